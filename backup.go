@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/server/backup"
+)
+
+const (
+	exportUsage  = "usage: syncrate export [-format json|csv] [-credentials] FILE"
+	restoreUsage = "usage: syncrate restore [-replace] FILE"
+)
+
+// runExport handles the "export" subcommand
+func runExport(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "json", "table file format, json or csv")
+	credentials := flags.Bool("credentials", false, "include password hashes and emails so accounts keep working after a restore")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(exportUsage)
+	}
+	encoding, err := backup.ParseEncoding(*format)
+	if err != nil {
+		return err
+	}
+
+	path := flags.Arg(0)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	manifest, err := backup.Export(backup.SQLDatabase{DB: db.DB}, file, backup.ExportOptions{Encoding: encoding, Credentials: *credentials})
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write backup file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	fmt.Printf("Wrote %s (schema version %d, %s)\n", path, manifest.SchemaVersion, manifest.Encoding)
+	for _, table := range manifest.Tables {
+		fmt.Printf("  %-14s %d rows\n", table.Name, table.Rows)
+	}
+	return nil
+}
+
+// runRestore handles the "restore" subcommand
+func runRestore(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	replace := flags.Bool("replace", false, "delete the current catalog and votes before restoring")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(restoreUsage)
+	}
+
+	// Restoring into an older schema would drop columns
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+
+	result, err := backup.Restore(backup.SQLDatabase{DB: db.DB}, file, info.Size(), backup.RestoreOptions{Replace: *replace})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s (exported %s)\n", flags.Arg(0), result.Manifest.CreatedAt.Format("2006-01-02 15:04:05"))
+	for _, table := range result.Manifest.Tables {
+		fmt.Printf("  %-14s %d rows\n", table.Name, result.Rows[table.Name])
+	}
+	fmt.Printf("Users: %d created, %d matched to existing accounts\n", result.UsersCreated, result.UsersMatched)
+	if !result.Manifest.Credentials && result.UsersCreated > 0 {
+		fmt.Println("The backup has no credentials; created users have no password and cannot log in")
+	}
+	return nil
+}
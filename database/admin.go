@@ -0,0 +1,436 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============= ADMIN =============
+
+// Snapshots of catalog entities as the audit log keeps them. Next to the
+// row they hold the links of an entity, and deleted songs also keep their
+// votes, so RestoreDeleted can undo a delete.
+type (
+	SongSnapshot struct {
+		models.Song
+		ArtistIDs []uint
+		UnitIDs   []uint
+		AlbumIDs  []uint
+		Votes     []models.Vote
+	}
+	ArtistSnapshot struct {
+		models.Artist
+		UnitIDs []uint
+		SongIDs []uint
+	}
+	UnitSnapshot struct {
+		models.Unit
+		ArtistIDs []uint
+		SongIDs   []uint
+	}
+	AlbumSnapshot struct {
+		models.Album
+		SongIDs []uint
+	}
+)
+
+// CatalogCounts is how many of each catalog entity are outside the trash
+type CatalogCounts struct {
+	Categories int64
+	Units      int64
+	Artists    int64
+	Albums     int64
+	Songs      int64
+}
+
+// NewSongSnapshot makes the snapshot of a song from its loaded relations
+func NewSongSnapshot(song models.Song) SongSnapshot {
+	snapshot := SongSnapshot{Song: song}
+	for _, artist := range song.Artists {
+		snapshot.ArtistIDs = append(snapshot.ArtistIDs, artist.ArtistID)
+	}
+	for _, unit := range song.Units {
+		snapshot.UnitIDs = append(snapshot.UnitIDs, unit.UnitID)
+	}
+	for _, album := range song.Albums {
+		snapshot.AlbumIDs = append(snapshot.AlbumIDs, album.AlbumID)
+	}
+	snapshot.Song.Category, snapshot.Song.Artists, snapshot.Song.Units, snapshot.Song.Albums = nil, nil, nil, nil
+	return snapshot
+}
+
+// NewArtistSnapshot makes the snapshot of an artist from its loaded relations
+func NewArtistSnapshot(artist models.Artist) ArtistSnapshot {
+	snapshot := ArtistSnapshot{Artist: artist}
+	for _, unit := range artist.Units {
+		snapshot.UnitIDs = append(snapshot.UnitIDs, unit.UnitID)
+	}
+	for _, song := range artist.Songs {
+		snapshot.SongIDs = append(snapshot.SongIDs, song.SongID)
+	}
+	snapshot.Artist.Category, snapshot.Artist.Units, snapshot.Artist.Songs = nil, nil, nil
+	return snapshot
+}
+
+// NewUnitSnapshot makes the snapshot of a unit from its loaded relations
+func NewUnitSnapshot(unit models.Unit) UnitSnapshot {
+	snapshot := UnitSnapshot{Unit: unit}
+	for _, artist := range unit.Artists {
+		snapshot.ArtistIDs = append(snapshot.ArtistIDs, artist.ArtistID)
+	}
+	snapshot.Unit.Category, snapshot.Unit.Artists = nil, nil
+	return snapshot
+}
+
+// NewAlbumSnapshot makes the snapshot of an album from its loaded relations
+func NewAlbumSnapshot(album models.Album) AlbumSnapshot {
+	snapshot := AlbumSnapshot{Album: album}
+	for _, song := range album.Songs {
+		snapshot.SongIDs = append(snapshot.SongIDs, song.SongID)
+	}
+	snapshot.Album.Category, snapshot.Album.Songs = nil, nil
+	return snapshot
+}
+
+func (db *Database) CountCatalog() (*CatalogCounts, error) {
+	counts := &CatalogCounts{}
+	tables := []struct {
+		model any
+		count *int64
+	}{
+		{&models.Category{}, &counts.Categories},
+		{&models.Unit{}, &counts.Units},
+		{&models.Artist{}, &counts.Artists},
+		{&models.Album{}, &counts.Albums},
+		{&models.Song{}, &counts.Songs},
+	}
+	for _, table := range tables {
+		if err := db.DB.Model(table.model).Count(table.count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count the catalog: %w", err)
+		}
+	}
+	return counts, nil
+}
+
+func (db *Database) GetSongByProvider(provider, providerID string) (*models.Song, error) {
+	var song models.Song
+	if err := db.DB.Where("provider = ? AND provider_id = ?", provider, providerID).First(&song).Error; err != nil {
+		return nil, fmt.Errorf("failed to get song by provider: %w", err)
+	}
+	return &song, nil
+}
+
+// relink adds join table rows from id to the other entities that exist.
+// Without trashed it skips those in the trash. The other table's key column
+// is named like its join table column.
+func relink(tx *gorm.DB, table, idColumn string, id uint, otherColumn, otherTable string, otherIDs []uint, trashed bool) error {
+	if len(otherIDs) == 0 {
+		return nil
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s) SELECT ?, %s FROM %s WHERE %s IN ?",
+		table, idColumn, otherColumn, otherColumn, otherTable, otherColumn)
+	if !trashed {
+		query += " AND deleted_at IS NULL"
+	}
+	if err := tx.Exec(query+" ON CONFLICT DO NOTHING", id, otherIDs).Error; err != nil {
+		return fmt.Errorf("failed to link %s: %w", table, err)
+	}
+	return nil
+}
+
+// setLinks replaces the join table rows from id with links to the other
+// entities outside the trash
+func setLinks(tx *gorm.DB, table, idColumn string, id uint, otherColumn, otherTable string, otherIDs []uint) error {
+	if err := tx.Exec("DELETE FROM "+table+" WHERE "+idColumn+" = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to clear %s: %w", table, err)
+	}
+	return relink(tx, table, idColumn, id, otherColumn, otherTable, otherIDs, false)
+}
+
+func (db *Database) SetSongLinks(songID uint, artistIDs, unitIDs, albumIDs []uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setLinks(tx, "song_artists", "song_id", songID, "artist_id", "artists", artistIDs); err != nil {
+			return err
+		}
+		if err := setLinks(tx, "song_units", "song_id", songID, "unit_id", "units", unitIDs); err != nil {
+			return err
+		}
+		return setLinks(tx, "album_songs", "song_id", songID, "album_id", "albums", albumIDs)
+	})
+}
+
+func (db *Database) SetArtistUnits(artistID uint, unitIDs []uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return setLinks(tx, "artist_units", "artist_id", artistID, "unit_id", "units", unitIDs)
+	})
+}
+
+func (db *Database) SetUnitArtists(unitID uint, artistIDs []uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return setLinks(tx, "artist_units", "unit_id", unitID, "artist_id", "artists", artistIDs)
+	})
+}
+
+// linkedIDs returns the IDs in column of the join table rows linked to id,
+// whether the entities they point at are in the trash or not
+func linkedIDs(tx *gorm.DB, table, idColumn string, id uint, column string) ([]uint, error) {
+	var ids []uint
+	if err := tx.Table(table).Where(idColumn+" = ?", id).Order(column).Pluck(column, &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", table, err)
+	}
+	return ids, nil
+}
+
+func (db *Database) GetSongSnapshot(songID uint, withVotes bool) (*SongSnapshot, error) {
+	snapshot := &SongSnapshot{}
+	if err := db.DB.First(&snapshot.Song, songID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get song: %w", err)
+	}
+	var err error
+	if snapshot.ArtistIDs, err = linkedIDs(db.DB, "song_artists", "song_id", songID, "artist_id"); err != nil {
+		return nil, err
+	}
+	if snapshot.UnitIDs, err = linkedIDs(db.DB, "song_units", "song_id", songID, "unit_id"); err != nil {
+		return nil, err
+	}
+	if snapshot.AlbumIDs, err = linkedIDs(db.DB, "album_songs", "song_id", songID, "album_id"); err != nil {
+		return nil, err
+	}
+	if withVotes {
+		if err := db.DB.Where("song_id = ?", songID).Order("vote_id").Find(&snapshot.Votes).Error; err != nil {
+			return nil, fmt.Errorf("failed to load votes: %w", err)
+		}
+	}
+	return snapshot, nil
+}
+
+func (db *Database) GetArtistSnapshot(artistID uint) (*ArtistSnapshot, error) {
+	snapshot := &ArtistSnapshot{}
+	if err := db.DB.First(&snapshot.Artist, artistID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get artist: %w", err)
+	}
+	var err error
+	if snapshot.UnitIDs, err = linkedIDs(db.DB, "artist_units", "artist_id", artistID, "unit_id"); err != nil {
+		return nil, err
+	}
+	if snapshot.SongIDs, err = linkedIDs(db.DB, "song_artists", "artist_id", artistID, "song_id"); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (db *Database) GetUnitSnapshot(unitID uint) (*UnitSnapshot, error) {
+	snapshot := &UnitSnapshot{}
+	if err := db.DB.First(&snapshot.Unit, unitID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get unit: %w", err)
+	}
+	var err error
+	if snapshot.ArtistIDs, err = linkedIDs(db.DB, "artist_units", "unit_id", unitID, "artist_id"); err != nil {
+		return nil, err
+	}
+	if snapshot.SongIDs, err = linkedIDs(db.DB, "song_units", "unit_id", unitID, "song_id"); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (db *Database) GetAlbumSnapshot(albumID uint) (*AlbumSnapshot, error) {
+	snapshot := &AlbumSnapshot{}
+	if err := db.DB.First(&snapshot.Album, albumID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get album: %w", err)
+	}
+	var err error
+	if snapshot.SongIDs, err = linkedIDs(db.DB, "album_songs", "album_id", albumID, "song_id"); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// getSnapshot loads the snapshot of a catalog entity of one of the Trash
+// types; songs come without their votes
+func getSnapshot(store Store, entityType string, id uint) (any, error) {
+	switch entityType {
+	case TrashSong:
+		return store.GetSongSnapshot(id, false)
+	case TrashArtist:
+		return store.GetArtistSnapshot(id)
+	case TrashUnit:
+		return store.GetUnitSnapshot(id)
+	case TrashAlbum:
+		return store.GetAlbumSnapshot(id)
+	case TrashCategory:
+		return store.GetCategoryByID(id)
+	}
+	return nil, fmt.Errorf("%w: %q has no snapshot", ErrValidation, entityType)
+}
+
+// rowExists reports whether a table has a row with the ID, in the trash or not
+func rowExists(tx *gorm.DB, table, idColumn string, id uint) (bool, error) {
+	var count int64
+	if err := tx.Table(table).Where(idColumn+" = ?", id).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check %s: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// existingCategory drops a category reference whose category is gone
+func existingCategory(tx *gorm.DB, categoryID *uint) (*uint, error) {
+	if categoryID == nil {
+		return nil, nil
+	}
+	exists, err := rowExists(tx, "categories", "category_id", *categoryID)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return categoryID, nil
+}
+
+func (db *Database) RestoreDeleted(entityType string, id uint, snapshot json.RawMessage) (any, error) {
+	var restored any
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		restored, err = (&Database{dsn: db.dsn, DB: tx}).restoreDeleted(entityType, id, snapshot)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+func (db *Database) restoreDeleted(entityType string, id uint, data json.RawMessage) (any, error) {
+	tx := db.DB
+	untrashed, err := RestoreTrashed(tx, entityType, id)
+	if err != nil {
+		return nil, err
+	}
+	if untrashed {
+		return getSnapshot(db, entityType, id)
+	}
+
+	spec := trashTables[entityType]
+	exists, err := rowExists(tx, spec.table, spec.idColumn, id)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: %s %d exists again", ErrValidation, entityType, id)
+	}
+
+	switch entityType {
+	case TrashCategory:
+		var category models.Category
+		if err := json.Unmarshal(data, &category); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		category.CategoryID = id
+		if err := tx.Create(&category).Error; err != nil {
+			return nil, fmt.Errorf("failed to restore category: %w", err)
+		}
+		return category, nil
+
+	case TrashUnit:
+		var snapshot UnitSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		snapshot.UnitID = id
+		if snapshot.CategoryID, err = existingCategory(tx, snapshot.CategoryID); err != nil {
+			return nil, err
+		}
+		if err := tx.Omit(clause.Associations).Create(&snapshot.Unit).Error; err != nil {
+			return nil, fmt.Errorf("failed to restore unit: %w", err)
+		}
+		if err := relink(tx, "artist_units", "unit_id", id, "artist_id", "artists", snapshot.ArtistIDs, true); err != nil {
+			return nil, err
+		}
+		if err := relink(tx, "song_units", "unit_id", id, "song_id", "songs", snapshot.SongIDs, true); err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+
+	case TrashArtist:
+		var snapshot ArtistSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		snapshot.ArtistID = id
+		if snapshot.CategoryID, err = existingCategory(tx, snapshot.CategoryID); err != nil {
+			return nil, err
+		}
+		if err := tx.Omit(clause.Associations).Create(&snapshot.Artist).Error; err != nil {
+			return nil, fmt.Errorf("failed to restore artist: %w", err)
+		}
+		if err := relink(tx, "artist_units", "artist_id", id, "unit_id", "units", snapshot.UnitIDs, true); err != nil {
+			return nil, err
+		}
+		if err := relink(tx, "song_artists", "artist_id", id, "song_id", "songs", snapshot.SongIDs, true); err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+
+	case TrashAlbum:
+		var snapshot AlbumSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		snapshot.AlbumID = id
+		if snapshot.CategoryID, err = existingCategory(tx, snapshot.CategoryID); err != nil {
+			return nil, err
+		}
+		if err := tx.Omit(clause.Associations).Create(&snapshot.Album).Error; err != nil {
+			return nil, fmt.Errorf("failed to restore album: %w", err)
+		}
+		if err := relink(tx, "album_songs", "album_id", id, "song_id", "songs", snapshot.SongIDs, true); err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+
+	case TrashSong:
+		var snapshot SongSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		snapshot.SongID = id
+		if snapshot.CategoryID, err = existingCategory(tx, snapshot.CategoryID); err != nil {
+			return nil, err
+		}
+		if err := tx.Omit(clause.Associations).Create(&snapshot.Song).Error; err != nil {
+			return nil, fmt.Errorf("failed to restore song: %w", err)
+		}
+		if err := relink(tx, "song_artists", "song_id", id, "artist_id", "artists", snapshot.ArtistIDs, true); err != nil {
+			return nil, err
+		}
+		if err := relink(tx, "song_units", "song_id", id, "unit_id", "units", snapshot.UnitIDs, true); err != nil {
+			return nil, err
+		}
+		if err := relink(tx, "album_songs", "song_id", id, "album_id", "albums", snapshot.AlbumIDs, true); err != nil {
+			return nil, err
+		}
+
+		// Votes of deleted users stay gone
+		votes := make([]models.Vote, 0, len(snapshot.Votes))
+		for _, vote := range snapshot.Votes {
+			exists, err := rowExists(tx, "users", "user_id", vote.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				vote.SongID = id
+				votes = append(votes, vote)
+			}
+		}
+		if len(votes) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&votes).Error; err != nil {
+				return nil, fmt.Errorf("failed to restore votes: %w", err)
+			}
+		}
+		snapshot.Votes = votes
+		return snapshot, nil
+	}
+	return nil, fmt.Errorf("%w: %s deletes cannot be restored", ErrValidation, entityType)
+}
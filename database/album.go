@@ -34,16 +34,15 @@ func (db *Database) validateAlbum(album *models.Album, isUpdate bool) error {
 		}
 	}
 
-	// Type validation (must be one of the allowed values)
-	if album.Type != "" {
-		validTypes := map[string]bool{
-			"Album":  true,
-			"Single": true,
-			"EP":     true,
-		}
-		if !validTypes[album.Type] {
-			return errors.New("album type must be one of: Album, Single, EP")
-		}
+	// Type validation (must be one of the allowed values, as chk_albums_type
+	// requires)
+	validTypes := map[string]bool{
+		"Album":  true,
+		"Single": true,
+		"EP":     true,
+	}
+	if !validTypes[album.Type] {
+		return errors.New("album type must be one of: Album, Single, EP")
 	}
 
 	// CategoryID validation (if provided)
@@ -62,7 +61,7 @@ func (db *Database) validateAlbum(album *models.Album, isUpdate bool) error {
 
 func (db *Database) CreateAlbum(album *models.Album) error {
 	if err := db.validateAlbum(album, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Create(album).Error; err != nil {
@@ -83,6 +82,19 @@ func (db *Database) GetAlbumByID(albumID uint) (*models.Album, error) {
 	return &album, nil
 }
 
+// GetAlbumsByIDs returns the albums with the given IDs without their relations
+func (db *Database) GetAlbumsByIDs(albumIDs []uint) ([]models.Album, error) {
+	var albums []models.Album
+	if len(albumIDs) == 0 {
+		return albums, nil
+	}
+
+	if err := db.DB.Where("album_id IN ?", albumIDs).Find(&albums).Error; err != nil {
+		return nil, fmt.Errorf("failed to get albums by IDs: %w", err)
+	}
+	return albums, nil
+}
+
 func (db *Database) GetAlbumsByName(name string) ([]models.Album, error) {
 	if strings.TrimSpace(name) == "" {
 		return nil, errors.New("name cannot be empty")
@@ -151,6 +163,34 @@ func (db *Database) GetAllAlbums() ([]models.Album, error) {
 	return albums, nil
 }
 
+func (db *Database) ListAlbums(filter AlbumFilter, opts ListOptions) (*Page[models.Album], error) {
+	opts, cursor, err := PrepareList(opts, AlbumListing)
+	if err != nil {
+		return nil, err
+	}
+
+	query := preloadIncludes(db.DB.Model(&models.Album{}), opts.Include)
+	if filter.CategoryID != nil {
+		query = query.Where("albums.category_id = ?", *filter.CategoryID)
+	}
+	if filter.Type != "" {
+		query = query.Where("albums.type = ?", filter.Type)
+	}
+	if filter.SongID != nil {
+		query = query.Where("albums.album_id IN (?)",
+			db.DB.Table("album_songs").Select("album_id").Where("song_id = ?", *filter.SongID))
+	}
+	query = applyKeyset(query, namedSortColumn("albums", opts.Sort), "albums.album_id", opts, cursor)
+
+	var albums []models.Album
+	if err := query.Find(&albums).Error; err != nil {
+		return nil, fmt.Errorf("failed to list albums: %w", err)
+	}
+	return NewPage(albums, opts, func(album models.Album) (any, uint) {
+		return NamedSortValue(opts.Sort, album.NameOriginal, album.CreatedAt), album.AlbumID
+	}), nil
+}
+
 func (db *Database) UpdateAlbum(album *models.Album) error {
 	if album == nil {
 		return errors.New("album cannot be nil")
@@ -170,7 +210,7 @@ func (db *Database) UpdateAlbum(album *models.Album) error {
 
 	// Validate the updated album data
 	if err := db.validateAlbum(album, true); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Save(album).Error; err != nil {
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+)
+
+// ============= API TOKENS =============
+
+func (db *Database) CreateAPIToken(token *models.APIToken) error {
+	if token.UserID == 0 {
+		return errors.New("user ID cannot be zero")
+	}
+	if strings.TrimSpace(token.Name) == "" {
+		return fmt.Errorf("%w: token name cannot be empty", ErrValidation)
+	}
+	if err := db.DB.Create(token).Error; err != nil {
+		return fmt.Errorf("failed to create API token: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) GetAPITokenByHash(tokenHash string) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := db.DB.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	return &token, nil
+}
+
+func (db *Database) GetAPITokensByUser(userID uint) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (db *Database) RevokeAPIToken(userID, tokenID uint) error {
+	result := db.DB.Model(&models.APIToken{}).
+		Where("token_id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke API token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to revoke API token: %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (db *Database) TouchAPIToken(tokenID uint, usedAt time.Time) error {
+	if err := db.DB.Model(&models.APIToken{}).Where("token_id = ?", tokenID).
+		Update("last_used_at", usedAt).Error; err != nil {
+		return fmt.Errorf("failed to touch API token: %w", err)
+	}
+	return nil
+}
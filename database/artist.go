@@ -89,7 +89,7 @@ func (db *Database) validateHexColor(color string) error {
 
 func (db *Database) CreateArtist(artist *models.Artist) error {
 	if err := db.validateArtist(artist, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Create(artist).Error; err != nil {
@@ -110,6 +110,19 @@ func (db *Database) GetArtistByID(artistID uint) (*models.Artist, error) {
 	return &artist, nil
 }
 
+// GetArtistsByIDs returns the artists with the given IDs without their relations
+func (db *Database) GetArtistsByIDs(artistIDs []uint) ([]models.Artist, error) {
+	var artists []models.Artist
+	if len(artistIDs) == 0 {
+		return artists, nil
+	}
+
+	if err := db.DB.Where("artist_id IN ?", artistIDs).Find(&artists).Error; err != nil {
+		return nil, fmt.Errorf("failed to get artists by IDs: %w", err)
+	}
+	return artists, nil
+}
+
 func (db *Database) GetArtistsByName(name string) ([]models.Artist, error) {
 	if strings.TrimSpace(name) == "" {
 		return nil, errors.New("name cannot be empty")
@@ -155,6 +168,31 @@ func (db *Database) GetAllArtists() ([]models.Artist, error) {
 	return artists, nil
 }
 
+func (db *Database) ListArtists(filter ArtistFilter, opts ListOptions) (*Page[models.Artist], error) {
+	opts, cursor, err := PrepareList(opts, ArtistListing)
+	if err != nil {
+		return nil, err
+	}
+
+	query := preloadIncludes(db.DB.Model(&models.Artist{}), opts.Include)
+	if filter.CategoryID != nil {
+		query = query.Where("artists.category_id = ?", *filter.CategoryID)
+	}
+	if filter.UnitID != nil {
+		query = query.Where("artists.artist_id IN (?)",
+			db.DB.Table("artist_units").Select("artist_id").Where("unit_id = ?", *filter.UnitID))
+	}
+	query = applyKeyset(query, namedSortColumn("artists", opts.Sort), "artists.artist_id", opts, cursor)
+
+	var artists []models.Artist
+	if err := query.Find(&artists).Error; err != nil {
+		return nil, fmt.Errorf("failed to list artists: %w", err)
+	}
+	return NewPage(artists, opts, func(artist models.Artist) (any, uint) {
+		return NamedSortValue(opts.Sort, artist.NameOriginal, artist.CreatedAt), artist.ArtistID
+	}), nil
+}
+
 func (db *Database) UpdateArtist(artist *models.Artist) error {
 	if artist == nil {
 		return errors.New("artist cannot be nil")
@@ -174,7 +212,7 @@ func (db *Database) UpdateArtist(artist *models.Artist) error {
 
 	// Validate the updated artist data
 	if err := db.validateArtist(artist, true); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Save(artist).Error; err != nil {
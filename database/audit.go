@@ -0,0 +1,80 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+// ============= AUDIT LOG =============
+
+// validateAuditEvent checks the fields every audit event needs
+func validateAuditEvent(event *models.AuditEvent) error {
+	if event == nil {
+		return errors.New("audit event cannot be nil")
+	}
+	if strings.TrimSpace(event.Action) == "" {
+		return fmt.Errorf("%w: audit action cannot be empty", ErrValidation)
+	}
+	if strings.TrimSpace(event.EntityType) == "" {
+		return fmt.Errorf("%w: audit entity type cannot be empty", ErrValidation)
+	}
+	return nil
+}
+
+// RecordAuditEvent writes an audit event with tx, so it can be part of the
+// transaction that makes the change
+func RecordAuditEvent(tx *gorm.DB, event *models.AuditEvent) error {
+	if err := validateAuditEvent(event); err != nil {
+		return err
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) RecordAuditEvent(event *models.AuditEvent) error {
+	return RecordAuditEvent(db.DB, event)
+}
+
+func (db *Database) GetAuditEvent(eventID uint) (*models.AuditEvent, error) {
+	var event models.AuditEvent
+	if err := db.DB.First(&event, eventID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get audit event: %w", err)
+	}
+	return &event, nil
+}
+
+func (db *Database) ListAuditEvents(filter AuditFilter, opts ListOptions) (*Page[models.AuditEvent], error) {
+	opts, cursor, err := PrepareList(opts, AuditListing)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.DB.Model(&models.AuditEvent{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	query = applyKeyset(query, "audit_events.created_at", "audit_events.event_id", opts, cursor)
+
+	var events []models.AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return NewPage(events, opts, func(event models.AuditEvent) (any, uint) {
+		return event.CreatedAt, event.EventID
+	}), nil
+}
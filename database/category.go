@@ -37,7 +37,7 @@ func (db *Database) validateCategory(category *models.Category, isUpdate bool) e
 
 func (db *Database) CreateCategory(category *models.Category) error {
 	if err := db.validateCategory(category, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Create(category).Error; err != nil {
@@ -115,7 +115,7 @@ func (db *Database) UpdateCategory(category *models.Category) error {
 
 	// Validate the updated category data
 	if err := db.validateCategory(category, true); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Save(category).Error; err != nil {
@@ -138,11 +138,6 @@ func (db *Database) DeleteCategory(categoryID uint) error {
 		return errors.New("category does not exist")
 	}
 
-	// Check if category is being used by any entities
-	if err := db.checkCategoryUsage(categoryID); err != nil {
-		return fmt.Errorf("cannot delete category: %w", err)
-	}
-
 	if err := db.DB.Delete(&models.Category{}, categoryID).Error; err != nil {
 		return fmt.Errorf("failed to delete category: %w", err)
 	}
@@ -173,44 +168,6 @@ func (db *Database) CategoryNameExists(name string) (bool, error) {
 	return count > 0, nil
 }
 
-func (db *Database) checkCategoryUsage(categoryID uint) error {
-	var count int64
-
-	// Check songs
-	if err := db.DB.Model(&models.Song{}).Where("category_id = ?", categoryID).Count(&count).Error; err != nil {
-		return fmt.Errorf("failed to check category usage in songs: %w", err)
-	}
-	if count > 0 {
-		return fmt.Errorf("%d songs are using this category", count)
-	}
-
-	// Check artists
-	if err := db.DB.Model(&models.Artist{}).Where("category_id = ?", categoryID).Count(&count).Error; err != nil {
-		return fmt.Errorf("failed to check category usage in artists: %w", err)
-	}
-	if count > 0 {
-		return fmt.Errorf("%d artists are using this category", count)
-	}
-
-	// Check albums
-	if err := db.DB.Model(&models.Album{}).Where("category_id = ?", categoryID).Count(&count).Error; err != nil {
-		return fmt.Errorf("failed to check category usage in albums: %w", err)
-	}
-	if count > 0 {
-		return fmt.Errorf("%d albums are using this category", count)
-	}
-
-	// Check units
-	if err := db.DB.Model(&models.Unit{}).Where("category_id = ?", categoryID).Count(&count).Error; err != nil {
-		return fmt.Errorf("failed to check category usage in units: %w", err)
-	}
-	if count > 0 {
-		return fmt.Errorf("%d units are using this category", count)
-	}
-
-	return nil
-}
-
 func (db *Database) SearchCategories(query string) ([]models.Category, error) {
 	if strings.TrimSpace(query) == "" {
 		return db.GetAllCategories()
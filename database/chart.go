@@ -0,0 +1,285 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+// ============= CHARTS =============
+
+// ChartSize is how many songs each chart keeps
+const ChartSize = 100
+
+// How the top charts score a song's ratings
+const (
+	// ChartScoringBayesian averages the ratings together with PriorVotes
+	// votes at the prior mean
+	ChartScoringBayesian = "bayesian"
+	// ChartScoringWilson takes the lower bound of the 95% Wilson interval of
+	// the ratings scaled to 0..1
+	ChartScoringWilson = "wilson"
+)
+
+// ChartScorings lists every scoring method; the first is the default
+var ChartScorings = []string{ChartScoringBayesian, ChartScoringWilson}
+
+// wilsonZ is the normal quantile of a two-sided 95% confidence interval
+const wilsonZ = 1.96
+
+// ChartOptions tunes how ComputeCharts ranks songs
+type ChartOptions struct {
+	Scoring string // ChartScoringBayesian or ChartScoringWilson
+	// PriorVotes is how many votes at PriorMean every song starts out with
+	// under ChartScoringBayesian
+	PriorVotes float64
+	// PriorMean is the rating of a song nobody rated yet; 0 uses the
+	// average of all votes
+	PriorMean float64
+	// MinVotes is how many votes a song needs for the top and divisive
+	// charts of a scope
+	MinVotes int
+	// RisingWindow is how far back the rising charts look
+	RisingWindow time.Duration
+}
+
+// DefaultChartOptions are the chart options unless configured otherwise
+var DefaultChartOptions = ChartOptions{
+	Scoring:      ChartScoringBayesian,
+	PriorVotes:   5,
+	MinVotes:     3,
+	RisingWindow: 14 * 24 * time.Hour,
+}
+
+// chartTotals adds up the votes of one song in one scope
+type chartTotals struct {
+	votes           int64
+	sum, sumSquares float64
+	momentum        float64 // Recent votes, see ComputeCharts
+}
+
+func (t *chartTotals) mean() float64 {
+	return t.sum / float64(t.votes)
+}
+
+func (t *chartTotals) variance() float64 {
+	mean := t.mean()
+	return max(t.sumSquares/float64(t.votes)-mean*mean, 0)
+}
+
+// topScore is the score of a song in the top charts
+func (opts ChartOptions) topScore(t *chartTotals, priorMean float64) float64 {
+	n := float64(t.votes)
+	if opts.Scoring == ChartScoringWilson {
+		p := (t.mean() - 1) / 9
+		z2 := wilsonZ * wilsonZ
+		lower := (p + z2/(2*n) - wilsonZ*math.Sqrt(p*(1-p)/n+z2/(4*n*n))) / (1 + z2/n)
+		return 1 + 9*lower
+	}
+	return (opts.PriorVotes*priorMean + t.sum) / (opts.PriorVotes + n)
+}
+
+// chartKey identifies the songs one set of charts is kept for
+type chartKey struct {
+	scope string
+	id    uint
+}
+
+// ComputeCharts ranks the songs of every scope from the votes:
+//   - top by the score of their ratings, see ChartOptions.Scoring
+//   - divisive by the variance of their ratings
+//   - rising by their votes of the last RisingWindow, where a vote counts
+//     more the newer and higher it is
+//
+// Year scopes only have top and divisive charts of the votes cast that year.
+// Votes of songs not among songs are left out.
+func ComputeCharts(votes []models.Vote, songs []models.Song, opts ChartOptions, now time.Time) []models.ChartEntry {
+	scopes := make(map[uint][]chartKey, len(songs))
+	for _, song := range songs {
+		keys := []chartKey{{models.ChartScopeOverall, 0}}
+		if song.Category != nil {
+			keys = append(keys, chartKey{models.ChartScopeCategory, song.Category.CategoryID})
+		}
+		for _, artist := range song.Artists {
+			keys = append(keys, chartKey{models.ChartScopeArtist, artist.ArtistID})
+		}
+		for _, unit := range song.Units {
+			keys = append(keys, chartKey{models.ChartScopeUnit, unit.UnitID})
+		}
+		for _, album := range song.Albums {
+			keys = append(keys, chartKey{models.ChartScopeAlbum, album.AlbumID})
+		}
+		scopes[song.SongID] = keys
+	}
+
+	totals := make(map[chartKey]map[uint]*chartTotals)
+	add := func(key chartKey, songID uint, rating, momentum float64) {
+		songTotals := totals[key]
+		if songTotals == nil {
+			songTotals = make(map[uint]*chartTotals)
+			totals[key] = songTotals
+		}
+		t := songTotals[songID]
+		if t == nil {
+			t = &chartTotals{}
+			songTotals[songID] = t
+		}
+		t.votes++
+		t.sum += rating
+		t.sumSquares += rating * rating
+		t.momentum += momentum
+	}
+
+	var sum float64
+	var count int
+	for _, vote := range votes {
+		keys, ok := scopes[vote.SongID]
+		if !ok {
+			continue
+		}
+		rating := float64(vote.Rating)
+		sum += rating
+		count++
+
+		momentum := 0.0
+		if age := now.Sub(vote.CreatedAt); age >= 0 && age < opts.RisingWindow {
+			momentum = (1 - float64(age)/float64(opts.RisingWindow)) * rating / 10
+		}
+		for _, key := range keys {
+			add(key, vote.SongID, rating, momentum)
+		}
+		if !vote.CreatedAt.IsZero() {
+			add(chartKey{models.ChartScopeYear, uint(vote.CreatedAt.Year())}, vote.SongID, rating, 0)
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+
+	priorMean := opts.PriorMean
+	if priorMean == 0 {
+		priorMean = sum / float64(count)
+	}
+	minVotes := int64(max(opts.MinVotes, 1))
+
+	var entries []models.ChartEntry
+	for key, songTotals := range totals {
+		entries = append(entries, rankChart(models.ChartTop, key, songTotals, now, func(t *chartTotals) (float64, bool) {
+			return opts.topScore(t, priorMean), t.votes >= minVotes
+		})...)
+		entries = append(entries, rankChart(models.ChartDivisive, key, songTotals, now, func(t *chartTotals) (float64, bool) {
+			// It takes two to disagree
+			variance := t.variance()
+			return variance, t.votes >= max(minVotes, 2) && variance > 0
+		})...)
+		if key.scope != models.ChartScopeYear {
+			entries = append(entries, rankChart(models.ChartRising, key, songTotals, now, func(t *chartTotals) (float64, bool) {
+				return t.momentum, t.momentum > 0
+			})...)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Chart != b.Chart {
+			return a.Chart < b.Chart
+		}
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		if a.ScopeID != b.ScopeID {
+			return a.ScopeID < b.ScopeID
+		}
+		return a.Rank < b.Rank
+	})
+	return entries
+}
+
+// rankChart ranks the songs score admits by their score, then by their vote
+// count, and keeps the first ChartSize
+func rankChart(chart string, key chartKey, songTotals map[uint]*chartTotals, now time.Time, score func(*chartTotals) (float64, bool)) []models.ChartEntry {
+	type candidate struct {
+		songID uint
+		score  float64
+		totals *chartTotals
+	}
+	var candidates []candidate
+	for songID, t := range songTotals {
+		if s, ok := score(t); ok {
+			candidates = append(candidates, candidate{songID, s, t})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.totals.votes != b.totals.votes {
+			return a.totals.votes > b.totals.votes
+		}
+		return a.songID < b.songID
+	})
+
+	entries := make([]models.ChartEntry, 0, min(len(candidates), ChartSize))
+	for i, c := range candidates[:min(len(candidates), ChartSize)] {
+		entries = append(entries, models.ChartEntry{
+			Chart:         chart,
+			Scope:         key.scope,
+			ScopeID:       key.id,
+			Rank:          i + 1,
+			SongID:        c.songID,
+			Score:         c.score,
+			AverageRating: c.totals.mean(),
+			VoteCount:     c.totals.votes,
+			RefreshedAt:   now,
+		})
+	}
+	return entries
+}
+
+// ReplaceChartEntries swaps all charts for freshly computed ones in one
+// transaction
+func (db *Database) ReplaceChartEntries(entries []models.ChartEntry) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM chart_entries").Error; err != nil {
+			return fmt.Errorf("failed to clear charts: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(entries, 1000).Error; err != nil {
+			return fmt.Errorf("failed to save charts: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetChart lists the entries of one chart by rank, leaving out songs in the
+// trash
+func (db *Database) GetChart(chart, scope string, scopeID uint) ([]models.ChartEntry, error) {
+	var entries []models.ChartEntry
+	if err := db.DB.Where("chart = ? AND scope = ? AND scope_id = ?", chart, scope, scopeID).
+		Where("song_id NOT IN (?)", db.DB.Table("songs").Select("song_id").Where("deleted_at IS NOT NULL")).
+		Order("rank").
+		Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to get chart: %w", err)
+	}
+	return entries, nil
+}
+
+// GetChartScopeIDs lists the IDs of a scope that have charts, in order
+func (db *Database) GetChartScopeIDs(scope string) ([]uint, error) {
+	var ids []uint
+	if err := db.DB.Model(&models.ChartEntry{}).
+		Where("scope = ?", scope).
+		Distinct("scope_id").
+		Order("scope_id").
+		Pluck("scope_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to get chart scopes: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,125 @@
+package database_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+)
+
+func TestComputeCharts(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-24 * time.Hour)
+	earlier := now.Add(-20 * 24 * time.Hour)
+	lastYear := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	songs := []models.Song{
+		{SongID: 1, Artists: []models.Artist{{ArtistID: 7}}},
+		{SongID: 2},
+		{SongID: 3},
+		{SongID: 4},
+	}
+	votes := []models.Vote{
+		{SongID: 1, Rating: 10, CreatedAt: recent},
+		{SongID: 1, Rating: 10, CreatedAt: recent},
+		{SongID: 2, Rating: 6, CreatedAt: earlier},
+		{SongID: 2, Rating: 6, CreatedAt: earlier},
+		{SongID: 2, Rating: 6, CreatedAt: earlier},
+		{SongID: 3, Rating: 1, CreatedAt: lastYear},
+		{SongID: 3, Rating: 10, CreatedAt: lastYear},
+		{SongID: 4, Rating: 10, CreatedAt: earlier}, // Too few votes
+		{SongID: 99, Rating: 1, CreatedAt: recent},  // Not a song
+	}
+	opts := database.ChartOptions{
+		Scoring:      database.ChartScoringBayesian,
+		PriorVotes:   2,
+		PriorMean:    5,
+		MinVotes:     2,
+		RisingWindow: 10 * 24 * time.Hour,
+	}
+
+	type ranked struct {
+		songID uint
+		score  float64
+	}
+	charts := make(map[string][]ranked)
+	for _, entry := range database.ComputeCharts(votes, songs, opts, now) {
+		chart := entry.Chart + " " + entry.Scope
+		if entry.ScopeID != 0 {
+			chart += fmt.Sprintf(" %d", entry.ScopeID)
+		}
+		if len(charts[chart])+1 != entry.Rank {
+			t.Errorf("%s: rank %d follows %d entries", chart, entry.Rank, len(charts[chart]))
+		}
+		charts[chart] = append(charts[chart], ranked{entry.SongID, entry.Score})
+	}
+
+	tests := []struct {
+		chart string
+		want  []ranked
+	}{
+		// (2*5 + ratings) / (2 + votes)
+		{"top overall", []ranked{{1, 7.5}, {2, 5.6}, {3, 5.25}}},
+		{"divisive overall", []ranked{{3, 20.25}}},
+		// Each recent vote counts (1 - 1/10) * 10/10
+		{"rising overall", []ranked{{1, 1.8}}},
+		{"top artist 7", []ranked{{1, 7.5}}},
+		{"top year 2023", []ranked{{3, 5.25}}},
+		{"top year 2024", []ranked{{1, 7.5}, {2, 5.6}}},
+		{"rising year 2024", nil},
+	}
+	for _, tt := range tests {
+		got := charts[tt.chart]
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.chart, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].songID != tt.want[i].songID || math.Abs(got[i].score-tt.want[i].score) > 1e-9 {
+				t.Errorf("%s: got %v, want %v", tt.chart, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestComputeChartsScoring(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	songs := []models.Song{{SongID: 1}, {SongID: 2}}
+	var votes []models.Vote
+	for i := 0; i < 2; i++ {
+		votes = append(votes, models.Vote{SongID: 1, Rating: 10, CreatedAt: now})
+	}
+	for i := 0; i < 8; i++ {
+		votes = append(votes, models.Vote{SongID: 2, Rating: 9, CreatedAt: now})
+	}
+
+	tests := []struct {
+		scoring string
+		want    []uint
+	}{
+		// Against the mean of all votes, 9.2, two perfect votes still win
+		{database.ChartScoringBayesian, []uint{1, 2}},
+		// Two votes leave a wide interval, eight near-perfect ones do not
+		{database.ChartScoringWilson, []uint{2, 1}},
+	}
+	for _, tt := range tests {
+		opts := database.ChartOptions{Scoring: tt.scoring, PriorVotes: 5, MinVotes: 1, RisingWindow: time.Hour}
+		var got []uint
+		for _, entry := range database.ComputeCharts(votes, songs, opts, now) {
+			if entry.Chart == models.ChartTop && entry.Scope == models.ChartScopeOverall {
+				got = append(got, entry.SongID)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: top chart %v, want %v", tt.scoring, got, tt.want)
+		}
+	}
+
+	if entries := database.ComputeCharts(nil, songs, database.DefaultChartOptions, now); len(entries) != 0 {
+		t.Errorf("charts without votes: %+v", entries)
+	}
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ============= COMPATIBILITY =============
+
+// Compatibility is how alike two users rate the songs both of them rated.
+// UserA is always the lower user ID.
+type Compatibility struct {
+	UserA   uint  `json:"user_a"`
+	UserB   uint  `json:"user_b"`
+	Overlap int64 `json:"overlap"` // Songs both users rated
+	// Correlation is the Pearson correlation of their ratings, from -1 to 1.
+	// It is nil with fewer than two shared songs or when either user gave
+	// all of them the same rating.
+	Correlation            *float64 `json:"correlation"`
+	MeanAbsoluteDifference float64  `json:"mean_absolute_difference"`
+}
+
+// SharedRating is a song two users both rated
+type SharedRating struct {
+	SongID       uint   `json:"song_id"`
+	NameOriginal string `json:"name_original"`
+	NameEnglish  string `json:"name_english"`
+	RatingA      int    `json:"rating_a"`
+	RatingB      int    `json:"rating_b"`
+}
+
+// CompareRatings computes the compatibility of two users from the songs
+// both of them rated
+func CompareRatings(userA, userB uint, shared []SharedRating) Compatibility {
+	if userA > userB {
+		userA, userB = userB, userA
+		swapped := make([]SharedRating, len(shared))
+		for i, rating := range shared {
+			swapped[i] = rating
+			swapped[i].RatingA, swapped[i].RatingB = rating.RatingB, rating.RatingA
+		}
+		shared = swapped
+	}
+	compatibility := Compatibility{UserA: userA, UserB: userB, Overlap: int64(len(shared))}
+	if len(shared) == 0 {
+		return compatibility
+	}
+
+	n := float64(len(shared))
+	var sumA, sumB, difference float64
+	for _, rating := range shared {
+		sumA += float64(rating.RatingA)
+		sumB += float64(rating.RatingB)
+		difference += math.Abs(float64(rating.RatingA - rating.RatingB))
+	}
+	compatibility.MeanAbsoluteDifference = difference / n
+
+	meanA, meanB := sumA/n, sumB/n
+	var covariance, varianceA, varianceB float64
+	for _, rating := range shared {
+		a, b := float64(rating.RatingA)-meanA, float64(rating.RatingB)-meanB
+		covariance += a * b
+		varianceA += a * a
+		varianceB += b * b
+	}
+	if varianceA > 0 && varianceB > 0 {
+		correlation := covariance / math.Sqrt(varianceA*varianceB)
+		compatibility.Correlation = &correlation
+	}
+	return compatibility
+}
+
+// SortCompatibility orders pairs most compatible first: by correlation, then
+// by the smaller difference, then by the larger overlap. Pairs without a
+// correlation come last.
+func SortCompatibility(pairs []Compatibility) {
+	sort.SliceStable(pairs, func(i, j int) bool {
+		a, b := pairs[i], pairs[j]
+		if (a.Correlation == nil) != (b.Correlation == nil) {
+			return a.Correlation != nil
+		}
+		if a.Correlation != nil && *a.Correlation != *b.Correlation {
+			return *a.Correlation > *b.Correlation
+		}
+		if a.MeanAbsoluteDifference != b.MeanAbsoluteDifference {
+			return a.MeanAbsoluteDifference < b.MeanAbsoluteDifference
+		}
+		if a.Overlap != b.Overlap {
+			return a.Overlap > b.Overlap
+		}
+		if a.UserA != b.UserA {
+			return a.UserA < b.UserA
+		}
+		return a.UserB < b.UserB
+	})
+}
+
+// GetCompatibility compares every pair of the given users who rated at least
+// one same song, most compatible first
+func (db *Database) GetCompatibility(userIDs []uint) ([]Compatibility, error) {
+	var pairs []Compatibility
+	if len(userIDs) < 2 {
+		return pairs, nil
+	}
+
+	if err := db.DB.Table("votes AS a").
+		Select("a.user_id AS user_a, b.user_id AS user_b, COUNT(*) AS overlap, "+
+			"CORR(a.rating::float8, b.rating::float8) AS correlation, "+
+			"AVG(ABS(a.rating - b.rating))::float8 AS mean_absolute_difference").
+		Joins("JOIN votes AS b ON b.song_id = a.song_id AND b.user_id > a.user_id").
+		Joins("JOIN songs ON songs.song_id = a.song_id AND songs.deleted_at IS NULL").
+		Where("a.user_id IN ? AND b.user_id IN ?", userIDs, userIDs).
+		Group("a.user_id, b.user_id").
+		Scan(&pairs).Error; err != nil {
+		return nil, fmt.Errorf("failed to compare users: %w", err)
+	}
+	SortCompatibility(pairs)
+	return pairs, nil
+}
+
+// GetSharedRatings lists the songs two users both rated, with RatingA the
+// rating of userA
+func (db *Database) GetSharedRatings(userA, userB uint) ([]SharedRating, error) {
+	for _, userID := range []uint{userA, userB} {
+		if _, err := db.GetUserByID(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	var shared []SharedRating
+	if err := db.DB.Table("votes AS a").
+		Select("a.song_id, songs.name_original, songs.name_english, a.rating AS rating_a, b.rating AS rating_b").
+		Joins("JOIN votes AS b ON b.song_id = a.song_id AND b.user_id = ?", userB).
+		Joins("JOIN songs ON songs.song_id = a.song_id AND songs.deleted_at IS NULL").
+		Where("a.user_id = ?", userA).
+		Order("a.song_id").
+		Scan(&shared).Error; err != nil {
+		return nil, fmt.Errorf("failed to load shared ratings: %w", err)
+	}
+	return shared, nil
+}
@@ -0,0 +1,64 @@
+package database_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+)
+
+// ratings builds shared ratings from pairs of ratings
+func ratings(pairs ...[2]int) []database.SharedRating {
+	shared := make([]database.SharedRating, len(pairs))
+	for i, pair := range pairs {
+		shared[i] = database.SharedRating{SongID: uint(i + 1), RatingA: pair[0], RatingB: pair[1]}
+	}
+	return shared
+}
+
+func TestCompareRatings(t *testing.T) {
+	tests := []struct {
+		name            string
+		userA, userB    uint
+		shared          []database.SharedRating
+		wantCorrelation *float64
+		wantDifference  float64
+	}{
+		{"nothing shared", 1, 2, nil, nil, 0},
+		{"one song", 1, 2, ratings([2]int{7, 9}), nil, 2},
+		{"same taste", 1, 2, ratings([2]int{2, 3}, [2]int{5, 6}, [2]int{9, 10}), ptr(1.0), 1},
+		{"opposite taste", 1, 2, ratings([2]int{1, 10}, [2]int{10, 1}), ptr(-1.0), 9},
+		{"one user rates everything alike", 1, 2, ratings([2]int{5, 1}, [2]int{5, 9}), nil, 4},
+		{"users given the other way round", 2, 1, ratings([2]int{10, 4}, [2]int{8, 6}, [2]int{6, 8}), ptr(-1.0), 10.0 / 3},
+	}
+	for _, tt := range tests {
+		got := database.CompareRatings(tt.userA, tt.userB, tt.shared)
+		if got.UserA != min(tt.userA, tt.userB) || got.UserB != max(tt.userA, tt.userB) {
+			t.Errorf("%s: users %d and %d; want the lower ID first", tt.name, got.UserA, got.UserB)
+		}
+		if got.Overlap != int64(len(tt.shared)) {
+			t.Errorf("%s: overlap = %d, want %d", tt.name, got.Overlap, len(tt.shared))
+		}
+		if math.Abs(got.MeanAbsoluteDifference-tt.wantDifference) > 1e-9 {
+			t.Errorf("%s: difference = %v, want %v", tt.name, got.MeanAbsoluteDifference, tt.wantDifference)
+		}
+		switch {
+		case (got.Correlation == nil) != (tt.wantCorrelation == nil):
+			t.Errorf("%s: correlation = %v, want %v", tt.name, got.Correlation, tt.wantCorrelation)
+		case got.Correlation != nil && math.Abs(*got.Correlation-*tt.wantCorrelation) > 1e-9:
+			t.Errorf("%s: correlation = %v, want %v", tt.name, *got.Correlation, *tt.wantCorrelation)
+		}
+	}
+}
+
+func TestCompareRatingsKeepsInput(t *testing.T) {
+	shared := ratings([2]int{10, 4})
+	database.CompareRatings(2, 1, shared)
+	if shared[0].RatingA != 10 {
+		t.Errorf("CompareRatings swapped the caller's ratings: %+v", shared[0])
+	}
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
@@ -3,7 +3,7 @@ package database
 import (
 	"fmt"
 
-	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/database/migrations"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -28,122 +28,41 @@ func (db *Database) Connect() error {
 	return nil
 }
 
-func (db *Database) Migrate() error {
-	// Disable foreign key checks during migration to avoid circular dependencies
-	fmt.Println("Disabling foreign key constraints for migration...")
-	err := db.DB.Exec("SET session_replication_role = replica").Error
-	if err != nil {
-		return fmt.Errorf("failed to disable foreign key constraints: %s", err.Error())
-	}
-
-	// First migrate Category table (no dependencies)
-	fmt.Println("Starting migration for Category table...")
-	err = db.DB.AutoMigrate(&models.Category{})
-	if err != nil {
-		return fmt.Errorf("migration failed for Category: %s", err.Error())
-	}
-	fmt.Println("✓ Category table migrated successfully")
-
-	// Then migrate all tables without foreign key constraints being enforced
-	fmt.Println("Starting migration for User table...")
-	err = db.DB.AutoMigrate(&models.User{})
-	if err != nil {
-		return fmt.Errorf("migration failed for User: %s", err.Error())
-	}
-	fmt.Println("✓ User table migrated successfully")
-
-	fmt.Println("Starting migration for Unit table...")
-	err = db.DB.AutoMigrate(&models.Unit{})
-	if err != nil {
-		return fmt.Errorf("migration failed for Unit: %s", err.Error())
-	}
-	fmt.Println("✓ Unit table migrated successfully")
-
-	fmt.Println("Starting migration for Artist table...")
-	err = db.DB.AutoMigrate(&models.Artist{})
-	if err != nil {
-		return fmt.Errorf("migration failed for Artist: %s", err.Error())
-	}
-	fmt.Println("✓ Artist table migrated successfully")
-
-	fmt.Println("Starting migration for Album table...")
-	err = db.DB.AutoMigrate(&models.Album{})
-	if err != nil {
-		return fmt.Errorf("migration failed for Album: %s", err.Error())
-	}
-	fmt.Println("✓ Album table migrated successfully")
-
-	fmt.Println("Starting migration for Song table...")
-	err = db.DB.AutoMigrate(&models.Song{})
-	if err != nil {
-		return fmt.Errorf("migration failed for Song: %s", err.Error())
-	}
-	fmt.Println("✓ Song table migrated successfully")
-
-	fmt.Println("Starting migration for Vote table...")
-	err = db.DB.AutoMigrate(&models.Vote{})
-	if err != nil {
-		return fmt.Errorf("migration failed for Vote: %s", err.Error())
-	}
-	fmt.Println("✓ Vote table migrated successfully")
-
-	fmt.Println("Starting migration for RatingRoom table...")
-	err = db.DB.AutoMigrate(&models.RatingRoom{})
-	if err != nil {
-		return fmt.Errorf("migration failed for RatingRoom: %s", err.Error())
-	}
-	fmt.Println("✓ RatingRoom table migrated successfully")
-
-	fmt.Println("Starting migration for RadioRoom table...")
-	err = db.DB.AutoMigrate(&models.RadioRoom{})
-	if err != nil {
-		return fmt.Errorf("migration failed for RadioRoom: %s", err.Error())
-	}
-	fmt.Println("✓ RadioRoom table migrated successfully")
-
-	fmt.Println("Starting migration for TournamentRoom table...")
-	err = db.DB.AutoMigrate(&models.TournamentRoom{})
-	if err != nil {
-		return fmt.Errorf("migration failed for TournamentRoom: %s", err.Error())
-	}
-	fmt.Println("✓ TournamentRoom table migrated successfully")
+// DSN returns the connection string the database was created with
+func (db *Database) DSN() string {
+	return db.dsn
+}
 
-	// Migrate join tables
-	fmt.Println("Starting migration for SongArtist join table...")
-	err = db.DB.AutoMigrate(&models.SongArtist{})
-	if err != nil {
-		return fmt.Errorf("migration failed for SongArtist: %s", err.Error())
-	}
-	fmt.Println("✓ SongArtist table migrated successfully")
+// Transaction runs fn in a database transaction
+func (db *Database) Transaction(fn func(tx Store) error) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(&Database{dsn: db.dsn, DB: tx})
+	})
+}
 
-	fmt.Println("Starting migration for SongUnit join table...")
-	err = db.DB.AutoMigrate(&models.SongUnit{})
+// Migrate applies all pending schema migrations
+func (db *Database) Migrate() error {
+	migrator, err := db.Migrator()
 	if err != nil {
-		return fmt.Errorf("migration failed for SongUnit: %s", err.Error())
+		return err
 	}
-	fmt.Println("✓ SongUnit table migrated successfully")
 
-	fmt.Println("Starting migration for AlbumSong join table...")
-	err = db.DB.AutoMigrate(&models.AlbumSong{})
-	if err != nil {
-		return fmt.Errorf("migration failed for AlbumSong: %s", err.Error())
+	if err := migrator.Up(); err != nil {
+		return err
 	}
-	fmt.Println("✓ AlbumSong table migrated successfully")
 
-	fmt.Println("Starting migration for ArtistUnit join table...")
-	err = db.DB.AutoMigrate(&models.ArtistUnit{})
+	version, err := migrator.Current()
 	if err != nil {
-		return fmt.Errorf("migration failed for ArtistUnit: %s", err.Error())
+		return err
 	}
-	fmt.Println("✓ ArtistUnit table migrated successfully")
+	fmt.Printf("🎉 Database schema is at version %d\n", version)
+	return nil
+}
 
-	// Re-enable foreign key constraints
-	fmt.Println("Re-enabling foreign key constraints...")
-	err = db.DB.Exec("SET session_replication_role = DEFAULT").Error
-	if err != nil {
-		return fmt.Errorf("failed to re-enable foreign key constraints: %s", err.Error())
+// Migrator returns a migrator for the embedded schema migrations
+func (db *Database) Migrator() (*migrations.Migrator, error) {
+	if db.DB == nil {
+		return nil, fmt.Errorf("database is not connected")
 	}
-
-	fmt.Println("🎉 All migrations completed successfully!")
-	return nil
+	return migrations.New(db.DB)
 }
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+// ============= GUESTS =============
+
+func (db *Database) ClaimGuest(guestID, userID uint) (int64, error) {
+	if guestID == 0 || userID == 0 {
+		return 0, errors.New("user ID cannot be zero")
+	}
+	if guestID == userID {
+		return 0, fmt.Errorf("%w: cannot claim a guest for itself", ErrValidation)
+	}
+
+	var moved int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var guest models.User
+		if err := tx.First(&guest, guestID).Error; err != nil {
+			return fmt.Errorf("failed to get guest: %w", err)
+		}
+		if !guest.IsGuest {
+			return fmt.Errorf("%w: user %d is not a guest", ErrValidation, guestID)
+		}
+
+		// The account keeps its own vote where both rated the same song
+		result := tx.Exec(`UPDATE votes SET user_id = ? WHERE user_id = ?
+			AND song_id NOT IN (SELECT song_id FROM votes WHERE user_id = ?)`, userID, guestID, userID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to move guest votes: %w", result.Error)
+		}
+		moved = result.RowsAffected
+
+		if err := tx.Exec(`INSERT INTO room_allowed_users (room_type, room_id, user_id, created_at)
+			SELECT room_type, room_id, ?, created_at FROM room_allowed_users WHERE user_id = ?
+			ON CONFLICT DO NOTHING`, userID, guestID).Error; err != nil {
+			return fmt.Errorf("failed to move guest room access: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", guestID).Delete(&models.Vote{}).Error; err != nil {
+			return fmt.Errorf("failed to delete leftover guest votes: %w", err)
+		}
+		// Removes the guest's allow-list entries through the foreign key
+		if err := tx.Delete(&models.User{}, guestID).Error; err != nil {
+			return fmt.Errorf("failed to delete guest: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+func (db *Database) DeleteStaleGuests(before time.Time) (int64, error) {
+	result := db.DB.Where("is_guest = ? AND created_at < ?", true, before).
+		Where("user_id NOT IN (?)", db.DB.Model(&models.Vote{}).Select("user_id")).
+		Delete(&models.User{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete stale guests: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -45,7 +45,7 @@ func (db *Database) validateSongArtist(songArtist *models.SongArtist) error {
 
 func (db *Database) CreateSongArtist(songArtist *models.SongArtist) error {
 	if err := db.validateSongArtist(songArtist); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	// Check if relationship already exists
@@ -201,7 +201,7 @@ func (db *Database) validateAlbumSong(albumSong *models.AlbumSong) error {
 
 func (db *Database) CreateAlbumSong(albumSong *models.AlbumSong) error {
 	if err := db.validateAlbumSong(albumSong); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	// Check if relationship already exists
@@ -357,7 +357,7 @@ func (db *Database) validateArtistUnit(artistUnit *models.ArtistUnit) error {
 
 func (db *Database) CreateArtistUnit(artistUnit *models.ArtistUnit) error {
 	if err := db.validateArtistUnit(artistUnit); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	// Check if relationship already exists
@@ -513,7 +513,7 @@ func (db *Database) validateSongUnit(songUnit *models.SongUnit) error {
 
 func (db *Database) CreateSongUnit(songUnit *models.SongUnit) error {
 	if err := db.validateSongUnit(songUnit); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	// Check if relationship already exists
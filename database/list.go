@@ -0,0 +1,301 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPageLimit is the page size when a listing does not ask for one
+	DefaultPageLimit = 50
+	// MaxPageLimit caps the page size of a listing
+	MaxPageLimit = 200
+)
+
+// ListOptions order and page a listing. Pages are cursor based: pass the
+// NextCursor of a page to get the one after it.
+type ListOptions struct {
+	Sort    string   // One of the listing's sort keys; empty for its default
+	Desc    bool     // Sort descending
+	Limit   int      // Page size; 0 for DefaultPageLimit, capped at MaxPageLimit
+	Cursor  string   // NextCursor of the previous page; empty for the first
+	Include []string // Relations to load with each item, e.g. "artists"
+}
+
+// Page is one page of a listing. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// SortKind is the type of the values a sort key orders by
+type SortKind int
+
+const (
+	SortText SortKind = iota
+	SortTime
+	SortFloat
+	SortInt
+)
+
+// Listing describes what a listing can be sorted by and which relations it
+// can load
+type Listing struct {
+	Name        string
+	Sorts       map[string]SortKind
+	DefaultSort string
+	Includes    []string
+}
+
+var (
+	SongListing = Listing{
+		Name:        "songs",
+		Sorts:       map[string]SortKind{"name": SortText, "created": SortTime, "average": SortFloat, "votes": SortInt},
+		DefaultSort: "name",
+		Includes:    []string{"category", "artists", "units", "albums"},
+	}
+	ArtistListing = Listing{
+		Name:        "artists",
+		Sorts:       map[string]SortKind{"name": SortText, "created": SortTime},
+		DefaultSort: "name",
+		Includes:    []string{"category", "units", "songs"},
+	}
+	UnitListing = Listing{
+		Name:        "units",
+		Sorts:       map[string]SortKind{"name": SortText, "created": SortTime},
+		DefaultSort: "name",
+		Includes:    []string{"category", "artists"},
+	}
+	AlbumListing = Listing{
+		Name:        "albums",
+		Sorts:       map[string]SortKind{"name": SortText, "created": SortTime},
+		DefaultSort: "name",
+		Includes:    []string{"category", "songs"},
+	}
+	VoteListing = Listing{
+		Name:        "votes",
+		Sorts:       map[string]SortKind{"created": SortTime, "rating": SortInt},
+		DefaultSort: "created",
+	}
+	AuditListing = Listing{
+		Name:        "audit events",
+		Sorts:       map[string]SortKind{"created": SortTime},
+		DefaultSort: "created",
+	}
+)
+
+// Cursor is where a page ends: the sort value and ID of its last item
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value any    `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// Encode turns the cursor into an opaque token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// PrepareList checks opts against a listing and fills in its defaults. It
+// returns the decoded cursor, nil for the first page.
+func PrepareList(opts ListOptions, listing Listing) (ListOptions, *Cursor, error) {
+	if opts.Sort == "" {
+		opts.Sort = listing.DefaultSort
+	}
+	kind, ok := listing.Sorts[opts.Sort]
+	if !ok {
+		return opts, nil, fmt.Errorf("%w: %s cannot be sorted by %q", ErrValidation, listing.Name, opts.Sort)
+	}
+	switch {
+	case opts.Limit <= 0:
+		opts.Limit = DefaultPageLimit
+	case opts.Limit > MaxPageLimit:
+		opts.Limit = MaxPageLimit
+	}
+	for _, include := range opts.Include {
+		if !slices.Contains(listing.Includes, include) {
+			return opts, nil, fmt.Errorf("%w: %s cannot include %q", ErrValidation, listing.Name, include)
+		}
+	}
+	if opts.Cursor == "" {
+		return opts, nil, nil
+	}
+
+	cursor, err := decodeCursor(opts.Cursor, kind)
+	if err != nil {
+		return opts, nil, fmt.Errorf("%w: invalid cursor", ErrValidation)
+	}
+	if cursor.Sort != opts.Sort || cursor.Desc != opts.Desc {
+		return opts, nil, fmt.Errorf("%w: cursor belongs to a different sort order", ErrValidation)
+	}
+	return opts, cursor, nil
+}
+
+// decodeCursor reads a cursor token, giving its value the Go type of the
+// sort kind: string, time.Time, float64 or int64
+func decodeCursor(token string, kind SortKind) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+
+	switch value := cursor.Value.(type) {
+	case string:
+		switch kind {
+		case SortText:
+		case SortTime:
+			if cursor.Value, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("cursor value %q is not a number", value)
+		}
+	case float64:
+		switch kind {
+		case SortFloat:
+		case SortInt:
+			cursor.Value = int64(value)
+		default:
+			return nil, fmt.Errorf("cursor value %v is not text", value)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected cursor value %v", value)
+	}
+	return &cursor, nil
+}
+
+// NewPage makes a page from items fetched with opts.Limit+1 rows: the extra
+// row only tells that there is a next page. key returns the sort value and ID
+// of an item.
+func NewPage[T any](items []T, opts ListOptions, key func(T) (any, uint)) *Page[T] {
+	page := &Page[T]{Items: items}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(items) > opts.Limit {
+		page.Items = items[:opts.Limit]
+		value, id := key(page.Items[opts.Limit-1])
+		page.NextCursor = Cursor{Sort: opts.Sort, Desc: opts.Desc, Value: value, ID: id}.Encode()
+	}
+	return page
+}
+
+// SongStats are the vote aggregates of a song
+type SongStats struct {
+	AverageScore float64 `json:"average_score"`
+	VoteCount    int64   `json:"vote_count"`
+}
+
+// SongWithStats is a song with its vote aggregates
+type SongWithStats struct {
+	models.Song
+	SongStats
+}
+
+// SongSortValue is the value ListSongs orders a song by for a sort key
+func SongSortValue(song SongWithStats, sort string) any {
+	switch sort {
+	case "created":
+		return song.CreatedAt
+	case "average":
+		return song.AverageScore
+	case "votes":
+		return song.VoteCount
+	}
+	return song.NameOriginal
+}
+
+// NamedSortValue is the value artist, unit and album listings order by
+func NamedSortValue(sort, name string, created time.Time) any {
+	if sort == "created" {
+		return created
+	}
+	return name
+}
+
+// VoteSortValue is the value ListVotes orders a vote by for a sort key
+func VoteSortValue(vote models.Vote, sort string) any {
+	if sort == "rating" {
+		return int64(vote.Rating)
+	}
+	return vote.CreatedAt
+}
+
+// ArtistFilter narrows down artist listings; nil fields are not filtered on
+type ArtistFilter struct {
+	CategoryID *uint
+	UnitID     *uint
+}
+
+// UnitFilter narrows down unit listings; nil fields are not filtered on
+type UnitFilter struct {
+	CategoryID *uint
+	ArtistID   *uint
+}
+
+// AlbumFilter narrows down album listings; nil and empty fields are not
+// filtered on
+type AlbumFilter struct {
+	CategoryID *uint
+	Type       string // Album, Single or EP
+	SongID     *uint
+}
+
+// AuditFilter narrows down the audit log; nil and empty fields are not
+// filtered on
+type AuditFilter struct {
+	ActorID    *uint
+	Action     string
+	EntityType string
+	EntityID   string
+}
+
+// applyKeyset orders a query by a sort expression with the ID column as tie
+// breaker, starts it after the cursor and fetches one row more than a page
+func applyKeyset(query *gorm.DB, sortExpr, idColumn string, opts ListOptions, cursor *Cursor) *gorm.DB {
+	direction, compare := "ASC", ">"
+	if opts.Desc {
+		direction, compare = "DESC", "<"
+	}
+	if cursor != nil {
+		query = query.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", sortExpr, idColumn, compare), cursor.Value, cursor.ID)
+	}
+	return query.Order(fmt.Sprintf("%s %s, %s %s", sortExpr, direction, idColumn, direction)).Limit(opts.Limit + 1)
+}
+
+// namedSortColumn is the column of an artist, unit or album table a sort
+// key orders by
+func namedSortColumn(table, sort string) string {
+	if sort == "created" {
+		return table + ".created_at"
+	}
+	return table + ".name_original"
+}
+
+// preloadIncludes loads the relations a listing was asked to include
+func preloadIncludes(query *gorm.DB, includes []string) *gorm.DB {
+	for _, include := range includes {
+		query = query.Preload(strings.ToUpper(include[:1]) + include[1:])
+	}
+	return query
+}
+
+// songStatsQuery aggregates the votes of each song
+func (db *Database) songStatsQuery() *gorm.DB {
+	return db.DB.Table("votes").
+		Select("song_id, AVG(rating)::float8 AS average_score, COUNT(*) AS vote_count").
+		Group("song_id")
+}
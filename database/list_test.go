@@ -0,0 +1,141 @@
+package database_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		sort  string
+		desc  bool
+		value any
+		want  any // The value PrepareList decodes
+	}{
+		{"name", false, "Aozora", "Aozora"},
+		{"created", true, created, created},
+		{"average", false, 7.25, 7.25},
+		{"votes", true, int64(12), int64(12)},
+	}
+	for _, tt := range tests {
+		token := database.Cursor{Sort: tt.sort, Desc: tt.desc, Value: tt.value, ID: 42}.Encode()
+		_, cursor, err := database.PrepareList(database.ListOptions{Sort: tt.sort, Desc: tt.desc, Cursor: token}, database.SongListing)
+		if err != nil {
+			t.Errorf("%s: %v", tt.sort, err)
+			continue
+		}
+		if cursor.ID != 42 || cursor.Sort != tt.sort || cursor.Desc != tt.desc {
+			t.Errorf("%s: cursor = %+v", tt.sort, cursor)
+		}
+		if got, ok := cursor.Value.(time.Time); ok {
+			if !got.Equal(tt.want.(time.Time)) {
+				t.Errorf("%s: value = %v, want %v", tt.sort, got, tt.want)
+			}
+		} else if cursor.Value != tt.want {
+			t.Errorf("%s: value = %#v, want %#v", tt.sort, cursor.Value, tt.want)
+		}
+	}
+}
+
+func TestPrepareList(t *testing.T) {
+	nameCursor := database.Cursor{Sort: "name", Value: "a", ID: 1}.Encode()
+	tests := []struct {
+		name      string
+		opts      database.ListOptions
+		wantSort  string
+		wantLimit int
+		wantErr   bool
+	}{
+		{"defaults", database.ListOptions{}, "name", database.DefaultPageLimit, false},
+		{"limit kept", database.ListOptions{Sort: "votes", Limit: 10}, "votes", 10, false},
+		{"limit capped", database.ListOptions{Limit: database.MaxPageLimit + 1}, "name", database.MaxPageLimit, false},
+		{"negative limit", database.ListOptions{Limit: -5}, "name", database.DefaultPageLimit, false},
+		{"includes", database.ListOptions{Include: []string{"artists", "albums"}}, "name", database.DefaultPageLimit, false},
+		{"cursor", database.ListOptions{Cursor: nameCursor}, "name", database.DefaultPageLimit, false},
+		{"unknown sort", database.ListOptions{Sort: "rating"}, "", 0, true},
+		{"unknown include", database.ListOptions{Include: []string{"votes"}}, "", 0, true},
+		{"garbage cursor", database.ListOptions{Cursor: "not base64!"}, "", 0, true},
+		{"cursor of another sort", database.ListOptions{Sort: "created", Cursor: nameCursor}, "", 0, true},
+		{"cursor of another direction", database.ListOptions{Desc: true, Cursor: nameCursor}, "", 0, true},
+		{"text cursor for a number sort", database.ListOptions{Sort: "votes", Cursor: database.Cursor{Sort: "votes", Value: "ten", ID: 1}.Encode()}, "", 0, true},
+		{"number cursor for a text sort", database.ListOptions{Cursor: database.Cursor{Sort: "name", Value: 3, ID: 1}.Encode()}, "", 0, true},
+		{"bad time cursor", database.ListOptions{Sort: "created", Cursor: database.Cursor{Sort: "created", Value: "yesterday", ID: 1}.Encode()}, "", 0, true},
+	}
+	for _, tt := range tests {
+		opts, _, err := database.PrepareList(tt.opts, database.SongListing)
+		if tt.wantErr {
+			if !errors.Is(err, database.ErrValidation) {
+				t.Errorf("%s: err = %v; want a validation error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if opts.Sort != tt.wantSort || opts.Limit != tt.wantLimit {
+			t.Errorf("%s: sort %q limit %d; want %q and %d", tt.name, opts.Sort, opts.Limit, tt.wantSort, tt.wantLimit)
+		}
+	}
+}
+
+// TestListSongsTies pages through songs that share their sort values. The
+// song ID breaks the ties, so every song shows up exactly once.
+func TestListSongsTies(t *testing.T) {
+	store := memory.New()
+	user := models.User{Username: "voter"}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	var songIDs []uint
+	for i := 0; i < 7; i++ {
+		song := models.Song{NameOriginal: fmt.Sprintf("song %d", i%2), SourceURL: "https://example.com/a.mp3", ThumbnailURL: "https://example.com/a.jpg"}
+		if err := store.CreateSong(&song); err != nil {
+			t.Fatalf("CreateSong: %v", err)
+		}
+		// Three songs rated 5, four unrated
+		if i%2 == 0 && i < 6 {
+			if err := store.UpsertVote(&models.Vote{UserID: user.UserID, SongID: song.SongID, Rating: 5}); err != nil {
+				t.Fatalf("UpsertVote: %v", err)
+			}
+		}
+		songIDs = append(songIDs, song.SongID)
+	}
+
+	for _, sort := range []string{"name", "average", "votes"} {
+		for _, desc := range []bool{false, true} {
+			for _, limit := range []int{1, 2, 3} {
+				seen := make(map[uint]int)
+				opts := database.ListOptions{Sort: sort, Desc: desc, Limit: limit}
+				for pages := 0; ; pages++ {
+					if pages > len(songIDs) {
+						t.Fatalf("%s desc=%v limit=%d: pages never end", sort, desc, limit)
+					}
+					page, err := store.ListSongs(database.SongFilter{}, opts)
+					if err != nil {
+						t.Fatalf("%s desc=%v limit=%d: %v", sort, desc, limit, err)
+					}
+					for _, song := range page.Items {
+						seen[song.SongID]++
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+				for _, id := range songIDs {
+					if seen[id] != 1 {
+						t.Errorf("%s desc=%v limit=%d: song %d listed %d times", sort, desc, limit, id, seen[id])
+					}
+				}
+			}
+		}
+	}
+}
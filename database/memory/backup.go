@@ -0,0 +1,423 @@
+package memory
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/migrations"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/backup"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var _ backup.Database = (*Store)(nil)
+
+// SchemaVersion is the newest migration, as the store has no schema of its
+// own to lag behind
+func (s *Store) SchemaVersion() (int, error) {
+	migrator, err := migrations.New(nil)
+	if err != nil {
+		return 0, err
+	}
+	return migrator.Latest(), nil
+}
+
+// TableTransaction runs fn on the store's tables with the columns and rows
+// Postgres has for them. Like Transaction, writes go to a copy that is put
+// in place if fn succeeds.
+func (s *Store) TableTransaction(readOnly bool, fn func(tx backup.TableTx) error) error {
+	if readOnly {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return fn(backupTx{s})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.tables()
+	tx.lastID = s.lastID
+	err := fn(backupTx{tx})
+	s.lastID = tx.lastID
+	if err != nil {
+		return err
+	}
+	s.setTables(tx)
+	return nil
+}
+
+// backupTable maps an archived table to the store. Tables of models have a
+// model; join tables have the links and the names of their two columns.
+type backupTable struct {
+	model  reflect.Type
+	rows   func(s *Store) map[uint]any // Models by ID, trashed ones included
+	put    func(s *Store, id uint, model any, trashed bool)
+	remove func(s *Store)
+
+	links   func(s *Store) links
+	columns [2]string
+}
+
+// modelTable archives a map of models. Models in the trash under trashType
+// are archived with their deleted_at set and restored into the trash.
+func modelTable[T any](table func(s *Store) map[uint]T, trashType string) backupTable {
+	return backupTable{
+		model: reflect.TypeFor[T](),
+		rows: func(s *Store) map[uint]any {
+			rows := make(map[uint]any)
+			for id, model := range table(s) {
+				rows[id] = &model
+			}
+			for key, model := range s.trash {
+				if trashType != "" && key.entityType == trashType {
+					model := model.(T)
+					rows[key.id] = &model
+				}
+			}
+			return rows
+		},
+		put: func(s *Store, id uint, model any, trashed bool) {
+			if trashed && trashType != "" {
+				s.trash[trashKey{trashType, id}] = *model.(*T)
+				return
+			}
+			table(s)[id] = *model.(*T)
+		},
+		remove: func(s *Store) {
+			clear(table(s))
+			for key := range s.trash {
+				if trashType != "" && key.entityType == trashType {
+					delete(s.trash, key)
+				}
+			}
+		},
+	}
+}
+
+func linkTable(table func(s *Store) links, left, right string) backupTable {
+	return backupTable{links: table, columns: [2]string{left, right}}
+}
+
+var backupTables = map[string]backupTable{
+	"categories":   modelTable(func(s *Store) map[uint]models.Category { return s.categories }, database.TrashCategory),
+	"users":        modelTable(func(s *Store) map[uint]models.User { return s.users }, ""),
+	"units":        modelTable(func(s *Store) map[uint]models.Unit { return s.units }, database.TrashUnit),
+	"artists":      modelTable(func(s *Store) map[uint]models.Artist { return s.artists }, database.TrashArtist),
+	"albums":       modelTable(func(s *Store) map[uint]models.Album { return s.albums }, database.TrashAlbum),
+	"songs":        modelTable(func(s *Store) map[uint]models.Song { return s.songs }, database.TrashSong),
+	"votes":        modelTable(func(s *Store) map[uint]models.Vote { return s.votes }, ""),
+	"artist_units": linkTable(func(s *Store) links { return s.artistUnits }, "artist_id", "unit_id"),
+	"song_artists": linkTable(func(s *Store) links { return s.songArtists }, "song_id", "artist_id"),
+	"song_units":   linkTable(func(s *Store) links { return s.songUnits }, "song_id", "unit_id"),
+	"album_songs":  linkTable(func(s *Store) links { return s.albumSongs }, "album_id", "song_id"),
+}
+
+// schemas caches the parsed models of backupTables
+var schemas sync.Map
+
+// modelFields returns the fields of a model that are columns
+func modelFields(model reflect.Type) ([]*schema.Field, error) {
+	parsed, err := schema.Parse(reflect.New(model).Interface(), &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	var fields []*schema.Field
+	for _, field := range parsed.Fields {
+		if field.DBName != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// backupTx is the backup.TableTx of a store
+type backupTx struct {
+	s *Store
+}
+
+func findBackupTable(name string) (backupTable, error) {
+	table, ok := backupTables[name]
+	if !ok {
+		return backupTable{}, fmt.Errorf("no table %s", name)
+	}
+	return table, nil
+}
+
+func (t backupTx) Columns(name string) ([]backup.Column, error) {
+	table, err := findBackupTable(name)
+	if err != nil {
+		return nil, err
+	}
+	if table.links != nil {
+		return []backup.Column{{Name: table.columns[0], Type: "integer"}, {Name: table.columns[1], Type: "integer"}}, nil
+	}
+
+	fields, err := modelFields(table.model)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]backup.Column, len(fields))
+	for i, field := range fields {
+		columns[i] = backup.Column{Name: field.DBName, Type: portableType(field.FieldType)}
+	}
+	return columns, nil
+}
+
+// Rows sorts by ID, the key of every table of models
+func (t backupTx) Rows(name string, key []string, fn func(row []any) error) error {
+	table, err := findBackupTable(name)
+	if err != nil {
+		return err
+	}
+	if table.links != nil {
+		pairs := slices.SortedFunc(maps.Keys(table.links(t.s)), func(a, b [2]uint) int {
+			return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+		})
+		for _, pair := range pairs {
+			if err := fn([]any{int64(pair[0]), int64(pair[1])}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fields, err := modelFields(table.model)
+	if err != nil {
+		return err
+	}
+	rows := table.rows(t.s)
+	row := make([]any, len(fields))
+	for _, id := range slices.Sorted(maps.Keys(rows)) {
+		model := reflect.ValueOf(rows[id]).Elem()
+		for i, field := range fields {
+			row[i] = columnValue(model.FieldByIndex(field.StructField.Index))
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t backupTx) Count(name string) (int64, error) {
+	table, err := findBackupTable(name)
+	if err != nil {
+		return 0, err
+	}
+	if table.links != nil {
+		return int64(len(table.links(t.s))), nil
+	}
+	return int64(len(table.rows(t.s))), nil
+}
+
+func (t backupTx) Clear(name string) error {
+	table, err := findBackupTable(name)
+	if err != nil {
+		return err
+	}
+	if table.links != nil {
+		clear(table.links(t.s))
+		return nil
+	}
+	table.remove(t.s)
+	return nil
+}
+
+// Insert keeps the ID counter ahead of the inserted IDs
+func (t backupTx) Insert(name string, columns []string, rows [][]any) error {
+	table, err := findBackupTable(name)
+	if err != nil {
+		return err
+	}
+	if table.links != nil {
+		if !slices.Equal(columns, table.columns[:]) {
+			return invalid("%s has columns %v, not %v", name, table.columns, columns)
+		}
+		for _, row := range rows {
+			left, leftOK := row[0].(int64)
+			right, rightOK := row[1].(int64)
+			if !leftOK || !rightOK {
+				return invalid("%s row %v is not a pair of IDs", name, row)
+			}
+			table.links(t.s).add(uint(left), uint(right))
+		}
+		return nil
+	}
+
+	for _, row := range rows {
+		model, err := newModel(table.model, columns, row)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		id, trashed, err := modelKey(model)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		t.s.lastID = max(t.s.lastID, id)
+		table.put(t.s, id, model.Interface(), trashed)
+	}
+	return nil
+}
+
+func (t backupTx) FindUser(username string) (int64, bool, error) {
+	for _, user := range t.s.users {
+		if user.Username == username {
+			return int64(user.UserID), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (t backupTx) CreateUser(columns []string, row []any) (int64, error) {
+	model, err := newModel(reflect.TypeFor[models.User](), columns, row)
+	if err != nil {
+		return 0, err
+	}
+	user := model.Interface().(*models.User)
+	user.UserID = t.s.nextID()
+	t.s.users[user.UserID] = *user
+	return int64(user.UserID), nil
+}
+
+// ResetSequence has nothing to do, as Insert keeps the ID counter ahead
+func (t backupTx) ResetSequence(table, column string) error {
+	return nil
+}
+
+// newModel returns a pointer to a model with the columns of a row set
+func newModel(model reflect.Type, columns []string, row []any) (reflect.Value, error) {
+	fields, err := modelFields(model)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	value := reflect.New(model)
+	for i, column := range columns {
+		j := slices.IndexFunc(fields, func(field *schema.Field) bool { return field.DBName == column })
+		if j < 0 {
+			return reflect.Value{}, invalid("no column %s", column)
+		}
+		if err := setColumnValue(value.Elem().FieldByIndex(fields[j].StructField.Index), row[i]); err != nil {
+			return reflect.Value{}, invalid("column %s: %v", column, err)
+		}
+	}
+	return value, nil
+}
+
+// modelKey returns the ID of a model and whether it is in the trash
+func modelKey(value reflect.Value) (uint, bool, error) {
+	parsed, err := schema.Parse(value.Interface(), &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return 0, false, err
+	}
+	id := value.Elem().FieldByIndex(parsed.PrioritizedPrimaryField.StructField.Index).Uint()
+	deletedAt, trashed := value.Elem().FieldByName("DeletedAt").Interface().(gorm.DeletedAt)
+	return uint(id), trashed && deletedAt.Valid, nil
+}
+
+// portableType is the backup column type of a model field
+func portableType(fieldType reflect.Type) string {
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	switch fieldType {
+	case reflect.TypeFor[time.Time](), reflect.TypeFor[gorm.DeletedAt]():
+		return "timestamp"
+	}
+	switch fieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Bool:
+		return "boolean"
+	}
+	return "text"
+}
+
+// columnValue returns a field as Postgres would: integers as int64 and
+// unset pointers and deletion times as nil
+func columnValue(field reflect.Value) any {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+	switch value := field.Interface().(type) {
+	case gorm.DeletedAt:
+		if !value.Valid {
+			return nil
+		}
+		return value.Time
+	case time.Time:
+		return value
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(field.Uint())
+	}
+	return field.Interface()
+}
+
+// setColumnValue sets a field from a value read by backup.Restore
+func setColumnValue(field reflect.Value, value any) error {
+	if value == nil {
+		field.SetZero()
+		return nil
+	}
+	if field.Kind() == reflect.Pointer {
+		target := reflect.New(field.Type().Elem())
+		if err := setColumnValue(target.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(target)
+		return nil
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		switch field.Type() {
+		case reflect.TypeFor[time.Time]():
+			field.Set(reflect.ValueOf(v))
+			return nil
+		case reflect.TypeFor[gorm.DeletedAt]():
+			field.Set(reflect.ValueOf(gorm.DeletedAt{Time: v, Valid: true}))
+			return nil
+		}
+	case int64:
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			field.SetInt(v)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			field.SetUint(uint64(v))
+			return nil
+		}
+	case float64:
+		if field.CanFloat() {
+			field.SetFloat(v)
+			return nil
+		}
+	case bool:
+		if field.Kind() == reflect.Bool {
+			field.SetBool(v)
+			return nil
+		}
+	case string:
+		if field.Kind() == reflect.String {
+			field.SetString(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot store %T in a %s field", value, field.Type())
+}
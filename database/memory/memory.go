@@ -0,0 +1,3203 @@
+// Package memory is a map-based implementation of database.Store. It keeps
+// everything in process memory and is meant for tests and local experiments
+// that should not need a running Postgres.
+package memory
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+// links is a set of (left, right) ID pairs backing a many2many relation
+type links map[[2]uint]struct{}
+
+func (l links) add(left, right uint) {
+	l[[2]uint{left, right}] = struct{}{}
+}
+
+// rights returns the sorted right-hand IDs linked to left
+func (l links) rights(left uint) []uint {
+	var ids []uint
+	for pair := range l {
+		if pair[0] == left {
+			ids = append(ids, pair[1])
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// lefts returns the sorted left-hand IDs linked to right
+func (l links) lefts(right uint) []uint {
+	var ids []uint
+	for pair := range l {
+		if pair[1] == right {
+			ids = append(ids, pair[0])
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (l links) removeLeft(left uint) {
+	for pair := range l {
+		if pair[0] == left {
+			delete(l, pair)
+		}
+	}
+}
+
+func (l links) removeRight(right uint) {
+	for pair := range l {
+		if pair[1] == right {
+			delete(l, pair)
+		}
+	}
+}
+
+// Store is an in-memory database.Store. The zero value is not usable; create
+// one with New.
+type Store struct {
+	mu     sync.RWMutex
+	lastID uint
+
+	categories map[uint]models.Category
+	artists    map[uint]models.Artist
+	units      map[uint]models.Unit
+	albums     map[uint]models.Album
+	songs      map[uint]models.Song
+	votes      map[uint]models.Vote
+	users      map[uint]models.User
+
+	songArtists links // song ID -> artist ID
+	songUnits   links // song ID -> unit ID
+	albumSongs  links // album ID -> song ID
+	artistUnits links // artist ID -> unit ID
+
+	ratingRooms     map[string]models.RatingRoom
+	radioRooms      map[string]models.RadioRoom
+	tournamentRooms map[string]models.TournamentRoom
+	roomAccess      map[roomAccessKey]bool
+	apiTokens       map[uint]models.APIToken
+	auditEvents     map[uint]models.AuditEvent
+
+	// trash holds deleted songs, artists, units, albums and categories. Their
+	// links and votes stay in place while they are in the trash.
+	trash map[trashKey]any
+
+	// similarities is replaced as a whole, never changed in place
+	similarities []models.SongSimilarity
+	// charts is replaced as a whole, never changed in place
+	charts []models.ChartEntry
+}
+
+// trashKey identifies an entity in the trash by its database.Trash type
+type trashKey struct {
+	entityType string
+	id         uint
+}
+
+// roomAccessKey identifies an allow-list entry
+type roomAccessKey struct {
+	roomType string
+	roomID   string
+	userID   uint
+}
+
+var _ database.Store = (*Store)(nil)
+
+// New creates an empty in-memory store
+func New() *Store {
+	return &Store{
+		categories:      make(map[uint]models.Category),
+		artists:         make(map[uint]models.Artist),
+		units:           make(map[uint]models.Unit),
+		albums:          make(map[uint]models.Album),
+		songs:           make(map[uint]models.Song),
+		votes:           make(map[uint]models.Vote),
+		users:           make(map[uint]models.User),
+		songArtists:     make(links),
+		songUnits:       make(links),
+		albumSongs:      make(links),
+		artistUnits:     make(links),
+		ratingRooms:     make(map[string]models.RatingRoom),
+		radioRooms:      make(map[string]models.RadioRoom),
+		tournamentRooms: make(map[string]models.TournamentRoom),
+		roomAccess:      make(map[roomAccessKey]bool),
+		apiTokens:       make(map[uint]models.APIToken),
+		auditEvents:     make(map[uint]models.AuditEvent),
+		trash:           make(map[trashKey]any),
+	}
+}
+
+// nextID hands out IDs from a single sequence shared by all tables, which
+// keeps IDs unique across types and makes mix-ups show up in tests
+func (s *Store) nextID() uint {
+	s.lastID++
+	return s.lastID
+}
+
+// Transaction runs fn against a copy of the store's tables and puts the copy
+// in place if fn succeeds. The store stays locked while fn runs, so other
+// callers wait for the transaction instead of seeing part of it, and a
+// rollback never undoes their writes. fn must only use tx, or it deadlocks.
+// Like a sequence, the ID counter is not rolled back.
+func (s *Store) Transaction(fn func(tx database.Store) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := s.tables()
+	tx.lastID = s.lastID
+	err := fn(tx)
+	s.lastID = tx.lastID
+	if err != nil {
+		return err
+	}
+	s.setTables(tx)
+	return nil
+}
+
+// tables copies everything the store holds except the ID counter into a new
+// store. Callers must hold s.mu.
+func (s *Store) tables() *Store {
+	return &Store{
+		categories:      maps.Clone(s.categories),
+		artists:         maps.Clone(s.artists),
+		units:           maps.Clone(s.units),
+		albums:          maps.Clone(s.albums),
+		songs:           maps.Clone(s.songs),
+		votes:           maps.Clone(s.votes),
+		users:           maps.Clone(s.users),
+		songArtists:     maps.Clone(s.songArtists),
+		songUnits:       maps.Clone(s.songUnits),
+		albumSongs:      maps.Clone(s.albumSongs),
+		artistUnits:     maps.Clone(s.artistUnits),
+		ratingRooms:     maps.Clone(s.ratingRooms),
+		radioRooms:      maps.Clone(s.radioRooms),
+		tournamentRooms: maps.Clone(s.tournamentRooms),
+		roomAccess:      maps.Clone(s.roomAccess),
+		apiTokens:       maps.Clone(s.apiTokens),
+		auditEvents:     maps.Clone(s.auditEvents),
+		trash:           maps.Clone(s.trash),
+		similarities:    s.similarities,
+		charts:          s.charts,
+	}
+}
+
+// setTables takes over the tables of a store made by tables. Callers must
+// hold s.mu.
+func (s *Store) setTables(tx *Store) {
+	s.categories, s.artists, s.units, s.albums = tx.categories, tx.artists, tx.units, tx.albums
+	s.songs, s.votes, s.users = tx.songs, tx.votes, tx.users
+	s.songArtists, s.songUnits, s.albumSongs, s.artistUnits = tx.songArtists, tx.songUnits, tx.albumSongs, tx.artistUnits
+	s.ratingRooms, s.radioRooms, s.tournamentRooms = tx.ratingRooms, tx.radioRooms, tx.tournamentRooms
+	s.roomAccess, s.apiTokens, s.auditEvents = tx.roomAccess, tx.apiTokens, tx.auditEvents
+	s.trash, s.similarities, s.charts = tx.trash, tx.similarities, tx.charts
+}
+
+func notFound(entity string) error {
+	return fmt.Errorf("failed to get %s: %w", entity, database.ErrNotFound)
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", database.ErrValidation, fmt.Sprintf(format, args...))
+}
+
+func containsFold(value, query string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(query))
+}
+
+func sortedKeys[V any](m map[uint]V) []uint {
+	ids := make([]uint, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// paginate orders items by sort value and ID like the SQL listings do, skips
+// those up to the cursor and keeps one more than a page for database.NewPage
+func paginate[T any](items []T, opts database.ListOptions, cursor *database.Cursor, key func(T) (any, uint)) *database.Page[T] {
+	compare := func(value any, id uint, otherValue any, otherID uint) int {
+		c := compareSortValues(value, otherValue)
+		if c == 0 {
+			c = cmp.Compare(id, otherID)
+		}
+		if opts.Desc {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(items, func(a, b T) int {
+		aValue, aID := key(a)
+		bValue, bID := key(b)
+		return compare(aValue, aID, bValue, bID)
+	})
+
+	if cursor != nil {
+		start := len(items)
+		for i, item := range items {
+			if value, id := key(item); compare(value, id, cursor.Value, cursor.ID) > 0 {
+				start = i
+				break
+			}
+		}
+		items = items[start:]
+	}
+	if len(items) > opts.Limit+1 {
+		items = items[:opts.Limit+1]
+	}
+	return database.NewPage(items, opts, key)
+}
+
+// compareSortValues compares two sort values of the same database.SortKind
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(a, b)
+	case time.Time:
+		b, _ := b.(time.Time)
+		return a.Compare(b)
+	case float64:
+		b, _ := b.(float64)
+		return cmp.Compare(a, b)
+	case int64:
+		b, _ := b.(int64)
+		return cmp.Compare(a, b)
+	}
+	return 0
+}
+
+func (s *Store) categoryExists(categoryID *uint) bool {
+	if categoryID == nil || *categoryID == 0 {
+		return true
+	}
+	_, ok := s.categories[*categoryID]
+	return ok
+}
+
+func (s *Store) categoryRef(categoryID *uint) *models.Category {
+	if categoryID == nil {
+		return nil
+	}
+	category, ok := s.categories[*categoryID]
+	if !ok {
+		return nil
+	}
+	return &category
+}
+
+// ============= HYDRATION =============
+
+func (s *Store) plainArtists(ids []uint) []models.Artist {
+	artists := make([]models.Artist, 0, len(ids))
+	for _, id := range ids {
+		if artist, ok := s.artists[id]; ok {
+			artists = append(artists, artist)
+		}
+	}
+	return artists
+}
+
+func (s *Store) plainUnits(ids []uint) []models.Unit {
+	units := make([]models.Unit, 0, len(ids))
+	for _, id := range ids {
+		if unit, ok := s.units[id]; ok {
+			units = append(units, unit)
+		}
+	}
+	return units
+}
+
+func (s *Store) plainAlbums(ids []uint) []models.Album {
+	albums := make([]models.Album, 0, len(ids))
+	for _, id := range ids {
+		if album, ok := s.albums[id]; ok {
+			albums = append(albums, album)
+		}
+	}
+	return albums
+}
+
+func (s *Store) plainSongs(ids []uint) []models.Song {
+	songs := make([]models.Song, 0, len(ids))
+	for _, id := range ids {
+		if song, ok := s.songs[id]; ok {
+			songs = append(songs, song)
+		}
+	}
+	return songs
+}
+
+func (s *Store) hydrateSong(song models.Song) models.Song {
+	song.Category = s.categoryRef(song.CategoryID)
+	song.Artists = s.plainArtists(s.songArtists.rights(song.SongID))
+	song.Units = s.plainUnits(s.songUnits.rights(song.SongID))
+	song.Albums = s.plainAlbums(s.albumSongs.lefts(song.SongID))
+	return song
+}
+
+func (s *Store) hydrateArtist(artist models.Artist) models.Artist {
+	artist.Category = s.categoryRef(artist.CategoryID)
+	artist.Units = s.plainUnits(s.artistUnits.rights(artist.ArtistID))
+	artist.Songs = s.plainSongs(s.songArtists.lefts(artist.ArtistID))
+	return artist
+}
+
+func (s *Store) hydrateUnit(unit models.Unit) models.Unit {
+	unit.Category = s.categoryRef(unit.CategoryID)
+	unit.Artists = s.plainArtists(s.artistUnits.lefts(unit.UnitID))
+	return unit
+}
+
+func (s *Store) hydrateAlbum(album models.Album) models.Album {
+	album.Category = s.categoryRef(album.CategoryID)
+	album.Songs = s.plainSongs(s.albumSongs.rights(album.AlbumID))
+	return album
+}
+
+// includeSong loads only the listed relations of a song, see
+// database.SongListing
+func (s *Store) includeSong(song models.Song, includes []string) models.Song {
+	hydrated := s.hydrateSong(song)
+	song = stripSong(song)
+	for _, include := range includes {
+		switch include {
+		case "category":
+			song.Category = hydrated.Category
+		case "artists":
+			song.Artists = hydrated.Artists
+		case "units":
+			song.Units = hydrated.Units
+		case "albums":
+			song.Albums = hydrated.Albums
+		}
+	}
+	return song
+}
+
+func (s *Store) includeArtist(artist models.Artist, includes []string) models.Artist {
+	hydrated := s.hydrateArtist(artist)
+	artist.Category, artist.Units, artist.Songs = nil, nil, nil
+	for _, include := range includes {
+		switch include {
+		case "category":
+			artist.Category = hydrated.Category
+		case "units":
+			artist.Units = hydrated.Units
+		case "songs":
+			artist.Songs = hydrated.Songs
+		}
+	}
+	return artist
+}
+
+func (s *Store) includeUnit(unit models.Unit, includes []string) models.Unit {
+	hydrated := s.hydrateUnit(unit)
+	unit.Category, unit.Artists = nil, nil
+	for _, include := range includes {
+		switch include {
+		case "category":
+			unit.Category = hydrated.Category
+		case "artists":
+			unit.Artists = hydrated.Artists
+		}
+	}
+	return unit
+}
+
+func (s *Store) includeAlbum(album models.Album, includes []string) models.Album {
+	hydrated := s.hydrateAlbum(album)
+	album.Category, album.Songs = nil, nil
+	for _, include := range includes {
+		switch include {
+		case "category":
+			album.Category = hydrated.Category
+		case "songs":
+			album.Songs = hydrated.Songs
+		}
+	}
+	return album
+}
+
+// ============= SONGS =============
+
+func (s *Store) validateSong(song *models.Song) error {
+	if song == nil {
+		return errors.New("song cannot be nil")
+	}
+	if strings.TrimSpace(song.NameOriginal) == "" {
+		return invalid("original name cannot be empty")
+	}
+	if strings.TrimSpace(song.SourceURL) == "" {
+		return invalid("source URL cannot be empty")
+	}
+	if strings.TrimSpace(song.ThumbnailURL) == "" {
+		return invalid("thumbnail URL cannot be empty")
+	}
+	if !s.categoryExists(song.CategoryID) {
+		return invalid("specified category does not exist")
+	}
+	return nil
+}
+
+// storeSongLinks adds the relations set on song to the link tables
+func (s *Store) storeSongLinks(song *models.Song) {
+	for _, artist := range song.Artists {
+		s.songArtists.add(song.SongID, artist.ArtistID)
+	}
+	for _, unit := range song.Units {
+		s.songUnits.add(song.SongID, unit.UnitID)
+	}
+	for _, album := range song.Albums {
+		s.albumSongs.add(album.AlbumID, song.SongID)
+	}
+}
+
+func stripSong(song models.Song) models.Song {
+	song.Category = nil
+	song.Artists = nil
+	song.Units = nil
+	song.Albums = nil
+	song.Votes = nil
+	return song
+}
+
+func (s *Store) CreateSong(song *models.Song) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.validateSong(song); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	song.SongID = s.nextID()
+	song.CreatedAt = now
+	song.UpdatedAt = now
+	s.songs[song.SongID] = stripSong(*song)
+	s.storeSongLinks(song)
+	return nil
+}
+
+func (s *Store) GetSongByID(songID uint) (*models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	song, ok := s.songs[songID]
+	if !ok {
+		return nil, notFound("song")
+	}
+	song = s.hydrateSong(song)
+	return &song, nil
+}
+
+func (s *Store) GetSongsByIDs(songIDs []uint) ([]models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.plainSongs(songIDs), nil
+}
+
+func (s *Store) listSongs(match func(models.Song) bool) []models.Song {
+	songs := make([]models.Song, 0, len(s.songs))
+	for _, id := range sortedKeys(s.songs) {
+		song := s.songs[id]
+		if match == nil || match(song) {
+			songs = append(songs, s.hydrateSong(song))
+		}
+	}
+	return songs
+}
+
+func (s *Store) GetAllSongs() ([]models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listSongs(nil), nil
+}
+
+func (s *Store) GetSongsByName(name string) ([]models.Song, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listSongs(func(song models.Song) bool {
+		return containsFold(song.NameOriginal, name) || containsFold(song.NameEnglish, name)
+	}), nil
+}
+
+func (s *Store) GetSongsByCategory(categoryID uint) ([]models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.categories[categoryID]; !ok {
+		return nil, errors.New("category does not exist")
+	}
+	return s.listSongs(func(song models.Song) bool {
+		return song.CategoryID != nil && *song.CategoryID == categoryID
+	}), nil
+}
+
+func (s *Store) GetSongsByArtist(artistID uint) ([]models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.artists[artistID]; !ok {
+		return nil, errors.New("artist does not exist")
+	}
+	return s.plainSongs(s.songArtists.lefts(artistID)), nil
+}
+
+func (s *Store) GetSongsBySourceURL(sourceURL string) (*models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.songs) {
+		if s.songs[id].SourceURL == sourceURL {
+			song := s.hydrateSong(s.songs[id])
+			return &song, nil
+		}
+	}
+	return nil, notFound("song by source URL")
+}
+
+func (s *Store) UpdateSong(song *models.Song) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.songs[song.SongID]
+	if !ok {
+		return errors.New("song does not exist")
+	}
+	if err := s.validateSong(song); err != nil {
+		return err
+	}
+
+	song.CreatedAt = existing.CreatedAt
+	song.UpdatedAt = time.Now()
+	s.songs[song.SongID] = stripSong(*song)
+	s.storeSongLinks(song)
+	return nil
+}
+
+func (s *Store) DeleteSong(songID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	song, ok := s.songs[songID]
+	if !ok {
+		return errors.New("song does not exist")
+	}
+
+	song.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	s.trash[trashKey{database.TrashSong, songID}] = song
+	delete(s.songs, songID)
+	return nil
+}
+
+func (s *Store) SongExists(songID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.songs[songID]
+	return ok, nil
+}
+
+// averageRating returns the mean rating of a song and whether it has votes
+func (s *Store) averageRating(songID uint) (float64, bool) {
+	total, count := 0, 0
+	for _, vote := range s.votes {
+		if vote.SongID == songID {
+			total += vote.Rating
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return float64(total) / float64(count), true
+}
+
+func (s *Store) hasVoted(userID, songID uint) bool {
+	for _, vote := range s.votes {
+		if vote.UserID == userID && vote.SongID == songID {
+			return true
+		}
+	}
+	return false
+}
+
+// songMatcher returns whether a song passes the filter. Callers must hold s.mu.
+func (s *Store) songMatcher(filter database.SongFilter) func(models.Song) bool {
+	excluded := make(map[uint]bool, len(filter.ExcludeSongIDs))
+	for _, id := range filter.ExcludeSongIDs {
+		excluded[id] = true
+	}
+
+	return func(song models.Song) bool {
+		if excluded[song.SongID] {
+			return false
+		}
+		if filter.SongIDs != nil && !slices.Contains(filter.SongIDs, song.SongID) {
+			return false
+		}
+		if filter.CategoryID != nil && (song.CategoryID == nil || *song.CategoryID != *filter.CategoryID) {
+			return false
+		}
+		if filter.IsCover != nil && song.IsCover != *filter.IsCover {
+			return false
+		}
+		if filter.ArtistID != nil && !slices.Contains(s.songArtists.rights(song.SongID), *filter.ArtistID) {
+			return false
+		}
+		if slices.ContainsFunc(s.songArtists.rights(song.SongID), func(artistID uint) bool {
+			return slices.Contains(filter.ExcludeArtistIDs, artistID)
+		}) {
+			return false
+		}
+		if filter.UnitID != nil && !slices.Contains(s.songUnits.rights(song.SongID), *filter.UnitID) {
+			return false
+		}
+		if filter.AlbumID != nil && !slices.Contains(s.albumSongs.lefts(song.SongID), *filter.AlbumID) {
+			return false
+		}
+		if filter.AlbumType != "" && !slices.ContainsFunc(s.albumSongs.lefts(song.SongID), func(albumID uint) bool {
+			return s.albums[albumID].Type == filter.AlbumType
+		}) {
+			return false
+		}
+		if filter.MinAverageRating != nil || filter.MaxAverageRating != nil {
+			avg, ok := s.averageRating(song.SongID)
+			if !ok {
+				return false
+			}
+			if filter.MinAverageRating != nil && avg < float64(*filter.MinAverageRating) {
+				return false
+			}
+			if filter.MaxAverageRating != nil && avg > float64(*filter.MaxAverageRating) {
+				return false
+			}
+		}
+		if filter.RatedBy != nil && !s.hasVoted(*filter.RatedBy, song.SongID) {
+			return false
+		}
+		if filter.NotRatedBy != nil && s.hasVoted(*filter.NotRatedBy, song.SongID) {
+			return false
+		}
+		if len(filter.NotRatedByAll) > 0 {
+			ratedByAll := true
+			for _, userID := range filter.NotRatedByAll {
+				if !s.hasVoted(userID, song.SongID) {
+					ratedByAll = false
+					break
+				}
+			}
+			if ratedByAll {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (s *Store) RandomSongs(filter database.SongFilter, limit int) ([]models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	songs := s.listSongs(s.songMatcher(filter))
+
+	rand.Shuffle(len(songs), func(i, j int) {
+		songs[i], songs[j] = songs[j], songs[i]
+	})
+	if limit >= 0 && len(songs) > limit {
+		songs = songs[:limit]
+	}
+	return songs, nil
+}
+
+func (s *Store) RandomSongByVotes(filter database.SongFilter) (*models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	songs := s.listSongs(s.songMatcher(filter))
+	if len(songs) == 0 {
+		return nil, nil
+	}
+	stats := s.songStats(nil)
+	weights := make([]float64, len(songs))
+	total := 0.0
+	for i, song := range songs {
+		weights[i] = 1 / float64(1+stats[song.SongID].VoteCount)
+		total += weights[i]
+	}
+	r := rand.Float64() * total
+	for i, weight := range weights {
+		if r < weight {
+			return &songs[i], nil
+		}
+		r -= weight
+	}
+	return &songs[len(songs)-1], nil
+}
+
+func (s *Store) GetSongCredits(filter database.SongFilter) ([]database.SongCredits, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	match := s.songMatcher(filter)
+	var credits []database.SongCredits
+	for _, id := range sortedKeys(s.songs) {
+		if song := s.songs[id]; match(song) {
+			credits = append(credits, database.SongCredits{
+				SongID:    id,
+				ArtistIDs: s.songArtists.rights(id),
+				UnitIDs:   s.songUnits.rights(id),
+			})
+		}
+	}
+	return credits, nil
+}
+
+func (s *Store) ListSongs(filter database.SongFilter, opts database.ListOptions) (*database.Page[database.SongWithStats], error) {
+	opts, cursor, err := database.PrepareList(opts, database.SongListing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := s.songStats(nil)
+	match := s.songMatcher(filter)
+	var songs []database.SongWithStats
+	for _, song := range s.songs {
+		if match(song) {
+			songs = append(songs, database.SongWithStats{Song: song, SongStats: stats[song.SongID]})
+		}
+	}
+
+	page := paginate(songs, opts, cursor, func(song database.SongWithStats) (any, uint) {
+		return database.SongSortValue(song, opts.Sort), song.SongID
+	})
+	for i := range page.Items {
+		page.Items[i].Song = s.includeSong(page.Items[i].Song, opts.Include)
+	}
+	return page, nil
+}
+
+// ============= ARTISTS =============
+
+func (s *Store) CreateArtist(artist *models.Artist) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if artist == nil {
+		return errors.New("artist cannot be nil")
+	}
+	if strings.TrimSpace(artist.NameOriginal) == "" {
+		return invalid("original name cannot be empty")
+	}
+	if !s.categoryExists(artist.CategoryID) {
+		return invalid("specified category does not exist")
+	}
+
+	now := time.Now()
+	artist.ArtistID = s.nextID()
+	artist.CreatedAt = now
+	artist.UpdatedAt = now
+	s.storeArtist(artist)
+	return nil
+}
+
+func (s *Store) storeArtist(artist *models.Artist) {
+	stored := *artist
+	stored.Category = nil
+	stored.Units = nil
+	stored.Songs = nil
+	s.artists[artist.ArtistID] = stored
+
+	for _, unit := range artist.Units {
+		s.artistUnits.add(artist.ArtistID, unit.UnitID)
+	}
+	for _, song := range artist.Songs {
+		s.songArtists.add(song.SongID, artist.ArtistID)
+	}
+}
+
+func (s *Store) GetArtistByID(artistID uint) (*models.Artist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	artist, ok := s.artists[artistID]
+	if !ok {
+		return nil, notFound("artist")
+	}
+	artist = s.hydrateArtist(artist)
+	return &artist, nil
+}
+
+func (s *Store) GetArtistsByIDs(artistIDs []uint) ([]models.Artist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.plainArtists(artistIDs), nil
+}
+
+func (s *Store) GetAllArtists() ([]models.Artist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	artists := make([]models.Artist, 0, len(s.artists))
+	for _, id := range sortedKeys(s.artists) {
+		artists = append(artists, s.hydrateArtist(s.artists[id]))
+	}
+	return artists, nil
+}
+
+func (s *Store) ListArtists(filter database.ArtistFilter, opts database.ListOptions) (*database.Page[models.Artist], error) {
+	opts, cursor, err := database.PrepareList(opts, database.ArtistListing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var artists []models.Artist
+	for _, artist := range s.artists {
+		if filter.CategoryID != nil && (artist.CategoryID == nil || *artist.CategoryID != *filter.CategoryID) {
+			continue
+		}
+		if filter.UnitID != nil && !slices.Contains(s.artistUnits.rights(artist.ArtistID), *filter.UnitID) {
+			continue
+		}
+		artists = append(artists, artist)
+	}
+
+	page := paginate(artists, opts, cursor, func(artist models.Artist) (any, uint) {
+		return database.NamedSortValue(opts.Sort, artist.NameOriginal, artist.CreatedAt), artist.ArtistID
+	})
+	for i := range page.Items {
+		page.Items[i] = s.includeArtist(page.Items[i], opts.Include)
+	}
+	return page, nil
+}
+
+func (s *Store) SearchArtists(query string) ([]models.Artist, error) {
+	if strings.TrimSpace(query) == "" {
+		return s.GetAllArtists()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var artists []models.Artist
+	for _, id := range sortedKeys(s.artists) {
+		artist := s.hydrateArtist(s.artists[id])
+		categoryName := ""
+		if artist.Category != nil {
+			categoryName = artist.Category.Name
+		}
+		if containsFold(artist.NameOriginal, query) || containsFold(artist.NameEnglish, query) || containsFold(categoryName, query) {
+			artists = append(artists, artist)
+		}
+	}
+	return artists, nil
+}
+
+func (s *Store) UpdateArtist(artist *models.Artist) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.artists[artist.ArtistID]
+	if !ok {
+		return errors.New("artist does not exist")
+	}
+	if strings.TrimSpace(artist.NameOriginal) == "" {
+		return invalid("original name cannot be empty")
+	}
+
+	artist.CreatedAt = existing.CreatedAt
+	artist.UpdatedAt = time.Now()
+	s.storeArtist(artist)
+	return nil
+}
+
+func (s *Store) DeleteArtist(artistID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	artist, ok := s.artists[artistID]
+	if !ok {
+		return errors.New("artist does not exist")
+	}
+
+	artist.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	s.trash[trashKey{database.TrashArtist, artistID}] = artist
+	delete(s.artists, artistID)
+	return nil
+}
+
+func (s *Store) ArtistExists(artistID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.artists[artistID]
+	return ok, nil
+}
+
+// ============= UNITS =============
+
+func (s *Store) CreateUnit(unit *models.Unit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if unit == nil {
+		return errors.New("unit cannot be nil")
+	}
+	if strings.TrimSpace(unit.NameOriginal) == "" {
+		return invalid("original name cannot be empty")
+	}
+	if !s.categoryExists(unit.CategoryID) {
+		return invalid("specified category does not exist")
+	}
+
+	now := time.Now()
+	unit.UnitID = s.nextID()
+	unit.CreatedAt = now
+	unit.UpdatedAt = now
+	s.storeUnit(unit)
+	return nil
+}
+
+func (s *Store) storeUnit(unit *models.Unit) {
+	stored := *unit
+	stored.Category = nil
+	stored.Artists = nil
+	s.units[unit.UnitID] = stored
+
+	for _, artist := range unit.Artists {
+		s.artistUnits.add(artist.ArtistID, unit.UnitID)
+	}
+}
+
+func (s *Store) GetUnitByID(unitID uint) (*models.Unit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	unit, ok := s.units[unitID]
+	if !ok {
+		return nil, notFound("unit")
+	}
+	unit = s.hydrateUnit(unit)
+	return &unit, nil
+}
+
+func (s *Store) GetUnitsByIDs(unitIDs []uint) ([]models.Unit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.plainUnits(unitIDs), nil
+}
+
+func (s *Store) GetAllUnits() ([]models.Unit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	units := make([]models.Unit, 0, len(s.units))
+	for _, id := range sortedKeys(s.units) {
+		units = append(units, s.hydrateUnit(s.units[id]))
+	}
+	return units, nil
+}
+
+func (s *Store) ListUnits(filter database.UnitFilter, opts database.ListOptions) (*database.Page[models.Unit], error) {
+	opts, cursor, err := database.PrepareList(opts, database.UnitListing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var units []models.Unit
+	for _, unit := range s.units {
+		if filter.CategoryID != nil && (unit.CategoryID == nil || *unit.CategoryID != *filter.CategoryID) {
+			continue
+		}
+		if filter.ArtistID != nil && !slices.Contains(s.artistUnits.lefts(unit.UnitID), *filter.ArtistID) {
+			continue
+		}
+		units = append(units, unit)
+	}
+
+	page := paginate(units, opts, cursor, func(unit models.Unit) (any, uint) {
+		return database.NamedSortValue(opts.Sort, unit.NameOriginal, unit.CreatedAt), unit.UnitID
+	})
+	for i := range page.Items {
+		page.Items[i] = s.includeUnit(page.Items[i], opts.Include)
+	}
+	return page, nil
+}
+
+func (s *Store) UpdateUnit(unit *models.Unit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.units[unit.UnitID]
+	if !ok {
+		return errors.New("unit does not exist")
+	}
+	if strings.TrimSpace(unit.NameOriginal) == "" {
+		return invalid("original name cannot be empty")
+	}
+
+	unit.CreatedAt = existing.CreatedAt
+	unit.UpdatedAt = time.Now()
+	s.storeUnit(unit)
+	return nil
+}
+
+func (s *Store) DeleteUnit(unitID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unit, ok := s.units[unitID]
+	if !ok {
+		return errors.New("unit does not exist")
+	}
+
+	unit.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	s.trash[trashKey{database.TrashUnit, unitID}] = unit
+	delete(s.units, unitID)
+	return nil
+}
+
+func (s *Store) UnitExists(unitID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.units[unitID]
+	return ok, nil
+}
+
+// ============= ALBUMS =============
+
+func (s *Store) CreateAlbum(album *models.Album) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if album == nil {
+		return errors.New("album cannot be nil")
+	}
+	if strings.TrimSpace(album.NameOriginal) == "" {
+		return invalid("original name cannot be empty")
+	}
+	if album.Type != "Album" && album.Type != "Single" && album.Type != "EP" {
+		return invalid("album type must be one of: Album, Single, EP")
+	}
+	if !s.categoryExists(album.CategoryID) {
+		return invalid("specified category does not exist")
+	}
+
+	now := time.Now()
+	album.AlbumID = s.nextID()
+	album.CreatedAt = now
+	album.UpdatedAt = now
+	s.storeAlbum(album)
+	return nil
+}
+
+func (s *Store) storeAlbum(album *models.Album) {
+	stored := *album
+	stored.Category = nil
+	stored.Songs = nil
+	s.albums[album.AlbumID] = stored
+
+	for _, song := range album.Songs {
+		s.albumSongs.add(album.AlbumID, song.SongID)
+	}
+}
+
+func (s *Store) GetAlbumByID(albumID uint) (*models.Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	album, ok := s.albums[albumID]
+	if !ok {
+		return nil, notFound("album")
+	}
+	album = s.hydrateAlbum(album)
+	return &album, nil
+}
+
+func (s *Store) GetAlbumsByIDs(albumIDs []uint) ([]models.Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.plainAlbums(albumIDs), nil
+}
+
+func (s *Store) GetAllAlbums() ([]models.Album, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	albums := make([]models.Album, 0, len(s.albums))
+	for _, id := range sortedKeys(s.albums) {
+		albums = append(albums, s.hydrateAlbum(s.albums[id]))
+	}
+	return albums, nil
+}
+
+func (s *Store) ListAlbums(filter database.AlbumFilter, opts database.ListOptions) (*database.Page[models.Album], error) {
+	opts, cursor, err := database.PrepareList(opts, database.AlbumListing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var albums []models.Album
+	for _, album := range s.albums {
+		if filter.CategoryID != nil && (album.CategoryID == nil || *album.CategoryID != *filter.CategoryID) {
+			continue
+		}
+		if filter.Type != "" && album.Type != filter.Type {
+			continue
+		}
+		if filter.SongID != nil && !slices.Contains(s.albumSongs.rights(album.AlbumID), *filter.SongID) {
+			continue
+		}
+		albums = append(albums, album)
+	}
+
+	page := paginate(albums, opts, cursor, func(album models.Album) (any, uint) {
+		return database.NamedSortValue(opts.Sort, album.NameOriginal, album.CreatedAt), album.AlbumID
+	})
+	for i := range page.Items {
+		page.Items[i] = s.includeAlbum(page.Items[i], opts.Include)
+	}
+	return page, nil
+}
+
+func (s *Store) UpdateAlbum(album *models.Album) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.albums[album.AlbumID]
+	if !ok {
+		return errors.New("album does not exist")
+	}
+	if strings.TrimSpace(album.NameOriginal) == "" {
+		return invalid("original name cannot be empty")
+	}
+
+	album.CreatedAt = existing.CreatedAt
+	album.UpdatedAt = time.Now()
+	s.storeAlbum(album)
+	return nil
+}
+
+func (s *Store) DeleteAlbum(albumID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	album, ok := s.albums[albumID]
+	if !ok {
+		return errors.New("album does not exist")
+	}
+
+	album.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	s.trash[trashKey{database.TrashAlbum, albumID}] = album
+	delete(s.albums, albumID)
+	return nil
+}
+
+func (s *Store) AlbumExists(albumID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.albums[albumID]
+	return ok, nil
+}
+
+// ============= CATEGORIES =============
+
+func (s *Store) categoryNameTaken(name string, exceptID uint) bool {
+	for id, category := range s.categories {
+		if id != exceptID && category.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateCategory(category *models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if category == nil {
+		return errors.New("category cannot be nil")
+	}
+	if strings.TrimSpace(category.Name) == "" {
+		return invalid("category name cannot be empty")
+	}
+	if s.categoryNameTaken(category.Name, 0) {
+		return invalid("category name already exists")
+	}
+
+	now := time.Now()
+	category.CategoryID = s.nextID()
+	category.CreatedAt = now
+	category.UpdatedAt = now
+	s.categories[category.CategoryID] = *category
+	return nil
+}
+
+func (s *Store) GetCategoryByID(categoryID uint) (*models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	category, ok := s.categories[categoryID]
+	if !ok {
+		return nil, notFound("category")
+	}
+	return &category, nil
+}
+
+func (s *Store) GetCategoryByName(name string) (*models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.categories) {
+		if category := s.categories[id]; category.Name == name {
+			return &category, nil
+		}
+	}
+	return nil, notFound("category by name")
+}
+
+func (s *Store) GetAllCategories() ([]models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	categories := make([]models.Category, 0, len(s.categories))
+	for _, id := range sortedKeys(s.categories) {
+		categories = append(categories, s.categories[id])
+	}
+	return categories, nil
+}
+
+func (s *Store) UpdateCategory(category *models.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.categories[category.CategoryID]
+	if !ok {
+		return errors.New("category does not exist")
+	}
+	if strings.TrimSpace(category.Name) == "" {
+		return invalid("category name cannot be empty")
+	}
+	if s.categoryNameTaken(category.Name, category.CategoryID) {
+		return errors.New("category name already exists")
+	}
+
+	category.CreatedAt = existing.CreatedAt
+	category.UpdatedAt = time.Now()
+	s.categories[category.CategoryID] = *category
+	return nil
+}
+
+func (s *Store) DeleteCategory(categoryID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category, ok := s.categories[categoryID]
+	if !ok {
+		return errors.New("category does not exist")
+	}
+
+	category.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	s.trash[trashKey{database.TrashCategory, categoryID}] = category
+	delete(s.categories, categoryID)
+	return nil
+}
+
+func (s *Store) CategoryExists(categoryID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.categories[categoryID]
+	return ok, nil
+}
+
+// ============= VOTES =============
+
+func (s *Store) findVote(userID, songID uint) (models.Vote, bool) {
+	for _, vote := range s.votes {
+		if vote.UserID == userID && vote.SongID == songID {
+			return vote, true
+		}
+	}
+	return models.Vote{}, false
+}
+
+func (s *Store) GetVoteByID(voteID uint) (*models.Vote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vote, ok := s.votes[voteID]
+	if !ok {
+		return nil, notFound("vote")
+	}
+	return &vote, nil
+}
+
+func (s *Store) GetVote(userID, songID uint) (*models.Vote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vote, ok := s.findVote(userID, songID)
+	if !ok {
+		return nil, notFound("vote")
+	}
+	return &vote, nil
+}
+
+func matchesIDs(ids []uint, id uint) bool {
+	if ids == nil {
+		return true
+	}
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// filterVotes returns the votes matching the filter, leaving out votes on
+// songs in the trash. Callers must hold s.mu.
+func (s *Store) filterVotes(filter database.VoteFilter) []models.Vote {
+	var votes []models.Vote
+	for _, id := range sortedKeys(s.votes) {
+		vote := s.votes[id]
+		if !matchesIDs(filter.UserIDs, vote.UserID) || !matchesIDs(filter.SongIDs, vote.SongID) {
+			continue
+		}
+		if _, trashed := s.trash[trashKey{database.TrashSong, vote.SongID}]; trashed {
+			continue
+		}
+		if filter.MinRating != nil && vote.Rating < *filter.MinRating {
+			continue
+		}
+		if filter.MaxRating != nil && vote.Rating > *filter.MaxRating {
+			continue
+		}
+		votes = append(votes, vote)
+	}
+	return votes
+}
+
+func (s *Store) GetVotes(filter database.VoteFilter) ([]models.Vote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.filterVotes(filter), nil
+}
+
+func (s *Store) ListVotes(filter database.VoteFilter, opts database.ListOptions) (*database.Page[models.Vote], error) {
+	opts, cursor, err := database.PrepareList(opts, database.VoteListing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return paginate(s.filterVotes(filter), opts, cursor, func(vote models.Vote) (any, uint) {
+		return database.VoteSortValue(vote, opts.Sort), vote.VoteID
+	}), nil
+}
+
+func (s *Store) GetVotesByUser(userID uint) ([]models.Vote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return nil, errors.New("user does not exist")
+	}
+	return s.filterVotes(database.VoteFilter{UserIDs: []uint{userID}}), nil
+}
+
+func (s *Store) GetVotesWithUsers(filter database.VoteFilter) ([]database.VoteWithUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	votes := s.filterVotes(filter)
+	result := make([]database.VoteWithUser, 0, len(votes))
+	for _, vote := range votes {
+		result = append(result, database.VoteWithUser{
+			Vote:     vote,
+			Username: s.users[vote.UserID].Username,
+			IsGuest:  s.users[vote.UserID].IsGuest,
+		})
+	}
+	return result, nil
+}
+
+func (s *Store) UpsertVote(vote *models.Vote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if vote == nil {
+		return errors.New("vote cannot be nil")
+	}
+	if vote.Rating < 1 || vote.Rating > 10 {
+		return invalid("rating must be between 1 and 10")
+	}
+	if _, ok := s.users[vote.UserID]; !ok {
+		return invalid("user does not exist")
+	}
+	if _, ok := s.songs[vote.SongID]; !ok {
+		return invalid("song does not exist")
+	}
+
+	now := time.Now()
+	if existing, ok := s.findVote(vote.UserID, vote.SongID); ok {
+		existing.Rating = vote.Rating
+		existing.Comment = vote.Comment
+		existing.UpdatedAt = now
+		s.votes[existing.VoteID] = existing
+		*vote = existing
+		return nil
+	}
+
+	vote.VoteID = s.nextID()
+	vote.CreatedAt = now
+	vote.UpdatedAt = now
+	s.votes[vote.VoteID] = *vote
+	return nil
+}
+
+func (s *Store) DeleteVote(userID, songID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vote, ok := s.findVote(userID, songID)
+	if !ok {
+		return errors.New("vote does not exist")
+	}
+	delete(s.votes, vote.VoteID)
+	return nil
+}
+
+func (s *Store) VoteExists(userID, songID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.findVote(userID, songID)
+	return ok, nil
+}
+
+func (s *Store) GetAverageRatingForSong(songID uint) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.songs[songID]; !ok {
+		return 0, errors.New("song does not exist")
+	}
+	avg, _ := s.averageRating(songID)
+	return avg, nil
+}
+
+func (s *Store) GetVoteCountForSong(songID uint) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.songs[songID]; !ok {
+		return 0, errors.New("song does not exist")
+	}
+	return int64(len(s.filterVotes(database.VoteFilter{SongIDs: []uint{songID}}))), nil
+}
+
+// songStats aggregates the votes of the given songs, or of all songs when
+// songIDs is nil. Callers must hold s.mu.
+func (s *Store) songStats(songIDs []uint) map[uint]database.SongStats {
+	totals := make(map[uint]int)
+	stats := make(map[uint]database.SongStats)
+	for _, vote := range s.votes {
+		if !matchesIDs(songIDs, vote.SongID) {
+			continue
+		}
+		totals[vote.SongID] += vote.Rating
+		songStats := stats[vote.SongID]
+		songStats.VoteCount++
+		stats[vote.SongID] = songStats
+	}
+	for songID, songStats := range stats {
+		songStats.AverageScore = float64(totals[songID]) / float64(songStats.VoteCount)
+		stats[songID] = songStats
+	}
+	return stats
+}
+
+func (s *Store) GetSongStats(songIDs []uint) (map[uint]database.SongStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.songStats(songIDs), nil
+}
+
+// ============= USER STATS =============
+
+// groupTotal sums the ratings a user gave the songs of one group
+type groupTotal struct {
+	name  string
+	total int
+	count int64
+}
+
+// groupRatings averages group totals, best rated first
+func groupRatings(totals map[uint]*groupTotal) []database.GroupRating {
+	groups := make([]database.GroupRating, 0, len(totals))
+	for id, group := range totals {
+		groups = append(groups, database.GroupRating{
+			ID:            id,
+			Name:          group.name,
+			AverageRating: float64(group.total) / float64(group.count),
+			VoteCount:     group.count,
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].AverageRating != groups[j].AverageRating {
+			return groups[i].AverageRating > groups[j].AverageRating
+		}
+		if groups[i].VoteCount != groups[j].VoteCount {
+			return groups[i].VoteCount > groups[j].VoteCount
+		}
+		return groups[i].ID < groups[j].ID
+	})
+	return groups
+}
+
+func (s *Store) GetUserStats(userID uint) (*database.UserStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return nil, notFound("user")
+	}
+	stats := &database.UserStats{UserID: userID, SongCount: int64(len(s.songs))}
+
+	// The community average of a song leaves out the user's own vote
+	others := make(map[uint]*groupTotal)
+	for _, vote := range s.filterVotes(database.VoteFilter{}) {
+		if vote.UserID == userID {
+			continue
+		}
+		if others[vote.SongID] == nil {
+			others[vote.SongID] = &groupTotal{}
+		}
+		others[vote.SongID].total += vote.Rating
+		others[vote.SongID].count++
+	}
+
+	counts := make(map[int]int64)
+	categories := make(map[uint]*groupTotal)
+	artists := make(map[uint]*groupTotal)
+	units := make(map[uint]*groupTotal)
+	months := make(map[string]*groupTotal)
+	add := func(totals map[uint]*groupTotal, id uint, name string, rating int) {
+		if totals[id] == nil {
+			totals[id] = &groupTotal{name: name}
+		}
+		totals[id].total += rating
+		totals[id].count++
+	}
+	total := 0
+	for _, vote := range s.filterVotes(database.VoteFilter{UserIDs: []uint{userID}}) {
+		song := s.songs[vote.SongID]
+		stats.VoteCount++
+		total += vote.Rating
+		counts[vote.Rating]++
+
+		if song.CategoryID != nil {
+			if category, ok := s.categories[*song.CategoryID]; ok {
+				add(categories, category.CategoryID, category.Name, vote.Rating)
+			}
+		}
+		for _, artistID := range s.songArtists.rights(song.SongID) {
+			if artist, ok := s.artists[artistID]; ok {
+				add(artists, artistID, artist.NameOriginal, vote.Rating)
+			}
+		}
+		for _, unitID := range s.songUnits.rights(song.SongID) {
+			if unit, ok := s.units[unitID]; ok {
+				add(units, unitID, unit.NameOriginal, vote.Rating)
+			}
+		}
+
+		month := vote.CreatedAt.Format("2006-01")
+		if months[month] == nil {
+			months[month] = &groupTotal{}
+		}
+		months[month].total += vote.Rating
+		months[month].count++
+
+		if community := others[vote.SongID]; community != nil {
+			average := float64(community.total) / float64(community.count)
+			stats.Divergent = append(stats.Divergent, database.DivergentRating{
+				SongID:           song.SongID,
+				NameOriginal:     song.NameOriginal,
+				NameEnglish:      song.NameEnglish,
+				Rating:           vote.Rating,
+				CommunityAverage: average,
+				CommunityVotes:   community.count,
+				Difference:       float64(vote.Rating) - average,
+			})
+		}
+	}
+
+	if stats.VoteCount > 0 {
+		stats.AverageRating = float64(total) / float64(stats.VoteCount)
+	}
+	if stats.SongCount > 0 {
+		stats.Coverage = float64(stats.VoteCount) / float64(stats.SongCount)
+	}
+	stats.Distribution = database.FillDistribution(counts)
+	stats.Categories = groupRatings(categories)
+	stats.Artists = groupRatings(artists)
+	stats.Units = groupRatings(units)
+
+	sort.Slice(stats.Divergent, func(i, j int) bool {
+		a, b := math.Abs(stats.Divergent[i].Difference), math.Abs(stats.Divergent[j].Difference)
+		if a != b {
+			return a > b
+		}
+		return stats.Divergent[i].SongID < stats.Divergent[j].SongID
+	})
+	if len(stats.Divergent) > database.DivergentSongLimit {
+		stats.Divergent = stats.Divergent[:database.DivergentSongLimit]
+	}
+
+	for _, month := range slices.Sorted(maps.Keys(months)) {
+		stats.Activity = append(stats.Activity, database.ActivityPeriod{
+			Month:         month,
+			VoteCount:     months[month].count,
+			AverageRating: float64(months[month].total) / float64(months[month].count),
+		})
+	}
+	return stats, nil
+}
+
+// sharedRatings lists the songs two users both rated. Callers must hold s.mu.
+func (s *Store) sharedRatings(userA, userB uint) []database.SharedRating {
+	ratingsB := make(map[uint]int)
+	for _, vote := range s.filterVotes(database.VoteFilter{UserIDs: []uint{userB}}) {
+		ratingsB[vote.SongID] = vote.Rating
+	}
+
+	var shared []database.SharedRating
+	for _, vote := range s.filterVotes(database.VoteFilter{UserIDs: []uint{userA}}) {
+		ratingB, ok := ratingsB[vote.SongID]
+		if !ok {
+			continue
+		}
+		song := s.songs[vote.SongID]
+		shared = append(shared, database.SharedRating{
+			SongID:       vote.SongID,
+			NameOriginal: song.NameOriginal,
+			NameEnglish:  song.NameEnglish,
+			RatingA:      vote.Rating,
+			RatingB:      ratingB,
+		})
+	}
+	sort.Slice(shared, func(i, j int) bool { return shared[i].SongID < shared[j].SongID })
+	return shared
+}
+
+func (s *Store) GetCompatibility(userIDs []uint) ([]database.Compatibility, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := slices.Clone(userIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	var pairs []database.Compatibility
+	for i, userA := range ids {
+		for _, userB := range ids[i+1:] {
+			if shared := s.sharedRatings(userA, userB); len(shared) > 0 {
+				pairs = append(pairs, database.CompareRatings(userA, userB, shared))
+			}
+		}
+	}
+	database.SortCompatibility(pairs)
+	return pairs, nil
+}
+
+func (s *Store) GetSharedRatings(userA, userB uint) ([]database.SharedRating, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, userID := range []uint{userA, userB} {
+		if _, ok := s.users[userID]; !ok {
+			return nil, notFound("user")
+		}
+	}
+	return s.sharedRatings(userA, userB), nil
+}
+
+// ============= RECOMMENDATIONS =============
+
+func (s *Store) ReplaceSongSimilarities(similarities []models.SongSimilarity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.similarities = slices.Clone(similarities)
+	return nil
+}
+
+func (s *Store) GetSongNeighbors(neighborIDs []uint) ([]models.SongSimilarity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	neighbors := make(map[uint]bool, len(neighborIDs))
+	for _, id := range neighborIDs {
+		neighbors[id] = true
+	}
+	var similarities []models.SongSimilarity
+	for _, similarity := range s.similarities {
+		if _, ok := s.songs[similarity.SongID]; ok && neighbors[similarity.NeighborID] {
+			similarities = append(similarities, similarity)
+		}
+	}
+	return similarities, nil
+}
+
+// ============= CHARTS =============
+
+func (s *Store) ReplaceChartEntries(entries []models.ChartEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.charts = slices.Clone(entries)
+	return nil
+}
+
+func (s *Store) GetChart(chart, scope string, scopeID uint) ([]models.ChartEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []models.ChartEntry
+	for _, entry := range s.charts {
+		if entry.Chart != chart || entry.Scope != scope || entry.ScopeID != scopeID {
+			continue
+		}
+		if _, ok := s.songs[entry.SongID]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Rank < entries[j].Rank })
+	return entries, nil
+}
+
+func (s *Store) GetChartScopeIDs(scope string) ([]uint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, entry := range s.charts {
+		if entry.Scope == scope && !seen[entry.ScopeID] {
+			seen[entry.ScopeID] = true
+			ids = append(ids, entry.ScopeID)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// ============= USERS =============
+
+func (s *Store) usernameTaken(username string, exceptID uint) bool {
+	for id, user := range s.users {
+		if id != exceptID && user.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user == nil {
+		return errors.New("user cannot be nil")
+	}
+	if strings.TrimSpace(user.Username) == "" {
+		return invalid("username cannot be empty")
+	}
+	if len(user.Username) > 50 {
+		return invalid("username cannot exceed 50 characters")
+	}
+	if s.usernameTaken(user.Username, 0) {
+		return invalid("username already exists")
+	}
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	if !models.ValidRole(user.Role) {
+		return invalid("unknown role %q", user.Role)
+	}
+
+	now := time.Now()
+	user.UserID = s.nextID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	s.users[user.UserID] = *user
+	return nil
+}
+
+func (s *Store) GetUserByID(userID uint) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, notFound("user")
+	}
+	return &user, nil
+}
+
+func (s *Store) GetUserByUsername(username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, notFound("user by username")
+}
+
+func (s *Store) GetAllUsers() ([]models.User, error) {
+	return s.SearchUsers("")
+}
+
+func (s *Store) SearchUsers(query string) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, id := range sortedKeys(s.users) {
+		if user := s.users[id]; containsFold(user.Username, query) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *Store) UpdateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.users[user.UserID]
+	if !ok {
+		return errors.New("user does not exist")
+	}
+	if strings.TrimSpace(user.Username) == "" {
+		return invalid("username cannot be empty")
+	}
+	if s.usernameTaken(user.Username, user.UserID) {
+		return errors.New("username already exists")
+	}
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	if !models.ValidRole(user.Role) {
+		return invalid("unknown role %q", user.Role)
+	}
+
+	user.CreatedAt = existing.CreatedAt
+	user.UpdatedAt = time.Now()
+	s.users[user.UserID] = *user
+	return nil
+}
+
+func (s *Store) DeleteUser(userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return errors.New("user does not exist")
+	}
+	delete(s.users, userID)
+	for id, token := range s.apiTokens {
+		if token.UserID == userID {
+			delete(s.apiTokens, id)
+		}
+	}
+	for id, event := range s.auditEvents {
+		if event.ActorID != nil && *event.ActorID == userID {
+			event.ActorID = nil
+			s.auditEvents[id] = event
+		}
+	}
+	return nil
+}
+
+func (s *Store) UserExists(userID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.users[userID]
+	return ok, nil
+}
+
+func (s *Store) UsernameExists(username string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.usernameTaken(username, 0), nil
+}
+
+func (s *Store) SetUserRole(userID uint, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !models.ValidRole(role) {
+		return invalid("unknown role %q", role)
+	}
+	user, ok := s.users[userID]
+	if !ok {
+		return notFound("user")
+	}
+	if err := database.CheckRoleChange(user, role, s.countRole(models.RoleAdmin)); err != nil {
+		return err
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	s.users[userID] = user
+	return nil
+}
+
+func (s *Store) ClaimFirstAdmin(userID uint) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok || user.IsGuest || s.countRole(models.RoleAdmin) > 0 {
+		return false, nil
+	}
+	user.Role = models.RoleAdmin
+	user.UpdatedAt = time.Now()
+	s.users[userID] = user
+	return true, nil
+}
+
+func (s *Store) CountUsersByRole(role string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(s.countRole(role)), nil
+}
+
+func (s *Store) countRole(role string) int {
+	count := 0
+	for _, user := range s.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Store) ClaimGuest(guestID, userID uint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	guest, ok := s.users[guestID]
+	if !ok {
+		return 0, notFound("guest")
+	}
+	if !guest.IsGuest {
+		return 0, invalid("user %d is not a guest", guestID)
+	}
+	if _, ok := s.users[userID]; !ok || guestID == userID {
+		return 0, invalid("user does not exist")
+	}
+
+	// The account keeps its own vote where both rated the same song
+	var moved int64
+	for id, vote := range s.votes {
+		if vote.UserID != guestID {
+			continue
+		}
+		if _, taken := s.findVote(userID, vote.SongID); taken {
+			delete(s.votes, id)
+			continue
+		}
+		vote.UserID = userID
+		s.votes[id] = vote
+		moved++
+	}
+
+	for key := range s.roomAccess {
+		if key.userID == guestID {
+			delete(s.roomAccess, key)
+			key.userID = userID
+			s.roomAccess[key] = true
+		}
+	}
+
+	delete(s.users, guestID)
+	return moved, nil
+}
+
+func (s *Store) DeleteStaleGuests(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, user := range s.users {
+		if !user.IsGuest || !user.CreatedAt.Before(before) {
+			continue
+		}
+		if len(s.filterVotes(database.VoteFilter{UserIDs: []uint{id}})) > 0 {
+			continue
+		}
+		delete(s.users, id)
+		for key := range s.roomAccess {
+			if key.userID == id {
+				delete(s.roomAccess, key)
+			}
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// ============= ROOMS =============
+
+func (s *Store) CreateRatingRoom(room *models.RatingRoom) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+	if strings.TrimSpace(room.RoomID) == "" {
+		return invalid("room ID cannot be empty")
+	}
+	if _, exists := s.ratingRooms[room.RoomID]; exists {
+		return fmt.Errorf("failed to create rating room: room %s already exists", room.RoomID)
+	}
+	s.ratingRooms[room.RoomID] = *room
+	return nil
+}
+
+func (s *Store) GetRatingRoom(roomID string) (*models.RatingRoom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, ok := s.ratingRooms[roomID]
+	if !ok {
+		return nil, notFound("rating room")
+	}
+	return &room, nil
+}
+
+func (s *Store) SetRatingRoomCurrentSong(roomID string, songID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, ok := s.ratingRooms[roomID]; ok {
+		room.CurrentSongID = &songID
+		room.RecentSongIDs = database.PushRecentSong(room.RecentSongIDs, songID)
+		room.LastActive = time.Now()
+		s.ratingRooms[roomID] = room
+	}
+	return nil
+}
+
+func (s *Store) TouchRatingRoom(roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, ok := s.ratingRooms[roomID]; ok {
+		room.LastActive = time.Now()
+		s.ratingRooms[roomID] = room
+	}
+	return nil
+}
+
+func (s *Store) DeleteInactiveRatingRooms(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, room := range s.ratingRooms {
+		if room.LastActive.Before(before) {
+			delete(s.ratingRooms, id)
+			s.deleteRoomAccess(models.RoomTypeRating, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) CreateRadioRoom(room *models.RadioRoom) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+	if strings.TrimSpace(room.RoomID) == "" {
+		return invalid("room ID cannot be empty")
+	}
+	if _, exists := s.radioRooms[room.RoomID]; exists {
+		return fmt.Errorf("failed to create radio room: room %s already exists", room.RoomID)
+	}
+	s.radioRooms[room.RoomID] = *room
+	return nil
+}
+
+func (s *Store) GetRadioRoom(roomID string) (*models.RadioRoom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, ok := s.radioRooms[roomID]
+	if !ok {
+		return nil, notFound("radio room")
+	}
+	return &room, nil
+}
+
+func (s *Store) SetRadioRoomCurrentSong(roomID string, songID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, ok := s.radioRooms[roomID]; ok {
+		room.CurrentSongID = &songID
+		room.LastActive = time.Now()
+		s.radioRooms[roomID] = room
+	}
+	return nil
+}
+
+func (s *Store) TouchRadioRoom(roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, ok := s.radioRooms[roomID]; ok {
+		room.LastActive = time.Now()
+		s.radioRooms[roomID] = room
+	}
+	return nil
+}
+
+func (s *Store) DeleteInactiveRadioRooms(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, room := range s.radioRooms {
+		if room.LastActive.Before(before) {
+			delete(s.radioRooms, id)
+			s.deleteRoomAccess(models.RoomTypeRadio, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// deleteRoomAccess drops the allow-list of a room. Callers must hold s.mu.
+func (s *Store) deleteRoomAccess(roomType, roomID string) {
+	for key := range s.roomAccess {
+		if key.roomType == roomType && key.roomID == roomID {
+			delete(s.roomAccess, key)
+		}
+	}
+}
+
+// copyTreeState deep-copies a bracket so callers never share slices with the store
+func copyTreeState(tree models.TreeState) models.TreeState {
+	var copied models.TreeState
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return tree
+	}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return tree
+	}
+	return copied
+}
+
+func (s *Store) CreateTournamentRoom(room *models.TournamentRoom) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+	if strings.TrimSpace(room.RoomID) == "" {
+		return invalid("room ID cannot be empty")
+	}
+	if _, exists := s.tournamentRooms[room.RoomID]; exists {
+		return fmt.Errorf("failed to create tournament room: room %s already exists", room.RoomID)
+	}
+
+	stored := *room
+	stored.TreeState = copyTreeState(room.TreeState)
+	s.tournamentRooms[room.RoomID] = stored
+	return nil
+}
+
+func (s *Store) GetTournamentRoom(roomID string) (*models.TournamentRoom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, ok := s.tournamentRooms[roomID]
+	if !ok {
+		return nil, notFound("tournament room")
+	}
+	room.TreeState = copyTreeState(room.TreeState)
+	return &room, nil
+}
+
+func (s *Store) UpdateTournamentRoom(room *models.TournamentRoom) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+
+	stored, ok := s.tournamentRooms[room.RoomID]
+	if !ok {
+		return nil
+	}
+	room.LastActive = time.Now()
+	stored.TreeState = copyTreeState(room.TreeState)
+	stored.Status = room.Status
+	stored.CurrentMatchID = room.CurrentMatchID
+	stored.LastActive = room.LastActive
+	s.tournamentRooms[room.RoomID] = stored
+	return nil
+}
+
+func (s *Store) TouchTournamentRoom(roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, ok := s.tournamentRooms[roomID]; ok {
+		room.LastActive = time.Now()
+		s.tournamentRooms[roomID] = room
+	}
+	return nil
+}
+
+func (s *Store) DeleteInactiveTournamentRooms(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, room := range s.tournamentRooms {
+		if room.LastActive.Before(before) {
+			delete(s.tournamentRooms, id)
+			s.deleteRoomAccess(models.RoomTypeTournament, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) AllowRoomUser(roomType, roomID string, userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roomAccess[roomAccessKey{roomType: roomType, roomID: roomID, userID: userID}] = true
+	return nil
+}
+
+func (s *Store) IsRoomUserAllowed(roomType, roomID string, userID uint) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.roomAccess[roomAccessKey{roomType: roomType, roomID: roomID, userID: userID}], nil
+}
+
+// ============= API TOKENS =============
+
+func (s *Store) CreateAPIToken(token *models.APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[token.UserID]; !ok {
+		return errors.New("user does not exist")
+	}
+	if strings.TrimSpace(token.Name) == "" {
+		return invalid("token name cannot be empty")
+	}
+	for _, existing := range s.apiTokens {
+		if existing.TokenHash == token.TokenHash {
+			return errors.New("token already exists")
+		}
+	}
+
+	token.TokenID = s.nextID()
+	token.CreatedAt = time.Now()
+	s.apiTokens[token.TokenID] = *token
+	return nil
+}
+
+func (s *Store) GetAPITokenByHash(tokenHash string) (*models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.apiTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+	return nil, notFound("API token")
+}
+
+func (s *Store) GetAPITokensByUser(userID uint) ([]models.APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tokens []models.APIToken
+	for _, id := range sortedKeys(s.apiTokens) {
+		if token := s.apiTokens[id]; token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	slices.Reverse(tokens)
+	return tokens, nil
+}
+
+func (s *Store) RevokeAPIToken(userID, tokenID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.apiTokens[tokenID]
+	if !ok || token.UserID != userID || token.RevokedAt != nil {
+		return fmt.Errorf("failed to revoke API token: %w", database.ErrNotFound)
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	s.apiTokens[tokenID] = token
+	return nil
+}
+
+func (s *Store) TouchAPIToken(tokenID uint, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.apiTokens[tokenID]; ok {
+		token.LastUsedAt = &usedAt
+		s.apiTokens[tokenID] = token
+	}
+	return nil
+}
+
+// ============= AUDIT LOG =============
+
+func (s *Store) RecordAuditEvent(event *models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event == nil {
+		return errors.New("audit event cannot be nil")
+	}
+	if strings.TrimSpace(event.Action) == "" {
+		return invalid("audit action cannot be empty")
+	}
+	if strings.TrimSpace(event.EntityType) == "" {
+		return invalid("audit entity type cannot be empty")
+	}
+
+	event.EventID = s.nextID()
+	event.CreatedAt = time.Now()
+	s.auditEvents[event.EventID] = *event
+	return nil
+}
+
+func (s *Store) GetAuditEvent(eventID uint) (*models.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	event, ok := s.auditEvents[eventID]
+	if !ok {
+		return nil, notFound("audit event")
+	}
+	return &event, nil
+}
+
+func (s *Store) ListAuditEvents(filter database.AuditFilter, opts database.ListOptions) (*database.Page[models.AuditEvent], error) {
+	opts, cursor, err := database.PrepareList(opts, database.AuditListing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []models.AuditEvent
+	for _, event := range s.auditEvents {
+		switch {
+		case filter.ActorID != nil && (event.ActorID == nil || *event.ActorID != *filter.ActorID):
+		case filter.Action != "" && event.Action != filter.Action:
+		case filter.EntityType != "" && event.EntityType != filter.EntityType:
+		case filter.EntityID != "" && event.EntityID != filter.EntityID:
+		default:
+			events = append(events, event)
+		}
+	}
+	return paginate(events, opts, cursor, func(event models.AuditEvent) (any, uint) {
+		return event.CreatedAt, event.EventID
+	}), nil
+}
+
+// ============= TRASH =============
+
+func (s *Store) ListTrash(entityType string) ([]database.TrashedEntity, error) {
+	if entityType != "" && !slices.Contains(database.TrashTypes, entityType) {
+		return nil, invalid("%q cannot be in the trash", entityType)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	trashed := []database.TrashedEntity{}
+	for key, entity := range s.trash {
+		if entityType != "" && key.entityType != entityType {
+			continue
+		}
+		item := database.TrashedEntity{EntityType: key.entityType, EntityID: key.id}
+		switch entity := entity.(type) {
+		case models.Song:
+			item.Name, item.DeletedAt = entity.NameOriginal, entity.DeletedAt.Time
+		case models.Artist:
+			item.Name, item.DeletedAt = entity.NameOriginal, entity.DeletedAt.Time
+		case models.Unit:
+			item.Name, item.DeletedAt = entity.NameOriginal, entity.DeletedAt.Time
+		case models.Album:
+			item.Name, item.DeletedAt = entity.NameOriginal, entity.DeletedAt.Time
+		case models.Category:
+			item.Name, item.DeletedAt = entity.Name, entity.DeletedAt.Time
+		}
+		trashed = append(trashed, item)
+	}
+	sort.Slice(trashed, func(i, j int) bool {
+		if !trashed[i].DeletedAt.Equal(trashed[j].DeletedAt) {
+			return trashed[i].DeletedAt.After(trashed[j].DeletedAt)
+		}
+		return trashed[i].EntityID < trashed[j].EntityID
+	})
+	return trashed, nil
+}
+
+func (s *Store) RestoreFromTrash(entityType string, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := trashKey{entityType, id}
+	if _, ok := s.trash[key]; !ok {
+		return fmt.Errorf("failed to restore %s: %w", entityType, database.ErrNotFound)
+	}
+	return s.untrash(key)
+}
+
+// untrash takes an entity that is in the trash out of it. Callers must hold
+// s.mu.
+func (s *Store) untrash(key trashKey) error {
+	id := key.id
+	switch entity := s.trash[key].(type) {
+	case models.Song:
+		entity.DeletedAt = gorm.DeletedAt{}
+		s.songs[id] = entity
+	case models.Artist:
+		entity.DeletedAt = gorm.DeletedAt{}
+		s.artists[id] = entity
+	case models.Unit:
+		entity.DeletedAt = gorm.DeletedAt{}
+		s.units[id] = entity
+	case models.Album:
+		entity.DeletedAt = gorm.DeletedAt{}
+		s.albums[id] = entity
+	case models.Category:
+		if s.categoryNameTaken(entity.Name, 0) {
+			return invalid("another category has the same name")
+		}
+		entity.DeletedAt = gorm.DeletedAt{}
+		s.categories[id] = entity
+	}
+	delete(s.trash, key)
+	return nil
+}
+
+// purge deletes an entity in the trash for good. Callers must hold s.mu.
+func (s *Store) purge(key trashKey) {
+	delete(s.trash, key)
+	switch key.entityType {
+	case database.TrashSong:
+		s.songArtists.removeLeft(key.id)
+		s.songUnits.removeLeft(key.id)
+		s.albumSongs.removeRight(key.id)
+		for id, vote := range s.votes {
+			if vote.SongID == key.id {
+				delete(s.votes, id)
+			}
+		}
+	case database.TrashArtist:
+		s.artistUnits.removeLeft(key.id)
+		s.songArtists.removeRight(key.id)
+	case database.TrashUnit:
+		s.artistUnits.removeRight(key.id)
+		s.songUnits.removeRight(key.id)
+	case database.TrashAlbum:
+		s.albumSongs.removeLeft(key.id)
+	case database.TrashCategory:
+		// Like ON DELETE SET NULL, for live and trashed entities alike
+		drop := func(categoryID **uint) {
+			if *categoryID != nil && **categoryID == key.id {
+				*categoryID = nil
+			}
+		}
+		for id, song := range s.songs {
+			drop(&song.CategoryID)
+			s.songs[id] = song
+		}
+		for id, artist := range s.artists {
+			drop(&artist.CategoryID)
+			s.artists[id] = artist
+		}
+		for id, unit := range s.units {
+			drop(&unit.CategoryID)
+			s.units[id] = unit
+		}
+		for id, album := range s.albums {
+			drop(&album.CategoryID)
+			s.albums[id] = album
+		}
+		for trashed, entity := range s.trash {
+			switch entity := entity.(type) {
+			case models.Song:
+				drop(&entity.CategoryID)
+				s.trash[trashed] = entity
+			case models.Artist:
+				drop(&entity.CategoryID)
+				s.trash[trashed] = entity
+			case models.Unit:
+				drop(&entity.CategoryID)
+				s.trash[trashed] = entity
+			case models.Album:
+				drop(&entity.CategoryID)
+				s.trash[trashed] = entity
+			}
+		}
+	}
+}
+
+func (s *Store) PurgeFromTrash(entityType string, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := trashKey{entityType, id}
+	if _, ok := s.trash[key]; !ok {
+		return fmt.Errorf("failed to purge %s: %w", entityType, database.ErrNotFound)
+	}
+	s.purge(key)
+	return nil
+}
+
+func (s *Store) PurgeTrash(before time.Time) (int64, error) {
+	trashed, err := s.ListTrash("")
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for _, item := range trashed {
+		key := trashKey{item.EntityType, item.EntityID}
+		if _, ok := s.trash[key]; ok && item.DeletedAt.Before(before) {
+			s.purge(key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ============= MERGE =============
+
+func (s *Store) MergeEntities(req database.MergeRequest) (*database.MergeReport, error) {
+	req, err := database.PrepareMerge(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists := func(id uint) bool {
+		switch req.EntityType {
+		case database.TrashSong:
+			_, ok := s.songs[id]
+			return ok
+		case database.TrashArtist:
+			_, ok := s.artists[id]
+			return ok
+		case database.TrashUnit:
+			_, ok := s.units[id]
+			return ok
+		}
+		_, ok := s.albums[id]
+		return ok
+	}
+	for _, id := range append([]uint{req.SurvivorID}, req.DuplicateIDs...) {
+		if !exists(id) {
+			return nil, fmt.Errorf("failed to merge: some %ss do not exist: %w", req.EntityType, database.ErrNotFound)
+		}
+	}
+
+	var saved *Store
+	if req.DryRun {
+		saved = s.tables()
+		defer s.setTables(saved)
+	}
+
+	report := &database.MergeReport{
+		EntityType:   req.EntityType,
+		SurvivorID:   req.SurvivorID,
+		DuplicateIDs: req.DuplicateIDs,
+		VotePolicy:   req.VotePolicy,
+		DryRun:       req.DryRun,
+		Links:        make(map[string]int64),
+	}
+	duplicate := func(id uint) bool {
+		return slices.Contains(req.DuplicateIDs, id)
+	}
+	// moveLeft and moveRight repoint the side of a join table holding the
+	// merged entities
+	moveLeft := func(table string, l links) {
+		for pair := range l {
+			if duplicate(pair[0]) {
+				delete(l, pair)
+				moved := [2]uint{req.SurvivorID, pair[1]}
+				if _, ok := l[moved]; !ok {
+					l[moved] = struct{}{}
+					report.Links[table]++
+				}
+			}
+		}
+	}
+	moveRight := func(table string, l links) {
+		for pair := range l {
+			if duplicate(pair[1]) {
+				delete(l, pair)
+				moved := [2]uint{pair[0], req.SurvivorID}
+				if _, ok := l[moved]; !ok {
+					l[moved] = struct{}{}
+					report.Links[table]++
+				}
+			}
+		}
+	}
+
+	now := time.Now()
+	trashed := gorm.DeletedAt{Time: now, Valid: true}
+	switch req.EntityType {
+	case database.TrashSong:
+		moveLeft("song_artists", s.songArtists)
+		moveLeft("song_units", s.songUnits)
+		moveRight("album_songs", s.albumSongs)
+		s.mergeSongVotes(req, report)
+		for id, room := range s.ratingRooms {
+			recent, changed := database.MergeSongIDs(room.RecentSongIDs, req.DuplicateIDs, req.SurvivorID)
+			if room.CurrentSongID != nil && duplicate(*room.CurrentSongID) {
+				room.CurrentSongID = &req.SurvivorID
+				changed = true
+			}
+			if changed {
+				room.RecentSongIDs = recent
+				s.ratingRooms[id] = room
+				report.RoomsMoved++
+			}
+		}
+		for id, room := range s.radioRooms {
+			if room.CurrentSongID != nil && duplicate(*room.CurrentSongID) {
+				room.CurrentSongID = &req.SurvivorID
+				s.radioRooms[id] = room
+				report.RoomsMoved++
+			}
+		}
+		for id, room := range s.tournamentRooms {
+			tree := copyTreeState(room.TreeState)
+			if database.MergeTreeSongIDs(&tree, req.DuplicateIDs, req.SurvivorID) {
+				room.TreeState = tree
+				s.tournamentRooms[id] = room
+				report.RoomsMoved++
+			}
+		}
+		for _, id := range req.DuplicateIDs {
+			song := s.songs[id]
+			song.DeletedAt = trashed
+			s.trash[trashKey{database.TrashSong, id}] = song
+			delete(s.songs, id)
+		}
+	case database.TrashArtist:
+		moveRight("song_artists", s.songArtists)
+		moveLeft("artist_units", s.artistUnits)
+		for _, id := range req.DuplicateIDs {
+			artist := s.artists[id]
+			artist.DeletedAt = trashed
+			s.trash[trashKey{database.TrashArtist, id}] = artist
+			delete(s.artists, id)
+		}
+	case database.TrashUnit:
+		moveRight("song_units", s.songUnits)
+		moveRight("artist_units", s.artistUnits)
+		for _, id := range req.DuplicateIDs {
+			unit := s.units[id]
+			unit.DeletedAt = trashed
+			s.trash[trashKey{database.TrashUnit, id}] = unit
+			delete(s.units, id)
+		}
+	case database.TrashAlbum:
+		moveLeft("album_songs", s.albumSongs)
+		for _, id := range req.DuplicateIDs {
+			album := s.albums[id]
+			album.DeletedAt = trashed
+			s.trash[trashKey{database.TrashAlbum, id}] = album
+			delete(s.albums, id)
+		}
+	}
+	return report, nil
+}
+
+// mergeSongVotes moves the votes on merged songs to the survivor, keeping
+// one vote per user. Callers must hold s.mu.
+func (s *Store) mergeSongVotes(req database.MergeRequest, report *database.MergeReport) {
+	byUser := make(map[uint][]models.Vote)
+	for _, id := range sortedKeys(s.votes) {
+		vote := s.votes[id]
+		if vote.SongID == req.SurvivorID || slices.Contains(req.DuplicateIDs, vote.SongID) {
+			byUser[vote.UserID] = append(byUser[vote.UserID], vote)
+		}
+	}
+
+	for _, userID := range sortedKeys(byUser) {
+		votes := byUser[userID]
+		if len(votes) == 1 {
+			if vote := votes[0]; vote.SongID != req.SurvivorID {
+				vote.SongID = req.SurvivorID
+				s.votes[vote.VoteID] = vote
+				report.VotesMoved++
+			}
+			continue
+		}
+
+		merged := database.MergeVotes(votes, req.VotePolicy)
+		collision := database.VoteCollision{UserID: userID, Rating: merged.Rating}
+		for _, vote := range votes {
+			collision.Ratings = append(collision.Ratings, vote.Rating)
+			if vote.VoteID != merged.VoteID {
+				collision.Dropped = append(collision.Dropped, vote)
+			}
+			delete(s.votes, vote.VoteID)
+		}
+		report.Collisions = append(report.Collisions, collision)
+
+		if merged.SongID != req.SurvivorID {
+			report.VotesMoved++
+		}
+		merged.SongID = req.SurvivorID
+		merged.UpdatedAt = time.Now()
+		s.votes[merged.VoteID] = merged
+	}
+}
+
+// ============= ADMIN =============
+
+// setRights replaces the right-hand IDs linked to left
+func (l links) setRights(left uint, rights []uint) {
+	l.removeLeft(left)
+	for _, right := range rights {
+		l.add(left, right)
+	}
+}
+
+// setLefts replaces the left-hand IDs linked to right
+func (l links) setLefts(right uint, lefts []uint) {
+	l.removeRight(right)
+	for _, left := range lefts {
+		l.add(left, right)
+	}
+}
+
+// liveIDs keeps the IDs that are in m, leaving out those in the trash
+func liveIDs[V any](ids []uint, m map[uint]V) []uint {
+	var live []uint
+	for _, id := range ids {
+		if _, ok := m[id]; ok {
+			live = append(live, id)
+		}
+	}
+	return live
+}
+
+// exists reports whether an entity of a database.Trash type is stored, in
+// the trash or not. Callers must hold s.mu.
+func (s *Store) exists(entityType string, id uint) bool {
+	if _, ok := s.trash[trashKey{entityType, id}]; ok {
+		return true
+	}
+	var ok bool
+	switch entityType {
+	case database.TrashSong:
+		_, ok = s.songs[id]
+	case database.TrashArtist:
+		_, ok = s.artists[id]
+	case database.TrashUnit:
+		_, ok = s.units[id]
+	case database.TrashAlbum:
+		_, ok = s.albums[id]
+	case database.TrashCategory:
+		_, ok = s.categories[id]
+	}
+	return ok
+}
+
+// existingIDs keeps the IDs of stored entities, in the trash or not.
+// Callers must hold s.mu.
+func (s *Store) existingIDs(entityType string, ids []uint) []uint {
+	var existing []uint
+	for _, id := range ids {
+		if s.exists(entityType, id) {
+			existing = append(existing, id)
+		}
+	}
+	return existing
+}
+
+func (s *Store) CountCatalog() (*database.CatalogCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &database.CatalogCounts{
+		Categories: int64(len(s.categories)),
+		Units:      int64(len(s.units)),
+		Artists:    int64(len(s.artists)),
+		Albums:     int64(len(s.albums)),
+		Songs:      int64(len(s.songs)),
+	}, nil
+}
+
+func (s *Store) GetSongByProvider(provider, providerID string) (*models.Song, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range sortedKeys(s.songs) {
+		if song := s.songs[id]; song.Provider == provider && song.ProviderID == providerID {
+			return &song, nil
+		}
+	}
+	return nil, notFound("song by provider")
+}
+
+func (s *Store) SetSongLinks(songID uint, artistIDs, unitIDs, albumIDs []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.songs[songID]; !ok {
+		return notFound("song")
+	}
+	s.songArtists.setRights(songID, liveIDs(artistIDs, s.artists))
+	s.songUnits.setRights(songID, liveIDs(unitIDs, s.units))
+	s.albumSongs.setLefts(songID, liveIDs(albumIDs, s.albums))
+	return nil
+}
+
+func (s *Store) SetArtistUnits(artistID uint, unitIDs []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.artists[artistID]; !ok {
+		return notFound("artist")
+	}
+	s.artistUnits.setRights(artistID, liveIDs(unitIDs, s.units))
+	return nil
+}
+
+func (s *Store) SetUnitArtists(unitID uint, artistIDs []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.units[unitID]; !ok {
+		return notFound("unit")
+	}
+	s.artistUnits.setLefts(unitID, liveIDs(artistIDs, s.artists))
+	return nil
+}
+
+func (s *Store) GetSongSnapshot(songID uint, withVotes bool) (*database.SongSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.songSnapshot(songID, withVotes)
+}
+
+// songSnapshot is GetSongSnapshot for callers that hold s.mu
+func (s *Store) songSnapshot(songID uint, withVotes bool) (*database.SongSnapshot, error) {
+	song, ok := s.songs[songID]
+	if !ok {
+		return nil, notFound("song")
+	}
+	snapshot := &database.SongSnapshot{
+		Song:      song,
+		ArtistIDs: s.songArtists.rights(songID),
+		UnitIDs:   s.songUnits.rights(songID),
+		AlbumIDs:  s.albumSongs.lefts(songID),
+	}
+	if withVotes {
+		for _, id := range sortedKeys(s.votes) {
+			if vote := s.votes[id]; vote.SongID == songID {
+				snapshot.Votes = append(snapshot.Votes, vote)
+			}
+		}
+	}
+	return snapshot, nil
+}
+
+func (s *Store) GetArtistSnapshot(artistID uint) (*database.ArtistSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.artistSnapshot(artistID)
+}
+
+func (s *Store) artistSnapshot(artistID uint) (*database.ArtistSnapshot, error) {
+	artist, ok := s.artists[artistID]
+	if !ok {
+		return nil, notFound("artist")
+	}
+	return &database.ArtistSnapshot{
+		Artist:  artist,
+		UnitIDs: s.artistUnits.rights(artistID),
+		SongIDs: s.songArtists.lefts(artistID),
+	}, nil
+}
+
+func (s *Store) GetUnitSnapshot(unitID uint) (*database.UnitSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.unitSnapshot(unitID)
+}
+
+func (s *Store) unitSnapshot(unitID uint) (*database.UnitSnapshot, error) {
+	unit, ok := s.units[unitID]
+	if !ok {
+		return nil, notFound("unit")
+	}
+	return &database.UnitSnapshot{
+		Unit:      unit,
+		ArtistIDs: s.artistUnits.lefts(unitID),
+		SongIDs:   s.songUnits.lefts(unitID),
+	}, nil
+}
+
+func (s *Store) GetAlbumSnapshot(albumID uint) (*database.AlbumSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.albumSnapshot(albumID)
+}
+
+func (s *Store) albumSnapshot(albumID uint) (*database.AlbumSnapshot, error) {
+	album, ok := s.albums[albumID]
+	if !ok {
+		return nil, notFound("album")
+	}
+	return &database.AlbumSnapshot{
+		Album:   album,
+		SongIDs: s.albumSongs.rights(albumID),
+	}, nil
+}
+
+// snapshot loads the snapshot of an entity of a database.Trash type; songs
+// come without their votes. Callers must hold s.mu.
+func (s *Store) snapshot(entityType string, id uint) (any, error) {
+	switch entityType {
+	case database.TrashSong:
+		return s.songSnapshot(id, false)
+	case database.TrashArtist:
+		return s.artistSnapshot(id)
+	case database.TrashUnit:
+		return s.unitSnapshot(id)
+	case database.TrashAlbum:
+		return s.albumSnapshot(id)
+	}
+	category, ok := s.categories[id]
+	if !ok {
+		return nil, notFound("category")
+	}
+	return &category, nil
+}
+
+// existingCategory drops a category reference whose category is gone.
+// Callers must hold s.mu.
+func (s *Store) existingCategory(categoryID *uint) *uint {
+	if categoryID == nil || !s.exists(database.TrashCategory, *categoryID) {
+		return nil
+	}
+	return categoryID
+}
+
+func (s *Store) RestoreDeleted(entityType string, id uint, data json.RawMessage) (any, error) {
+	if !slices.Contains(database.TrashTypes, entityType) {
+		return nil, invalid("%q cannot be in the trash", entityType)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := trashKey{entityType, id}
+	if _, ok := s.trash[key]; ok {
+		if err := s.untrash(key); err != nil {
+			return nil, err
+		}
+		return s.snapshot(entityType, id)
+	}
+	if s.exists(entityType, id) {
+		return nil, invalid("%s %d exists again", entityType, id)
+	}
+
+	switch entityType {
+	case database.TrashCategory:
+		var category models.Category
+		if err := json.Unmarshal(data, &category); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if s.categoryNameTaken(category.Name, 0) {
+			return nil, invalid("another category has the same name")
+		}
+		category.CategoryID = id
+		category.DeletedAt = gorm.DeletedAt{}
+		s.categories[id] = category
+		return category, nil
+
+	case database.TrashUnit:
+		var snapshot database.UnitSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		snapshot.UnitID = id
+		snapshot.CategoryID = s.existingCategory(snapshot.CategoryID)
+		snapshot.DeletedAt = gorm.DeletedAt{}
+		s.storeUnit(&snapshot.Unit)
+		for _, artistID := range s.existingIDs(database.TrashArtist, snapshot.ArtistIDs) {
+			s.artistUnits.add(artistID, id)
+		}
+		for _, songID := range s.existingIDs(database.TrashSong, snapshot.SongIDs) {
+			s.songUnits.add(songID, id)
+		}
+		return snapshot, nil
+
+	case database.TrashArtist:
+		var snapshot database.ArtistSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		snapshot.ArtistID = id
+		snapshot.CategoryID = s.existingCategory(snapshot.CategoryID)
+		snapshot.DeletedAt = gorm.DeletedAt{}
+		s.storeArtist(&snapshot.Artist)
+		for _, unitID := range s.existingIDs(database.TrashUnit, snapshot.UnitIDs) {
+			s.artistUnits.add(id, unitID)
+		}
+		for _, songID := range s.existingIDs(database.TrashSong, snapshot.SongIDs) {
+			s.songArtists.add(songID, id)
+		}
+		return snapshot, nil
+
+	case database.TrashAlbum:
+		var snapshot database.AlbumSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		snapshot.AlbumID = id
+		snapshot.CategoryID = s.existingCategory(snapshot.CategoryID)
+		snapshot.DeletedAt = gorm.DeletedAt{}
+		s.storeAlbum(&snapshot.Album)
+		for _, songID := range s.existingIDs(database.TrashSong, snapshot.SongIDs) {
+			s.albumSongs.add(id, songID)
+		}
+		return snapshot, nil
+	}
+
+	var snapshot database.SongSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	snapshot.SongID = id
+	snapshot.CategoryID = s.existingCategory(snapshot.CategoryID)
+	snapshot.DeletedAt = gorm.DeletedAt{}
+	s.songs[id] = stripSong(snapshot.Song)
+	for _, artistID := range s.existingIDs(database.TrashArtist, snapshot.ArtistIDs) {
+		s.songArtists.add(id, artistID)
+	}
+	for _, unitID := range s.existingIDs(database.TrashUnit, snapshot.UnitIDs) {
+		s.songUnits.add(id, unitID)
+	}
+	for _, albumID := range s.existingIDs(database.TrashAlbum, snapshot.AlbumIDs) {
+		s.albumSongs.add(albumID, id)
+	}
+
+	// Votes of deleted users stay gone
+	votes := make([]models.Vote, 0, len(snapshot.Votes))
+	for _, vote := range snapshot.Votes {
+		if _, ok := s.users[vote.UserID]; !ok {
+			continue
+		}
+		vote.SongID = id
+		if _, taken := s.votes[vote.VoteID]; !taken {
+			s.votes[vote.VoteID] = vote
+		}
+		votes = append(votes, vote)
+	}
+	snapshot.Votes = votes
+	return snapshot, nil
+}
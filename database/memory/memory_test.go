@@ -0,0 +1,356 @@
+package memory_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+)
+
+func newSong(name string, artists ...models.Artist) *models.Song {
+	return &models.Song{
+		NameOriginal: name,
+		SourceURL:    "https://example.com/" + name + ".mp3",
+		ThumbnailURL: "https://example.com/" + name + ".jpg",
+		Artists:      artists,
+	}
+}
+
+func createUser(t *testing.T, store database.Store, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+func songIDs(songs []models.Song) []uint {
+	ids := make([]uint, len(songs))
+	for i, song := range songs {
+		ids[i] = song.SongID
+	}
+	return ids
+}
+
+func TestMissingRecordsAreNotFound(t *testing.T) {
+	store := memory.New()
+
+	tests := map[string]error{}
+	_, tests["GetSongByID"] = store.GetSongByID(1)
+	_, tests["GetArtistByID"] = store.GetArtistByID(1)
+	_, tests["GetUnitByID"] = store.GetUnitByID(1)
+	_, tests["GetAlbumByID"] = store.GetAlbumByID(1)
+	_, tests["GetCategoryByID"] = store.GetCategoryByID(1)
+	_, tests["GetUserByID"] = store.GetUserByID(1)
+	_, tests["GetUserByUsername"] = store.GetUserByUsername("nobody")
+	_, tests["GetVote"] = store.GetVote(1, 1)
+	_, tests["GetRatingRoom"] = store.GetRatingRoom("room")
+	for name, err := range tests {
+		if !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("%s = %v; want ErrNotFound", name, err)
+		}
+	}
+
+	// Like the Postgres store, changes of missing records fail without
+	// ErrNotFound
+	changes := map[string]error{
+		"UpdateSong": store.UpdateSong(&models.Song{SongID: 1, NameOriginal: "x", SourceURL: "x", ThumbnailURL: "x"}),
+		"DeleteSong": store.DeleteSong(1),
+		"DeleteUser": store.DeleteUser(1),
+		"DeleteVote": store.DeleteVote(1, 1),
+	}
+	for name, err := range changes {
+		if err == nil {
+			t.Errorf("%s of a missing record succeeded", name)
+		}
+	}
+}
+
+func TestInvalidInputIsRejected(t *testing.T) {
+	store := memory.New()
+	user := createUser(t, store, "alice")
+	song := newSong("song")
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	if err := store.CreateCategory(&models.Category{Name: "Aqours"}); err != nil {
+		t.Fatalf("CreateCategory: %v", err)
+	}
+	missingCategory := uint(999)
+
+	tests := map[string]error{
+		"song without name":        store.CreateSong(&models.Song{SourceURL: "x", ThumbnailURL: "x"}),
+		"song in missing category": store.CreateSong(&models.Song{NameOriginal: "x", SourceURL: "x", ThumbnailURL: "x", CategoryID: &missingCategory}),
+		"duplicate username":       store.CreateUser(&models.User{Username: "alice"}),
+		"unknown role":             store.CreateUser(&models.User{Username: "bob", Role: "owner"}),
+		"duplicate category":       store.CreateCategory(&models.Category{Name: "Aqours"}),
+		"rating out of range":      store.UpsertVote(&models.Vote{UserID: user.UserID, SongID: song.SongID, Rating: 11}),
+		"vote on missing song":     store.UpsertVote(&models.Vote{UserID: user.UserID, SongID: 999, Rating: 5}),
+	}
+	for name, err := range tests {
+		if !errors.Is(err, database.ErrValidation) {
+			t.Errorf("%s: error = %v; want ErrValidation", name, err)
+		}
+	}
+}
+
+func TestCreateSongStoresLinks(t *testing.T) {
+	store := memory.New()
+	artist := models.Artist{NameOriginal: "Chika"}
+	if err := store.CreateArtist(&artist); err != nil {
+		t.Fatalf("CreateArtist: %v", err)
+	}
+	song := newSong("Aozora", artist)
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	if err := store.CreateSong(newSong("other")); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+
+	got, err := store.GetSongByID(song.SongID)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	if len(got.Artists) != 1 || got.Artists[0].ArtistID != artist.ArtistID {
+		t.Errorf("song artists = %v; want [%d]", got.Artists, artist.ArtistID)
+	}
+	byArtist, err := store.GetSongsByArtist(artist.ArtistID)
+	if err != nil {
+		t.Fatalf("GetSongsByArtist: %v", err)
+	}
+	if ids := songIDs(byArtist); !slices.Equal(ids, []uint{song.SongID}) {
+		t.Errorf("songs by artist = %v; want [%d]", ids, song.SongID)
+	}
+}
+
+func TestReturnedRecordsAreCopies(t *testing.T) {
+	store := memory.New()
+	song := newSong("original")
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	song.NameOriginal = "changed by the caller"
+
+	got, err := store.GetSongByID(song.SongID)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	got.NameOriginal = "changed again"
+
+	again, err := store.GetSongByID(song.SongID)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	if again.NameOriginal != "original" {
+		t.Errorf("name = %q; want the stored %q", again.NameOriginal, "original")
+	}
+}
+
+func TestUpsertVoteUpdatesTheUsersVote(t *testing.T) {
+	store := memory.New()
+	alice := createUser(t, store, "alice")
+	bob := createUser(t, store, "bob")
+	song := newSong("song")
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+
+	votes := []models.Vote{
+		{UserID: alice.UserID, SongID: song.SongID, Rating: 2},
+		{UserID: alice.UserID, SongID: song.SongID, Rating: 8, Comment: "grew on me"},
+		{UserID: bob.UserID, SongID: song.SongID, Rating: 6},
+	}
+	for i := range votes {
+		if err := store.UpsertVote(&votes[i]); err != nil {
+			t.Fatalf("UpsertVote: %v", err)
+		}
+	}
+	if votes[0].VoteID != votes[1].VoteID {
+		t.Errorf("second vote got ID %d; want the first vote's %d", votes[1].VoteID, votes[0].VoteID)
+	}
+
+	vote, err := store.GetVote(alice.UserID, song.SongID)
+	if err != nil {
+		t.Fatalf("GetVote: %v", err)
+	}
+	if vote.Rating != 8 || vote.Comment != "grew on me" {
+		t.Errorf("vote = %d %q; want 8 %q", vote.Rating, vote.Comment, "grew on me")
+	}
+	if count, _ := store.GetVoteCountForSong(song.SongID); count != 2 {
+		t.Errorf("vote count = %d; want 2", count)
+	}
+	if average, _ := store.GetAverageRatingForSong(song.SongID); average != 7 {
+		t.Errorf("average = %v; want 7", average)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantKept bool
+	}{
+		{name: "commit", wantKept: true},
+		{name: "rollback", err: errors.New("abort")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			song := newSong("song")
+			err := store.Transaction(func(tx database.Store) error {
+				if err := tx.CreateSong(song); err != nil {
+					return err
+				}
+				// The transaction sees its own writes
+				if _, err := tx.GetSongByID(song.SongID); err != nil {
+					t.Errorf("GetSongByID in tx: %v", err)
+				}
+				return tt.err
+			})
+			if err != tt.err {
+				t.Fatalf("Transaction = %v; want %v", err, tt.err)
+			}
+
+			_, err = store.GetSongByID(song.SongID)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("song kept = %v; want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestTransactionRollbackKeepsIDsUnique(t *testing.T) {
+	store := memory.New()
+	rolledBack := newSong("rolled back")
+	store.Transaction(func(tx database.Store) error {
+		tx.CreateSong(rolledBack)
+		return errors.New("abort")
+	})
+
+	song := newSong("song")
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	if song.SongID == rolledBack.SongID {
+		t.Errorf("song reused ID %d of the rolled back song", song.SongID)
+	}
+}
+
+func TestTransactionIsIsolated(t *testing.T) {
+	store := memory.New()
+	created := make(chan struct{})
+	commit := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- store.Transaction(func(tx database.Store) error {
+			if err := tx.CreateSong(newSong("first")); err != nil {
+				return err
+			}
+			close(created)
+			<-commit
+			return tx.CreateSong(newSong("second"))
+		})
+	}()
+	<-created
+
+	// A reader waits for the transaction instead of seeing half of it
+	read := make(chan []models.Song)
+	go func() {
+		songs, _ := store.GetAllSongs()
+		read <- songs
+	}()
+	select {
+	case songs := <-read:
+		t.Fatalf("read %d songs while the transaction ran", len(songs))
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(commit)
+	if err := <-done; err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+	if songs := <-read; len(songs) != 2 {
+		t.Errorf("read %d songs after the commit; want 2", len(songs))
+	}
+}
+
+func TestClaimGuest(t *testing.T) {
+	store := memory.New()
+	account := createUser(t, store, "account")
+	member := createUser(t, store, "member")
+	guest := &models.User{Username: "guest-1", IsGuest: true}
+	if err := store.CreateUser(guest); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	both, guestOnly := newSong("both"), newSong("guest only")
+	for _, song := range []*models.Song{both, guestOnly} {
+		if err := store.CreateSong(song); err != nil {
+			t.Fatalf("CreateSong: %v", err)
+		}
+	}
+	// Guest and account both rated one song
+	for _, vote := range []models.Vote{
+		{UserID: guest.UserID, SongID: both.SongID, Rating: 2},
+		{UserID: guest.UserID, SongID: guestOnly.SongID, Rating: 9},
+		{UserID: account.UserID, SongID: both.SongID, Rating: 8},
+	} {
+		if err := store.UpsertVote(&vote); err != nil {
+			t.Fatalf("UpsertVote: %v", err)
+		}
+	}
+	if err := store.AllowRoomUser(models.RoomTypeRating, "room1", guest.UserID); err != nil {
+		t.Fatalf("AllowRoomUser: %v", err)
+	}
+
+	errorTests := []struct {
+		name    string
+		guestID uint
+		userID  uint
+		want    error
+	}{
+		{"missing guest", 999, account.UserID, database.ErrNotFound},
+		{"account that is not a guest", member.UserID, account.UserID, database.ErrValidation},
+		{"guest claiming itself", guest.UserID, guest.UserID, database.ErrValidation},
+		{"missing account", guest.UserID, 999, database.ErrValidation},
+	}
+	for _, tt := range errorTests {
+		if _, err := store.ClaimGuest(tt.guestID, tt.userID); !errors.Is(err, tt.want) {
+			t.Errorf("%s: ClaimGuest = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+
+	moved, err := store.ClaimGuest(guest.UserID, account.UserID)
+	if err != nil {
+		t.Fatalf("ClaimGuest: %v", err)
+	}
+	if moved != 1 {
+		t.Errorf("moved %d votes; want 1", moved)
+	}
+
+	// The account keeps its own rating of the song both rated
+	wantRatings := map[uint]int{both.SongID: 8, guestOnly.SongID: 9}
+	for songID, want := range wantRatings {
+		vote, err := store.GetVote(account.UserID, songID)
+		if err != nil {
+			t.Fatalf("GetVote %d: %v", songID, err)
+		}
+		if vote.Rating != want {
+			t.Errorf("rating of song %d = %d; want %d", songID, vote.Rating, want)
+		}
+	}
+	if count, _ := store.GetVoteCountForSong(both.SongID); count != 1 {
+		t.Errorf("song both rated has %d votes; want the guest's dropped", count)
+	}
+	if _, err := store.GetUserByID(guest.UserID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetUserByID of the claimed guest = %v; want ErrNotFound", err)
+	}
+	if allowed, _ := store.IsRoomUserAllowed(models.RoomTypeRating, "room1", account.UserID); !allowed {
+		t.Error("the guest's room access did not move to the account")
+	}
+}
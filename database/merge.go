@@ -0,0 +1,375 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============= MERGE =============
+
+// Vote policies for a user who rated more than one of the songs merged
+const (
+	VotePolicyNewest  = "newest"  // Keep the most recently changed vote
+	VotePolicyHighest = "highest" // Keep the highest rating
+	VotePolicyAverage = "average" // Rate the rounded mean of the ratings
+)
+
+// VotePolicies lists every vote policy; the first is the default
+var VotePolicies = []string{VotePolicyNewest, VotePolicyHighest, VotePolicyAverage}
+
+// MergeRequest asks to fold duplicate artists, units, albums or songs into a
+// survivor. EntityType is one of TrashArtist, TrashUnit, TrashAlbum or
+// TrashSong.
+type MergeRequest struct {
+	EntityType   string
+	SurvivorID   uint
+	DuplicateIDs []uint
+	VotePolicy   string // Songs only; empty for VotePolicyNewest
+	DryRun       bool   // Build the report and roll everything back
+}
+
+// VoteCollision is a user who rated more than one of the songs merged
+type VoteCollision struct {
+	UserID  uint          `json:"user_id"`
+	Ratings []int         `json:"ratings"` // Oldest vote first
+	Rating  int           `json:"rating"`  // Rating of the merged vote
+	Dropped []models.Vote `json:"dropped"` // Votes deleted in favour of the merged one
+}
+
+// MergeReport is what a merge did, or would do in a dry run
+type MergeReport struct {
+	EntityType   string           `json:"entity_type"`
+	SurvivorID   uint             `json:"survivor_id"`
+	DuplicateIDs []uint           `json:"duplicate_ids"`
+	VotePolicy   string           `json:"vote_policy,omitempty"`
+	DryRun       bool             `json:"dry_run"`
+	Links        map[string]int64 `json:"links"` // Join table rows moved to the survivor, by table
+	VotesMoved   int64            `json:"votes_moved"`
+	Collisions   []VoteCollision  `json:"collisions,omitempty"`
+	RoomsMoved   int64            `json:"rooms_moved"` // Rating, radio and tournament rooms whose songs now point at the survivor
+}
+
+// DroppedVotes lists every vote the merge deleted
+func (r *MergeReport) DroppedVotes() []models.Vote {
+	var dropped []models.Vote
+	for _, collision := range r.Collisions {
+		dropped = append(dropped, collision.Dropped...)
+	}
+	return dropped
+}
+
+// MergeSongIDs points the songs merged in a list of song IDs, such as a
+// rating room's RecentSongIDs, at the survivor. It reports whether any of
+// them was in the list.
+func MergeSongIDs(songIDs []uint, duplicateIDs []uint, survivorID uint) ([]uint, bool) {
+	merged := make([]uint, len(songIDs))
+	changed := false
+	for i, id := range songIDs {
+		if slices.Contains(duplicateIDs, id) {
+			id = survivorID
+			changed = true
+		}
+		merged[i] = id
+	}
+	return merged, changed
+}
+
+// MergeTreeSongIDs points the songs, winners and picks of a tournament
+// bracket that are merged at the survivor. It reports whether the bracket
+// had any of them.
+func MergeTreeSongIDs(tree *models.TreeState, duplicateIDs []uint, survivorID uint) bool {
+	changed := false
+	merge := func(songID **uint) {
+		if *songID != nil && slices.Contains(duplicateIDs, **songID) {
+			survivor := survivorID
+			*songID = &survivor
+			changed = true
+		}
+	}
+	for _, round := range tree.Rounds {
+		for _, match := range round.Matches {
+			for _, song := range []*models.MatchSong{match.Song1, match.Song2, match.Winner} {
+				if song != nil {
+					merge(&song.SongID)
+				}
+			}
+			for i := range match.UserPicks {
+				merge(&match.UserPicks[i].PickedSongID)
+			}
+		}
+	}
+	return changed
+}
+
+// mergeLinks are the join tables a merge moves, by entity type: the column
+// pointing at the entity and the column of the other side
+var mergeLinks = map[string][][3]string{
+	TrashSong:   {{"song_artists", "song_id", "artist_id"}, {"song_units", "song_id", "unit_id"}, {"album_songs", "song_id", "album_id"}},
+	TrashArtist: {{"song_artists", "artist_id", "song_id"}, {"artist_units", "artist_id", "unit_id"}},
+	TrashUnit:   {{"song_units", "unit_id", "song_id"}, {"artist_units", "unit_id", "artist_id"}},
+	TrashAlbum:  {{"album_songs", "album_id", "song_id"}},
+}
+
+// errMergeDryRun ends the transaction of a merge preview
+var errMergeDryRun = errors.New("merge preview rolled back")
+
+// PrepareMerge checks a merge request and fills in its defaults
+func PrepareMerge(req MergeRequest) (MergeRequest, error) {
+	if _, ok := mergeLinks[req.EntityType]; !ok {
+		return req, fmt.Errorf("%w: %q cannot be merged", ErrValidation, req.EntityType)
+	}
+	if req.SurvivorID == 0 {
+		return req, fmt.Errorf("%w: pick the %s to keep", ErrValidation, req.EntityType)
+	}
+
+	duplicates := make([]uint, 0, len(req.DuplicateIDs))
+	for _, id := range req.DuplicateIDs {
+		if id == req.SurvivorID {
+			return req, fmt.Errorf("%w: the %s to keep cannot also be a duplicate", ErrValidation, req.EntityType)
+		}
+		if id != 0 && !slices.Contains(duplicates, id) {
+			duplicates = append(duplicates, id)
+		}
+	}
+	if len(duplicates) == 0 {
+		return req, fmt.Errorf("%w: pick at least one duplicate %s", ErrValidation, req.EntityType)
+	}
+	slices.Sort(duplicates)
+	req.DuplicateIDs = duplicates
+
+	if req.EntityType != TrashSong {
+		req.VotePolicy = ""
+	} else if req.VotePolicy == "" {
+		req.VotePolicy = VotePolicies[0]
+	} else if !slices.Contains(VotePolicies, req.VotePolicy) {
+		return req, fmt.Errorf("%w: unknown vote policy %q", ErrValidation, req.VotePolicy)
+	}
+	return req, nil
+}
+
+// MergeVotes resolves the votes of one user on the songs merged. It sorts
+// votes oldest first and returns the vote to keep with its merged rating.
+func MergeVotes(votes []models.Vote, policy string) models.Vote {
+	sort.SliceStable(votes, func(i, j int) bool {
+		if !votes[i].UpdatedAt.Equal(votes[j].UpdatedAt) {
+			return votes[i].UpdatedAt.Before(votes[j].UpdatedAt)
+		}
+		return votes[i].VoteID < votes[j].VoteID
+	})
+
+	kept := votes[0]
+	for _, vote := range votes[1:] {
+		newer := !vote.UpdatedAt.Before(kept.UpdatedAt)
+		switch policy {
+		case VotePolicyHighest:
+			if vote.Rating > kept.Rating || (vote.Rating == kept.Rating && newer) {
+				kept = vote
+			}
+		default:
+			if newer {
+				kept = vote
+			}
+		}
+	}
+
+	if policy == VotePolicyAverage {
+		total := 0
+		for _, vote := range votes {
+			total += vote.Rating
+		}
+		kept.Rating = int(math.Round(float64(total) / float64(len(votes))))
+	}
+	return kept
+}
+
+// MergeEntities folds the duplicates into the survivor in one transaction:
+// their links move to the survivor, and for songs their votes and the rooms
+// playing or having played them too. The duplicates then go to the trash.
+func (db *Database) MergeEntities(req MergeRequest) (*MergeReport, error) {
+	req, err := PrepareMerge(req)
+	if err != nil {
+		return nil, err
+	}
+	report := &MergeReport{
+		EntityType:   req.EntityType,
+		SurvivorID:   req.SurvivorID,
+		DuplicateIDs: req.DuplicateIDs,
+		VotePolicy:   req.VotePolicy,
+		DryRun:       req.DryRun,
+		Links:        make(map[string]int64),
+	}
+	spec := trashTables[req.EntityType]
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var found int64
+		ids := append([]uint{req.SurvivorID}, req.DuplicateIDs...)
+		if err := tx.Model(spec.model).Where(spec.idColumn+" IN ?", ids).Count(&found).Error; err != nil {
+			return fmt.Errorf("failed to check %s: %w", spec.table, err)
+		}
+		if found != int64(len(ids)) {
+			return fmt.Errorf("failed to merge: some %s do not exist: %w", spec.table, ErrNotFound)
+		}
+
+		for _, link := range mergeLinks[req.EntityType] {
+			table, column, other := link[0], link[1], link[2]
+			result := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s, %s) SELECT DISTINCT ?, %s FROM %s WHERE %s IN ? ON CONFLICT DO NOTHING",
+				table, column, other, other, table, column), req.SurvivorID, req.DuplicateIDs)
+			if result.Error != nil {
+				return fmt.Errorf("failed to merge %s: %w", table, result.Error)
+			}
+			report.Links[table] = result.RowsAffected
+			if err := tx.Exec("DELETE FROM "+table+" WHERE "+column+" IN ?", req.DuplicateIDs).Error; err != nil {
+				return fmt.Errorf("failed to merge %s: %w", table, err)
+			}
+		}
+
+		if req.EntityType == TrashSong {
+			if err := mergeSongVotes(tx, req, report); err != nil {
+				return err
+			}
+			if err := mergeSongRooms(tx, req, report); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where(spec.idColumn+" IN ?", req.DuplicateIDs).Delete(spec.model).Error; err != nil {
+			return fmt.Errorf("failed to trash merged %s: %w", spec.table, err)
+		}
+
+		if req.DryRun {
+			return errMergeDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMergeDryRun) {
+		return nil, err
+	}
+	return report, nil
+}
+
+// mergeSongVotes moves the votes on the duplicates to the survivor. A user
+// who rated more than one of the songs keeps one vote, chosen by the policy.
+func mergeSongVotes(tx *gorm.DB, req MergeRequest, report *MergeReport) error {
+	var votes []models.Vote
+	songIDs := append([]uint{req.SurvivorID}, req.DuplicateIDs...)
+	if err := tx.Where("song_id IN ?", songIDs).Order("vote_id").Find(&votes).Error; err != nil {
+		return fmt.Errorf("failed to load votes: %w", err)
+	}
+
+	byUser := make(map[uint][]models.Vote)
+	var userIDs []uint
+	for _, vote := range votes {
+		if _, ok := byUser[vote.UserID]; !ok {
+			userIDs = append(userIDs, vote.UserID)
+		}
+		byUser[vote.UserID] = append(byUser[vote.UserID], vote)
+	}
+
+	for _, userID := range userIDs {
+		userVotes := byUser[userID]
+		if len(userVotes) == 1 {
+			if userVotes[0].SongID == req.SurvivorID {
+				continue
+			}
+			if err := tx.Model(&models.Vote{}).Where("vote_id = ?", userVotes[0].VoteID).
+				Update("song_id", req.SurvivorID).Error; err != nil {
+				return fmt.Errorf("failed to move vote: %w", err)
+			}
+			report.VotesMoved++
+			continue
+		}
+
+		merged := MergeVotes(userVotes, req.VotePolicy)
+		collision := VoteCollision{UserID: userID, Rating: merged.Rating}
+		var dropped []uint
+		for _, vote := range userVotes {
+			collision.Ratings = append(collision.Ratings, vote.Rating)
+			if vote.VoteID != merged.VoteID {
+				dropped = append(dropped, vote.VoteID)
+				collision.Dropped = append(collision.Dropped, vote)
+			}
+		}
+		report.Collisions = append(report.Collisions, collision)
+
+		// Free the survivor's slot in idx_user_song before moving the kept vote
+		if err := tx.Where("vote_id IN ?", dropped).Delete(&models.Vote{}).Error; err != nil {
+			return fmt.Errorf("failed to drop merged votes: %w", err)
+		}
+		if err := tx.Model(&models.Vote{}).Where("vote_id = ?", merged.VoteID).Updates(map[string]any{
+			"song_id":    req.SurvivorID,
+			"rating":     merged.Rating,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to merge votes: %w", err)
+		}
+		if merged.SongID != req.SurvivorID {
+			report.VotesMoved++
+		}
+	}
+	return nil
+}
+
+// mergeSongRooms moves the rating and radio rooms playing the duplicates on
+// to the survivor, and points the rating rooms' recent songs at it so song
+// selectors do not play it again too soon. Tournament brackets have their
+// songs, winners and picks pointed at the survivor as well.
+func mergeSongRooms(tx *gorm.DB, req MergeRequest, report *MergeReport) error {
+	var rooms []models.RatingRoom
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("room_id", "current_song_id", "recent_song_ids").
+		Where("current_song_id IN ? OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(recent_song_ids) AS recent(song_id) WHERE recent.song_id::bigint IN ?)",
+			req.DuplicateIDs, req.DuplicateIDs).
+		Find(&rooms).Error; err != nil {
+		return fmt.Errorf("failed to load rating rooms: %w", err)
+	}
+	for _, room := range rooms {
+		updates := map[string]interface{}{}
+		if room.CurrentSongID != nil && slices.Contains(req.DuplicateIDs, *room.CurrentSongID) {
+			updates["current_song_id"] = req.SurvivorID
+		}
+		if recent, changed := MergeSongIDs(room.RecentSongIDs, req.DuplicateIDs, req.SurvivorID); changed {
+			recentJSON, err := json.Marshal(recent)
+			if err != nil {
+				return fmt.Errorf("failed to merge rating room songs: %w", err)
+			}
+			updates["recent_song_ids"] = string(recentJSON)
+		}
+		if err := tx.Model(&models.RatingRoom{}).Where("room_id = ?", room.RoomID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to merge rating room songs: %w", err)
+		}
+	}
+
+	result := tx.Model(&models.RadioRoom{}).Where("current_song_id IN ?", req.DuplicateIDs).
+		Update("current_song_id", req.SurvivorID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to merge radio rooms: %w", result.Error)
+	}
+	report.RoomsMoved = int64(len(rooms)) + result.RowsAffected
+
+	var tournaments []models.TournamentRoom
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("room_id", "tree_state").
+		Find(&tournaments).Error; err != nil {
+		return fmt.Errorf("failed to load tournament rooms: %w", err)
+	}
+	for _, room := range tournaments {
+		if !MergeTreeSongIDs(&room.TreeState, req.DuplicateIDs, req.SurvivorID) {
+			continue
+		}
+		if err := tx.Model(&models.TournamentRoom{}).Where("room_id = ?", room.RoomID).
+			Update("tree_state", room.TreeState).Error; err != nil {
+			return fmt.Errorf("failed to merge tournament brackets: %w", err)
+		}
+		report.RoomsMoved++
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package database_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+)
+
+func TestMergeVotes(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Given out of order: vote 1 is the oldest, 3 ties with 2 and wins on ID
+	votes := func() []models.Vote {
+		return []models.Vote{
+			{VoteID: 2, Rating: 4, UpdatedAt: base.Add(2 * time.Hour)},
+			{VoteID: 1, Rating: 9, UpdatedAt: base.Add(time.Hour)},
+			{VoteID: 3, Rating: 4, UpdatedAt: base.Add(2 * time.Hour)},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		votes      []models.Vote
+		policy     string
+		wantVoteID uint
+		wantRating int
+	}{
+		{"newest", votes(), database.VotePolicyNewest, 3, 4},
+		{"highest however old", votes(), database.VotePolicyHighest, 1, 9},
+		{"average on the newest vote", votes(), database.VotePolicyAverage, 3, 6},
+		{"average rounds half up", []models.Vote{{VoteID: 1, Rating: 7}, {VoteID: 2, Rating: 8}}, database.VotePolicyAverage, 2, 8},
+		{"highest tie goes to the newer", []models.Vote{
+			{VoteID: 1, Rating: 8, UpdatedAt: base.Add(time.Hour)},
+			{VoteID: 2, Rating: 8, UpdatedAt: base},
+		}, database.VotePolicyHighest, 1, 8},
+		{"single vote", []models.Vote{{VoteID: 5, Rating: 3}}, database.VotePolicyAverage, 5, 3},
+	}
+	for _, tt := range tests {
+		got := database.MergeVotes(tt.votes, tt.policy)
+		if got.VoteID != tt.wantVoteID || got.Rating != tt.wantRating {
+			t.Errorf("%s: kept vote %d rated %d; want vote %d rated %d", tt.name, got.VoteID, got.Rating, tt.wantVoteID, tt.wantRating)
+		}
+	}
+}
+
+func TestPrepareMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            database.MergeRequest
+		wantDuplicates []uint
+		wantPolicy     string
+		wantErr        bool
+	}{
+		{"song defaults", database.MergeRequest{EntityType: database.TrashSong, SurvivorID: 1, DuplicateIDs: []uint{3, 2, 3, 0}}, []uint{2, 3}, database.VotePolicyNewest, false},
+		{"artists have no vote policy", database.MergeRequest{EntityType: database.TrashArtist, SurvivorID: 1, DuplicateIDs: []uint{2}, VotePolicy: "highest"}, []uint{2}, "", false},
+		{"categories", database.MergeRequest{EntityType: database.TrashCategory, SurvivorID: 1, DuplicateIDs: []uint{2}}, nil, "", true},
+		{"no survivor", database.MergeRequest{EntityType: database.TrashSong, DuplicateIDs: []uint{2}}, nil, "", true},
+		{"no duplicates", database.MergeRequest{EntityType: database.TrashSong, SurvivorID: 1, DuplicateIDs: []uint{0}}, nil, "", true},
+		{"survivor is a duplicate", database.MergeRequest{EntityType: database.TrashSong, SurvivorID: 1, DuplicateIDs: []uint{1, 2}}, nil, "", true},
+		{"unknown policy", database.MergeRequest{EntityType: database.TrashSong, SurvivorID: 1, DuplicateIDs: []uint{2}, VotePolicy: "lowest"}, nil, "", true},
+	}
+	for _, tt := range tests {
+		got, err := database.PrepareMerge(tt.req)
+		if tt.wantErr {
+			if !errors.Is(err, database.ErrValidation) {
+				t.Errorf("%s: err = %v; want a validation error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got.DuplicateIDs, tt.wantDuplicates) || got.VotePolicy != tt.wantPolicy {
+			t.Errorf("%s: got %+v, %v; want duplicates %v, policy %q", tt.name, got, err, tt.wantDuplicates, tt.wantPolicy)
+		}
+	}
+}
+
+func TestMergeSongIDs(t *testing.T) {
+	merged, changed := database.MergeSongIDs([]uint{4, 2, 1, 3}, []uint{2, 3}, 1)
+	if !changed || !slices.Equal(merged, []uint{4, 1, 1, 1}) {
+		t.Errorf("got %v, %v; want [4 1 1 1], true", merged, changed)
+	}
+	if _, changed := database.MergeSongIDs([]uint{4, 5}, []uint{2}, 1); changed {
+		t.Error("a list without merged songs changed")
+	}
+}
+
+func TestMergeTreeSongIDs(t *testing.T) {
+	id := func(id uint) *uint { return &id }
+	from := "r1m1"
+	tree := models.TreeState{Rounds: []models.Round{
+		{RoundNumber: 1, Matches: []models.Match{{
+			Song1:     &models.MatchSong{SongID: id(2)},
+			Song2:     &models.MatchSong{SongID: id(4)},
+			Winner:    &models.MatchSong{SongID: id(2)},
+			UserPicks: []models.UserPick{{PickedSongID: id(2)}, {PickedSongID: id(4)}},
+		}}},
+		{RoundNumber: 2, Matches: []models.Match{{
+			Song1: &models.MatchSong{SongID: id(3)},
+			Song2: &models.MatchSong{FromMatchID: &from},
+		}}},
+	}}
+	if !database.MergeTreeSongIDs(&tree, []uint{2, 3}, 1) {
+		t.Fatal("bracket with merged songs did not change")
+	}
+	first, second := tree.Rounds[0].Matches[0], tree.Rounds[1].Matches[0]
+	got := []uint{*first.Song1.SongID, *first.Song2.SongID, *first.Winner.SongID,
+		*first.UserPicks[0].PickedSongID, *first.UserPicks[1].PickedSongID, *second.Song1.SongID}
+	if want := []uint{1, 4, 1, 1, 4, 1}; !slices.Equal(got, want) {
+		t.Errorf("bracket songs = %v; want %v", got, want)
+	}
+	if second.Song2.SongID != nil || second.Winner != nil {
+		t.Error("open slots of the bracket were filled")
+	}
+	if database.MergeTreeSongIDs(&tree, []uint{2, 3}, 1) {
+		t.Error("bracket without merged songs changed")
+	}
+}
@@ -0,0 +1,276 @@
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// fileNamePattern matches migration files such as 0002_add_song_provider.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single numbered schema step with its forward and rollback SQL
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration is a row in the schema_migrations table
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255;not null"`
+	AppliedAt time.Time
+}
+
+// MigrationStatus describes whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back the embedded migrations
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New creates a migrator for the given database using the embedded SQL files
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := load(sqlFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load reads all migration files and pairs up/down steps by version
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := fileNamePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+		content, err := fs.ReadFile(fsys, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) must have both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential starting at 1, found %d at position %d", migration.Version, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// ensureTable creates the schema_migrations bookkeeping table if needed
+func (m *Migrator) ensureTable() error {
+	err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`).Error
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// applied returns the applied migrations keyed by version
+func (m *Migrator) applied() (map[int]SchemaMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var rows []SchemaMigration
+	if err := m.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	result := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+// Latest returns the highest migration version embedded in the binary
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Current returns the schema version the database is on (0 if none applied)
+func (m *Migrator) Current() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	current := 0
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	for version, row := range applied {
+		if version > m.Latest() {
+			appliedAt := row.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: version, Name: row.Name + " (unknown to this binary)", Applied: true, AppliedAt: &appliedAt})
+		}
+	}
+	return statuses, nil
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up() error {
+	return m.To(m.Latest())
+}
+
+// Down rolls back the most recently applied migration
+func (m *Migrator) Down() error {
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return errors.New("no migrations to roll back")
+	}
+	return m.To(current - 1)
+}
+
+// To migrates the schema up or down until it is at the given version
+func (m *Migrator) To(target int) error {
+	if target < 0 || target > m.Latest() {
+		return fmt.Errorf("target version %d is out of range (0-%d)", target, m.Latest())
+	}
+
+	current, err := m.Current()
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("database is at version %d, which is newer than this binary (%d)", current, m.Latest())
+	}
+
+	for current < target {
+		migration := m.migrations[current]
+		if err := m.apply(migration, true); err != nil {
+			return err
+		}
+		current = migration.Version
+	}
+
+	for current > target {
+		migration := m.migrations[current-1]
+		if err := m.apply(migration, false); err != nil {
+			return err
+		}
+		current = migration.Version - 1
+	}
+
+	return nil
+}
+
+// apply runs a single migration step and records it in one transaction
+func (m *Migrator) apply(migration Migration, up bool) error {
+	direction, script := "down", migration.Down
+	if up {
+		direction, script = "up", migration.Up
+	}
+
+	fmt.Printf("Applying migration %04d_%s (%s)...\n", migration.Version, migration.Name, direction)
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(script).Error; err != nil {
+			return err
+		}
+		if up {
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		}
+		return tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s (%s) failed: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	fmt.Printf("✓ Migration %04d_%s (%s) applied successfully\n", migration.Version, migration.Name, direction)
+	return nil
+}
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS artist_units;
+DROP TABLE IF EXISTS album_songs;
+DROP TABLE IF EXISTS song_units;
+DROP TABLE IF EXISTS song_artists;
+DROP TABLE IF EXISTS tournament_rooms;
+DROP TABLE IF EXISTS radio_rooms;
+DROP TABLE IF EXISTS rating_rooms;
+DROP TABLE IF EXISTS votes;
+DROP TABLE IF EXISTS songs;
+DROP TABLE IF EXISTS albums;
+DROP TABLE IF EXISTS artists;
+DROP TABLE IF EXISTS units;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS categories;
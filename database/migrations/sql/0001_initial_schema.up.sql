@@ -0,0 +1,188 @@
+-- Baseline schema. Matches the tables previously created by GORM's
+-- AutoMigrate, so existing deployments can adopt versioned migrations
+-- without losing data: every statement is a no-op if the object exists.
+
+CREATE TABLE IF NOT EXISTS categories (
+    category_id BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name);
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id       BIGSERIAL PRIMARY KEY,
+    username      VARCHAR(50) NOT NULL,
+    password_hash TEXT,
+    email         TEXT,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+
+CREATE TABLE IF NOT EXISTS units (
+    unit_id         BIGSERIAL PRIMARY KEY,
+    name_original   VARCHAR(255) NOT NULL,
+    name_english    VARCHAR(255),
+    primary_color   VARCHAR(7),
+    secondary_color VARCHAR(7),
+    category_id     BIGINT,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    CONSTRAINT fk_units_category FOREIGN KEY (category_id)
+        REFERENCES categories (category_id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS artists (
+    artist_id       BIGSERIAL PRIMARY KEY,
+    name_original   VARCHAR(255) NOT NULL,
+    name_english    VARCHAR(255),
+    primary_color   VARCHAR(7),
+    secondary_color VARCHAR(7),
+    category_id     BIGINT,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    CONSTRAINT fk_artists_category FOREIGN KEY (category_id)
+        REFERENCES categories (category_id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS albums (
+    album_id      BIGSERIAL PRIMARY KEY,
+    name_original VARCHAR(255) NOT NULL,
+    name_english  VARCHAR(255),
+    album_art_url TEXT,
+    type          VARCHAR(20),
+    category_id   BIGINT,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    CONSTRAINT chk_albums_type CHECK (type IN ('Album', 'Single', 'EP')),
+    CONSTRAINT fk_albums_category FOREIGN KEY (category_id)
+        REFERENCES categories (category_id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS songs (
+    song_id       BIGSERIAL PRIMARY KEY,
+    name_original VARCHAR(255) NOT NULL,
+    name_english  VARCHAR(255),
+    source_url    TEXT NOT NULL,
+    thumbnail_url TEXT NOT NULL,
+    category_id   BIGINT,
+    is_cover      BOOLEAN,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ,
+    CONSTRAINT fk_songs_category FOREIGN KEY (category_id)
+        REFERENCES categories (category_id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS votes (
+    vote_id    BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT,
+    song_id    BIGINT,
+    rating     BIGINT,
+    comment    TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    CONSTRAINT chk_votes_rating CHECK (rating >= 1 AND rating <= 10),
+    CONSTRAINT fk_songs_votes FOREIGN KEY (song_id) REFERENCES songs (song_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_song ON votes (user_id, song_id);
+
+CREATE TABLE IF NOT EXISTS rating_rooms (
+    room_id            VARCHAR(8) PRIMARY KEY,
+    creator_id         BIGINT NOT NULL,
+    current_song_id    BIGINT,
+    category_id        BIGINT,
+    covers_only        BOOLEAN DEFAULT false,
+    video_sync_enabled BOOLEAN DEFAULT true,
+    unvoted_songs_only BOOLEAN DEFAULT true,
+    created_at         TIMESTAMPTZ,
+    last_active        TIMESTAMPTZ,
+    CONSTRAINT fk_rating_rooms_creator FOREIGN KEY (creator_id) REFERENCES users (user_id),
+    CONSTRAINT fk_rating_rooms_current_song FOREIGN KEY (current_song_id)
+        REFERENCES songs (song_id) ON DELETE SET NULL,
+    CONSTRAINT fk_rating_rooms_category FOREIGN KEY (category_id)
+        REFERENCES categories (category_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_rating_rooms_current_song_id ON rating_rooms (current_song_id);
+CREATE INDEX IF NOT EXISTS idx_rating_rooms_category_id ON rating_rooms (category_id);
+CREATE INDEX IF NOT EXISTS idx_rating_rooms_last_active ON rating_rooms (last_active);
+
+CREATE TABLE IF NOT EXISTS radio_rooms (
+    room_id         VARCHAR(8) PRIMARY KEY,
+    creator_id      BIGINT NOT NULL,
+    current_song_id BIGINT,
+    category_id     BIGINT,
+    include_covers  BOOLEAN DEFAULT false,
+    min_rating      BIGINT DEFAULT null,
+    created_at      TIMESTAMPTZ,
+    last_active     TIMESTAMPTZ,
+    CONSTRAINT fk_radio_rooms_creator FOREIGN KEY (creator_id) REFERENCES users (user_id),
+    CONSTRAINT fk_radio_rooms_current_song FOREIGN KEY (current_song_id)
+        REFERENCES songs (song_id) ON DELETE SET NULL,
+    CONSTRAINT fk_radio_rooms_category FOREIGN KEY (category_id)
+        REFERENCES categories (category_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_radio_rooms_current_song_id ON radio_rooms (current_song_id);
+CREATE INDEX IF NOT EXISTS idx_radio_rooms_category_id ON radio_rooms (category_id);
+CREATE INDEX IF NOT EXISTS idx_radio_rooms_last_active ON radio_rooms (last_active);
+
+CREATE TABLE IF NOT EXISTS tournament_rooms (
+    room_id            VARCHAR(8) PRIMARY KEY,
+    creator_id         BIGINT NOT NULL,
+    tree_size          BIGINT NOT NULL,
+    category_id        BIGINT,
+    voted_only         BOOLEAN DEFAULT false,
+    voted_ratio        DECIMAL DEFAULT null,
+    covers_only        BOOLEAN DEFAULT false,
+    video_sync_enabled BOOLEAN DEFAULT true,
+    tree_state         JSONB,
+    current_match_id   TEXT,
+    status             TEXT DEFAULT 'setup',
+    created_at         TIMESTAMPTZ,
+    last_active        TIMESTAMPTZ,
+    CONSTRAINT fk_tournament_rooms_creator FOREIGN KEY (creator_id) REFERENCES users (user_id),
+    CONSTRAINT fk_tournament_rooms_category FOREIGN KEY (category_id)
+        REFERENCES categories (category_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tournament_rooms_category_id ON tournament_rooms (category_id);
+CREATE INDEX IF NOT EXISTS idx_tournament_rooms_current_match_id ON tournament_rooms (current_match_id);
+CREATE INDEX IF NOT EXISTS idx_tournament_rooms_last_active ON tournament_rooms (last_active);
+
+CREATE TABLE IF NOT EXISTS song_artists (
+    song_id   BIGINT,
+    artist_id BIGINT,
+    PRIMARY KEY (song_id, artist_id),
+    CONSTRAINT fk_song_artists_song FOREIGN KEY (song_id) REFERENCES songs (song_id),
+    CONSTRAINT fk_song_artists_artist FOREIGN KEY (artist_id) REFERENCES artists (artist_id)
+);
+
+CREATE TABLE IF NOT EXISTS song_units (
+    song_id BIGINT,
+    unit_id BIGINT,
+    PRIMARY KEY (song_id, unit_id),
+    CONSTRAINT fk_song_units_song FOREIGN KEY (song_id) REFERENCES songs (song_id),
+    CONSTRAINT fk_song_units_unit FOREIGN KEY (unit_id) REFERENCES units (unit_id)
+);
+
+CREATE TABLE IF NOT EXISTS album_songs (
+    album_id BIGINT,
+    song_id  BIGINT,
+    PRIMARY KEY (album_id, song_id),
+    CONSTRAINT fk_album_songs_album FOREIGN KEY (album_id) REFERENCES albums (album_id),
+    CONSTRAINT fk_album_songs_song FOREIGN KEY (song_id) REFERENCES songs (song_id)
+);
+
+CREATE TABLE IF NOT EXISTS artist_units (
+    artist_id BIGINT,
+    unit_id   BIGINT,
+    PRIMARY KEY (artist_id, unit_id),
+    CONSTRAINT fk_artist_units_artist FOREIGN KEY (artist_id) REFERENCES artists (artist_id),
+    CONSTRAINT fk_artist_units_unit FOREIGN KEY (unit_id) REFERENCES units (unit_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS room_events;
+DROP TABLE IF EXISTS live_room_members;
+DROP TABLE IF EXISTS live_rooms;
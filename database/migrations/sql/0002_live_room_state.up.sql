@@ -0,0 +1,35 @@
+-- Shared state of live rooms, so rooms survive restarts and can be served
+-- by several instances. Written by server/websocket/pgbackend.
+
+CREATE TABLE live_rooms (
+    topic           VARCHAR(32) NOT NULL,
+    room_id         VARCHAR(64) NOT NULL,
+    creator_id      VARCHAR(64) NOT NULL DEFAULT '',
+    current_song_id BIGINT,
+    video_time      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    is_playing      BOOLEAN NOT NULL DEFAULT FALSE,
+    last_activity   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (topic, room_id)
+);
+
+CREATE TABLE live_room_members (
+    topic       VARCHAR(32) NOT NULL,
+    room_id     VARCHAR(64) NOT NULL,
+    user_id     VARCHAR(64) NOT NULL,
+    username    VARCHAR(255) NOT NULL DEFAULT '',
+    instance_id VARCHAR(64) NOT NULL,
+    last_seen   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (topic, room_id, user_id),
+    CONSTRAINT fk_live_room_members_room FOREIGN KEY (topic, room_id)
+        REFERENCES live_rooms (topic, room_id) ON DELETE CASCADE
+);
+CREATE INDEX idx_live_room_members_instance ON live_room_members (topic, instance_id);
+CREATE INDEX idx_live_room_members_last_seen ON live_room_members (last_seen);
+
+-- Room events too large for a NOTIFY payload
+CREATE TABLE room_events (
+    id         BIGSERIAL PRIMARY KEY,
+    payload    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX idx_room_events_created_at ON room_events (created_at);
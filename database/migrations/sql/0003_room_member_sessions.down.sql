@@ -0,0 +1,6 @@
+DELETE FROM live_room_members;
+
+DROP INDEX IF EXISTS idx_live_room_members_user;
+ALTER TABLE live_room_members DROP CONSTRAINT live_room_members_pkey;
+ALTER TABLE live_room_members ADD PRIMARY KEY (topic, room_id, user_id);
+ALTER TABLE live_room_members DROP COLUMN session_id;
@@ -0,0 +1,9 @@
+-- A user may be connected to a room from several tabs or devices at once,
+-- so memberships are per connection (session) rather than per user.
+
+DELETE FROM live_room_members;
+
+ALTER TABLE live_room_members ADD COLUMN session_id VARCHAR(64) NOT NULL;
+ALTER TABLE live_room_members DROP CONSTRAINT live_room_members_pkey;
+ALTER TABLE live_room_members ADD PRIMARY KEY (topic, room_id, session_id);
+CREATE INDEX idx_live_room_members_user ON live_room_members (topic, room_id, user_id);
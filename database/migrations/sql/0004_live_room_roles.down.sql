@@ -0,0 +1,2 @@
+ALTER TABLE live_rooms DROP COLUMN banned;
+ALTER TABLE live_rooms DROP COLUMN roles;
@@ -0,0 +1,5 @@
+-- Room roles and bans, so they hold on every instance and across restarts.
+-- The host is live_rooms.creator_id.
+
+ALTER TABLE live_rooms ADD COLUMN roles JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE live_rooms ADD COLUMN banned JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS room_allowed_users;
+
+ALTER TABLE tournament_rooms DROP COLUMN invite_only;
+ALTER TABLE tournament_rooms DROP COLUMN password_hash;
+ALTER TABLE radio_rooms DROP COLUMN invite_only;
+ALTER TABLE radio_rooms DROP COLUMN password_hash;
+ALTER TABLE rating_rooms DROP COLUMN invite_only;
+ALTER TABLE rating_rooms DROP COLUMN password_hash;
@@ -0,0 +1,19 @@
+-- Optional room passwords and invite-only rooms. Users who entered the
+-- password or redeemed an invite are kept on the room's allow-list.
+
+ALTER TABLE rating_rooms ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE rating_rooms ADD COLUMN invite_only BOOLEAN DEFAULT false;
+ALTER TABLE radio_rooms ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE radio_rooms ADD COLUMN invite_only BOOLEAN DEFAULT false;
+ALTER TABLE tournament_rooms ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE tournament_rooms ADD COLUMN invite_only BOOLEAN DEFAULT false;
+
+CREATE TABLE room_allowed_users (
+    room_type  VARCHAR(16) NOT NULL,
+    room_id    VARCHAR(8) NOT NULL,
+    user_id    BIGINT NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (room_type, room_id, user_id),
+    CONSTRAINT fk_room_allowed_users_user FOREIGN KEY (user_id)
+        REFERENCES users (user_id) ON DELETE CASCADE
+);
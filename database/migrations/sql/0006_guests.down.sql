@@ -0,0 +1,7 @@
+ALTER TABLE tournament_rooms DROP COLUMN allow_guests;
+ALTER TABLE radio_rooms DROP COLUMN allow_guests;
+ALTER TABLE rating_rooms DROP COLUMN persist_guest_votes;
+ALTER TABLE rating_rooms DROP COLUMN allow_guests;
+
+DROP INDEX IF EXISTS idx_users_is_guest;
+ALTER TABLE users DROP COLUMN is_guest;
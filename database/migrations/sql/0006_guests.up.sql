@@ -0,0 +1,10 @@
+-- Guest users: temporary accounts made from a display name, and the room
+-- settings that let them in.
+
+ALTER TABLE users ADD COLUMN is_guest BOOLEAN DEFAULT false;
+CREATE INDEX idx_users_is_guest ON users (is_guest);
+
+ALTER TABLE rating_rooms ADD COLUMN allow_guests BOOLEAN DEFAULT false;
+ALTER TABLE rating_rooms ADD COLUMN persist_guest_votes BOOLEAN DEFAULT false;
+ALTER TABLE radio_rooms ADD COLUMN allow_guests BOOLEAN DEFAULT false;
+ALTER TABLE tournament_rooms ADD COLUMN allow_guests BOOLEAN DEFAULT false;
@@ -0,0 +1,4 @@
+ALTER TABLE radio_rooms DROP COLUMN skip_threshold;
+
+ALTER TABLE live_rooms DROP COLUMN skip_votes;
+ALTER TABLE live_rooms DROP COLUMN queue;
@@ -0,0 +1,7 @@
+-- Radio room queues: songs listeners asked for and the votes to skip the
+-- current one, plus the share of listeners a skip needs.
+
+ALTER TABLE live_rooms ADD COLUMN queue JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE live_rooms ADD COLUMN skip_votes JSONB NOT NULL DEFAULT '[]';
+
+ALTER TABLE radio_rooms ADD COLUMN skip_threshold DOUBLE PRECISION DEFAULT 0.5;
@@ -0,0 +1,2 @@
+ALTER TABLE live_rooms DROP COLUMN duration;
+ALTER TABLE live_rooms DROP COLUMN started_at;
@@ -0,0 +1,5 @@
+-- The server's playback clock for live rooms: when the current song was at
+-- 0s and how long it is.
+
+ALTER TABLE live_rooms ADD COLUMN started_at TIMESTAMPTZ;
+ALTER TABLE live_rooms ADD COLUMN duration DOUBLE PRECISION NOT NULL DEFAULT 0;
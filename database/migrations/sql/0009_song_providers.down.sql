@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_songs_provider;
+ALTER TABLE songs DROP COLUMN provider_id;
+ALTER TABLE songs DROP COLUMN provider;
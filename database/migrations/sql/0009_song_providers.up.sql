@@ -0,0 +1,13 @@
+-- The media provider that plays each song and the provider's ID for it.
+-- YouTube songs are filled in here; other songs are resolved from their
+-- source URL until they are saved again.
+
+ALTER TABLE songs ADD COLUMN provider VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE songs ADD COLUMN provider_id VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX idx_songs_provider ON songs (provider);
+
+UPDATE songs
+SET provider = 'youtube',
+    provider_id = substring(source_url from '(?:v=|youtu\.be/|/embed/|/v/)([a-zA-Z0-9_-]{11})')
+WHERE source_url ~* '(youtube\.com|youtu\.be)'
+  AND substring(source_url from '(?:v=|youtu\.be/|/embed/|/v/)([a-zA-Z0-9_-]{11})') IS NOT NULL;
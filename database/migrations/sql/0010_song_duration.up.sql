@@ -0,0 +1,4 @@
+-- Song lengths in seconds, from the media provider's metadata. 0 means the
+-- length is unknown and rooms wait for a player to report it.
+
+ALTER TABLE songs ADD COLUMN duration INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+-- Personal access tokens for the JSON API. Only a SHA-256 hash of each token
+-- is kept; revoked tokens stay for the record.
+
+CREATE TABLE api_tokens (
+    token_id     BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    prefix       VARCHAR(16) NOT NULL,
+    token_hash   VARCHAR(64) NOT NULL,
+    scopes       TEXT NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    expires_at   TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ,
+    CONSTRAINT fk_api_tokens_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_api_tokens_token_hash ON api_tokens (token_hash);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens (user_id);
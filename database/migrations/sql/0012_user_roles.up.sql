@@ -0,0 +1,8 @@
+-- Roles replace "every logged-in user is an admin". Existing accounts become
+-- members and the oldest registered account becomes the admin.
+
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'member';
+ALTER TABLE users ADD CONSTRAINT chk_users_role CHECK (role IN ('viewer', 'member', 'curator', 'admin'));
+
+UPDATE users SET role = 'admin'
+WHERE user_id = (SELECT MIN(user_id) FROM users WHERE is_guest IS NOT TRUE);
@@ -0,0 +1,19 @@
+-- Audit log of catalog, user and room moderation changes. Snapshots are
+-- JSON, so deleted entities can be restored from the log.
+
+CREATE TABLE audit_events (
+    event_id    BIGSERIAL PRIMARY KEY,
+    actor_id    BIGINT,
+    actor_name  VARCHAR(50),
+    action      VARCHAR(32) NOT NULL,
+    entity_type VARCHAR(32) NOT NULL,
+    entity_id   VARCHAR(64) NOT NULL,
+    before      JSONB,
+    after       JSONB,
+    created_at  TIMESTAMPTZ,
+    CONSTRAINT fk_audit_events_actor FOREIGN KEY (actor_id) REFERENCES users (user_id) ON DELETE SET NULL
+);
+CREATE INDEX idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX idx_audit_events_action ON audit_events (action);
+CREATE INDEX idx_audit_events_entity ON audit_events (entity_type, entity_id);
+CREATE INDEX idx_audit_events_created_at ON audit_events (created_at);
@@ -0,0 +1,26 @@
+-- Entities still in the trash are deleted for good; older versions would
+-- show them as live.
+
+DELETE FROM votes WHERE song_id IN (SELECT song_id FROM songs WHERE deleted_at IS NOT NULL);
+DELETE FROM song_artists WHERE song_id IN (SELECT song_id FROM songs WHERE deleted_at IS NOT NULL)
+    OR artist_id IN (SELECT artist_id FROM artists WHERE deleted_at IS NOT NULL);
+DELETE FROM song_units WHERE song_id IN (SELECT song_id FROM songs WHERE deleted_at IS NOT NULL)
+    OR unit_id IN (SELECT unit_id FROM units WHERE deleted_at IS NOT NULL);
+DELETE FROM album_songs WHERE song_id IN (SELECT song_id FROM songs WHERE deleted_at IS NOT NULL)
+    OR album_id IN (SELECT album_id FROM albums WHERE deleted_at IS NOT NULL);
+DELETE FROM artist_units WHERE artist_id IN (SELECT artist_id FROM artists WHERE deleted_at IS NOT NULL)
+    OR unit_id IN (SELECT unit_id FROM units WHERE deleted_at IS NOT NULL);
+DELETE FROM songs WHERE deleted_at IS NOT NULL;
+DELETE FROM artists WHERE deleted_at IS NOT NULL;
+DELETE FROM units WHERE deleted_at IS NOT NULL;
+DELETE FROM albums WHERE deleted_at IS NOT NULL;
+DELETE FROM categories WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_categories_name;
+CREATE UNIQUE INDEX idx_categories_name ON categories (name);
+
+DROP INDEX IF EXISTS idx_songs_deleted_at;
+DROP INDEX IF EXISTS idx_artists_deleted_at;
+DROP INDEX IF EXISTS idx_units_deleted_at;
+DROP INDEX IF EXISTS idx_albums_deleted_at;
+DROP INDEX IF EXISTS idx_categories_deleted_at;
@@ -0,0 +1,19 @@
+-- Catalog entities are soft deleted: deleted_at is NULL while they are live
+-- and set while they are in the trash. Rows written so far carry the zero
+-- time instead of NULL.
+
+UPDATE songs SET deleted_at = NULL WHERE deleted_at < '0002-01-01';
+UPDATE artists SET deleted_at = NULL WHERE deleted_at < '0002-01-01';
+UPDATE units SET deleted_at = NULL WHERE deleted_at < '0002-01-01';
+UPDATE albums SET deleted_at = NULL WHERE deleted_at < '0002-01-01';
+UPDATE categories SET deleted_at = NULL WHERE deleted_at < '0002-01-01';
+
+CREATE INDEX idx_songs_deleted_at ON songs (deleted_at);
+CREATE INDEX idx_artists_deleted_at ON artists (deleted_at);
+CREATE INDEX idx_units_deleted_at ON units (deleted_at);
+CREATE INDEX idx_albums_deleted_at ON albums (deleted_at);
+CREATE INDEX idx_categories_deleted_at ON categories (deleted_at);
+
+-- A category in the trash does not hold on to its name
+DROP INDEX IF EXISTS idx_categories_name;
+CREATE UNIQUE INDEX idx_categories_name ON categories (name) WHERE deleted_at IS NULL;
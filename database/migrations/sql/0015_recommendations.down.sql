@@ -0,0 +1,4 @@
+ALTER TABLE radio_rooms DROP COLUMN song_selection;
+ALTER TABLE rating_rooms DROP COLUMN song_selection;
+
+DROP TABLE IF EXISTS song_similarities;
@@ -0,0 +1,14 @@
+-- Song similarities the recommender predicts ratings from, and the rooms'
+-- song selection mode.
+
+CREATE TABLE song_similarities (
+    song_id     BIGINT NOT NULL,
+    neighbor_id BIGINT NOT NULL,
+    similarity  DOUBLE PRECISION NOT NULL,
+    overlap     INTEGER NOT NULL,
+    PRIMARY KEY (song_id, neighbor_id)
+);
+CREATE INDEX idx_song_similarities_neighbor_id ON song_similarities (neighbor_id);
+
+ALTER TABLE rating_rooms ADD COLUMN song_selection VARCHAR(16) DEFAULT 'random';
+ALTER TABLE radio_rooms ADD COLUMN song_selection VARCHAR(16) DEFAULT 'random';
@@ -0,0 +1,15 @@
+-- Charts materialized from the votes, refreshed periodically.
+
+CREATE TABLE chart_entries (
+    chart          VARCHAR(16) NOT NULL,
+    scope          VARCHAR(16) NOT NULL,
+    scope_id       BIGINT NOT NULL,
+    rank           INTEGER NOT NULL,
+    song_id        BIGINT NOT NULL,
+    score          DOUBLE PRECISION NOT NULL,
+    average_rating DOUBLE PRECISION NOT NULL,
+    vote_count     BIGINT NOT NULL,
+    refreshed_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (chart, scope, scope_id, rank)
+);
+CREATE INDEX idx_chart_entries_song_id ON chart_entries (song_id);
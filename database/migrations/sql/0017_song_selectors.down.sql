@@ -0,0 +1,2 @@
+ALTER TABLE rating_rooms DROP COLUMN recent_song_ids;
+ALTER TABLE rating_rooms DROP COLUMN repeat_window;
@@ -0,0 +1,5 @@
+-- Rating rooms remember their last songs so song selectors can rotate
+-- between artists and units and avoid repeating them.
+
+ALTER TABLE rating_rooms ADD COLUMN repeat_window INTEGER DEFAULT 0;
+ALTER TABLE rating_rooms ADD COLUMN recent_song_ids JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,2 @@
+ALTER TABLE live_rooms DROP COLUMN advancing_at;
+ALTER TABLE live_rooms DROP COLUMN advancing_from;
@@ -0,0 +1,6 @@
+-- Which song an instance is moving a live room on from, so only one of the
+-- instances serving the room advances it when the song ends. Claims older
+-- than a few seconds are from instances that died mid-advance.
+
+ALTER TABLE live_rooms ADD COLUMN advancing_from BIGINT;
+ALTER TABLE live_rooms ADD COLUMN advancing_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE songs ALTER COLUMN provider_id TYPE VARCHAR(255) USING left(provider_id, 255);
@@ -0,0 +1,4 @@
+-- Direct file songs use their whole URL as the provider ID, which does not
+-- fit in 255 characters.
+
+ALTER TABLE songs ALTER COLUMN provider_id TYPE TEXT;
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+// ============= RECOMMENDATIONS =============
+
+const (
+	// SimilarityNeighbors is how many of its most similar songs are kept
+	// per song
+	SimilarityNeighbors = 50
+	// SimilarityMinOverlap is how many users must have rated two songs
+	// before they are compared
+	SimilarityMinOverlap = 2
+	// similarityShrinkage damps similarities backed by few users: a pair
+	// rated by n users keeps n/(n+similarityShrinkage) of its similarity
+	similarityShrinkage = 10
+)
+
+// Prediction is a rating the recommender expects a user to give a song
+type Prediction struct {
+	SongID    uint    `json:"song_id"`
+	Rating    float64 `json:"rating"`    // From 1 to 10
+	Neighbors int     `json:"neighbors"` // Rated songs the prediction is based on
+}
+
+// ComputeSongSimilarities compares every two songs by how the users who
+// rated both of them rated them, relative to each user's average rating
+// (adjusted cosine). It keeps the SimilarityNeighbors most similar songs of
+// each song, in both directions, and drops dissimilar ones.
+func ComputeSongSimilarities(votes []models.Vote) []models.SongSimilarity {
+	byUser := make(map[uint][]models.Vote)
+	for _, vote := range votes {
+		byUser[vote.UserID] = append(byUser[vote.UserID], vote)
+	}
+
+	type pairTotals struct {
+		dot, normA, normB float64
+		overlap           int
+	}
+	pairs := make(map[[2]uint]*pairTotals)
+	for _, userVotes := range byUser {
+		if len(userVotes) < 2 {
+			continue
+		}
+		total := 0
+		for _, vote := range userVotes {
+			total += vote.Rating
+		}
+		mean := float64(total) / float64(len(userVotes))
+
+		sort.Slice(userVotes, func(i, j int) bool { return userVotes[i].SongID < userVotes[j].SongID })
+		for i, voteA := range userVotes {
+			a := float64(voteA.Rating) - mean
+			for _, voteB := range userVotes[i+1:] {
+				b := float64(voteB.Rating) - mean
+				key := [2]uint{voteA.SongID, voteB.SongID}
+				pair := pairs[key]
+				if pair == nil {
+					pair = &pairTotals{}
+					pairs[key] = pair
+				}
+				pair.dot += a * b
+				pair.normA += a * a
+				pair.normB += b * b
+				pair.overlap++
+			}
+		}
+	}
+
+	neighbors := make(map[uint][]models.SongSimilarity)
+	for key, pair := range pairs {
+		if pair.overlap < SimilarityMinOverlap || pair.normA == 0 || pair.normB == 0 {
+			continue
+		}
+		similarity := pair.dot / math.Sqrt(pair.normA*pair.normB)
+		similarity *= float64(pair.overlap) / float64(pair.overlap+similarityShrinkage)
+		if similarity <= 0 {
+			continue
+		}
+		neighbors[key[0]] = append(neighbors[key[0]], models.SongSimilarity{
+			SongID: key[0], NeighborID: key[1], Similarity: similarity, Overlap: pair.overlap,
+		})
+		neighbors[key[1]] = append(neighbors[key[1]], models.SongSimilarity{
+			SongID: key[1], NeighborID: key[0], Similarity: similarity, Overlap: pair.overlap,
+		})
+	}
+
+	var similarities []models.SongSimilarity
+	for _, songNeighbors := range neighbors {
+		sort.Slice(songNeighbors, func(i, j int) bool {
+			if songNeighbors[i].Similarity != songNeighbors[j].Similarity {
+				return songNeighbors[i].Similarity > songNeighbors[j].Similarity
+			}
+			return songNeighbors[i].NeighborID < songNeighbors[j].NeighborID
+		})
+		similarities = append(similarities, songNeighbors[:min(len(songNeighbors), SimilarityNeighbors)]...)
+	}
+	sort.Slice(similarities, func(i, j int) bool {
+		if similarities[i].SongID != similarities[j].SongID {
+			return similarities[i].SongID < similarities[j].SongID
+		}
+		return similarities[i].NeighborID < similarities[j].NeighborID
+	})
+	return similarities
+}
+
+// PredictRatings predicts the ratings of one user for the songs they have
+// not rated, from their votes and the similarities of those songs to the
+// ones they rated. Songs without a similar rated song get no prediction.
+func PredictRatings(votes []models.Vote, similarities []models.SongSimilarity) map[uint]Prediction {
+	predictions := make(map[uint]Prediction)
+	if len(votes) == 0 {
+		return predictions
+	}
+
+	ratings := make(map[uint]int, len(votes))
+	total := 0
+	for _, vote := range votes {
+		ratings[vote.SongID] = vote.Rating
+		total += vote.Rating
+	}
+	mean := float64(total) / float64(len(votes))
+
+	type predictionTotals struct {
+		weighted, weights float64
+		neighbors         int
+	}
+	totals := make(map[uint]*predictionTotals)
+	for _, similarity := range similarities {
+		rating, rated := ratings[similarity.NeighborID]
+		if !rated {
+			continue
+		}
+		if _, alreadyRated := ratings[similarity.SongID]; alreadyRated {
+			continue
+		}
+		songTotals := totals[similarity.SongID]
+		if songTotals == nil {
+			songTotals = &predictionTotals{}
+			totals[similarity.SongID] = songTotals
+		}
+		songTotals.weighted += similarity.Similarity * (float64(rating) - mean)
+		songTotals.weights += similarity.Similarity
+		songTotals.neighbors++
+	}
+
+	for songID, songTotals := range totals {
+		rating := mean + songTotals.weighted/songTotals.weights
+		predictions[songID] = Prediction{
+			SongID:    songID,
+			Rating:    min(max(rating, 1), 10),
+			Neighbors: songTotals.neighbors,
+		}
+	}
+	return predictions
+}
+
+// ReplaceSongSimilarities swaps the similarity table for a freshly computed
+// one in one transaction
+func (db *Database) ReplaceSongSimilarities(similarities []models.SongSimilarity) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM song_similarities").Error; err != nil {
+			return fmt.Errorf("failed to clear song similarities: %w", err)
+		}
+		if len(similarities) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(similarities, 1000).Error; err != nil {
+			return fmt.Errorf("failed to save song similarities: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetSongNeighbors lists the similarities whose neighbor is one of the given
+// songs, i.e. every song a rating of one of them says something about
+func (db *Database) GetSongNeighbors(neighborIDs []uint) ([]models.SongSimilarity, error) {
+	var similarities []models.SongSimilarity
+	if len(neighborIDs) == 0 {
+		return similarities, nil
+	}
+	if err := db.DB.Where("neighbor_id IN ?", neighborIDs).
+		Where("song_id NOT IN (?)", db.DB.Table("songs").Select("song_id").Where("deleted_at IS NOT NULL")).
+		Order("song_id, neighbor_id").
+		Find(&similarities).Error; err != nil {
+		return nil, fmt.Errorf("failed to get song neighbors: %w", err)
+	}
+	return similarities, nil
+}
@@ -0,0 +1,130 @@
+package database_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+)
+
+// votesOf builds votes from user ID -> song ID -> rating
+func votesOf(ratings map[uint]map[uint]int) []models.Vote {
+	var votes []models.Vote
+	for userID, songs := range ratings {
+		for songID, rating := range songs {
+			votes = append(votes, models.Vote{UserID: userID, SongID: songID, Rating: rating})
+		}
+	}
+	return votes
+}
+
+func TestComputeSongSimilarities(t *testing.T) {
+	tests := []struct {
+		name  string
+		votes []models.Vote
+		want  []models.SongSimilarity
+	}{
+		{"no votes", nil, nil},
+		{
+			// Songs 1 and 2 are rated alike, 3 the opposite; only user 4
+			// rated song 4, and user 5 rated a single song
+			"alike and opposite songs",
+			votesOf(map[uint]map[uint]int{
+				1: {1: 9, 2: 9, 3: 1},
+				2: {1: 8, 2: 8, 3: 2},
+				3: {1: 2, 2: 2, 3: 8},
+				4: {1: 1, 4: 10},
+				5: {2: 10},
+			}),
+			[]models.SongSimilarity{
+				{SongID: 1, NeighborID: 2, Similarity: 3.0 / 13, Overlap: 3},
+				{SongID: 2, NeighborID: 1, Similarity: 3.0 / 13, Overlap: 3},
+			},
+		},
+		{
+			"users rating everything alike say nothing",
+			votesOf(map[uint]map[uint]int{
+				1: {1: 5, 2: 5},
+				2: {1: 7, 2: 7},
+			}),
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		got := database.ComputeSongSimilarities(tt.votes)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			g, w := got[i], tt.want[i]
+			if g.SongID != w.SongID || g.NeighborID != w.NeighborID || g.Overlap != w.Overlap || math.Abs(g.Similarity-w.Similarity) > 1e-9 {
+				t.Errorf("%s: similarity %d = %+v, want %+v", tt.name, i, g, w)
+			}
+		}
+	}
+}
+
+func TestComputeSongSimilaritiesKeepsNearestNeighbors(t *testing.T) {
+	// Songs 1 to 52 are all alike, song 53 is their opposite
+	songCount := database.SimilarityNeighbors + 2
+	ratings := map[uint]map[uint]int{1: {}, 2: {}}
+	for _, userRatings := range ratings {
+		for songID := uint(1); songID <= uint(songCount); songID++ {
+			userRatings[songID] = 9
+		}
+		userRatings[uint(songCount)+1] = 1
+	}
+
+	neighbors := make(map[uint][]uint)
+	for _, similarity := range database.ComputeSongSimilarities(votesOf(ratings)) {
+		neighbors[similarity.SongID] = append(neighbors[similarity.SongID], similarity.NeighborID)
+	}
+	if len(neighbors[1]) != database.SimilarityNeighbors {
+		t.Fatalf("song 1 has %d neighbors; want %d", len(neighbors[1]), database.SimilarityNeighbors)
+	}
+	// Ties go to the lower ID
+	if last := neighbors[1][len(neighbors[1])-1]; last != uint(database.SimilarityNeighbors)+1 {
+		t.Errorf("song 1's last neighbor is %d; want %d", last, database.SimilarityNeighbors+1)
+	}
+	if _, ok := neighbors[uint(songCount)+1]; ok {
+		t.Error("the opposite song has neighbors")
+	}
+}
+
+func TestPredictRatings(t *testing.T) {
+	votes := []models.Vote{{SongID: 2, Rating: 8}, {SongID: 3, Rating: 4}} // Mean 6
+	similarities := []models.SongSimilarity{
+		{SongID: 1, NeighborID: 2, Similarity: 0.5},
+		{SongID: 1, NeighborID: 3, Similarity: 0.25},
+		{SongID: 4, NeighborID: 2, Similarity: 1},
+		{SongID: 2, NeighborID: 3, Similarity: 0.9}, // Rated already
+		{SongID: 5, NeighborID: 9, Similarity: 1},   // Neighbor not rated
+	}
+
+	tests := []struct {
+		name  string
+		votes []models.Vote
+		want  map[uint]database.Prediction
+	}{
+		{"no votes", nil, map[uint]database.Prediction{}},
+		{"weighted by similarity", votes, map[uint]database.Prediction{
+			1: {SongID: 1, Rating: 6 + 0.5/0.75, Neighbors: 2},
+			4: {SongID: 4, Rating: 8, Neighbors: 1},
+		}},
+	}
+	for _, tt := range tests {
+		got := database.PredictRatings(tt.votes, similarities)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for songID, want := range tt.want {
+			prediction := got[songID]
+			if prediction.SongID != want.SongID || prediction.Neighbors != want.Neighbors || math.Abs(prediction.Rating-want.Rating) > 1e-9 {
+				t.Errorf("%s: song %d = %+v, want %+v", tt.name, songID, prediction, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============= USER ROLES =============
+
+// SetUserRole changes the role of a user. Guests cannot be made curators or
+// admins, and the last admin cannot be demoted.
+func (db *Database) SetUserRole(userID uint, role string) error {
+	if !models.ValidRole(role) {
+		return fmt.Errorf("%w: unknown role %q", ErrValidation, role)
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the admins first, so two demotions cannot both see another admin
+		var adminIDs []uint
+		if err := tx.Model(&models.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("role = ?", models.RoleAdmin).Pluck("user_id", &adminIDs).Error; err != nil {
+			return fmt.Errorf("failed to get admins: %w", err)
+		}
+
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if err := CheckRoleChange(user, role, len(adminIDs)); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Update("role", role).Error; err != nil {
+			return fmt.Errorf("failed to update role: %w", err)
+		}
+		return nil
+	})
+}
+
+// CheckRoleChange enforces the rules of SetUserRole, given how many admins
+// there are
+func CheckRoleChange(user models.User, role string, admins int) error {
+	if user.IsGuest && models.RoleAtLeast(role, models.RoleCurator) {
+		return fmt.Errorf("%w: guests cannot be %ss", ErrValidation, role)
+	}
+	if user.Role == models.RoleAdmin && role != models.RoleAdmin && admins <= 1 {
+		return fmt.Errorf("%w: %s is the last admin", ErrValidation, user.Username)
+	}
+	return nil
+}
+
+// ClaimFirstAdmin makes a user admin if there is no admin yet. Locking the
+// users table makes concurrent claims wait for each other; locking the admin
+// rows would lock nothing while there are none.
+func (db *Database) ClaimFirstAdmin(userID uint) (bool, error) {
+	claimed := false
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return fmt.Errorf("failed to lock users: %w", err)
+		}
+		result := tx.Model(&models.User{}).
+			Where("user_id = ? AND is_guest = ?", userID, false).
+			Where("NOT EXISTS (SELECT 1 FROM users WHERE role = ?)", models.RoleAdmin).
+			Update("role", models.RoleAdmin)
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim first admin: %w", result.Error)
+		}
+		claimed = result.RowsAffected == 1
+		return nil
+	})
+	return claimed, err
+}
+
+func (db *Database) CountUsersByRole(role string) (int64, error) {
+	var count int64
+	if err := db.DB.Model(&models.User{}).Where("role = ?", role).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count users by role: %w", err)
+	}
+	return count, nil
+}
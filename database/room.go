@@ -0,0 +1,221 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============= RATING ROOMS =============
+
+// RatingRoomHistory is how many of its last songs a rating room remembers
+const RatingRoomHistory = 50
+
+// PushRecentSong puts a song in front of a room's recent songs and forgets
+// the ones beyond RatingRoomHistory
+func PushRecentSong(recent []uint, songID uint) []uint {
+	pushed := append([]uint{songID}, recent...)
+	return pushed[:min(len(pushed), RatingRoomHistory)]
+}
+
+func (db *Database) CreateRatingRoom(room *models.RatingRoom) error {
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+	if strings.TrimSpace(room.RoomID) == "" {
+		return fmt.Errorf("%w: room ID cannot be empty", ErrValidation)
+	}
+
+	if err := db.DB.Create(room).Error; err != nil {
+		return fmt.Errorf("failed to create rating room: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) GetRatingRoom(roomID string) (*models.RatingRoom, error) {
+	var room models.RatingRoom
+	if err := db.DB.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+		return nil, fmt.Errorf("failed to get rating room: %w", err)
+	}
+	return &room, nil
+}
+
+func (db *Database) SetRatingRoomCurrentSong(roomID string, songID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the room so songs picked at once on two instances both
+		// end up in its history
+		var rooms []models.RatingRoom
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("room_id", "recent_song_ids").
+			Where("room_id = ?", roomID).
+			Find(&rooms).Error; err != nil {
+			return fmt.Errorf("failed to update rating room song: %w", err)
+		}
+		var recent []uint
+		if len(rooms) > 0 {
+			recent = rooms[0].RecentSongIDs
+		}
+		recentJSON, err := json.Marshal(PushRecentSong(recent, songID))
+		if err != nil {
+			return fmt.Errorf("failed to update rating room song: %w", err)
+		}
+
+		if err := tx.Model(&models.RatingRoom{}).
+			Where("room_id = ?", roomID).
+			Updates(map[string]interface{}{
+				"current_song_id": songID,
+				"recent_song_ids": string(recentJSON),
+				"last_active":     time.Now(),
+			}).Error; err != nil {
+			return fmt.Errorf("failed to update rating room song: %w", err)
+		}
+		return nil
+	})
+}
+
+func (db *Database) TouchRatingRoom(roomID string) error {
+	if err := db.DB.Model(&models.RatingRoom{}).
+		Where("room_id = ?", roomID).
+		Update("last_active", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to update rating room activity: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) DeleteInactiveRatingRooms(before time.Time) (int64, error) {
+	result := db.DB.Where("last_active < ?", before).Delete(&models.RatingRoom{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete inactive rating rooms: %w", result.Error)
+	}
+	if err := db.deleteOrphanedRoomAccess(models.RoomTypeRating, &models.RatingRoom{}); err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
+
+// ============= RADIO ROOMS =============
+
+func (db *Database) CreateRadioRoom(room *models.RadioRoom) error {
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+	if strings.TrimSpace(room.RoomID) == "" {
+		return fmt.Errorf("%w: room ID cannot be empty", ErrValidation)
+	}
+
+	if err := db.DB.Create(room).Error; err != nil {
+		return fmt.Errorf("failed to create radio room: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) GetRadioRoom(roomID string) (*models.RadioRoom, error) {
+	var room models.RadioRoom
+	if err := db.DB.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+		return nil, fmt.Errorf("failed to get radio room: %w", err)
+	}
+	return &room, nil
+}
+
+func (db *Database) SetRadioRoomCurrentSong(roomID string, songID uint) error {
+	if err := db.DB.Model(&models.RadioRoom{}).
+		Where("room_id = ?", roomID).
+		Updates(map[string]interface{}{
+			"current_song_id": songID,
+			"last_active":     time.Now(),
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update radio room song: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) TouchRadioRoom(roomID string) error {
+	if err := db.DB.Model(&models.RadioRoom{}).
+		Where("room_id = ?", roomID).
+		Update("last_active", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to update radio room activity: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) DeleteInactiveRadioRooms(before time.Time) (int64, error) {
+	result := db.DB.Where("last_active < ?", before).Delete(&models.RadioRoom{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete inactive radio rooms: %w", result.Error)
+	}
+	if err := db.deleteOrphanedRoomAccess(models.RoomTypeRadio, &models.RadioRoom{}); err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
+
+// ============= TOURNAMENT ROOMS =============
+
+func (db *Database) CreateTournamentRoom(room *models.TournamentRoom) error {
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+	if strings.TrimSpace(room.RoomID) == "" {
+		return fmt.Errorf("%w: room ID cannot be empty", ErrValidation)
+	}
+
+	if err := db.DB.Create(room).Error; err != nil {
+		return fmt.Errorf("failed to create tournament room: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) GetTournamentRoom(roomID string) (*models.TournamentRoom, error) {
+	var room models.TournamentRoom
+	if err := db.DB.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+		return nil, fmt.Errorf("failed to get tournament room: %w", err)
+	}
+	return &room, nil
+}
+
+// UpdateTournamentRoom saves the bracket, status and current match of a room
+// and marks it as active
+func (db *Database) UpdateTournamentRoom(room *models.TournamentRoom) error {
+	if room == nil {
+		return errors.New("room cannot be nil")
+	}
+
+	room.LastActive = time.Now()
+	if err := db.DB.Model(&models.TournamentRoom{}).
+		Where("room_id = ?", room.RoomID).
+		Updates(map[string]interface{}{
+			"tree_state":       room.TreeState,
+			"status":           room.Status,
+			"current_match_id": room.CurrentMatchID,
+			"last_active":      room.LastActive,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update tournament room: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) TouchTournamentRoom(roomID string) error {
+	if err := db.DB.Model(&models.TournamentRoom{}).
+		Where("room_id = ?", roomID).
+		Update("last_active", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to update tournament room activity: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) DeleteInactiveTournamentRooms(before time.Time) (int64, error) {
+	result := db.DB.Where("last_active < ?", before).Delete(&models.TournamentRoom{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete inactive tournament rooms: %w", result.Error)
+	}
+	if err := db.deleteOrphanedRoomAccess(models.RoomTypeTournament, &models.TournamentRoom{}); err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
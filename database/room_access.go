@@ -0,0 +1,43 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm/clause"
+)
+
+// ============= ROOM ACCESS =============
+
+func (db *Database) AllowRoomUser(roomType, roomID string, userID uint) error {
+	entry := models.RoomAllowedUser{
+		RoomType:  roomType,
+		RoomID:    roomID,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	if err := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to allow user in room: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) IsRoomUserAllowed(roomType, roomID string, userID uint) (bool, error) {
+	var count int64
+	if err := db.DB.Model(&models.RoomAllowedUser{}).
+		Where("room_type = ? AND room_id = ? AND user_id = ?", roomType, roomID, userID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check room access: %w", err)
+	}
+	return count > 0, nil
+}
+
+// deleteOrphanedRoomAccess removes the allow-list entries of deleted rooms
+func (db *Database) deleteOrphanedRoomAccess(roomType string, rooms interface{}) error {
+	if err := db.DB.Where("room_type = ? AND room_id NOT IN (?)", roomType, db.DB.Model(rooms).Select("room_id")).
+		Delete(&models.RoomAllowedUser{}).Error; err != nil {
+		return fmt.Errorf("failed to delete room access of deleted rooms: %w", err)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
 )
 
 func (db *Database) validateSong(song *models.Song, isUpdate bool) error {
@@ -59,7 +60,7 @@ func (db *Database) validateSong(song *models.Song, isUpdate bool) error {
 
 func (db *Database) CreateSong(song *models.Song) error {
 	if err := db.validateSong(song, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Create(song).Error; err != nil {
@@ -80,6 +81,19 @@ func (db *Database) GetSongByID(songID uint) (*models.Song, error) {
 	return &song, nil
 }
 
+// GetSongsByIDs returns the songs with the given IDs without their relations
+func (db *Database) GetSongsByIDs(songIDs []uint) ([]models.Song, error) {
+	var songs []models.Song
+	if len(songIDs) == 0 {
+		return songs, nil
+	}
+
+	if err := db.DB.Where("song_id IN ?", songIDs).Find(&songs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get songs by IDs: %w", err)
+	}
+	return songs, nil
+}
+
 func (db *Database) GetSongsByName(name string) ([]models.Song, error) {
 	if strings.TrimSpace(name) == "" {
 		return nil, errors.New("name cannot be empty")
@@ -163,7 +177,7 @@ func (db *Database) UpdateSong(song *models.Song) error {
 
 	// Validate the updated song data
 	if err := db.validateSong(song, true); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Save(song).Error; err != nil {
@@ -215,4 +229,207 @@ func (db *Database) GetSongsBySourceURL(sourceURL string) (*models.Song, error)
 		return nil, fmt.Errorf("failed to get song by source URL: %w", err)
 	}
 	return &song, nil
-}
\ No newline at end of file
+}
+// applySongFilter restricts a songs query to the songs matching the filter
+func (db *Database) applySongFilter(query *gorm.DB, filter SongFilter) *gorm.DB {
+	if filter.CategoryID != nil {
+		query = query.Where("songs.category_id = ?", *filter.CategoryID)
+	}
+	if filter.IsCover != nil {
+		query = query.Where("songs.is_cover = ?", *filter.IsCover)
+	}
+	if filter.ArtistID != nil {
+		query = query.Where("songs.song_id IN (?)",
+			db.DB.Table("song_artists").Select("song_id").Where("artist_id = ?", *filter.ArtistID))
+	}
+	if filter.UnitID != nil {
+		query = query.Where("songs.song_id IN (?)",
+			db.DB.Table("song_units").Select("song_id").Where("unit_id = ?", *filter.UnitID))
+	}
+	if filter.AlbumID != nil {
+		query = query.Where("songs.song_id IN (?)",
+			db.DB.Table("album_songs").Select("song_id").Where("album_id = ?", *filter.AlbumID))
+	}
+	if filter.AlbumType != "" {
+		query = query.Where("songs.song_id IN (?)",
+			db.DB.Table("album_songs").
+				Select("album_songs.song_id").
+				Joins("JOIN albums ON albums.album_id = album_songs.album_id").
+				Where("albums.type = ?", filter.AlbumType))
+	}
+	if filter.MinAverageRating != nil {
+		query = query.Where("songs.song_id IN (?)",
+			db.DB.Table("votes").
+				Select("song_id").
+				Group("song_id").
+				Having("AVG(rating) >= ?", *filter.MinAverageRating),
+		)
+	}
+	if filter.MaxAverageRating != nil {
+		query = query.Where("songs.song_id IN (?)",
+			db.DB.Table("votes").
+				Select("song_id").
+				Group("song_id").
+				Having("AVG(rating) <= ?", *filter.MaxAverageRating),
+		)
+	}
+	if filter.RatedBy != nil {
+		query = query.Where("songs.song_id IN (?)",
+			db.DB.Table("votes").Select("song_id").Where("user_id = ?", *filter.RatedBy))
+	}
+	if filter.NotRatedBy != nil {
+		query = query.Where("songs.song_id NOT IN (?)",
+			db.DB.Table("votes").Select("song_id").Where("user_id = ?", *filter.NotRatedBy))
+	}
+	if len(filter.NotRatedByAll) > 0 {
+		query = query.Where("songs.song_id NOT IN (?)",
+			db.DB.Table("votes").
+				Select("song_id").
+				Where("user_id IN ?", filter.NotRatedByAll).
+				Group("song_id").
+				Having("COUNT(DISTINCT user_id) = ?", len(filter.NotRatedByAll)),
+		)
+	}
+	if len(filter.ExcludeSongIDs) > 0 {
+		query = query.Where("songs.song_id NOT IN ?", filter.ExcludeSongIDs)
+	}
+	if len(filter.ExcludeArtistIDs) > 0 {
+		query = query.Where("songs.song_id NOT IN (?)",
+			db.DB.Table("song_artists").Select("song_id").Where("artist_id IN ?", filter.ExcludeArtistIDs))
+	}
+	if filter.SongIDs != nil {
+		query = query.Where("songs.song_id IN ?", filter.SongIDs)
+	}
+	return query
+}
+
+// RandomSongs returns up to limit songs matching the filter in random order,
+// with their relations loaded
+func (db *Database) RandomSongs(filter SongFilter, limit int) ([]models.Song, error) {
+	query := db.DB.Preload("Units").Preload("Category").Preload("Artists").Preload("Albums")
+	query = db.applySongFilter(query, filter)
+
+	var songs []models.Song
+	if err := query.Order("RANDOM()").Limit(limit).Find(&songs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get random songs: %w", err)
+	}
+	return songs, nil
+}
+
+func (db *Database) RandomSongByVotes(filter SongFilter) (*models.Song, error) {
+	query := db.DB.Preload("Units").Preload("Category").Preload("Artists").Preload("Albums").
+		Select("songs.*").
+		Joins("LEFT JOIN (?) AS stats ON stats.song_id = songs.song_id", db.songStatsQuery())
+	query = db.applySongFilter(query, filter)
+
+	// Every song draws an exponential key with rate 1/(1+votes) and the
+	// smallest key wins, which picks each song with a chance proportional to
+	// its rate. 1 - RANDOM() keeps the logarithm away from 0.
+	var songs []models.Song
+	if err := query.Order("-LN(1 - RANDOM()) * (1 + COALESCE(stats.vote_count, 0))").Limit(1).Find(&songs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get random song: %w", err)
+	}
+	if len(songs) == 0 {
+		return nil, nil
+	}
+	return &songs[0], nil
+}
+
+func (db *Database) GetSongCredits(filter SongFilter) ([]SongCredits, error) {
+	// A fresh query each time, as gorm queries cannot be reused once run
+	matching := func() *gorm.DB {
+		return db.applySongFilter(db.DB.Table("songs").Select("songs.song_id").Where("songs.deleted_at IS NULL"), filter)
+	}
+
+	var songIDs []uint
+	if err := matching().Pluck("songs.song_id", &songIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get songs: %w", err)
+	}
+	var artists, units []struct {
+		SongID  uint
+		GroupID uint
+	}
+	if err := db.DB.Table("song_artists").Select("song_id, artist_id AS group_id").
+		Where("song_id IN (?)", matching()).Scan(&artists).Error; err != nil {
+		return nil, fmt.Errorf("failed to get song artists: %w", err)
+	}
+	if err := db.DB.Table("song_units").Select("song_id, unit_id AS group_id").
+		Where("song_id IN (?)", matching()).Scan(&units).Error; err != nil {
+		return nil, fmt.Errorf("failed to get song units: %w", err)
+	}
+
+	credits := make([]SongCredits, len(songIDs))
+	index := make(map[uint]int, len(songIDs))
+	for i, id := range songIDs {
+		credits[i].SongID = id
+		index[id] = i
+	}
+	for _, row := range artists {
+		if i, ok := index[row.SongID]; ok {
+			credits[i].ArtistIDs = append(credits[i].ArtistIDs, row.GroupID)
+		}
+	}
+	for _, row := range units {
+		if i, ok := index[row.SongID]; ok {
+			credits[i].UnitIDs = append(credits[i].UnitIDs, row.GroupID)
+		}
+	}
+	return credits, nil
+}
+
+// songSortExpressions are what ListSongs orders by for each sort key
+var songSortExpressions = map[string]string{
+	"name":    "songs.name_original",
+	"created": "songs.created_at",
+	"average": "COALESCE(stats.average_score, 0)",
+	"votes":   "COALESCE(stats.vote_count, 0)",
+}
+
+// ListSongs finds a page of song IDs with their vote aggregates in one query,
+// then loads those songs with the requested relations
+func (db *Database) ListSongs(filter SongFilter, opts ListOptions) (*Page[SongWithStats], error) {
+	opts, cursor, err := PrepareList(opts, SongListing)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.DB.Table("songs").
+		Select("songs.song_id, COALESCE(stats.average_score, 0) AS average_score, COALESCE(stats.vote_count, 0) AS vote_count").
+		Joins("LEFT JOIN (?) AS stats ON stats.song_id = songs.song_id", db.songStatsQuery()).
+		Where("songs.deleted_at IS NULL")
+	query = db.applySongFilter(query, filter)
+	query = applyKeyset(query, songSortExpressions[opts.Sort], "songs.song_id", opts, cursor)
+
+	var rows []struct {
+		SongID uint
+		SongStats
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list songs: %w", err)
+	}
+
+	songIDs := make([]uint, len(rows))
+	for i, row := range rows {
+		songIDs[i] = row.SongID
+	}
+	var songs []models.Song
+	if len(songIDs) > 0 {
+		if err := preloadIncludes(db.DB, opts.Include).Where("song_id IN ?", songIDs).Find(&songs).Error; err != nil {
+			return nil, fmt.Errorf("failed to list songs: %w", err)
+		}
+	}
+	songsByID := make(map[uint]models.Song, len(songs))
+	for _, song := range songs {
+		songsByID[song.SongID] = song
+	}
+
+	items := make([]SongWithStats, 0, len(rows))
+	for _, row := range rows {
+		if song, ok := songsByID[row.SongID]; ok {
+			items = append(items, SongWithStats{Song: song, SongStats: row.SongStats})
+		}
+	}
+	return NewPage(items, opts, func(song SongWithStats) (any, uint) {
+		return SongSortValue(song, opts.Sort), song.SongID
+	}), nil
+}
@@ -0,0 +1,339 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned (wrapped) when a requested record does not exist.
+	// It aliases gorm.ErrRecordNotFound so errors.Is works for both backends.
+	ErrNotFound = gorm.ErrRecordNotFound
+
+	// ErrValidation is returned (wrapped) when input fails validation
+	ErrValidation = errors.New("validation failed")
+)
+
+// SongFilter narrows down song picks; nil and empty fields are not filtered on
+type SongFilter struct {
+	CategoryID       *uint
+	IsCover          *bool
+	ArtistID         *uint
+	UnitID           *uint
+	AlbumID          *uint
+	AlbumType        string // only songs on an album of this type
+	MinAverageRating *int
+	MaxAverageRating *int
+	RatedBy          *uint  // only songs this user has voted on
+	NotRatedBy       *uint  // only songs this user has not voted on
+	NotRatedByAll    []uint // skip songs every one of these users has voted on
+	ExcludeSongIDs   []uint
+	ExcludeArtistIDs []uint // skip songs by any of these artists
+	SongIDs          []uint // only these songs
+}
+
+// SongCredits are the artist and unit IDs of a song
+type SongCredits struct {
+	SongID    uint
+	ArtistIDs []uint
+	UnitIDs   []uint
+}
+
+// SongRepository stores songs and their artist, unit and album relations.
+// Relations set on a song passed to CreateSong are stored with it.
+// DeleteSong moves the song to the trash and keeps its relations and votes.
+type SongRepository interface {
+	CreateSong(song *models.Song) error
+	GetSongByID(songID uint) (*models.Song, error)
+	GetSongsByIDs(songIDs []uint) ([]models.Song, error)
+	GetSongsByName(name string) ([]models.Song, error)
+	GetAllSongs() ([]models.Song, error)
+	GetSongsByCategory(categoryID uint) ([]models.Song, error)
+	GetSongsByArtist(artistID uint) ([]models.Song, error)
+	GetSongsBySourceURL(sourceURL string) (*models.Song, error)
+	UpdateSong(song *models.Song) error
+	DeleteSong(songID uint) error
+	SongExists(songID uint) (bool, error)
+	RandomSongs(filter SongFilter, limit int) ([]models.Song, error)
+	// RandomSongByVotes picks one song matching the filter, with its
+	// relations loaded, or nil if none does. Songs with fewer votes are
+	// picked more often: a song's chance is proportional to 1/(1+votes).
+	RandomSongByVotes(filter SongFilter) (*models.Song, error)
+	// GetSongCredits returns the artists and units of every song matching
+	// the filter without loading the songs themselves
+	GetSongCredits(filter SongFilter) ([]SongCredits, error)
+	// ListSongs pages through the songs matching the filter with their vote
+	// aggregates, see SongListing for the sort keys and relations
+	ListSongs(filter SongFilter, opts ListOptions) (*Page[SongWithStats], error)
+}
+
+// ArtistRepository stores artists. DeleteArtist moves the artist to the
+// trash and keeps its links.
+type ArtistRepository interface {
+	CreateArtist(artist *models.Artist) error
+	GetArtistByID(artistID uint) (*models.Artist, error)
+	GetArtistsByIDs(artistIDs []uint) ([]models.Artist, error)
+	GetAllArtists() ([]models.Artist, error)
+	ListArtists(filter ArtistFilter, opts ListOptions) (*Page[models.Artist], error)
+	SearchArtists(query string) ([]models.Artist, error)
+	UpdateArtist(artist *models.Artist) error
+	DeleteArtist(artistID uint) error
+	ArtistExists(artistID uint) (bool, error)
+}
+
+// UnitRepository stores units. DeleteUnit moves the unit to the trash and
+// keeps its links.
+type UnitRepository interface {
+	CreateUnit(unit *models.Unit) error
+	GetUnitByID(unitID uint) (*models.Unit, error)
+	GetUnitsByIDs(unitIDs []uint) ([]models.Unit, error)
+	GetAllUnits() ([]models.Unit, error)
+	ListUnits(filter UnitFilter, opts ListOptions) (*Page[models.Unit], error)
+	UpdateUnit(unit *models.Unit) error
+	DeleteUnit(unitID uint) error
+	UnitExists(unitID uint) (bool, error)
+}
+
+// AlbumRepository stores albums. DeleteAlbum moves the album to the trash
+// and keeps its songs.
+type AlbumRepository interface {
+	CreateAlbum(album *models.Album) error
+	GetAlbumByID(albumID uint) (*models.Album, error)
+	GetAlbumsByIDs(albumIDs []uint) ([]models.Album, error)
+	GetAllAlbums() ([]models.Album, error)
+	ListAlbums(filter AlbumFilter, opts ListOptions) (*Page[models.Album], error)
+	UpdateAlbum(album *models.Album) error
+	DeleteAlbum(albumID uint) error
+	AlbumExists(albumID uint) (bool, error)
+}
+
+// CategoryRepository stores categories. DeleteCategory moves the category
+// to the trash; entities using it keep it until it is purged.
+type CategoryRepository interface {
+	CreateCategory(category *models.Category) error
+	GetCategoryByID(categoryID uint) (*models.Category, error)
+	GetCategoryByName(name string) (*models.Category, error)
+	GetAllCategories() ([]models.Category, error)
+	UpdateCategory(category *models.Category) error
+	DeleteCategory(categoryID uint) error
+	CategoryExists(categoryID uint) (bool, error)
+}
+
+// VoteFilter narrows down vote listings; nil fields are not filtered on
+type VoteFilter struct {
+	UserIDs   []uint
+	SongIDs   []uint
+	MinRating *int
+	MaxRating *int
+}
+
+// VoteWithUser is a vote joined with the username of its author
+type VoteWithUser struct {
+	models.Vote
+	Username string
+	IsGuest  bool
+}
+
+// VoteRepository stores ratings. UpsertVote creates the vote or updates the
+// rating and comment of the user's existing vote for the song.
+type VoteRepository interface {
+	GetVoteByID(voteID uint) (*models.Vote, error)
+	GetVote(userID, songID uint) (*models.Vote, error)
+	GetVotes(filter VoteFilter) ([]models.Vote, error)
+	ListVotes(filter VoteFilter, opts ListOptions) (*Page[models.Vote], error)
+	GetVotesByUser(userID uint) ([]models.Vote, error)
+	GetVotesWithUsers(filter VoteFilter) ([]VoteWithUser, error)
+	UpsertVote(vote *models.Vote) error
+	DeleteVote(userID, songID uint) error
+	VoteExists(userID, songID uint) (bool, error)
+	GetAverageRatingForSong(songID uint) (float64, error)
+	GetVoteCountForSong(songID uint) (int64, error)
+	// GetSongStats returns the vote aggregates of the given songs, or of all
+	// songs when songIDs is nil; songs without votes are left out
+	GetSongStats(songIDs []uint) (map[uint]SongStats, error)
+}
+
+// StatsRepository aggregates votes into profiles and compares users
+type StatsRepository interface {
+	// GetUserStats builds the taste profile of a user from their votes
+	GetUserStats(userID uint) (*UserStats, error)
+	// GetCompatibility compares every pair of the given users who rated at
+	// least one same song, most compatible first
+	GetCompatibility(userIDs []uint) ([]Compatibility, error)
+	GetSharedRatings(userA, userB uint) ([]SharedRating, error)
+}
+
+// RecommendationRepository keeps the song similarities the recommender
+// predicts ratings from, see ComputeSongSimilarities and PredictRatings
+type RecommendationRepository interface {
+	// ReplaceSongSimilarities swaps in a freshly computed similarity table
+	ReplaceSongSimilarities(similarities []models.SongSimilarity) error
+	// GetSongNeighbors lists the similarities whose neighbor is one of the
+	// given songs, leaving out songs in the trash
+	GetSongNeighbors(neighborIDs []uint) ([]models.SongSimilarity, error)
+}
+
+// ChartRepository keeps the charts materialized by ComputeCharts
+type ChartRepository interface {
+	// ReplaceChartEntries swaps in freshly computed charts
+	ReplaceChartEntries(entries []models.ChartEntry) error
+	// GetChart lists the entries of one chart by rank, leaving out songs in
+	// the trash
+	GetChart(chart, scope string, scopeID uint) ([]models.ChartEntry, error)
+	// GetChartScopeIDs lists the IDs of a scope that have charts, in order
+	GetChartScopeIDs(scope string) ([]uint, error)
+}
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	CreateUser(user *models.User) error
+	GetUserByID(userID uint) (*models.User, error)
+	GetUserByUsername(username string) (*models.User, error)
+	GetAllUsers() ([]models.User, error)
+	SearchUsers(query string) ([]models.User, error)
+	UpdateUser(user *models.User) error
+	DeleteUser(userID uint) error
+	UserExists(userID uint) (bool, error)
+	UsernameExists(username string) (bool, error)
+
+	// ClaimGuest moves the votes and room access of a guest onto userID and
+	// deletes the guest. It returns the number of votes moved.
+	ClaimGuest(guestID, userID uint) (int64, error)
+	// DeleteStaleGuests removes guests created before the cutoff that have
+	// no votes
+	DeleteStaleGuests(before time.Time) (int64, error)
+
+	// SetUserRole changes the role of a user; the last admin cannot be demoted
+	SetUserRole(userID uint, role string) error
+	// ClaimFirstAdmin makes an account admin if the site has no admin yet.
+	// Of several accounts claiming at once only one wins.
+	ClaimFirstAdmin(userID uint) (bool, error)
+	CountUsersByRole(role string) (int64, error)
+}
+
+// RoomRepository stores the persistent part of rating, radio and tournament rooms
+type RoomRepository interface {
+	CreateRatingRoom(room *models.RatingRoom) error
+	GetRatingRoom(roomID string) (*models.RatingRoom, error)
+	// SetRatingRoomCurrentSong moves a rating room on to a song and adds it
+	// to the room's RecentSongIDs
+	SetRatingRoomCurrentSong(roomID string, songID uint) error
+	TouchRatingRoom(roomID string) error
+	DeleteInactiveRatingRooms(before time.Time) (int64, error)
+
+	CreateRadioRoom(room *models.RadioRoom) error
+	GetRadioRoom(roomID string) (*models.RadioRoom, error)
+	SetRadioRoomCurrentSong(roomID string, songID uint) error
+	TouchRadioRoom(roomID string) error
+	DeleteInactiveRadioRooms(before time.Time) (int64, error)
+
+	CreateTournamentRoom(room *models.TournamentRoom) error
+	GetTournamentRoom(roomID string) (*models.TournamentRoom, error)
+	UpdateTournamentRoom(room *models.TournamentRoom) error
+	TouchTournamentRoom(roomID string) error
+	DeleteInactiveTournamentRooms(before time.Time) (int64, error)
+
+	// AllowRoomUser puts a user on the allow-list of a room; roomType is one
+	// of the models.RoomType constants
+	AllowRoomUser(roomType, roomID string, userID uint) error
+	IsRoomUserAllowed(roomType, roomID string, userID uint) (bool, error)
+}
+
+// TrashRepository holds deleted songs, artists, units, albums and
+// categories until they are restored or purged. Entity types are the Trash
+// constants.
+type TrashRepository interface {
+	// ListTrash lists what is in the trash, most recently deleted first;
+	// an empty entityType lists every type
+	ListTrash(entityType string) ([]TrashedEntity, error)
+	RestoreFromTrash(entityType string, id uint) error
+	// PurgeFromTrash deletes an entity in the trash for good, with its
+	// relations and, for songs, its votes
+	PurgeFromTrash(entityType string, id uint) error
+	// PurgeTrash purges everything deleted before the cutoff and returns how
+	// many entities it purged
+	PurgeTrash(before time.Time) (int64, error)
+}
+
+// MergeRepository folds duplicate artists, units, albums and songs into one
+type MergeRepository interface {
+	// MergeEntities moves the links, votes and rooms of the duplicates to
+	// the survivor and puts the duplicates in the trash, all in one
+	// transaction. With DryRun it only reports what it would do.
+	MergeEntities(req MergeRequest) (*MergeReport, error)
+}
+
+// APITokenRepository stores personal access tokens for the JSON API
+type APITokenRepository interface {
+	CreateAPIToken(token *models.APIToken) error
+	GetAPITokenByHash(tokenHash string) (*models.APIToken, error)
+	// GetAPITokensByUser lists the tokens of a user, newest first, including
+	// revoked ones
+	GetAPITokensByUser(userID uint) ([]models.APIToken, error)
+	// RevokeAPIToken revokes one of the user's active tokens; other users'
+	// tokens are reported as not found
+	RevokeAPIToken(userID, tokenID uint) error
+	TouchAPIToken(tokenID uint, usedAt time.Time) error
+}
+
+// AdminRepository backs the admin catalog pages. The Set methods replace the
+// links of an entity, skipping IDs of entities that do not exist or are in
+// the trash. Snapshots hold the entity's row and the IDs it links to, in the
+// trash or not, as the audit log keeps them.
+type AdminRepository interface {
+	CountCatalog() (*CatalogCounts, error)
+	GetSongByProvider(provider, providerID string) (*models.Song, error)
+	SetSongLinks(songID uint, artistIDs, unitIDs, albumIDs []uint) error
+	SetArtistUnits(artistID uint, unitIDs []uint) error
+	SetUnitArtists(unitID uint, artistIDs []uint) error
+
+	GetSongSnapshot(songID uint, withVotes bool) (*SongSnapshot, error)
+	GetArtistSnapshot(artistID uint) (*ArtistSnapshot, error)
+	GetUnitSnapshot(unitID uint) (*UnitSnapshot, error)
+	GetAlbumSnapshot(albumID uint) (*AlbumSnapshot, error)
+	// RestoreDeleted undoes the delete of an entity of one of the Trash
+	// types from the snapshot taken before it. An entity still in the trash
+	// just comes out of it. One that was purged is recreated with its ID,
+	// its links to entities that still exist and, for songs, the votes of
+	// users that still exist. It returns the restored snapshot.
+	RestoreDeleted(entityType string, id uint, snapshot json.RawMessage) (any, error)
+}
+
+// AuditRepository stores the audit log
+type AuditRepository interface {
+	RecordAuditEvent(event *models.AuditEvent) error
+	GetAuditEvent(eventID uint) (*models.AuditEvent, error)
+	ListAuditEvents(filter AuditFilter, opts ListOptions) (*Page[models.AuditEvent], error)
+}
+
+// Store is everything the handlers need from persistent storage.
+// *Database is the Postgres implementation; database/memory holds an
+// in-memory one for tests.
+type Store interface {
+	SongRepository
+	ArtistRepository
+	UnitRepository
+	AlbumRepository
+	CategoryRepository
+	TrashRepository
+	MergeRepository
+	VoteRepository
+	StatsRepository
+	RecommendationRepository
+	ChartRepository
+	UserRepository
+	RoomRepository
+	APITokenRepository
+	AuditRepository
+	AdminRepository
+
+	// Transaction runs fn with a store whose changes are kept if fn returns
+	// nil and rolled back if it returns an error
+	Transaction(fn func(tx Store) error) error
+}
+
+var _ Store = (*Database)(nil)
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+// ============= TRASH =============
+
+// Catalog entity types that go to the trash when deleted
+const (
+	TrashSong     = "song"
+	TrashArtist   = "artist"
+	TrashUnit     = "unit"
+	TrashAlbum    = "album"
+	TrashCategory = "category"
+)
+
+// TrashTypes lists the entity types of the trash in the order they are purged
+var TrashTypes = []string{TrashSong, TrashAlbum, TrashArtist, TrashUnit, TrashCategory}
+
+// TrashedEntity is a song, artist, unit, album or category in the trash
+type TrashedEntity struct {
+	EntityType string
+	EntityID   uint
+	Name       string
+	DeletedAt  time.Time
+}
+
+// trashTable is where the rows of a trash entity type live
+type trashTable struct {
+	table      string
+	idColumn   string
+	nameColumn string
+	model      any
+	// links are the join tables and their column pointing at the entity;
+	// purging removes the entity's rows from them
+	links [][2]string
+}
+
+var trashTables = map[string]trashTable{
+	TrashSong: {"songs", "song_id", "name_original", &models.Song{},
+		[][2]string{{"votes", "song_id"}, {"song_artists", "song_id"}, {"song_units", "song_id"}, {"album_songs", "song_id"}}},
+	TrashArtist: {"artists", "artist_id", "name_original", &models.Artist{},
+		[][2]string{{"song_artists", "artist_id"}, {"artist_units", "artist_id"}}},
+	TrashUnit: {"units", "unit_id", "name_original", &models.Unit{},
+		[][2]string{{"song_units", "unit_id"}, {"artist_units", "unit_id"}}},
+	TrashAlbum: {"albums", "album_id", "name_original", &models.Album{},
+		[][2]string{{"album_songs", "album_id"}}},
+	// Songs, artists, units and albums drop the category by ON DELETE SET NULL
+	TrashCategory: {"categories", "category_id", "name", &models.Category{}, nil},
+}
+
+func getTrashTable(entityType string) (trashTable, error) {
+	spec, ok := trashTables[entityType]
+	if !ok {
+		return trashTable{}, fmt.Errorf("%w: %q cannot be in the trash", ErrValidation, entityType)
+	}
+	return spec, nil
+}
+
+func (db *Database) ListTrash(entityType string) ([]TrashedEntity, error) {
+	types := TrashTypes
+	if entityType != "" {
+		if _, err := getTrashTable(entityType); err != nil {
+			return nil, err
+		}
+		types = []string{entityType}
+	}
+
+	trashed := []TrashedEntity{}
+	for _, trashType := range types {
+		spec := trashTables[trashType]
+		var rows []struct {
+			EntityID  uint
+			Name      string
+			DeletedAt time.Time
+		}
+		if err := db.DB.Table(spec.table).
+			Select(spec.idColumn + " AS entity_id, " + spec.nameColumn + " AS name, deleted_at").
+			Where("deleted_at IS NOT NULL").
+			Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to list trashed %s: %w", spec.table, err)
+		}
+		for _, row := range rows {
+			trashed = append(trashed, TrashedEntity{
+				EntityType: trashType,
+				EntityID:   row.EntityID,
+				Name:       row.Name,
+				DeletedAt:  row.DeletedAt,
+			})
+		}
+	}
+
+	sort.SliceStable(trashed, func(i, j int) bool {
+		return trashed[i].DeletedAt.After(trashed[j].DeletedAt)
+	})
+	return trashed, nil
+}
+
+// RestoreTrashed takes an entity out of the trash with tx, so it can be part
+// of a larger transaction. It reports false when the entity is not in the
+// trash. A category cannot come back while a live one has its name.
+func RestoreTrashed(tx *gorm.DB, entityType string, id uint) (bool, error) {
+	spec, err := getTrashTable(entityType)
+	if err != nil {
+		return false, err
+	}
+
+	if entityType == TrashCategory {
+		var taken int64
+		if err := tx.Table("categories AS trashed").
+			Joins("JOIN categories AS live ON live.name = trashed.name AND live.deleted_at IS NULL").
+			Where("trashed.category_id = ?", id).
+			Count(&taken).Error; err != nil {
+			return false, fmt.Errorf("failed to check category name uniqueness: %w", err)
+		}
+		if taken > 0 {
+			return false, fmt.Errorf("%w: another category has the same name", ErrValidation)
+		}
+	}
+
+	result := tx.Unscoped().Model(spec.model).
+		Where(spec.idColumn+" = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", entityType, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (db *Database) RestoreFromTrash(entityType string, id uint) error {
+	restored, err := RestoreTrashed(db.DB, entityType, id)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return fmt.Errorf("failed to restore %s: %w", entityType, ErrNotFound)
+	}
+	return nil
+}
+
+// purgeTrashed deletes an entity in the trash for good, along with its links
+// and, for songs, its votes
+func purgeTrashed(tx *gorm.DB, entityType string, id uint) error {
+	spec, err := getTrashTable(entityType)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := tx.Table(spec.table).Where(spec.idColumn+" = ? AND deleted_at IS NOT NULL", id).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check trashed %s: %w", entityType, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("failed to purge %s: %w", entityType, ErrNotFound)
+	}
+
+	for _, link := range spec.links {
+		if err := tx.Exec("DELETE FROM "+link[0]+" WHERE "+link[1]+" = ?", id).Error; err != nil {
+			return fmt.Errorf("failed to purge %s: %w", link[0], err)
+		}
+	}
+	if err := tx.Unscoped().Where(spec.idColumn+" = ?", id).Delete(spec.model).Error; err != nil {
+		return fmt.Errorf("failed to purge %s: %w", entityType, err)
+	}
+	return nil
+}
+
+func (db *Database) PurgeFromTrash(entityType string, id uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeTrashed(tx, entityType, id)
+	})
+}
+
+// PurgeTrash deletes everything that went to the trash before the cutoff
+func (db *Database) PurgeTrash(before time.Time) (int64, error) {
+	var purged int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, entityType := range TrashTypes {
+			spec := trashTables[entityType]
+			var ids []uint
+			if err := tx.Table(spec.table).Where("deleted_at < ?", before).Pluck(spec.idColumn, &ids).Error; err != nil {
+				return fmt.Errorf("failed to find expired %s: %w", spec.table, err)
+			}
+			for _, id := range ids {
+				if err := purgeTrashed(tx, entityType, id); err != nil {
+					return err
+				}
+				purged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
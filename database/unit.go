@@ -29,7 +29,7 @@ func (db *Database) validateUnit(unit *models.Unit, isUpdate bool) error {
 
 func (db *Database) CreateUnit(unit *models.Unit) error {
 	if err := db.validateUnit(unit, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Create(unit).Error; err != nil {
@@ -50,6 +50,19 @@ func (db *Database) GetUnitByID(unitID uint) (*models.Unit, error) {
 	return &unit, nil
 }
 
+// GetUnitsByIDs returns the units with the given IDs without their relations
+func (db *Database) GetUnitsByIDs(unitIDs []uint) ([]models.Unit, error) {
+	var units []models.Unit
+	if len(unitIDs) == 0 {
+		return units, nil
+	}
+
+	if err := db.DB.Where("unit_id IN ?", unitIDs).Find(&units).Error; err != nil {
+		return nil, fmt.Errorf("failed to get units by IDs: %w", err)
+	}
+	return units, nil
+}
+
 func (db *Database) GetUnitsByName(name string) ([]models.Unit, error) {
 	if strings.TrimSpace(name) == "" {
 		return nil, errors.New("name cannot be empty")
@@ -95,6 +108,31 @@ func (db *Database) GetAllUnits() ([]models.Unit, error) {
 	return units, nil
 }
 
+func (db *Database) ListUnits(filter UnitFilter, opts ListOptions) (*Page[models.Unit], error) {
+	opts, cursor, err := PrepareList(opts, UnitListing)
+	if err != nil {
+		return nil, err
+	}
+
+	query := preloadIncludes(db.DB.Model(&models.Unit{}), opts.Include)
+	if filter.CategoryID != nil {
+		query = query.Where("units.category_id = ?", *filter.CategoryID)
+	}
+	if filter.ArtistID != nil {
+		query = query.Where("units.unit_id IN (?)",
+			db.DB.Table("artist_units").Select("unit_id").Where("artist_id = ?", *filter.ArtistID))
+	}
+	query = applyKeyset(query, namedSortColumn("units", opts.Sort), "units.unit_id", opts, cursor)
+
+	var units []models.Unit
+	if err := query.Find(&units).Error; err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+	return NewPage(units, opts, func(unit models.Unit) (any, uint) {
+		return NamedSortValue(opts.Sort, unit.NameOriginal, unit.CreatedAt), unit.UnitID
+	}), nil
+}
+
 func (db *Database) UpdateUnit(unit *models.Unit) error {
 	if unit == nil {
 		return errors.New("unit cannot be nil")
@@ -114,7 +152,7 @@ func (db *Database) UpdateUnit(unit *models.Unit) error {
 
 	// Validate the updated unit data
 	if err := db.validateUnit(unit, true); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Save(unit).Error; err != nil {
@@ -137,15 +175,6 @@ func (db *Database) DeleteUnit(unitID uint) error {
 		return errors.New("unit does not exist")
 	}
 
-	// Check if unit has songs associated with it via SongUnit join table
-	var songCount int64
-	if err := db.DB.Model(&models.SongUnit{}).Where("unit_id = ?", unitID).Count(&songCount).Error; err != nil {
-		return fmt.Errorf("failed to check unit song relationships: %w", err)
-	}
-	if songCount > 0 {
-		return fmt.Errorf("cannot delete unit: %d songs are still associated with this unit", songCount)
-	}
-
 	if err := db.DB.Delete(&models.Unit{}, unitID).Error; err != nil {
 		return fmt.Errorf("failed to delete unit: %w", err)
 	}
@@ -21,6 +21,14 @@ func (db *Database) validateUser(user *models.User, isUpdate bool) error {
 		return errors.New("username cannot exceed 50 characters")
 	}
 
+	// New accounts are members unless given another role
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	if !models.ValidRole(user.Role) {
+		return fmt.Errorf("unknown role %q", user.Role)
+	}
+
 	// Check username uniqueness (skip if updating and username hasn't changed)
 	if !isUpdate {
 		exists, err := db.UsernameExists(user.Username)
@@ -37,7 +45,7 @@ func (db *Database) validateUser(user *models.User, isUpdate bool) error {
 
 func (db *Database) CreateUser(user *models.User) error {
 	if err := db.validateUser(user, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Create(user).Error; err != nil {
@@ -52,7 +60,7 @@ func (db *Database) GetUserByID(userID uint) (*models.User, error) {
 	}
 
 	var user models.User
-	if err := db.DB.Preload("Votes").First(&user, userID).Error; err != nil {
+	if err := db.DB.First(&user, userID).Error; err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	return &user, nil
@@ -64,21 +72,33 @@ func (db *Database) GetUserByUsername(username string) (*models.User, error) {
 	}
 
 	var user models.User
-	if err := db.DB.Preload("Votes").Where("username = ?", username).First(&user).Error; err != nil {
+	if err := db.DB.Where("username = ?", username).First(&user).Error; err != nil {
 		return nil, fmt.Errorf("failed to get user by username: %w", err)
 	}
 	return &user, nil
 }
 
-
 func (db *Database) GetAllUsers() ([]models.User, error) {
 	var users []models.User
-	if err := db.DB.Preload("Votes").Find(&users).Error; err != nil {
+	if err := db.DB.Find(&users).Error; err != nil {
 		return nil, fmt.Errorf("failed to get all users: %w", err)
 	}
 	return users, nil
 }
 
+func (db *Database) SearchUsers(query string) ([]models.User, error) {
+	if strings.TrimSpace(query) == "" {
+		return db.GetAllUsers()
+	}
+
+	var users []models.User
+	searchPattern := "%" + query + "%"
+	if err := db.DB.Where("username ILIKE ?", searchPattern).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return users, nil
+}
+
 func (db *Database) UpdateUser(user *models.User) error {
 	if user == nil {
 		return errors.New("user cannot be nil")
@@ -116,7 +136,7 @@ func (db *Database) UpdateUser(user *models.User) error {
 
 	// Validate the updated user data
 	if err := db.validateUser(user, true); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	if err := db.DB.Save(user).Error; err != nil {
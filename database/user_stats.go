@@ -0,0 +1,167 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
+)
+
+// ============= USER STATS =============
+
+// DivergentSongLimit is how many songs UserStats lists where the user
+// differs most from everyone else
+const DivergentSongLimit = 10
+
+// RatingCount is how often a user gave a rating
+type RatingCount struct {
+	Rating int   `json:"rating"`
+	Count  int64 `json:"count"`
+}
+
+// GroupRating is the average rating a user gave the songs of a category,
+// artist or unit
+type GroupRating struct {
+	ID            uint    `json:"id"`
+	Name          string  `json:"name"`
+	AverageRating float64 `json:"average_rating"`
+	VoteCount     int64   `json:"vote_count"`
+}
+
+// DivergentRating is a song the user rated away from everyone else
+type DivergentRating struct {
+	SongID           uint    `json:"song_id"`
+	NameOriginal     string  `json:"name_original"`
+	NameEnglish      string  `json:"name_english"`
+	Rating           int     `json:"rating"`
+	CommunityAverage float64 `json:"community_average"` // Average of the other users' votes
+	CommunityVotes   int64   `json:"community_votes"`
+	Difference       float64 `json:"difference"` // Rating minus CommunityAverage
+}
+
+// ActivityPeriod is how much a user rated in one month
+type ActivityPeriod struct {
+	Month         string  `json:"month"` // YYYY-MM
+	VoteCount     int64   `json:"vote_count"`
+	AverageRating float64 `json:"average_rating"`
+}
+
+// UserStats is the taste profile of a user, aggregated from their votes.
+// Songs in the trash are left out.
+type UserStats struct {
+	UserID        uint    `json:"user_id"`
+	VoteCount     int64   `json:"vote_count"`
+	AverageRating float64 `json:"average_rating"`
+	SongCount     int64   `json:"song_count"` // Songs in the catalog
+	Coverage      float64 `json:"coverage"`   // Share of the catalog rated, 0 to 1
+
+	Distribution []RatingCount     `json:"distribution"` // Every rating from 1 to 10
+	Categories   []GroupRating     `json:"categories"`   // Best rated first
+	Artists      []GroupRating     `json:"artists"`
+	Units        []GroupRating     `json:"units"`
+	Divergent    []DivergentRating `json:"divergent"` // Largest difference first
+	Activity     []ActivityPeriod  `json:"activity"`  // Oldest month first
+}
+
+// FillDistribution turns rating counts into one entry for every rating from
+// 1 to 10
+func FillDistribution(counts map[int]int64) []RatingCount {
+	distribution := make([]RatingCount, 0, 10)
+	for rating := 1; rating <= 10; rating++ {
+		distribution = append(distribution, RatingCount{Rating: rating, Count: counts[rating]})
+	}
+	return distribution
+}
+
+// GetUserStats aggregates the votes of a user into their taste profile
+func (db *Database) GetUserStats(userID uint) (*UserStats, error) {
+	if _, err := db.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	stats := &UserStats{UserID: userID}
+
+	// Votes on songs in the trash do not count
+	userVotes := func() *gorm.DB {
+		return db.DB.Table("votes").
+			Joins("JOIN songs ON songs.song_id = votes.song_id AND songs.deleted_at IS NULL").
+			Where("votes.user_id = ?", userID)
+	}
+
+	var totals struct {
+		VoteCount     int64
+		AverageRating *float64
+	}
+	if err := userVotes().Select("COUNT(*) AS vote_count, AVG(votes.rating)::float8 AS average_rating").
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to count votes: %w", err)
+	}
+	stats.VoteCount = totals.VoteCount
+	if totals.AverageRating != nil {
+		stats.AverageRating = *totals.AverageRating
+	}
+
+	if err := db.DB.Model(&models.Song{}).Count(&stats.SongCount).Error; err != nil {
+		return nil, fmt.Errorf("failed to count songs: %w", err)
+	}
+	if stats.SongCount > 0 {
+		stats.Coverage = float64(stats.VoteCount) / float64(stats.SongCount)
+	}
+
+	var ratings []RatingCount
+	if err := userVotes().Select("votes.rating, COUNT(*) AS count").
+		Group("votes.rating").Scan(&ratings).Error; err != nil {
+		return nil, fmt.Errorf("failed to count ratings: %w", err)
+	}
+	counts := make(map[int]int64, len(ratings))
+	for _, rating := range ratings {
+		counts[rating.Rating] = rating.Count
+	}
+	stats.Distribution = FillDistribution(counts)
+
+	groupSelect := "AVG(votes.rating)::float8 AS average_rating, COUNT(*) AS vote_count"
+	groupOrder := "average_rating DESC, vote_count DESC, id"
+	if err := userVotes().Select("categories.category_id AS id, categories.name AS name, " + groupSelect).
+		Joins("JOIN categories ON categories.category_id = songs.category_id AND categories.deleted_at IS NULL").
+		Group("categories.category_id, categories.name").Order(groupOrder).
+		Scan(&stats.Categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to average categories: %w", err)
+	}
+	if err := userVotes().Select("artists.artist_id AS id, artists.name_original AS name, " + groupSelect).
+		Joins("JOIN song_artists ON song_artists.song_id = votes.song_id").
+		Joins("JOIN artists ON artists.artist_id = song_artists.artist_id AND artists.deleted_at IS NULL").
+		Group("artists.artist_id, artists.name_original").Order(groupOrder).
+		Scan(&stats.Artists).Error; err != nil {
+		return nil, fmt.Errorf("failed to average artists: %w", err)
+	}
+	if err := userVotes().Select("units.unit_id AS id, units.name_original AS name, " + groupSelect).
+		Joins("JOIN song_units ON song_units.song_id = votes.song_id").
+		Joins("JOIN units ON units.unit_id = song_units.unit_id AND units.deleted_at IS NULL").
+		Group("units.unit_id, units.name_original").Order(groupOrder).
+		Scan(&stats.Units).Error; err != nil {
+		return nil, fmt.Errorf("failed to average units: %w", err)
+	}
+
+	others := db.DB.Table("votes").
+		Select("song_id, AVG(rating)::float8 AS average_rating, COUNT(*) AS vote_count").
+		Where("user_id <> ?", userID).
+		Group("song_id")
+	if err := userVotes().
+		Select("votes.song_id, songs.name_original, songs.name_english, votes.rating, "+
+			"others.average_rating AS community_average, others.vote_count AS community_votes, "+
+			"votes.rating - others.average_rating AS difference").
+		Joins("JOIN (?) AS others ON others.song_id = votes.song_id", others).
+		Order("ABS(votes.rating - others.average_rating) DESC, votes.song_id").
+		Limit(DivergentSongLimit).
+		Scan(&stats.Divergent).Error; err != nil {
+		return nil, fmt.Errorf("failed to compare ratings: %w", err)
+	}
+
+	if err := userVotes().
+		Select("to_char(date_trunc('month', votes.created_at), 'YYYY-MM') AS month, " +
+			"COUNT(*) AS vote_count, AVG(votes.rating)::float8 AS average_rating").
+		Group("month").Order("month").
+		Scan(&stats.Activity).Error; err != nil {
+		return nil, fmt.Errorf("failed to load rating activity: %w", err)
+	}
+	return stats, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/CptPie/SyncRate/models"
+	"gorm.io/gorm"
 )
 
 func (db *Database) validateVote(vote *models.Vote, isUpdate bool) error {
@@ -50,7 +51,7 @@ func (db *Database) validateVote(vote *models.Vote, isUpdate bool) error {
 
 func (db *Database) CreateVote(vote *models.Vote) error {
 	if err := db.validateVote(vote, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	// Check if vote already exists (since it's a composite primary key)
@@ -77,13 +78,86 @@ func (db *Database) GetVote(userID, songID uint) (*models.Vote, error) {
 	}
 
 	var vote models.Vote
-	if err := db.DB.Preload("User").Preload("Song").
-		Where("user_id = ? AND song_id = ?", userID, songID).First(&vote).Error; err != nil {
+	if err := db.DB.Where("user_id = ? AND song_id = ?", userID, songID).First(&vote).Error; err != nil {
 		return nil, fmt.Errorf("failed to get vote: %w", err)
 	}
 	return &vote, nil
 }
 
+func (db *Database) GetVoteByID(voteID uint) (*models.Vote, error) {
+	if voteID == 0 {
+		return nil, errors.New("vote ID cannot be zero")
+	}
+
+	var vote models.Vote
+	if err := db.DB.First(&vote, voteID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vote: %w", err)
+	}
+	return &vote, nil
+}
+
+// applyVoteFilter restricts a votes query to the users, songs and ratings in
+// the filter. Votes on songs in the trash are left out.
+func applyVoteFilter(query *gorm.DB, filter VoteFilter) *gorm.DB {
+	query = query.Where("votes.song_id NOT IN (SELECT song_id FROM songs WHERE deleted_at IS NOT NULL)")
+	if filter.UserIDs != nil {
+		query = query.Where("votes.user_id IN ?", filter.UserIDs)
+	}
+	if filter.SongIDs != nil {
+		query = query.Where("votes.song_id IN ?", filter.SongIDs)
+	}
+	if filter.MinRating != nil {
+		query = query.Where("votes.rating >= ?", *filter.MinRating)
+	}
+	if filter.MaxRating != nil {
+		query = query.Where("votes.rating <= ?", *filter.MaxRating)
+	}
+	return query
+}
+
+func (db *Database) GetVotes(filter VoteFilter) ([]models.Vote, error) {
+	var votes []models.Vote
+	if err := applyVoteFilter(db.DB, filter).Find(&votes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get votes: %w", err)
+	}
+	return votes, nil
+}
+
+// voteSortColumns are what ListVotes orders by for each sort key
+var voteSortColumns = map[string]string{
+	"created": "votes.created_at",
+	"rating":  "votes.rating",
+}
+
+func (db *Database) ListVotes(filter VoteFilter, opts ListOptions) (*Page[models.Vote], error) {
+	opts, cursor, err := PrepareList(opts, VoteListing)
+	if err != nil {
+		return nil, err
+	}
+
+	query := applyVoteFilter(db.DB.Model(&models.Vote{}), filter)
+	query = applyKeyset(query, voteSortColumns[opts.Sort], "votes.vote_id", opts, cursor)
+
+	var votes []models.Vote
+	if err := query.Find(&votes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list votes: %w", err)
+	}
+	return NewPage(votes, opts, func(vote models.Vote) (any, uint) {
+		return VoteSortValue(vote, opts.Sort), vote.VoteID
+	}), nil
+}
+
+func (db *Database) GetVotesWithUsers(filter VoteFilter) ([]VoteWithUser, error) {
+	var votes []VoteWithUser
+	query := db.DB.Table("votes").
+		Select("votes.*, users.username, users.is_guest").
+		Joins("LEFT JOIN users ON votes.user_id = users.user_id")
+	if err := applyVoteFilter(query, filter).Find(&votes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get votes with users: %w", err)
+	}
+	return votes, nil
+}
+
 func (db *Database) GetVotesByUser(userID uint) ([]models.Vote, error) {
 	if userID == 0 {
 		return nil, errors.New("user ID cannot be zero")
@@ -99,8 +173,7 @@ func (db *Database) GetVotesByUser(userID uint) ([]models.Vote, error) {
 	}
 
 	var votes []models.Vote
-	if err := db.DB.Preload("User").Preload("Song").
-		Where("user_id = ?", userID).Find(&votes).Error; err != nil {
+	if err := applyVoteFilter(db.DB, VoteFilter{UserIDs: []uint{userID}}).Find(&votes).Error; err != nil {
 		return nil, fmt.Errorf("failed to get votes by user: %w", err)
 	}
 	return votes, nil
@@ -121,8 +194,7 @@ func (db *Database) GetVotesBySong(songID uint) ([]models.Vote, error) {
 	}
 
 	var votes []models.Vote
-	if err := db.DB.Preload("User").Preload("Song").
-		Where("song_id = ?", songID).Find(&votes).Error; err != nil {
+	if err := db.DB.Where("song_id = ?", songID).Find(&votes).Error; err != nil {
 		return nil, fmt.Errorf("failed to get votes by song: %w", err)
 	}
 	return votes, nil
@@ -134,8 +206,7 @@ func (db *Database) GetVotesByRating(rating int) ([]models.Vote, error) {
 	}
 
 	var votes []models.Vote
-	if err := db.DB.Preload("User").Preload("Song").
-		Where("rating = ?", rating).Find(&votes).Error; err != nil {
+	if err := db.DB.Where("rating = ?", rating).Find(&votes).Error; err != nil {
 		return nil, fmt.Errorf("failed to get votes by rating: %w", err)
 	}
 	return votes, nil
@@ -143,7 +214,7 @@ func (db *Database) GetVotesByRating(rating int) ([]models.Vote, error) {
 
 func (db *Database) GetAllVotes() ([]models.Vote, error) {
 	var votes []models.Vote
-	if err := db.DB.Preload("User").Preload("Song").Find(&votes).Error; err != nil {
+	if err := db.DB.Find(&votes).Error; err != nil {
 		return nil, fmt.Errorf("failed to get all votes: %w", err)
 	}
 	return votes, nil
@@ -156,7 +227,7 @@ func (db *Database) UpdateVote(vote *models.Vote) error {
 
 	// Validate the vote
 	if err := db.validateVote(vote, true); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	// Check if vote exists
@@ -261,22 +332,57 @@ func (db *Database) GetVoteCountForSong(songID uint) (int64, error) {
 	return count, nil
 }
 
+// GetSongStats aggregates the votes of the given songs, or of all songs when
+// songIDs is nil
+func (db *Database) GetSongStats(songIDs []uint) (map[uint]SongStats, error) {
+	stats := make(map[uint]SongStats)
+	if songIDs != nil && len(songIDs) == 0 {
+		return stats, nil
+	}
+
+	query := db.songStatsQuery()
+	if songIDs != nil {
+		query = query.Where("song_id IN ?", songIDs)
+	}
+	var rows []struct {
+		SongID uint
+		SongStats
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get song stats: %w", err)
+	}
+	for _, row := range rows {
+		stats[row.SongID] = row.SongStats
+	}
+	return stats, nil
+}
+
 func (db *Database) UpsertVote(vote *models.Vote) error {
 	if err := db.validateVote(vote, false); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return fmt.Errorf("%w: %w", ErrValidation, err)
 	}
 
 	// Check if vote exists
-	exists, err := db.VoteExists(vote.UserID, vote.SongID)
-	if err != nil {
-		return fmt.Errorf("failed to check if vote exists: %w", err)
+	var existing models.Vote
+	result := db.DB.Where("user_id = ? AND song_id = ?", vote.UserID, vote.SongID).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return fmt.Errorf("failed to check if vote exists: %w", result.Error)
 	}
 
-	if exists {
-		// Update existing vote
-		return db.UpdateVote(vote)
-	} else {
+	if result.RowsAffected == 0 {
 		// Create new vote
-		return db.CreateVote(vote)
+		if err := db.DB.Create(vote).Error; err != nil {
+			return fmt.Errorf("failed to create vote: %w", err)
+		}
+		return nil
+	}
+
+	// Update existing vote
+	existing.Rating = vote.Rating
+	existing.Comment = vote.Comment
+	if err := db.DB.Save(&existing).Error; err != nil {
+		return fmt.Errorf("failed to update vote: %w", err)
 	}
-}
\ No newline at end of file
+	*vote = existing
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/server/importer"
+)
+
+const importUsage = "usage: syncrate import [-dry-run] [-update] [-format csv|json] [-json] FILE"
+
+// runImport handles the "import" subcommand
+func runImport(db *database.Database, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without saving anything")
+	update := flags.Bool("update", false, "update existing songs that differ instead of reporting conflicts")
+	format := flags.String("format", "", "file format, csv or json (default: from the file extension)")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+	path := flags.Arg(0)
+
+	fileFormat := importer.Format(strings.ToLower(*format))
+	if fileFormat == "" {
+		var err error
+		if fileFormat, err = importer.FormatFromFilename(path); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	records, err := importer.Parse(file, fileFormat)
+	if err != nil {
+		return err
+	}
+	report, err := importer.Import(db, records, importer.Options{DryRun: *dryRun, Update: *update})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	printImportReport(os.Stdout, report)
+	if !report.DryRun && !report.Committed {
+		return errors.New("import rolled back because of errors")
+	}
+	return nil
+}
+
+func printImportReport(out io.Writer, report *importer.Report) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ROW\tACTION\tSONG\tNAME\tDETAILS")
+	for _, row := range report.Rows {
+		var details []string
+		if len(row.Changes) > 0 {
+			details = append(details, "changes: "+strings.Join(row.Changes, ", "))
+		}
+		if len(row.Created) > 0 {
+			details = append(details, "creates: "+strings.Join(row.Created, ", "))
+		}
+		if row.Message != "" {
+			details = append(details, row.Message)
+		}
+		songID := "-"
+		if row.SongID != 0 {
+			songID = fmt.Sprint(row.SongID)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", row.Row, row.Action, songID, row.Name, strings.Join(details, "; "))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n%d create, %d update, %d unchanged, %d conflict, %d error\n",
+		report.Counts[importer.ActionCreate], report.Counts[importer.ActionUpdate],
+		report.Counts[importer.ActionUnchanged], report.Counts[importer.ActionConflict],
+		report.Counts[importer.ActionError])
+	switch {
+	case report.DryRun:
+		fmt.Fprintln(out, "Dry run: nothing was saved")
+	case report.Committed:
+		fmt.Fprintln(out, "Import saved")
+	default:
+		fmt.Fprintln(out, "Nothing was saved; fix the rows with errors and run the import again")
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/server/backup"
 	"github.com/CptPie/SyncRate/server/handlers"
 	"github.com/CptPie/SyncRate/server/router"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/CptPie/SyncRate/server/websocket/pgbackend"
 )
 
 func main() {
@@ -26,25 +34,159 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	// Subcommands: syncrate migrate status|up|down|to N, syncrate import FILE,
+	// syncrate export FILE, syncrate restore FILE
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := runMigrate(db, os.Args[2:]); err != nil {
+				log.Fatal(err.Error())
+			}
+			return
+		case "import":
+			if err := runImport(db, os.Args[2:]); err != nil {
+				log.Fatal(err.Error())
+			}
+			return
+		case "export":
+			if err := runExport(db, os.Args[2:]); err != nil {
+				log.Fatal(err.Error())
+			}
+			return
+		case "restore":
+			if err := runRestore(db, os.Args[2:]); err != nil {
+				log.Fatal(err.Error())
+			}
+			return
+		default:
+			log.Fatalf("unknown command %q (available: migrate, import, export, restore)", os.Args[1])
+		}
+	}
+
 	err = db.Migrate()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
+	// ADMIN_USERNAME is made admin if the account exists. The first account
+	// to register on a site without admin becomes admin too.
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		if err := handlers.SetBootstrapAdmin(db, username); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	// Room state backend: in-process by default, Postgres to share rooms
+	// between instances and keep them across restarts
+	switch backend := os.Getenv("ROOM_BACKEND"); backend {
+	case "", "memory":
+		log.Println("Using in-process room state")
+	case "postgres":
+		broadcaster := pgbackend.NewBroadcaster(db.DB, db.DSN())
+		if err := broadcaster.Start(context.Background()); err != nil {
+			log.Fatal(err.Error())
+		}
+		handlers.UseRoomBackend(func(topic string) wsocket.RoomStore {
+			return pgbackend.NewRoomStore(db.DB, topic)
+		}, broadcaster)
+		log.Println("Using Postgres room state with LISTEN/NOTIFY fan-out")
+	default:
+		log.Fatalf("unknown ROOM_BACKEND %q (available: memory, postgres)", backend)
+	}
+
+	// Invite links must verify on every instance and after restarts
+	if secret := os.Getenv("INVITE_SECRET"); secret != "" {
+		handlers.SetInviteSecret([]byte(secret))
+	} else {
+		log.Println("INVITE_SECRET is not set; room invite links stop working on restart")
+	}
+
 	// Start background cleanup for old rating rooms
-	handlers.StartDatabaseCleanup(db.DB)
+	handlers.StartDatabaseCleanup(db)
 	log.Println("Started database cleanup routine for rating rooms")
 
 	// Start background cleanup for old radio rooms
-	handlers.StartRadioRoomDatabaseCleanup(db.DB)
+	handlers.StartRadioRoomDatabaseCleanup(db)
 	log.Println("Started database cleanup routine for radio rooms")
 
+	// Keep radio room players in sync and move on when songs end
+	handlers.StartRadioPlaybackClock(db)
+	log.Println("Started playback clock for radio rooms")
+
 	// Start background cleanup for old tournament rooms
-	handlers.StartTournamentDatabaseCleanup(db.DB)
+	handlers.StartTournamentDatabaseCleanup(db)
 	log.Println("Started database cleanup routine for tournament rooms")
 
+	// Purge the trash of catalog entities deleted more than
+	// TRASH_RETENTION_DAYS ago; 0 keeps them until purged by hand
+	trashRetention := handlers.DefaultTrashRetention
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid TRASH_RETENTION_DAYS %q", days)
+		}
+		trashRetention = time.Duration(n) * 24 * time.Hour
+	}
+	handlers.StartTrashPurge(db, trashRetention)
+	log.Printf("Trash retention is %v", trashRetention)
+
+	// Recompute the recommender's song similarities every
+	// RECOMMENDATION_REFRESH_MINUTES
+	recommendationRefresh := handlers.DefaultRecommendationRefresh
+	if minutes := os.Getenv("RECOMMENDATION_REFRESH_MINUTES"); minutes != "" {
+		n, err := strconv.Atoi(minutes)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid RECOMMENDATION_REFRESH_MINUTES %q", minutes)
+		}
+		recommendationRefresh = time.Duration(n) * time.Minute
+	}
+	handlers.StartRecommendationRefresh(db, recommendationRefresh)
+	log.Printf("Started recommendation refresh every %v", recommendationRefresh)
+
+	// Recompute the charts every CHART_REFRESH_MINUTES. CHART_SCORING picks
+	// bayesian or wilson scores, CHART_PRIOR_VOTES and CHART_MIN_VOTES tune
+	// how far few votes count, CHART_RISING_DAYS is how far back rising looks.
+	chartRefresh := handlers.DefaultChartRefresh
+	if minutes := os.Getenv("CHART_REFRESH_MINUTES"); minutes != "" {
+		n, err := strconv.Atoi(minutes)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CHART_REFRESH_MINUTES %q", minutes)
+		}
+		chartRefresh = time.Duration(n) * time.Minute
+	}
+	chartOptions := database.DefaultChartOptions
+	if scoring := os.Getenv("CHART_SCORING"); scoring != "" {
+		if !slices.Contains(database.ChartScorings, scoring) {
+			log.Fatalf("unknown CHART_SCORING %q (available: %s)", scoring, strings.Join(database.ChartScorings, ", "))
+		}
+		chartOptions.Scoring = scoring
+	}
+	if votes := os.Getenv("CHART_PRIOR_VOTES"); votes != "" {
+		n, err := strconv.ParseFloat(votes, 64)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid CHART_PRIOR_VOTES %q", votes)
+		}
+		chartOptions.PriorVotes = n
+	}
+	if votes := os.Getenv("CHART_MIN_VOTES"); votes != "" {
+		n, err := strconv.Atoi(votes)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid CHART_MIN_VOTES %q", votes)
+		}
+		chartOptions.MinVotes = n
+	}
+	if days := os.Getenv("CHART_RISING_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CHART_RISING_DAYS %q", days)
+		}
+		chartOptions.RisingWindow = time.Duration(n) * 24 * time.Hour
+	}
+	handlers.StartChartRefresh(db, chartOptions, chartRefresh)
+	log.Printf("Started %s chart refresh every %v", chartOptions.Scoring, chartRefresh)
+
 	// Start web server
-	r := router.SetupRouter(db.DB)
+	r := router.SetupRouter(db, backup.DBExporter{DB: backup.SQLDatabase{DB: db.DB}})
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/CptPie/SyncRate/database"
+)
+
+const migrateUsage = "usage: syncrate migrate status|up|down|to N"
+
+// runMigrate handles the "migrate" subcommand
+func runMigrate(db *database.Database, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		current, err := migrator.Current()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Schema version: %d (latest available: %d)\n", current, migrator.Latest())
+		for _, status := range statuses {
+			if status.Applied {
+				fmt.Printf("  [x] %04d_%s (applied %s)\n", status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("  [ ] %04d_%s\n", status.Version, status.Name)
+			}
+		}
+		return nil
+
+	case "up":
+		return migrator.Up()
+
+	case "down":
+		return migrator.Down()
+
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[1], err)
+		}
+		return migrator.To(version)
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+}
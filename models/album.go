@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Album struct {
 	AlbumID      uint   `gorm:"primaryKey"`
@@ -14,5 +18,5 @@ type Album struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"` // Set while the album is in the trash
 }
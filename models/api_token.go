@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Scopes of API tokens. Read covers every GET endpoint of the JSON API.
+const (
+	ScopeRead         = "read"
+	ScopeVotesWrite   = "votes:write"
+	ScopeCatalogWrite = "catalog:write"
+	ScopeUsersWrite   = "users:write"
+)
+
+// AllScopes lists every scope a token can have
+var AllScopes = []string{ScopeRead, ScopeVotesWrite, ScopeCatalogWrite, ScopeUsersWrite}
+
+// APIToken is a personal access token for the JSON API. Only the SHA-256
+// hash of the token is stored; the token itself is shown once on creation.
+type APIToken struct {
+	TokenID    uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"size:100;not null"`
+	Prefix     string `gorm:"size:16;not null"` // Start of the token, to tell tokens apart
+	TokenHash  string `gorm:"size:64;uniqueIndex;not null"`
+	Scopes     string `gorm:"not null"` // Space separated, see AllScopes
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time // nil for tokens that do not expire
+	RevokedAt  *time.Time
+
+	CreatedAt time.Time
+}
+
+// ScopeList returns the scopes of the token
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// Active reports whether the token can still be used at the given time
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
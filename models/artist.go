@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Artist struct {
 	ArtistID       uint   `gorm:"primaryKey"`
@@ -15,7 +19,7 @@ type Artist struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"` // Set while the artist is in the trash
 }
 
 func (a *Artist) GetNameOriginal() string {
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions. Room moderation events use the moderation message type,
+// e.g. "kick_user", as their action.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge" // Deleted for good from the trash
+	AuditMerge   = "merge" // Duplicates folded into the entity
+	AuditImport  = "import"
+)
+
+// AuditEvent records a change to the catalog, users or rooms: who made it
+// and how the entity looked before and after. Deletes keep the full entity,
+// so it can be restored from the log.
+type AuditEvent struct {
+	EventID    uint            `gorm:"primaryKey"`
+	ActorID    *uint           `gorm:"index"`   // nil when the actor's account is gone
+	ActorName  string          `gorm:"size:50"` // Username at the time of the change
+	Action     string          `gorm:"size:32;not null;index"`
+	EntityType string          `gorm:"size:32;not null"`
+	EntityID   string          `gorm:"size:64;not null"` // Numeric ID, or room ID for rooms
+	Before     json.RawMessage `gorm:"serializer:json"`  // nil for creates
+	After      json.RawMessage `gorm:"serializer:json"`  // nil for deletes
+
+	CreatedAt time.Time `gorm:"index"`
+}
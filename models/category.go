@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Category struct {
 	CategoryID uint   `gorm:"primaryKey"`
@@ -8,5 +12,5 @@ type Category struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"` // Set while the category is in the trash
 }
\ No newline at end of file
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Charts songs are ranked in
+const (
+	ChartTop      = "top"      // Best rated, with few votes pulled towards the average
+	ChartDivisive = "divisive" // Largest spread of ratings
+	ChartRising   = "rising"   // Most and best votes lately
+)
+
+// Charts lists every chart; the first is the default
+var Charts = []string{ChartTop, ChartDivisive, ChartRising}
+
+// Scopes a chart is kept for
+const (
+	ChartScopeOverall  = "overall"  // All songs, ScopeID is 0
+	ChartScopeCategory = "category" // Songs of a category
+	ChartScopeArtist   = "artist"   // Songs of an artist
+	ChartScopeUnit     = "unit"     // Songs of a unit
+	ChartScopeAlbum    = "album"    // Songs on an album
+	ChartScopeYear     = "year"     // Votes cast in a year, ScopeID is the year
+)
+
+// ChartScopes lists every chart scope; the first is the default
+var ChartScopes = []string{ChartScopeOverall, ChartScopeCategory, ChartScopeArtist, ChartScopeUnit, ChartScopeAlbum, ChartScopeYear}
+
+// ChartEntry is one place in a chart. The charts are recomputed from the
+// votes periodically and replaced as a whole.
+type ChartEntry struct {
+	Chart         string    `gorm:"size:16;primaryKey"`
+	Scope         string    `gorm:"size:16;primaryKey"`
+	ScopeID       uint      `gorm:"primaryKey;autoIncrement:false"`
+	Rank          int       `gorm:"primaryKey;autoIncrement:false"` // From 1
+	SongID        uint      `gorm:"not null;index"`
+	Score         float64   `gorm:"not null"` // What the chart ranks by
+	AverageRating float64   `gorm:"not null"`
+	VoteCount     int64     `gorm:"not null"` // Votes in the scope, for year charts cast that year
+	RefreshedAt   time.Time `gorm:"not null"`
+}
@@ -9,6 +9,11 @@ type RadioRoom struct {
 	CategoryID     *uint     `gorm:"index"`
 	IncludeCovers  bool      `gorm:"default:false"`
 	MinRating      *int      `gorm:"default:null"` // Null means no rating filter
+	PasswordHash   string    `json:"-"`                // Empty means no password
+	InviteOnly     bool      `gorm:"default:false"` // Only users on the allow-list may join
+	AllowGuests    bool      `gorm:"default:false"` // Guests may join without an account
+	SkipThreshold  float64   `gorm:"default:0.5"`   // Share of listeners that must vote to skip a song
+	SongSelection  string    `gorm:"size:16;default:random"` // How the next song is picked, see SongSelections
 	CreatedAt      time.Time
 	LastActive     time.Time `gorm:"index"`
 
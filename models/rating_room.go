@@ -10,6 +10,13 @@ type RatingRoom struct {
 	CoversOnly       bool      `gorm:"default:false"`
 	VideoSyncEnabled *bool     `gorm:"default:true"`
 	UnvotedSongsOnly *bool     `gorm:"default:true"`
+	PasswordHash     string    `json:"-"`                // Empty means no password
+	InviteOnly       bool      `gorm:"default:false"` // Only users on the allow-list may join
+	AllowGuests       bool      `gorm:"default:false"` // Guests may join without an account
+	PersistGuestVotes bool      `gorm:"default:false"` // Save guest ratings to votes, not just show them
+	SongSelection     string    `gorm:"size:16;default:random"` // How the next song is picked, see handlers.SongSelector
+	RepeatWindow      int       `gorm:"default:0"`              // Artists of this many last songs are not picked again while others are left
+	RecentSongIDs     []uint    `gorm:"serializer:json"`        // Last songs played, newest first, see database.RatingRoomHistory
 	CreatedAt       time.Time
 	LastActive      time.Time `gorm:"index"`
 
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Kinds of room, as used by RoomAllowedUser.RoomType
+const (
+	RoomTypeRating     = "rating"
+	RoomTypeRadio      = "radio"
+	RoomTypeTournament = "tournament"
+)
+
+// RoomAllowedUser lets a user into a password-protected or invite-only
+// room. Users are added when they enter the password or redeem an invite.
+type RoomAllowedUser struct {
+	RoomType  string `gorm:"primaryKey;size:16"`
+	RoomID    string `gorm:"primaryKey;size:8"`
+	UserID    uint   `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
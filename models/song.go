@@ -1,13 +1,20 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Song struct {
 	SongID       uint   `gorm:"primaryKey"`
 	NameOriginal string `gorm:"size:255;not null"`
 	NameEnglish  string `gorm:"size:255"`
 	SourceURL    string `gorm:"not null"`
+	Provider     string `gorm:"size:32;index"` // Media provider playing SourceURL, see utils.MediaProvider
+	ProviderID   string                        // The provider's ID for the media
 	ThumbnailURL string `gorm:"not null"`
+	Duration     int    // Length in seconds, 0 if unknown
 	CategoryID   *uint
 	Category     *Category    `gorm:"foreignKey:CategoryID;references:CategoryID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
 	IsCover      bool
@@ -18,5 +25,5 @@ type Song struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"` // Set while the song is in the trash
 }
@@ -0,0 +1,29 @@
+package models
+
+// Song selection modes of rating and radio rooms
+const (
+	SongSelectionRandom      = "random"      // Any song matching the room filters
+	SongSelectionRecommended = "recommended" // Songs the members are predicted to enjoy
+	SongSelectionDivisive    = "divisive"    // Songs the members are predicted to disagree on
+)
+
+// SongSelections lists the song selection modes of every room type; the
+// first is the default
+var SongSelections = []string{SongSelectionRandom, SongSelectionRecommended, SongSelectionDivisive}
+
+// Song selection modes only rating rooms have
+const (
+	SongSelectionArtistRotation = "artist_rotation" // Artists take turns
+	SongSelectionUnitRotation   = "unit_rotation"   // Units take turns
+	SongSelectionFewestVotes    = "fewest_votes"    // Songs with fewer votes come up more often
+	SongSelectionOldestFirst    = "oldest_first"    // Songs in the order they were added
+)
+
+// SongSimilarity is how alike users rate a song and one of its nearest
+// neighbours. The recommender refreshes the whole table periodically.
+type SongSimilarity struct {
+	SongID     uint    `gorm:"primaryKey"`
+	NeighborID uint    `gorm:"primaryKey;index"`
+	Similarity float64 `gorm:"not null"` // Adjusted cosine, shrunk towards 0 for few shared raters
+	Overlap    int     `gorm:"not null"` // Users who rated both songs
+}
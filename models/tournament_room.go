@@ -19,6 +19,9 @@ type TournamentRoom struct {
 	TreeState        TreeState `gorm:"type:jsonb"` // Store the entire tree structure as JSON
 	CurrentMatchID   *string   `gorm:"index"`      // Current active match ID
 	Status           string    `gorm:"default:'setup'"` // setup, in_progress, completed
+	PasswordHash     string    `json:"-"`                    // Empty means no password
+	InviteOnly       bool      `gorm:"default:false"`     // Only users on the allow-list may join
+	AllowGuests      bool      `gorm:"default:false"`     // Guests may join without an account
 	CreatedAt        time.Time
 	LastActive       time.Time `gorm:"index"`
 
@@ -58,6 +61,7 @@ type MatchSong struct {
 	ThumbnailURL     string  `json:"thumbnail_url"`       // Thumbnail
 	SourceURL        string  `json:"source_url"`          // Source URL for video
 	EmbedURL         string  `json:"embed_url"`           // Embed URL for video
+	Provider         string  `json:"provider"`            // Media provider of the embed URL
 	FromMatchID      *string `json:"from_match_id"`       // If this is a winner from another match
 	AverageRating    float64 `json:"average_rating"`      // Average rating (used for tiebreaker)
 	CategoryName     string  `json:"category_name"`       // Category name
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Unit struct {
 	UnitID         uint   `gorm:"primaryKey"`
@@ -14,7 +18,7 @@ type Unit struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"` // Set while the unit is in the trash
 }
 
 func (u *Unit) GetNameOriginal() string {
@@ -1,16 +1,47 @@
 package models
 
 import (
+	"slices"
 	"time"
 )
 
+// Roles of users, from least to most privileged. Each role can do what the
+// ones before it can.
+const (
+	RoleViewer  = "viewer"  // Browses the catalog
+	RoleMember  = "member"  // Rates songs
+	RoleCurator = "curator" // Edits the catalog
+	RoleAdmin   = "admin"   // Manages roles and backups
+)
+
+// Roles lists every role from least to most privileged
+var Roles = []string{RoleViewer, RoleMember, RoleCurator, RoleAdmin}
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// RoleAtLeast reports whether role grants everything required does
+func RoleAtLeast(role, required string) bool {
+	rank := slices.Index(Roles, role)
+	return rank >= 0 && rank >= slices.Index(Roles, required)
+}
+
 type User struct {
 	UserID       uint   `gorm:"primaryKey"`
 	Username     string `gorm:"uniqueIndex;size:50;not null"`
-	PasswordHash string
-	Email        string
+	PasswordHash string `json:"-"` // Never serialized, see handlers.UserResponse
+	Email        string `json:"-"`
+	IsGuest      bool   `gorm:"default:false;index"`             // Temporary identity without a password, see handlers.PostGuest
+	Role         string `gorm:"size:20;not null;default:member"` // One of Roles
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt time.Time
 }
+
+// HasRole reports whether the user has the role or a more privileged one
+func (u *User) HasRole(role string) bool {
+	return RoleAtLeast(u.Role, role)
+}
@@ -0,0 +1,135 @@
+// Package backup writes the catalog and its ratings to a portable archive and
+// restores them from one.
+//
+// An archive is a zip file holding manifest.json and one file per table under
+// tables/, either a JSON array of row objects or a CSV file with a header row.
+// The manifest names the format version, the schema version the data was
+// exported at and every table with its columns and row count, so an archive
+// can be read without SyncRate.
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatName identifies SyncRate archives in their manifest
+	FormatName = "syncrate-backup"
+	// FormatVersion is the archive layout written by Export. Restore reads
+	// archives up to this version.
+	FormatVersion = 1
+
+	manifestFile = "manifest.json"
+	tablesDir    = "tables/"
+)
+
+// Encoding is how the table files of an archive are written
+type Encoding string
+
+const (
+	EncodingJSON Encoding = "json"
+	EncodingCSV  Encoding = "csv"
+)
+
+// ParseEncoding reads an encoding name, defaulting to JSON
+func ParseEncoding(name string) (Encoding, error) {
+	switch Encoding(strings.ToLower(name)) {
+	case "", EncodingJSON:
+		return EncodingJSON, nil
+	case EncodingCSV:
+		return EncodingCSV, nil
+	}
+	return "", fmt.Errorf("unsupported backup encoding %q (expected json or csv)", name)
+}
+
+// ErrNotEmpty is returned by Restore when the catalog already has data and
+// the restore was not asked to replace it
+var ErrNotEmpty = errors.New("the catalog is not empty")
+
+// Manifest describes an archive
+type Manifest struct {
+	Format        string    `json:"format"`
+	FormatVersion int       `json:"format_version"`
+	SchemaVersion int       `json:"schema_version"` // Database migration the data was exported at
+	CreatedAt     time.Time `json:"created_at"`
+	Encoding      Encoding  `json:"encoding"`
+	Credentials   bool      `json:"credentials"` // Users carry password hashes and emails
+	Tables        []Table   `json:"tables"`
+}
+
+// Table describes one table file of an archive
+type Table struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Key     []string `json:"key"` // Primary key columns; rows are sorted by them
+	Columns []Column `json:"columns"`
+	Rows    int      `json:"rows"`
+}
+
+// Column is a column of a table file. Type is one of integer, float,
+// boolean, timestamp (RFC 3339) and text.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// tableSpec is a table the archive covers
+type tableSpec struct {
+	name   string
+	key    []string
+	serial string // Column filled from a sequence, reset after a restore
+}
+
+// tables are exported and restored in this order, so rows only refer to rows
+// of earlier tables
+var tables = []tableSpec{
+	{name: "categories", key: []string{"category_id"}, serial: "category_id"},
+	{name: "users", key: []string{"user_id"}, serial: "user_id"},
+	{name: "units", key: []string{"unit_id"}, serial: "unit_id"},
+	{name: "artists", key: []string{"artist_id"}, serial: "artist_id"},
+	{name: "albums", key: []string{"album_id"}, serial: "album_id"},
+	{name: "songs", key: []string{"song_id"}, serial: "song_id"},
+	{name: "artist_units", key: []string{"artist_id", "unit_id"}},
+	{name: "song_artists", key: []string{"song_id", "artist_id"}},
+	{name: "song_units", key: []string{"song_id", "unit_id"}},
+	{name: "album_songs", key: []string{"album_id", "song_id"}},
+	{name: "votes", key: []string{"vote_id"}, serial: "vote_id"},
+}
+
+// credentialColumns of the users table are only exported when asked for
+var credentialColumns = map[string]bool{
+	"password_hash": true,
+	"email":         true,
+}
+
+func findTable(name string) (tableSpec, bool) {
+	for _, spec := range tables {
+		if spec.name == name {
+			return spec, true
+		}
+	}
+	return tableSpec{}, false
+}
+
+// columnType maps a Postgres type name to a portable column type
+func columnType(databaseType string) string {
+	switch strings.ToUpper(databaseType) {
+	case "INT2", "INT4", "INT8", "SMALLINT", "INTEGER", "BIGINT":
+		return "integer"
+	case "FLOAT4", "FLOAT8", "NUMERIC", "REAL", "DOUBLE PRECISION":
+		return "float"
+	case "BOOL", "BOOLEAN":
+		return "boolean"
+	case "TIMESTAMPTZ", "TIMESTAMP", "DATE":
+		return "timestamp"
+	}
+	return "text"
+}
+
+// quoteIdent quotes a table or column name for SQL
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
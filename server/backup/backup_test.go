@@ -0,0 +1,196 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/backup"
+)
+
+// catalog is what newCatalog put in a store
+type catalog struct {
+	category models.Category
+	unit     models.Unit
+	artist   models.Artist
+	album    models.Album
+	song     models.Song
+	trashed  models.Song
+	alice    models.User
+	bob      models.User
+}
+
+// newCatalog fills a store with one of everything an archive covers
+func newCatalog(t *testing.T) (*memory.Store, catalog) {
+	t.Helper()
+	store := memory.New()
+	var c catalog
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.category = models.Category{Name: "Idols"}
+	must(store.CreateCategory(&c.category))
+	c.unit = models.Unit{NameOriginal: "Unit", PrimaryColor: "#ff0000", CategoryID: &c.category.CategoryID}
+	must(store.CreateUnit(&c.unit))
+	c.artist = models.Artist{NameOriginal: "Artist", NameEnglish: "The Artist", Units: []models.Unit{c.unit}}
+	must(store.CreateArtist(&c.artist))
+	c.album = models.Album{NameOriginal: "Album", Type: "EP"}
+	must(store.CreateAlbum(&c.album))
+	c.song = models.Song{
+		NameOriginal: "Song, with \"quotes\"",
+		SourceURL:    "https://example.com/song.mp3",
+		ThumbnailURL: "https://example.com/song.jpg",
+		Duration:     215,
+		IsCover:      true,
+		CategoryID:   &c.category.CategoryID,
+		Artists:      []models.Artist{c.artist},
+		Units:        []models.Unit{c.unit},
+		Albums:       []models.Album{c.album},
+	}
+	must(store.CreateSong(&c.song))
+	c.trashed = models.Song{NameOriginal: "Trashed", SourceURL: "https://example.com/trashed.mp3", ThumbnailURL: "https://example.com/trashed.jpg"}
+	must(store.CreateSong(&c.trashed))
+	must(store.DeleteSong(c.trashed.SongID))
+
+	c.alice = models.User{Username: "alice", PasswordHash: "alice-hash", Email: "alice@example.com", Role: models.RoleAdmin}
+	must(store.CreateUser(&c.alice))
+	c.bob = models.User{Username: "bob", PasswordHash: "bob-hash", Email: "bob@example.com", Role: models.RoleMember}
+	must(store.CreateUser(&c.bob))
+	must(store.UpsertVote(&models.Vote{UserID: c.alice.UserID, SongID: c.song.SongID, Rating: 9, Comment: "line one\nline two"}))
+	must(store.UpsertVote(&models.Vote{UserID: c.bob.UserID, SongID: c.song.SongID, Rating: 3}))
+	return store, c
+}
+
+// export writes an archive of a store
+func export(t *testing.T, store *memory.Store, opts backup.ExportOptions) *bytes.Reader {
+	t.Helper()
+	var archive bytes.Buffer
+	if _, err := backup.Export(store, &archive, opts); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	return bytes.NewReader(archive.Bytes())
+}
+
+func TestExportRestoreRoundTrip(t *testing.T) {
+	for _, encoding := range []backup.Encoding{backup.EncodingJSON, backup.EncodingCSV} {
+		t.Run(string(encoding), func(t *testing.T) {
+			source, c := newCatalog(t)
+			archive := export(t, source, backup.ExportOptions{Encoding: encoding, Credentials: true})
+
+			// bob already has an account where the archive is restored
+			target := memory.New()
+			bob := models.User{Username: "bob", Role: models.RoleViewer}
+			if err := target.CreateUser(&bob); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			result, err := backup.Restore(target, archive, archive.Size(), backup.RestoreOptions{})
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			if result.UsersCreated != 1 || result.UsersMatched != 1 {
+				t.Errorf("users created %d, matched %d; want 1 and 1", result.UsersCreated, result.UsersMatched)
+			}
+			if result.Rows["songs"] != 2 || result.Rows["votes"] != 2 || result.Rows["artist_units"] != 1 {
+				t.Errorf("restored rows = %v", result.Rows)
+			}
+
+			song, err := target.GetSongByID(c.song.SongID)
+			if err != nil {
+				t.Fatalf("GetSongByID: %v", err)
+			}
+			if song.NameOriginal != c.song.NameOriginal || song.Duration != 215 || !song.IsCover ||
+				song.CategoryID == nil || *song.CategoryID != c.category.CategoryID || !song.CreatedAt.Equal(c.song.CreatedAt) {
+				t.Errorf("restored song %q, duration %d, cover %v, created %v; want the exported one", song.NameOriginal, song.Duration, song.IsCover, song.CreatedAt)
+			}
+			if len(song.Artists) != 1 || song.Artists[0].ArtistID != c.artist.ArtistID ||
+				len(song.Units) != 1 || song.Units[0].UnitID != c.unit.UnitID ||
+				len(song.Albums) != 1 || song.Albums[0].AlbumID != c.album.AlbumID {
+				t.Errorf("restored song links: artists %v, units %v, albums %v", song.Artists, song.Units, song.Albums)
+			}
+			artist, err := target.GetArtistByID(c.artist.ArtistID)
+			if err != nil || len(artist.Units) != 1 || artist.NameEnglish != "The Artist" {
+				t.Errorf("restored artist = %+v, %v", artist, err)
+			}
+
+			trash, err := target.ListTrash(database.TrashSong)
+			if err != nil || len(trash) != 1 || trash[0].EntityID != c.trashed.SongID {
+				t.Errorf("restored trash = %v, %v; want the trashed song", trash, err)
+			}
+
+			// Credentials come along, and votes follow their users
+			alice, err := target.GetUserByUsername("alice")
+			if err != nil {
+				t.Fatalf("GetUserByUsername: %v", err)
+			}
+			if alice.PasswordHash != "alice-hash" || alice.Email != "alice@example.com" || alice.Role != models.RoleAdmin {
+				t.Errorf("restored alice = %+v", alice)
+			}
+			wantVotes := map[uint]models.Vote{
+				alice.UserID: {Rating: 9, Comment: "line one\nline two"},
+				bob.UserID:   {Rating: 3},
+			}
+			for userID, want := range wantVotes {
+				votes, _ := target.GetVotesByUser(userID)
+				if len(votes) != 1 || votes[0].SongID != c.song.SongID || votes[0].Rating != want.Rating || votes[0].Comment != want.Comment {
+					t.Errorf("votes of user %d = %+v; want %+v", userID, votes, want)
+				}
+			}
+
+			// New rows do not reuse restored IDs
+			next := models.Category{Name: "Next"}
+			if err := target.CreateCategory(&next); err != nil {
+				t.Fatalf("CreateCategory: %v", err)
+			}
+			if next.CategoryID <= c.trashed.SongID {
+				t.Errorf("new category got ID %d, which a restored row may hold", next.CategoryID)
+			}
+
+			if _, err := backup.Restore(target, archive, archive.Size(), backup.RestoreOptions{}); !errors.Is(err, backup.ErrNotEmpty) {
+				t.Errorf("second Restore = %v; want ErrNotEmpty", err)
+			}
+			result, err = backup.Restore(target, archive, archive.Size(), backup.RestoreOptions{Replace: true})
+			if err != nil {
+				t.Fatalf("Restore with replace: %v", err)
+			}
+			if result.UsersMatched != 2 {
+				t.Errorf("users matched on replace = %d; want 2", result.UsersMatched)
+			}
+		})
+	}
+}
+
+func TestExportWithoutCredentials(t *testing.T) {
+	source, _ := newCatalog(t)
+	archive := export(t, source, backup.ExportOptions{Encoding: backup.EncodingCSV})
+
+	target := memory.New()
+	result, err := backup.Restore(target, archive, archive.Size(), backup.RestoreOptions{})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if result.Manifest.Credentials {
+		t.Error("manifest says the archive has credentials")
+	}
+	i := slices.IndexFunc(result.Manifest.Tables, func(table backup.Table) bool { return table.Name == "users" })
+	for _, column := range result.Manifest.Tables[i].Columns {
+		if column.Name == "password_hash" || column.Name == "email" {
+			t.Errorf("users table has column %s", column.Name)
+		}
+	}
+	alice, err := target.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if alice.PasswordHash != "" || alice.Email != "" {
+		t.Errorf("restored alice has credentials: %+v", alice)
+	}
+}
@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/CptPie/SyncRate/database/migrations"
+	"gorm.io/gorm"
+)
+
+// insertBatchSize is how many rows go into one INSERT
+const insertBatchSize = 500
+
+// Database holds the tables an archive covers. SQLDatabase is the site's
+// Postgres database; the memory store implements it too, so archives can be
+// written and read without Postgres.
+type Database interface {
+	// SchemaVersion is the migration the tables are at
+	SchemaVersion() (int, error)
+	// TableTransaction runs fn on the tables. Reads see one snapshot, and
+	// writes are kept only if fn returns nil.
+	TableTransaction(readOnly bool, fn func(tx TableTx) error) error
+}
+
+// TableTx reads and writes tables by name inside a TableTransaction. Rows
+// hold one value per column, in the order Columns lists them.
+type TableTx interface {
+	// Columns lists the columns of a table
+	Columns(table string) ([]Column, error)
+	// Rows calls fn with every row of a table, sorted by key
+	Rows(table string, key []string, fn func(row []any) error) error
+	Count(table string) (int64, error)
+	// Clear deletes every row of a table
+	Clear(table string) error
+	// Insert adds rows with the given columns, IDs included
+	Insert(table string, columns []string, rows [][]any) error
+	// FindUser returns the ID of the user with a username
+	FindUser(username string) (id int64, found bool, err error)
+	// CreateUser adds a user from a row without its user_id column and
+	// returns the ID it got
+	CreateUser(columns []string, row []any) (int64, error)
+	// ResetSequence makes the next generated ID of a table follow its
+	// highest one
+	ResetSequence(table, column string) error
+}
+
+// SQLDatabase is a Database on Postgres
+type SQLDatabase struct {
+	DB *gorm.DB
+}
+
+func (d SQLDatabase) SchemaVersion() (int, error) {
+	migrator, err := migrations.New(d.DB)
+	if err != nil {
+		return 0, err
+	}
+	return migrator.Current()
+}
+
+// TableTransaction runs read-only transactions at repeatable read, so an
+// export is consistent while the site runs
+func (d SQLDatabase) TableTransaction(readOnly bool, fn func(tx TableTx) error) error {
+	var opts []*sql.TxOptions
+	if readOnly {
+		opts = append(opts, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	}
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(sqlTx{tx})
+	}, opts...)
+}
+
+// sqlTx is a TableTx on a Postgres transaction
+type sqlTx struct {
+	tx *gorm.DB
+}
+
+func (t sqlTx) Columns(table string) ([]Column, error) {
+	rows, err := t.tx.Raw("SELECT * FROM " + quoteIdent(table) + " LIMIT 0").Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	columns := make([]Column, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = Column{Name: ct.Name(), Type: columnType(ct.DatabaseTypeName())}
+	}
+	return columns, nil
+}
+
+func (t sqlTx) Rows(table string, key []string, fn func(row []any) error) error {
+	keys := make([]string, len(key))
+	for i, column := range key {
+		keys[i] = quoteIdent(column)
+	}
+	rows, err := t.tx.Raw("SELECT * FROM " + quoteIdent(table) + " ORDER BY " + strings.Join(keys, ", ")).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	return nil
+}
+
+func (t sqlTx) Count(table string) (int64, error) {
+	var count int64
+	if err := t.tx.Table(table).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", table, err)
+	}
+	return count, nil
+}
+
+func (t sqlTx) Clear(table string) error {
+	if err := t.tx.Exec("DELETE FROM " + quoteIdent(table)).Error; err != nil {
+		return fmt.Errorf("failed to clear %s: %w", table, err)
+	}
+	return nil
+}
+
+// Insert writes rows in batches of insertBatchSize
+func (t sqlTx) Insert(table string, columns []string, rows [][]any) error {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdent(column)
+	}
+	prefix := "INSERT INTO " + quoteIdent(table) + " (" + strings.Join(quoted, ", ") + ") VALUES "
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	for start := 0; start < len(rows); start += insertBatchSize {
+		batch := rows[start:min(start+insertBatchSize, len(rows))]
+		values := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*len(columns))
+		for i, row := range batch {
+			values[i] = placeholders
+			args = append(args, row...)
+		}
+		if err := t.tx.Exec(prefix+strings.Join(values, ", "), args...).Error; err != nil {
+			return fmt.Errorf("failed to restore %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (t sqlTx) FindUser(username string) (int64, bool, error) {
+	var existing []int64
+	if err := t.tx.Raw("SELECT user_id FROM users WHERE username = ?", username).Scan(&existing).Error; err != nil {
+		return 0, false, fmt.Errorf("failed to look up user %q: %w", username, err)
+	}
+	if len(existing) == 0 {
+		return 0, false, nil
+	}
+	return existing[0], true, nil
+}
+
+func (t sqlTx) CreateUser(columns []string, row []any) (int64, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdent(column)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	insert := "INSERT INTO users (" + strings.Join(quoted, ", ") + ") VALUES (" + placeholders + ") RETURNING user_id"
+
+	var id int64
+	if err := t.tx.Raw(insert, row...).Scan(&id).Error; err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (t sqlTx) ResetSequence(table, column string) error {
+	err := t.tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX("+quoteIdent(column)+"), 0) + 1, false) FROM "+quoteIdent(table),
+		table, column).Error
+	if err != nil {
+		return fmt.Errorf("failed to reset the %s sequence: %w", table, err)
+	}
+	return nil
+}
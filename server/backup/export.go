@@ -0,0 +1,226 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ExportOptions control what Export writes
+type ExportOptions struct {
+	Encoding Encoding
+	// Credentials includes the password hashes and emails of users, so a
+	// restore keeps accounts usable. Leave it off for archives that are shared.
+	Credentials bool
+}
+
+// Exporter writes backup archives, see Export
+type Exporter interface {
+	Export(w io.Writer, opts ExportOptions) (*Manifest, error)
+}
+
+// DBExporter exports the database it wraps
+type DBExporter struct {
+	DB Database
+}
+
+func (e DBExporter) Export(w io.Writer, opts ExportOptions) (*Manifest, error) {
+	return Export(e.DB, w, opts)
+}
+
+// Export writes an archive of the catalog, users and votes to w. The tables
+// are read in one snapshot, so the archive is consistent while the site runs.
+func Export(db Database, w io.Writer, opts ExportOptions) (*Manifest, error) {
+	if opts.Encoding == "" {
+		opts.Encoding = EncodingJSON
+	}
+	if _, err := ParseEncoding(string(opts.Encoding)); err != nil {
+		return nil, err
+	}
+
+	schemaVersion, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Format:        FormatName,
+		FormatVersion: FormatVersion,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Encoding:      opts.Encoding,
+		Credentials:   opts.Credentials,
+	}
+
+	archive := zip.NewWriter(w)
+	err = db.TableTransaction(true, func(tx TableTx) error {
+		for _, spec := range tables {
+			table, err := exportTable(tx, archive, spec, opts)
+			if err != nil {
+				return err
+			}
+			manifest.Tables = append(manifest.Tables, table)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := archive.Create(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return manifest, nil
+}
+
+// exportTable writes the rows of one table to its file in the archive
+func exportTable(tx TableTx, archive *zip.Writer, spec tableSpec, opts ExportOptions) (Table, error) {
+	columns, err := tx.Columns(spec.name)
+	if err != nil {
+		return Table{}, err
+	}
+
+	table := Table{
+		Name: spec.name,
+		File: tablesDir + spec.name + "." + string(opts.Encoding),
+		Key:  spec.key,
+	}
+	// keep lists the columns that go into the archive
+	var keep []int
+	for i, column := range columns {
+		if spec.name == "users" && credentialColumns[column.Name] && !opts.Credentials {
+			continue
+		}
+		keep = append(keep, i)
+		table.Columns = append(table.Columns, column)
+	}
+
+	file, err := archive.Create(table.File)
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to write %s: %w", table.File, err)
+	}
+	writer := newRowWriter(file, opts.Encoding, table.Columns)
+	if err := writer.begin(); err != nil {
+		return Table{}, fmt.Errorf("failed to write %s: %w", table.File, err)
+	}
+
+	row := make([]any, len(keep))
+	err = tx.Rows(spec.name, spec.key, func(values []any) error {
+		for i, column := range keep {
+			row[i] = values[column]
+		}
+		if err := writer.write(row); err != nil {
+			return fmt.Errorf("failed to write %s: %w", table.File, err)
+		}
+		table.Rows++
+		return nil
+	})
+	if err != nil {
+		return Table{}, err
+	}
+	if err := writer.end(); err != nil {
+		return Table{}, fmt.Errorf("failed to write %s: %w", table.File, err)
+	}
+	return table, nil
+}
+
+// rowWriter streams the rows of a table file
+type rowWriter struct {
+	out     io.Writer
+	columns []Column
+	csv     *csv.Writer // nil for JSON
+	rows    int
+}
+
+func newRowWriter(out io.Writer, encoding Encoding, columns []Column) *rowWriter {
+	w := &rowWriter{out: out, columns: columns}
+	if encoding == EncodingCSV {
+		w.csv = csv.NewWriter(out)
+	}
+	return w
+}
+
+func (w *rowWriter) begin() error {
+	if w.csv != nil {
+		header := make([]string, len(w.columns))
+		for i, column := range w.columns {
+			header[i] = column.Name
+		}
+		return w.csv.Write(header)
+	}
+	_, err := io.WriteString(w.out, "[")
+	return err
+}
+
+func (w *rowWriter) write(row []any) error {
+	defer func() { w.rows++ }()
+
+	if w.csv != nil {
+		fields := make([]string, len(row))
+		for i, value := range row {
+			fields[i] = formatCSVValue(value)
+		}
+		return w.csv.Write(fields)
+	}
+
+	object := make(map[string]any, len(row))
+	for i, value := range row {
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		object[w.columns[i].Name] = value
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if w.rows == 0 {
+		separator = "\n"
+	}
+	if _, err := io.WriteString(w.out, separator); err != nil {
+		return err
+	}
+	_, err = w.out.Write(data)
+	return err
+}
+
+func (w *rowWriter) end() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	_, err := io.WriteString(w.out, "\n]\n")
+	return err
+}
+
+// formatCSVValue writes a value as CSV text. NULL becomes an empty field, so
+// CSV archives cannot tell an empty text from a missing one.
+func formatCSVValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RestoreOptions control what Restore does with existing data
+type RestoreOptions struct {
+	// Replace deletes the catalog and all votes before restoring. Without it
+	// the catalog and votes must be empty. Users are never deleted.
+	Replace bool
+}
+
+// RestoreResult counts what Restore wrote
+type RestoreResult struct {
+	Manifest     *Manifest
+	Rows         map[string]int // Rows restored per table
+	UsersCreated int
+	UsersMatched int // Users of the archive that already had an account
+}
+
+// Restore loads an archive written by Export in one transaction. Catalog and
+// vote rows keep their IDs. Users are matched to existing accounts by
+// username and only created when missing, and votes follow their users.
+func Restore(db Database, r io.ReaderAt, size int64, opts RestoreOptions) (*RestoreResult, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	manifest, err := ReadManifest(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaVersion, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > schemaVersion {
+		return nil, fmt.Errorf("backup is from schema version %d but the database is on %d; migrate the database first", manifest.SchemaVersion, schemaVersion)
+	}
+
+	result := &RestoreResult{Manifest: manifest, Rows: make(map[string]int)}
+	err = db.TableTransaction(false, func(tx TableTx) error {
+		if err := clearCatalog(tx, opts.Replace); err != nil {
+			return err
+		}
+
+		userIDs := make(map[int64]int64)
+		for _, spec := range tables {
+			i := slices.IndexFunc(manifest.Tables, func(t Table) bool { return t.Name == spec.name })
+			if i < 0 {
+				continue
+			}
+			table := manifest.Tables[i]
+
+			rows, err := readTable(tx, archive, manifest.Encoding, table)
+			if err != nil {
+				return err
+			}
+			columns := make([]string, len(table.Columns))
+			for i, column := range table.Columns {
+				columns[i] = column.Name
+			}
+
+			switch spec.name {
+			case "users":
+				if err := restoreUsers(tx, columns, rows, userIDs, result); err != nil {
+					return err
+				}
+			case "votes":
+				if column := slices.Index(columns, "user_id"); column >= 0 {
+					for _, row := range rows {
+						if id, ok := row[column].(int64); ok {
+							if newID, ok := userIDs[id]; ok {
+								row[column] = newID
+							}
+						}
+					}
+				}
+				fallthrough
+			default:
+				if err := tx.Insert(spec.name, columns, rows); err != nil {
+					return err
+				}
+			}
+			result.Rows[spec.name] = len(rows)
+		}
+
+		for _, spec := range tables {
+			if spec.serial == "" {
+				continue
+			}
+			if err := tx.ResetSequence(spec.name, spec.serial); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReadManifest reads and checks the manifest of an archive
+func ReadManifest(archive *zip.Reader) (*Manifest, error) {
+	file, err := archive.Open(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("backup has no %s: %w", manifestFile, err)
+	}
+	defer file.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(file).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", manifestFile, err)
+	}
+	if manifest.Format != FormatName {
+		return nil, fmt.Errorf("not a SyncRate backup (format %q)", manifest.Format)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("backup format version %d is not supported (this build reads up to %d)", manifest.FormatVersion, FormatVersion)
+	}
+	if _, err := ParseEncoding(string(manifest.Encoding)); err != nil {
+		return nil, err
+	}
+	for _, table := range manifest.Tables {
+		if _, ok := findTable(table.Name); !ok {
+			return nil, fmt.Errorf("backup has unknown table %q", table.Name)
+		}
+	}
+	return &manifest, nil
+}
+
+// clearCatalog deletes the catalog and votes, or checks they are empty
+func clearCatalog(tx TableTx, replace bool) error {
+	for i := len(tables) - 1; i >= 0; i-- {
+		name := tables[i].name
+		if name == "users" {
+			continue
+		}
+		if replace {
+			if err := tx.Clear(name); err != nil {
+				return err
+			}
+			continue
+		}
+		count, err := tx.Count(name)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s has %d rows; restore with replace to overwrite them", ErrNotEmpty, name, count)
+		}
+	}
+	return nil
+}
+
+// readTable reads the rows of a table file as values for the database
+// columns of the same names
+func readTable(tx TableTx, archive *zip.Reader, encoding Encoding, table Table) ([][]any, error) {
+	columns, err := tx.Columns(table.Name)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(columns))
+	for _, column := range columns {
+		types[column.Name] = column.Type
+	}
+	kinds := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		kind, ok := types[column.Name]
+		if !ok {
+			return nil, fmt.Errorf("backup column %s.%s does not exist in the database", table.Name, column.Name)
+		}
+		kinds[i] = kind
+	}
+
+	file, err := archive.Open(table.File)
+	if err != nil {
+		return nil, fmt.Errorf("backup has no %s: %w", table.File, err)
+	}
+	defer file.Close()
+
+	var raw [][]any
+	if encoding == EncodingCSV {
+		raw, err = readCSVRows(file, table)
+	} else {
+		raw, err = readJSONRows(file, table)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", table.File, err)
+	}
+
+	for n, row := range raw {
+		for i, value := range row {
+			if row[i], err = decodeValue(kinds[i], value); err != nil {
+				return nil, fmt.Errorf("failed to read %s row %d, %s: %w", table.File, n+1, table.Columns[i].Name, err)
+			}
+		}
+	}
+	return raw, nil
+}
+
+func readJSONRows(r io.Reader, table Table) ([][]any, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var objects []map[string]any
+	if err := decoder.Decode(&objects); err != nil {
+		return nil, err
+	}
+	rows := make([][]any, len(objects))
+	for n, object := range objects {
+		row := make([]any, len(table.Columns))
+		for i, column := range table.Columns {
+			row[i] = object[column.Name]
+		}
+		if len(object) > len(table.Columns) {
+			return nil, fmt.Errorf("row %d has columns the manifest does not list", n+1)
+		}
+		rows[n] = row
+	}
+	return rows, nil
+}
+
+func readCSVRows(r io.Reader, table Table) ([][]any, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(table.Columns)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range table.Columns {
+		if header[i] != column.Name {
+			return nil, fmt.Errorf("header column %d is %q, the manifest says %q", i+1, header[i], column.Name)
+		}
+	}
+
+	var rows [][]any
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make([]any, len(fields))
+		for i, field := range fields {
+			row[i] = field
+		}
+		rows = append(rows, row)
+	}
+}
+
+// decodeValue turns a JSON value or CSV field into a value for a column of
+// the given portable type. Empty CSV fields are NULL except for text.
+func decodeValue(kind string, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if s, ok := value.(string); ok && s == "" && kind != "text" {
+		return nil, nil
+	}
+
+	text := func() string {
+		if s, ok := value.(string); ok {
+			return s
+		}
+		return fmt.Sprint(value)
+	}
+	switch kind {
+	case "integer":
+		return strconv.ParseInt(text(), 10, 64)
+	case "float":
+		return strconv.ParseFloat(text(), 64)
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return strconv.ParseBool(text())
+	case "timestamp":
+		return time.Parse(time.RFC3339Nano, text())
+	}
+	return text(), nil
+}
+
+// restoreUsers matches the users of an archive to accounts by username and
+// creates the missing ones, recording their new IDs
+func restoreUsers(tx TableTx, columns []string, rows [][]any, userIDs map[int64]int64, result *RestoreResult) error {
+	idColumn := slices.Index(columns, "user_id")
+	nameColumn := slices.Index(columns, "username")
+	if idColumn < 0 || nameColumn < 0 {
+		return errors.New("backup users have no user_id or username")
+	}
+	insertColumns := slices.Delete(slices.Clone(columns), idColumn, idColumn+1)
+
+	for _, row := range rows {
+		oldID, _ := row[idColumn].(int64)
+		username, _ := row[nameColumn].(string)
+
+		existingID, found, err := tx.FindUser(username)
+		if err != nil {
+			return err
+		}
+		if found {
+			userIDs[oldID] = existingID
+			result.UsersMatched++
+			continue
+		}
+
+		newID, err := tx.CreateUser(insertColumns, slices.Delete(slices.Clone(row), idColumn, idColumn+1))
+		if err != nil {
+			return fmt.Errorf("failed to create user %q: %w", username, err)
+		}
+		userIDs[oldID] = newID
+		result.UsersCreated++
+	}
+	return nil
+}
@@ -2,48 +2,96 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/CptPie/SyncRate/database"
 	"github.com/CptPie/SyncRate/models"
 	"github.com/CptPie/SyncRate/server/utils"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
+// loadAll loads the entities an admin page lists. A failure is logged and
+// the page shows none.
+func loadAll[T any](handler string, load func() ([]T, error)) []T {
+	entities, err := load()
+	if err != nil {
+		log.Printf("%s: Error loading %T: %v", handler, entities, err)
+		return []T{}
+	}
+	return entities
+}
+
+// formCategoryID parses the optional category_id form field
+func formCategoryID(c *gin.Context) *uint {
+	if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
+		if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
+			categoryIDUint := uint(categoryID)
+			return &categoryIDUint
+		}
+	}
+	return nil
+}
+
+// formIDs parses a comma separated list of IDs from a form field, skipping
+// anything that is not an ID
+func formIDs(c *gin.Context, field string) []uint {
+	var ids []uint
+	for _, idStr := range strings.Split(c.PostForm(field), ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(idStr), 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// adminChangeFailed shows why an admin change of an entity failed
+func adminChangeFailed(c *gin.Context, change, entity string, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"error": strings.ToUpper(entity[:1]) + entity[1:] + " not found",
+		})
+		return
+	}
+	log.Printf("adminChangeFailed: %s %s: %v", change, entity, err)
+	c.HTML(storeErrorStatus(err), "error.html", gin.H{
+		"error": "Failed to " + change + " " + entity + ": " + err.Error(),
+	})
+}
+
 // Admin index page
-func GetAdmin(db *gorm.DB) gin.HandlerFunc {
+func GetAdmin(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetAdmin: Loading admin panel")
 
-		var categoryCount, unitCount, artistCount, albumCount, songCount int64
-		db.Model(&models.Category{}).Count(&categoryCount)
-		db.Model(&models.Unit{}).Count(&unitCount)
-		db.Model(&models.Artist{}).Count(&artistCount)
-		db.Model(&models.Album{}).Count(&albumCount)
-		db.Model(&models.Song{}).Count(&songCount)
+		counts, err := store.CountCatalog()
+		if err != nil {
+			log.Printf("GetAdmin: Error counting the catalog: %v", err)
+			counts = &database.CatalogCounts{}
+		}
 
 		templateData := GetUserContext(c)
 		templateData["title"] = "SyncRate | Admin Panel"
-		templateData["categoryCount"] = categoryCount
-		templateData["unitCount"] = unitCount
-		templateData["artistCount"] = artistCount
-		templateData["albumCount"] = albumCount
-		templateData["songCount"] = songCount
+		templateData["categoryCount"] = counts.Categories
+		templateData["unitCount"] = counts.Units
+		templateData["artistCount"] = counts.Artists
+		templateData["albumCount"] = counts.Albums
+		templateData["songCount"] = counts.Songs
 
 		c.HTML(http.StatusOK, "admin-index.html", templateData)
 	}
 }
 
 // Add Category page
-func GetAddCategory(db *gorm.DB) gin.HandlerFunc {
+func GetAddCategory(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetAddCategory: Loading add category page")
 
-		var categories []models.Category
-		db.Find(&categories)
+		categories := loadAll("GetAddCategory", store.GetAllCategories)
 
 		templateData := GetUserContext(c)
 		templateData["title"] = "SyncRate | Add Category"
@@ -54,16 +102,13 @@ func GetAddCategory(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Add Unit page
-func GetAddUnit(db *gorm.DB) gin.HandlerFunc {
+func GetAddUnit(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetAddUnit: Loading add unit page")
 
-		var units []models.Unit
-		var categories []models.Category
-		var artists []models.Artist
-		db.Find(&units)
-		db.Find(&categories)
-		db.Preload("Category").Find(&artists)
+		units := loadAll("GetAddUnit", store.GetAllUnits)
+		categories := loadAll("GetAddUnit", store.GetAllCategories)
+		artists := loadAll("GetAddUnit", store.GetAllArtists)
 
 		// Convert to JSON for JavaScript
 		categoriesJSON, _ := json.Marshal(categories)
@@ -82,16 +127,13 @@ func GetAddUnit(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Add Artist page
-func GetAddArtist(db *gorm.DB) gin.HandlerFunc {
+func GetAddArtist(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetAddArtist: Loading add artist page")
 
-		var artists []models.Artist
-		var units []models.Unit
-		var categories []models.Category
-		db.Find(&artists)
-		db.Find(&units)
-		db.Find(&categories)
+		artists := loadAll("GetAddArtist", store.GetAllArtists)
+		units := loadAll("GetAddArtist", store.GetAllUnits)
+		categories := loadAll("GetAddArtist", store.GetAllCategories)
 
 		// Convert to JSON for JavaScript
 		unitsJSON, _ := json.Marshal(units)
@@ -110,18 +152,14 @@ func GetAddArtist(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Add Song page
-func GetAddSong(db *gorm.DB) gin.HandlerFunc {
+func GetAddSong(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetAddSong: Loading add song page")
 
-		var categories []models.Category
-		var artists []models.Artist
-		var units []models.Unit
-		var albums []models.Album
-		db.Find(&categories)
-		db.Find(&artists)
-		db.Find(&units)
-		db.Preload("Category").Find(&albums)
+		categories := loadAll("GetAddSong", store.GetAllCategories)
+		artists := loadAll("GetAddSong", store.GetAllArtists)
+		units := loadAll("GetAddSong", store.GetAllUnits)
+		albums := loadAll("GetAddSong", store.GetAllAlbums)
 
 		// Convert to JSON for JavaScript
 		categoriesJSON, _ := json.Marshal(categories)
@@ -145,14 +183,12 @@ func GetAddSong(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Add Album page
-func GetAddAlbum(db *gorm.DB) gin.HandlerFunc {
+func GetAddAlbum(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetAddAlbum: Loading add album page")
 
-		var albums []models.Album
-		var categories []models.Category
-		db.Preload("Category").Find(&albums)
-		db.Find(&categories)
+		albums := loadAll("GetAddAlbum", store.GetAllAlbums)
+		categories := loadAll("GetAddAlbum", store.GetAllCategories)
 
 		// Convert to JSON for JavaScript
 		categoriesJSON, _ := json.Marshal(categories)
@@ -169,7 +205,7 @@ func GetAddAlbum(db *gorm.DB) gin.HandlerFunc {
 
 // POST handlers for form submissions
 
-func PostAddCategory(db *gorm.DB) gin.HandlerFunc {
+func PostAddCategory(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("PostAddCategory: Adding new category")
 
@@ -185,12 +221,14 @@ func PostAddCategory(db *gorm.DB) gin.HandlerFunc {
 			Name: name,
 		}
 
-		result := db.Create(&category)
-		if result.Error != nil {
-			log.Printf("PostAddCategory: Error creating category: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to create category: " + result.Error.Error(),
-			})
+		err := store.Transaction(func(tx database.Store) error {
+			if err := tx.CreateCategory(&category); err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditCreate, auditCategory, category.CategoryID, nil, category)
+		})
+		if err != nil {
+			adminChangeFailed(c, "create", "category", err)
 			return
 		}
 
@@ -199,7 +237,7 @@ func PostAddCategory(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func PostAddUnit(db *gorm.DB) gin.HandlerFunc {
+func PostAddUnit(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("PostAddUnit: Adding new unit")
 
@@ -216,53 +254,33 @@ func PostAddUnit(db *gorm.DB) gin.HandlerFunc {
 			NameEnglish:    strings.TrimSpace(c.PostForm("name_english")),
 			PrimaryColor:   strings.TrimSpace(c.PostForm("primary_color")),
 			SecondaryColor: strings.TrimSpace(c.PostForm("secondary_color")),
+			CategoryID:     formCategoryID(c),
 		}
 
-		// Parse category ID if provided
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				unit.CategoryID = &categoryIDUint
+		err := store.Transaction(func(tx database.Store) error {
+			if err := tx.CreateUnit(&unit); err != nil {
+				return err
 			}
-		}
-
-		// Start transaction
-		tx := db.Begin()
-
-		result := tx.Create(&unit)
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostAddUnit: Error creating unit: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to create unit: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Handle artist associations
-		if artistIDsStr := strings.TrimSpace(c.PostForm("artist_ids")); artistIDsStr != "" {
-			artistIDs := strings.Split(artistIDsStr, ",")
-			for _, artistIDStr := range artistIDs {
-				if artistID, err := strconv.ParseUint(strings.TrimSpace(artistIDStr), 10, 32); err == nil {
-					artistUnit := models.ArtistUnit{
-						ArtistID: uint(artistID),
-						UnitID:   unit.UnitID,
-					}
-					if err := tx.Create(&artistUnit).Error; err != nil {
-						log.Printf("PostAddUnit: Warning - failed to associate unit with artist %d: %v", artistID, err)
-					}
-				}
+			if err := tx.SetUnitArtists(unit.UnitID, formIDs(c, "artist_ids")); err != nil {
+				return err
+			}
+			after, err := tx.GetUnitSnapshot(unit.UnitID)
+			if err != nil {
+				return err
 			}
+			return recordAdminAudit(c, tx, models.AuditCreate, auditUnit, unit.UnitID, nil, after)
+		})
+		if err != nil {
+			adminChangeFailed(c, "create", "unit", err)
+			return
 		}
 
-		tx.Commit()
-
 		log.Printf("PostAddUnit: Successfully created unit '%s' with ID %d", unit.NameOriginal, unit.UnitID)
 		c.Redirect(http.StatusSeeOther, "/admin/add-unit")
 	}
 }
 
-func PostAddArtist(db *gorm.DB) gin.HandlerFunc {
+func PostAddArtist(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("PostAddArtist: Adding new artist")
 
@@ -279,59 +297,38 @@ func PostAddArtist(db *gorm.DB) gin.HandlerFunc {
 			NameEnglish:    strings.TrimSpace(c.PostForm("name_english")),
 			PrimaryColor:   strings.TrimSpace(c.PostForm("primary_color")),
 			SecondaryColor: strings.TrimSpace(c.PostForm("secondary_color")),
+			CategoryID:     formCategoryID(c),
 		}
 
-		// Parse category ID if provided
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				artist.CategoryID = &categoryIDUint
+		err := store.Transaction(func(tx database.Store) error {
+			if err := tx.CreateArtist(&artist); err != nil {
+				return err
 			}
-		}
-
-		// Start transaction
-		tx := db.Begin()
-
-		result := tx.Create(&artist)
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostAddArtist: Error creating artist: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to create artist: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Handle unit associations
-		if unitIDsStr := strings.TrimSpace(c.PostForm("unit_ids")); unitIDsStr != "" {
-			unitIDs := strings.Split(unitIDsStr, ",")
-			for _, unitIDStr := range unitIDs {
-				if unitID, err := strconv.ParseUint(strings.TrimSpace(unitIDStr), 10, 32); err == nil {
-					artistUnit := models.ArtistUnit{
-						ArtistID: artist.ArtistID,
-						UnitID:   uint(unitID),
-					}
-					if err := tx.Create(&artistUnit).Error; err != nil {
-						log.Printf("PostAddArtist: Warning - failed to associate artist with unit %d: %v", unitID, err)
-					}
-				}
+			if err := tx.SetArtistUnits(artist.ArtistID, formIDs(c, "unit_ids")); err != nil {
+				return err
 			}
+			after, err := tx.GetArtistSnapshot(artist.ArtistID)
+			if err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditCreate, auditArtist, artist.ArtistID, nil, after)
+		})
+		if err != nil {
+			adminChangeFailed(c, "create", "artist", err)
+			return
 		}
 
-		tx.Commit()
-
 		log.Printf("PostAddArtist: Successfully created artist '%s' with ID %d", artist.NameOriginal, artist.ArtistID)
 		c.Redirect(http.StatusSeeOther, "/admin/add-artist")
 	}
 }
 
 // View Categories page
-func GetViewCategories(db *gorm.DB) gin.HandlerFunc {
+func GetViewCategories(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetViewCategories: Loading view categories page")
 
-		var categories []models.Category
-		db.Find(&categories)
+		categories := loadAll("GetViewCategories", store.GetAllCategories)
 
 		// Convert to JSON for JavaScript
 		categoriesJSON, _ := json.Marshal(categories)
@@ -347,16 +344,13 @@ func GetViewCategories(db *gorm.DB) gin.HandlerFunc {
 }
 
 // View Units page
-func GetViewUnits(db *gorm.DB) gin.HandlerFunc {
+func GetViewUnits(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetViewUnits: Loading view units page")
 
-		var units []models.Unit
-		var categories []models.Category
-		var artists []models.Artist
-		db.Preload("Category").Preload("Artists").Find(&units)
-		db.Find(&categories)
-		db.Preload("Category").Find(&artists)
+		units := loadAll("GetViewUnits", store.GetAllUnits)
+		categories := loadAll("GetViewUnits", store.GetAllCategories)
+		artists := loadAll("GetViewUnits", store.GetAllArtists)
 
 		// Convert to JSON for JavaScript
 		unitsJSON, _ := json.Marshal(units)
@@ -378,16 +372,13 @@ func GetViewUnits(db *gorm.DB) gin.HandlerFunc {
 }
 
 // View Artists page
-func GetViewArtists(db *gorm.DB) gin.HandlerFunc {
+func GetViewArtists(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetViewArtists: Loading view artists page")
 
-		var artists []models.Artist
-		var categories []models.Category
-		var units []models.Unit
-		db.Preload("Category").Preload("Units").Find(&artists)
-		db.Find(&categories)
-		db.Find(&units)
+		artists := loadAll("GetViewArtists", store.GetAllArtists)
+		categories := loadAll("GetViewArtists", store.GetAllCategories)
+		units := loadAll("GetViewArtists", store.GetAllUnits)
 
 		// Convert to JSON for JavaScript
 		artistsJSON, _ := json.Marshal(artists)
@@ -409,7 +400,7 @@ func GetViewArtists(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Edit Category
-func PostEditCategory(db *gorm.DB) gin.HandlerFunc {
+func PostEditCategory(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostEditCategory: Editing category ID: %s", idParam)
@@ -432,28 +423,20 @@ func PostEditCategory(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var category models.Category
-		result := db.First(&category, uint(id))
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"error": "Category not found",
-				})
-				return
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetCategoryByID(uint(id))
+			if err != nil {
+				return err
 			}
-			log.Printf("PostEditCategory: Database error: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to find category: " + result.Error.Error(),
-			})
-			return
-		}
-
-		category.Name = name
-		result = db.Save(&category)
-		if result.Error != nil {
-			log.Printf("PostEditCategory: Error updating category: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update category: " + result.Error.Error(),
-			})
+			category = *before
+			category.Name = name
+			if err := tx.UpdateCategory(&category); err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditUpdate, auditCategory, category.CategoryID, before, category)
+		})
+		if err != nil {
+			adminChangeFailed(c, "update", "category", err)
 			return
 		}
 
@@ -463,7 +446,7 @@ func PostEditCategory(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Delete Category
-func PostDeleteCategory(db *gorm.DB) gin.HandlerFunc {
+func PostDeleteCategory(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostDeleteCategory: Deleting category ID: %s", idParam)
@@ -477,12 +460,18 @@ func PostDeleteCategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		result := db.Delete(&models.Category{}, uint(id))
-		if result.Error != nil {
-			log.Printf("PostDeleteCategory: Error deleting category: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete category: " + result.Error.Error(),
-			})
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetCategoryByID(uint(id))
+			if err != nil {
+				return err
+			}
+			if err := tx.DeleteCategory(before.CategoryID); err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditDelete, auditCategory, before.CategoryID, before, nil)
+		})
+		if err != nil {
+			adminChangeFailed(c, "delete", "category", err)
 			return
 		}
 
@@ -492,7 +481,7 @@ func PostDeleteCategory(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Edit Unit
-func PostEditUnit(db *gorm.DB) gin.HandlerFunc {
+func PostEditUnit(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostEditUnit: Editing unit ID: %s", idParam)
@@ -515,82 +504,46 @@ func PostEditUnit(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var unit models.Unit
-		result := db.First(&unit, uint(id))
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"error": "Unit not found",
-				})
-				return
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetUnitSnapshot(uint(id))
+			if err != nil {
+				return err
 			}
-			log.Printf("PostEditUnit: Database error: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to find unit: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Update unit fields
-		unit.NameOriginal = nameOrig
-		unit.NameEnglish = strings.TrimSpace(c.PostForm("name_english"))
-		unit.PrimaryColor = strings.TrimSpace(c.PostForm("primary_color"))
-		unit.SecondaryColor = strings.TrimSpace(c.PostForm("secondary_color"))
 
-		// Parse category ID if provided
-		unit.CategoryID = nil
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				unit.CategoryID = &categoryIDUint
+			// Update unit fields
+			unit = before.Unit
+			unit.NameOriginal = nameOrig
+			unit.NameEnglish = strings.TrimSpace(c.PostForm("name_english"))
+			unit.PrimaryColor = strings.TrimSpace(c.PostForm("primary_color"))
+			unit.SecondaryColor = strings.TrimSpace(c.PostForm("secondary_color"))
+			unit.CategoryID = formCategoryID(c)
+			if err := tx.UpdateUnit(&unit); err != nil {
+				return err
 			}
-		}
 
-		// Start transaction
-		tx := db.Begin()
-
-		result = tx.Save(&unit)
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostEditUnit: Error updating unit: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update unit: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Handle artist associations - delete existing and create new ones
-		if err := tx.Where("unit_id = ?", unit.UnitID).Delete(&models.ArtistUnit{}).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostEditUnit: Error deleting existing artist associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update artist associations: " + err.Error(),
-			})
-			return
-		}
+			// Replace the artist associations with the submitted ones
+			if err := tx.SetUnitArtists(unit.UnitID, formIDs(c, "artist_ids")); err != nil {
+				return err
+			}
 
-		if artistIDsStr := strings.TrimSpace(c.PostForm("artist_ids")); artistIDsStr != "" {
-			artistIDs := strings.Split(artistIDsStr, ",")
-			for _, artistIDStr := range artistIDs {
-				if artistID, err := strconv.ParseUint(strings.TrimSpace(artistIDStr), 10, 32); err == nil {
-					artistUnit := models.ArtistUnit{
-						ArtistID: uint(artistID),
-						UnitID:   unit.UnitID,
-					}
-					if err := tx.Create(&artistUnit).Error; err != nil {
-						log.Printf("PostEditUnit: Warning - failed to associate unit with artist %d: %v", artistID, err)
-					}
-				}
+			after, err := tx.GetUnitSnapshot(unit.UnitID)
+			if err != nil {
+				return err
 			}
+			return recordAdminAudit(c, tx, models.AuditUpdate, auditUnit, unit.UnitID, before, after)
+		})
+		if err != nil {
+			adminChangeFailed(c, "update", "unit", err)
+			return
 		}
 
-		tx.Commit()
 		log.Printf("PostEditUnit: Successfully updated unit '%s' with ID %d", unit.NameOriginal, unit.UnitID)
 		c.Redirect(http.StatusSeeOther, "/admin/units")
 	}
 }
 
 // Delete Unit
-func PostDeleteUnit(db *gorm.DB) gin.HandlerFunc {
+func PostDeleteUnit(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostDeleteUnit: Deleting unit ID: %s", idParam)
@@ -604,38 +557,29 @@ func PostDeleteUnit(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Start transaction to delete unit and its associations
-		tx := db.Begin()
-
-		// Delete artist-unit associations
-		if err := tx.Where("unit_id = ?", id).Delete(&models.ArtistUnit{}).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteUnit: Error deleting unit associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete unit associations: " + err.Error(),
-			})
-			return
-		}
-
-		// Delete the unit
-		result := tx.Delete(&models.Unit{}, uint(id))
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteUnit: Error deleting unit: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete unit: " + result.Error.Error(),
-			})
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetUnitSnapshot(uint(id))
+			if err != nil {
+				return err
+			}
+			// Move the unit to the trash; its associations stay for a restore
+			if err := tx.DeleteUnit(before.UnitID); err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditDelete, auditUnit, before.UnitID, before, nil)
+		})
+		if err != nil {
+			adminChangeFailed(c, "delete", "unit", err)
 			return
 		}
 
-		tx.Commit()
 		log.Printf("PostDeleteUnit: Successfully deleted unit with ID %d", id)
 		c.Redirect(http.StatusSeeOther, "/admin/units")
 	}
 }
 
 // Edit Artist
-func PostEditArtist(db *gorm.DB) gin.HandlerFunc {
+func PostEditArtist(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostEditArtist: Editing artist ID: %s", idParam)
@@ -658,82 +602,46 @@ func PostEditArtist(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var artist models.Artist
-		result := db.First(&artist, uint(id))
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"error": "Artist not found",
-				})
-				return
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetArtistSnapshot(uint(id))
+			if err != nil {
+				return err
 			}
-			log.Printf("PostEditArtist: Database error: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to find artist: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Start transaction
-		tx := db.Begin()
 
-		// Update artist fields
-		artist.NameOriginal = nameOrig
-		artist.NameEnglish = strings.TrimSpace(c.PostForm("name_english"))
-		artist.PrimaryColor = strings.TrimSpace(c.PostForm("primary_color"))
-		artist.SecondaryColor = strings.TrimSpace(c.PostForm("secondary_color"))
-
-		// Parse category ID if provided
-		artist.CategoryID = nil
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				artist.CategoryID = &categoryIDUint
+			// Update artist fields
+			artist = before.Artist
+			artist.NameOriginal = nameOrig
+			artist.NameEnglish = strings.TrimSpace(c.PostForm("name_english"))
+			artist.PrimaryColor = strings.TrimSpace(c.PostForm("primary_color"))
+			artist.SecondaryColor = strings.TrimSpace(c.PostForm("secondary_color"))
+			artist.CategoryID = formCategoryID(c)
+			if err := tx.UpdateArtist(&artist); err != nil {
+				return err
 			}
-		}
-
-		result = tx.Save(&artist)
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostEditArtist: Error updating artist: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update artist: " + result.Error.Error(),
-			})
-			return
-		}
 
-		// Handle unit associations - delete existing and create new ones
-		if err := tx.Where("artist_id = ?", artist.ArtistID).Delete(&models.ArtistUnit{}).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostEditArtist: Error deleting existing unit associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update unit associations: " + err.Error(),
-			})
-			return
-		}
+			// Replace the unit associations with the submitted ones
+			if err := tx.SetArtistUnits(artist.ArtistID, formIDs(c, "unit_ids")); err != nil {
+				return err
+			}
 
-		if unitIDsStr := strings.TrimSpace(c.PostForm("unit_ids")); unitIDsStr != "" {
-			unitIDs := strings.Split(unitIDsStr, ",")
-			for _, unitIDStr := range unitIDs {
-				if unitID, err := strconv.ParseUint(strings.TrimSpace(unitIDStr), 10, 32); err == nil {
-					artistUnit := models.ArtistUnit{
-						ArtistID: artist.ArtistID,
-						UnitID:   uint(unitID),
-					}
-					if err := tx.Create(&artistUnit).Error; err != nil {
-						log.Printf("PostEditArtist: Warning - failed to associate artist with unit %d: %v", unitID, err)
-					}
-				}
+			after, err := tx.GetArtistSnapshot(artist.ArtistID)
+			if err != nil {
+				return err
 			}
+			return recordAdminAudit(c, tx, models.AuditUpdate, auditArtist, artist.ArtistID, before, after)
+		})
+		if err != nil {
+			adminChangeFailed(c, "update", "artist", err)
+			return
 		}
 
-		tx.Commit()
 		log.Printf("PostEditArtist: Successfully updated artist '%s' with ID %d", artist.NameOriginal, artist.ArtistID)
 		c.Redirect(http.StatusSeeOther, "/admin/artists")
 	}
 }
 
 // Delete Artist
-func PostDeleteArtist(db *gorm.DB) gin.HandlerFunc {
+func PostDeleteArtist(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostDeleteArtist: Deleting artist ID: %s", idParam)
@@ -747,168 +655,231 @@ func PostDeleteArtist(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Start transaction to delete artist and its associations
-		tx := db.Begin()
-
-		// Delete artist-unit associations
-		if err := tx.Where("artist_id = ?", id).Delete(&models.ArtistUnit{}).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteArtist: Error deleting artist-unit associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete artist associations: " + err.Error(),
-			})
-			return
-		}
-
-		// Delete song-artist associations
-		if err := tx.Where("artist_id = ?", id).Delete(&models.SongArtist{}).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteArtist: Error deleting song-artist associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete song associations: " + err.Error(),
-			})
-			return
-		}
-
-		// Delete the artist
-		result := tx.Delete(&models.Artist{}, uint(id))
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteArtist: Error deleting artist: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete artist: " + result.Error.Error(),
-			})
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetArtistSnapshot(uint(id))
+			if err != nil {
+				return err
+			}
+			// Move the artist to the trash; its associations stay for a restore
+			if err := tx.DeleteArtist(before.ArtistID); err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditDelete, auditArtist, before.ArtistID, before, nil)
+		})
+		if err != nil {
+			adminChangeFailed(c, "delete", "artist", err)
 			return
 		}
 
-		tx.Commit()
 		log.Printf("PostDeleteArtist: Successfully deleted artist with ID %d", id)
 		c.Redirect(http.StatusSeeOther, "/admin/artists")
 	}
 }
 
-func PostAddSong(db *gorm.DB) gin.HandlerFunc {
+func PostAddSong(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("PostAddSong: Adding new song")
 
-		nameOriginal := strings.TrimSpace(c.PostForm("name_original"))
 		sourceURL := strings.TrimSpace(c.PostForm("source_url"))
-		thumbnailURL := strings.TrimSpace(c.PostForm("thumbnail_url"))
+		if sourceURL == "" {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"error": "Source URL is required",
+			})
+			return
+		}
 
-		if nameOriginal == "" || sourceURL == "" {
+		song := models.Song{
+			NameOriginal: strings.TrimSpace(c.PostForm("name_original")),
+			NameEnglish:  strings.TrimSpace(c.PostForm("name_english")),
+			SourceURL:    sourceURL,
+			ThumbnailURL: strings.TrimSpace(c.PostForm("thumbnail_url")),
+			IsCover:      c.PostForm("is_cover") == "true",
+			CategoryID:   formCategoryID(c),
+		}
+		if duration, err := strconv.Atoi(strings.TrimSpace(c.PostForm("duration"))); err == nil && duration > 0 {
+			song.Duration = duration
+		}
+
+		// Find the media provider that plays the source URL
+		media, err := setSongMedia(&song)
+		if err != nil {
+			log.Printf("PostAddSong: Unsupported source URL: %v", err)
 			c.HTML(http.StatusBadRequest, "error.html", gin.H{
-				"error": "Original name and source URL are required",
+				"error": "Unsupported source URL: " + err.Error(),
 			})
 			return
 		}
 
-		// Auto-extract thumbnail URL from YouTube if not provided
-		if thumbnailURL == "" && utils.IsYouTubeURL(sourceURL) {
-			var err error
-			thumbnailURL, err = utils.ExtractYouTubeThumbnail(sourceURL)
+		// Ask the provider for a thumbnail if not provided
+		if song.ThumbnailURL == "" {
+			song.ThumbnailURL, err = providerThumbnail(media)
 			if err != nil {
-				log.Printf("PostAddSong: Failed to extract YouTube thumbnail: %v", err)
+				log.Printf("PostAddSong: Failed to get %s thumbnail: %v", media.Provider, err)
 				c.HTML(http.StatusBadRequest, "error.html", gin.H{
-					"error": "Failed to extract YouTube thumbnail: " + err.Error(),
+					"error": "Failed to get thumbnail: " + err.Error(),
 				})
 				return
 			}
-			log.Printf("PostAddSong: Auto-extracted YouTube thumbnail: %s", thumbnailURL)
+			if song.ThumbnailURL != "" {
+				log.Printf("PostAddSong: Auto-extracted %s thumbnail: %s", media.Provider, song.ThumbnailURL)
+			}
+		}
+
+		// Fill in the name, thumbnail and duration from the provider's metadata
+		fillSongMetadata(c.Request.Context(), &song, media)
+
+		if song.NameOriginal == "" {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"error": "Original name is required",
+			})
+			return
 		}
 
 		// Require thumbnail URL if still empty
-		if thumbnailURL == "" {
+		if song.ThumbnailURL == "" {
 			c.HTML(http.StatusBadRequest, "error.html", gin.H{
 				"error": "Thumbnail URL is required",
 			})
 			return
 		}
 
-		song := models.Song{
-			NameOriginal: nameOriginal,
-			NameEnglish:  strings.TrimSpace(c.PostForm("name_english")),
-			SourceURL:    sourceURL,
-			ThumbnailURL: thumbnailURL,
-			IsCover:      c.PostForm("is_cover") == "true",
+		err = store.Transaction(func(tx database.Store) error {
+			if err := tx.CreateSong(&song); err != nil {
+				return err
+			}
+			if err := tx.SetSongLinks(song.SongID, formIDs(c, "artist_ids"), formIDs(c, "unit_ids"), formIDs(c, "album_ids")); err != nil {
+				return err
+			}
+			after, err := tx.GetSongSnapshot(song.SongID, false)
+			if err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditCreate, auditSong, song.SongID, nil, after)
+		})
+		if err != nil {
+			adminChangeFailed(c, "create", "song", err)
+			return
 		}
 
-		// Parse category ID if provided
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				song.CategoryID = &categoryIDUint
+		log.Printf("PostAddSong: Successfully created song '%s' with ID %d", song.NameOriginal, song.SongID)
+		c.Redirect(http.StatusSeeOther, "/admin/add-song")
+	}
+}
+
+const (
+	// minSuggestionScore is how closely an artist or unit name must match a
+	// song's uploader or title to be suggested, see utils.NameMatchScore
+	minSuggestionScore = 0.75
+	maxSuggestions     = 5
+)
+
+// nameSuggestion is an existing artist or unit a new song may be by
+type nameSuggestion struct {
+	ID    uint    `json:"id"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// suggestNames rates names against texts and returns the best matches. names
+// holds the original and English name of each candidate by ID.
+func suggestNames(names map[uint][2]string, texts ...string) []nameSuggestion {
+	suggestions := []nameSuggestion{}
+	for id, candidate := range names {
+		score := 0.0
+		for _, name := range candidate {
+			for _, text := range texts {
+				score = max(score, utils.NameMatchScore(name, text))
 			}
 		}
+		if score >= minSuggestionScore {
+			suggestions = append(suggestions, nameSuggestion{ID: id, Name: candidate[0], Score: score})
+		}
+	}
 
-		// Start transaction
-		tx := db.Begin()
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
 
-		result := tx.Create(&song)
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostAddSong: Error creating song: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to create song: " + result.Error.Error(),
-			})
+// GetSongPreview resolves a source URL for the add song form: its provider,
+// the provider's metadata and the existing artists and units it may be by
+func GetSongPreview(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sourceURL := strings.TrimSpace(c.Query("source_url"))
+		if sourceURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Source URL is required"})
 			return
 		}
 
-		// Handle artist associations
-		if artistIDsStr := strings.TrimSpace(c.PostForm("artist_ids")); artistIDsStr != "" {
-			artistIDs := strings.Split(artistIDsStr, ",")
-			for _, artistIDStr := range artistIDs {
-				if artistID, err := strconv.ParseUint(strings.TrimSpace(artistIDStr), 10, 32); err == nil {
-					songArtist := models.SongArtist{
-						SongID:   song.SongID,
-						ArtistID: uint(artistID),
-					}
-					if err := tx.Create(&songArtist).Error; err != nil {
-						log.Printf("PostAddSong: Warning - failed to associate song with artist %d: %v", artistID, err)
-					}
-				}
-			}
+		media, err := utils.ResolveMedia(sourceURL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported source URL: " + err.Error()})
+			return
 		}
 
-		// Handle unit associations
-		if unitIDsStr := strings.TrimSpace(c.PostForm("unit_ids")); unitIDsStr != "" {
-			unitIDs := strings.Split(unitIDsStr, ",")
-			for _, unitIDStr := range unitIDs {
-				if unitID, err := strconv.ParseUint(strings.TrimSpace(unitIDStr), 10, 32); err == nil {
-					songUnit := models.SongUnit{
-						SongID: song.SongID,
-						UnitID: uint(unitID),
-					}
-					if err := tx.Create(&songUnit).Error; err != nil {
-						log.Printf("PostAddSong: Warning - failed to associate song with unit %d: %v", unitID, err)
-					}
-				}
-			}
+		preview := gin.H{
+			"provider":    media.Provider,
+			"provider_id": media.ID,
+			"embed_url":   media.EmbedURL,
 		}
 
-		// Handle album associations
-		if albumIDsStr := strings.TrimSpace(c.PostForm("album_ids")); albumIDsStr != "" {
-			albumIDs := strings.Split(albumIDsStr, ",")
-			for _, albumIDStr := range albumIDs {
-				if albumID, err := strconv.ParseUint(strings.TrimSpace(albumIDStr), 10, 32); err == nil {
-					albumSong := models.AlbumSong{
-						AlbumID: uint(albumID),
-						SongID:  song.SongID,
-					}
-					if err := tx.Create(&albumSong).Error; err != nil {
-						log.Printf("PostAddSong: Warning - failed to associate song with album %d: %v", albumID, err)
-					}
-				}
+		// Warn about songs that are already in the catalog
+		existing, err := store.GetSongByProvider(media.Provider, media.ID)
+		if err == nil {
+			preview["existing_song_id"] = existing.SongID
+			preview["existing_song_name"] = existing.NameOriginal
+		} else if !errors.Is(err, database.ErrNotFound) {
+			log.Printf("GetSongPreview: Error looking up existing songs: %v", err)
+		}
+
+		metadata, err := fetchSongMetadata(c.Request.Context(), media)
+		if err != nil {
+			if !errors.Is(err, utils.ErrNoMetadata) {
+				log.Printf("GetSongPreview: %v", err)
 			}
+			metadata = &utils.MediaMetadata{}
+			preview["metadata_error"] = "Could not fetch details for this source"
 		}
+		if thumbnailURL, err := providerThumbnail(media); err == nil && thumbnailURL != "" {
+			metadata.ThumbnailURL = thumbnailURL
+		}
+		preview["title"] = metadata.Title
+		preview["uploader"] = metadata.Uploader
+		preview["duration"] = int(metadata.Duration)
+		preview["thumbnail_url"] = metadata.ThumbnailURL
 
-		tx.Commit()
+		artists, err := store.GetAllArtists()
+		if err != nil {
+			log.Printf("GetSongPreview: Error loading artists: %v", err)
+		}
+		units, err := store.GetAllUnits()
+		if err != nil {
+			log.Printf("GetSongPreview: Error loading units: %v", err)
+		}
 
-		log.Printf("PostAddSong: Successfully created song '%s' with ID %d", song.NameOriginal, song.SongID)
-		c.Redirect(http.StatusSeeOther, "/admin/add-song")
+		artistNames := make(map[uint][2]string, len(artists))
+		for _, artist := range artists {
+			artistNames[artist.ArtistID] = [2]string{artist.NameOriginal, artist.NameEnglish}
+		}
+		unitNames := make(map[uint][2]string, len(units))
+		for _, unit := range units {
+			unitNames[unit.UnitID] = [2]string{unit.NameOriginal, unit.NameEnglish}
+		}
+		preview["artist_suggestions"] = suggestNames(artistNames, metadata.Uploader, metadata.Title)
+		preview["unit_suggestions"] = suggestNames(unitNames, metadata.Uploader, metadata.Title)
+
+		c.JSON(http.StatusOK, preview)
 	}
 }
 
-func PostAddAlbum(db *gorm.DB) gin.HandlerFunc {
+func PostAddAlbum(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("PostAddAlbum: Adding new album")
 
@@ -925,22 +896,17 @@ func PostAddAlbum(db *gorm.DB) gin.HandlerFunc {
 			NameEnglish:  strings.TrimSpace(c.PostForm("name_english")),
 			AlbumArtURL:  strings.TrimSpace(c.PostForm("album_art_url")),
 			Type:         strings.TrimSpace(c.PostForm("type")),
+			CategoryID:   formCategoryID(c),
 		}
 
-		// Parse category ID if provided
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				album.CategoryID = &categoryIDUint
+		err := store.Transaction(func(tx database.Store) error {
+			if err := tx.CreateAlbum(&album); err != nil {
+				return err
 			}
-		}
-
-		result := db.Create(&album)
-		if result.Error != nil {
-			log.Printf("PostAddAlbum: Error creating album: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to create album: " + result.Error.Error(),
-			})
+			return recordAdminAudit(c, tx, models.AuditCreate, auditAlbum, album.AlbumID, nil, database.AlbumSnapshot{Album: album})
+		})
+		if err != nil {
+			adminChangeFailed(c, "create", "album", err)
 			return
 		}
 
@@ -950,21 +916,15 @@ func PostAddAlbum(db *gorm.DB) gin.HandlerFunc {
 }
 
 // View Songs page
-func GetViewSongs(db *gorm.DB) gin.HandlerFunc {
+func GetViewSongs(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetViewSongs: Loading view songs page")
 
-		var songs []models.Song
-		var categories []models.Category
-		var artists []models.Artist
-		var units []models.Unit
-		var albums []models.Album
-
-		db.Preload("Category").Preload("Artists").Preload("Units").Preload("Albums").Find(&songs)
-		db.Find(&categories)
-		db.Preload("Category").Find(&artists)
-		db.Preload("Category").Find(&units)
-		db.Preload("Category").Find(&albums)
+		songs := loadAll("GetViewSongs", store.GetAllSongs)
+		categories := loadAll("GetViewSongs", store.GetAllCategories)
+		artists := loadAll("GetViewSongs", store.GetAllArtists)
+		units := loadAll("GetViewSongs", store.GetAllUnits)
+		albums := loadAll("GetViewSongs", store.GetAllAlbums)
 
 		// Convert to JSON for JavaScript
 		songsJSON, _ := json.Marshal(songs)
@@ -992,7 +952,7 @@ func GetViewSongs(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Edit Song
-func PostEditSong(db *gorm.DB) gin.HandlerFunc {
+func PostEditSong(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostEditSong: Editing song ID: %s", idParam)
@@ -1030,180 +990,68 @@ func PostEditSong(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var song models.Song
-		result := db.First(&song, uint(id))
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"error": "Song not found",
-				})
-				return
-			}
-			log.Printf("PostEditSong: Database error: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to find song: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Update song fields
-		song.NameOriginal = nameOrig
-		song.NameEnglish = strings.TrimSpace(c.PostForm("name_english"))
-		song.SourceURL = sourceURL
-		song.ThumbnailURL = thumbnailURL
-		song.IsCover = c.PostForm("is_cover") == "true"
-
-		// Parse category ID if provided
-		song.CategoryID = nil
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				song.CategoryID = &categoryIDUint
-			}
-		}
-
-		tx := db.Begin()
-
-		result = tx.Save(&song)
-		if result.Error != nil {
-			tx.Rollback()
-			log.Printf("PostEditSong: Error updating song: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update song: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Update many2many associations
-		// Clear existing associations and rebuild them
-		if err := tx.Model(&song).Association("Artists").Clear(); err != nil {
-			tx.Rollback()
-			log.Printf("PostEditSong: Error clearing artist associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update artist associations: " + err.Error(),
-			})
-			return
-		}
-
-		if err := tx.Model(&song).Association("Units").Clear(); err != nil {
-			tx.Rollback()
-			log.Printf("PostEditSong: Error clearing unit associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update unit associations: " + err.Error(),
-			})
-			return
+		// The submitted fields, copied onto the stored song below
+		edited := models.Song{
+			NameOriginal: nameOrig,
+			NameEnglish:  strings.TrimSpace(c.PostForm("name_english")),
+			SourceURL:    sourceURL,
+			ThumbnailURL: thumbnailURL,
+			IsCover:      c.PostForm("is_cover") == "true",
+			CategoryID:   formCategoryID(c),
 		}
-
-		if err := tx.Model(&song).Association("Albums").Clear(); err != nil {
-			tx.Rollback()
-			log.Printf("PostEditSong: Error clearing album associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update album associations: " + err.Error(),
+		if _, err := setSongMedia(&edited); err != nil {
+			log.Printf("PostEditSong: Unsupported source URL: %v", err)
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"error": "Unsupported source URL: " + err.Error(),
 			})
 			return
 		}
 
-		// Add artist associations
-		if artistIDsStr := strings.TrimSpace(c.PostForm("artist_ids")); artistIDsStr != "" {
-			artistIDs := strings.Split(artistIDsStr, ",")
-			var artistIDsParsed []uint
-			for _, artistIDStr := range artistIDs {
-				if artistID, err := strconv.ParseUint(strings.TrimSpace(artistIDStr), 10, 32); err == nil {
-					artistIDsParsed = append(artistIDsParsed, uint(artistID))
-				}
-			}
-			if len(artistIDsParsed) > 0 {
-				// Fetch the actual artist records from database
-				var artists []models.Artist
-				if err := tx.Where("artist_id IN ?", artistIDsParsed).Find(&artists).Error; err != nil {
-					tx.Rollback()
-					log.Printf("PostEditSong: Error fetching artists: %v", err)
-					c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-						"error": "Failed to fetch artists: " + err.Error(),
-					})
-					return
-				}
-				if err := tx.Model(&song).Association("Artists").Append(artists); err != nil {
-					tx.Rollback()
-					log.Printf("PostEditSong: Error adding artist associations: %v", err)
-					c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-						"error": "Failed to update artist associations: " + err.Error(),
-					})
-					return
-				}
+		var song models.Song
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetSongSnapshot(uint(id), false)
+			if err != nil {
+				return err
 			}
-		}
 
-		// Add unit associations
-		if unitIDsStr := strings.TrimSpace(c.PostForm("unit_ids")); unitIDsStr != "" {
-			unitIDs := strings.Split(unitIDsStr, ",")
-			var unitIDsParsed []uint
-			for _, unitIDStr := range unitIDs {
-				if unitID, err := strconv.ParseUint(strings.TrimSpace(unitIDStr), 10, 32); err == nil {
-					unitIDsParsed = append(unitIDsParsed, uint(unitID))
-				}
-			}
-			if len(unitIDsParsed) > 0 {
-				// Fetch the actual unit records from database
-				var units []models.Unit
-				if err := tx.Where("unit_id IN ?", unitIDsParsed).Find(&units).Error; err != nil {
-					tx.Rollback()
-					log.Printf("PostEditSong: Error fetching units: %v", err)
-					c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-						"error": "Failed to fetch units: " + err.Error(),
-					})
-					return
-				}
-				if err := tx.Model(&song).Association("Units").Append(units); err != nil {
-					tx.Rollback()
-					log.Printf("PostEditSong: Error adding unit associations: %v", err)
-					c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-						"error": "Failed to update unit associations: " + err.Error(),
-					})
-					return
-				}
+			// Update song fields
+			song = before.Song
+			song.NameOriginal = edited.NameOriginal
+			song.NameEnglish = edited.NameEnglish
+			song.SourceURL = edited.SourceURL
+			song.Provider = edited.Provider
+			song.ProviderID = edited.ProviderID
+			song.ThumbnailURL = edited.ThumbnailURL
+			song.IsCover = edited.IsCover
+			song.CategoryID = edited.CategoryID
+			if err := tx.UpdateSong(&song); err != nil {
+				return err
 			}
-		}
 
-		// Add album associations
-		if albumIDsStr := strings.TrimSpace(c.PostForm("album_ids")); albumIDsStr != "" {
-			albumIDs := strings.Split(albumIDsStr, ",")
-			var albumIDsParsed []uint
-			for _, albumIDStr := range albumIDs {
-				if albumID, err := strconv.ParseUint(strings.TrimSpace(albumIDStr), 10, 32); err == nil {
-					albumIDsParsed = append(albumIDsParsed, uint(albumID))
-				}
+			// Replace the artist, unit and album associations with the
+			// submitted ones
+			if err := tx.SetSongLinks(song.SongID, formIDs(c, "artist_ids"), formIDs(c, "unit_ids"), formIDs(c, "album_ids")); err != nil {
+				return err
 			}
-			if len(albumIDsParsed) > 0 {
-				// Fetch the actual album records from database
-				var albums []models.Album
-				if err := tx.Where("album_id IN ?", albumIDsParsed).Find(&albums).Error; err != nil {
-					tx.Rollback()
-					log.Printf("PostEditSong: Error fetching albums: %v", err)
-					c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-						"error": "Failed to fetch albums: " + err.Error(),
-					})
-					return
-				}
-				if err := tx.Model(&song).Association("Albums").Append(albums); err != nil {
-					tx.Rollback()
-					log.Printf("PostEditSong: Error adding album associations: %v", err)
-					c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-						"error": "Failed to update album associations: " + err.Error(),
-					})
-					return
-				}
+
+			after, err := tx.GetSongSnapshot(song.SongID, false)
+			if err != nil {
+				return err
 			}
+			return recordAdminAudit(c, tx, models.AuditUpdate, auditSong, song.SongID, before, after)
+		})
+		if err != nil {
+			adminChangeFailed(c, "update", "song", err)
+			return
 		}
 
-		tx.Commit()
 		log.Printf("PostEditSong: Successfully updated song '%s' with ID %d", song.NameOriginal, song.SongID)
 		c.Redirect(http.StatusSeeOther, "/admin/view-songs")
 	}
 }
 
 // Delete Song
-func PostDeleteSong(db *gorm.DB) gin.HandlerFunc {
+func PostDeleteSong(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostDeleteSong: Deleting song ID: %s", idParam)
@@ -1217,81 +1065,36 @@ func PostDeleteSong(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Start transaction to delete song and its associations
-		tx := db.Begin()
-
-		// Delete all many2many associations first
-		var song models.Song
-		result := tx.First(&song, uint(id))
-		if result.Error != nil {
-			tx.Rollback()
-			if result.Error == gorm.ErrRecordNotFound {
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"error": "Song not found",
-				})
-				return
+		err = store.Transaction(func(tx database.Store) error {
+			// Keep the song, its links and votes for the audit log
+			before, err := tx.GetSongSnapshot(uint(id), true)
+			if err != nil {
+				return err
 			}
-			log.Printf("PostDeleteSong: Database error: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to find song: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Clear associations
-		if err := tx.Model(&song).Association("Artists").Clear(); err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteSong: Error clearing artist associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete song associations: " + err.Error(),
-			})
-			return
-		}
-
-		if err := tx.Model(&song).Association("Units").Clear(); err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteSong: Error clearing unit associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete song associations: " + err.Error(),
-			})
-			return
-		}
-
-		// Delete votes
-		if err := tx.Where("song_id = ?", id).Delete(&models.Vote{}).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteSong: Error deleting votes: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete song votes: " + err.Error(),
-			})
-			return
-		}
-
-		// Finally delete the song
-		if err := tx.Delete(&song).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteSong: Error deleting song: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete song: " + err.Error(),
-			})
+			// Move the song to the trash. Its associations and votes stay, so
+			// a restore brings the ratings back.
+			if err := tx.DeleteSong(before.SongID); err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditDelete, auditSong, before.SongID, before, nil)
+		})
+		if err != nil {
+			adminChangeFailed(c, "delete", "song", err)
 			return
 		}
 
-		tx.Commit()
 		log.Printf("PostDeleteSong: Successfully deleted song with ID %d", id)
 		c.Redirect(http.StatusSeeOther, "/admin/view-songs")
 	}
 }
 
 // View Albums page
-func GetViewAlbums(db *gorm.DB) gin.HandlerFunc {
+func GetViewAlbums(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetViewAlbums: Loading view albums page")
 
-		var albums []models.Album
-		var categories []models.Category
-		db.Preload("Category").Preload("Songs").Find(&albums)
-		db.Find(&categories)
+		albums := loadAll("GetViewAlbums", store.GetAllAlbums)
+		categories := loadAll("GetViewAlbums", store.GetAllCategories)
 
 		// Convert to JSON for JavaScript
 		albumsJSON, _ := json.Marshal(albums)
@@ -1310,7 +1113,7 @@ func GetViewAlbums(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Edit Album
-func PostEditAlbum(db *gorm.DB) gin.HandlerFunc {
+func PostEditAlbum(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostEditAlbum: Editing album ID: %s", idParam)
@@ -1333,42 +1136,28 @@ func PostEditAlbum(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var album models.Album
-		result := db.First(&album, uint(id))
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"error": "Album not found",
-				})
-				return
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetAlbumSnapshot(uint(id))
+			if err != nil {
+				return err
 			}
-			log.Printf("PostEditAlbum: Database error: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to find album: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Update album fields
-		album.NameOriginal = nameOriginal
-		album.NameEnglish = strings.TrimSpace(c.PostForm("name_english"))
-		album.AlbumArtURL = strings.TrimSpace(c.PostForm("album_art_url"))
-		album.Type = strings.TrimSpace(c.PostForm("type"))
 
-		// Parse category ID if provided
-		album.CategoryID = nil
-		if categoryIDStr := strings.TrimSpace(c.PostForm("category_id")); categoryIDStr != "" {
-			if categoryID, err := strconv.ParseUint(categoryIDStr, 10, 32); err == nil {
-				categoryIDUint := uint(categoryID)
-				album.CategoryID = &categoryIDUint
+			// Update album fields
+			album = before.Album
+			album.NameOriginal = nameOriginal
+			album.NameEnglish = strings.TrimSpace(c.PostForm("name_english"))
+			album.AlbumArtURL = strings.TrimSpace(c.PostForm("album_art_url"))
+			album.Type = strings.TrimSpace(c.PostForm("type"))
+			album.CategoryID = formCategoryID(c)
+			if err := tx.UpdateAlbum(&album); err != nil {
+				return err
 			}
-		}
 
-		result = db.Save(&album)
-		if result.Error != nil {
-			log.Printf("PostEditAlbum: Error updating album: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to update album: " + result.Error.Error(),
-			})
+			after := database.AlbumSnapshot{Album: album, SongIDs: before.SongIDs}
+			return recordAdminAudit(c, tx, models.AuditUpdate, auditAlbum, album.AlbumID, before, after)
+		})
+		if err != nil {
+			adminChangeFailed(c, "update", "album", err)
 			return
 		}
 
@@ -1378,7 +1167,7 @@ func PostEditAlbum(db *gorm.DB) gin.HandlerFunc {
 }
 
 // Delete Album
-func PostDeleteAlbum(db *gorm.DB) gin.HandlerFunc {
+func PostDeleteAlbum(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("PostDeleteAlbum: Deleting album ID: %s", idParam)
@@ -1392,48 +1181,22 @@ func PostDeleteAlbum(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Start transaction to delete album and its associations
-		tx := db.Begin()
-
-		// Get album to clear associations
-		var album models.Album
-		result := tx.First(&album, uint(id))
-		if result.Error != nil {
-			tx.Rollback()
-			if result.Error == gorm.ErrRecordNotFound {
-				c.HTML(http.StatusNotFound, "error.html", gin.H{
-					"error": "Album not found",
-				})
-				return
+		err = store.Transaction(func(tx database.Store) error {
+			before, err := tx.GetAlbumSnapshot(uint(id))
+			if err != nil {
+				return err
 			}
-			log.Printf("PostDeleteAlbum: Database error: %v", result.Error)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to find album: " + result.Error.Error(),
-			})
-			return
-		}
-
-		// Clear song associations
-		if err := tx.Model(&album).Association("Songs").Clear(); err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteAlbum: Error clearing song associations: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete album associations: " + err.Error(),
-			})
-			return
-		}
-
-		// Delete the album
-		if err := tx.Delete(&album).Error; err != nil {
-			tx.Rollback()
-			log.Printf("PostDeleteAlbum: Error deleting album: %v", err)
-			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to delete album: " + err.Error(),
-			})
+			// Move the album to the trash; its songs stay linked for a restore
+			if err := tx.DeleteAlbum(before.AlbumID); err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditDelete, auditAlbum, before.AlbumID, before, nil)
+		})
+		if err != nil {
+			adminChangeFailed(c, "delete", "album", err)
 			return
 		}
 
-		tx.Commit()
 		log.Printf("PostDeleteAlbum: Successfully deleted album with ID %d", id)
 		c.Redirect(http.StatusSeeOther, "/admin/albums")
 	}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/backup"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminPagesRender(t *testing.T) {
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+	artist := createTestArtist(t, store, "Aqours")
+	createTestSong(t, store, "Aozora", artist)
+	createTestSong(t, store, "Mijuku", artist)
+
+	pages := map[string]func(database.Store) gin.HandlerFunc{
+		"/admin":              GetAdmin,
+		"/admin/add-category": GetAddCategory,
+		"/admin/add-unit":     GetAddUnit,
+		"/admin/add-artist":   GetAddArtist,
+		"/admin/add-song":     GetAddSong,
+		"/admin/add-album":    GetAddAlbum,
+		"/admin/categories":   GetViewCategories,
+		"/admin/units":        GetViewUnits,
+		"/admin/artists":      GetViewArtists,
+		"/admin/view-songs":   GetViewSongs,
+		"/admin/albums":       GetViewAlbums,
+	}
+	r := newTestRouter(t, admin)
+	for path, handler := range pages {
+		r.GET(path, handler(store))
+	}
+	for path := range pages {
+		w := serveForm(r, http.MethodGet, path, nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d; want 200", path, w.Code)
+		}
+	}
+
+	w := serveForm(r, http.MethodGet, "/admin", nil)
+	if !strings.Contains(w.Body.String(), "View Songs (2)") {
+		t.Errorf("admin index does not count the two songs")
+	}
+}
+
+func TestPostAddUnitLinksArtists(t *testing.T) {
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+	first := createTestArtist(t, store, "first")
+	second := createTestArtist(t, store, "second")
+
+	r := newTestRouter(t, admin)
+	r.POST("/admin/add-unit", PostAddUnit(store))
+	w := serveForm(r, http.MethodPost, "/admin/add-unit", url.Values{
+		"name_original": {"Guilty Kiss"},
+		// Unknown IDs and junk are skipped
+		"artist_ids": {fmt.Sprintf("%d, %d,999,junk", first.ArtistID, second.ArtistID)},
+	})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d; want 303", w.Code)
+	}
+
+	event := lastAuditEvent(t, store)
+	if event.Action != models.AuditCreate || event.EntityType != auditUnit {
+		t.Fatalf("last audit event is %s %s; want a unit create", event.Action, event.EntityType)
+	}
+	var after database.UnitSnapshot
+	if err := json.Unmarshal(event.After, &after); err != nil {
+		t.Fatalf("audit after: %v", err)
+	}
+	if want := []uint{first.ArtistID, second.ArtistID}; !slices.Equal(after.ArtistIDs, want) {
+		t.Errorf("audited artists = %v; want %v", after.ArtistIDs, want)
+	}
+	snapshot, err := store.GetUnitSnapshot(after.UnitID)
+	if err != nil {
+		t.Fatalf("GetUnitSnapshot: %v", err)
+	}
+	if snapshot.NameOriginal != "Guilty Kiss" || !slices.Equal(snapshot.ArtistIDs, after.ArtistIDs) {
+		t.Errorf("stored unit = %+v; want it as audited", snapshot)
+	}
+}
+
+func TestPostEditSongReplacesLinks(t *testing.T) {
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+	before := createTestArtist(t, store, "before")
+	after := createTestArtist(t, store, "after")
+	song := createTestSong(t, store, "song", before)
+
+	r := newTestRouter(t, admin)
+	r.POST("/admin/songs/:id/edit", PostEditSong(store))
+	w := serveForm(r, http.MethodPost, fmt.Sprintf("/admin/songs/%d/edit", song.SongID), url.Values{
+		"name_original": {"renamed"},
+		"source_url":    {"https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		"thumbnail_url": {"https://example.com/renamed.jpg"},
+		"artist_ids":    {fmt.Sprint(after.ArtistID)},
+	})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d; want 303", w.Code)
+	}
+
+	snapshot, err := store.GetSongSnapshot(song.SongID, false)
+	if err != nil {
+		t.Fatalf("GetSongSnapshot: %v", err)
+	}
+	if snapshot.NameOriginal != "renamed" || snapshot.Provider != "youtube" || snapshot.ProviderID != "dQw4w9WgXcQ" {
+		t.Errorf("song = %+v; want the edited fields", snapshot.Song)
+	}
+	if !slices.Equal(snapshot.ArtistIDs, []uint{after.ArtistID}) {
+		t.Errorf("artists = %v; want only %d", snapshot.ArtistIDs, after.ArtistID)
+	}
+
+	event := lastAuditEvent(t, store)
+	var audited database.SongSnapshot
+	if err := json.Unmarshal(event.Before, &audited); err != nil {
+		t.Fatalf("audit before: %v", err)
+	}
+	if event.Action != models.AuditUpdate || !slices.Equal(audited.ArtistIDs, []uint{before.ArtistID}) {
+		t.Errorf("audit event %s before = %+v; want the old artist", event.Action, audited)
+	}
+}
+
+func TestAdminChangesOfMissingEntities(t *testing.T) {
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+
+	r := newTestRouter(t, admin)
+	r.POST("/admin/categories/:id/edit", PostEditCategory(store))
+	r.POST("/admin/units/:id/edit", PostEditUnit(store))
+	r.POST("/admin/albums/:id/delete", PostDeleteAlbum(store))
+	r.POST("/admin/songs/:id/delete", PostDeleteSong(store))
+	tests := []struct {
+		target string
+		form   url.Values
+		want   int
+	}{
+		{"/admin/categories/9/edit", url.Values{"name": {"name"}}, http.StatusNotFound},
+		{"/admin/units/9/edit", url.Values{"name_original": {"name"}}, http.StatusNotFound},
+		{"/admin/units/9/edit", url.Values{}, http.StatusBadRequest},
+		{"/admin/units/nine/edit", url.Values{"name_original": {"name"}}, http.StatusBadRequest},
+		{"/admin/albums/9/delete", url.Values{}, http.StatusNotFound},
+		{"/admin/songs/9/delete", url.Values{}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serveForm(r, http.MethodPost, tt.target, tt.form); w.Code != tt.want {
+			t.Errorf("POST %s = %d; want %d", tt.target, w.Code, tt.want)
+		}
+	}
+}
+
+// TestPostDeleteUnitWithSongs moves a unit that still has songs to the
+// trash and brings it back with its links from the audit log
+func TestPostDeleteUnitWithSongs(t *testing.T) {
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+	song := createTestSong(t, store, "song")
+	unit := models.Unit{NameOriginal: "unit"}
+	if err := store.CreateUnit(&unit); err != nil {
+		t.Fatalf("CreateUnit: %v", err)
+	}
+	if err := store.SetSongLinks(song.SongID, nil, []uint{unit.UnitID}, nil); err != nil {
+		t.Fatalf("SetSongLinks: %v", err)
+	}
+
+	r := newTestRouter(t, admin)
+	r.POST("/admin/units/:id/delete", PostDeleteUnit(store))
+	r.POST("/admin/audit/:id/restore", PostRestoreAuditEvent(store))
+	w := serveForm(r, http.MethodPost, fmt.Sprintf("/admin/units/%d/delete", unit.UnitID), url.Values{})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("delete status = %d; want 303", w.Code)
+	}
+	if _, err := store.GetUnitByID(unit.UnitID); err == nil {
+		t.Fatalf("unit %d still listed after the delete", unit.UnitID)
+	}
+	trashed, err := store.ListTrash(database.TrashUnit)
+	if err != nil || len(trashed) != 1 {
+		t.Fatalf("ListTrash = %v, %v; want the unit", trashed, err)
+	}
+
+	deleted := lastAuditEvent(t, store)
+	w = serveForm(r, http.MethodPost, fmt.Sprintf("/admin/audit/%d/restore", deleted.EventID), url.Values{})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("restore status = %d; want 303", w.Code)
+	}
+	snapshot, err := store.GetUnitSnapshot(unit.UnitID)
+	if err != nil {
+		t.Fatalf("GetUnitSnapshot: %v", err)
+	}
+	if !slices.Equal(snapshot.SongIDs, []uint{song.SongID}) {
+		t.Errorf("restored unit songs = %v; want %d", snapshot.SongIDs, song.SongID)
+	}
+
+	// The unit exists again, so the same event cannot restore it twice
+	w = serveForm(r, http.MethodPost, fmt.Sprintf("/admin/audit/%d/restore", deleted.EventID), url.Values{})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("second restore status = %d; want 400", w.Code)
+	}
+}
+
+func TestPostRestoreAuditEventRecreatesPurgedSong(t *testing.T) {
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+	voter := createTestUser(t, store, "voter")
+	artist := createTestArtist(t, store, "artist")
+	song := createTestSong(t, store, "song", artist)
+	for _, user := range []*models.User{admin, voter} {
+		if err := store.UpsertVote(&models.Vote{UserID: user.UserID, SongID: song.SongID, Rating: 8}); err != nil {
+			t.Fatalf("UpsertVote: %v", err)
+		}
+	}
+
+	r := newTestRouter(t, admin)
+	r.POST("/admin/songs/:id/delete", PostDeleteSong(store))
+	r.POST("/admin/audit/:id/restore", PostRestoreAuditEvent(store))
+	if w := serveForm(r, http.MethodPost, fmt.Sprintf("/admin/songs/%d/delete", song.SongID), url.Values{}); w.Code != http.StatusSeeOther {
+		t.Fatalf("delete status = %d; want 303", w.Code)
+	}
+	deleted := lastAuditEvent(t, store)
+	if err := store.PurgeFromTrash(database.TrashSong, song.SongID); err != nil {
+		t.Fatalf("PurgeFromTrash: %v", err)
+	}
+	// Votes of users that are gone by now stay gone
+	if err := store.DeleteUser(voter.UserID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	w := serveForm(r, http.MethodPost, fmt.Sprintf("/admin/audit/%d/restore", deleted.EventID), url.Values{})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("restore status = %d; want 303", w.Code)
+	}
+	snapshot, err := store.GetSongSnapshot(song.SongID, true)
+	if err != nil {
+		t.Fatalf("GetSongSnapshot: %v", err)
+	}
+	if !slices.Equal(snapshot.ArtistIDs, []uint{artist.ArtistID}) {
+		t.Errorf("artists = %v; want %d", snapshot.ArtistIDs, artist.ArtistID)
+	}
+	if len(snapshot.Votes) != 1 || snapshot.Votes[0].UserID != admin.UserID {
+		t.Errorf("votes = %+v; want only the admin's", snapshot.Votes)
+	}
+	if event := lastAuditEvent(t, store); event.Action != models.AuditRestore || event.EntityID != fmt.Sprint(song.SongID) {
+		t.Errorf("last audit event is %s of %s; want the restore", event.Action, event.EntityID)
+	}
+}
+
+func TestGetSongPreviewFlagsExistingSong(t *testing.T) {
+	useTestMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"title": "Aozora Jumping Heart", "author_name": "Aqours"}`))
+	})
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+	artist := createTestArtist(t, store, "Aqours")
+	song := models.Song{
+		NameOriginal: "existing",
+		SourceURL:    "https://youtu.be/dQw4w9WgXcQ",
+		Provider:     "youtube",
+		ProviderID:   "dQw4w9WgXcQ",
+		ThumbnailURL: "https://example.com/existing.jpg",
+	}
+	if err := store.CreateSong(&song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+
+	r := newTestRouter(t, admin)
+	r.GET("/admin/songs/preview", GetSongPreview(store))
+	w := serveForm(r, http.MethodGet, "/admin/songs/preview?source_url="+url.QueryEscape("https://www.youtube.com/watch?v=dQw4w9WgXcQ"), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200", w.Code)
+	}
+	var preview struct {
+		ExistingSongID    uint             `json:"existing_song_id"`
+		ArtistSuggestions []nameSuggestion `json:"artist_suggestions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if preview.ExistingSongID != song.SongID {
+		t.Errorf("existing song = %d; want %d", preview.ExistingSongID, song.SongID)
+	}
+	if len(preview.ArtistSuggestions) != 1 || preview.ArtistSuggestions[0].ID != artist.ArtistID {
+		t.Errorf("artist suggestions = %+v; want %d", preview.ArtistSuggestions, artist.ArtistID)
+	}
+}
+
+// fakeExporter writes a fixed archive and remembers the options it got
+type fakeExporter struct {
+	opts backup.ExportOptions
+}
+
+func (e *fakeExporter) Export(w io.Writer, opts backup.ExportOptions) (*backup.Manifest, error) {
+	e.opts = opts
+	_, err := io.WriteString(w, "archive")
+	return &backup.Manifest{}, err
+}
+
+func TestGetExport(t *testing.T) {
+	exporter := &fakeExporter{}
+	r := newTestRouter(t, createTestAdmin(t, memory.New()))
+	r.GET("/admin/export", GetExport(exporter))
+
+	w := serveForm(r, http.MethodGet, "/admin/export?format=csv", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "archive" {
+		t.Fatalf("export = %d %q; want the archive", w.Code, w.Body.String())
+	}
+	if exporter.opts.Encoding != backup.EncodingCSV || exporter.opts.Credentials {
+		t.Errorf("export options = %+v; want CSV without credentials", exporter.opts)
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "-csv.zip") {
+		t.Errorf("Content-Disposition = %q; want a CSV archive name", w.Header().Get("Content-Disposition"))
+	}
+
+	if w := serveForm(r, http.MethodGet, "/admin/export?format=xml", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("xml export status = %d; want 400", w.Code)
+	}
+}
+
+func TestGetExportLeavesOutCredentials(t *testing.T) {
+	store := memory.New()
+	admin := &models.User{Username: "admin", Role: models.RoleAdmin, PasswordHash: "secret-hash", Email: "admin@example.com"}
+	if err := store.CreateUser(admin); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	r := newTestRouter(t, admin)
+	r.GET("/admin/export", GetExport(backup.DBExporter{DB: store}))
+
+	for _, format := range []string{"json", "csv"} {
+		w := serveForm(r, http.MethodGet, "/admin/export?format="+format, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s export status = %d; want 200", format, w.Code)
+		}
+		archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		if err != nil {
+			t.Fatalf("%s export is not a zip file: %v", format, err)
+		}
+		for _, file := range archive.File {
+			f, err := file.Open()
+			if err != nil {
+				t.Fatalf("open %s: %v", file.Name, err)
+			}
+			content, _ := io.ReadAll(f)
+			f.Close()
+			for _, secret := range []string{"secret-hash", "admin@example.com", "password_hash"} {
+				if bytes.Contains(content, []byte(secret)) {
+					t.Errorf("%s export: %s contains %q", format, file.Name, secret)
+				}
+			}
+			if file.Name == "tables/users."+format && !bytes.Contains(content, []byte("admin")) {
+				t.Errorf("%s export: %s does not list the admin", format, file.Name)
+			}
+		}
+	}
+}
@@ -1,24 +1,165 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/CptPie/SyncRate/database"
 	"github.com/CptPie/SyncRate/models"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
+// storeErrorStatus maps a storage error to the HTTP status it should produce
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrValidation):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseIDQuery parses an optional numeric query parameter into a one-element
+// ID filter; a missing parameter yields nil (no filter)
+func parseIDQuery(c *gin.Context, name string) ([]uint, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return []uint{uint(id)}, nil
+}
+
+// parseUintQuery parses an optional numeric query parameter; a missing
+// parameter yields nil
+func parseUintQuery(c *gin.Context, name string) (*uint, error) {
+	ids, err := parseIDQuery(c, name)
+	if err != nil || ids == nil {
+		return nil, err
+	}
+	return &ids[0], nil
+}
+
+// parseIntQuery parses an optional integer query parameter
+func parseIntQuery(c *gin.Context, name string) (*int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &n, nil
+}
+
+// parseBoolQuery parses an optional true/false query parameter
+func parseBoolQuery(c *gin.Context, name string) (*bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &b, nil
+}
+
+// parseListOptions reads the paging query parameters shared by the list
+// endpoints: limit, cursor, sort, order (asc or desc) and include, a comma
+// separated list of relations
+func parseListOptions(c *gin.Context) (database.ListOptions, error) {
+	opts := database.ListOptions{
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return opts, errors.New("invalid limit")
+		}
+		opts.Limit = n
+	}
+	for _, include := range strings.Split(c.Query("include"), ",") {
+		if include = strings.TrimSpace(include); include != "" {
+			opts.Include = append(opts.Include, include)
+		}
+	}
+	return opts, nil
+}
+
+// parseSongFilter reads the song list filters. voted_by_me needs a logged-in
+// user and keeps the songs they have (true) or have not (false) rated.
+func parseSongFilter(c *gin.Context) (database.SongFilter, error) {
+	var filter database.SongFilter
+	var err error
+	if filter.CategoryID, err = parseUintQuery(c, "category_id"); err != nil {
+		return filter, err
+	}
+	if filter.IsCover, err = parseBoolQuery(c, "is_cover"); err != nil {
+		return filter, err
+	}
+	if filter.ArtistID, err = parseUintQuery(c, "artist_id"); err != nil {
+		return filter, err
+	}
+	if filter.UnitID, err = parseUintQuery(c, "unit_id"); err != nil {
+		return filter, err
+	}
+	if filter.AlbumID, err = parseUintQuery(c, "album_id"); err != nil {
+		return filter, err
+	}
+	filter.AlbumType = c.Query("album_type")
+	if filter.MinAverageRating, err = parseIntQuery(c, "min_rating"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAverageRating, err = parseIntQuery(c, "max_rating"); err != nil {
+		return filter, err
+	}
+
+	votedByMe, err := parseBoolQuery(c, "voted_by_me")
+	if err != nil || votedByMe == nil {
+		return filter, err
+	}
+	value, exists := c.Get("user_id")
+	if !exists || value == nil {
+		return filter, errors.New("voted_by_me needs a logged-in user")
+	}
+	userID := value.(uint)
+	if *votedByMe {
+		filter.RatedBy = &userID
+	} else {
+		filter.NotRatedBy = &userID
+	}
+	return filter, nil
+}
+
 // ============= SONG API ENDPOINTS =============
 
 type CreateSongRequest struct {
-	NameOriginal string  `json:"name_original" binding:"required"`
+	NameOriginal string  `json:"name_original"`
 	NameEnglish  string  `json:"name_english"`
 	SourceURL    string  `json:"source_url" binding:"required"`
-	ThumbnailURL string  `json:"thumbnail_url" binding:"required"`
+	ThumbnailURL string  `json:"thumbnail_url"`
+	Duration     int     `json:"duration"` // Seconds
 	CategoryID   *uint   `json:"category_id"`
 	IsCover      bool    `json:"is_cover"`
 	ArtistIDs    []uint  `json:"artist_ids"`
@@ -26,7 +167,7 @@ type CreateSongRequest struct {
 	AlbumIDs     []uint  `json:"album_ids"`
 }
 
-func PostAPISong(db *gorm.DB) gin.HandlerFunc {
+func PostAPISong(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateSongRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -39,90 +180,82 @@ func PostAPISong(db *gorm.DB) gin.HandlerFunc {
 			NameEnglish:  req.NameEnglish,
 			SourceURL:    req.SourceURL,
 			ThumbnailURL: req.ThumbnailURL,
+			Duration:     max(0, req.Duration),
 			CategoryID:   req.CategoryID,
 			IsCover:      req.IsCover,
 		}
 
-		// Start transaction
-		tx := db.Begin()
-		defer func() {
-			if r := recover(); r != nil {
-				tx.Rollback()
-			}
-		}()
+		media, err := setSongMedia(&song)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Create song
-		if err := tx.Create(&song).Error; err != nil {
-			tx.Rollback()
-			log.Printf("Error creating song: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create song"})
+		// Fill in what was left out from the source
+		if song.ThumbnailURL == "" {
+			if song.ThumbnailURL, err = providerThumbnail(media); err != nil {
+				log.Printf("Error getting %s thumbnail: %v", media.Provider, err)
+			}
+		}
+		fillSongMetadata(c.Request.Context(), &song, media)
+		if song.NameOriginal == "" || song.ThumbnailURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name_original and thumbnail_url are required when they cannot be fetched from the source"})
 			return
 		}
 
-		// Associate artists
+		// Resolve artists
 		if len(req.ArtistIDs) > 0 {
-			var artists []models.Artist
-			if err := tx.Where("artist_id IN ?", req.ArtistIDs).Find(&artists).Error; err != nil {
-				tx.Rollback()
+			artists, err := store.GetArtistsByIDs(req.ArtistIDs)
+			if err != nil {
 				log.Printf("Error finding artists: %v", err)
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid artist IDs"})
 				return
 			}
 			if len(artists) != len(req.ArtistIDs) {
-				tx.Rollback()
 				log.Printf("Artist count mismatch: requested %d, found %d", len(req.ArtistIDs), len(artists))
 				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Some artist IDs not found: requested %d, found %d", len(req.ArtistIDs), len(artists))})
 				return
 			}
-			if err := tx.Model(&song).Association("Artists").Append(&artists); err != nil {
-				tx.Rollback()
-				log.Printf("Error associating artists: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate artists"})
-				return
-			}
-			log.Printf("Associated %d artists to song %d", len(artists), song.SongID)
+			song.Artists = artists
 		}
 
-		// Associate units
+		// Resolve units
 		if len(req.UnitIDs) > 0 {
-			var units []models.Unit
-			if err := tx.Where("unit_id IN ?", req.UnitIDs).Find(&units).Error; err != nil {
-				tx.Rollback()
+			units, err := store.GetUnitsByIDs(req.UnitIDs)
+			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unit IDs"})
 				return
 			}
-			if err := tx.Model(&song).Association("Units").Append(&units); err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate units"})
-				return
-			}
+			song.Units = units
 		}
 
-		// Associate albums
+		// Resolve albums
 		if len(req.AlbumIDs) > 0 {
-			var albums []models.Album
-			if err := tx.Where("album_id IN ?", req.AlbumIDs).Find(&albums).Error; err != nil {
-				tx.Rollback()
+			albums, err := store.GetAlbumsByIDs(req.AlbumIDs)
+			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album IDs"})
 				return
 			}
-			if err := tx.Model(&song).Association("Albums").Append(&albums); err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate albums"})
-				return
-			}
+			song.Albums = albums
 		}
 
-		// Commit transaction
-		if err := tx.Commit().Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		// Create song together with its associations
+		if err := store.CreateSong(&song); err != nil {
+			log.Printf("Error creating song: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to create song: " + err.Error()})
 			return
 		}
+		log.Printf("Associated %d artists to song %d", len(song.Artists), song.SongID)
 
-		// Load full song with associations
-		db.Preload("Artists").Preload("Units").Preload("Category").Preload("Albums").First(&song, song.SongID)
+		recordAudit(c, store, newAuditEvent(c, models.AuditCreate, auditSong, song.SongID, nil, database.NewSongSnapshot(song)))
 
-		c.JSON(http.StatusCreated, song)
+		// Load full song with associations
+		created, err := store.GetSongByID(song.SongID)
+		if err != nil {
+			c.JSON(http.StatusCreated, song)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
 	}
 }
 
@@ -137,7 +270,7 @@ type CreateArtistRequest struct {
 	UnitIDs        []uint `json:"unit_ids"`
 }
 
-func PostAPIArtist(db *gorm.DB) gin.HandlerFunc {
+func PostAPIArtist(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateArtistRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -153,47 +286,32 @@ func PostAPIArtist(db *gorm.DB) gin.HandlerFunc {
 			CategoryID:     req.CategoryID,
 		}
 
-		// Start transaction
-		tx := db.Begin()
-		defer func() {
-			if r := recover(); r != nil {
-				tx.Rollback()
-			}
-		}()
-
-		// Create artist
-		if err := tx.Create(&artist).Error; err != nil {
-			tx.Rollback()
-			log.Printf("Error creating artist: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create artist"})
-			return
-		}
-
-		// Associate units
+		// Resolve units
 		if len(req.UnitIDs) > 0 {
-			var units []models.Unit
-			if err := tx.Where("unit_id IN ?", req.UnitIDs).Find(&units).Error; err != nil {
-				tx.Rollback()
+			units, err := store.GetUnitsByIDs(req.UnitIDs)
+			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unit IDs"})
 				return
 			}
-			if err := tx.Model(&artist).Association("Units").Append(&units); err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate units"})
-				return
-			}
+			artist.Units = units
 		}
 
-		// Commit transaction
-		if err := tx.Commit().Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		// Create artist together with its associations
+		if err := store.CreateArtist(&artist); err != nil {
+			log.Printf("Error creating artist: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to create artist: " + err.Error()})
 			return
 		}
 
-		// Load full artist with associations
-		db.Preload("Units").Preload("Category").First(&artist, artist.ArtistID)
+		recordAudit(c, store, newAuditEvent(c, models.AuditCreate, auditArtist, artist.ArtistID, nil, database.NewArtistSnapshot(artist)))
 
-		c.JSON(http.StatusCreated, artist)
+		// Load full artist with associations
+		created, err := store.GetArtistByID(artist.ArtistID)
+		if err != nil {
+			c.JSON(http.StatusCreated, artist)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
 	}
 }
 
@@ -208,7 +326,7 @@ type CreateAlbumRequest struct {
 	SongIDs      []uint `json:"song_ids"`
 }
 
-func PostAPIAlbum(db *gorm.DB) gin.HandlerFunc {
+func PostAPIAlbum(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateAlbumRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -224,47 +342,32 @@ func PostAPIAlbum(db *gorm.DB) gin.HandlerFunc {
 			CategoryID:   req.CategoryID,
 		}
 
-		// Start transaction
-		tx := db.Begin()
-		defer func() {
-			if r := recover(); r != nil {
-				tx.Rollback()
-			}
-		}()
-
-		// Create album
-		if err := tx.Create(&album).Error; err != nil {
-			tx.Rollback()
-			log.Printf("Error creating album: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create album"})
-			return
-		}
-
-		// Associate songs
+		// Resolve songs
 		if len(req.SongIDs) > 0 {
-			var songs []models.Song
-			if err := tx.Where("song_id IN ?", req.SongIDs).Find(&songs).Error; err != nil {
-				tx.Rollback()
+			songs, err := store.GetSongsByIDs(req.SongIDs)
+			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song IDs"})
 				return
 			}
-			if err := tx.Model(&album).Association("Songs").Append(&songs); err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate songs"})
-				return
-			}
+			album.Songs = songs
 		}
 
-		// Commit transaction
-		if err := tx.Commit().Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		// Create album together with its associations
+		if err := store.CreateAlbum(&album); err != nil {
+			log.Printf("Error creating album: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to create album: " + err.Error()})
 			return
 		}
 
-		// Load full album with associations
-		db.Preload("Songs").Preload("Category").First(&album, album.AlbumID)
+		recordAudit(c, store, newAuditEvent(c, models.AuditCreate, auditAlbum, album.AlbumID, nil, database.NewAlbumSnapshot(album)))
 
-		c.JSON(http.StatusCreated, album)
+		// Load full album with associations
+		created, err := store.GetAlbumByID(album.AlbumID)
+		if err != nil {
+			c.JSON(http.StatusCreated, album)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
 	}
 }
 
@@ -279,7 +382,7 @@ type CreateUnitRequest struct {
 	ArtistIDs      []uint `json:"artist_ids"`
 }
 
-func PostAPIUnit(db *gorm.DB) gin.HandlerFunc {
+func PostAPIUnit(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateUnitRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -295,47 +398,32 @@ func PostAPIUnit(db *gorm.DB) gin.HandlerFunc {
 			CategoryID:     req.CategoryID,
 		}
 
-		// Start transaction
-		tx := db.Begin()
-		defer func() {
-			if r := recover(); r != nil {
-				tx.Rollback()
-			}
-		}()
-
-		// Create unit
-		if err := tx.Create(&unit).Error; err != nil {
-			tx.Rollback()
-			log.Printf("Error creating unit: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create unit"})
-			return
-		}
-
-		// Associate artists
+		// Resolve artists
 		if len(req.ArtistIDs) > 0 {
-			var artists []models.Artist
-			if err := tx.Where("artist_id IN ?", req.ArtistIDs).Find(&artists).Error; err != nil {
-				tx.Rollback()
+			artists, err := store.GetArtistsByIDs(req.ArtistIDs)
+			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid artist IDs"})
 				return
 			}
-			if err := tx.Model(&unit).Association("Artists").Append(&artists); err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate artists"})
-				return
-			}
+			unit.Artists = artists
 		}
 
-		// Commit transaction
-		if err := tx.Commit().Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		// Create unit together with its associations
+		if err := store.CreateUnit(&unit); err != nil {
+			log.Printf("Error creating unit: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to create unit: " + err.Error()})
 			return
 		}
 
-		// Load full unit with associations
-		db.Preload("Artists").Preload("Category").First(&unit, unit.UnitID)
+		recordAudit(c, store, newAuditEvent(c, models.AuditCreate, auditUnit, unit.UnitID, nil, database.NewUnitSnapshot(unit)))
 
-		c.JSON(http.StatusCreated, unit)
+		// Load full unit with associations
+		created, err := store.GetUnitByID(unit.UnitID)
+		if err != nil {
+			c.JSON(http.StatusCreated, unit)
+			return
+		}
+		c.JSON(http.StatusCreated, created)
 	}
 }
 
@@ -345,7 +433,7 @@ type CreateCategoryRequest struct {
 	Name string `json:"name" binding:"required"`
 }
 
-func PostAPICategory(db *gorm.DB) gin.HandlerFunc {
+func PostAPICategory(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateCategoryRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -357,11 +445,12 @@ func PostAPICategory(db *gorm.DB) gin.HandlerFunc {
 			Name: req.Name,
 		}
 
-		if err := db.Create(&category).Error; err != nil {
+		if err := store.CreateCategory(&category); err != nil {
 			log.Printf("Error creating category: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to create category: " + err.Error()})
 			return
 		}
+		recordAudit(c, store, newAuditEvent(c, models.AuditCreate, auditCategory, category.CategoryID, nil, category))
 
 		c.JSON(http.StatusCreated, category)
 	}
@@ -369,84 +458,99 @@ func PostAPICategory(db *gorm.DB) gin.HandlerFunc {
 
 // ============= VOTE API ENDPOINTS =============
 
+// CreateVoteRequest is a vote by the caller; who votes comes from the
+// session or token, never from the body
 type CreateVoteRequest struct {
-	UserID  uint   `json:"user_id" binding:"required"`
 	SongID  uint   `json:"song_id" binding:"required"`
 	Rating  int    `json:"rating" binding:"required,min=1,max=10"`
 	Comment string `json:"comment"`
 }
 
-func PostAPIVote(db *gorm.DB) gin.HandlerFunc {
+func PostAPIVote(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateVoteRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		// Check if user exists
-		var user models.User
-		if err := db.First(&user, req.UserID).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
-			return
-		}
+		userID := c.GetUint("user_id")
 
 		// Check if song exists
-		var song models.Song
-		if err := db.First(&song, req.SongID).Error; err != nil {
+		if exists, err := store.SongExists(req.SongID); err != nil || !exists {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Song not found"})
 			return
 		}
 
 		// Check if vote already exists
-		var existingVote models.Vote
-		result := db.Where("user_id = ? AND song_id = ?", req.UserID, req.SongID).First(&existingVote)
-
-		if result.Error == nil {
-			// Update existing vote
-			existingVote.Rating = req.Rating
-			existingVote.Comment = req.Comment
-			if err := db.Save(&existingVote).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vote"})
-				return
-			}
-			c.JSON(http.StatusOK, existingVote)
+		existed, err := store.VoteExists(userID, req.SongID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save vote"})
 			return
 		}
 
-		// Create new vote
 		vote := models.Vote{
-			UserID:  req.UserID,
+			UserID:  userID,
 			SongID:  req.SongID,
 			Rating:  req.Rating,
 			Comment: req.Comment,
 		}
 
-		if err := db.Create(&vote).Error; err != nil {
-			log.Printf("Error creating vote: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vote"})
+		// Keep the old vote for the audit log
+		var previous *models.Vote
+		if existed {
+			if previous, err = store.GetVote(userID, req.SongID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save vote"})
+				return
+			}
+		}
+
+		if err := store.UpsertVote(&vote); err != nil {
+			log.Printf("Error saving vote: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to save vote"})
 			return
 		}
 
+		if existed {
+			recordAudit(c, store, newAuditEvent(c, models.AuditUpdate, auditVote, vote.VoteID, previous, vote))
+		} else {
+			recordAudit(c, store, newAuditEvent(c, models.AuditCreate, auditVote, vote.VoteID, nil, vote))
+		}
+
+		if existed {
+			c.JSON(http.StatusOK, vote)
+			return
+		}
 		c.JSON(http.StatusCreated, vote)
 	}
 }
 
 // ============= GET ENDPOINTS FOR LISTING =============
 
-func GetAPISongs(db *gorm.DB) gin.HandlerFunc {
+// GetAPISongs pages through songs with their average rating and vote count
+func GetAPISongs(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var songs []models.Song
-		result := db.Preload("Artists").Preload("Units").Preload("Category").Preload("Albums").Find(&songs)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch songs"})
+		opts, err := parseListOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter, err := parseSongFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, songs)
+
+		page, err := store.ListSongs(filter, opts)
+		if err != nil {
+			log.Printf("GetAPISongs: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch songs: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
 	}
 }
 
-func GetAPISong(db *gorm.DB) gin.HandlerFunc {
+func GetAPISong(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.ParseUint(idParam, 10, 32)
@@ -455,9 +559,8 @@ func GetAPISong(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var song models.Song
-		result := db.Preload("Artists").Preload("Units").Preload("Category").Preload("Albums").First(&song, uint(id))
-		if result.Error != nil {
+		song, err := store.GetSongByID(uint(id))
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
 			return
 		}
@@ -465,19 +568,34 @@ func GetAPISong(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetAPIArtists(db *gorm.DB) gin.HandlerFunc {
+func GetAPIArtists(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var artists []models.Artist
-		result := db.Preload("Units").Preload("Category").Find(&artists)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch artists"})
+		opts, err := parseListOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var filter database.ArtistFilter
+		if filter.CategoryID, err = parseUintQuery(c, "category_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filter.UnitID, err = parseUintQuery(c, "unit_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, artists)
+
+		page, err := store.ListArtists(filter, opts)
+		if err != nil {
+			log.Printf("GetAPIArtists: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch artists: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
 	}
 }
 
-func GetAPIArtist(db *gorm.DB) gin.HandlerFunc {
+func GetAPIArtist(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.ParseUint(idParam, 10, 32)
@@ -486,9 +604,8 @@ func GetAPIArtist(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var artist models.Artist
-		result := db.Preload("Units").Preload("Category").First(&artist, uint(id))
-		if result.Error != nil {
+		artist, err := store.GetArtistByID(uint(id))
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Artist not found"})
 			return
 		}
@@ -496,19 +613,34 @@ func GetAPIArtist(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetAPIAlbums(db *gorm.DB) gin.HandlerFunc {
+func GetAPIAlbums(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var albums []models.Album
-		result := db.Preload("Songs").Preload("Category").Find(&albums)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch albums"})
+		opts, err := parseListOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, albums)
+		filter := database.AlbumFilter{Type: c.Query("type")}
+		if filter.CategoryID, err = parseUintQuery(c, "category_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filter.SongID, err = parseUintQuery(c, "song_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := store.ListAlbums(filter, opts)
+		if err != nil {
+			log.Printf("GetAPIAlbums: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch albums: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
 	}
 }
 
-func GetAPIAlbum(db *gorm.DB) gin.HandlerFunc {
+func GetAPIAlbum(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.ParseUint(idParam, 10, 32)
@@ -517,9 +649,8 @@ func GetAPIAlbum(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var album models.Album
-		result := db.Preload("Songs").Preload("Category").First(&album, uint(id))
-		if result.Error != nil {
+		album, err := store.GetAlbumByID(uint(id))
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
 			return
 		}
@@ -527,19 +658,34 @@ func GetAPIAlbum(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetAPIUnits(db *gorm.DB) gin.HandlerFunc {
+func GetAPIUnits(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var units []models.Unit
-		result := db.Preload("Artists").Preload("Category").Find(&units)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch units"})
+		opts, err := parseListOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, units)
+		var filter database.UnitFilter
+		if filter.CategoryID, err = parseUintQuery(c, "category_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filter.ArtistID, err = parseUintQuery(c, "artist_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := store.ListUnits(filter, opts)
+		if err != nil {
+			log.Printf("GetAPIUnits: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch units: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
 	}
 }
 
-func GetAPIUnit(db *gorm.DB) gin.HandlerFunc {
+func GetAPIUnit(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.ParseUint(idParam, 10, 32)
@@ -548,9 +694,8 @@ func GetAPIUnit(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var unit models.Unit
-		result := db.Preload("Artists").Preload("Category").First(&unit, uint(id))
-		if result.Error != nil {
+		unit, err := store.GetUnitByID(uint(id))
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Unit not found"})
 			return
 		}
@@ -558,11 +703,10 @@ func GetAPIUnit(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetAPICategories(db *gorm.DB) gin.HandlerFunc {
+func GetAPICategories(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var categories []models.Category
-		result := db.Find(&categories)
-		if result.Error != nil {
+		categories, err := store.GetAllCategories()
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
 			return
 		}
@@ -570,7 +714,7 @@ func GetAPICategories(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetAPICategory(db *gorm.DB) gin.HandlerFunc {
+func GetAPICategory(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.ParseUint(idParam, 10, 32)
@@ -579,9 +723,8 @@ func GetAPICategory(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var category models.Category
-		result := db.First(&category, uint(id))
-		if result.Error != nil {
+		category, err := store.GetCategoryByID(uint(id))
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 			return
 		}
@@ -589,29 +732,44 @@ func GetAPICategory(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetAPIVotes(db *gorm.DB) gin.HandlerFunc {
+func GetAPIVotes(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var votes []models.Vote
+		opts, err := parseListOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Optional filtering by user_id or song_id
-		query := db
-		if userID := c.Query("user_id"); userID != "" {
-			query = query.Where("user_id = ?", userID)
+		// Optional filtering by user_id, song_id and rating range
+		var filter database.VoteFilter
+		if filter.UserIDs, err = parseIDQuery(c, "user_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		if songID := c.Query("song_id"); songID != "" {
-			query = query.Where("song_id = ?", songID)
+		if filter.SongIDs, err = parseIDQuery(c, "song_id"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filter.MinRating, err = parseIntQuery(c, "min_rating"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filter.MaxRating, err = parseIntQuery(c, "max_rating"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		result := query.Find(&votes)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch votes"})
+		page, err := store.ListVotes(filter, opts)
+		if err != nil {
+			log.Printf("GetAPIVotes: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch votes: " + err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, votes)
+		c.JSON(http.StatusOK, page)
 	}
 }
 
-func GetAPIVote(db *gorm.DB) gin.HandlerFunc {
+func GetAPIVote(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.ParseUint(idParam, 10, 32)
@@ -620,9 +778,8 @@ func GetAPIVote(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var vote models.Vote
-		result := db.First(&vote, uint(id))
-		if result.Error != nil {
+		vote, err := store.GetVoteByID(uint(id))
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
 			return
 		}
@@ -632,27 +789,54 @@ func GetAPIVote(db *gorm.DB) gin.HandlerFunc {
 
 // ============= USER API ENDPOINTS =============
 
+// UserResponse is the public view of a user. Password hashes and emails are
+// never part of API responses.
+type UserResponse struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	IsGuest   bool      `json:"is_guest"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserResponse(user models.User) UserResponse {
+	return UserResponse{
+		UserID:    user.UserID,
+		Username:  user.Username,
+		IsGuest:   user.IsGuest,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
 }
 
-func PostAPIUser(db *gorm.DB) gin.HandlerFunc {
+func PostAPIUser(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateUserRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		req.Username = strings.TrimSpace(req.Username)
+
+		// Generated guest usernames are reserved
+		if strings.HasPrefix(strings.ToLower(req.Username), guestUsernamePrefix) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Usernames starting with \"guest-\" are reserved"})
+			return
+		}
 
 		// Check if user already exists
-		var existingUser models.User
-		if err := db.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
+		if exists, err := store.UsernameExists(req.Username); err == nil && exists {
 			c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
 			return
 		}
 
-		// Hash the temporary password
-		passwordHash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			log.Printf("Error hashing password: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -662,40 +846,37 @@ func PostAPIUser(db *gorm.DB) gin.HandlerFunc {
 		user := models.User{
 			Username:     req.Username,
 			PasswordHash: string(passwordHash),
-			Email:        req.Username + "@temp.syncrate.local",
+			Email:        req.Email,
 		}
 
-		if err := db.Create(&user).Error; err != nil {
+		if err := store.CreateUser(&user); err != nil {
 			log.Printf("Error creating user: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to create user"})
 			return
 		}
+		recordAudit(c, store, newAuditEvent(c, models.AuditCreate, auditUser, user.UserID, nil, newUserResponse(user)))
 
-		c.JSON(http.StatusCreated, user)
+		c.JSON(http.StatusCreated, newUserResponse(user))
 	}
 }
 
-func GetAPIUsers(db *gorm.DB) gin.HandlerFunc {
+func GetAPIUsers(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var users []models.User
-
 		// Optional filtering by username (fuzzy search)
-		query := db
-		if username := c.Query("username"); username != "" {
-			// Fuzzy search using LIKE
-			query = query.Where("username ILIKE ?", "%"+username+"%")
-		}
-
-		result := query.Find(&users)
-		if result.Error != nil {
+		users, err := store.SearchUsers(c.Query("username"))
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 			return
 		}
-		c.JSON(http.StatusOK, users)
+		response := make([]UserResponse, len(users))
+		for i, user := range users {
+			response[i] = newUserResponse(user)
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-func GetAPIUser(db *gorm.DB) gin.HandlerFunc {
+func GetAPIUser(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.ParseUint(idParam, 10, 32)
@@ -704,12 +885,35 @@ func GetAPIUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var user models.User
-		result := db.First(&user, uint(id))
-		if result.Error != nil {
+		user, err := store.GetUserByID(uint(id))
+		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
-		c.JSON(http.StatusOK, user)
+		c.JSON(http.StatusOK, newUserResponse(*user))
+	}
+}
+
+// GetAPIUserStats returns the taste profile of a user, see database.UserStats
+func GetAPIUserStats(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.ParseUint(idParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+
+		stats, err := store.GetUserStats(uint(id))
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+			log.Printf("GetAPIUserStats: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch user stats"})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
 	}
 }
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// Entity types in the audit log. Rooms use their room type with a "_room"
+// suffix, e.g. "radio_room".
+const (
+	auditSong     = "song"
+	auditArtist   = "artist"
+	auditUnit     = "unit"
+	auditAlbum    = "album"
+	auditCategory = "category"
+	auditUser     = "user"
+	auditVote     = "vote"
+	auditImport   = "import" // Entity ID is the file name
+)
+
+// Choices of the audit view filters
+var (
+	auditActions = []string{
+		models.AuditCreate, models.AuditUpdate, models.AuditDelete, models.AuditRestore, models.AuditPurge, models.AuditMerge, models.AuditImport,
+		string(wsocket.MsgSetRole), string(wsocket.MsgKickUser), string(wsocket.MsgBanUser),
+		string(wsocket.MsgUnbanUser), string(wsocket.MsgTransferHost),
+	}
+	auditEntityTypes = []string{
+		auditSong, auditArtist, auditUnit, auditAlbum, auditCategory, auditUser, auditVote, auditImport,
+		models.RoomTypeRating + "_room", models.RoomTypeRadio + "_room", models.RoomTypeTournament + "_room",
+	}
+)
+
+// maxAuditValueLength shortens long values in the audit view
+const maxAuditValueLength = 200
+
+// newAuditEvent starts an audit event for a change made by the user of the
+// request. before and after are the entity around the change; pass nil for
+// the side where it does not exist.
+func newAuditEvent(c *gin.Context, action, entityType string, entityID any, before, after any) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Before:     auditSnapshot(before),
+		After:      auditSnapshot(after),
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		if id, ok := userID.(uint); ok {
+			event.ActorID = &id
+		}
+	}
+	event.ActorName = c.GetString("username")
+	return event
+}
+
+// auditSnapshot turns an entity into the JSON kept in the audit log. Null
+// fields, like relations that were not loaded, are left out.
+func auditSnapshot(entity any) json.RawMessage {
+	if entity == nil {
+		return nil
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		log.Printf("auditSnapshot: %v", err)
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data
+	}
+	for name, value := range fields {
+		if value == nil {
+			delete(fields, name)
+		}
+	}
+	data, _ = json.Marshal(fields)
+	return data
+}
+
+// recordAdminAudit writes the audit event of an admin change with tx, as
+// part of the change's transaction
+func recordAdminAudit(c *gin.Context, tx database.Store, action, entityType string, entityID any, before, after any) error {
+	event := newAuditEvent(c, action, entityType, entityID, before, after)
+	return tx.RecordAuditEvent(&event)
+}
+
+// recordAudit writes an audit event for a change that is already saved, as
+// made through the JSON API. A failure is only logged.
+func recordAudit(c *gin.Context, store database.Store, event models.AuditEvent) {
+	if err := store.RecordAuditEvent(&event); err != nil {
+		log.Printf("recordAudit: %v", err)
+	}
+}
+
+// ============= RESTORE =============
+
+// restorableTypes are the entity types whose deletes can be undone
+var restorableTypes = map[string]bool{
+	auditSong:     true,
+	auditArtist:   true,
+	auditUnit:     true,
+	auditAlbum:    true,
+	auditCategory: true,
+}
+
+// canRestore reports whether an audit event is a delete that can be undone
+func canRestore(event models.AuditEvent) bool {
+	return event.Action == models.AuditDelete && restorableTypes[event.EntityType] && len(event.Before) > 0
+}
+
+// PostRestoreAuditEvent undoes the delete recorded in an audit event
+func PostRestoreAuditEvent(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"error": "Invalid audit event ID",
+			})
+			return
+		}
+
+		event, err := store.GetAuditEvent(uint(id))
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
+				c.HTML(http.StatusNotFound, "error.html", gin.H{
+					"error": "Audit event not found",
+				})
+				return
+			}
+			log.Printf("PostRestoreAuditEvent: %v", err)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"error": "Failed to load audit event: " + err.Error(),
+			})
+			return
+		}
+		if !canRestore(*event) {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"error": "Only deleted songs, artists, units, albums and categories can be restored",
+			})
+			return
+		}
+		entityID, err := strconv.ParseUint(event.EntityID, 10, 32)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"error": "Invalid entity ID " + event.EntityID,
+			})
+			return
+		}
+
+		err = store.Transaction(func(tx database.Store) error {
+			restored, err := tx.RestoreDeleted(event.EntityType, uint(entityID), event.Before)
+			if err != nil {
+				return err
+			}
+			return recordAdminAudit(c, tx, models.AuditRestore, event.EntityType, event.EntityID, nil, restored)
+		})
+		if err != nil {
+			log.Printf("PostRestoreAuditEvent: %v", err)
+			c.HTML(storeErrorStatus(err), "error.html", gin.H{
+				"error": "Failed to restore: " + err.Error(),
+			})
+			return
+		}
+
+		log.Printf("PostRestoreAuditEvent: Restored %s %s from audit event %d", event.EntityType, event.EntityID, event.EventID)
+		c.Redirect(http.StatusSeeOther, "/admin/audit?entity_type="+url.QueryEscape(event.EntityType)+"&entity_id="+url.QueryEscape(event.EntityID))
+	}
+}
+
+// ============= AUDIT VIEW =============
+
+// auditChange is one field that differs between the snapshots of an event
+type auditChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// auditRow is an audit event as the audit view shows it
+type auditRow struct {
+	models.AuditEvent
+	Changes    []auditChange
+	Restorable bool
+}
+
+// auditChanges lists the fields that differ between two snapshots
+func auditChanges(before, after json.RawMessage) []auditChange {
+	var beforeFields, afterFields map[string]any
+	json.Unmarshal(before, &beforeFields)
+	json.Unmarshal(after, &afterFields)
+
+	names := make(map[string]bool)
+	for name := range beforeFields {
+		names[name] = true
+	}
+	for name := range afterFields {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changes []auditChange
+	for _, name := range sorted {
+		beforeValue, afterValue := formatAuditValue(beforeFields, name), formatAuditValue(afterFields, name)
+		if beforeValue != afterValue {
+			changes = append(changes, auditChange{Field: name, Before: beforeValue, After: afterValue})
+		}
+	}
+	return changes
+}
+
+// formatAuditValue renders a snapshot field for the audit view
+func formatAuditValue(fields map[string]any, name string) string {
+	value, ok := fields[name]
+	if !ok {
+		return ""
+	}
+	text, ok := value.(string)
+	if !ok {
+		data, _ := json.Marshal(value)
+		text = string(data)
+	}
+	if len(text) > maxAuditValueLength {
+		text = text[:maxAuditValueLength] + "…"
+	}
+	return text
+}
+
+// GetAdminAudit shows the audit log, newest first. It can be filtered by
+// actor (username), action, entity_type and entity_id.
+func GetAdminAudit(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateData := GetUserContext(c)
+		templateData["title"] = "SyncRate | Audit Log"
+		templateData["actor"] = c.Query("actor")
+		templateData["action"] = c.Query("action")
+		templateData["entityType"] = c.Query("entity_type")
+		templateData["entityID"] = c.Query("entity_id")
+		templateData["actions"] = auditActions
+		templateData["entityTypes"] = auditEntityTypes
+
+		filter := database.AuditFilter{
+			Action:     c.Query("action"),
+			EntityType: c.Query("entity_type"),
+			EntityID:   c.Query("entity_id"),
+		}
+		if actor := c.Query("actor"); actor != "" {
+			user, err := store.GetUserByUsername(actor)
+			if err != nil {
+				templateData["events"] = []auditRow{}
+				c.HTML(http.StatusOK, "admin-audit.html", templateData)
+				return
+			}
+			filter.ActorID = &user.UserID
+		}
+
+		page, err := store.ListAuditEvents(filter, database.ListOptions{Desc: true, Cursor: c.Query("cursor")})
+		if err != nil {
+			log.Printf("GetAdminAudit: %v", err)
+			templateData["error"] = "Failed to load the audit log: " + err.Error()
+			c.HTML(storeErrorStatus(err), "admin-audit.html", templateData)
+			return
+		}
+
+		rows := make([]auditRow, len(page.Items))
+		for i, event := range page.Items {
+			rows[i] = auditRow{
+				AuditEvent: event,
+				Changes:    auditChanges(event.Before, event.After),
+				Restorable: canRestore(event),
+			}
+		}
+		templateData["events"] = rows
+
+		if page.NextCursor != "" {
+			next := c.Request.URL.Query()
+			next.Set("cursor", page.NextCursor)
+			templateData["nextURL"] = "/admin/audit?" + next.Encode()
+		}
+		c.HTML(http.StatusOK, "admin-audit.html", templateData)
+	}
+}
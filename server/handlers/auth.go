@@ -1,14 +1,15 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
+	"github.com/CptPie/SyncRate/database"
 	"github.com/CptPie/SyncRate/models"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 // GetUserContext extracts user information from gin context and returns template data
@@ -16,20 +17,25 @@ func GetUserContext(c *gin.Context) gin.H {
 	isAuth, _ := c.Get("is_authenticated")
 	username, _ := c.Get("username")
 	userID, _ := c.Get("user_id")
+	role := c.GetString("role")
 
 	return gin.H{
 		"is_authenticated": isAuth,
+		"is_guest":         isGuest(c),
 		"username":         username,
 		"user_id":          userID,
+		"role":             role,
+		"can_curate":       models.RoleAtLeast(role, models.RoleCurator),
+		"is_admin":         role == models.RoleAdmin,
 	}
 }
 
-func GetLogin(db *gorm.DB) gin.HandlerFunc {
+func GetLogin(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 
-		// Check if user is already logged in
-		if userID := session.Get("user_id"); userID != nil {
+		// Check if user is already logged in; guests may still sign in
+		if userID := session.Get("user_id"); userID != nil && !isGuest(c) {
 			c.Redirect(http.StatusFound, "/")
 			return
 		}
@@ -40,7 +46,7 @@ func GetLogin(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func PostLogin(db *gorm.DB) gin.HandlerFunc {
+func PostLogin(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 
@@ -57,8 +63,8 @@ func PostLogin(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Get user from database
-		var user models.User
-		if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		user, err := store.GetUserByUsername(username)
+		if err != nil {
 			data := GetUserContext(c)
 			data["title"] = "SyncRate | Login"
 			data["error"] = "Invalid username or password"
@@ -67,7 +73,7 @@ func PostLogin(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Check password
-		err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 		if err != nil {
 			data := GetUserContext(c)
 			data["title"] = "SyncRate | Login"
@@ -76,9 +82,20 @@ func PostLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Set session
+		// Guest accounts cannot log in
+		if user.IsGuest {
+			data := GetUserContext(c)
+			data["title"] = "SyncRate | Login"
+			data["error"] = "Invalid username or password"
+			c.HTML(http.StatusUnauthorized, "login.html", data)
+			return
+		}
+
+		// Set session, replacing a guest session
 		session.Set("user_id", user.UserID)
 		session.Set("username", user.Username)
+		session.Set("role", user.Role)
+		session.Delete("is_guest")
 		if err := session.Save(); err != nil {
 			data := GetUserContext(c)
 			data["title"] = "SyncRate | Login"
@@ -92,12 +109,12 @@ func PostLogin(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetRegister(db *gorm.DB) gin.HandlerFunc {
+func GetRegister(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 
-		// Check if user is already logged in
-		if userID := session.Get("user_id"); userID != nil {
+		// Check if user is already logged in; guests may still register
+		if userID := session.Get("user_id"); userID != nil && !isGuest(c) {
 			c.Redirect(http.StatusFound, "/")
 			return
 		}
@@ -108,7 +125,7 @@ func GetRegister(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func PostRegister(db *gorm.DB) gin.HandlerFunc {
+func PostRegister(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username := strings.TrimSpace(c.PostForm("username"))
 		email := strings.TrimSpace(c.PostForm("email"))
@@ -142,9 +159,17 @@ func PostRegister(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Generated guest usernames are reserved
+		if strings.HasPrefix(strings.ToLower(username), guestUsernamePrefix) {
+			data := GetUserContext(c)
+			data["title"] = "SyncRate | Register"
+			data["error"] = "Usernames starting with \"guest-\" are reserved"
+			c.HTML(http.StatusBadRequest, "register.html", data)
+			return
+		}
+
 		// Check if username already exists
-		var existingUser models.User
-		if err := db.Where("username = ?", username).First(&existingUser).Error; err == nil {
+		if exists, err := store.UsernameExists(username); err == nil && exists {
 			data := GetUserContext(c)
 			data["title"] = "SyncRate | Register"
 			data["error"] = "Username already exists"
@@ -162,25 +187,40 @@ func PostRegister(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Create user
+		// Create user; the first account becomes admin
 		user := models.User{
 			Username:     username,
 			Email:        email,
 			PasswordHash: string(hashedPassword),
+			Role:         models.RoleMember,
 		}
 
-		if err := db.Create(&user).Error; err != nil {
+		if err := store.CreateUser(&user); err != nil {
 			data := GetUserContext(c)
 			data["title"] = "SyncRate | Register"
 			data["error"] = "Failed to create account"
 			c.HTML(http.StatusInternalServerError, "register.html", data)
 			return
 		}
+		claimFirstAdmin(store, &user)
 
-		// Auto-login after registration
+		// Registering from a guest session claims the guest's votes unless
+		// the user opted out
 		session := sessions.Default(c)
+		if guestID, ok := session.Get("user_id").(uint); ok && isGuest(c) && c.PostForm("claim_guest_votes") != "" {
+			moved, err := store.ClaimGuest(guestID, user.UserID)
+			if err != nil {
+				log.Printf("PostRegister: failed to claim guest votes: %v", err)
+			} else {
+				log.Printf("PostRegister: moved %d guest votes to user %d", moved, user.UserID)
+			}
+		}
+
+		// Auto-login after registration
 		session.Set("user_id", user.UserID)
 		session.Set("username", user.Username)
+		session.Set("role", user.Role)
+		session.Delete("is_guest")
 		if err := session.Save(); err != nil {
 			// Registration succeeded but login failed - redirect to login page
 			c.Redirect(http.StatusFound, "/login")
@@ -192,7 +232,7 @@ func PostRegister(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func PostLogout(db *gorm.DB) gin.HandlerFunc {
+func PostLogout(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/middleware"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// newSessionRouter returns an engine that takes its user from the session
+// cookie, as the site does
+func newSessionRouter(store database.Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions("syncrate-session", cookie.NewStore([]byte("test"))))
+	r.Use(middleware.SetUserContext())
+
+	tmpl := template.Must(template.ParseGlob("../../web/templates/components/*.html"))
+	tmpl = template.Must(tmpl.ParseGlob("../../web/templates/pages/*.html"))
+	r.SetHTMLTemplate(tmpl)
+
+	r.POST("/guest", PostGuest(store))
+	r.POST("/register", PostRegister(store))
+	return r
+}
+
+// postWithCookies sends a form along with the given cookies and returns the
+// cookies of the response, or the given ones when it sets none
+func postWithCookies(t *testing.T, r *gin.Engine, target string, form url.Values, cookies []*http.Cookie) []*http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("POST %s = %d; want %d", target, w.Code, http.StatusFound)
+	}
+	if set := w.Result().Cookies(); len(set) > 0 {
+		return set
+	}
+	return cookies
+}
+
+func TestPostRegisterClaimsGuestVotes(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim bool
+	}{
+		{"claim guest votes", true},
+		{"keep guest votes apart", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			songs := []models.Song{createTestSong(t, store, "First"), createTestSong(t, store, "Second")}
+			r := newSessionRouter(store)
+
+			cookies := postWithCookies(t, r, "/guest", url.Values{"display_name": {"Visitor"}, "next": {"/"}}, nil)
+			users, err := store.GetAllUsers()
+			if err != nil || len(users) != 1 || !users[0].IsGuest {
+				t.Fatalf("GetAllUsers = %v, %v; want the guest", users, err)
+			}
+			guest := users[0]
+			for _, song := range songs {
+				if err := store.UpsertVote(&models.Vote{UserID: guest.UserID, SongID: song.SongID, Rating: 7}); err != nil {
+					t.Fatalf("UpsertVote: %v", err)
+				}
+			}
+			if err := store.AllowRoomUser(models.RoomTypeRating, "room1", guest.UserID); err != nil {
+				t.Fatalf("AllowRoomUser: %v", err)
+			}
+
+			form := url.Values{
+				"username":         {"visitor"},
+				"email":            {"visitor@example.com"},
+				"password":         {"secret123"},
+				"confirm_password": {"secret123"},
+			}
+			if tt.claim {
+				form.Set("claim_guest_votes", "on")
+			}
+			postWithCookies(t, r, "/register", form, cookies)
+
+			account, err := store.GetUserByUsername("visitor")
+			if err != nil {
+				t.Fatalf("GetUserByUsername: %v", err)
+			}
+			accountVotes, _ := store.GetVotesByUser(account.UserID)
+			guestVotes, _ := store.GetVotesByUser(guest.UserID)
+			_, guestErr := store.GetUserByID(guest.UserID)
+			allowed, _ := store.IsRoomUserAllowed(models.RoomTypeRating, "room1", account.UserID)
+
+			if tt.claim {
+				if len(accountVotes) != 2 || len(guestVotes) != 0 {
+					t.Errorf("account has %d votes, guest %d; want all moved to the account", len(accountVotes), len(guestVotes))
+				}
+				if !errors.Is(guestErr, database.ErrNotFound) {
+					t.Errorf("GetUserByID of the claimed guest = %v; want ErrNotFound", guestErr)
+				}
+				if !allowed {
+					t.Error("the guest's room access did not move to the account")
+				}
+				return
+			}
+			if len(accountVotes) != 0 || len(guestVotes) != 2 {
+				t.Errorf("account has %d votes, guest %d; want the guest to keep them", len(accountVotes), len(guestVotes))
+			}
+			if guestErr != nil {
+				t.Errorf("GetUserByID of the unclaimed guest = %v; want it kept", guestErr)
+			}
+			if allowed {
+				t.Error("the account got the room access of an unclaimed guest")
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultChartRefresh is how often the charts are recomputed unless
+// CHART_REFRESH_MINUTES says otherwise
+const DefaultChartRefresh = 15 * time.Minute
+
+// chartPageLimit is how many songs of each chart the charts page lists
+const chartPageLimit = 25
+
+// StartChartRefresh starts a background routine that recomputes the charts
+// right away and then every interval
+func StartChartRefresh(store database.Store, opts database.ChartOptions, interval time.Duration) {
+	go func() {
+		refreshCharts(store, opts)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				refreshCharts(store, opts)
+			}
+		}
+	}()
+}
+
+// refreshCharts recomputes the charts from all votes
+func refreshCharts(store database.Store, opts database.ChartOptions) {
+	started := time.Now()
+	votes, err := store.GetVotes(database.VoteFilter{})
+	if err != nil {
+		log.Printf("Error loading votes for charts: %v", err)
+		return
+	}
+	songs, err := store.GetAllSongs()
+	if err != nil {
+		log.Printf("Error loading songs for charts: %v", err)
+		return
+	}
+
+	entries := database.ComputeCharts(votes, songs, opts, started)
+	if err := store.ReplaceChartEntries(entries); err != nil {
+		log.Printf("Error saving charts: %v", err)
+		return
+	}
+	log.Printf("Refreshed charts: %d entries from %d votes in %v",
+		len(entries), len(votes), time.Since(started).Round(time.Millisecond))
+}
+
+// ChartEntryResponse is a song's place in a chart
+type ChartEntryResponse struct {
+	Rank          int         `json:"rank"`
+	Score         float64     `json:"score"`
+	AverageRating float64     `json:"average_rating"`
+	VoteCount     int64       `json:"vote_count"`
+	Song          models.Song `json:"song"`
+}
+
+// ChartResponse is one chart of one scope
+type ChartResponse struct {
+	Chart       string               `json:"chart"`
+	Scope       string               `json:"scope"`
+	ScopeID     uint                 `json:"scope_id"`
+	RefreshedAt *time.Time           `json:"refreshed_at"` // nil before the first refresh
+	Entries     []ChartEntryResponse `json:"entries"`
+}
+
+// loadChart loads the first limit songs of a chart. Ranks are counted again
+// so songs moved to the trash since the last refresh leave no gaps.
+func loadChart(store database.Store, chart, scope string, scopeID uint, limit int) (*ChartResponse, error) {
+	entries, err := store.GetChart(chart, scope, scopeID)
+	if err != nil {
+		return nil, err
+	}
+	entries = entries[:min(len(entries), limit)]
+
+	songIDs := make([]uint, len(entries))
+	for i, entry := range entries {
+		songIDs[i] = entry.SongID
+	}
+	songs, err := store.GetSongsByIDs(songIDs)
+	if err != nil {
+		return nil, err
+	}
+	songsByID := make(map[uint]models.Song, len(songs))
+	for _, song := range songs {
+		songsByID[song.SongID] = song
+	}
+
+	response := &ChartResponse{Chart: chart, Scope: scope, ScopeID: scopeID, Entries: make([]ChartEntryResponse, 0, len(entries))}
+	for _, entry := range entries {
+		song, ok := songsByID[entry.SongID]
+		if !ok {
+			continue
+		}
+		response.RefreshedAt = &entry.RefreshedAt
+		response.Entries = append(response.Entries, ChartEntryResponse{
+			Rank:          len(response.Entries) + 1,
+			Score:         entry.Score,
+			AverageRating: entry.AverageRating,
+			VoteCount:     entry.VoteCount,
+			Song:          song,
+		})
+	}
+	return response, nil
+}
+
+// parseChartScope reads the scope and id query parameters. The overall scope
+// is the default and needs no id.
+func parseChartScope(c *gin.Context) (string, uint, error) {
+	scope := c.DefaultQuery("scope", models.ChartScopeOverall)
+	if !slices.Contains(models.ChartScopes, scope) {
+		return "", 0, errors.New("unknown chart scope")
+	}
+	if scope == models.ChartScopeOverall {
+		return scope, 0, nil
+	}
+	id, err := strconv.ParseUint(c.Query("id"), 10, 32)
+	if err != nil || id == 0 {
+		return "", 0, errors.New("invalid id")
+	}
+	return scope, uint(id), nil
+}
+
+// chartScopeName names the songs a chart scope covers, failing with
+// database.ErrNotFound when its category, artist, unit or album does not
+// exist
+func chartScopeName(store database.Store, scope string, scopeID uint) (string, error) {
+	switch scope {
+	case models.ChartScopeCategory:
+		category, err := store.GetCategoryByID(scopeID)
+		if err != nil {
+			return "", err
+		}
+		return category.Name, nil
+	case models.ChartScopeArtist:
+		artist, err := store.GetArtistByID(scopeID)
+		if err != nil {
+			return "", err
+		}
+		return artist.NameOriginal, nil
+	case models.ChartScopeUnit:
+		unit, err := store.GetUnitByID(scopeID)
+		if err != nil {
+			return "", err
+		}
+		return unit.NameOriginal, nil
+	case models.ChartScopeAlbum:
+		album, err := store.GetAlbumByID(scopeID)
+		if err != nil {
+			return "", err
+		}
+		return album.NameOriginal, nil
+	case models.ChartScopeYear:
+		return "Votes of " + strconv.FormatUint(uint64(scopeID), 10), nil
+	default:
+		return "All Songs", nil
+	}
+}
+
+// GetCharts shows the top, divisive and rising charts of a scope, picked
+// with the scope and id query parameters
+func GetCharts(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope, scopeID, err := parseChartScope(c)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Invalid chart: " + err.Error(),
+			})
+			return
+		}
+		scopeName, err := chartScopeName(store, scope, scopeID)
+		if err != nil {
+			c.HTML(storeErrorStatus(err), "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "No charts for this " + scope,
+			})
+			return
+		}
+
+		charts := make(map[string]*ChartResponse, len(models.Charts))
+		for _, chart := range models.Charts {
+			if chart == models.ChartRising && scope == models.ChartScopeYear {
+				continue
+			}
+			charts[chart], err = loadChart(store, chart, scope, scopeID, chartPageLimit)
+			if err != nil {
+				log.Printf("GetCharts: Error loading %s chart of %s %d: %v", chart, scope, scopeID, err)
+				c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+					"title": "SyncRate | Error",
+					"error": "Failed to load the charts",
+				})
+				return
+			}
+		}
+
+		// Everything the scope picker offers
+		categories, err := store.GetAllCategories()
+		if err != nil {
+			log.Printf("GetCharts: Error loading categories: %v", err)
+		}
+		artists, err := store.GetAllArtists()
+		if err != nil {
+			log.Printf("GetCharts: Error loading artists: %v", err)
+		}
+		units, err := store.GetAllUnits()
+		if err != nil {
+			log.Printf("GetCharts: Error loading units: %v", err)
+		}
+		albums, err := store.GetAllAlbums()
+		if err != nil {
+			log.Printf("GetCharts: Error loading albums: %v", err)
+		}
+		years, err := store.GetChartScopeIDs(models.ChartScopeYear)
+		if err != nil {
+			log.Printf("GetCharts: Error loading chart years: %v", err)
+		}
+		slices.Reverse(years)
+
+		templateData := GetUserContext(c)
+		templateData["title"] = "SyncRate | Charts: " + scopeName
+		templateData["scope"] = scope
+		templateData["scopeID"] = scopeID
+		templateData["scopeName"] = scopeName
+		templateData["topChart"] = charts[models.ChartTop]
+		templateData["divisiveChart"] = charts[models.ChartDivisive]
+		templateData["risingChart"] = charts[models.ChartRising]
+		templateData["categories"] = categories
+		templateData["artists"] = artists
+		templateData["units"] = units
+		templateData["albums"] = albums
+		templateData["years"] = years
+		c.HTML(http.StatusOK, "charts.html", templateData)
+	}
+}
+
+// GetAPIChart returns one chart. The scope and id query parameters pick the
+// songs it covers, limit caps the entries.
+func GetAPIChart(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chart := c.Param("chart")
+		if !slices.Contains(models.Charts, chart) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown chart"})
+			return
+		}
+		scope, scopeID, err := parseChartScope(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if chart == models.ChartRising && scope == models.ChartScopeYear {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rising charts are not kept per year"})
+			return
+		}
+		if _, err := chartScopeName(store, scope, scopeID); err != nil {
+			c.JSON(storeErrorStatus(err), gin.H{"error": "unknown " + scope})
+			return
+		}
+
+		limit := database.ChartSize
+		if value := c.Query("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > database.ChartSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+			limit = n
+		}
+
+		response, err := loadChart(store, chart, scope, scopeID, limit)
+		if err != nil {
+			log.Printf("GetAPIChart: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch chart"})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/backup"
+	"github.com/gin-gonic/gin"
+)
+
+// GetExport downloads a backup archive of the catalog and votes. Archives
+// made here never carry credentials; use "syncrate export -credentials" for
+// a full backup.
+func GetExport(exporter backup.Exporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding, err := backup.ParseEncoding(c.Query("format"))
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": err.Error(),
+			})
+			return
+		}
+
+		var archive bytes.Buffer
+		if _, err := exporter.Export(&archive, backup.ExportOptions{Encoding: encoding}); err != nil {
+			log.Printf("GetExport: %v", err)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Failed to export the database",
+			})
+			return
+		}
+
+		filename := fmt.Sprintf("syncrate-backup-%s-%s.zip", time.Now().UTC().Format("20060102-150405"), encoding)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Data(http.StatusOK, "application/zip", archive.Bytes())
+	}
+}
+
+// GetMyRatingsCSV downloads the ratings of the logged-in user as CSV
+func GetMyRatingsCSV(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists || userID == nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		votes, err := store.GetVotesByUser(userID.(uint))
+		if err != nil {
+			log.Printf("GetMyRatingsCSV: %v", err)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Failed to load your ratings",
+			})
+			return
+		}
+
+		songIDs := make([]uint, len(votes))
+		for i, vote := range votes {
+			songIDs[i] = vote.SongID
+		}
+		songs, err := store.GetSongsByIDs(songIDs)
+		if err != nil {
+			log.Printf("GetMyRatingsCSV: %v", err)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Failed to load your ratings",
+			})
+			return
+		}
+		songsByID := make(map[uint]models.Song, len(songs))
+		for _, song := range songs {
+			songsByID[song.SongID] = song
+		}
+
+		var out bytes.Buffer
+		writer := csv.NewWriter(&out)
+		writer.Write([]string{"song_id", "name_original", "name_english", "source_url", "rating", "comment", "rated_at", "updated_at"})
+		for _, vote := range votes {
+			song := songsByID[vote.SongID]
+			writer.Write([]string{
+				strconv.FormatUint(uint64(vote.SongID), 10),
+				song.NameOriginal,
+				song.NameEnglish,
+				song.SourceURL,
+				strconv.Itoa(vote.Rating),
+				vote.Comment,
+				vote.CreatedAt.UTC().Format(time.RFC3339),
+				vote.UpdatedAt.UTC().Format(time.RFC3339),
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			log.Printf("GetMyRatingsCSV: %v", err)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Failed to export your ratings",
+			})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="syncrate-ratings.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", out.Bytes())
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxGuestNameLength = 30
+
+	// Guests live as long as their session cookie
+	guestLifetime = 7 * 24 * time.Hour
+)
+
+// guestUsernamePrefix marks the usernames of guest users. Display names are
+// kept in the session, so guests never collide with accounts or each other.
+const guestUsernamePrefix = "guest-"
+
+// voteAuthor is the name shown next to a stored vote. Guest usernames are
+// generated, and their display names are gone with their session.
+func voteAuthor(vote database.VoteWithUser) string {
+	if vote.IsGuest {
+		return "Guest"
+	}
+	return vote.Username
+}
+
+// isGuest reports whether the current session belongs to a guest
+func isGuest(c *gin.Context) bool {
+	guest, _ := c.Get("is_guest")
+	isGuest, _ := guest.(bool)
+	return isGuest
+}
+
+// isGuestUser reports whether a stored user is a guest
+func isGuestUser(store database.Store, userID uint) bool {
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		log.Printf("isGuestUser: %v", err)
+		return false
+	}
+	return user.IsGuest
+}
+
+// safeRedirect only allows redirects to paths on this site
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// redirectToSignIn sends a visitor without a session to the guest form if
+// the room lets guests in, and to the login page otherwise
+func redirectToSignIn(c *gin.Context, store database.Store, roomType, roomID string) {
+	if access, err := loadRoomAccess(store, roomType, roomID); err == nil && access.allowGuests {
+		c.Redirect(http.StatusFound, "/guest?next="+url.QueryEscape(c.Request.URL.RequestURI()))
+		return
+	}
+	c.Redirect(http.StatusFound, "/login")
+}
+
+// GetGuest shows the form for joining a room as a guest
+func GetGuest(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		next := safeRedirect(c.Query("next"))
+
+		// Signed-in users and guests go straight to the room
+		if userID, exists := c.Get("user_id"); exists && userID != nil {
+			c.Redirect(http.StatusFound, next)
+			return
+		}
+
+		data := GetUserContext(c)
+		data["title"] = "SyncRate | Join as Guest"
+		data["next"] = next
+		c.HTML(http.StatusOK, "guest.html", data)
+	}
+}
+
+// PostGuest creates a guest user for the chosen display name and signs the
+// session in as it. Guests can join rooms that allow them and keep their
+// ratings by registering later.
+func PostGuest(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		next := safeRedirect(c.PostForm("next"))
+		displayName := strings.TrimSpace(c.PostForm("display_name"))
+
+		renderError := func(status int, message string) {
+			data := GetUserContext(c)
+			data["title"] = "SyncRate | Join as Guest"
+			data["next"] = next
+			data["display_name"] = displayName
+			data["error"] = message
+			c.HTML(status, "guest.html", data)
+		}
+
+		if userID, exists := c.Get("user_id"); exists && userID != nil {
+			c.Redirect(http.StatusFound, next)
+			return
+		}
+
+		if displayName == "" {
+			renderError(http.StatusBadRequest, "Display name is required")
+			return
+		}
+		if utf8.RuneCountInString(displayName) > maxGuestNameLength {
+			renderError(http.StatusBadRequest, "Display name cannot exceed 30 characters")
+			return
+		}
+
+		suffix := make([]byte, 8)
+		rand.Read(suffix)
+		guest := models.User{
+			Username: guestUsernamePrefix + hex.EncodeToString(suffix),
+			IsGuest:  true,
+		}
+		if err := store.CreateUser(&guest); err != nil {
+			log.Printf("PostGuest: %v", err)
+			renderError(http.StatusInternalServerError, "Failed to create guest")
+			return
+		}
+
+		session := sessions.Default(c)
+		session.Set("user_id", guest.UserID)
+		session.Set("username", displayName)
+		session.Set("is_guest", true)
+		session.Set("role", guest.Role)
+		if err := session.Save(); err != nil {
+			renderError(http.StatusInternalServerError, "Failed to create session")
+			return
+		}
+
+		c.Redirect(http.StatusFound, next)
+	}
+}
+
+// cleanupStaleGuests removes guests whose session has expired and who left
+// no votes behind
+func cleanupStaleGuests(store database.Store) {
+	deleted, err := store.DeleteStaleGuests(time.Now().Add(-guestLifetime))
+	if err != nil {
+		log.Printf("Error cleaning up stale guests: %v", err)
+		return
+	}
+
+	if deleted > 0 {
+		log.Printf("Cleaned up %d stale guests", deleted)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter returns an engine with the site's templates whose requests
+// are made by the given user, as the user context middleware would set them
+func newTestRouter(t *testing.T, user *models.User) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions("syncrate-session", cookie.NewStore([]byte("test"))))
+	r.Use(func(c *gin.Context) {
+		c.Set("is_authenticated", user != nil)
+		if user != nil {
+			c.Set("user_id", user.UserID)
+			c.Set("username", user.Username)
+			c.Set("role", user.Role)
+			c.Set("is_guest", user.IsGuest)
+		}
+		c.Next()
+	})
+
+	tmpl := template.Must(template.ParseGlob("../../web/templates/components/*.html"))
+	tmpl = template.Must(tmpl.ParseGlob("../../web/templates/pages/*.html"))
+	r.SetHTMLTemplate(tmpl)
+	return r
+}
+
+// createTestAdmin adds an admin account to the store
+func createTestAdmin(t *testing.T, store database.Store) *models.User {
+	t.Helper()
+	admin := &models.User{Username: "admin", Role: models.RoleAdmin}
+	if err := store.CreateUser(admin); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return admin
+}
+
+// serveForm sends a request with a url-encoded form body, or none for nil
+func serveForm(r *gin.Engine, method, target string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form == nil {
+		req = httptest.NewRequest(method, target, nil)
+	} else {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// lastAuditEvent returns the newest audit event, failing without one
+func lastAuditEvent(t *testing.T, store database.Store) models.AuditEvent {
+	t.Helper()
+	page, err := store.ListAuditEvents(database.AuditFilter{}, database.ListOptions{Desc: true, Limit: 1})
+	if err != nil || len(page.Items) == 0 {
+		t.Fatalf("ListAuditEvents = %v, %v; want an event", page, err)
+	}
+	return page.Items[0]
+}
@@ -4,11 +4,11 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/CptPie/SyncRate/database"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func GetHome(db *gorm.DB) gin.HandlerFunc {
+func GetHome(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		templateData := GetUserContext(c)
 		templateData["title"] = "SyncRate | Home"
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/importer"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize caps uploaded import files
+const maxImportSize = 10 << 20
+
+// GetImportSongs shows the bulk import form
+func GetImportSongs(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateData := GetUserContext(c)
+		templateData["title"] = "SyncRate | Import Songs"
+		c.HTML(http.StatusOK, "import-songs.html", templateData)
+	}
+}
+
+// PostImportSongs imports an uploaded CSV or JSON file, or reports what it
+// would do in a dry run, and shows the report
+func PostImportSongs(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateData := GetUserContext(c)
+		templateData["title"] = "SyncRate | Import Songs"
+		showError := func(status int, message string) {
+			templateData["error"] = message
+			c.HTML(status, "import-songs.html", templateData)
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+		header, err := c.FormFile("file")
+		if err != nil {
+			showError(http.StatusBadRequest, "Choose a CSV or JSON file of at most 10 MB")
+			return
+		}
+		format, err := importer.FormatFromFilename(header.Filename)
+		if err != nil {
+			showError(http.StatusBadRequest, err.Error())
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			log.Printf("PostImportSongs: %v", err)
+			showError(http.StatusInternalServerError, "Failed to read the file")
+			return
+		}
+		defer file.Close()
+
+		records, err := importer.Parse(file, format)
+		if err != nil {
+			showError(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts := importer.Options{
+			DryRun: c.PostForm("dry_run") == "true",
+			Update: c.PostForm("update") == "true",
+		}
+		report, err := importer.Import(store, records, opts)
+		if err != nil {
+			log.Printf("PostImportSongs: %v", err)
+			showError(http.StatusInternalServerError, "Import failed: "+err.Error())
+			return
+		}
+		log.Printf("PostImportSongs: %s: %d rows, dry run %t, committed %t", header.Filename, len(report.Rows), report.DryRun, report.Committed)
+
+		counts := make(map[string]int, len(report.Counts))
+		for action, count := range report.Counts {
+			counts[string(action)] = count
+		}
+		if report.Committed {
+			recordImportAudit(c, store, header.Filename, opts, report, counts)
+		}
+		templateData["report"] = report
+		templateData["counts"] = counts
+		templateData["filename"] = header.Filename
+		templateData["dryRun"] = opts.DryRun
+		templateData["update"] = opts.Update
+		c.HTML(http.StatusOK, "import-songs.html", templateData)
+	}
+}
+
+// recordImportAudit writes one audit event for a committed import with the
+// songs it created or changed
+func recordImportAudit(c *gin.Context, store database.Store, filename string, opts importer.Options, report *importer.Report, counts map[string]int) {
+	var rows []importer.RowReport
+	for _, row := range report.Rows {
+		if row.Action == importer.ActionCreate || row.Action == importer.ActionUpdate {
+			rows = append(rows, row)
+		}
+	}
+	entityID := filename
+	if len(entityID) > 64 {
+		entityID = entityID[:64]
+	}
+	recordAudit(c, store, newAuditEvent(c, models.AuditImport, auditImport, entityID, nil, gin.H{
+		"Filename": filename,
+		"Update":   opts.Update,
+		"Counts":   counts,
+		"Rows":     rows,
+	}))
+}
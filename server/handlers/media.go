@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/utils"
+)
+
+// setSongMedia records the provider and media ID of a song's source URL. It
+// fails if no provider plays the URL.
+func setSongMedia(song *models.Song) (*utils.Media, error) {
+	media, err := utils.ResolveMedia(song.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+	song.Provider = media.Provider
+	song.ProviderID = media.ID
+	return media, nil
+}
+
+// songMedia returns how a song plays in rooms. Songs no provider plays get
+// an empty Media, which rooms show without a player.
+func songMedia(song *models.Song) utils.Media {
+	media, err := utils.SongMedia(song.Provider, song.ProviderID, song.SourceURL)
+	if err != nil {
+		log.Printf("songMedia: song %d: %v", song.SongID, err)
+		return utils.Media{}
+	}
+	return *media
+}
+
+// providerThumbnail asks the song's provider for a thumbnail
+func providerThumbnail(media *utils.Media) (string, error) {
+	provider, ok := utils.MediaProviderByName(media.Provider)
+	if !ok {
+		return "", nil
+	}
+	return provider.ThumbnailURL(media.ID)
+}
+
+// metadataFetcher looks up titles, uploaders, durations and thumbnails of new
+// songs. Tests can swap it for one backed by an httptest server.
+var metadataFetcher utils.MetadataFetcher = utils.NewMetadataFetcher()
+
+// fetchSongMetadata asks the song's provider for its metadata
+func fetchSongMetadata(ctx context.Context, media *utils.Media) (*utils.MediaMetadata, error) {
+	metadata, err := metadataFetcher.FetchMetadata(ctx, media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s metadata: %w", media.Provider, err)
+	}
+	return metadata, nil
+}
+
+// fillSongMetadata fills in the name, thumbnail and duration of a song that
+// were left empty from its provider's metadata. Songs are saved without it if
+// the provider cannot be reached.
+func fillSongMetadata(ctx context.Context, song *models.Song, media *utils.Media) {
+	if song.NameOriginal != "" && song.ThumbnailURL != "" && song.Duration > 0 {
+		return
+	}
+
+	metadata, err := fetchSongMetadata(ctx, media)
+	if err != nil {
+		if !errors.Is(err, utils.ErrNoMetadata) {
+			log.Printf("fillSongMetadata: %v", err)
+		}
+		return
+	}
+	if song.NameOriginal == "" {
+		song.NameOriginal = strings.TrimSpace(metadata.Title)
+	}
+	if song.ThumbnailURL == "" {
+		song.ThumbnailURL = metadata.ThumbnailURL
+	}
+	if song.Duration == 0 {
+		song.Duration = int(metadata.Duration)
+	}
+}
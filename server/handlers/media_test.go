@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/utils"
+)
+
+// useTestMetadata points metadataFetcher at a test server for one test
+func useTestMetadata(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := metadataFetcher
+	metadataFetcher = &utils.HTTPMetadataFetcher{
+		Client:    server.Client(),
+		Endpoints: utils.MetadataEndpoints{YouTube: server.URL},
+	}
+	t.Cleanup(func() {
+		metadataFetcher = previous
+		server.Close()
+	})
+}
+
+func TestFillSongMetadata(t *testing.T) {
+	useTestMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"title": " Fetched Title ", "thumbnail_url": "https://example.com/fetched.jpg", "duration": 180}`))
+	})
+	media := &utils.Media{Provider: "youtube", ID: "dQw4w9WgXcQ"}
+
+	song := models.Song{}
+	fillSongMetadata(context.Background(), &song, media)
+	if song.NameOriginal != "Fetched Title" || song.ThumbnailURL != "https://example.com/fetched.jpg" || song.Duration != 180 {
+		t.Errorf("song = %+v; want the fetched metadata", song)
+	}
+
+	// What the user entered is kept
+	song = models.Song{NameOriginal: "Own Title", ThumbnailURL: "https://example.com/own.jpg"}
+	fillSongMetadata(context.Background(), &song, media)
+	if song.NameOriginal != "Own Title" || song.ThumbnailURL != "https://example.com/own.jpg" || song.Duration != 180 {
+		t.Errorf("song = %+v; want only the duration filled in", song)
+	}
+}
+
+func TestFillSongMetadataProviderDown(t *testing.T) {
+	useTestMetadata(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	song := models.Song{NameOriginal: "Own Title"}
+	fillSongMetadata(context.Background(), &song, &utils.Media{Provider: "youtube", ID: "dQw4w9WgXcQ"})
+	if song.NameOriginal != "Own Title" || song.ThumbnailURL != "" || song.Duration != 0 {
+		t.Errorf("song = %+v; want it left as it was", song)
+	}
+}
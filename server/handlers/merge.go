@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// mergeTypes are the entity types the merge tool handles
+var mergeTypes = []string{database.TrashArtist, database.TrashUnit, database.TrashAlbum, database.TrashSong}
+
+// mergeCandidate is an entity the merge page offers to keep or fold in
+type mergeCandidate struct {
+	ID           uint
+	NameOriginal string
+	NameEnglish  string
+}
+
+// mergeCandidates lists the entities of a type whose names contain query,
+// or all of them when query is empty
+func mergeCandidates(store database.Store, entityType, query string) ([]mergeCandidate, error) {
+	var candidates []mergeCandidate
+	switch entityType {
+	case database.TrashArtist:
+		artists, err := store.GetAllArtists()
+		if err != nil {
+			return nil, err
+		}
+		for _, artist := range artists {
+			candidates = append(candidates, mergeCandidate{artist.ArtistID, artist.NameOriginal, artist.NameEnglish})
+		}
+	case database.TrashUnit:
+		units, err := store.GetAllUnits()
+		if err != nil {
+			return nil, err
+		}
+		for _, unit := range units {
+			candidates = append(candidates, mergeCandidate{unit.UnitID, unit.NameOriginal, unit.NameEnglish})
+		}
+	case database.TrashAlbum:
+		albums, err := store.GetAllAlbums()
+		if err != nil {
+			return nil, err
+		}
+		for _, album := range albums {
+			candidates = append(candidates, mergeCandidate{album.AlbumID, album.NameOriginal, album.NameEnglish})
+		}
+	case database.TrashSong:
+		songs, err := store.GetAllSongs()
+		if err != nil {
+			return nil, err
+		}
+		for _, song := range songs {
+			candidates = append(candidates, mergeCandidate{song.SongID, song.NameOriginal, song.NameEnglish})
+		}
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return candidates, nil
+	}
+	matches := candidates[:0]
+	for _, candidate := range candidates {
+		if strings.Contains(strings.ToLower(candidate.NameOriginal), query) ||
+			strings.Contains(strings.ToLower(candidate.NameEnglish), query) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches, nil
+}
+
+// mergeCollisionRow is a vote collision as the merge page shows it
+type mergeCollisionRow struct {
+	database.VoteCollision
+	Username string
+}
+
+// renderAdminMerge shows the merge page for the entity type and search of
+// the request, with the report of a merge or preview if there is one
+func renderAdminMerge(c *gin.Context, store database.Store, status int, req database.MergeRequest, report *database.MergeReport, message string) {
+	entityType := c.DefaultQuery("type", c.DefaultPostForm("type", database.TrashArtist))
+	query := c.DefaultQuery("q", c.PostForm("q"))
+
+	templateData := GetUserContext(c)
+	templateData["title"] = "SyncRate | Merge Duplicates"
+	templateData["types"] = mergeTypes
+	templateData["entityType"] = entityType
+	templateData["query"] = query
+	templateData["votePolicies"] = database.VotePolicies
+	templateData["votePolicy"] = req.VotePolicy
+	templateData["survivorID"] = req.SurvivorID
+	duplicates := make(map[uint]bool, len(req.DuplicateIDs))
+	for _, id := range req.DuplicateIDs {
+		duplicates[id] = true
+	}
+	templateData["duplicates"] = duplicates
+	if message != "" {
+		templateData["error"] = message
+	}
+
+	candidates, err := mergeCandidates(store, entityType, query)
+	if err != nil {
+		log.Printf("renderAdminMerge: %v", err)
+		templateData["error"] = "Failed to load " + entityType + "s"
+		status = http.StatusInternalServerError
+	}
+	templateData["candidates"] = candidates
+
+	if report != nil {
+		names := make(map[uint]string, len(candidates))
+		for _, candidate := range candidates {
+			names[candidate.ID] = candidate.NameOriginal
+		}
+		templateData["report"] = report
+		templateData["names"] = names
+
+		users, err := store.GetAllUsers()
+		if err != nil {
+			log.Printf("renderAdminMerge: %v", err)
+		}
+		usernames := make(map[uint]string, len(users))
+		for _, user := range users {
+			usernames[user.UserID] = user.Username
+		}
+		collisions := make([]mergeCollisionRow, len(report.Collisions))
+		for i, collision := range report.Collisions {
+			collisions[i] = mergeCollisionRow{VoteCollision: collision, Username: usernames[collision.UserID]}
+		}
+		templateData["collisions"] = collisions
+	}
+	c.HTML(status, "admin-merge.html", templateData)
+}
+
+// GetAdminMerge shows the merge tool. The type and q query parameters pick
+// the entity type and filter the candidates by name.
+func GetAdminMerge(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderAdminMerge(c, store, http.StatusOK, database.MergeRequest{}, nil, "")
+	}
+}
+
+// mergeQueuedSongs points the radio queues holding merged songs at the
+// survivor. The merge stands if it fails.
+func mergeQueuedSongs(store database.Store, report *database.MergeReport) {
+	survivor, err := store.GetSongByID(report.SurvivorID)
+	if err != nil {
+		log.Printf("mergeQueuedSongs: %v", err)
+		return
+	}
+	merge := wsocket.SongMerge{DuplicateIDs: report.DuplicateIDs, SurvivorID: survivor.SongID, Title: queueTitle(survivor)}
+	if err := radioRoomManager.MergeQueuedSongs(merge); err != nil {
+		log.Printf("mergeQueuedSongs: %v", err)
+	}
+}
+
+// PostAdminMerge previews or runs a merge. The survivor is the "survivor"
+// field, the duplicates the "duplicate" fields; "preview" only reports what
+// the merge would do.
+func PostAdminMerge(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := database.MergeRequest{
+			EntityType: c.PostForm("type"),
+			VotePolicy: c.PostForm("vote_policy"),
+			DryRun:     c.PostForm("preview") != "",
+		}
+		if id, err := strconv.ParseUint(c.PostForm("survivor"), 10, 32); err == nil {
+			req.SurvivorID = uint(id)
+		}
+		for _, value := range c.PostFormArray("duplicate") {
+			if id, err := strconv.ParseUint(value, 10, 32); err == nil {
+				req.DuplicateIDs = append(req.DuplicateIDs, uint(id))
+			}
+		}
+
+		var report *database.MergeReport
+		err := store.Transaction(func(tx database.Store) error {
+			var err error
+			if report, err = tx.MergeEntities(req); err != nil || report.DryRun {
+				return err
+			}
+			before := gin.H{"DuplicateIDs": report.DuplicateIDs}
+			if dropped := report.DroppedVotes(); len(dropped) > 0 {
+				before["DroppedVotes"] = dropped
+			}
+			event := newAuditEvent(c, models.AuditMerge, req.EntityType, report.SurvivorID, before, report)
+			return tx.RecordAuditEvent(&event)
+		})
+		if err != nil {
+			log.Printf("PostAdminMerge: %v", err)
+			message := "Failed to merge"
+			if errors.Is(err, database.ErrValidation) || errors.Is(err, database.ErrNotFound) {
+				message += ": " + err.Error()
+			}
+			renderAdminMerge(c, store, storeErrorStatus(err), req, nil, message)
+			return
+		}
+
+		if !report.DryRun {
+			log.Printf("PostAdminMerge: Merged %s %v into %d", report.EntityType, report.DuplicateIDs, report.SurvivorID)
+			if report.EntityType == database.TrashSong {
+				mergeQueuedSongs(store, report)
+			}
+		}
+		renderAdminMerge(c, store, http.StatusOK, req, report, "")
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+)
+
+func TestPostAdminMergeSongs(t *testing.T) {
+	store := memory.New()
+	admin := createTestAdmin(t, store)
+	survivor := createTestSong(t, store, "survivor")
+	duplicate := createTestSong(t, store, "duplicate")
+	other := createTestSong(t, store, "other")
+
+	// The admin rated both songs; the older vote is dropped
+	for i, songID := range []uint{survivor.SongID, duplicate.SongID} {
+		if err := store.UpsertVote(&models.Vote{UserID: admin.UserID, SongID: songID, Rating: 3 + 5*i}); err != nil {
+			t.Fatalf("UpsertVote: %v", err)
+		}
+	}
+	room := models.RatingRoom{RoomID: "rating1", CreatorID: admin.UserID}
+	if err := store.CreateRatingRoom(&room); err != nil {
+		t.Fatalf("CreateRatingRoom: %v", err)
+	}
+	for _, songID := range []uint{duplicate.SongID, other.SongID} {
+		if err := store.SetRatingRoomCurrentSong(room.RoomID, songID); err != nil {
+			t.Fatalf("SetRatingRoomCurrentSong: %v", err)
+		}
+	}
+	duplicateID := duplicate.SongID
+	tournament := models.TournamentRoom{RoomID: "bracket1", CreatorID: admin.UserID, Status: "in_progress", TreeState: models.TreeState{
+		Rounds: []models.Round{{RoundNumber: 1, Matches: []models.Match{{
+			MatchID:   "r1m1",
+			Song1:     &models.MatchSong{SongID: &duplicateID, SongTitle: "duplicate"},
+			UserPicks: []models.UserPick{{UserID: "1", PickedSongID: &duplicateID}},
+		}}}},
+	}}
+	if err := store.CreateTournamentRoom(&tournament); err != nil {
+		t.Fatalf("CreateTournamentRoom: %v", err)
+	}
+	radioRoomManager.CreateRoom("radio1", "1", "admin")
+	radio, _ := radioRoomManager.GetRoom("radio1")
+	radio.Queue = []wsocket.QueueItem{{ID: "a", SongID: duplicate.SongID}, {ID: "b", SongID: other.SongID}}
+	t.Cleanup(func() { radioRoomManager.CleanupInactiveRooms(0) })
+
+	r := newTestRouter(t, admin)
+	r.POST("/admin/merge", PostAdminMerge(store))
+	w := serveForm(r, http.MethodPost, "/admin/merge", url.Values{
+		"type":      {database.TrashSong},
+		"survivor":  {fmt.Sprint(survivor.SongID)},
+		"duplicate": {fmt.Sprint(duplicate.SongID)},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200", w.Code)
+	}
+
+	updated, err := store.GetRatingRoom(room.RoomID)
+	if err != nil {
+		t.Fatalf("GetRatingRoom: %v", err)
+	}
+	if want := []uint{other.SongID, survivor.SongID}; !slices.Equal(updated.RecentSongIDs, want) {
+		t.Errorf("recent songs = %v; want %v", updated.RecentSongIDs, want)
+	}
+	if radio.Queue[0].SongID != survivor.SongID || radio.Queue[0].Title != "survivor" {
+		t.Errorf("queue = %+v; want the survivor first", radio.Queue)
+	}
+
+	bracket, err := store.GetTournamentRoom(tournament.RoomID)
+	if err != nil {
+		t.Fatalf("GetTournamentRoom: %v", err)
+	}
+	match := bracket.TreeState.Rounds[0].Matches[0]
+	if *match.Song1.SongID != survivor.SongID || *match.UserPicks[0].PickedSongID != survivor.SongID {
+		t.Errorf("bracket song %d, pick %d; want the survivor %d", *match.Song1.SongID, *match.UserPicks[0].PickedSongID, survivor.SongID)
+	}
+
+	event := lastAuditEvent(t, store)
+	if event.Action != models.AuditMerge {
+		t.Fatalf("last audit event is %s; want merge", event.Action)
+	}
+	var before struct {
+		DroppedVotes []models.Vote
+	}
+	if err := json.Unmarshal(event.Before, &before); err != nil {
+		t.Fatalf("audit before: %v", err)
+	}
+	if len(before.DroppedVotes) != 1 || before.DroppedVotes[0].SongID != survivor.SongID {
+		t.Errorf("dropped votes = %+v; want the admin's vote on the survivor", before.DroppedVotes)
+	}
+	var report database.MergeReport
+	if err := json.Unmarshal(event.After, &report); err != nil {
+		t.Fatalf("audit after: %v", err)
+	}
+	if report.RoomsMoved != 2 || len(report.Collisions) != 1 || len(report.Collisions[0].Dropped) != 1 {
+		t.Errorf("report = %+v; want two rooms moved and one dropped vote", report)
+	}
+}
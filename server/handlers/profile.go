@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/gin-gonic/gin"
+)
+
+// profileBar is one bar of a chart on the profile page
+type profileBar struct {
+	Label   string
+	Count   int64
+	Percent float64 // Width relative to the largest bar
+}
+
+// profileBars scales counts to the largest one
+func profileBars(labels []string, counts []int64) []profileBar {
+	var largest int64
+	for _, count := range counts {
+		largest = max(largest, count)
+	}
+	bars := make([]profileBar, len(counts))
+	for i, count := range counts {
+		bars[i] = profileBar{Label: labels[i], Count: count}
+		if largest > 0 {
+			bars[i].Percent = float64(count) * 100 / float64(largest)
+		}
+	}
+	return bars
+}
+
+// renderProfile shows the taste profile of a user
+func renderProfile(c *gin.Context, store database.Store, userID uint) {
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			c.HTML(http.StatusNotFound, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "User not found",
+			})
+			return
+		}
+		log.Printf("renderProfile: Error loading user %d: %v", userID, err)
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"title": "SyncRate | Error",
+			"error": "Failed to load user",
+		})
+		return
+	}
+
+	stats, err := store.GetUserStats(userID)
+	if err != nil {
+		log.Printf("renderProfile: Error loading stats of user %d: %v", userID, err)
+		c.HTML(storeErrorStatus(err), "error.html", gin.H{
+			"title": "SyncRate | Error",
+			"error": "Failed to load the profile of " + user.Username,
+		})
+		return
+	}
+
+	labels := make([]string, len(stats.Distribution))
+	counts := make([]int64, len(stats.Distribution))
+	for i, rating := range stats.Distribution {
+		labels[i] = strconv.Itoa(rating.Rating)
+		counts[i] = rating.Count
+	}
+	distribution := profileBars(labels, counts)
+
+	labels = make([]string, len(stats.Activity))
+	counts = make([]int64, len(stats.Activity))
+	for i, period := range stats.Activity {
+		labels[i] = period.Month
+		counts[i] = period.VoteCount
+	}
+	activity := profileBars(labels, counts)
+
+	templateData := GetUserContext(c)
+	templateData["title"] = "SyncRate | " + user.Username
+	templateData["profile"] = newUserResponse(*user)
+	templateData["stats"] = stats
+	templateData["coveragePercent"] = stats.Coverage * 100
+	templateData["distribution"] = distribution
+	templateData["activity"] = activity
+	if currentID, exists := c.Get("user_id"); exists && currentID != nil {
+		if currentID == userID {
+			templateData["is_own_profile"] = true
+		} else {
+			templateData["compare_url"] = "/users/" + strconv.FormatUint(uint64(currentID.(uint)), 10) + "/compare/" + strconv.FormatUint(uint64(userID), 10)
+		}
+	}
+	c.HTML(http.StatusOK, "profile.html", templateData)
+}
+
+// GetMyProfile shows the taste profile of the logged in user
+func GetMyProfile(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists || userID == nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+		renderProfile(c, store, userID.(uint))
+	}
+}
+
+// GetUserProfile shows the taste profile of any user
+func GetUserProfile(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Invalid user ID",
+			})
+			return
+		}
+		renderProfile(c, store, uint(id))
+	}
+}
+
+// compareSongLimit is how many agreements and disagreements the compare page lists
+const compareSongLimit = 10
+
+// compareRow is a song two users both rated, as the compare page shows it
+type compareRow struct {
+	database.SharedRating
+	Difference int // Absolute difference of the ratings
+}
+
+// GetCompareUsers compares the ratings of two users: how compatible they
+// are and the songs they agree and disagree on most
+func GetCompareUsers(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idA, errA := strconv.ParseUint(c.Param("id"), 10, 32)
+		idB, errB := strconv.ParseUint(c.Param("other"), 10, 32)
+		if errA != nil || errB != nil || idA == idB {
+			c.HTML(http.StatusBadRequest, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Pick two different users to compare",
+			})
+			return
+		}
+
+		userA, errA := store.GetUserByID(uint(idA))
+		userB, errB := store.GetUserByID(uint(idB))
+		if errA != nil || errB != nil {
+			c.HTML(http.StatusNotFound, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "User not found",
+			})
+			return
+		}
+
+		shared, err := store.GetSharedRatings(userA.UserID, userB.UserID)
+		if err != nil {
+			log.Printf("GetCompareUsers: Error comparing users %d and %d: %v", idA, idB, err)
+			c.HTML(storeErrorStatus(err), "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Failed to compare " + userA.Username + " and " + userB.Username,
+			})
+			return
+		}
+
+		rows := make([]compareRow, len(shared))
+		for i, rating := range shared {
+			rows[i] = compareRow{SharedRating: rating, Difference: max(rating.RatingA-rating.RatingB, rating.RatingB-rating.RatingA)}
+		}
+
+		// Agreements favour songs both liked, disagreements the widest gaps
+		agreements := slices.Clone(rows)
+		sort.SliceStable(agreements, func(i, j int) bool {
+			if agreements[i].Difference != agreements[j].Difference {
+				return agreements[i].Difference < agreements[j].Difference
+			}
+			return agreements[i].RatingA+agreements[i].RatingB > agreements[j].RatingA+agreements[j].RatingB
+		})
+		disagreements := slices.Clone(rows)
+		sort.SliceStable(disagreements, func(i, j int) bool {
+			return disagreements[i].Difference > disagreements[j].Difference
+		})
+		for len(disagreements) > 0 && disagreements[len(disagreements)-1].Difference == 0 {
+			disagreements = disagreements[:len(disagreements)-1]
+		}
+
+		compatibility := database.CompareRatings(userA.UserID, userB.UserID, shared)
+
+		templateData := GetUserContext(c)
+		templateData["title"] = "SyncRate | " + userA.Username + " vs " + userB.Username
+		templateData["userA"] = newUserResponse(*userA)
+		templateData["userB"] = newUserResponse(*userB)
+		templateData["compatibility"] = compatibility
+		if compatibility.Correlation != nil {
+			templateData["correlation"] = *compatibility.Correlation
+		}
+		templateData["agreements"] = agreements[:min(len(agreements), compareSongLimit)]
+		templateData["disagreements"] = disagreements[:min(len(disagreements), compareSongLimit)]
+		c.HTML(http.StatusOK, "compare-users.html", templateData)
+	}
+}
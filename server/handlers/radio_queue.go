@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultSkipThreshold is the share of listeners that must vote to skip
+	// a song when the room does not set one
+	defaultSkipThreshold = 0.5
+
+	maxSongSearchResults = 20
+)
+
+// skipThreshold returns the room's skip threshold, or the default if it is
+// not set to a share between 0 and 1
+func skipThreshold(room *models.RadioRoom) float64 {
+	if room.SkipThreshold <= 0 || room.SkipThreshold > 1 {
+		return defaultSkipThreshold
+	}
+	return room.SkipThreshold
+}
+
+// queueTitle is the title shown for a song in the queue
+func queueTitle(song *models.Song) string {
+	if song.NameEnglish != "" && song.NameEnglish != song.NameOriginal {
+		return song.NameOriginal + " (" + song.NameEnglish + ")"
+	}
+	return song.NameOriginal
+}
+
+// currentRadioSongID returns the song a radio room is playing, or 0
+func currentRadioSongID(roomID string) uint {
+	room, exists := radioRoomManager.GetRoom(roomID)
+	if !exists {
+		return 0
+	}
+
+	room.Mutex.RLock()
+	defer room.Mutex.RUnlock()
+	if room.CurrentSongID == nil {
+		return 0
+	}
+	return *room.CurrentSongID
+}
+
+// handleQueueAdd adds a song to the room queue by its ID
+func handleQueueAdd(store database.Store, client *wsocket.Client, msg wsocket.WSMessage) {
+	var data wsocket.QueueRequestData
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.SongID == 0 {
+		sendRoomError(client, msg.Type, &wsocket.RoomError{Message: "Choose a song to queue"})
+		return
+	}
+
+	song, err := store.GetSongByID(data.SongID)
+	if err != nil {
+		if !errors.Is(err, database.ErrNotFound) {
+			log.Printf("handleQueueAdd: %v", err)
+		}
+		sendRoomError(client, msg.Type, &wsocket.RoomError{Message: "Song not found"})
+		return
+	}
+
+	if err := radioRoomManager.Enqueue(client, song.SongID, queueTitle(song)); err != nil {
+		sendRoomError(client, msg.Type, err)
+	}
+}
+
+// handleQueueItem applies an upvote, removal or move to a queued song
+func handleQueueItem(client *wsocket.Client, msg wsocket.WSMessage) {
+	var data wsocket.QueueRequestData
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.ItemID == "" {
+		sendRoomError(client, msg.Type, &wsocket.RoomError{Message: "Choose a song in the queue"})
+		return
+	}
+
+	var err error
+	switch msg.Type {
+	case wsocket.MsgQueueUpvote:
+		err = radioRoomManager.ToggleUpvote(client, data.ItemID)
+	case wsocket.MsgQueueRemove:
+		err = radioRoomManager.RemoveFromQueue(client, data.ItemID)
+	case wsocket.MsgQueueMove:
+		err = radioRoomManager.MoveInQueue(client, data.ItemID, data.Position)
+	}
+	if err != nil {
+		sendRoomError(client, msg.Type, err)
+	}
+}
+
+// handleVoteSkip records a vote to skip the current song and moves on once
+// enough listeners voted
+func handleVoteSkip(store database.Store, roomID string, client *wsocket.Client, msg wsocket.WSMessage) {
+	room, err := store.GetRadioRoom(roomID)
+	if err != nil {
+		log.Printf("handleVoteSkip: %v", err)
+		return
+	}
+
+	songID := currentRadioSongID(roomID)
+	reached, err := radioRoomManager.VoteSkip(client, skipThreshold(room))
+	if err != nil {
+		sendRoomError(client, msg.Type, err)
+		return
+	}
+	if reached {
+		handleRadioNextSong(store, roomID, songID)
+	}
+}
+
+// handleRadioSongEnded moves on when a player reports the end of a song.
+// Every listener's player reports it; only the first report counts. Reports
+// well before the end by the server's clock are ignored, or any listener
+// could skip without a vote.
+func handleRadioSongEnded(store database.Store, roomID string, data json.RawMessage) {
+	var songData wsocket.NextSongData
+	if err := json.Unmarshal(data, &songData); err != nil {
+		log.Printf("Error unmarshaling song ended data: %v", err)
+		return
+	}
+	if !radioRoomManager.NearEnd(roomID, songData.SongID) {
+		log.Printf("Ignoring early end of song %d in radio room %s", songData.SongID, roomID)
+		return
+	}
+	handleRadioNextSong(store, roomID, songData.SongID)
+}
+
+// sendRadioQueue sends the room queue to a newly connected client
+func sendRadioQueue(roomID string, client *wsocket.Client) {
+	room, exists := radioRoomManager.GetRoom(roomID)
+	if !exists {
+		return
+	}
+	client.SendJSON(wsocket.QueueUpdateMessage(room))
+}
+
+// GetRadioRoomSongSearch finds songs by name for the room queue
+func GetRadioRoomSongSearch(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists || userID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		access, err := loadRoomAccess(store, models.RoomTypeRadio, c.Param("roomId"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+			return
+		}
+		if err := checkRoomAccess(store, access, userID.(uint), isGuest(c)); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot access this room"})
+			return
+		}
+
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			c.JSON(http.StatusOK, gin.H{"songs": []gin.H{}})
+			return
+		}
+
+		songs, err := store.GetSongsByName(query)
+		if err != nil {
+			log.Printf("GetRadioRoomSongSearch: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search songs"})
+			return
+		}
+
+		results := make([]gin.H, 0, min(len(songs), maxSongSearchResults))
+		for i := range songs {
+			if len(results) == maxSongSearchResults {
+				break
+			}
+			results = append(results, gin.H{
+				"song_id": songs[i].SongID,
+				"title":   queueTitle(&songs[i]),
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"songs": results})
+	}
+}
@@ -3,17 +3,18 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/CptPie/SyncRate/database"
 	"github.com/CptPie/SyncRate/models"
-	"github.com/CptPie/SyncRate/server/utils"
 	wsocket "github.com/CptPie/SyncRate/server/websocket"
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
-	"gorm.io/gorm"
 )
 
 var (
@@ -21,8 +22,11 @@ var (
 	radioRoomManager = wsocket.NewRoomManager()
 )
 
+// radioPlaybackTick is how often radio rooms get the server's position
+const radioPlaybackTick = 5 * time.Second
+
 // StartRadioRoomDatabaseCleanup starts a background routine to clean up old radio rooms from the database
-func StartRadioRoomDatabaseCleanup(db *gorm.DB) {
+func StartRadioRoomDatabaseCleanup(store database.Store) {
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
@@ -30,29 +34,37 @@ func StartRadioRoomDatabaseCleanup(db *gorm.DB) {
 		for {
 			select {
 			case <-ticker.C:
-				cleanupOldRadioRooms(db, 24*time.Hour)
+				cleanupOldRadioRooms(store, 24*time.Hour)
 			}
 		}
 	}()
 }
 
+// StartRadioPlaybackClock starts the routine that keeps radio room players
+// in sync and moves rooms on when a song ends. Call it after UseRoomBackend.
+func StartRadioPlaybackClock(store database.Store) {
+	radioRoomManager.StartPlaybackClock(radioPlaybackTick, func(roomID string, songID uint) {
+		handleRadioNextSong(store, roomID, songID)
+	})
+}
+
 // cleanupOldRadioRooms removes radio rooms that haven't been active for the specified duration
-func cleanupOldRadioRooms(db *gorm.DB, inactivityThreshold time.Duration) {
+func cleanupOldRadioRooms(store database.Store, inactivityThreshold time.Duration) {
 	cutoffTime := time.Now().Add(-inactivityThreshold)
 
-	result := db.Where("last_active < ?", cutoffTime).Delete(&models.RadioRoom{})
-	if result.Error != nil {
-		log.Printf("Error cleaning up old radio rooms: %v", result.Error)
+	deleted, err := store.DeleteInactiveRadioRooms(cutoffTime)
+	if err != nil {
+		log.Printf("Error cleaning up old radio rooms: %v", err)
 		return
 	}
 
-	if result.RowsAffected > 0 {
-		log.Printf("Cleaned up %d inactive radio rooms from database (older than %v)", result.RowsAffected, inactivityThreshold)
+	if deleted > 0 {
+		log.Printf("Cleaned up %d inactive radio rooms from database (older than %v)", deleted, inactivityThreshold)
 	}
 }
 
 // GetCreateRadioRoom shows the radio room creation page
-func GetCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
+func GetCreateRadioRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated
 		if userID, exists := c.Get("user_id"); !exists || userID == nil {
@@ -60,9 +72,17 @@ func GetCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Guests need an account to host rooms
+		if isGuest(c) {
+			c.Redirect(http.StatusFound, "/register")
+			return
+		}
+
 		// Load categories for filter options
-		var categories []models.Category
-		db.Find(&categories)
+		categories, err := store.GetAllCategories()
+		if err != nil {
+			log.Printf("Error loading categories: %v", err)
+		}
 
 		templateData := GetUserContext(c)
 		templateData["title"] = "SyncRate | Create Radio Room"
@@ -73,7 +93,7 @@ func GetCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // PostCreateRadioRoom creates a new radio room
-func PostCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
+func PostCreateRadioRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated
 		userID, exists := c.Get("user_id")
@@ -81,12 +101,21 @@ func PostCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 			return
 		}
+		if isGuest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Create an account to host rooms"})
+			return
+		}
 
 		// Parse request body for filters
 		var requestBody struct {
-			CategoryID    *uint `json:"category_id"`
-			MinRating     *int  `json:"min_rating"`
-			IncludeCovers bool  `json:"include_covers"`
+			CategoryID    *uint   `json:"category_id"`
+			MinRating     *int    `json:"min_rating"`
+			IncludeCovers bool    `json:"include_covers"`
+			Password      string  `json:"password"`
+			InviteOnly    bool    `json:"invite_only"`
+			AllowGuests   bool    `json:"allow_guests"`
+			SkipThreshold float64 `json:"skip_threshold"`
+			SongSelection string  `json:"song_selection"`
 		}
 
 		// Bind JSON, but don't fail if body is empty (filters are optional)
@@ -94,11 +123,39 @@ func PostCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
 			log.Printf("Error parsing request body: %v", err)
 		}
 
-		log.Printf("Creating radio room with filters: %+v", requestBody)
+		// Never log the password itself
+		log.Printf("Creating radio room with filters: category=%v min_rating=%v include_covers=%v password=%v invite_only=%v",
+			requestBody.CategoryID, requestBody.MinRating, requestBody.IncludeCovers, requestBody.Password != "", requestBody.InviteOnly)
+
+		// Share of listeners needed to vote-skip a song
+		if requestBody.SkipThreshold == 0 {
+			requestBody.SkipThreshold = defaultSkipThreshold
+		}
+		if requestBody.SkipThreshold < 0 || requestBody.SkipThreshold > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Skip threshold must be between 0 and 100%"})
+			return
+		}
+
+		// How the next song is picked
+		if requestBody.SongSelection == "" {
+			requestBody.SongSelection = models.SongSelectionRandom
+		}
+		if !slices.Contains(models.SongSelections, requestBody.SongSelection) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown song selection"})
+			return
+		}
 
 		// Generate unique room code
 		roomID := generateRadioRoomCode()
 
+		// Optional room password, hashed like user passwords
+		passwordHash, err := hashRoomPassword(requestBody.Password)
+		if err != nil {
+			log.Printf("Error hashing room password: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+			return
+		}
+
 		// Create room in database
 		room := models.RadioRoom{
 			RoomID:        roomID,
@@ -106,11 +163,16 @@ func PostCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
 			CategoryID:    requestBody.CategoryID,
 			MinRating:     requestBody.MinRating,
 			IncludeCovers: requestBody.IncludeCovers,
+			PasswordHash:  passwordHash,
+			InviteOnly:    requestBody.InviteOnly,
+			AllowGuests:   requestBody.AllowGuests,
+			SkipThreshold: requestBody.SkipThreshold,
+			SongSelection: requestBody.SongSelection,
 			CreatedAt:     time.Now(),
 			LastActive:    time.Now(),
 		}
 
-		if err := db.Create(&room).Error; err != nil {
+		if err := store.CreateRadioRoom(&room); err != nil {
 			log.Printf("Error creating radio room in database: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
 			return
@@ -134,21 +196,21 @@ func PostCreateRadioRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // GetRadioRoom shows the radio room interface
-func GetRadioRoom(db *gorm.DB) gin.HandlerFunc {
+func GetRadioRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roomID := c.Param("roomId")
 
 		// Check if user is authenticated
 		userID, exists := c.Get("user_id")
 		if !exists || userID == nil {
-			c.Redirect(http.StatusFound, "/login")
+			redirectToSignIn(c, store, models.RoomTypeRadio, roomID)
 			return
 		}
 
 		// Check if room exists in database
-		var room models.RadioRoom
-		if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
+		room, err := store.GetRadioRoom(roomID)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
 				c.HTML(http.StatusNotFound, "error.html", gin.H{
 					"title": "SyncRate | Room Not Found",
 					"error": "Radio room not found",
@@ -162,9 +224,14 @@ func GetRadioRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Password-protected and invite-only rooms
+		if !guardRoomPage(c, store, models.RoomTypeRadio, roomID, userID.(uint)) {
+			return
+		}
+
 		templateData := GetUserContext(c)
 		templateData["title"] = fmt.Sprintf("SyncRate | Radio Room %s", roomID)
-		templateData["room"] = room
+		templateData["room"] = *room
 		templateData["room_id"] = roomID
 
 		c.HTML(http.StatusOK, "radio-room.html", templateData)
@@ -172,7 +239,7 @@ func GetRadioRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // GetRadioRoomWS handles WebSocket connections for radio rooms
-func GetRadioRoomWS(db *gorm.DB) gin.HandlerFunc {
+func GetRadioRoomWS(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roomID := c.Param("roomId")
 
@@ -195,32 +262,38 @@ func GetRadioRoomWS(db *gorm.DB) gin.HandlerFunc {
 			log.Printf("WebSocket upgrade error: %v", err)
 			return
 		}
-		defer conn.Close()
 
-		// Join room
+		// Join room if the user may enter it
 		userIDStr := fmt.Sprintf("%d", userID.(uint))
-		if err := radioRoomManager.JoinRoom(roomID, userIDStr, usernameStr, conn); err != nil {
+		err = checkRoomJoin(store, models.RoomTypeRadio, roomID, userID.(uint), isGuest(c))
+		var client *wsocket.Client
+		if err == nil {
+			client, err = radioRoomManager.JoinRoom(roomID, userIDStr, usernameStr, conn)
+		}
+		if err != nil {
 			log.Printf("Error joining radio room: %v", err)
 			conn.WriteJSON(map[string]interface{}{
 				"type":  "error",
 				"error": err.Error(),
 			})
+			conn.Close()
 			return
 		}
 
-		// Handle connection
-		handleRadioRoomConnection(db, roomID, userIDStr, conn)
+		// Handle connection; from here on only the client writes to conn
+		// and its writer closes it
+		handleRadioRoomConnection(store, roomID, userIDStr, client)
 
 		// Clean up when connection closes
-		radioRoomManager.LeaveRoom(userIDStr)
+		radioRoomManager.LeaveRoom(client.SessionID)
 	}
 }
 
 // handleRadioRoomConnection manages the WebSocket connection for a radio room
-func handleRadioRoomConnection(db *gorm.DB, roomID, userID string, conn *websocket.Conn) {
+func handleRadioRoomConnection(store database.Store, roomID, userID string, client *wsocket.Client) {
 	// Check if room exists in database
-	if err := checkRadioRoomExists(db, roomID); err != nil {
-		conn.WriteJSON(map[string]interface{}{
+	if err := checkRadioRoomExists(store, roomID); err != nil {
+		client.SendJSON(map[string]interface{}{
 			"type":  "error",
 			"error": "This radio room no longer exists",
 		})
@@ -228,72 +301,104 @@ func handleRadioRoomConnection(db *gorm.DB, roomID, userID string, conn *websock
 	}
 
 	// Send initial room state
-	sendRadioRoomState(db, roomID, conn)
+	sendRadioRoomState(store, roomID, client)
 
 	// Listen for messages
 	for {
 		var msg wsocket.WSMessage
-		if err := conn.ReadJSON(&msg); err != nil {
+		if err := client.Conn.ReadJSON(&msg); err != nil {
 			log.Printf("WebSocket read error: %v", err)
 			break
 		}
 
-		handleRadioRoomMessage(db, roomID, userID, msg, conn)
+		handleRadioRoomMessage(store, roomID, userID, msg, client)
 	}
 }
 
 // sendRadioRoomState sends the current room state to a newly connected client
-func sendRadioRoomState(db *gorm.DB, roomID string, conn *websocket.Conn) {
+func sendRadioRoomState(store database.Store, roomID string, client *wsocket.Client) {
 	// Get room from database
-	var room models.RadioRoom
-	if err := db.Preload("CurrentSong").Where("room_id = ?", roomID).First(&room).Error; err != nil {
+	room, err := store.GetRadioRoom(roomID)
+	if err != nil {
 		return
 	}
 
 	// Radio rooms always have video sync enabled
 	settingsData, _ := json.Marshal(wsocket.RoomSettingsData{
 		VideoSyncEnabled: true,
+		SkipThreshold:    skipThreshold(room),
 	})
 	settingsMessage := wsocket.WSMessage{
 		Type:      wsocket.MsgRoomSettings,
 		Data:      settingsData,
 		Timestamp: time.Now(),
 	}
-	conn.WriteJSON(settingsMessage)
+	client.SendJSON(settingsMessage)
 
-	// If there's a current song, send it
-	if room.CurrentSong != nil {
-		sendRadioSongData(db, roomID, *room.CurrentSong, conn)
+	// If there's a current song, send it and where it is at
+	if room.CurrentSongID != nil {
+		sendRadioSongData(store, roomID, models.Song{SongID: *room.CurrentSongID}, client)
+		if liveRoom, exists := radioRoomManager.GetRoom(roomID); exists {
+			client.SendJSON(wsocket.PlaybackSyncMessage(liveRoom))
+		}
 	}
+
+	sendRadioQueue(roomID, client)
 }
 
 // handleRadioRoomMessage processes incoming WebSocket messages
-func handleRadioRoomMessage(db *gorm.DB, roomID, userID string, msg wsocket.WSMessage, conn *websocket.Conn) {
+func handleRadioRoomMessage(store database.Store, roomID, userID string, msg wsocket.WSMessage, client *wsocket.Client) {
 	// Check if room still exists in database
-	if err := checkRadioRoomExists(db, roomID); err != nil {
+	if err := checkRadioRoomExists(store, roomID); err != nil {
 		log.Printf("Radio room %s no longer exists: %v", roomID, err)
-		conn.WriteJSON(map[string]interface{}{
+		client.SendJSON(map[string]interface{}{
 			"type":  "error",
 			"error": "This radio room no longer exists. The page will reload.",
 		})
 		return
 	}
 
+	// Check the sender's role before acting on the message
+	if !authorizeMessage(radioRoomManager, client, msg, radioRoomPermissions) {
+		return
+	}
+
 	// Update last_active timestamp for any room activity
-	updateRadioRoomActivity(db, roomID)
+	updateRadioRoomActivity(store, roomID)
 
 	switch msg.Type {
 	case wsocket.MsgVideoSync:
-		// Broadcast video sync to all room members
-		radioRoomManager.BroadcastToRoom(roomID, msg)
+		// Move the room's clock and send everyone its new position
+		recordVideoSync(radioRoomManager, roomID, msg.Data)
+		if room, exists := radioRoomManager.GetRoom(roomID); exists {
+			radioRoomManager.BroadcastToRoom(roomID, wsocket.PlaybackSyncMessage(room))
+		}
+
+	case wsocket.MsgSongDuration:
+		handleRadioSongDuration(roomID, msg.Data)
 
 	case wsocket.MsgVoteUpdate:
 		// Handle vote update (broadcast to all users)
-		handleRadioVoteUpdate(db, roomID, userID, msg.Data)
+		handleRadioVoteUpdate(store, roomID, userID, msg.Data)
 
 	case wsocket.MsgNextSong:
-		// Handle next song request
-		handleRadioNextSong(db, roomID)
+		// Skip straight to the next song
+		handleRadioNextSong(store, roomID, currentRadioSongID(roomID))
+
+	case wsocket.MsgSongEnded:
+		handleRadioSongEnded(store, roomID, msg.Data)
+
+	case wsocket.MsgQueueAdd:
+		handleQueueAdd(store, client, msg)
+
+	case wsocket.MsgQueueUpvote, wsocket.MsgQueueRemove, wsocket.MsgQueueMove:
+		handleQueueItem(client, msg)
+
+	case wsocket.MsgVoteSkip:
+		handleVoteSkip(store, roomID, client, msg)
+
+	case wsocket.MsgSetRole, wsocket.MsgKickUser, wsocket.MsgBanUser, wsocket.MsgUnbanUser, wsocket.MsgTransferHost:
+		handleModeration(store, radioRoomManager, models.RoomTypeRadio, client, msg)
 
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
@@ -301,7 +406,7 @@ func handleRadioRoomMessage(db *gorm.DB, roomID, userID string, msg wsocket.WSMe
 }
 
 // handleRadioVoteUpdate processes vote updates and broadcasts them
-func handleRadioVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMessage) {
+func handleRadioVoteUpdate(store database.Store, roomID, userID string, data json.RawMessage) {
 	var voteData wsocket.VoteUpdateData
 	if err := json.Unmarshal(data, &voteData); err != nil {
 		log.Printf("Error unmarshaling vote data: %v", err)
@@ -309,8 +414,8 @@ func handleRadioVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMess
 	}
 
 	// Get current song for the room
-	var room models.RadioRoom
-	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+	room, err := store.GetRadioRoom(roomID)
+	if err != nil {
 		return
 	}
 
@@ -328,95 +433,120 @@ func handleRadioVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMess
 	radioRoomManager.BroadcastToRoom(roomID, message)
 }
 
-// handleRadioNextSong handles requests to move to the next song
-func handleRadioNextSong(db *gorm.DB, roomID string) {
-	nextSong := findNextRadioSong(db, roomID)
+// handleRadioNextSong moves the room past fromSongID to the first song in
+// its queue, or to a random song if the queue is empty. Requests for a song
+// the room already moved past are dropped.
+func handleRadioNextSong(store database.Store, roomID string, fromSongID uint) {
+	queued, ok := radioRoomManager.AdvanceQueue(roomID, fromSongID)
+	if !ok {
+		return
+	}
+
+	var nextSong *models.Song
+	if queued != nil {
+		nextSong = &models.Song{SongID: queued.SongID}
+	} else {
+		nextSong = findNextRadioSong(store, roomID)
+	}
 	if nextSong != nil {
-		updateRadioRoomCurrentSong(db, roomID, nextSong.SongID)
-		broadcastRadioSongChange(db, roomID, *nextSong)
+		updateRadioRoomCurrentSong(store, roomID, nextSong.SongID)
+		broadcastRadioSongChange(store, roomID, *nextSong)
+		// Start every player on the room's clock
+		if room, exists := radioRoomManager.GetRoom(roomID); exists {
+			radioRoomManager.BroadcastToRoom(roomID, wsocket.PlaybackSyncMessage(room))
+		}
 	} else {
 		log.Printf("No songs available for radio room %s", roomID)
+		radioRoomManager.CancelAdvance(roomID, fromSongID)
 	}
 }
 
 // findNextRadioSong finds the next song based on room filters
-func findNextRadioSong(db *gorm.DB, roomID string) *models.Song {
+func findNextRadioSong(store database.Store, roomID string) *models.Song {
 	// Load room filters from database
-	var dbRoom models.RadioRoom
-	if err := db.Where("room_id = ?", roomID).First(&dbRoom).Error; err != nil {
+	dbRoom, err := store.GetRadioRoom(roomID)
+	if err != nil {
 		log.Printf("Error loading radio room filters: %v", err)
 		return nil
 	}
 
-	// Build base query with filters
-	baseQuery := db.Preload("Artists").Preload("Units").Preload("Albums").Preload("Category")
-
-	// Apply category filter if set
-	if dbRoom.CategoryID != nil {
-		baseQuery = baseQuery.Where("category_id = ?", *dbRoom.CategoryID)
+	filter := database.SongFilter{
+		CategoryID:       dbRoom.CategoryID,
+		MinAverageRating: dbRoom.MinRating,
 	}
 
 	// Apply covers filter
 	if !dbRoom.IncludeCovers {
-		baseQuery = baseQuery.Where("is_cover = ?", false)
+		isCover := false
+		filter.IsCover = &isCover
 	}
 
-	// Apply rating filter if set
-	if dbRoom.MinRating != nil {
-		// Need to join with votes and calculate average rating
-		baseQuery = baseQuery.Where("song_id IN (?)",
-			db.Table("votes").
-				Select("song_id").
-				Group("song_id").
-				Having("AVG(rating) >= ?", *dbRoom.MinRating),
-		)
+	// Recommended modes play to everyone listening and fall back to a
+	// random song when the recommender knows nothing about them yet
+	if dbRoom.SongSelection != "" && dbRoom.SongSelection != models.SongSelectionRandom {
+		if room, exists := radioRoomManager.GetRoom(roomID); exists {
+			if song := pickRecommendedSong(store, roomUserIDs(room, false), filter, dbRoom.SongSelection); song != nil {
+				return song
+			}
+		}
 	}
 
-	var song models.Song
-	err := baseQuery.
-		Order("RANDOM()").
-		First(&song).Error
-
+	songs, err := store.RandomSongs(filter, 1)
 	if err != nil {
 		log.Printf("Error finding next radio song: %v", err)
 		return nil
 	}
+	if len(songs) == 0 {
+		log.Printf("Error finding next radio song: no song matches the room filters")
+		return nil
+	}
+
+	return &songs[0]
+}
 
-	return &song
+// handleRadioSongDuration records the length of the current song reported
+// by a player, so the room moves on when it ends
+func handleRadioSongDuration(roomID string, data json.RawMessage) {
+	var durationData wsocket.SongDurationData
+	if err := json.Unmarshal(data, &durationData); err != nil {
+		log.Printf("Error unmarshaling song duration data: %v", err)
+		return
+	}
+	radioRoomManager.SetDuration(roomID, durationData.SongID, durationData.Duration)
 }
 
-// updateRadioRoomCurrentSong updates the current song in the database
-func updateRadioRoomCurrentSong(db *gorm.DB, roomID string, songID uint) error {
-	return db.Model(&models.RadioRoom{}).
-		Where("room_id = ?", roomID).
-		Updates(map[string]interface{}{
-			"current_song_id": songID,
-			"last_active":     time.Now(),
-		}).Error
+// updateRadioRoomCurrentSong updates the current song in the database and
+// starts the room's clock
+func updateRadioRoomCurrentSong(store database.Store, roomID string, songID uint) error {
+	if err := store.SetRadioRoomCurrentSong(roomID, songID); err != nil {
+		return err
+	}
+	radioRoomManager.StartSong(roomID, songID)
+
+	// Start the clock with the catalog's duration rather than wait for a
+	// player to report it
+	if song, err := store.GetSongByID(songID); err == nil && song.Duration > 0 {
+		radioRoomManager.SetDuration(roomID, songID, float64(song.Duration))
+	}
+	return nil
 }
 
 // broadcastRadioSongChange sends a song change message to all users in the radio room
-func broadcastRadioSongChange(db *gorm.DB, roomID string, song models.Song) {
-	sendRadioSongDataToRoom(db, roomID, song)
+func broadcastRadioSongChange(store database.Store, roomID string, song models.Song) {
+	sendRadioSongDataToRoom(store, roomID, song)
 }
 
 // sendRadioSongData sends song data to a specific connection
-func sendRadioSongData(db *gorm.DB, roomID string, song models.Song, conn *websocket.Conn) {
+func sendRadioSongData(store database.Store, roomID string, song models.Song, client *wsocket.Client) {
 	// Load song with related data if not already loaded
-	var fullSong models.Song
-	if err := db.Preload("Artists").Preload("Units").Preload("Albums").Preload("Category").
-		First(&fullSong, song.SongID).Error; err != nil {
+	fullSong, err := store.GetSongByID(song.SongID)
+	if err != nil {
 		log.Printf("Error loading song data: %v", err)
 		return
 	}
 
-	// Get embed URL using existing utility function
-	embedURL := ""
-	if utils.IsYouTubeURL(fullSong.SourceURL) {
-		if url, err := utils.GetYouTubeEmbedURL(fullSong.SourceURL); err == nil {
-			embedURL = url
-		}
-	}
+	// How the song plays, from its media provider
+	media := songMedia(fullSong)
 
 	// Build artists array with color information
 	artists := make([]wsocket.ArtistData, 0, len(fullSong.Artists))
@@ -460,14 +590,16 @@ func sendRadioSongData(db *gorm.DB, roomID string, song models.Song, conn *webso
 	}
 
 	// Load existing votes for this song from users in the room
-	existingVotes := loadRadioRoomVotes(db, roomID, fullSong.SongID)
+	existingVotes := loadRadioRoomVotes(store, roomID, fullSong.SongID)
 
 	// Create song change message
 	songData := wsocket.SongChangeData{
 		SongID:            fullSong.SongID,
 		SongTitleOriginal: fullSong.NameOriginal,
 		SongTitleEnglish:  fullSong.NameEnglish,
-		EmbedURL:          embedURL,
+		EmbedURL:          media.EmbedURL,
+		Provider:          media.Provider,
+		Capabilities:      media.Capabilities,
 		ThumbnailURL:      fullSong.ThumbnailURL,
 		Artists:           artists,
 		Units:             units,
@@ -484,26 +616,20 @@ func sendRadioSongData(db *gorm.DB, roomID string, song models.Song, conn *webso
 		Timestamp: time.Now(),
 	}
 
-	conn.WriteJSON(message)
+	client.SendJSON(message)
 }
 
 // sendRadioSongDataToRoom broadcasts song data to all connections in the room
-func sendRadioSongDataToRoom(db *gorm.DB, roomID string, song models.Song) {
+func sendRadioSongDataToRoom(store database.Store, roomID string, song models.Song) {
 	// Load song with related data if not already loaded
-	var fullSong models.Song
-	if err := db.Preload("Artists").Preload("Units").Preload("Albums").Preload("Category").
-		First(&fullSong, song.SongID).Error; err != nil {
+	fullSong, err := store.GetSongByID(song.SongID)
+	if err != nil {
 		log.Printf("Error loading song data: %v", err)
 		return
 	}
 
-	// Get embed URL using existing utility function
-	embedURL := ""
-	if utils.IsYouTubeURL(fullSong.SourceURL) {
-		if url, err := utils.GetYouTubeEmbedURL(fullSong.SourceURL); err == nil {
-			embedURL = url
-		}
-	}
+	// How the song plays, from its media provider
+	media := songMedia(fullSong)
 
 	// Build artists array with color information
 	artists := make([]wsocket.ArtistData, 0, len(fullSong.Artists))
@@ -547,14 +673,16 @@ func sendRadioSongDataToRoom(db *gorm.DB, roomID string, song models.Song) {
 	}
 
 	// Load existing votes for this song from users in the room
-	existingVotes := loadRadioRoomVotes(db, roomID, fullSong.SongID)
+	existingVotes := loadRadioRoomVotes(store, roomID, fullSong.SongID)
 
 	// Create song change message
 	songData := wsocket.SongChangeData{
 		SongID:            fullSong.SongID,
 		SongTitleOriginal: fullSong.NameOriginal,
 		SongTitleEnglish:  fullSong.NameEnglish,
-		EmbedURL:          embedURL,
+		EmbedURL:          media.EmbedURL,
+		Provider:          media.Provider,
+		Capabilities:      media.Capabilities,
 		ThumbnailURL:      fullSong.ThumbnailURL,
 		Artists:           artists,
 		Units:             units,
@@ -577,29 +705,32 @@ func sendRadioSongDataToRoom(db *gorm.DB, roomID string, song models.Song) {
 // Helper functions
 
 // loadRadioRoomVotes loads all votes for a specific song from users currently in the room
-func loadRadioRoomVotes(db *gorm.DB, roomID string, songID uint) []wsocket.VoteUpdateData {
+func loadRadioRoomVotes(store database.Store, roomID string, songID uint) []wsocket.VoteUpdateData {
 	// Get all users in the room
 	room, exists := radioRoomManager.GetRoom(roomID)
 	if !exists {
 		return []wsocket.VoteUpdateData{}
 	}
 
-	room.Mutex.RLock()
-	userIDs := make([]string, 0, len(room.Clients))
+	users := room.Users()
+	userIDs := make([]uint, 0, len(users))
 	usernames := make(map[string]string) // map user_id to username
-	for userID, client := range room.Clients {
-		userIDs = append(userIDs, userID)
-		usernames[userID] = client.Username
+	for _, user := range users {
+		if id, err := strconv.ParseUint(user.ID, 10, 32); err == nil {
+			userIDs = append(userIDs, uint(id))
+		}
+		usernames[user.ID] = user.Username
 	}
-	room.Mutex.RUnlock()
 
 	if len(userIDs) == 0 {
 		return []wsocket.VoteUpdateData{}
 	}
 
 	// Load votes for this song from these users
-	var votes []models.Vote
-	db.Where("song_id = ? AND user_id IN ?", songID, userIDs).Find(&votes)
+	votes, err := store.GetVotes(database.VoteFilter{UserIDs: userIDs, SongIDs: []uint{songID}})
+	if err != nil {
+		log.Printf("Error loading votes for song %d: %v", songID, err)
+	}
 
 	// Convert to VoteUpdateData
 	voteData := make([]wsocket.VoteUpdateData, 0, len(votes))
@@ -616,17 +747,16 @@ func loadRadioRoomVotes(db *gorm.DB, roomID string, songID uint) []wsocket.VoteU
 }
 
 // updateRadioRoomActivity updates the last_active timestamp for a radio room
-func updateRadioRoomActivity(db *gorm.DB, roomID string) {
-	db.Model(&models.RadioRoom{}).
-		Where("room_id = ?", roomID).
-		Update("last_active", time.Now())
+func updateRadioRoomActivity(store database.Store, roomID string) {
+	if err := store.TouchRadioRoom(roomID); err != nil {
+		log.Printf("Error updating radio room activity: %v", err)
+	}
 }
 
 // checkRadioRoomExists checks if a radio room exists in the database and returns an error if not
-func checkRadioRoomExists(db *gorm.DB, roomID string) error {
-	var room models.RadioRoom
-	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+func checkRadioRoomExists(store database.Store, roomID string) error {
+	if _, err := store.GetRadioRoom(roomID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
 			return fmt.Errorf("room not found")
 		}
 		return fmt.Errorf("database error: %v", err)
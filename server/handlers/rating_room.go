@@ -3,17 +3,19 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/CptPie/SyncRate/database"
 	"github.com/CptPie/SyncRate/models"
-	"github.com/CptPie/SyncRate/server/utils"
 	wsocket "github.com/CptPie/SyncRate/server/websocket"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"gorm.io/gorm"
 )
 
 var (
@@ -44,7 +46,7 @@ func init() {
 }
 
 // StartDatabaseCleanup starts a background routine to clean up old rating rooms from the database
-func StartDatabaseCleanup(db *gorm.DB) {
+func StartDatabaseCleanup(store database.Store) {
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
@@ -52,29 +54,30 @@ func StartDatabaseCleanup(db *gorm.DB) {
 		for {
 			select {
 			case <-ticker.C:
-				cleanupOldRatingRooms(db, 24*time.Hour)
+				cleanupOldRatingRooms(store, 24*time.Hour)
+				cleanupStaleGuests(store)
 			}
 		}
 	}()
 }
 
 // cleanupOldRatingRooms removes rating rooms that haven't been active for the specified duration
-func cleanupOldRatingRooms(db *gorm.DB, inactivityThreshold time.Duration) {
+func cleanupOldRatingRooms(store database.Store, inactivityThreshold time.Duration) {
 	cutoffTime := time.Now().Add(-inactivityThreshold)
 
-	result := db.Where("last_active < ?", cutoffTime).Delete(&models.RatingRoom{})
-	if result.Error != nil {
-		log.Printf("Error cleaning up old rating rooms: %v", result.Error)
+	deleted, err := store.DeleteInactiveRatingRooms(cutoffTime)
+	if err != nil {
+		log.Printf("Error cleaning up old rating rooms: %v", err)
 		return
 	}
 
-	if result.RowsAffected > 0 {
-		log.Printf("Cleaned up %d inactive rating rooms from database (older than %v)", result.RowsAffected, inactivityThreshold)
+	if deleted > 0 {
+		log.Printf("Cleaned up %d inactive rating rooms from database (older than %v)", deleted, inactivityThreshold)
 	}
 }
 
 // GetCreateRatingRoom shows the room creation page
-func GetCreateRatingRoom(db *gorm.DB) gin.HandlerFunc {
+func GetCreateRatingRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated
 		if userID, exists := c.Get("user_id"); !exists || userID == nil {
@@ -82,20 +85,29 @@ func GetCreateRatingRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Guests need an account to host rooms
+		if isGuest(c) {
+			c.Redirect(http.StatusFound, "/register")
+			return
+		}
+
 		// Load categories for filter options
-		var categories []models.Category
-		db.Find(&categories)
+		categories, err := store.GetAllCategories()
+		if err != nil {
+			log.Printf("Error loading categories: %v", err)
+		}
 
 		templateData := GetUserContext(c)
 		templateData["title"] = "SyncRate | Create Rating Room"
 		templateData["categories"] = categories
+		templateData["songSelectors"] = songSelectors
 
 		c.HTML(http.StatusOK, "create-rating-room.html", templateData)
 	}
 }
 
 // PostCreateRatingRoom creates a new rating room
-func PostCreateRatingRoom(db *gorm.DB) gin.HandlerFunc {
+func PostCreateRatingRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated
 		userID, exists := c.Get("user_id")
@@ -103,13 +115,23 @@ func PostCreateRatingRoom(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 			return
 		}
+		if isGuest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Create an account to host rooms"})
+			return
+		}
 
 		// Parse request body for filters
 		var requestBody struct {
-			CategoryID       *uint `json:"category_id"`
-			CoversOnly       bool  `json:"covers_only"`
-			VideoSyncEnabled bool  `json:"video_sync_enabled"`
-			UnvotedSongsOnly bool  `json:"unvoted_songs_only"`
+			CategoryID        *uint  `json:"category_id"`
+			CoversOnly        bool   `json:"covers_only"`
+			VideoSyncEnabled  bool   `json:"video_sync_enabled"`
+			UnvotedSongsOnly  bool   `json:"unvoted_songs_only"`
+			Password          string `json:"password"`
+			InviteOnly        bool   `json:"invite_only"`
+			AllowGuests       bool   `json:"allow_guests"`
+			PersistGuestVotes bool   `json:"persist_guest_votes"`
+			SongSelection     string `json:"song_selection"`
+			RepeatWindow      int    `json:"repeat_window"`
 		}
 
 		// Bind JSON, but don't fail if body is empty (filters are optional)
@@ -117,12 +139,35 @@ func PostCreateRatingRoom(db *gorm.DB) gin.HandlerFunc {
 			log.Printf("Error parsing request body: %v", err)
 		}
 
-		log.Printf("Request body received: %+v", requestBody)
+		// Never log the password itself
+		log.Printf("Request body received: category=%v covers_only=%v unvoted_songs_only=%v password=%v invite_only=%v allow_guests=%v",
+			requestBody.CategoryID, requestBody.CoversOnly, requestBody.UnvotedSongsOnly, requestBody.Password != "", requestBody.InviteOnly, requestBody.AllowGuests)
 		log.Printf("Creating room with VideoSyncEnabled: %v", requestBody.VideoSyncEnabled)
 
+		// How the next song is picked
+		if requestBody.SongSelection == "" {
+			requestBody.SongSelection = models.SongSelectionRandom
+		}
+		if _, ok := songSelectorByName(requestBody.SongSelection); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown song selection"})
+			return
+		}
+		if requestBody.RepeatWindow < 0 || requestBody.RepeatWindow > database.RatingRoomHistory {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Repeat window must be between 0 and %d songs", database.RatingRoomHistory)})
+			return
+		}
+
 		// Generate unique room code
 		roomID := generateRoomCode()
 
+		// Optional room password, hashed like user passwords
+		passwordHash, err := hashRoomPassword(requestBody.Password)
+		if err != nil {
+			log.Printf("Error hashing room password: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+			return
+		}
+
 		// Create room in database
 		room := models.RatingRoom{
 			RoomID:          roomID,
@@ -131,11 +176,17 @@ func PostCreateRatingRoom(db *gorm.DB) gin.HandlerFunc {
 			CoversOnly:      requestBody.CoversOnly,
 			VideoSyncEnabled: &requestBody.VideoSyncEnabled,
 		UnvotedSongsOnly: &requestBody.UnvotedSongsOnly,
+			PasswordHash:     passwordHash,
+			InviteOnly:       requestBody.InviteOnly,
+			AllowGuests:       requestBody.AllowGuests,
+			PersistGuestVotes: requestBody.PersistGuestVotes,
+			SongSelection:     requestBody.SongSelection,
+			RepeatWindow:      requestBody.RepeatWindow,
 			CreatedAt:       time.Now(),
 			LastActive:      time.Now(),
 		}
 
-		if err := db.Create(&room).Error; err != nil {
+		if err := store.CreateRatingRoom(&room); err != nil {
 			log.Printf("Error creating room in database: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
 			return
@@ -159,21 +210,21 @@ func PostCreateRatingRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // GetRatingRoom shows the rating room interface
-func GetRatingRoom(db *gorm.DB) gin.HandlerFunc {
+func GetRatingRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roomID := c.Param("roomId")
 
 		// Check if user is authenticated
 		userID, exists := c.Get("user_id")
 		if !exists || userID == nil {
-			c.Redirect(http.StatusFound, "/login")
+			redirectToSignIn(c, store, models.RoomTypeRating, roomID)
 			return
 		}
 
 		// Check if room exists in database
-		var room models.RatingRoom
-		if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
+		room, err := store.GetRatingRoom(roomID)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
 				c.HTML(http.StatusNotFound, "error.html", gin.H{
 					"title": "SyncRate | Room Not Found",
 					"error": "Rating room not found",
@@ -187,9 +238,14 @@ func GetRatingRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Password-protected and invite-only rooms
+		if !guardRoomPage(c, store, models.RoomTypeRating, roomID, userID.(uint)) {
+			return
+		}
+
 		templateData := GetUserContext(c)
 		templateData["title"] = fmt.Sprintf("SyncRate | Rating Room %s", roomID)
-		templateData["room"] = room
+		templateData["room"] = *room
 		templateData["room_id"] = roomID
 
 		c.HTML(http.StatusOK, "rating-room.html", templateData)
@@ -197,7 +253,7 @@ func GetRatingRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // GetRatingRoomWS handles WebSocket connections for rating rooms
-func GetRatingRoomWS(db *gorm.DB) gin.HandlerFunc {
+func GetRatingRoomWS(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roomID := c.Param("roomId")
 
@@ -220,32 +276,38 @@ func GetRatingRoomWS(db *gorm.DB) gin.HandlerFunc {
 			log.Printf("WebSocket upgrade error: %v", err)
 			return
 		}
-		defer conn.Close()
 
-		// Join room
+		// Join room if the user may enter it
 		userIDStr := fmt.Sprintf("%d", userID.(uint))
-		if err := roomManager.JoinRoom(roomID, userIDStr, usernameStr, conn); err != nil {
+		err = checkRoomJoin(store, models.RoomTypeRating, roomID, userID.(uint), isGuest(c))
+		var client *wsocket.Client
+		if err == nil {
+			client, err = roomManager.JoinRoom(roomID, userIDStr, usernameStr, conn)
+		}
+		if err != nil {
 			log.Printf("Error joining room: %v", err)
 			conn.WriteJSON(map[string]interface{}{
 				"type":  "error",
 				"error": err.Error(),
 			})
+			conn.Close()
 			return
 		}
 
-		// Handle connection
-		handleRoomConnection(db, roomID, userIDStr, conn)
+		// Handle connection; from here on only the client writes to conn
+		// and its writer closes it
+		handleRoomConnection(store, roomID, userIDStr, client)
 
 		// Clean up when connection closes
-		roomManager.LeaveRoom(userIDStr)
+		roomManager.LeaveRoom(client.SessionID)
 	}
 }
 
 // handleRoomConnection manages the WebSocket connection for a room
-func handleRoomConnection(db *gorm.DB, roomID, userID string, conn *websocket.Conn) {
+func handleRoomConnection(store database.Store, roomID, userID string, client *wsocket.Client) {
 	// Check if room exists in database
-	if err := checkRoomExists(db, roomID); err != nil {
-		conn.WriteJSON(map[string]interface{}{
+	if err := checkRoomExists(store, roomID); err != nil {
+		client.SendJSON(map[string]interface{}{
 			"type":  "error",
 			"error": "This rating room no longer exists",
 		})
@@ -253,25 +315,25 @@ func handleRoomConnection(db *gorm.DB, roomID, userID string, conn *websocket.Co
 	}
 
 	// Send initial room state
-	sendRoomState(db, roomID, conn)
+	sendRoomState(store, roomID, client)
 
 	// Listen for messages
 	for {
 		var msg wsocket.WSMessage
-		if err := conn.ReadJSON(&msg); err != nil {
+		if err := client.Conn.ReadJSON(&msg); err != nil {
 			log.Printf("WebSocket read error: %v", err)
 			break
 		}
 
-		handleRoomMessage(db, roomID, userID, msg, conn)
+		handleRoomMessage(store, roomID, userID, msg, client)
 	}
 }
 
 // sendRoomState sends the current room state to a newly connected client
-func sendRoomState(db *gorm.DB, roomID string, conn *websocket.Conn) {
+func sendRoomState(store database.Store, roomID string, client *wsocket.Client) {
 	// Get room from database
-	var room models.RatingRoom
-	if err := db.Preload("CurrentSong").Where("room_id = ?", roomID).First(&room).Error; err != nil {
+	room, err := store.GetRatingRoom(roomID)
+	if err != nil {
 		return
 	}
 
@@ -289,22 +351,15 @@ func sendRoomState(db *gorm.DB, roomID string, conn *websocket.Conn) {
 		Data:      settingsData,
 		Timestamp: time.Now(),
 	}
-	conn.WriteJSON(settingsMessage)
+	client.SendJSON(settingsMessage)
 
 	// If there's a current song, send it
-	if room.CurrentSong != nil {
+	if room.CurrentSongID != nil {
 		// Load song with related data
-		var song models.Song
-		if err := db.Preload("Artists").Preload("Units").Preload("Albums").Preload("Category").
-			First(&song, room.CurrentSong.SongID).Error; err == nil {
-
-			// Get embed URL using existing utility function
-			embedURL := ""
-			if utils.IsYouTubeURL(song.SourceURL) {
-				if url, err := utils.GetYouTubeEmbedURL(song.SourceURL); err == nil {
-					embedURL = url
-				}
-			}
+		if song, err := store.GetSongByID(*room.CurrentSongID); err == nil {
+
+			// How the song plays, from its media provider
+			media := songMedia(song)
 
 			// Build artists array with color information
 			artists := make([]wsocket.ArtistData, 0, len(song.Artists))
@@ -348,14 +403,16 @@ func sendRoomState(db *gorm.DB, roomID string, conn *websocket.Conn) {
 			}
 
 			// Load existing votes for this song
-			existingVotes := loadExistingVotes(db, roomID, song.SongID)
+			existingVotes := loadExistingVotes(store, roomID, song.SongID)
 
 			// Send song change message
 			songData := wsocket.SongChangeData{
 				SongID:            song.SongID,
 				SongTitleOriginal: song.NameOriginal,
 				SongTitleEnglish:  song.NameEnglish,
-				EmbedURL:          embedURL,
+				EmbedURL:          media.EmbedURL,
+				Provider:          media.Provider,
+				Capabilities:      media.Capabilities,
 				ThumbnailURL:      song.ThumbnailURL,
 				Artists:           artists,
 				Units:             units,
@@ -372,38 +429,50 @@ func sendRoomState(db *gorm.DB, roomID string, conn *websocket.Conn) {
 				Timestamp: time.Now(),
 			}
 
-			conn.WriteJSON(message)
+			client.SendJSON(message)
 		}
 	}
 }
 
 // handleRoomMessage processes incoming WebSocket messages
-func handleRoomMessage(db *gorm.DB, roomID, userID string, msg wsocket.WSMessage, conn *websocket.Conn) {
+func handleRoomMessage(store database.Store, roomID, userID string, msg wsocket.WSMessage, client *wsocket.Client) {
 	// Check if room still exists in database
-	if err := checkRoomExists(db, roomID); err != nil {
+	if err := checkRoomExists(store, roomID); err != nil {
 		log.Printf("Room %s no longer exists: %v", roomID, err)
-		conn.WriteJSON(map[string]interface{}{
+		client.SendJSON(map[string]interface{}{
 			"type":  "error",
 			"error": "This rating room no longer exists. The page will reload.",
 		})
 		return
 	}
 
+	// Check the sender's role before acting on the message
+	if !authorizeMessage(roomManager, client, msg, ratingRoomPermissions) {
+		return
+	}
+
 	// Update last_active timestamp for any room activity
-	updateRoomActivity(db, roomID)
+	updateRoomActivity(store, roomID)
 
 	switch msg.Type {
 	case wsocket.MsgVideoSync:
 		// Broadcast video sync to all room members
+		recordVideoSync(roomManager, roomID, msg.Data)
 		roomManager.BroadcastToRoom(roomID, msg)
 
 	case wsocket.MsgVoteUpdate:
 		// Handle vote update (save to database and broadcast)
-		handleVoteUpdate(db, roomID, userID, msg.Data)
+		handleVoteUpdate(store, roomID, userID, msg.Data)
 
 	case wsocket.MsgNextSong:
 		// Handle next song request
-		handleNextSong(db, roomID, userID)
+		handleNextSong(store, roomID, userID)
+
+	case wsocket.MsgEndSession:
+		broadcastSessionSummary(store, roomID)
+
+	case wsocket.MsgSetRole, wsocket.MsgKickUser, wsocket.MsgBanUser, wsocket.MsgUnbanUser, wsocket.MsgTransferHost:
+		handleModeration(store, roomManager, models.RoomTypeRating, client, msg)
 
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
@@ -411,7 +480,7 @@ func handleRoomMessage(db *gorm.DB, roomID, userID string, msg wsocket.WSMessage
 }
 
 // handleVoteUpdate processes vote updates
-func handleVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMessage) {
+func handleVoteUpdate(store database.Store, roomID, userID string, data json.RawMessage) {
 	var voteData wsocket.VoteUpdateData
 	if err := json.Unmarshal(data, &voteData); err != nil {
 		log.Printf("Error unmarshaling vote data: %v", err)
@@ -419,8 +488,8 @@ func handleVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMessage)
 	}
 
 	// Get current song for the room
-	var room models.RatingRoom
-	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+	room, err := store.GetRatingRoom(roomID)
+	if err != nil {
 		return
 	}
 
@@ -442,11 +511,12 @@ func handleVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMessage)
 		Comment: voteData.Comment,
 	}
 
-	// Use GORM's upsert (create or update)
-	if err := db.Where("user_id = ? AND song_id = ?", userIDUint, *room.CurrentSongID).
-		Assign(vote).FirstOrCreate(&vote).Error; err != nil {
-		log.Printf("Error saving vote: %v", err)
-		return
+	// Guest ratings are only shown in the room unless the host keeps them
+	if room.PersistGuestVotes || !isGuestUser(store, userIDUint) {
+		if err := store.UpsertVote(&vote); err != nil {
+			log.Printf("Error saving vote: %v", err)
+			return
+		}
 	}
 
 	// Broadcast vote update to room
@@ -460,55 +530,93 @@ func handleVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMessage)
 }
 
 // handleNextSong handles requests to move to the next song
-func handleNextSong(db *gorm.DB, roomID, userID string) {
-	// For now, allow any user to advance (could add creator-only restriction later)
-	nextSong := findNextUnratedSong(db, roomID)
+func handleNextSong(store database.Store, roomID, userID string) {
+	nextSong := findNextUnratedSong(store, roomID)
 	if nextSong != nil {
-		updateRoomCurrentSong(db, roomID, nextSong.SongID)
-		broadcastSongChange(db, roomID, *nextSong)
+		updateRoomCurrentSong(store, roomID, nextSong.SongID)
+		broadcastSongChange(store, roomID, *nextSong)
 	} else {
-		// No more unrated songs - could broadcast "completed" message
+		// No more unrated songs, so the session is over
 		log.Printf("No more unrated songs for room %s", roomID)
+		broadcastSessionSummary(store, roomID)
 	}
 }
 
-// findNextUnratedSong finds the next song that hasn't been rated by at least one user in the room
-func findNextUnratedSong(db *gorm.DB, roomID string) *models.Song {
-	// Get all users in the room
+// broadcastSessionSummary ranks how compatible the members of the room are,
+// pair by pair, over every song both of them rated. Spectators don't rate,
+// so they are left out.
+func broadcastSessionSummary(store database.Store, roomID string) {
 	room, exists := roomManager.GetRoom(roomID)
 	if !exists {
-		return nil
+		return
+	}
+
+	usernames := make(map[uint]string)
+	userIDs := make([]uint, 0)
+	for _, user := range room.Users() {
+		if !canParticipate(user) {
+			continue
+		}
+		if id, err := strconv.ParseUint(user.ID, 10, 32); err == nil {
+			userIDs = append(userIDs, uint(id))
+			usernames[uint(id)] = user.Username
+		}
+	}
+
+	pairs, err := store.GetCompatibility(userIDs)
+	if err != nil {
+		log.Printf("Error comparing members of room %s: %v", roomID, err)
+		return
+	}
+
+	summary := wsocket.SessionSummaryData{Pairs: make([]wsocket.CompatibilityData, 0, len(pairs))}
+	for _, pair := range pairs {
+		summary.Pairs = append(summary.Pairs, wsocket.CompatibilityData{
+			UserA:                  strconv.FormatUint(uint64(pair.UserA), 10),
+			UsernameA:              usernames[pair.UserA],
+			UserB:                  strconv.FormatUint(uint64(pair.UserB), 10),
+			UsernameB:              usernames[pair.UserB],
+			Overlap:                pair.Overlap,
+			Correlation:            pair.Correlation,
+			MeanAbsoluteDifference: pair.MeanAbsoluteDifference,
+		})
 	}
 
-	room.Mutex.RLock()
-	userIDs := make([]string, 0, len(room.Clients))
-	for userID := range room.Clients {
-		userIDs = append(userIDs, userID)
+	data, _ := json.Marshal(summary)
+	roomManager.BroadcastToRoom(roomID, wsocket.WSMessage{
+		Type:      wsocket.MsgSessionSummary,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+}
+
+// findNextUnratedSong finds the next song that hasn't been rated by at least one user in the room.
+// Spectators don't rate, so they are left out.
+func findNextUnratedSong(store database.Store, roomID string) *models.Song {
+	// Get all users in the room
+	room, exists := roomManager.GetRoom(roomID)
+	if !exists {
+		return nil
 	}
-	room.Mutex.RUnlock()
 
+	userIDs := roomUserIDs(room, true)
 	if len(userIDs) == 0 {
 		return nil
 	}
 
 	// Load room filters from database
-	var dbRoom models.RatingRoom
-	if err := db.Where("room_id = ?", roomID).First(&dbRoom).Error; err != nil {
+	dbRoom, err := store.GetRatingRoom(roomID)
+	if err != nil {
 		log.Printf("Error loading room filters: %v", err)
 		return nil
 	}
 
-	// Build base query with filters
-	baseQuery := db.Preload("Artists").Preload("Units").Preload("Albums").Preload("Category")
-
-	// Apply category filter if set
-	if dbRoom.CategoryID != nil {
-		baseQuery = baseQuery.Where("category_id = ?", *dbRoom.CategoryID)
-	}
+	filter := database.SongFilter{CategoryID: dbRoom.CategoryID}
 
 	// Apply covers filter if set
 	if dbRoom.CoversOnly {
-		baseQuery = baseQuery.Where("is_cover = ?", true)
+		coversOnly := true
+		filter.IsCover = &coversOnly
 	}
 
 	// Check if we should only show unvoted songs
@@ -516,74 +624,85 @@ func findNextUnratedSong(db *gorm.DB, roomID string) *models.Song {
 	if dbRoom.UnvotedSongsOnly != nil {
 		unvotedOnly = *dbRoom.UnvotedSongsOnly
 	}
-
-	var song models.Song
-	var err error
-
 	if unvotedOnly {
-		// Find songs that haven't been rated by at least one user in the room
-		err = baseQuery.
-			Where("song_id NOT IN (?)",
-				db.Table("votes").
-					Select("DISTINCT song_id").
-					Where("user_id IN ?", userIDs).
-					Group("song_id").
-					Having("COUNT(DISTINCT user_id) = ?", len(userIDs)),
-			).
-			Order("RANDOM()").
-			First(&song).Error
+		// Skip songs that every user in the room has already rated
+		filter.NotRatedByAll = userIDs
+	}
 
-		if err != nil {
-			// If no completely unrated songs, find songs rated by fewer than all users
-			err = baseQuery.
-				Where("song_id NOT IN (?)",
-					db.Table("votes").
-						Select("song_id").
-						Where("user_id IN ?", userIDs).
-						Group("song_id").
-						Having("COUNT(*) >= ?", len(userIDs)),
-				).
-				Order("RANDOM()").
-				First(&song).Error
-
-			if err != nil {
-				// All songs have been rated by all users
-				return nil
+	selector, ok := songSelectorByName(dbRoom.SongSelection)
+	if !ok {
+		selector = randomSelector{}
+	}
+	pick := SongPick{Filter: filter, UserIDs: userIDs, Recent: recentRoomSongs(store, dbRoom.RecentSongIDs)}
+
+	// Keep the last songs and their artists out while other songs are left
+	if window := min(dbRoom.RepeatWindow, len(pick.Recent)); window > 0 {
+		windowed := pick
+		windowed.Filter.ExcludeSongIDs = slices.Clone(filter.ExcludeSongIDs)
+		windowed.Filter.ExcludeArtistIDs = slices.Clone(filter.ExcludeArtistIDs)
+		for _, song := range pick.Recent[:window] {
+			windowed.Filter.ExcludeSongIDs = append(windowed.Filter.ExcludeSongIDs, song.SongID)
+			for _, artist := range song.Artists {
+				windowed.Filter.ExcludeArtistIDs = append(windowed.Filter.ExcludeArtistIDs, artist.ArtistID)
 			}
 		}
-	} else {
-		// Allow any song (including previously voted ones)
-		err = baseQuery.
-			Order("RANDOM()").
-			First(&song).Error
-
+		song, err := selector.Next(store, windowed)
 		if err != nil {
+			log.Printf("Error finding next song: %v", err)
 			return nil
 		}
+		if song != nil {
+			return song
+		}
+	}
+
+	song, err := selector.Next(store, pick)
+	if err != nil {
+		log.Printf("Error finding next song: %v", err)
+		return nil
+	}
+	// nil when all songs have been rated by all users
+	return song
+}
+
+// recentRoomSongs loads a room's recent songs with their relations, newest
+// first. Songs deleted since are left out.
+func recentRoomSongs(store database.Store, songIDs []uint) []models.Song {
+	if len(songIDs) == 0 {
+		return nil
+	}
+	songs, err := store.RandomSongs(database.SongFilter{SongIDs: songIDs}, -1)
+	if err != nil {
+		log.Printf("Error loading recent room songs: %v", err)
+		return nil
+	}
+	songsByID := make(map[uint]models.Song, len(songs))
+	for _, song := range songs {
+		songsByID[song.SongID] = song
 	}
 
-	return &song
+	recent := make([]models.Song, 0, len(songIDs))
+	for _, id := range songIDs {
+		if song, ok := songsByID[id]; ok {
+			recent = append(recent, song)
+		}
+	}
+	return recent
 }
 
 // updateRoomCurrentSong updates the current song in the database
-func updateRoomCurrentSong(db *gorm.DB, roomID string, songID uint) error {
-	return db.Model(&models.RatingRoom{}).
-		Where("room_id = ?", roomID).
-		Updates(map[string]interface{}{
-			"current_song_id": songID,
-			"last_active":     time.Now(),
-		}).Error
+func updateRoomCurrentSong(store database.Store, roomID string, songID uint) error {
+	if err := store.SetRatingRoomCurrentSong(roomID, songID); err != nil {
+		return err
+	}
+	roomManager.SetCurrentSong(roomID, songID)
+	return nil
 }
 
 // broadcastSongChange sends a song change message to all users in the room
-func broadcastSongChange(db *gorm.DB, roomID string, song models.Song) {
-	// Get embed URL using existing utility function
-	embedURL := ""
-	if utils.IsYouTubeURL(song.SourceURL) {
-		if url, err := utils.GetYouTubeEmbedURL(song.SourceURL); err == nil {
-			embedURL = url
-		}
-	}
+func broadcastSongChange(store database.Store, roomID string, song models.Song) {
+	// How the song plays, from its media provider
+	media := songMedia(&song)
 
 	// Build artists array with color information
 	artists := make([]wsocket.ArtistData, 0, len(song.Artists))
@@ -627,14 +746,16 @@ func broadcastSongChange(db *gorm.DB, roomID string, song models.Song) {
 	}
 
 	// Load existing votes for this song
-	existingVotes := loadExistingVotes(db, roomID, song.SongID)
+	existingVotes := loadExistingVotes(store, roomID, song.SongID)
 
 	// Create song change message
 	songData := wsocket.SongChangeData{
 		SongID:            song.SongID,
 		SongTitleOriginal: song.NameOriginal,
 		SongTitleEnglish:  song.NameEnglish,
-		EmbedURL:          embedURL,
+		EmbedURL:          media.EmbedURL,
+		Provider:          media.Provider,
+		Capabilities:      media.Capabilities,
 		ThumbnailURL:      song.ThumbnailURL,
 		Artists:           artists,
 		Units:             units,
@@ -657,29 +778,32 @@ func broadcastSongChange(db *gorm.DB, roomID string, song models.Song) {
 // Helper functions
 
 // loadExistingVotes loads all votes for a specific song from users currently in the room
-func loadExistingVotes(db *gorm.DB, roomID string, songID uint) []wsocket.VoteUpdateData {
+func loadExistingVotes(store database.Store, roomID string, songID uint) []wsocket.VoteUpdateData {
 	// Get all users in the room
 	room, exists := roomManager.GetRoom(roomID)
 	if !exists {
 		return []wsocket.VoteUpdateData{}
 	}
 
-	room.Mutex.RLock()
-	userIDs := make([]string, 0, len(room.Clients))
+	users := room.Users()
+	userIDs := make([]uint, 0, len(users))
 	usernames := make(map[string]string) // map user_id to username
-	for userID, client := range room.Clients {
-		userIDs = append(userIDs, userID)
-		usernames[userID] = client.Username
+	for _, user := range users {
+		if id, err := strconv.ParseUint(user.ID, 10, 32); err == nil {
+			userIDs = append(userIDs, uint(id))
+		}
+		usernames[user.ID] = user.Username
 	}
-	room.Mutex.RUnlock()
 
 	if len(userIDs) == 0 {
 		return []wsocket.VoteUpdateData{}
 	}
 
 	// Load votes for this song from these users
-	var votes []models.Vote
-	db.Where("song_id = ? AND user_id IN ?", songID, userIDs).Find(&votes)
+	votes, err := store.GetVotes(database.VoteFilter{UserIDs: userIDs, SongIDs: []uint{songID}})
+	if err != nil {
+		log.Printf("Error loading votes for song %d: %v", songID, err)
+	}
 
 	// Convert to VoteUpdateData
 	voteData := make([]wsocket.VoteUpdateData, 0, len(votes))
@@ -696,17 +820,16 @@ func loadExistingVotes(db *gorm.DB, roomID string, songID uint) []wsocket.VoteUp
 }
 
 // updateRoomActivity updates the last_active timestamp for a room
-func updateRoomActivity(db *gorm.DB, roomID string) {
-	db.Model(&models.RatingRoom{}).
-		Where("room_id = ?", roomID).
-		Update("last_active", time.Now())
+func updateRoomActivity(store database.Store, roomID string) {
+	if err := store.TouchRatingRoom(roomID); err != nil {
+		log.Printf("Error updating room activity: %v", err)
+	}
 }
 
 // checkRoomExists checks if a room exists in the database and returns an error if not
-func checkRoomExists(db *gorm.DB, roomID string) error {
-	var room models.RatingRoom
-	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+func checkRoomExists(store database.Store, roomID string) error {
+	if _, err := store.GetRatingRoom(roomID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
 			return fmt.Errorf("room not found")
 		}
 		return fmt.Errorf("database error: %v", err)
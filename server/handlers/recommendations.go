@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRecommendationRefresh is how often song similarities are
+// recomputed unless RECOMMENDATION_REFRESH_MINUTES says otherwise
+const DefaultRecommendationRefresh = time.Hour
+
+const (
+	// recommendationLimit is how many songs the recommendations page and
+	// API list
+	recommendationLimit = 50
+	// recommendedPool is how many of the best scored songs a room picks
+	// its next song from, so rooms with the same members vary
+	recommendedPool = 5
+	// recommendedBatch is how many scored songs are checked against the
+	// room filters at once
+	recommendedBatch = 50
+)
+
+// StartRecommendationRefresh starts a background routine that recomputes
+// the song similarities right away and then every interval
+func StartRecommendationRefresh(store database.Store, interval time.Duration) {
+	go func() {
+		refreshRecommendations(store)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				refreshRecommendations(store)
+			}
+		}
+	}()
+}
+
+// refreshRecommendations recomputes the song similarities from all votes
+func refreshRecommendations(store database.Store) {
+	started := time.Now()
+	votes, err := store.GetVotes(database.VoteFilter{})
+	if err != nil {
+		log.Printf("Error loading votes for recommendations: %v", err)
+		return
+	}
+
+	similarities := database.ComputeSongSimilarities(votes)
+	if err := store.ReplaceSongSimilarities(similarities); err != nil {
+		log.Printf("Error saving song similarities: %v", err)
+		return
+	}
+	log.Printf("Refreshed recommendations: %d song similarities from %d votes in %v",
+		len(similarities), len(votes), time.Since(started).Round(time.Millisecond))
+}
+
+// expectedRatings returns, per user, the rating each of them gave or is
+// predicted to give every song the recommender knows something about
+func expectedRatings(store database.Store, userIDs []uint) (map[uint]map[uint]float64, error) {
+	votes, err := store.GetVotes(database.VoteFilter{UserIDs: userIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[uint][]models.Vote)
+	rated := make(map[uint]bool)
+	for _, vote := range votes {
+		byUser[vote.UserID] = append(byUser[vote.UserID], vote)
+		rated[vote.SongID] = true
+	}
+	songIDs := make([]uint, 0, len(rated))
+	for songID := range rated {
+		songIDs = append(songIDs, songID)
+	}
+	neighbors, err := store.GetSongNeighbors(songIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[uint]map[uint]float64, len(userIDs))
+	for _, userID := range userIDs {
+		ratings := make(map[uint]float64)
+		for songID, prediction := range database.PredictRatings(byUser[userID], neighbors) {
+			ratings[songID] = prediction.Rating
+		}
+		for _, vote := range byUser[userID] {
+			ratings[vote.SongID] = float64(vote.Rating)
+		}
+		expected[userID] = ratings
+	}
+	return expected, nil
+}
+
+// groupSongScores scores songs for a room's members: the mean of their
+// expected ratings for SongSelectionRecommended, their spread for
+// SongSelectionDivisive. Songs are ordered best score first.
+func groupSongScores(expected map[uint]map[uint]float64, mode string) ([]uint, map[uint]float64) {
+	values := make(map[uint][]float64)
+	for _, ratings := range expected {
+		for songID, rating := range ratings {
+			values[songID] = append(values[songID], rating)
+		}
+	}
+
+	scores := make(map[uint]float64)
+	for songID, ratings := range values {
+		mean := 0.0
+		for _, rating := range ratings {
+			mean += rating
+		}
+		mean /= float64(len(ratings))
+
+		if mode != models.SongSelectionDivisive {
+			scores[songID] = mean
+			continue
+		}
+		// It takes two to disagree
+		if len(ratings) < 2 {
+			continue
+		}
+		variance := 0.0
+		for _, rating := range ratings {
+			variance += (rating - mean) * (rating - mean)
+		}
+		scores[songID] = math.Sqrt(variance / float64(len(ratings)))
+	}
+
+	songIDs := make([]uint, 0, len(scores))
+	for songID := range scores {
+		songIDs = append(songIDs, songID)
+	}
+	sort.Slice(songIDs, func(i, j int) bool {
+		if scores[songIDs[i]] != scores[songIDs[j]] {
+			return scores[songIDs[i]] > scores[songIDs[j]]
+		}
+		return songIDs[i] < songIDs[j]
+	})
+	return songIDs, scores
+}
+
+// pickRecommendedSong picks the next song of a room in a recommended
+// selection mode: one of the best scored songs for the members that pass
+// the room filter. It returns nil when the recommender knows no such song,
+// e.g. before the members rated anything.
+func pickRecommendedSong(store database.Store, userIDs []uint, filter database.SongFilter, mode string) *models.Song {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	expected, err := expectedRatings(store, userIDs)
+	if err != nil {
+		log.Printf("Error predicting ratings: %v", err)
+		return nil
+	}
+	songIDs, scores := groupSongScores(expected, mode)
+
+	for start := 0; start < len(songIDs); start += recommendedBatch {
+		filter.SongIDs = songIDs[start:min(start+recommendedBatch, len(songIDs))]
+		songs, err := store.RandomSongs(filter, -1)
+		if err != nil {
+			log.Printf("Error finding recommended song: %v", err)
+			return nil
+		}
+		if len(songs) == 0 {
+			continue
+		}
+
+		sort.Slice(songs, func(i, j int) bool {
+			if scores[songs[i].SongID] != scores[songs[j].SongID] {
+				return scores[songs[i].SongID] > scores[songs[j].SongID]
+			}
+			return songs[i].SongID < songs[j].SongID
+		})
+		song := songs[rand.Intn(min(len(songs), recommendedPool))]
+		return &song
+	}
+	return nil
+}
+
+// roomUserIDs returns the IDs of the users in a room, leaving out
+// spectators when participantsOnly is set
+func roomUserIDs(room *wsocket.Room, participantsOnly bool) []uint {
+	users := room.Users()
+	userIDs := make([]uint, 0, len(users))
+	for _, user := range users {
+		if participantsOnly && !canParticipate(user) {
+			continue
+		}
+		if id, err := strconv.ParseUint(user.ID, 10, 32); err == nil {
+			userIDs = append(userIDs, uint(id))
+		}
+	}
+	return userIDs
+}
+
+// Recommendation is a song with the rating a user is predicted to give it
+type Recommendation struct {
+	database.Prediction
+	Song models.Song `json:"song"`
+}
+
+// recommendSongs lists the songs a user has not rated with the best
+// predicted ratings first
+func recommendSongs(store database.Store, userID uint, limit int) ([]Recommendation, error) {
+	votes, err := store.GetVotesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	songIDs := make([]uint, len(votes))
+	for i, vote := range votes {
+		songIDs[i] = vote.SongID
+	}
+	neighbors, err := store.GetSongNeighbors(songIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	predictions := make([]database.Prediction, 0)
+	for _, prediction := range database.PredictRatings(votes, neighbors) {
+		predictions = append(predictions, prediction)
+	}
+	sort.Slice(predictions, func(i, j int) bool {
+		if predictions[i].Rating != predictions[j].Rating {
+			return predictions[i].Rating > predictions[j].Rating
+		}
+		if predictions[i].Neighbors != predictions[j].Neighbors {
+			return predictions[i].Neighbors > predictions[j].Neighbors
+		}
+		return predictions[i].SongID < predictions[j].SongID
+	})
+	predictions = predictions[:min(len(predictions), limit)]
+
+	predictedIDs := make([]uint, len(predictions))
+	for i, prediction := range predictions {
+		predictedIDs[i] = prediction.SongID
+	}
+	songs, err := store.GetSongsByIDs(predictedIDs)
+	if err != nil {
+		return nil, err
+	}
+	songsByID := make(map[uint]models.Song, len(songs))
+	for _, song := range songs {
+		songsByID[song.SongID] = song
+	}
+
+	recommendations := make([]Recommendation, 0, len(predictions))
+	for _, prediction := range predictions {
+		if song, ok := songsByID[prediction.SongID]; ok {
+			recommendations = append(recommendations, Recommendation{Prediction: prediction, Song: song})
+		}
+	}
+	return recommendations, nil
+}
+
+// GetRecommendations shows the songs the logged in user will probably like
+func GetRecommendations(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists || userID == nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		recommendations, err := recommendSongs(store, userID.(uint), recommendationLimit)
+		if err != nil {
+			log.Printf("GetRecommendations: %v", err)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Failed to load your recommendations",
+			})
+			return
+		}
+
+		templateData := GetUserContext(c)
+		templateData["title"] = "SyncRate | Recommendations"
+		templateData["recommendations"] = recommendations
+		c.HTML(http.StatusOK, "recommendations.html", templateData)
+	}
+}
+
+// GetAPIRecommendations lists the songs the authenticated user has not
+// rated with the best predicted ratings first. limit caps the list.
+func GetAPIRecommendations(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := recommendationLimit
+		if value := c.Query("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > database.MaxPageLimit {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+			limit = n
+		}
+
+		recommendations, err := recommendSongs(store, c.GetUint("user_id"), limit)
+		if err != nil {
+			log.Printf("GetAPIRecommendations: %v", err)
+			c.JSON(storeErrorStatus(err), gin.H{"error": "Failed to fetch recommendations"})
+			return
+		}
+		c.JSON(http.StatusOK, recommendations)
+	}
+}
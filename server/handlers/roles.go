@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-gonic/gin"
+)
+
+// SetBootstrapAdmin makes an existing account admin. It is how a site gets
+// its first admin back after losing it. Registering with the name does not
+// make an account admin, or anyone could claim it before its owner.
+func SetBootstrapAdmin(store database.Store, username string) error {
+	user, err := store.GetUserByUsername(username)
+	if errors.Is(err, database.ErrNotFound) {
+		log.Printf("SetBootstrapAdmin: no account named %s; register it and restart", username)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Role == models.RoleAdmin {
+		return nil
+	}
+	if err := store.SetUserRole(user.UserID, models.RoleAdmin); err != nil {
+		return fmt.Errorf("failed to make %s admin: %w", username, err)
+	}
+	log.Printf("SetBootstrapAdmin: %s is now admin", username)
+	return nil
+}
+
+// claimFirstAdmin makes a newly registered account admin while the site has
+// no admin
+func claimFirstAdmin(store database.Store, user *models.User) {
+	claimed, err := store.ClaimFirstAdmin(user.UserID)
+	if err != nil {
+		log.Printf("claimFirstAdmin: %v", err)
+		return
+	}
+	if claimed {
+		user.Role = models.RoleAdmin
+		log.Printf("claimFirstAdmin: %s is the first admin", user.Username)
+	}
+}
+
+// renderAdminUsers shows the role management page with an optional error
+func renderAdminUsers(c *gin.Context, store database.Store, status int, message string) {
+	templateData := GetUserContext(c)
+	templateData["title"] = "SyncRate | Users"
+	templateData["roles"] = models.Roles
+	if message != "" {
+		templateData["error"] = message
+	}
+
+	users, err := store.GetAllUsers()
+	if err != nil {
+		log.Printf("renderAdminUsers: %v", err)
+		templateData["error"] = "Failed to load users"
+	}
+	// Guests come and go; they keep the member role
+	accounts := make([]models.User, 0, len(users))
+	for _, user := range users {
+		if !user.IsGuest {
+			accounts = append(accounts, user)
+		}
+	}
+	templateData["users"] = accounts
+	c.HTML(status, "admin-users.html", templateData)
+}
+
+// GetAdminUsers lists the accounts and their roles
+func GetAdminUsers(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderAdminUsers(c, store, http.StatusOK, "")
+	}
+}
+
+// PostAdminUserRole changes the role of an account
+func PostAdminUserRole(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			renderAdminUsers(c, store, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		user, err := store.GetUserByID(uint(id))
+		if err != nil {
+			renderAdminUsers(c, store, storeErrorStatus(err), "User not found")
+			return
+		}
+		role := c.PostForm("role")
+		if err := store.SetUserRole(user.UserID, role); err != nil {
+			log.Printf("PostAdminUserRole: %v", err)
+			message := "Failed to change the role"
+			if errors.Is(err, database.ErrValidation) {
+				message = err.Error()
+			}
+			renderAdminUsers(c, store, storeErrorStatus(err), message)
+			return
+		}
+		recordAudit(c, store, newAuditEvent(c, models.AuditUpdate, auditUser, user.UserID,
+			gin.H{"Username": user.Username, "Role": user.Role}, gin.H{"Username": user.Username, "Role": role}))
+		c.Redirect(http.StatusFound, "/admin/users")
+	}
+}
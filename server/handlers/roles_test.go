@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+)
+
+func createTestUser(t *testing.T, store database.Store, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Role: models.RoleMember}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+func TestSetBootstrapAdminOnlyPromotesExistingAccounts(t *testing.T) {
+	store := memory.New()
+	createTestUser(t, store, "first")
+	claimFirstAdmin(store, createTestUser(t, store, "first-admin"))
+
+	if err := SetBootstrapAdmin(store, "owner"); err != nil {
+		t.Fatalf("SetBootstrapAdmin: %v", err)
+	}
+	// Whoever registers the name later is a member like everyone else
+	owner := createTestUser(t, store, "owner")
+	claimFirstAdmin(store, owner)
+	if owner.Role != models.RoleMember {
+		t.Fatalf("owner registered as %s; want member", owner.Role)
+	}
+
+	if err := SetBootstrapAdmin(store, "owner"); err != nil {
+		t.Fatalf("SetBootstrapAdmin: %v", err)
+	}
+	promoted, _ := store.GetUserByUsername("owner")
+	if promoted.Role != models.RoleAdmin {
+		t.Errorf("owner is %s after SetBootstrapAdmin; want admin", promoted.Role)
+	}
+}
+
+func TestClaimFirstAdminOnce(t *testing.T) {
+	store := memory.New()
+	users := make([]*models.User, 20)
+	for i := range users {
+		users[i] = createTestUser(t, store, fmt.Sprintf("user%d", i))
+	}
+
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func(user *models.User) {
+			defer wg.Done()
+			claimFirstAdmin(store, user)
+		}(user)
+	}
+	wg.Wait()
+
+	admins, err := store.CountUsersByRole(models.RoleAdmin)
+	if err != nil || admins != 1 {
+		t.Fatalf("admins = %d, %v; want one", admins, err)
+	}
+	claimed := 0
+	for _, user := range users {
+		if user.Role == models.RoleAdmin {
+			claimed++
+		}
+	}
+	if claimed != 1 {
+		t.Errorf("%d users were told they are admin; want one", claimed)
+	}
+
+	// Guests never become admin
+	store = memory.New()
+	guest := &models.User{Username: "guest-1", IsGuest: true}
+	if err := store.CreateUser(guest); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if ok, err := store.ClaimFirstAdmin(guest.UserID); ok || err != nil {
+		t.Errorf("guest claim = %v, %v; want false", ok, err)
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultInviteLifetime = 24 * time.Hour
+	maxInviteLifetime     = 7 * 24 * time.Hour
+)
+
+var (
+	errRoomPasswordRequired = errors.New("This room is password protected")
+	errRoomInviteOnly       = errors.New("This room is invite-only. Ask the host for an invite link.")
+	errInvalidInvite        = errors.New("This invite link is invalid or has expired")
+	errRoomNoGuests         = errors.New("This room does not allow guests. Log in or register to join.")
+)
+
+// inviteSecret signs invite links so they cannot be forged or extended
+var inviteSecret = newInviteSecret()
+
+func newInviteSecret() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// SetInviteSecret sets the key invite links are signed with. Instances that
+// serve the same rooms need the same key. Without one a random key is used,
+// and invite links stop working when the server restarts.
+func SetInviteSecret(secret []byte) {
+	inviteSecret = secret
+}
+
+// roomAccess is what the access checks need to know about a room
+type roomAccess struct {
+	roomType     string
+	roomID       string
+	creatorID    uint
+	passwordHash string
+	inviteOnly   bool
+	allowGuests  bool
+}
+
+// roomPath is the page of a room, e.g. /rating-room/ABC123
+func (a *roomAccess) roomPath() string {
+	return fmt.Sprintf("/%s-room/%s", a.roomType, a.roomID)
+}
+
+func loadRoomAccess(store database.Store, roomType, roomID string) (*roomAccess, error) {
+	access := &roomAccess{roomType: roomType, roomID: roomID}
+
+	switch roomType {
+	case models.RoomTypeRating:
+		room, err := store.GetRatingRoom(roomID)
+		if err != nil {
+			return nil, err
+		}
+		access.creatorID, access.passwordHash, access.inviteOnly = room.CreatorID, room.PasswordHash, room.InviteOnly
+		access.allowGuests = room.AllowGuests
+	case models.RoomTypeRadio:
+		room, err := store.GetRadioRoom(roomID)
+		if err != nil {
+			return nil, err
+		}
+		access.creatorID, access.passwordHash, access.inviteOnly = room.CreatorID, room.PasswordHash, room.InviteOnly
+		access.allowGuests = room.AllowGuests
+	case models.RoomTypeTournament:
+		room, err := store.GetTournamentRoom(roomID)
+		if err != nil {
+			return nil, err
+		}
+		access.creatorID, access.passwordHash, access.inviteOnly = room.CreatorID, room.PasswordHash, room.InviteOnly
+		access.allowGuests = room.AllowGuests
+	default:
+		return nil, fmt.Errorf("unknown room type %q", roomType)
+	}
+	return access, nil
+}
+
+// roomManagerFor returns the room manager serving a kind of room
+func roomManagerFor(roomType string) *wsocket.RoomManager {
+	switch roomType {
+	case models.RoomTypeRadio:
+		return radioRoomManager
+	case models.RoomTypeTournament:
+		return tournamentRoomManager
+	}
+	return roomManager
+}
+
+// checkRoomAccess decides whether a user may enter a room. Guests need a
+// room that allows them. The creator and users on the allow-list always may;
+// everyone else only if the room is neither password protected nor
+// invite-only.
+func checkRoomAccess(store database.Store, access *roomAccess, userID uint, guest bool) error {
+	if guest && !access.allowGuests {
+		return errRoomNoGuests
+	}
+	if access.creatorID == userID || (access.passwordHash == "" && !access.inviteOnly) {
+		return nil
+	}
+
+	allowed, err := store.IsRoomUserAllowed(access.roomType, access.roomID, userID)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		return nil
+	}
+	if access.inviteOnly {
+		return errRoomInviteOnly
+	}
+	return errRoomPasswordRequired
+}
+
+// checkRoomJoin is checkRoomAccess for WebSocket connections, which are
+// opened before JoinRoom
+func checkRoomJoin(store database.Store, roomType, roomID string, userID uint, guest bool) error {
+	access, err := loadRoomAccess(store, roomType, roomID)
+	if err != nil {
+		return errors.New("Room not found")
+	}
+	if err := checkRoomAccess(store, access, userID, guest); err != nil {
+		if errors.Is(err, errRoomPasswordRequired) || errors.Is(err, errRoomInviteOnly) || errors.Is(err, errRoomNoGuests) {
+			return err
+		}
+		log.Printf("checkRoomJoin: %v", err)
+		return errors.New("Failed to check room access")
+	}
+	return nil
+}
+
+// guardRoomPage redeems an invite in the URL and checks access to a room
+// page. When access is denied it renders the password form or an error and
+// returns false.
+func guardRoomPage(c *gin.Context, store database.Store, roomType, roomID string, userID uint) bool {
+	access, err := loadRoomAccess(store, roomType, roomID)
+	if err != nil {
+		// The page handler reports missing rooms
+		return true
+	}
+
+	if token := c.Query("invite"); token != "" {
+		if err := verifyInvite(token, roomType, roomID); err != nil {
+			c.HTML(http.StatusForbidden, "error.html", gin.H{
+				"title": "SyncRate | Invalid Invite",
+				"error": err.Error(),
+			})
+			return false
+		}
+		if err := store.AllowRoomUser(roomType, roomID, userID); err != nil {
+			log.Printf("guardRoomPage: %v", err)
+			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+				"title": "SyncRate | Error",
+				"error": "Failed to redeem invite",
+			})
+			return false
+		}
+		// Drop the token from the address bar
+		c.Redirect(http.StatusFound, access.roomPath())
+		return false
+	}
+
+	switch err := checkRoomAccess(store, access, userID, isGuest(c)); {
+	case err == nil:
+		return true
+	case errors.Is(err, errRoomPasswordRequired):
+		renderRoomLocked(c, access, "")
+	case errors.Is(err, errRoomInviteOnly):
+		c.HTML(http.StatusForbidden, "error.html", gin.H{
+			"title": "SyncRate | Invite Only",
+			"error": err.Error(),
+		})
+	case errors.Is(err, errRoomNoGuests):
+		c.HTML(http.StatusForbidden, "error.html", gin.H{
+			"title": "SyncRate | Account Required",
+			"error": err.Error(),
+		})
+	default:
+		log.Printf("guardRoomPage: %v", err)
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"title": "SyncRate | Error",
+			"error": "Failed to load room",
+		})
+	}
+	return false
+}
+
+func renderRoomLocked(c *gin.Context, access *roomAccess, errorMessage string) {
+	templateData := GetUserContext(c)
+	templateData["title"] = "SyncRate | Password Required"
+	templateData["room_id"] = access.roomID
+	templateData["unlock_url"] = access.roomPath() + "/unlock"
+	if errorMessage != "" {
+		templateData["error"] = errorMessage
+	}
+	c.HTML(http.StatusOK, "room-locked.html", templateData)
+}
+
+// hashRoomPassword hashes a room password like user passwords. An empty
+// password leaves the room open.
+func hashRoomPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash room password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// PostUnlockRatingRoom checks the password of a rating room
+func PostUnlockRatingRoom(store database.Store) gin.HandlerFunc {
+	return postUnlockRoom(store, models.RoomTypeRating)
+}
+
+// PostUnlockRadioRoom checks the password of a radio room
+func PostUnlockRadioRoom(store database.Store) gin.HandlerFunc {
+	return postUnlockRoom(store, models.RoomTypeRadio)
+}
+
+// PostUnlockTournamentRoom checks the password of a tournament room
+func PostUnlockTournamentRoom(store database.Store) gin.HandlerFunc {
+	return postUnlockRoom(store, models.RoomTypeTournament)
+}
+
+// postUnlockRoom puts users who know the room password on its allow-list
+func postUnlockRoom(store database.Store, roomType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists || userID == nil {
+			c.Redirect(http.StatusFound, "/login")
+			return
+		}
+
+		access, err := loadRoomAccess(store, roomType, c.Param("roomId"))
+		if err != nil {
+			c.HTML(http.StatusNotFound, "error.html", gin.H{
+				"title": "SyncRate | Room Not Found",
+				"error": "Room not found",
+			})
+			return
+		}
+		if access.passwordHash == "" || access.inviteOnly {
+			c.Redirect(http.StatusFound, access.roomPath())
+			return
+		}
+
+		password := c.PostForm("password")
+		if err := bcrypt.CompareHashAndPassword([]byte(access.passwordHash), []byte(password)); err != nil {
+			renderRoomLocked(c, access, "Wrong password")
+			return
+		}
+
+		if err := store.AllowRoomUser(roomType, access.roomID, userID.(uint)); err != nil {
+			log.Printf("postUnlockRoom: %v", err)
+			renderRoomLocked(c, access, "Failed to unlock room")
+			return
+		}
+		c.Redirect(http.StatusFound, access.roomPath())
+	}
+}
+
+// PostRatingRoomInvite creates an invite link for a rating room
+func PostRatingRoomInvite(store database.Store) gin.HandlerFunc {
+	return postRoomInvite(store, models.RoomTypeRating)
+}
+
+// PostRadioRoomInvite creates an invite link for a radio room
+func PostRadioRoomInvite(store database.Store) gin.HandlerFunc {
+	return postRoomInvite(store, models.RoomTypeRadio)
+}
+
+// PostTournamentRoomInvite creates an invite link for a tournament room
+func PostTournamentRoomInvite(store database.Store) gin.HandlerFunc {
+	return postRoomInvite(store, models.RoomTypeTournament)
+}
+
+// postRoomInvite lets the host and co-hosts create signed, expiring invite
+// links. Redeeming one puts the user on the room's allow-list.
+func postRoomInvite(store database.Store, roomType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists || userID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		access, err := loadRoomAccess(store, roomType, c.Param("roomId"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+			return
+		}
+
+		if !canInvite(access, userID.(uint)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the host and co-hosts can create invite links"})
+			return
+		}
+
+		var requestBody struct {
+			ExpiresInHours int `json:"expires_in_hours"`
+		}
+		if err := c.ShouldBindJSON(&requestBody); err != nil && err.Error() != "EOF" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		lifetime := defaultInviteLifetime
+		if requestBody.ExpiresInHours > 0 {
+			lifetime = min(time.Duration(requestBody.ExpiresInHours)*time.Hour, maxInviteLifetime)
+		}
+		expiresAt := time.Now().Add(lifetime)
+
+		c.JSON(http.StatusOK, gin.H{
+			"url":        access.roomPath() + "?invite=" + signInvite(roomType, access.roomID, expiresAt),
+			"expires_at": expiresAt,
+		})
+	}
+}
+
+// canInvite reports whether a user runs the room: its host or a co-host in
+// the live room, or its creator while nobody is in it
+func canInvite(access *roomAccess, userID uint) bool {
+	if room, exists := roomManagerFor(access.roomType).GetRoom(access.roomID); exists {
+		return room.RoleOf(fmt.Sprintf("%d", userID)).AtLeast(wsocket.RoleCoHost)
+	}
+	return access.creatorID == userID
+}
+
+// signInvite creates an invite token for a room that is valid until expiresAt
+func signInvite(roomType, roomID string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s:%s:%d", roomType, roomID, expiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(inviteSignature(payload))
+}
+
+// verifyInvite checks that a token was signed by us, for this room, and has
+// not expired
+func verifyInvite(token, roomType, roomID string) error {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return errInvalidInvite
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return errInvalidInvite
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, inviteSignature(string(payload))) {
+		return errInvalidInvite
+	}
+
+	fields := strings.Split(string(payload), ":")
+	if len(fields) != 3 || fields[0] != roomType || fields[1] != roomID {
+		return errInvalidInvite
+	}
+	expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return errInvalidInvite
+	}
+	return nil
+}
+
+func inviteSignature(payload string) []byte {
+	mac := hmac.New(sha256.New, inviteSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
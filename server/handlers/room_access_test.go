@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestVerifyInvite(t *testing.T) {
+	valid := signInvite(models.RoomTypeRating, "room1", time.Now().Add(time.Hour))
+	payload, signature, _ := strings.Cut(valid, ".")
+	// Change the first character of the signature, which holds six of its
+	// bits
+	tampered := "A" + signature[1:]
+	if signature[0] == 'A' {
+		tampered = "B" + signature[1:]
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		roomType string
+		roomID   string
+		wantErr  bool
+	}{
+		{"valid invite", valid, models.RoomTypeRating, "room1", false},
+		{"expired invite", signInvite(models.RoomTypeRating, "room1", time.Now().Add(-time.Minute)), models.RoomTypeRating, "room1", true},
+		{"tampered signature", payload + "." + tampered, models.RoomTypeRating, "room1", true},
+		{"signature of another invite", signInvite(models.RoomTypeRating, "room2", time.Now().Add(time.Hour)), models.RoomTypeRating, "room1", true},
+		{"invite for the wrong room", valid, models.RoomTypeRating, "room2", true},
+		{"invite for another kind of room", valid, models.RoomTypeRadio, "room1", true},
+		{"no signature", payload, models.RoomTypeRating, "room1", true},
+		{"garbage", "not-a-token", models.RoomTypeRating, "room1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyInvite(tt.token, tt.roomType, tt.roomID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyInvite = %v; want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errInvalidInvite) {
+				t.Errorf("error = %v; want errInvalidInvite", err)
+			}
+		})
+	}
+}
+
+func TestVerifyInviteRejectsOtherSecrets(t *testing.T) {
+	token := signInvite(models.RoomTypeRating, "room1", time.Now().Add(time.Hour))
+	saved := inviteSecret
+	t.Cleanup(func() { SetInviteSecret(saved) })
+
+	SetInviteSecret([]byte("another instance"))
+	if err := verifyInvite(token, models.RoomTypeRating, "room1"); !errors.Is(err, errInvalidInvite) {
+		t.Errorf("verifyInvite with another secret = %v; want errInvalidInvite", err)
+	}
+}
+
+func TestCheckRoomAccess(t *testing.T) {
+	store := memory.New()
+	creator := createTestUser(t, store, "creator")
+	allowed := createTestUser(t, store, "allowed")
+	stranger := createTestUser(t, store, "stranger")
+	if err := store.AllowRoomUser(models.RoomTypeRating, "room1", allowed.UserID); err != nil {
+		t.Fatalf("AllowRoomUser: %v", err)
+	}
+
+	open := roomAccess{roomType: models.RoomTypeRating, roomID: "room1", creatorID: creator.UserID}
+	locked := open
+	locked.passwordHash = "hash"
+	inviteOnly := open
+	inviteOnly.inviteOnly = true
+	guests := open
+	guests.allowGuests = true
+
+	tests := []struct {
+		name   string
+		access roomAccess
+		userID uint
+		guest  bool
+		want   error
+	}{
+		{"open room", open, stranger.UserID, false, nil},
+		{"guest in a room without guests", open, stranger.UserID, true, errRoomNoGuests},
+		{"guest in a room with guests", guests, stranger.UserID, true, nil},
+		{"creator of a locked room", locked, creator.UserID, false, nil},
+		{"unlocked user", locked, allowed.UserID, false, nil},
+		{"stranger in a locked room", locked, stranger.UserID, false, errRoomPasswordRequired},
+		{"invited user", inviteOnly, allowed.UserID, false, nil},
+		{"stranger in an invite-only room", inviteOnly, stranger.UserID, false, errRoomInviteOnly},
+		{"allow-list of another room", roomAccess{roomType: models.RoomTypeRating, roomID: "room2", creatorID: creator.UserID, inviteOnly: true}, allowed.UserID, false, errRoomInviteOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRoomAccess(store, &tt.access, tt.userID, tt.guest); !errors.Is(err, tt.want) {
+				t.Errorf("checkRoomAccess = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoomPasswordAndInvites(t *testing.T) {
+	store := memory.New()
+	creator := createTestUser(t, store, "creator")
+	visitor := createTestUser(t, store, "visitor")
+	hash, err := hashRoomPassword("open sesame")
+	if err != nil {
+		t.Fatalf("hashRoomPassword: %v", err)
+	}
+	for _, room := range []models.RatingRoom{
+		{RoomID: "locked", CreatorID: creator.UserID, PasswordHash: hash},
+		{RoomID: "invite", CreatorID: creator.UserID, InviteOnly: true},
+	} {
+		if err := store.CreateRatingRoom(&room); err != nil {
+			t.Fatalf("CreateRatingRoom: %v", err)
+		}
+	}
+
+	r := newTestRouter(t, visitor)
+	r.GET("/rating-room/:roomId", func(c *gin.Context) {
+		if guardRoomPage(c, store, models.RoomTypeRating, c.Param("roomId"), visitor.UserID) {
+			c.String(http.StatusOK, "in the room")
+		}
+	})
+	r.POST("/rating-room/:roomId/unlock", PostUnlockRatingRoom(store))
+	isAllowed := func(roomID string) bool {
+		allowed, err := store.IsRoomUserAllowed(models.RoomTypeRating, roomID, visitor.UserID)
+		if err != nil {
+			t.Fatalf("IsRoomUserAllowed: %v", err)
+		}
+		return allowed
+	}
+	invite := func(roomID string, expiresAt time.Time) string {
+		return "?invite=" + url.QueryEscape(signInvite(models.RoomTypeRating, roomID, expiresAt))
+	}
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		form        url.Values
+		wantStatus  int
+		wantBody    string
+		wantAllowed map[string]bool
+	}{
+		{
+			name: "locked room asks for the password", method: http.MethodGet, target: "/rating-room/locked",
+			wantStatus: http.StatusOK, wantBody: "/rating-room/locked/unlock",
+		},
+		{
+			name: "wrong unlock password", method: http.MethodPost, target: "/rating-room/locked/unlock",
+			form: url.Values{"password": {"let me in"}}, wantStatus: http.StatusOK, wantBody: "Wrong password",
+			wantAllowed: map[string]bool{"locked": false},
+		},
+		{
+			name: "expired invite", method: http.MethodGet, target: "/rating-room/invite" + invite("invite", time.Now().Add(-time.Minute)),
+			wantStatus: http.StatusForbidden, wantAllowed: map[string]bool{"invite": false},
+		},
+		{
+			name: "invite for the wrong room", method: http.MethodGet, target: "/rating-room/invite" + invite("locked", later),
+			wantStatus: http.StatusForbidden, wantAllowed: map[string]bool{"invite": false, "locked": false},
+		},
+		{
+			name: "invite-only room without an invite", method: http.MethodGet, target: "/rating-room/invite",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "valid invite", method: http.MethodGet, target: "/rating-room/invite" + invite("invite", later),
+			wantStatus: http.StatusFound, wantAllowed: map[string]bool{"invite": true},
+		},
+		{
+			name: "invited user enters", method: http.MethodGet, target: "/rating-room/invite",
+			wantStatus: http.StatusOK, wantBody: "in the room",
+		},
+		{
+			name: "right unlock password", method: http.MethodPost, target: "/rating-room/locked/unlock",
+			form: url.Values{"password": {"open sesame"}}, wantStatus: http.StatusFound,
+			wantAllowed: map[string]bool{"locked": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveForm(r, tt.method, tt.target, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q", tt.wantBody)
+			}
+			for roomID, want := range tt.wantAllowed {
+				if got := isAllowed(roomID); got != want {
+					t.Errorf("allowed in %s = %v; want %v", roomID, got, want)
+				}
+			}
+		})
+	}
+}
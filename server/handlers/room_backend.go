@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+)
+
+// Room kinds, used as the topic of each room manager
+const (
+	ratingRoomTopic     = "rating"
+	radioRoomTopic      = "radio"
+	tournamentRoomTopic = "tournament"
+)
+
+// UseRoomBackend replaces the in-process room managers with ones that keep
+// room state in the stores returned by newStore and exchange room traffic
+// through broadcaster. Call it before the router starts serving.
+func UseRoomBackend(newStore func(topic string) wsocket.RoomStore, broadcaster wsocket.Broadcaster) {
+	roomManager = wsocket.NewRoomManagerWithBackend(ratingRoomTopic, newStore(ratingRoomTopic), broadcaster)
+	radioRoomManager = wsocket.NewRoomManagerWithBackend(radioRoomTopic, newStore(radioRoomTopic), broadcaster)
+	tournamentRoomManager = wsocket.NewRoomManagerWithBackend(tournamentRoomTopic, newStore(tournamentRoomTopic), broadcaster)
+}
+
+// recordVideoSync remembers the player position sent by a client so it can
+// be restored after a restart or on another instance
+func recordVideoSync(manager *wsocket.RoomManager, roomID string, data json.RawMessage) {
+	var syncData wsocket.VideoSyncData
+	if err := json.Unmarshal(data, &syncData); err != nil {
+		return
+	}
+	manager.UpdatePlayback(roomID, syncData.Time, syncData.IsPlaying)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+)
+
+// Lowest role allowed to send each message type, per kind of room. Host
+// actions (roles, kicks, bans, ownership) are allowed to the host in every
+// room and need no entry.
+var (
+	ratingRoomPermissions = wsocket.Permissions{
+		wsocket.MsgVideoSync:  wsocket.RoleCoHost,
+		wsocket.MsgVoteUpdate: wsocket.RoleMember,
+		wsocket.MsgNextSong:   wsocket.RoleCoHost,
+		wsocket.MsgEndSession: wsocket.RoleCoHost,
+	}
+
+	// Every player asks for the next song when its song ends, so members
+	// may advance a radio room. Durations come from the catalog or the
+	// host's player, as a shorter one would let anyone cut a song short.
+	radioRoomPermissions = wsocket.Permissions{
+		wsocket.MsgVideoSync:    wsocket.RoleCoHost,
+		wsocket.MsgVoteUpdate:   wsocket.RoleMember,
+		wsocket.MsgNextSong:     wsocket.RoleCoHost,
+		wsocket.MsgSongEnded:    wsocket.RoleMember,
+		wsocket.MsgSongDuration: wsocket.RoleHost,
+		wsocket.MsgQueueAdd:     wsocket.RoleMember,
+		wsocket.MsgQueueUpvote:  wsocket.RoleMember,
+		wsocket.MsgQueueRemove:  wsocket.RoleMember,
+		wsocket.MsgQueueMove:    wsocket.RoleCoHost,
+		wsocket.MsgVoteSkip:     wsocket.RoleMember,
+	}
+
+	tournamentRoomPermissions = wsocket.Permissions{
+		wsocket.MsgStartTournament: wsocket.RoleCoHost,
+		wsocket.MsgStartMatch:      wsocket.RoleCoHost,
+		wsocket.MsgNavigateMatch:   wsocket.RoleCoHost,
+		wsocket.MsgPickWinner:      wsocket.RoleMember,
+		wsocket.MsgVideoSync:       wsocket.RoleCoHost,
+		wsocket.MsgVoteUpdate:      wsocket.RoleMember,
+	}
+)
+
+// authorizeMessage checks a message against the sender's role in the room
+// and tells the sender when it is rejected
+func authorizeMessage(manager *wsocket.RoomManager, client *wsocket.Client, msg wsocket.WSMessage, permissions wsocket.Permissions) bool {
+	if err := manager.Authorize(client, msg.Type, permissions); err != nil {
+		sendRoomError(client, msg.Type, err)
+		return false
+	}
+	return true
+}
+
+// handleModeration applies a host action such as a kick or a promotion and
+// records it in the audit log. roomType is one of the models.RoomType kinds.
+func handleModeration(store database.Store, manager *wsocket.RoomManager, roomType string, client *wsocket.Client, msg wsocket.WSMessage) {
+	if err := manager.Moderate(client, msg); err != nil {
+		sendRoomError(client, msg.Type, err)
+		return
+	}
+
+	var data wsocket.ModerationData
+	json.Unmarshal(msg.Data, &data)
+	event := models.AuditEvent{
+		ActorName:  client.Username,
+		Action:     string(msg.Type),
+		EntityType: roomType + "_room",
+		EntityID:   client.RoomID,
+		After:      auditSnapshot(data),
+	}
+	if actorID, err := strconv.ParseUint(client.ID, 10, 32); err == nil {
+		id := uint(actorID)
+		event.ActorID = &id
+	}
+	if err := store.RecordAuditEvent(&event); err != nil {
+		log.Printf("handleModeration: %v", err)
+	}
+}
+
+// sendRoomError replies to a rejected action so the client can explain it
+func sendRoomError(client *wsocket.Client, action wsocket.MessageType, err error) {
+	client.SendJSON(map[string]interface{}{
+		"type":   wsocket.MsgError,
+		"action": action,
+		"error":  err.Error(),
+	})
+}
+
+// canParticipate reports whether a user counts towards votes and picks
+func canParticipate(user wsocket.UserInfo) bool {
+	return user.Role.AtLeast(wsocket.RoleMember)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"testing"
+
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+)
+
+func TestRoomPermissions(t *testing.T) {
+	// Users of the test room by role; user 1 created it
+	users := map[wsocket.Role]string{
+		wsocket.RoleHost:      "1",
+		wsocket.RoleCoHost:    "2",
+		wsocket.RoleMember:    "3",
+		wsocket.RoleSpectator: "4",
+	}
+	ranks := []wsocket.Role{wsocket.RoleSpectator, wsocket.RoleMember, wsocket.RoleCoHost, wsocket.RoleHost}
+
+	moderation := []wsocket.MessageType{
+		wsocket.MsgSetRole, wsocket.MsgKickUser, wsocket.MsgBanUser, wsocket.MsgUnbanUser, wsocket.MsgTransferHost,
+	}
+
+	tests := []struct {
+		name        string
+		permissions wsocket.Permissions
+		// lowest role allowed per message type; "" means nobody may send it
+		want map[wsocket.MessageType]wsocket.Role
+	}{
+		{
+			name:        "rating",
+			permissions: ratingRoomPermissions,
+			want: map[wsocket.MessageType]wsocket.Role{
+				wsocket.MsgVideoSync:    wsocket.RoleCoHost,
+				wsocket.MsgVoteUpdate:   wsocket.RoleMember,
+				wsocket.MsgNextSong:     wsocket.RoleCoHost,
+				wsocket.MsgEndSession:   wsocket.RoleCoHost,
+				wsocket.MsgQueueAdd:     "",
+				wsocket.MsgPickWinner:   "",
+				wsocket.MsgSongDuration: "",
+			},
+		},
+		{
+			name:        "radio",
+			permissions: radioRoomPermissions,
+			want: map[wsocket.MessageType]wsocket.Role{
+				wsocket.MsgVideoSync:    wsocket.RoleCoHost,
+				wsocket.MsgVoteUpdate:   wsocket.RoleMember,
+				wsocket.MsgNextSong:     wsocket.RoleCoHost,
+				wsocket.MsgSongEnded:    wsocket.RoleMember,
+				wsocket.MsgSongDuration: wsocket.RoleHost,
+				wsocket.MsgQueueAdd:     wsocket.RoleMember,
+				wsocket.MsgQueueUpvote:  wsocket.RoleMember,
+				wsocket.MsgQueueRemove:  wsocket.RoleMember,
+				wsocket.MsgQueueMove:    wsocket.RoleCoHost,
+				wsocket.MsgVoteSkip:     wsocket.RoleMember,
+				wsocket.MsgEndSession:   "",
+				wsocket.MsgPickWinner:   "",
+			},
+		},
+		{
+			name:        "tournament",
+			permissions: tournamentRoomPermissions,
+			want: map[wsocket.MessageType]wsocket.Role{
+				wsocket.MsgStartTournament: wsocket.RoleCoHost,
+				wsocket.MsgStartMatch:      wsocket.RoleCoHost,
+				wsocket.MsgNavigateMatch:   wsocket.RoleCoHost,
+				wsocket.MsgPickWinner:      wsocket.RoleMember,
+				wsocket.MsgVideoSync:       wsocket.RoleCoHost,
+				wsocket.MsgVoteUpdate:      wsocket.RoleMember,
+				wsocket.MsgNextSong:        "",
+				wsocket.MsgQueueAdd:        "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := wsocket.NewRoomManager()
+			room := manager.CreateRoom("room", users[wsocket.RoleHost], "host")
+			room.Roles[users[wsocket.RoleCoHost]] = wsocket.RoleCoHost
+			room.Roles[users[wsocket.RoleSpectator]] = wsocket.RoleSpectator
+
+			// Host actions are the host's alone in every room
+			want := tt.want
+			for _, msgType := range moderation {
+				want[msgType] = wsocket.RoleHost
+			}
+
+			for msgType, lowest := range want {
+				for _, role := range ranks {
+					client := &wsocket.Client{ID: users[role], RoomID: "room"}
+					allowed := manager.Authorize(client, msgType, tt.permissions) == nil
+					if want := lowest != "" && role.AtLeast(lowest); allowed != want {
+						t.Errorf("%s sending %s: allowed = %v; want %v", role, msgType, allowed, want)
+					}
+				}
+			}
+		})
+	}
+}
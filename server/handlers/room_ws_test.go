@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/gorilla/websocket"
+)
+
+// dialRoom connects a user to a room's WebSocket through a test server
+func dialRoom(t *testing.T, server *httptest.Server, path string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + path
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial %s: %v", path, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readMessage skips messages until one of the given type arrives
+func readMessage(t *testing.T, conn *websocket.Conn, msgType wsocket.MessageType) wsocket.WSMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg wsocket.WSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+func TestRatingRoomWSRoundTrip(t *testing.T) {
+	store := memory.New()
+	host := createTestUser(t, store, "host")
+	member := createTestUser(t, store, "member")
+	song := createTestSong(t, store, "song")
+
+	room := models.RatingRoom{RoomID: "ws-round-trip", CreatorID: host.UserID}
+	if err := store.CreateRatingRoom(&room); err != nil {
+		t.Fatalf("CreateRatingRoom: %v", err)
+	}
+	if err := store.SetRatingRoomCurrentSong(room.RoomID, song.SongID); err != nil {
+		t.Fatalf("SetRatingRoomCurrentSong: %v", err)
+	}
+	roomManager.CreateRoom(room.RoomID, fmt.Sprint(host.UserID), host.Username)
+	t.Cleanup(func() { roomManager.CleanupInactiveRooms(0) })
+
+	path := "/rating-room/" + room.RoomID + "/ws"
+	conns := make([]*websocket.Conn, 0, 2)
+	for _, user := range []*models.User{host, member} {
+		r := newTestRouter(t, user)
+		r.GET("/rating-room/:roomId/ws", GetRatingRoomWS(store))
+		server := httptest.NewServer(r)
+		t.Cleanup(server.Close)
+		conns = append(conns, dialRoom(t, server, path))
+	}
+
+	// Everyone joining gets the room's current song
+	for _, conn := range conns {
+		var change wsocket.SongChangeData
+		if err := json.Unmarshal(readMessage(t, conn, wsocket.MsgSongChange).Data, &change); err != nil {
+			t.Fatalf("song change: %v", err)
+		}
+		if change.SongID != song.SongID {
+			t.Fatalf("song change for song %d; want %d", change.SongID, song.SongID)
+		}
+	}
+
+	data, _ := json.Marshal(wsocket.VoteUpdateData{UserID: fmt.Sprint(member.UserID), Rating: 7, Comment: "nice"})
+	if err := conns[1].WriteJSON(wsocket.WSMessage{Type: wsocket.MsgVoteUpdate, Data: data}); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+
+	// The vote reaches the other member and is stored
+	var update wsocket.VoteUpdateData
+	if err := json.Unmarshal(readMessage(t, conns[0], wsocket.MsgVoteUpdate).Data, &update); err != nil {
+		t.Fatalf("vote update: %v", err)
+	}
+	if update.Rating != 7 {
+		t.Errorf("broadcast rating = %d; want 7", update.Rating)
+	}
+	vote, err := store.GetVote(member.UserID, song.SongID)
+	if err != nil {
+		t.Fatalf("GetVote: %v", err)
+	}
+	if vote.Rating != 7 || vote.Comment != "nice" {
+		t.Errorf("stored vote = %d %q; want 7 %q", vote.Rating, vote.Comment, "nice")
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"math/rand"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+)
+
+// SongSelector picks the next song of a rating room. Selectors are looked up
+// by the name stored in RatingRoom.SongSelection.
+type SongSelector interface {
+	// Name identifies the selector in RatingRoom.SongSelection
+	Name() string
+	// Label describes the selector on the create room page
+	Label() string
+	// Next picks one of the songs matching pick.Filter, or returns nil when
+	// none is left
+	Next(store database.Store, pick SongPick) (*models.Song, error)
+}
+
+// SongPick is what a selector knows about the room it picks for
+type SongPick struct {
+	Filter  database.SongFilter // The room filters
+	UserIDs []uint              // Participants in the room
+	Recent  []models.Song       // Songs played last, newest first, with their relations
+}
+
+// songSelectors are offered in this order when creating a rating room
+var songSelectors = []SongSelector{
+	randomSelector{},
+	recommendedSelector{mode: models.SongSelectionRecommended},
+	recommendedSelector{mode: models.SongSelectionDivisive},
+	rotationSelector{byUnit: false},
+	rotationSelector{byUnit: true},
+	fewestVotesSelector{},
+	oldestFirstSelector{},
+}
+
+// songSelectorByName returns the selector stored as name in
+// RatingRoom.SongSelection
+func songSelectorByName(name string) (SongSelector, bool) {
+	for _, selector := range songSelectors {
+		if selector.Name() == name {
+			return selector, true
+		}
+	}
+	return nil, false
+}
+
+// randomSelector picks any matching song
+type randomSelector struct{}
+
+func (randomSelector) Name() string  { return models.SongSelectionRandom }
+func (randomSelector) Label() string { return "Random" }
+
+func (randomSelector) Next(store database.Store, pick SongPick) (*models.Song, error) {
+	songs, err := store.RandomSongs(pick.Filter, 1)
+	if err != nil || len(songs) == 0 {
+		return nil, err
+	}
+	return &songs[0], nil
+}
+
+// recommendedSelector picks what the recommender predicts the participants
+// enjoy or disagree on, see pickRecommendedSong. It falls back to a random
+// song when the recommender knows nothing about them yet.
+type recommendedSelector struct {
+	mode string // SongSelectionRecommended or SongSelectionDivisive
+}
+
+func (s recommendedSelector) Name() string { return s.mode }
+
+func (s recommendedSelector) Label() string {
+	if s.mode == models.SongSelectionDivisive {
+		return "Songs the room will probably disagree on"
+	}
+	return "Songs the room will probably enjoy"
+}
+
+func (s recommendedSelector) Next(store database.Store, pick SongPick) (*models.Song, error) {
+	if song := pickRecommendedSong(store, pick.UserIDs, pick.Filter, s.mode); song != nil {
+		return song, nil
+	}
+	return randomSelector{}.Next(store, pick)
+}
+
+// rotationSelector lets artists, or units, take turns: the one played
+// longest ago goes next, so artists with many songs do not crowd out the
+// others. Songs without an artist or unit take turns as one more group.
+type rotationSelector struct {
+	byUnit bool
+}
+
+func (s rotationSelector) Name() string {
+	if s.byUnit {
+		return models.SongSelectionUnitRotation
+	}
+	return models.SongSelectionArtistRotation
+}
+
+func (s rotationSelector) Label() string {
+	if s.byUnit {
+		return "Units take turns"
+	}
+	return "Artists take turns"
+}
+
+// groups returns the artist or unit IDs of a song, or 0 without any
+func (s rotationSelector) groups(credits database.SongCredits) []uint {
+	ids := credits.ArtistIDs
+	if s.byUnit {
+		ids = credits.UnitIDs
+	}
+	if len(ids) == 0 {
+		return []uint{0}
+	}
+	return ids
+}
+
+// songCredits are the artists and units of a song with its relations loaded
+func songCredits(song models.Song) database.SongCredits {
+	credits := database.SongCredits{SongID: song.SongID}
+	for _, artist := range song.Artists {
+		credits.ArtistIDs = append(credits.ArtistIDs, artist.ArtistID)
+	}
+	for _, unit := range song.Units {
+		credits.UnitIDs = append(credits.UnitIDs, unit.UnitID)
+	}
+	return credits
+}
+
+// Next only loads the credits of the matching songs, then the one it picks
+func (s rotationSelector) Next(store database.Store, pick SongPick) (*models.Song, error) {
+	credits, err := store.GetSongCredits(pick.Filter)
+	if err != nil || len(credits) == 0 {
+		return nil, err
+	}
+
+	// How many songs ago each group was last played; the oldest songs go
+	// first so newer ones overwrite them
+	lastPlayed := make(map[uint]int)
+	for i := len(pick.Recent) - 1; i >= 0; i-- {
+		for _, id := range s.groups(songCredits(pick.Recent[i])) {
+			lastPlayed[id] = i
+		}
+	}
+
+	songsByGroup := make(map[uint][]uint)
+	for _, song := range credits {
+		for _, id := range s.groups(song) {
+			songsByGroup[id] = append(songsByGroup[id], song.SongID)
+		}
+	}
+
+	// Groups not played lately tie, and each of them is as likely to go
+	// next however many songs it has
+	longestAgo := -1
+	var next []uint
+	for id := range songsByGroup {
+		ago, played := lastPlayed[id]
+		if !played {
+			ago = len(pick.Recent)
+		}
+		switch {
+		case ago > longestAgo:
+			longestAgo = ago
+			next = []uint{id}
+		case ago == longestAgo:
+			next = append(next, id)
+		}
+	}
+	songIDs := songsByGroup[next[rand.Intn(len(next))]]
+	return store.GetSongByID(songIDs[rand.Intn(len(songIDs))])
+}
+
+// fewestVotesSelector picks songs with fewer votes more often: a song's
+// chance is proportional to 1/(1+votes)
+type fewestVotesSelector struct{}
+
+func (fewestVotesSelector) Name() string  { return models.SongSelectionFewestVotes }
+func (fewestVotesSelector) Label() string { return "Songs with few votes more often" }
+
+func (fewestVotesSelector) Next(store database.Store, pick SongPick) (*models.Song, error) {
+	return store.RandomSongByVotes(pick.Filter)
+}
+
+// oldestFirstSelector plays songs in the order they were added: the next is
+// the oldest added after the song played last, and after the newest it starts
+// over with the oldest
+type oldestFirstSelector struct{}
+
+func (oldestFirstSelector) Name() string  { return models.SongSelectionOldestFirst }
+func (oldestFirstSelector) Label() string { return "Oldest added first" }
+
+func (oldestFirstSelector) Next(store database.Store, pick SongPick) (*models.Song, error) {
+	opts := database.ListOptions{
+		Sort:    "created",
+		Limit:   1,
+		Include: database.SongListing.Includes,
+	}
+	if len(pick.Recent) > 0 {
+		last := pick.Recent[0]
+		opts.Cursor = database.Cursor{Sort: opts.Sort, Value: last.CreatedAt, ID: last.SongID}.Encode()
+	}
+
+	page, err := store.ListSongs(pick.Filter, opts)
+	if err == nil && len(page.Items) == 0 && opts.Cursor != "" {
+		opts.Cursor = ""
+		page, err = store.ListSongs(pick.Filter, opts)
+	}
+	if err != nil || len(page.Items) == 0 {
+		return nil, err
+	}
+	return &page.Items[0].Song, nil
+}
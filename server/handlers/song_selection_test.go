@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+)
+
+// createTestSong adds a song by the given artists to the store
+func createTestSong(t *testing.T, store database.Store, name string, artists ...models.Artist) models.Song {
+	t.Helper()
+	song := models.Song{
+		NameOriginal: name,
+		SourceURL:    "https://example.com/" + name + ".mp3",
+		ThumbnailURL: "https://example.com/" + name + ".jpg",
+		Artists:      artists,
+	}
+	if err := store.CreateSong(&song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	created, err := store.GetSongByID(song.SongID)
+	if err != nil {
+		t.Fatalf("GetSongByID: %v", err)
+	}
+	return *created
+}
+
+func createTestArtist(t *testing.T, store database.Store, name string) models.Artist {
+	t.Helper()
+	artist := models.Artist{NameOriginal: name}
+	if err := store.CreateArtist(&artist); err != nil {
+		t.Fatalf("CreateArtist: %v", err)
+	}
+	return artist
+}
+
+func TestOldestFirstSelectorCycles(t *testing.T) {
+	store := memory.New()
+	songs := []models.Song{
+		createTestSong(t, store, "first"),
+		createTestSong(t, store, "second"),
+		createTestSong(t, store, "third"),
+	}
+
+	tests := []struct {
+		name   string
+		recent []models.Song
+		want   uint
+	}{
+		{"nothing played", nil, songs[0].SongID},
+		{"after the oldest", []models.Song{songs[0]}, songs[1].SongID},
+		{"newest played last", []models.Song{songs[1], songs[0]}, songs[2].SongID},
+		{"starts over", []models.Song{songs[2], songs[1]}, songs[0].SongID},
+	}
+	for _, tt := range tests {
+		song, err := oldestFirstSelector{}.Next(store, SongPick{Recent: tt.recent})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if song == nil || song.SongID != tt.want {
+			t.Errorf("%s: got %v, want song %d", tt.name, song, tt.want)
+		}
+	}
+}
+
+func TestRotationSelectorPicksArtistPlayedLongestAgo(t *testing.T) {
+	store := memory.New()
+	prolific := createTestArtist(t, store, "prolific")
+	rare := createTestArtist(t, store, "rare")
+	var played models.Song
+	for i := 0; i < 5; i++ {
+		played = createTestSong(t, store, fmt.Sprintf("prolific-%d", i), prolific)
+	}
+	rareSong := createTestSong(t, store, "rare", rare)
+
+	for i := 0; i < 20; i++ {
+		song, err := rotationSelector{}.Next(store, SongPick{Recent: []models.Song{played}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if song == nil || song.SongID != rareSong.SongID {
+			t.Fatalf("got %v, want the rare artist's song", song)
+		}
+		if len(song.Artists) != 1 {
+			t.Fatalf("song artists = %v; want them loaded", song.Artists)
+		}
+	}
+
+	none, err := rotationSelector{}.Next(store, SongPick{Filter: database.SongFilter{SongIDs: []uint{}}})
+	if err != nil || none != nil {
+		t.Errorf("no matching songs: got %v, %v", none, err)
+	}
+}
+
+func TestFewestVotesSelectorPrefersUnvotedSongs(t *testing.T) {
+	store := memory.New()
+	voted := createTestSong(t, store, "voted")
+	unvoted := createTestSong(t, store, "unvoted")
+	for i := 0; i < 9; i++ {
+		user := models.User{Username: fmt.Sprintf("user%d", i)}
+		if err := store.CreateUser(&user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := store.UpsertVote(&models.Vote{UserID: user.UserID, SongID: voted.SongID, Rating: 5}); err != nil {
+			t.Fatalf("UpsertVote: %v", err)
+		}
+	}
+
+	// The unvoted song is ten times as likely
+	picks := make(map[uint]int)
+	for i := 0; i < 1000; i++ {
+		song, err := fewestVotesSelector{}.Next(store, SongPick{})
+		if err != nil || song == nil {
+			t.Fatalf("got %v, %v", song, err)
+		}
+		picks[song.SongID]++
+	}
+	if picks[unvoted.SongID] < 800 || picks[voted.SongID] == 0 {
+		t.Errorf("picks = %v; want about 909 of song %d", picks, unvoted.SongID)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -9,61 +10,36 @@ import (
 
 	"github.com/CptPie/SyncRate/database"
 	"github.com/CptPie/SyncRate/models"
-	"github.com/CptPie/SyncRate/server/utils"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func GetSongs(db *gorm.DB) gin.HandlerFunc {
+func GetSongs(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log.Println("GetSongs: Starting to load all songs")
 
-		// Define a structure to hold song data with average score
-		type SongWithAverage struct {
-			models.Song
-			AverageScore float64 `json:"average_score"`
-			VoteCount    int64   `json:"vote_count"`
-		}
-
-		var songs []models.Song
-		var categories []models.Category
-
-		result := db.Preload("Artists").Preload("Units").Preload("Category").Preload("Albums").Find(&songs)
-		if result.Error != nil {
-			log.Printf("GetSongs: Database error: %v", result.Error)
+		songs, err := store.GetAllSongs()
+		if err != nil {
+			log.Printf("GetSongs: Database error: %v", err)
 			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
 				"title": "SyncRate | Error",
-				"error": "Failed to load songs: " + result.Error.Error(),
+				"error": "Failed to load songs: " + err.Error(),
 			})
 			return
 		}
 
-		db.Find(&categories)
-
-		// Create database wrapper to use existing functions
-		dbWrapper := &database.Database{DB: db}
-
-		// Calculate average scores for each song using existing database functions
-		var songsWithAverages []SongWithAverage
-		for _, song := range songs {
-			avgScore, err := dbWrapper.GetAverageRatingForSong(song.SongID)
-			if err != nil {
-				log.Printf("Error getting average rating for song %d: %v", song.SongID, err)
-				avgScore = 0 // Default to 0 if error
-			}
-
-			voteCount, err := dbWrapper.GetVoteCountForSong(song.SongID)
-			if err != nil {
-				log.Printf("Error getting vote count for song %d: %v", song.SongID, err)
-				voteCount = 0 // Default to 0 if error
-			}
+		categories, err := store.GetAllCategories()
+		if err != nil {
+			log.Printf("GetSongs: Error loading categories: %v", err)
+		}
 
-			songWithAvg := SongWithAverage{
-				Song:         song,
-				AverageScore: avgScore,
-				VoteCount:    voteCount,
-			}
-			songsWithAverages = append(songsWithAverages, songWithAvg)
+		// Vote aggregates of every song in one query
+		stats, err := store.GetSongStats(nil)
+		if err != nil {
+			log.Printf("GetSongs: Error loading song stats: %v", err)
+		}
+		songsWithAverages := make([]database.SongWithStats, len(songs))
+		for i, song := range songs {
+			songsWithAverages[i] = database.SongWithStats{Song: song, SongStats: stats[song.SongID]}
 		}
 
 		// Convert to JSON for JavaScript (using the enhanced structure)
@@ -84,7 +60,7 @@ func GetSongs(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func GetSong(db *gorm.DB) gin.HandlerFunc {
+func GetSong(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		log.Printf("GetSong: Requested song ID: %s", idParam)
@@ -99,76 +75,58 @@ func GetSong(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var song models.Song
-		result := db.Preload("Artists").Preload("Category").Preload("Units").Preload("Albums").First(&song, uint(id))
-		if result.Error != nil {
-			if result.Error == gorm.ErrRecordNotFound {
+		song, err := store.GetSongByID(uint(id))
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
 				log.Printf("GetSong: Song with ID %d not found", id)
 				c.HTML(http.StatusNotFound, "error.html", gin.H{
 					"error": "Song not found",
 				})
 				return
 			}
-			log.Printf("GetSong: Database error loading song %d: %v", id, result.Error)
+			log.Printf("GetSong: Database error loading song %d: %v", id, err)
 			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-				"error": "Failed to load song: " + result.Error.Error(),
+				"error": "Failed to load song: " + err.Error(),
 			})
 			return
 		}
 
-		// Load votes with user information using a JOIN
-		type VoteWithUser struct {
-			models.Vote
-			Username string
-		}
-
-		var votesWithUsers []VoteWithUser
-		voteResult := db.Table("votes").
-			Select("votes.*, users.username").
-			Joins("LEFT JOIN users ON votes.user_id = users.user_id").
-			Where("votes.song_id = ?", id).
-			Find(&votesWithUsers)
-
-		if voteResult.Error != nil {
-			log.Printf("GetSong: Error loading votes for song %d: %v", id, voteResult.Error)
+		// Load votes with user information
+		votesWithUsers, err := store.GetVotesWithUsers(database.VoteFilter{SongIDs: []uint{uint(id)}})
+		if err != nil {
+			log.Printf("GetSong: Error loading votes for song %d: %v", id, err)
 		}
 
 		log.Printf("GetSong: Successfully loaded song '%s' with %d votes", song.NameOriginal, len(votesWithUsers))
 
 		// Convert song to JSON for JavaScript color initialization
 		// Wrap in array to match the format expected by artist-colors.js
-		songsArray := []models.Song{song}
+		songsArray := []models.Song{*song}
 		songJSON, err := json.Marshal(songsArray)
 		if err != nil {
 			log.Printf("GetSong: Error marshaling song JSON: %v", err)
 			songJSON = []byte("[]") // Empty array fallback
 		}
 
-		// Generate YouTube embed URL if source is a YouTube URL
-		var embedURL string
-		if song.SourceURL != "" {
-			if url, err := utils.GetYouTubeEmbedURL(song.SourceURL); err == nil {
-				embedURL = url
-			}
-		}
+		// Embedded player from the song's media provider
+		media := songMedia(song)
 
 		templateData := GetUserContext(c)
 		templateData["title"] = song.NameOriginal
-		templateData["song"] = song
+		templateData["song"] = *song
 		templateData["votes"] = votesWithUsers
 		templateData["songJSON"] = string(songJSON)
-		templateData["embedURL"] = embedURL
+		templateData["embedURL"] = media.EmbedURL
+		templateData["mediaProvider"] = media.Provider
 
 		// Calculate average score and vote count for this song
-		dbWrapper := &database.Database{DB: db}
-
-		avgScore, err := dbWrapper.GetAverageRatingForSong(uint(id))
+		avgScore, err := store.GetAverageRatingForSong(uint(id))
 		if err != nil {
 			log.Printf("Error getting average rating for song %d: %v", id, err)
 			avgScore = 0
 		}
 
-		voteCount, err := dbWrapper.GetVoteCountForSong(uint(id))
+		voteCount, err := store.GetVoteCountForSong(uint(id))
 		if err != nil {
 			log.Printf("Error getting vote count for song %d: %v", id, err)
 			voteCount = 0
@@ -179,23 +137,21 @@ func GetSong(db *gorm.DB) gin.HandlerFunc {
 
 		// Check if current user has voted for this song
 		if userID, exists := c.Get("user_id"); exists && userID != nil {
-			var userVote models.Vote
-			// Use Find instead of First to avoid "record not found" errors in logs
-			result := db.Where("user_id = ? AND song_id = ?", userID, id).Limit(1).Find(&userVote)
-			if result.Error != nil {
-				log.Printf("GetSong: Error checking user vote: %v", result.Error)
-			} else if result.RowsAffected > 0 {
+			userVote, err := store.GetVote(userID.(uint), uint(id))
+			if err == nil {
 				// User has voted - include the vote in template data
-				templateData["user_vote"] = userVote
+				templateData["user_vote"] = *userVote
+			} else if !errors.Is(err, database.ErrNotFound) {
+				log.Printf("GetSong: Error checking user vote: %v", err)
 			}
-			// If RowsAffected == 0, user hasn't voted yet, which is fine
+			// If not found, user hasn't voted yet, which is fine
 		}
 
 		c.HTML(http.StatusOK, "song.html", templateData)
 	}
 }
 
-func PostVote(db *gorm.DB) gin.HandlerFunc {
+func PostVote(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated
 		userID, exists := c.Get("user_id")
@@ -204,6 +160,12 @@ func PostVote(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Guests only rate inside rooms
+		if isGuest(c) {
+			c.Redirect(http.StatusFound, "/register")
+			return
+		}
+
 		// Get song ID from URL
 		songIDParam := c.Param("id")
 		songID, err := strconv.ParseUint(songIDParam, 10, 32)
@@ -216,8 +178,7 @@ func PostVote(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Verify song exists
-		var song models.Song
-		if err := db.First(&song, uint(songID)).Error; err != nil {
+		if exists, err := store.SongExists(uint(songID)); err != nil || !exists {
 			c.HTML(http.StatusNotFound, "error.html", gin.H{
 				"title": "SyncRate | Error",
 				"error": "Song not found",
@@ -239,41 +200,18 @@ func PostVote(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Check if user already voted for this song
-		var existingVote models.Vote
-		result := db.Where("user_id = ? AND song_id = ?", userID, uint(songID)).First(&existingVote)
-
-		if result.Error == nil {
-			// Update existing vote
-			existingVote.Rating = rating
-			existingVote.Comment = comment
-			if err := db.Save(&existingVote).Error; err != nil {
-				c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-					"title": "SyncRate | Error",
-					"error": "Failed to update vote",
-				})
-				return
-			}
-		} else if result.Error == gorm.ErrRecordNotFound {
-			// Create new vote
-			vote := models.Vote{
-				UserID:  userID.(uint),
-				SongID:  uint(songID),
-				Rating:  rating,
-				Comment: comment,
-			}
-			if err := db.Create(&vote).Error; err != nil {
-				c.HTML(http.StatusInternalServerError, "error.html", gin.H{
-					"title": "SyncRate | Error",
-					"error": "Failed to create vote",
-				})
-				return
-			}
-		} else {
-			// Database error
+		// Create the vote or update the user's existing one
+		vote := models.Vote{
+			UserID:  userID.(uint),
+			SongID:  uint(songID),
+			Rating:  rating,
+			Comment: comment,
+		}
+		if err := store.UpsertVote(&vote); err != nil {
+			log.Printf("PostVote: Error saving vote: %v", err)
 			c.HTML(http.StatusInternalServerError, "error.html", gin.H{
 				"title": "SyncRate | Error",
-				"error": "Database error",
+				"error": "Failed to save vote",
 			})
 			return
 		}
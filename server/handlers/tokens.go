@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxTokenLifetimeDays caps the expiry that can be picked for a token
+const maxTokenLifetimeDays = 365
+
+// renderAPITokens shows the token settings page of the logged-in user with
+// extra template data, e.g. a freshly created token
+func renderAPITokens(c *gin.Context, store database.Store, status int, extra gin.H) {
+	templateData := GetUserContext(c)
+	templateData["title"] = "SyncRate | API Tokens"
+	templateData["scopes"] = models.AllScopes
+	for key, value := range extra {
+		templateData[key] = value
+	}
+
+	tokens, err := store.GetAPITokensByUser(c.GetUint("user_id"))
+	if err != nil {
+		log.Printf("renderAPITokens: %v", err)
+		templateData["error"] = "Failed to load your tokens"
+	}
+	templateData["tokens"] = tokens
+	templateData["now"] = time.Now()
+	c.HTML(status, "api-tokens.html", templateData)
+}
+
+// GetAPITokens lists the personal access tokens of the logged-in user
+func GetAPITokens(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderAPITokens(c, store, http.StatusOK, nil)
+	}
+}
+
+// PostAPIToken mints a personal access token. The token is shown once; only
+// its hash is stored.
+func PostAPIToken(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.PostForm("name"))
+		if name == "" {
+			renderAPITokens(c, store, http.StatusBadRequest, gin.H{"error": "Give the token a name"})
+			return
+		}
+
+		scopes := c.PostFormArray("scopes")
+		if len(scopes) == 0 {
+			renderAPITokens(c, store, http.StatusBadRequest, gin.H{"error": "Pick at least one scope"})
+			return
+		}
+		for _, scope := range scopes {
+			if !slices.Contains(models.AllScopes, scope) {
+				renderAPITokens(c, store, http.StatusBadRequest, gin.H{"error": "Unknown scope " + scope})
+				return
+			}
+		}
+
+		var expiresAt *time.Time
+		if days := c.PostForm("expires_in_days"); days != "" {
+			n, err := strconv.Atoi(days)
+			if err != nil || n < 1 || n > maxTokenLifetimeDays {
+				renderAPITokens(c, store, http.StatusBadRequest, gin.H{"error": "Expiry must be between 1 and 365 days"})
+				return
+			}
+			expires := time.Now().AddDate(0, 0, n)
+			expiresAt = &expires
+		}
+
+		raw, prefix, hash, err := utils.GenerateAPIToken()
+		if err != nil {
+			log.Printf("PostAPIToken: %v", err)
+			renderAPITokens(c, store, http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+			return
+		}
+		token := models.APIToken{
+			UserID:    c.GetUint("user_id"),
+			Name:      name,
+			Prefix:    prefix,
+			TokenHash: hash,
+			Scopes:    strings.Join(scopes, " "),
+			ExpiresAt: expiresAt,
+		}
+		if err := store.CreateAPIToken(&token); err != nil {
+			log.Printf("PostAPIToken: %v", err)
+			renderAPITokens(c, store, storeErrorStatus(err), gin.H{"error": "Failed to create token"})
+			return
+		}
+
+		renderAPITokens(c, store, http.StatusOK, gin.H{"newToken": raw, "newTokenName": name})
+	}
+}
+
+// PostRevokeAPIToken revokes a token of the logged-in user
+func PostRevokeAPIToken(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			renderAPITokens(c, store, http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+			return
+		}
+		if err := store.RevokeAPIToken(c.GetUint("user_id"), uint(id)); err != nil {
+			log.Printf("PostRevokeAPIToken: %v", err)
+			renderAPITokens(c, store, storeErrorStatus(err), gin.H{"error": "Failed to revoke token"})
+			return
+		}
+		c.Redirect(http.StatusFound, "/settings/tokens")
+	}
+}
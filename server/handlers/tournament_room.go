@@ -3,6 +3,7 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -10,12 +11,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/CptPie/SyncRate/database"
 	"github.com/CptPie/SyncRate/models"
-	"github.com/CptPie/SyncRate/server/utils"
 	wsocket "github.com/CptPie/SyncRate/server/websocket"
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
-	"gorm.io/gorm"
 )
 
 var (
@@ -24,7 +23,7 @@ var (
 )
 
 // StartTournamentDatabaseCleanup starts a background routine to clean up old tournament rooms
-func StartTournamentDatabaseCleanup(db *gorm.DB) {
+func StartTournamentDatabaseCleanup(store database.Store) {
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
@@ -32,29 +31,29 @@ func StartTournamentDatabaseCleanup(db *gorm.DB) {
 		for {
 			select {
 			case <-ticker.C:
-				cleanupOldTournamentRooms(db, 48*time.Hour) // Keep tournaments for 2 days
+				cleanupOldTournamentRooms(store, 48*time.Hour) // Keep tournaments for 2 days
 			}
 		}
 	}()
 }
 
 // cleanupOldTournamentRooms removes old tournament rooms
-func cleanupOldTournamentRooms(db *gorm.DB, inactivityThreshold time.Duration) {
+func cleanupOldTournamentRooms(store database.Store, inactivityThreshold time.Duration) {
 	cutoffTime := time.Now().Add(-inactivityThreshold)
 
-	result := db.Where("last_active < ?", cutoffTime).Delete(&models.TournamentRoom{})
-	if result.Error != nil {
-		log.Printf("Error cleaning up old tournament rooms: %v", result.Error)
+	deleted, err := store.DeleteInactiveTournamentRooms(cutoffTime)
+	if err != nil {
+		log.Printf("Error cleaning up old tournament rooms: %v", err)
 		return
 	}
 
-	if result.RowsAffected > 0 {
-		log.Printf("Cleaned up %d inactive tournament rooms from database", result.RowsAffected)
+	if deleted > 0 {
+		log.Printf("Cleaned up %d inactive tournament rooms from database", deleted)
 	}
 }
 
 // GetCreateTournamentRoom shows the tournament creation page
-func GetCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
+func GetCreateTournamentRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated
 		if userID, exists := c.Get("user_id"); !exists || userID == nil {
@@ -62,9 +61,17 @@ func GetCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Guests need an account to host rooms
+		if isGuest(c) {
+			c.Redirect(http.StatusFound, "/register")
+			return
+		}
+
 		// Load categories
-		var categories []models.Category
-		db.Find(&categories)
+		categories, err := store.GetAllCategories()
+		if err != nil {
+			log.Printf("GetCreateTournamentRoom: failed to load categories: %v", err)
+		}
 
 		templateData := GetUserContext(c)
 		templateData["title"] = "SyncRate | Create Tournament"
@@ -75,7 +82,7 @@ func GetCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // PostCreateTournamentRoom creates a new tournament room
-func PostCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
+func PostCreateTournamentRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if user is authenticated
 		userID, exists := c.Get("user_id")
@@ -83,6 +90,10 @@ func PostCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 			return
 		}
+		if isGuest(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Create an account to host rooms"})
+			return
+		}
 
 		// Parse request body
 		var requestBody struct {
@@ -92,6 +103,9 @@ func PostCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 			VotedRatio       *float64 `json:"voted_ratio"`
 			CoversOnly       bool     `json:"covers_only"`
 			VideoSyncEnabled bool     `json:"video_sync_enabled"`
+			Password         string   `json:"password"`
+			InviteOnly       bool     `json:"invite_only"`
+			AllowGuests      bool     `json:"allow_guests"`
 		}
 
 		if err := c.ShouldBindJSON(&requestBody); err != nil {
@@ -110,7 +124,7 @@ func PostCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 		roomID := generateTournamentRoomCode()
 
 		// Select songs for the tournament
-		songs, err := selectTournamentSongs(db, userID.(uint), requestBody.TreeSize, requestBody.CategoryID, requestBody.VotedOnly, requestBody.VotedRatio, requestBody.CoversOnly)
+		songs, err := selectTournamentSongs(store, userID.(uint), requestBody.TreeSize, requestBody.CategoryID, requestBody.VotedOnly, requestBody.VotedRatio, requestBody.CoversOnly)
 		if err != nil {
 			log.Printf("Error selecting tournament songs: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to select songs: %v", err)})
@@ -123,7 +137,15 @@ func PostCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Generate tournament tree
-		treeState := generateTournamentTree(db, songs, requestBody.TreeSize)
+		treeState := generateTournamentTree(store, songs, requestBody.TreeSize)
+
+		// Optional room password, hashed like user passwords
+		passwordHash, err := hashRoomPassword(requestBody.Password)
+		if err != nil {
+			log.Printf("Error hashing room password: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+			return
+		}
 
 		// Create room in database
 		room := models.TournamentRoom{
@@ -137,11 +159,14 @@ func PostCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 			VideoSyncEnabled: requestBody.VideoSyncEnabled,
 			TreeState:        treeState,
 			Status:           "setup",
+			PasswordHash:     passwordHash,
+			InviteOnly:       requestBody.InviteOnly,
+			AllowGuests:      requestBody.AllowGuests,
 			CreatedAt:        time.Now(),
 			LastActive:       time.Now(),
 		}
 
-		if err := db.Create(&room).Error; err != nil {
+		if err := store.CreateTournamentRoom(&room); err != nil {
 			log.Printf("Error creating tournament room: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tournament"})
 			return
@@ -165,45 +190,35 @@ func PostCreateTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // selectTournamentSongs selects songs for the tournament based on filters
-func selectTournamentSongs(db *gorm.DB, userID uint, count int, categoryID *uint, votedOnly bool, votedRatio *float64, coversOnly bool) ([]models.Song, error) {
-	var songs []models.Song
-
-	// Build base query
-	baseQuery := db.Preload("Artists").Preload("Units").Preload("Category")
-
-	// Apply category filter
-	if categoryID != nil {
-		baseQuery = baseQuery.Where("category_id = ?", *categoryID)
-	}
-
-	// Apply covers filter
+func selectTournamentSongs(store database.Store, userID uint, count int, categoryID *uint, votedOnly bool, votedRatio *float64, coversOnly bool) ([]models.Song, error) {
+	// Base filter shared by all picks
+	filter := database.SongFilter{CategoryID: categoryID}
 	if coversOnly {
-		baseQuery = baseQuery.Where("is_cover = ?", true)
+		isCover := true
+		filter.IsCover = &isCover
 	}
 
 	if votedOnly {
 		// Only voted songs
-		err := baseQuery.
-			Joins("INNER JOIN votes ON votes.song_id = songs.song_id AND votes.user_id = ?", userID).
-			Order("RANDOM()").
-			Limit(count).
-			Find(&songs).Error
+		votedFilter := filter
+		votedFilter.RatedBy = &userID
+		songs, err := store.RandomSongs(votedFilter, count)
+		if err != nil {
+			return nil, err
+		}
 
 		// If not enough voted songs, fill with unvoted
 		if len(songs) < count {
-			remaining := count - len(songs)
-			var unvotedSongs []models.Song
-
-			baseQuery.
-				Where("song_id NOT IN (?)", db.Table("votes").Select("song_id").Where("user_id = ?", userID)).
-				Order("RANDOM()").
-				Limit(remaining).
-				Find(&unvotedSongs)
-
+			unvotedFilter := filter
+			unvotedFilter.NotRatedBy = &userID
+			unvotedSongs, err := store.RandomSongs(unvotedFilter, count-len(songs))
+			if err != nil {
+				return nil, err
+			}
 			songs = append(songs, unvotedSongs...)
 		}
 
-		return songs, err
+		return songs, nil
 	}
 
 	// Mix of voted and unvoted songs (best effort)
@@ -212,65 +227,36 @@ func selectTournamentSongs(db *gorm.DB, userID uint, count int, categoryID *uint
 		unvotedCount := count - votedCount
 
 		// Get voted songs (up to desired count)
-		var votedSongs []models.Song
-		votedQuery := db.Model(&models.Song{}).
-			Preload("Artists").Preload("Units").Preload("Category").
-			Joins("INNER JOIN votes ON votes.song_id = songs.song_id AND votes.user_id = ?", userID)
-
-		// Apply same filters to voted query
-		if categoryID != nil {
-			votedQuery = votedQuery.Where("songs.category_id = ?", *categoryID)
-		}
-		if coversOnly {
-			votedQuery = votedQuery.Where("songs.is_cover = ?", true)
+		votedFilter := filter
+		votedFilter.RatedBy = &userID
+		votedSongs, err := store.RandomSongs(votedFilter, votedCount)
+		if err != nil {
+			return nil, err
 		}
 
-		votedQuery.Order("RANDOM()").Limit(votedCount).Find(&votedSongs)
-
 		// Get unvoted songs (up to desired count)
-		var unvotedSongs []models.Song
-		unvotedQuery := db.Model(&models.Song{}).
-			Preload("Artists").Preload("Units").Preload("Category").
-			Where("song_id NOT IN (?)", db.Table("votes").Select("song_id").Where("user_id = ?", userID))
-
-		// Apply same filters to unvoted query
-		if categoryID != nil {
-			unvotedQuery = unvotedQuery.Where("category_id = ?", *categoryID)
-		}
-		if coversOnly {
-			unvotedQuery = unvotedQuery.Where("is_cover = ?", true)
+		unvotedFilter := filter
+		unvotedFilter.NotRatedBy = &userID
+		unvotedSongs, err := store.RandomSongs(unvotedFilter, unvotedCount)
+		if err != nil {
+			return nil, err
 		}
 
-		unvotedQuery.Order("RANDOM()").Limit(unvotedCount).Find(&unvotedSongs)
-
 		// Combine what we found
-		songs = append(votedSongs, unvotedSongs...)
+		songs := append(votedSongs, unvotedSongs...)
 
 		// If we don't have enough songs yet, fill with whatever is available
 		if len(songs) < count {
-			remaining := count - len(songs)
-
-			// Get song IDs we already have
-			existingIDs := make([]uint, len(songs))
+			fillFilter := filter
+			fillFilter.ExcludeSongIDs = make([]uint, len(songs))
 			for i, s := range songs {
-				existingIDs[i] = s.SongID
+				fillFilter.ExcludeSongIDs[i] = s.SongID
 			}
 
-			// Get more songs that we haven't selected yet
-			var additionalSongs []models.Song
-			fillQuery := db.Model(&models.Song{}).
-				Preload("Artists").Preload("Units").Preload("Category").
-				Where("song_id NOT IN (?)", existingIDs)
-
-			// Apply same filters
-			if categoryID != nil {
-				fillQuery = fillQuery.Where("category_id = ?", *categoryID)
-			}
-			if coversOnly {
-				fillQuery = fillQuery.Where("is_cover = ?", true)
+			additionalSongs, err := store.RandomSongs(fillFilter, count-len(songs))
+			if err != nil {
+				return nil, err
 			}
-
-			fillQuery.Order("RANDOM()").Limit(remaining).Find(&additionalSongs)
 			songs = append(songs, additionalSongs...)
 		}
 
@@ -278,12 +264,11 @@ func selectTournamentSongs(db *gorm.DB, userID uint, count int, categoryID *uint
 	}
 
 	// All songs (no ratio preference)
-	err := baseQuery.Order("RANDOM()").Limit(count).Find(&songs).Error
-	return songs, err
+	return store.RandomSongs(filter, count)
 }
 
 // generateTournamentTree creates the tournament bracket structure
-func generateTournamentTree(db *gorm.DB, songs []models.Song, treeSize int) models.TreeState {
+func generateTournamentTree(store database.Store, songs []models.Song, treeSize int) models.TreeState {
 	// Calculate number of rounds
 	numRounds := int(math.Log2(float64(treeSize)))
 
@@ -309,8 +294,10 @@ func generateTournamentTree(db *gorm.DB, songs []models.Song, treeSize int) mode
 		song2 := songs[i*2+1]
 
 		// Get average ratings from database
-		avgRating1 := getAverageSongRatingFromDB(db, song1.SongID)
-		avgRating2 := getAverageSongRatingFromDB(db, song2.SongID)
+		avgRating1 := getAverageSongRatingFromDB(store, song1.SongID)
+		avgRating2 := getAverageSongRatingFromDB(store, song2.SongID)
+		media1 := songMedia(&song1)
+		media2 := songMedia(&song2)
 
 		treeState.Rounds[0].Matches[i] = models.Match{
 			MatchID: fmt.Sprintf("r1m%d", i+1),
@@ -321,7 +308,8 @@ func generateTournamentTree(db *gorm.DB, songs []models.Song, treeSize int) mode
 				Artists:          formatArtistNames(song1.Artists),
 				ThumbnailURL:     song1.ThumbnailURL,
 				SourceURL:        song1.SourceURL,
-				EmbedURL:         getEmbedURL(song1.SourceURL),
+				EmbedURL:         media1.EmbedURL,
+				Provider:         media1.Provider,
 				AverageRating:    avgRating1,
 				CategoryName:     getCategoryName(song1.Category),
 				IsCover:          song1.IsCover,
@@ -333,7 +321,8 @@ func generateTournamentTree(db *gorm.DB, songs []models.Song, treeSize int) mode
 				Artists:          formatArtistNames(song2.Artists),
 				ThumbnailURL:     song2.ThumbnailURL,
 				SourceURL:        song2.SourceURL,
-				EmbedURL:         getEmbedURL(song2.SourceURL),
+				EmbedURL:         media2.EmbedURL,
+				Provider:         media2.Provider,
 				AverageRating:    avgRating2,
 				CategoryName:     getCategoryName(song2.Category),
 				IsCover:          song2.IsCover,
@@ -406,36 +395,19 @@ func formatArtistNames(artists []models.Artist) string {
 	return result
 }
 
-func getEmbedURL(sourceURL string) string {
-	if utils.IsYouTubeURL(sourceURL) {
-		if embedURL, err := utils.GetYouTubeEmbedURL(sourceURL); err == nil {
-			return embedURL
-		}
-	}
-	return ""
-}
-
 func getAverageSongRating(songID uint) float64 {
 	// This will be called during tree generation, but we don't have db access here
 	// The rating will be properly set during tree generation where we have db access
 	return 0.0
 }
 
-func getAverageSongRatingFromDB(db *gorm.DB, songID uint) float64 {
-	var avgRating struct {
-		Average float64
-	}
-
-	err := db.Table("votes").
-		Select("AVG(rating) as average").
-		Where("song_id = ?", songID).
-		Scan(&avgRating).Error
-
+func getAverageSongRatingFromDB(store database.Store, songID uint) float64 {
+	average, err := store.GetAverageRatingForSong(songID)
 	if err != nil {
 		return 0.0
 	}
 
-	return avgRating.Average
+	return average
 }
 
 func generateTournamentRoomCode() string {
@@ -449,21 +421,21 @@ func generateTournamentRoomCode() string {
 }
 
 // GetTournamentRoom shows the tournament room interface
-func GetTournamentRoom(db *gorm.DB) gin.HandlerFunc {
+func GetTournamentRoom(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roomID := c.Param("roomId")
 
 		// Check if user is authenticated
 		userID, exists := c.Get("user_id")
 		if !exists || userID == nil {
-			c.Redirect(http.StatusFound, "/login")
+			redirectToSignIn(c, store, models.RoomTypeTournament, roomID)
 			return
 		}
 
 		// Check if room exists in database
-		var room models.TournamentRoom
-		if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
+		room, err := store.GetTournamentRoom(roomID)
+		if err != nil {
+			if errors.Is(err, database.ErrNotFound) {
 				c.HTML(http.StatusNotFound, "error.html", gin.H{
 					"title": "SyncRate | Room Not Found",
 					"error": "Tournament room not found",
@@ -477,9 +449,14 @@ func GetTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Password-protected and invite-only rooms
+		if !guardRoomPage(c, store, models.RoomTypeTournament, roomID, userID.(uint)) {
+			return
+		}
+
 		templateData := GetUserContext(c)
 		templateData["title"] = fmt.Sprintf("SyncRate | Tournament %s", roomID)
-		templateData["room"] = room
+		templateData["room"] = *room
 		templateData["room_id"] = roomID
 
 		c.HTML(http.StatusOK, "tournament-room.html", templateData)
@@ -487,7 +464,7 @@ func GetTournamentRoom(db *gorm.DB) gin.HandlerFunc {
 }
 
 // GetTournamentRoomWS handles WebSocket connections for tournament rooms
-func GetTournamentRoomWS(db *gorm.DB) gin.HandlerFunc {
+func GetTournamentRoomWS(store database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roomID := c.Param("roomId")
 
@@ -510,24 +487,30 @@ func GetTournamentRoomWS(db *gorm.DB) gin.HandlerFunc {
 			log.Printf("WebSocket upgrade error: %v", err)
 			return
 		}
-		defer conn.Close()
 
-		// Join room
+		// Join room if the user may enter it
 		userIDStr := fmt.Sprintf("%d", userID.(uint))
-		if err := tournamentRoomManager.JoinRoom(roomID, userIDStr, usernameStr, conn); err != nil {
+		err = checkRoomJoin(store, models.RoomTypeTournament, roomID, userID.(uint), isGuest(c))
+		var client *wsocket.Client
+		if err == nil {
+			client, err = tournamentRoomManager.JoinRoom(roomID, userIDStr, usernameStr, conn)
+		}
+		if err != nil {
 			log.Printf("Error joining tournament room: %v", err)
 			conn.WriteJSON(map[string]interface{}{
 				"type":  "error",
 				"error": err.Error(),
 			})
+			conn.Close()
 			return
 		}
 
-		// Handle connection
-		handleTournamentConnection(db, roomID, userIDStr, conn)
+		// Handle connection; from here on only the client writes to conn
+		// and its writer closes it
+		handleTournamentConnection(store, roomID, userIDStr, client)
 
 		// Clean up when connection closes
-		tournamentRoomManager.LeaveRoom(userIDStr)
+		tournamentRoomManager.LeaveRoom(client.SessionID)
 
 		// Broadcast updated user list
 		broadcastTournamentUserUpdate(roomID)
@@ -535,9 +518,9 @@ func GetTournamentRoomWS(db *gorm.DB) gin.HandlerFunc {
 }
 
 // handleTournamentConnection manages the WebSocket connection for a tournament room
-func handleTournamentConnection(db *gorm.DB, roomID, userID string, conn *websocket.Conn) {
+func handleTournamentConnection(store database.Store, roomID, userID string, client *wsocket.Client) {
 	// Send initial tournament state
-	sendTournamentState(db, roomID, conn)
+	sendTournamentState(store, roomID, client)
 
 	// Broadcast user update to all participants
 	broadcastTournamentUserUpdate(roomID)
@@ -545,24 +528,24 @@ func handleTournamentConnection(db *gorm.DB, roomID, userID string, conn *websoc
 	// Listen for messages
 	for {
 		var msg wsocket.WSMessage
-		if err := conn.ReadJSON(&msg); err != nil {
+		if err := client.Conn.ReadJSON(&msg); err != nil {
 			log.Printf("WebSocket read error: %v", err)
 			break
 		}
 
-		handleTournamentMessage(db, roomID, userID, msg, conn)
+		handleTournamentMessage(store, roomID, userID, msg, client)
 	}
 }
 
 // sendTournamentState sends the current tournament state to a client
-func sendTournamentState(db *gorm.DB, roomID string, conn *websocket.Conn) {
-	var room models.TournamentRoom
-	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+func sendTournamentState(store database.Store, roomID string, client *wsocket.Client) {
+	room, err := store.GetTournamentRoom(roomID)
+	if err != nil {
 		return
 	}
 
 	// Load existing votes for all tournament songs
-	existingVotes := loadExistingVotesForTournament(db, &room.TreeState)
+	existingVotes := loadExistingVotesForTournament(store, &room.TreeState)
 
 	// Send tournament state
 	stateData, _ := json.Marshal(map[string]interface{}{
@@ -579,58 +562,66 @@ func sendTournamentState(db *gorm.DB, roomID string, conn *websocket.Conn) {
 		Timestamp: time.Now(),
 	}
 
-	conn.WriteJSON(message)
+	client.SendJSON(message)
 }
 
 // handleTournamentMessage processes incoming WebSocket messages
-func handleTournamentMessage(db *gorm.DB, roomID, userID string, msg wsocket.WSMessage, conn *websocket.Conn) {
+func handleTournamentMessage(store database.Store, roomID, userID string, msg wsocket.WSMessage, client *wsocket.Client) {
+	// Check the sender's role before acting on the message
+	if !authorizeMessage(tournamentRoomManager, client, msg, tournamentRoomPermissions) {
+		return
+	}
+
 	// Update last_active timestamp
-	db.Model(&models.TournamentRoom{}).
-		Where("room_id = ?", roomID).
-		Update("last_active", time.Now())
+	if err := store.TouchTournamentRoom(roomID); err != nil {
+		log.Printf("handleTournamentMessage: %v", err)
+	}
 
 	switch msg.Type {
-	case "start_tournament":
-		handleStartTournament(db, roomID)
-	case "start_match":
-		handleStartMatch(db, roomID, msg.Data)
-	case "pick_winner":
-		handlePickWinner(db, roomID, userID, msg.Data)
-	case "navigate_match":
+	case wsocket.MsgStartTournament:
+		handleStartTournament(store, roomID)
+	case wsocket.MsgStartMatch:
+		handleStartMatch(store, roomID, msg.Data)
+	case wsocket.MsgPickWinner:
+		handlePickWinner(store, roomID, userID, msg.Data)
+	case wsocket.MsgNavigateMatch:
 		// Broadcast match navigation to all clients for synchronized navigation
 		tournamentRoomManager.BroadcastToRoom(roomID, msg)
 	case wsocket.MsgVideoSync:
+		recordVideoSync(tournamentRoomManager, roomID, msg.Data)
 		tournamentRoomManager.BroadcastToRoom(roomID, msg)
 	case wsocket.MsgVoteUpdate:
-		handleTournamentVoteUpdate(db, roomID, userID, msg.Data)
+		handleTournamentVoteUpdate(store, roomID, userID, msg.Data)
+	case wsocket.MsgSetRole, wsocket.MsgKickUser, wsocket.MsgBanUser, wsocket.MsgUnbanUser, wsocket.MsgTransferHost:
+		handleModeration(store, tournamentRoomManager, models.RoomTypeTournament, client, msg)
 	default:
 		log.Printf("Unknown tournament message type: %s", msg.Type)
 	}
 }
 
-func handleStartTournament(db *gorm.DB, roomID string) {
+func handleStartTournament(store database.Store, roomID string) {
+	room, err := store.GetTournamentRoom(roomID)
+	if err != nil {
+		log.Printf("Error finding tournament room: %v", err)
+		return
+	}
+
 	// Set status to in_progress and set first match as current
 	firstMatchID := "r1m1"
+	room.Status = "in_progress"
+	room.CurrentMatchID = &firstMatchID
 
-	err := db.Model(&models.TournamentRoom{}).
-		Where("room_id = ?", roomID).
-		Updates(map[string]interface{}{
-			"status":           "in_progress",
-			"current_match_id": firstMatchID,
-			"last_active":      time.Now(),
-		}).Error
-
-	if err != nil {
+	if err := store.UpdateTournamentRoom(room); err != nil {
 		log.Printf("Error starting tournament: %v", err)
 		return
 	}
 
 	// Broadcast updated state (clients will auto-open first match on status change)
-	broadcastTournamentState(db, roomID)
+	broadcastTournamentState(store, roomID)
 	log.Printf("Tournament started in room %s, broadcasting state update", roomID)
 }
 
-func handleStartMatch(db *gorm.DB, roomID string, data json.RawMessage) {
+func handleStartMatch(store database.Store, roomID string, data json.RawMessage) {
 	var matchData struct {
 		MatchID string `json:"match_id"`
 	}
@@ -640,18 +631,23 @@ func handleStartMatch(db *gorm.DB, roomID string, data json.RawMessage) {
 		return
 	}
 
+	room, err := store.GetTournamentRoom(roomID)
+	if err != nil {
+		log.Printf("Error finding tournament room: %v", err)
+		return
+	}
+
 	// Update current match
-	db.Model(&models.TournamentRoom{}).
-		Where("room_id = ?", roomID).
-		Updates(map[string]interface{}{
-			"current_match_id": matchData.MatchID,
-			"last_active":      time.Now(),
-		})
+	room.CurrentMatchID = &matchData.MatchID
+	if err := store.UpdateTournamentRoom(room); err != nil {
+		log.Printf("Error updating current match: %v", err)
+		return
+	}
 
-	broadcastTournamentState(db, roomID)
+	broadcastTournamentState(store, roomID)
 }
 
-func handlePickWinner(db *gorm.DB, roomID string, userID string, data json.RawMessage) {
+func handlePickWinner(store database.Store, roomID string, userID string, data json.RawMessage) {
 	var pickData struct {
 		MatchID string `json:"match_id"`
 		SongID  uint   `json:"song_id"`
@@ -663,8 +659,8 @@ func handlePickWinner(db *gorm.DB, roomID string, userID string, data json.RawMe
 	}
 
 	// Get the tournament room
-	var room models.TournamentRoom
-	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+	room, err := store.GetTournamentRoom(roomID)
+	if err != nil {
 		log.Printf("Error finding tournament room: %v", err)
 		return
 	}
@@ -682,14 +678,18 @@ func handlePickWinner(db *gorm.DB, roomID string, userID string, data json.RawMe
 		return
 	}
 
-	tournRoom.Mutex.RLock()
-	client, exists := tournRoom.Clients[userID]
+	// Every user picks once, however many tabs or devices they have open;
+	// spectators don't pick
 	username := ""
-	if exists {
-		username = client.Username
+	totalUsers := 0
+	for _, user := range tournRoom.Users() {
+		if user.ID == userID {
+			username = user.Username
+		}
+		if canParticipate(user) {
+			totalUsers++
+		}
 	}
-	totalUsers := len(tournRoom.Clients)
-	tournRoom.Mutex.RUnlock()
 
 	// Add or update user's pick
 	pickedSongID := pickData.SongID
@@ -716,14 +716,14 @@ func handlePickWinner(db *gorm.DB, roomID string, userID string, data json.RawMe
 	if len(match.UserPicks) >= totalUsers {
 		// Update average ratings with current values from database before determining winner
 		if match.Song1 != nil && match.Song1.SongID != nil {
-			match.Song1.AverageRating = getAverageSongRatingFromDB(db, *match.Song1.SongID)
+			match.Song1.AverageRating = getAverageSongRatingFromDB(store, *match.Song1.SongID)
 		}
 		if match.Song2 != nil && match.Song2.SongID != nil {
-			match.Song2.AverageRating = getAverageSongRatingFromDB(db, *match.Song2.SongID)
+			match.Song2.AverageRating = getAverageSongRatingFromDB(store, *match.Song2.SongID)
 		}
 
-		// Determine winner (pass db to recalculate ratings)
-		winner := determineMatchWinner(db, match)
+		// Determine winner (pass store to recalculate ratings)
+		winner := determineMatchWinner(store, match)
 		match.Winner = winner
 		match.Status = "completed"
 		now := time.Now()
@@ -734,15 +734,13 @@ func handlePickWinner(db *gorm.DB, roomID string, userID string, data json.RawMe
 	}
 
 	// Save updated tree state
-	db.Model(&models.TournamentRoom{}).
-		Where("room_id = ?", roomID).
-		Updates(map[string]interface{}{
-			"tree_state":  room.TreeState,
-			"last_active": time.Now(),
-		})
+	if err := store.UpdateTournamentRoom(room); err != nil {
+		log.Printf("Error saving tournament tree: %v", err)
+		return
+	}
 
 	// Broadcast updated state
-	broadcastTournamentState(db, roomID)
+	broadcastTournamentState(store, roomID)
 }
 
 func findMatchInTree(tree *models.TreeState, matchID string) *models.Match {
@@ -756,7 +754,7 @@ func findMatchInTree(tree *models.TreeState, matchID string) *models.Match {
 	return nil
 }
 
-func determineMatchWinner(db *gorm.DB, match *models.Match) *models.MatchSong {
+func determineMatchWinner(store database.Store, match *models.Match) *models.MatchSong {
 	// Count picks for each song
 	song1Picks := 0
 	song2Picks := 0
@@ -781,10 +779,10 @@ func determineMatchWinner(db *gorm.DB, match *models.Match) *models.MatchSong {
 	// Tie: recalculate average ratings from database to get latest votes
 	var currentRating1, currentRating2 float64
 	if match.Song1 != nil && match.Song1.SongID != nil {
-		currentRating1 = getAverageSongRatingFromDB(db, *match.Song1.SongID)
+		currentRating1 = getAverageSongRatingFromDB(store, *match.Song1.SongID)
 	}
 	if match.Song2 != nil && match.Song2.SongID != nil {
-		currentRating2 = getAverageSongRatingFromDB(db, *match.Song2.SongID)
+		currentRating2 = getAverageSongRatingFromDB(store, *match.Song2.SongID)
 	}
 
 	if currentRating1 > currentRating2 {
@@ -829,14 +827,14 @@ func advanceWinner(tree *models.TreeState, completedMatchID string, winner *mode
 	}
 }
 
-func broadcastTournamentState(db *gorm.DB, roomID string) {
-	var room models.TournamentRoom
-	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+func broadcastTournamentState(store database.Store, roomID string) {
+	room, err := store.GetTournamentRoom(roomID)
+	if err != nil {
 		return
 	}
 
 	// Load existing votes for all tournament songs
-	existingVotes := loadExistingVotesForTournament(db, &room.TreeState)
+	existingVotes := loadExistingVotesForTournament(store, &room.TreeState)
 
 	stateData, _ := json.Marshal(map[string]interface{}{
 		"tree_state":         room.TreeState,
@@ -855,7 +853,7 @@ func broadcastTournamentState(db *gorm.DB, roomID string) {
 	tournamentRoomManager.BroadcastToRoom(roomID, message)
 }
 
-func handleTournamentVoteUpdate(db *gorm.DB, roomID, userID string, data json.RawMessage) {
+func handleTournamentVoteUpdate(store database.Store, roomID, userID string, data json.RawMessage) {
 	// Broadcast vote update for rating songs during matches
 	tournamentRoomManager.BroadcastToRoom(roomID, wsocket.WSMessage{
 		Type:      wsocket.MsgVoteUpdate,
@@ -870,17 +868,7 @@ func broadcastTournamentUserUpdate(roomID string) {
 		return
 	}
 
-	room.Mutex.RLock()
-	users := make([]wsocket.UserInfo, 0, len(room.Clients))
-	for _, client := range room.Clients {
-		users = append(users, wsocket.UserInfo{
-			ID:       client.ID,
-			Username: client.Username,
-		})
-	}
-	room.Mutex.RUnlock()
-
-	data, _ := json.Marshal(wsocket.UserUpdateData{Users: users})
+	data, _ := json.Marshal(wsocket.UserUpdateData{Users: room.Users()})
 	message := wsocket.WSMessage{
 		Type:      wsocket.MsgUserUpdate,
 		Data:      data,
@@ -891,7 +879,7 @@ func broadcastTournamentUserUpdate(roomID string) {
 }
 
 // loadExistingVotesForTournament loads existing votes for all songs in the tournament
-func loadExistingVotesForTournament(db *gorm.DB, treeState *models.TreeState) map[uint][]wsocket.VoteUpdateData {
+func loadExistingVotesForTournament(store database.Store, treeState *models.TreeState) map[uint][]wsocket.VoteUpdateData {
 	if treeState == nil {
 		return make(map[uint][]wsocket.VoteUpdateData)
 	}
@@ -921,30 +909,18 @@ func loadExistingVotesForTournament(db *gorm.DB, treeState *models.TreeState) ma
 		return result
 	}
 
-	// Load all votes for these songs
-	var votes []models.Vote
-	db.Where("song_id IN ?", songIDs).Find(&votes)
-
-	// Get usernames for the votes
-	userIDs := make([]uint, 0, len(votes))
-	for _, vote := range votes {
-		userIDs = append(userIDs, vote.UserID)
-	}
-
-	usernames := make(map[uint]string)
-	if len(userIDs) > 0 {
-		var users []models.User
-		db.Where("user_id IN ?", userIDs).Find(&users)
-		for _, user := range users {
-			usernames[user.UserID] = user.Username
-		}
+	// Load all votes for these songs along with their authors
+	votes, err := store.GetVotesWithUsers(database.VoteFilter{SongIDs: songIDs})
+	if err != nil {
+		log.Printf("loadExistingVotesForTournament: %v", err)
+		return result
 	}
 
 	// Group votes by song ID
 	for _, vote := range votes {
 		voteData := wsocket.VoteUpdateData{
 			UserID:   fmt.Sprintf("%d", vote.UserID),
-			Username: usernames[vote.UserID],
+			Username: voteAuthor(vote),
 			Rating:   vote.Rating,
 			Comment:  vote.Comment,
 		}
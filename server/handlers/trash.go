@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTrashRetention is how long deleted catalog entities stay in the
+// trash unless TRASH_RETENTION_DAYS says otherwise
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// trashRetention is how long entities stay in the trash; 0 keeps them until
+// they are purged by hand
+var trashRetention = DefaultTrashRetention
+
+// StartTrashPurge starts a background routine that purges entities that
+// have been in the trash for longer than retention. A retention of 0 keeps
+// them until they are purged by hand.
+func StartTrashPurge(store database.Store, retention time.Duration) {
+	trashRetention = retention
+	if retention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				purgeExpiredTrash(store, retention)
+			}
+		}
+	}()
+}
+
+// purgeExpiredTrash purges entities that went to the trash before retention
+func purgeExpiredTrash(store database.Store, retention time.Duration) {
+	purged, err := store.PurgeTrash(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("Error purging the trash: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d entities from the trash (deleted more than %v ago)", purged, retention)
+	}
+}
+
+// trashRow is an entity in the trash as the trash view shows it
+type trashRow struct {
+	database.TrashedEntity
+	PurgeAt time.Time // Zero when the trash is not purged automatically
+}
+
+// renderAdminTrash shows the trash with an optional error
+func renderAdminTrash(c *gin.Context, store database.Store, status int, message string) {
+	templateData := GetUserContext(c)
+	templateData["title"] = "SyncRate | Trash"
+	templateData["entityType"] = c.Query("entity_type")
+	templateData["entityTypes"] = database.TrashTypes
+	templateData["retentionDays"] = int(trashRetention / (24 * time.Hour))
+	if message != "" {
+		templateData["error"] = message
+	}
+
+	trashed, err := store.ListTrash(c.Query("entity_type"))
+	if err != nil {
+		log.Printf("renderAdminTrash: %v", err)
+		templateData["error"] = "Failed to load the trash: " + err.Error()
+		status = storeErrorStatus(err)
+	}
+	rows := make([]trashRow, len(trashed))
+	for i, item := range trashed {
+		rows[i] = trashRow{TrashedEntity: item}
+		if trashRetention > 0 {
+			rows[i].PurgeAt = item.DeletedAt.Add(trashRetention)
+		}
+	}
+	templateData["items"] = rows
+	c.HTML(status, "admin-trash.html", templateData)
+}
+
+// GetAdminTrash lists the deleted songs, artists, units, albums and
+// categories, newest first. It can be filtered by entity_type.
+func GetAdminTrash(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderAdminTrash(c, store, http.StatusOK, "")
+	}
+}
+
+// parseTrashEntity reads the entity type and ID of a trash route
+func parseTrashEntity(c *gin.Context) (string, uint, bool) {
+	entityType := c.Param("type")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || !slices.Contains(database.TrashTypes, entityType) {
+		return "", 0, false
+	}
+	return entityType, uint(id), true
+}
+
+// findTrashed looks up an entity in the trash, for the audit log
+func findTrashed(store database.Store, entityType string, id uint) (*database.TrashedEntity, error) {
+	trashed, err := store.ListTrash(entityType)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range trashed {
+		if item.EntityID == id {
+			return &item, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
+
+// changeTrash runs a restore or purge of a trashed entity together with
+// its audit event, then shows the trash again
+func changeTrash(c *gin.Context, store database.Store, action string, change func(tx database.Store, entityType string, id uint) error) {
+	entityType, id, ok := parseTrashEntity(c)
+	if !ok {
+		renderAdminTrash(c, store, http.StatusBadRequest, "Invalid trash entry")
+		return
+	}
+
+	err := store.Transaction(func(tx database.Store) error {
+		item, err := findTrashed(tx, entityType, id)
+		if err != nil {
+			return err
+		}
+		if err := change(tx, entityType, id); err != nil {
+			return err
+		}
+		snapshot := gin.H{"Name": item.Name, "DeletedAt": item.DeletedAt}
+		var event models.AuditEvent
+		if action == models.AuditRestore {
+			event = newAuditEvent(c, action, entityType, id, nil, snapshot)
+		} else {
+			event = newAuditEvent(c, action, entityType, id, snapshot, nil)
+		}
+		return tx.RecordAuditEvent(&event)
+	})
+	if err != nil {
+		log.Printf("changeTrash: %s %s %d: %v", action, entityType, id, err)
+		message := "Failed to " + action + " " + entityType
+		if errors.Is(err, database.ErrValidation) || errors.Is(err, database.ErrNotFound) {
+			message += ": " + err.Error()
+		}
+		renderAdminTrash(c, store, storeErrorStatus(err), message)
+		return
+	}
+
+	log.Printf("changeTrash: %s %s %d", action, entityType, id)
+	c.Redirect(http.StatusSeeOther, "/admin/trash?entity_type="+url.QueryEscape(c.Query("entity_type")))
+}
+
+// PostRestoreTrashed takes an entity out of the trash with its links and,
+// for songs, its votes
+func PostRestoreTrashed(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeTrash(c, store, models.AuditRestore, func(tx database.Store, entityType string, id uint) error {
+			return tx.RestoreFromTrash(entityType, id)
+		})
+	}
+}
+
+// PostPurgeTrashed deletes an entity in the trash for good. The audit log
+// keeps the snapshot taken when it was deleted.
+func PostPurgeTrashed(store database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		changeTrash(c, store, models.AuditPurge, func(tx database.Store, entityType string, id uint) error {
+			return tx.PurgeFromTrash(entityType, id)
+		})
+	}
+}
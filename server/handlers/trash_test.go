@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+)
+
+func TestTrashSongLifecycle(t *testing.T) {
+	store := memory.New()
+	curator := &models.User{Username: "curator", Role: models.RoleCurator}
+	if err := store.CreateUser(curator); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	voter := createTestUser(t, store, "voter")
+	artist := createTestArtist(t, store, "Aqours")
+	song := createTestSong(t, store, "Aozora", artist)
+	if err := store.UpsertVote(&models.Vote{UserID: voter.UserID, SongID: song.SongID, Rating: 8}); err != nil {
+		t.Fatalf("UpsertVote: %v", err)
+	}
+
+	r := newTestRouter(t, curator)
+	r.POST("/admin/songs/:id/delete", PostDeleteSong(store))
+	r.POST("/admin/trash/:type/:id/restore", PostRestoreTrashed(store))
+	r.POST("/admin/trash/:type/:id/purge", PostPurgeTrashed(store))
+	post := func(target string, want int) {
+		t.Helper()
+		if w := serveForm(r, http.MethodPost, target, nil); w.Code != want {
+			t.Fatalf("POST %s = %d; want %d", target, w.Code, want)
+		}
+	}
+	votes := func() int {
+		t.Helper()
+		votes, err := store.GetVotesByUser(voter.UserID)
+		if err != nil {
+			t.Fatalf("GetVotesByUser: %v", err)
+		}
+		return len(votes)
+	}
+	inTrash := func() bool {
+		t.Helper()
+		trashed, err := store.ListTrash(database.TrashSong)
+		if err != nil {
+			t.Fatalf("ListTrash: %v", err)
+		}
+		return len(trashed) == 1 && trashed[0].EntityID == song.SongID
+	}
+	deletePath := fmt.Sprintf("/admin/songs/%d/delete", song.SongID)
+	restorePath := fmt.Sprintf("/admin/trash/song/%d/restore", song.SongID)
+	purgePath := fmt.Sprintf("/admin/trash/song/%d/purge", song.SongID)
+
+	// Deleting moves the song to the trash and hides its votes
+	post(deletePath, http.StatusSeeOther)
+	if _, err := store.GetSongByID(song.SongID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetSongByID of a trashed song = %v; want ErrNotFound", err)
+	}
+	if !inTrash() {
+		t.Error("deleted song is not in the trash")
+	}
+	if n := votes(); n != 0 {
+		t.Errorf("voter sees %d votes on a trashed song; want 0", n)
+	}
+
+	// Restoring brings back the song with its links and votes
+	post(restorePath, http.StatusSeeOther)
+	restored, err := store.GetSongByID(song.SongID)
+	if err != nil {
+		t.Fatalf("GetSongByID after restore: %v", err)
+	}
+	if len(restored.Artists) != 1 || restored.Artists[0].ArtistID != artist.ArtistID {
+		t.Errorf("restored song artists = %v; want %s", restored.Artists, artist.NameOriginal)
+	}
+	if n := votes(); n != 1 {
+		t.Errorf("voter has %d votes after the restore; want 1", n)
+	}
+	if event := lastAuditEvent(t, store); event.Action != models.AuditRestore || event.EntityID != fmt.Sprint(song.SongID) {
+		t.Errorf("audit event = %s %s; want a restore of the song", event.Action, event.EntityID)
+	}
+	if inTrash() {
+		t.Error("restored song is still in the trash")
+	}
+
+	// Purging deletes the song and its votes for good
+	post(deletePath, http.StatusSeeOther)
+	post(purgePath, http.StatusSeeOther)
+	if inTrash() {
+		t.Error("purged song is still in the trash")
+	}
+	if _, err := store.GetSongByID(song.SongID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetSongByID of a purged song = %v; want ErrNotFound", err)
+	}
+	if n := votes(); n != 0 {
+		t.Errorf("voter has %d votes on a purged song; want 0", n)
+	}
+	if event := lastAuditEvent(t, store); event.Action != models.AuditPurge || event.EntityID != fmt.Sprint(song.SongID) {
+		t.Errorf("audit event = %s %s; want a purge of the song", event.Action, event.EntityID)
+	}
+
+	// Nothing is left to restore, and unknown entries are turned down
+	post(restorePath, http.StatusNotFound)
+	post(fmt.Sprintf("/admin/trash/planet/%d/restore", song.SongID), http.StatusBadRequest)
+}
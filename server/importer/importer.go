@@ -0,0 +1,439 @@
+// Package importer adds songs to the catalog in bulk from CSV and JSON files.
+// Artists, units, albums and categories are matched by name and created when
+// missing. Songs already in the catalog are found by source URL.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/utils"
+)
+
+// Action is what an import did, or would do in a dry run, with a row
+type Action string
+
+const (
+	ActionCreate    Action = "create"    // New song
+	ActionUpdate    Action = "update"    // Existing song changed
+	ActionUnchanged Action = "unchanged" // Existing song already matches
+	ActionConflict  Action = "conflict"  // Row skipped, see RowReport.Message
+	ActionError     Action = "error"     // Row invalid; nothing is imported
+)
+
+// Options control an import
+type Options struct {
+	// DryRun builds the report and rolls everything back
+	DryRun bool
+	// Update changes existing songs that differ from their row. Without it
+	// such rows are conflicts.
+	Update bool
+}
+
+// RowReport is the outcome of one row
+type RowReport struct {
+	Row       int      `json:"row"`
+	SourceURL string   `json:"source_url"`
+	Name      string   `json:"name"`
+	Action    Action   `json:"action"`
+	SongID    uint     `json:"song_id,omitempty"`
+	Changes   []string `json:"changes,omitempty"` // Fields an update changes or a conflict differs in
+	Created   []string `json:"created,omitempty"` // Artists, units, albums and categories created for the row
+	Message   string   `json:"message,omitempty"`
+}
+
+// Report is the row-by-row outcome of an import
+type Report struct {
+	DryRun    bool           `json:"dry_run"`
+	Committed bool           `json:"committed"` // False for dry runs and imports with errors
+	Counts    map[Action]int `json:"counts"`
+	Rows      []RowReport    `json:"rows"`
+}
+
+// errRollback ends the transaction of dry runs and imports with row errors
+var errRollback = errors.New("import rolled back")
+
+// Import adds or updates the songs of records in one transaction. Rows with
+// errors roll back the whole import; conflicts are skipped. The returned error
+// is set only if the import failed as a whole, e.g. the database went away.
+func Import(store database.Store, records []Record, opts Options) (*Report, error) {
+	report := &Report{DryRun: opts.DryRun, Counts: make(map[Action]int)}
+
+	err := store.Transaction(func(tx database.Store) error {
+		imp, err := newImporter(tx, opts)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			row, err := imp.importRecord(record)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", record.Row, err)
+			}
+			report.Rows = append(report.Rows, row)
+			report.Counts[row.Action]++
+		}
+
+		if opts.DryRun || report.Counts[ActionError] > 0 {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, fmt.Errorf("failed to import songs: %w", err)
+	}
+	report.Committed = err == nil
+	return report, nil
+}
+
+// nameIndex finds IDs by case-insensitive original or English name
+type nameIndex map[string]uint
+
+func (idx nameIndex) add(id uint, names ...string) {
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, taken := idx[key]; key != "" && !taken {
+			idx[key] = id
+		}
+	}
+}
+
+func (idx nameIndex) find(name string) (uint, bool) {
+	id, ok := idx[strings.ToLower(strings.TrimSpace(name))]
+	return id, ok
+}
+
+type importer struct {
+	store database.Store
+	opts  Options
+
+	categories nameIndex
+	artists    nameIndex
+	units      nameIndex
+	albums     nameIndex
+
+	// seen maps source URLs to the row that imported them
+	seen map[string]int
+}
+
+func newImporter(store database.Store, opts Options) (*importer, error) {
+	imp := &importer{
+		store:      store,
+		opts:       opts,
+		categories: make(nameIndex),
+		artists:    make(nameIndex),
+		units:      make(nameIndex),
+		albums:     make(nameIndex),
+		seen:       make(map[string]int),
+	}
+
+	categories, err := store.GetAllCategories()
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		imp.categories.add(category.CategoryID, category.Name)
+	}
+	artists, err := store.GetAllArtists()
+	if err != nil {
+		return nil, err
+	}
+	for _, artist := range artists {
+		imp.artists.add(artist.ArtistID, artist.NameOriginal, artist.NameEnglish)
+	}
+	units, err := store.GetAllUnits()
+	if err != nil {
+		return nil, err
+	}
+	for _, unit := range units {
+		imp.units.add(unit.UnitID, unit.NameOriginal, unit.NameEnglish)
+	}
+	albums, err := store.GetAllAlbums()
+	if err != nil {
+		return nil, err
+	}
+	for _, album := range albums {
+		imp.albums.add(album.AlbumID, album.NameOriginal, album.NameEnglish)
+	}
+	return imp, nil
+}
+
+// importRecord imports one row. Problems with the row are reported on it;
+// the error is set only for failures that should end the import.
+func (imp *importer) importRecord(record Record) (RowReport, error) {
+	row := RowReport{Row: record.Row, SourceURL: record.SourceURL, Name: record.NameOriginal}
+	fail := func(action Action, format string, args ...any) (RowReport, error) {
+		row.Action = action
+		row.Message = fmt.Sprintf(format, args...)
+		return row, nil
+	}
+
+	if record.Problem != "" {
+		return fail(ActionError, "%s", record.Problem)
+	}
+	if record.SourceURL == "" {
+		return fail(ActionError, "source_url is required")
+	}
+	if first, ok := imp.seen[record.SourceURL]; ok {
+		return fail(ActionConflict, "same source URL as row %d", first)
+	}
+	imp.seen[record.SourceURL] = record.Row
+
+	media, err := utils.ResolveMedia(record.SourceURL)
+	if err != nil {
+		return fail(ActionError, "%v", err)
+	}
+
+	existing, err := imp.store.GetSongsBySourceURL(record.SourceURL)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return imp.createSong(record, media, row)
+	case err != nil:
+		return row, err
+	}
+
+	row.SongID = existing.SongID
+	if row.Name == "" {
+		row.Name = existing.NameOriginal
+	}
+	row.Changes = changes(existing, record)
+	switch {
+	case len(row.Changes) == 0:
+		row.Action = ActionUnchanged
+		return row, nil
+	case !imp.opts.Update:
+		return fail(ActionConflict, "song %d already has this source URL with different details", existing.SongID)
+	}
+	return imp.updateSong(existing, record, row)
+}
+
+func (imp *importer) createSong(record Record, media *utils.Media, row RowReport) (RowReport, error) {
+	song := models.Song{
+		NameOriginal: record.NameOriginal,
+		NameEnglish:  record.NameEnglish,
+		SourceURL:    record.SourceURL,
+		Provider:     media.Provider,
+		ProviderID:   media.ID,
+		ThumbnailURL: record.ThumbnailURL,
+		Duration:     record.Duration,
+		IsCover:      record.IsCover != nil && *record.IsCover,
+	}
+	if song.NameOriginal == "" {
+		row.Action, row.Message = ActionError, "name_original is required for new songs"
+		return row, nil
+	}
+	if song.ThumbnailURL == "" {
+		if provider, ok := utils.MediaProviderByName(media.Provider); ok {
+			song.ThumbnailURL, _ = provider.ThumbnailURL(media.ID)
+		}
+		if song.ThumbnailURL == "" {
+			row.Action, row.Message = ActionError, "thumbnail_url is required for "+media.Provider+" songs"
+			return row, nil
+		}
+	}
+
+	if err := imp.resolveRelations(&song, record, &row); err != nil {
+		return rowError(row, err)
+	}
+	if err := imp.store.CreateSong(&song); err != nil {
+		return rowError(row, err)
+	}
+	row.Action = ActionCreate
+	row.SongID = song.SongID
+	return row, nil
+}
+
+func (imp *importer) updateSong(song *models.Song, record Record, row RowReport) (RowReport, error) {
+	if record.NameOriginal != "" {
+		song.NameOriginal = record.NameOriginal
+	}
+	if record.NameEnglish != "" {
+		song.NameEnglish = record.NameEnglish
+	}
+	if record.ThumbnailURL != "" {
+		song.ThumbnailURL = record.ThumbnailURL
+	}
+	if record.Duration > 0 {
+		song.Duration = record.Duration
+	}
+	if record.IsCover != nil {
+		song.IsCover = *record.IsCover
+	}
+
+	// Relations are added to the song's existing ones
+	if err := imp.resolveRelations(song, record, &row); err != nil {
+		return rowError(row, err)
+	}
+	if err := imp.store.UpdateSong(song); err != nil {
+		return rowError(row, err)
+	}
+	row.Action = ActionUpdate
+	return row, nil
+}
+
+// rowError reports validation errors on the row and passes on the rest
+func rowError(row RowReport, err error) (RowReport, error) {
+	if !errors.Is(err, database.ErrValidation) {
+		return row, err
+	}
+	row.Action = ActionError
+	row.Message = err.Error()
+	return row, nil
+}
+
+// resolveRelations sets the song's category and adds the record's artists,
+// units and albums, creating those that do not exist yet
+func (imp *importer) resolveRelations(song *models.Song, record Record, row *RowReport) error {
+	if record.Category != "" {
+		id, err := imp.findOrCreate(imp.categories, "category", record.Category, row, func() (uint, error) {
+			category := models.Category{Name: record.Category}
+			err := imp.store.CreateCategory(&category)
+			return category.CategoryID, err
+		})
+		if err != nil {
+			return err
+		}
+		song.CategoryID = &id
+		song.Category = nil
+	}
+
+	artistIDs, err := imp.findOrCreateAll(imp.artists, "artist", record.Artists, row, func(name string) (uint, error) {
+		artist := models.Artist{NameOriginal: name}
+		err := imp.store.CreateArtist(&artist)
+		return artist.ArtistID, err
+	})
+	if err != nil {
+		return err
+	}
+	unitIDs, err := imp.findOrCreateAll(imp.units, "unit", record.Units, row, func(name string) (uint, error) {
+		unit := models.Unit{NameOriginal: name}
+		err := imp.store.CreateUnit(&unit)
+		return unit.UnitID, err
+	})
+	if err != nil {
+		return err
+	}
+	albumType := record.AlbumType
+	if albumType == "" {
+		albumType = albumTypes[0]
+	}
+	albumIDs, err := imp.findOrCreateAll(imp.albums, "album", record.Albums, row, func(name string) (uint, error) {
+		album := models.Album{NameOriginal: name, Type: albumType}
+		err := imp.store.CreateAlbum(&album)
+		return album.AlbumID, err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, artist := range song.Artists {
+		artistIDs = slices.DeleteFunc(artistIDs, func(id uint) bool { return id == artist.ArtistID })
+	}
+	for _, unit := range song.Units {
+		unitIDs = slices.DeleteFunc(unitIDs, func(id uint) bool { return id == unit.UnitID })
+	}
+	for _, album := range song.Albums {
+		albumIDs = slices.DeleteFunc(albumIDs, func(id uint) bool { return id == album.AlbumID })
+	}
+
+	artists, err := imp.store.GetArtistsByIDs(artistIDs)
+	if err != nil {
+		return err
+	}
+	units, err := imp.store.GetUnitsByIDs(unitIDs)
+	if err != nil {
+		return err
+	}
+	albums, err := imp.store.GetAlbumsByIDs(albumIDs)
+	if err != nil {
+		return err
+	}
+	song.Artists = append(song.Artists, artists...)
+	song.Units = append(song.Units, units...)
+	song.Albums = append(song.Albums, albums...)
+	return nil
+}
+
+func (imp *importer) findOrCreateAll(idx nameIndex, kind string, names []string, row *RowReport, create func(name string) (uint, error)) ([]uint, error) {
+	var ids []uint
+	for _, name := range names {
+		id, err := imp.findOrCreate(idx, kind, name, row, func() (uint, error) { return create(name) })
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (imp *importer) findOrCreate(idx nameIndex, kind, name string, row *RowReport, create func() (uint, error)) (uint, error) {
+	if id, ok := idx.find(name); ok {
+		return id, nil
+	}
+	id, err := create()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s %q: %w", kind, name, err)
+	}
+	idx.add(id, name)
+	row.Created = append(row.Created, kind+" "+name)
+	return id, nil
+}
+
+// changes lists what a record would change on an existing song
+func changes(song *models.Song, record Record) []string {
+	var changed []string
+	if record.NameOriginal != "" && record.NameOriginal != song.NameOriginal {
+		changed = append(changed, "name_original")
+	}
+	if record.NameEnglish != "" && record.NameEnglish != song.NameEnglish {
+		changed = append(changed, "name_english")
+	}
+	if record.ThumbnailURL != "" && record.ThumbnailURL != song.ThumbnailURL {
+		changed = append(changed, "thumbnail_url")
+	}
+	if record.Duration > 0 && record.Duration != song.Duration {
+		changed = append(changed, "duration")
+	}
+	if record.IsCover != nil && *record.IsCover != song.IsCover {
+		changed = append(changed, "is_cover")
+	}
+	if record.Category != "" && (song.Category == nil || !strings.EqualFold(song.Category.Name, record.Category)) {
+		changed = append(changed, "category")
+	}
+
+	var artistNames, unitNames, albumNames []string
+	for _, artist := range song.Artists {
+		artistNames = append(artistNames, artist.NameOriginal, artist.NameEnglish)
+	}
+	for _, unit := range song.Units {
+		unitNames = append(unitNames, unit.NameOriginal, unit.NameEnglish)
+	}
+	for _, album := range song.Albums {
+		albumNames = append(albumNames, album.NameOriginal, album.NameEnglish)
+	}
+	if hasNewNames(record.Artists, artistNames) {
+		changed = append(changed, "artists")
+	}
+	if hasNewNames(record.Units, unitNames) {
+		changed = append(changed, "units")
+	}
+	if hasNewNames(record.Albums, albumNames) {
+		changed = append(changed, "albums")
+	}
+	return changed
+}
+
+// hasNewNames reports whether names has one that is not in existing
+func hasNewNames(names, existing []string) bool {
+	for _, name := range names {
+		if !slices.ContainsFunc(existing, func(e string) bool { return strings.EqualFold(e, name) }) {
+			return true
+		}
+	}
+	return false
+}
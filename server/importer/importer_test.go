@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database/memory"
+)
+
+func parseCSVString(t *testing.T, data string) []Record {
+	t.Helper()
+	records, err := Parse(strings.NewReader(data), FormatCSV)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return records
+}
+
+func TestImportCreatesAlbums(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		store := memory.New()
+		records := parseCSVString(t, `source_url,name_original,artists,albums
+https://www.youtube.com/watch?v=dQw4w9WgXcQ,First Song,Some Artist,New Album
+`)
+
+		report, err := Import(store, records, Options{DryRun: dryRun})
+		if err != nil {
+			t.Fatalf("dry run %v: Import: %v", dryRun, err)
+		}
+		if report.Counts[ActionCreate] != 1 || report.Counts[ActionError] != 0 {
+			t.Fatalf("dry run %v: rows = %+v; want one created", dryRun, report.Rows)
+		}
+		if report.Committed == dryRun {
+			t.Errorf("dry run %v: committed = %v", dryRun, report.Committed)
+		}
+
+		albums, err := store.GetAllAlbums()
+		if err != nil {
+			t.Fatalf("GetAllAlbums: %v", err)
+		}
+		if dryRun {
+			if len(albums) != 0 {
+				t.Errorf("dry run created albums %+v", albums)
+			}
+			continue
+		}
+		if len(albums) != 1 || albums[0].NameOriginal != "New Album" || albums[0].Type != "Album" {
+			t.Errorf("albums = %+v; want New Album of type Album", albums)
+		}
+	}
+}
+
+func TestImportAlbumType(t *testing.T) {
+	store := memory.New()
+	records := parseCSVString(t, `source_url,name_original,albums,album_type
+https://www.youtube.com/watch?v=dQw4w9WgXcQ,EP Song,New EP,ep
+`)
+
+	report, err := Import(store, records, Options{})
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if !report.Committed {
+		t.Fatalf("rows = %+v; want the import committed", report.Rows)
+	}
+	albums, _ := store.GetAllAlbums()
+	if len(albums) != 1 || albums[0].Type != "EP" {
+		t.Errorf("albums = %+v; want one EP", albums)
+	}
+}
+
+func TestParseAlbumType(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"Album", "Album", false},
+		{"single", "Single", false},
+		{"EP", "EP", false},
+		{"LP", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseAlbumType(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseAlbumType(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	records, err := Parse(strings.NewReader(`[{"source_url": "https://example.com/a.mp3", "album_type": "LP"}]`), FormatJSON)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if records[0].Problem == "" {
+		t.Error("JSON record with an invalid album_type has no problem")
+	}
+}
@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Format is the file format of an import
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+// listSeparator separates names in the artists, units and albums CSV columns
+const listSeparator = ";"
+
+// FormatFromFilename picks the format of a file by its extension
+func FormatFromFilename(name string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".json":
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unsupported import file %q (expected .csv or .json)", name)
+}
+
+// Record is one song of an import file. Artists, units, albums and the
+// category are given by name.
+type Record struct {
+	Row          int      `json:"-"` // Line in a CSV file, position in a JSON array
+	NameOriginal string   `json:"name_original"`
+	NameEnglish  string   `json:"name_english"`
+	SourceURL    string   `json:"source_url"`
+	ThumbnailURL string   `json:"thumbnail_url"`
+	Duration     int      `json:"duration"` // Seconds
+	Category     string   `json:"category"`
+	IsCover      *bool    `json:"is_cover"` // nil keeps an existing song's value
+	Artists      []string `json:"artists"`
+	Units        []string `json:"units"`
+	Albums       []string `json:"albums"`
+	AlbumType    string   `json:"album_type"` // Type of the albums the row creates, Album if empty
+
+	// Problem says why the row could not be read, e.g. a malformed duration
+	Problem string `json:"-"`
+}
+
+// Parse reads the records of an import file. It fails if the file cannot be
+// read at all; problems with single rows are left on their records.
+func Parse(r io.Reader, format Format) ([]Record, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSON:
+		return parseJSON(r)
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+// csvColumns are the columns a CSV file may have, named in its header row
+var csvColumns = map[string]bool{
+	"name_original": true,
+	"name_english":  true,
+	"source_url":    true,
+	"thumbnail_url": true,
+	"duration":      true,
+	"category":      true,
+	"is_cover":      true,
+	"artists":       true,
+	"units":         true,
+	"albums":        true,
+	"album_type":    true,
+}
+
+func parseCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !csvColumns[name] {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["source_url"]; !ok {
+		return nil, errors.New("CSV header has no source_url column")
+	}
+
+	var records []Record
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+
+		record := Record{
+			Row:          line,
+			NameOriginal: field("name_original"),
+			NameEnglish:  field("name_english"),
+			SourceURL:    field("source_url"),
+			ThumbnailURL: field("thumbnail_url"),
+			Category:     field("category"),
+			Artists:      splitList(field("artists")),
+			Units:        splitList(field("units")),
+			Albums:       splitList(field("albums")),
+		}
+		var problems []string
+		if record.Duration, err = parseDuration(field("duration")); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if record.IsCover, err = parseBool(field("is_cover")); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if record.AlbumType, err = parseAlbumType(field("album_type")); err != nil {
+			problems = append(problems, err.Error())
+		}
+		record.Problem = strings.Join(problems, "; ")
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parseJSON(r io.Reader) ([]Record, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var records []Record
+	if err := decoder.Decode(&records); err != nil {
+		return nil, fmt.Errorf("failed to read JSON (expected an array of songs): %w", err)
+	}
+	for i := range records {
+		records[i].Row = i + 1
+		var problems []string
+		if records[i].Duration < 0 {
+			problems = append(problems, "duration cannot be negative")
+		}
+		albumType, err := parseAlbumType(records[i].AlbumType)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		records[i].AlbumType = albumType
+		records[i].Problem = strings.Join(problems, "; ")
+	}
+	return records, nil
+}
+
+// splitList splits a list column into its names
+func splitList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, listSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseDuration reads seconds ("215") or a clock ("3:35", "1:02:03")
+func parseDuration(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	seconds := 0
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// albumTypes are the types an album may have; the first is the default
+var albumTypes = []string{"Album", "Single", "EP"}
+
+// parseAlbumType reads an album type in any case; empty means not given
+func parseAlbumType(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	for _, albumType := range albumTypes {
+		if strings.EqualFold(value, albumType) {
+			return albumType, nil
+		}
+	}
+	return "", fmt.Errorf("invalid album_type %q", value)
+}
+
+// parseBool reads a yes/no column; empty means not given
+func parseBool(value string) (*bool, error) {
+	var b bool
+	switch strings.ToLower(value) {
+	case "":
+		return nil, nil
+	case "true", "yes", "y", "1", "x":
+		b = true
+	case "false", "no", "n", "0":
+		b = false
+	default:
+		return nil, fmt.Errorf("invalid is_cover %q", value)
+	}
+	return &b, nil
+}
@@ -0,0 +1,200 @@
+package middleware_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/handlers"
+	"github.com/CptPie/SyncRate/server/middleware"
+	"github.com/CptPie/SyncRate/server/utils"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// newAPIRouter returns the users and votes endpoints of the JSON API, as the
+// router sets them up. Requests without a token come from sessionUser, or
+// from nobody when it is nil.
+func newAPIRouter(store database.Store, sessionUser *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions("syncrate-session", cookie.NewStore([]byte("test"))))
+	r.Use(func(c *gin.Context) {
+		if sessionUser != nil {
+			c.Set("user_id", sessionUser.UserID)
+			c.Set("username", sessionUser.Username)
+			c.Set("is_guest", sessionUser.IsGuest)
+		}
+		c.Next()
+	})
+
+	api := r.Group("/api")
+	api.Use(middleware.APIAuth(store))
+	api.GET("/users", middleware.RequireScope(models.ScopeRead), handlers.GetAPIUsers(store))
+	api.POST("/votes", middleware.RequireScope(models.ScopeVotesWrite), middleware.RequireRole(store, models.RoleMember), handlers.PostAPIVote(store))
+	api.POST("/users", middleware.RequireScope(models.ScopeUsersWrite), middleware.RequireRole(store, models.RoleAdmin), handlers.PostAPIUser(store))
+	return r
+}
+
+// serveAPI sends a JSON request with an optional Authorization header
+func serveAPI(r *gin.Engine, method, target, authorization, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func createUser(t *testing.T, store database.Store, username, role string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Role: role, PasswordHash: username + "-hash", Email: username + "@example.com"}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+// createToken stores a token of the user and returns its Authorization header
+func createToken(t *testing.T, store database.Store, user *models.User, scopes []string, expiresAt, revokedAt *time.Time) string {
+	t.Helper()
+	raw, prefix, hash, err := utils.GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken: %v", err)
+	}
+	token := &models.APIToken{
+		UserID:    user.UserID,
+		Name:      "test",
+		Prefix:    prefix,
+		TokenHash: hash,
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+		RevokedAt: revokedAt,
+	}
+	if err := store.CreateAPIToken(token); err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	return "Bearer " + raw
+}
+
+func TestAPIAuthScopesAndRoles(t *testing.T) {
+	store := memory.New()
+	admin := createUser(t, store, "admin", models.RoleAdmin)
+	member := createUser(t, store, "member", models.RoleMember)
+	viewer := createUser(t, store, "viewer", models.RoleViewer)
+	song := &models.Song{NameOriginal: "Song", SourceURL: "https://example.com/song.mp3", ThumbnailURL: "https://example.com/song.jpg"}
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	readToken := createToken(t, store, member, []string{models.ScopeRead}, nil, nil)
+	memberToken := createToken(t, store, member, models.AllScopes, &future, nil)
+	viewerToken := createToken(t, store, viewer, models.AllScopes, nil, nil)
+	adminToken := createToken(t, store, admin, models.AllScopes, nil, nil)
+	revokedToken := createToken(t, store, admin, models.AllScopes, nil, &past)
+	expiredToken := createToken(t, store, admin, models.AllScopes, &past, nil)
+
+	vote := fmt.Sprintf(`{"song_id": %d, "rating": 7}`, song.SongID)
+	newUser := `{"username": "newbie", "email": "newbie@example.com", "password": "secret123"}`
+
+	tests := []struct {
+		name          string
+		session       *models.User
+		method        string
+		target        string
+		authorization string
+		body          string
+		wantStatus    int
+	}{
+		{name: "no credentials", method: http.MethodGet, target: "/api/users", wantStatus: http.StatusUnauthorized},
+		{name: "not a bearer token", method: http.MethodGet, target: "/api/users", authorization: "Token abc", wantStatus: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodGet, target: "/api/users", authorization: "Bearer srt_unknown", wantStatus: http.StatusUnauthorized},
+		{name: "token looked up by hash", method: http.MethodGet, target: "/api/users", authorization: readToken, wantStatus: http.StatusOK},
+		{name: "revoked token", method: http.MethodGet, target: "/api/users", authorization: revokedToken, wantStatus: http.StatusUnauthorized},
+		{name: "expired token", method: http.MethodGet, target: "/api/users", authorization: expiredToken, wantStatus: http.StatusUnauthorized},
+		{name: "token without the scope", method: http.MethodPost, target: "/api/votes", authorization: readToken, body: vote, wantStatus: http.StatusForbidden},
+		{name: "token with the scope but not the role", method: http.MethodPost, target: "/api/votes", authorization: viewerToken, body: vote, wantStatus: http.StatusForbidden},
+		{name: "token with scope and role", method: http.MethodPost, target: "/api/votes", authorization: memberToken, body: vote, wantStatus: http.StatusCreated},
+		{name: "member creating a user", method: http.MethodPost, target: "/api/users", authorization: memberToken, body: newUser, wantStatus: http.StatusForbidden},
+		{name: "admin creating a user", method: http.MethodPost, target: "/api/users", authorization: adminToken, body: newUser, wantStatus: http.StatusCreated},
+		{name: "session user", session: member, method: http.MethodGet, target: "/api/users", wantStatus: http.StatusOK},
+		{name: "guest session reads", session: &models.User{UserID: viewer.UserID, IsGuest: true}, method: http.MethodGet, target: "/api/users", wantStatus: http.StatusOK},
+		{name: "guest session writes", session: &models.User{UserID: viewer.UserID, IsGuest: true}, method: http.MethodPost, target: "/api/votes", body: vote, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newAPIRouter(store, tt.session)
+			w := serveAPI(r, tt.method, tt.target, tt.authorization, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	tokens, err := store.GetAPITokensByUser(member.UserID)
+	if err != nil {
+		t.Fatalf("GetAPITokensByUser: %v", err)
+	}
+	for _, token := range tokens {
+		if token.LastUsedAt == nil {
+			t.Errorf("last use of token %d was not recorded", token.TokenID)
+		}
+	}
+}
+
+func TestPostAPIVoteUsesTheCallersAccount(t *testing.T) {
+	store := memory.New()
+	member := createUser(t, store, "member", models.RoleMember)
+	other := createUser(t, store, "other", models.RoleMember)
+	song := &models.Song{NameOriginal: "Song", SourceURL: "https://example.com/song.mp3", ThumbnailURL: "https://example.com/song.jpg"}
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	token := createToken(t, store, member, []string{models.ScopeVotesWrite}, nil, nil)
+
+	// A user_id in the body does not vote in another user's name
+	body := fmt.Sprintf(`{"song_id": %d, "rating": 4, "user_id": %d}`, song.SongID, other.UserID)
+	w := serveAPI(newAPIRouter(store, nil), http.MethodPost, "/api/votes", token, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d; want 201 (%s)", w.Code, w.Body.String())
+	}
+	if votes, _ := store.GetVotesByUser(other.UserID); len(votes) != 0 {
+		t.Errorf("other user has votes %+v; want none", votes)
+	}
+	if votes, _ := store.GetVotesByUser(member.UserID); len(votes) != 1 || votes[0].Rating != 4 {
+		t.Errorf("caller's votes = %+v; want the new vote", votes)
+	}
+}
+
+func TestUserResponsesLeaveOutCredentials(t *testing.T) {
+	store := memory.New()
+	admin := createUser(t, store, "admin", models.RoleAdmin)
+	token := createToken(t, store, admin, models.AllScopes, nil, nil)
+	r := newAPIRouter(store, nil)
+
+	responses := map[string]*httptest.ResponseRecorder{
+		"list":   serveAPI(r, http.MethodGet, "/api/users", token, ""),
+		"create": serveAPI(r, http.MethodPost, "/api/users", token, `{"username": "newbie", "email": "newbie@example.com", "password": "secret123"}`),
+	}
+	for name, w := range responses {
+		body := w.Body.String()
+		for _, secret := range []string{"admin-hash", "admin@example.com", "newbie@example.com", "password", "Password", "email"} {
+			if strings.Contains(body, secret) {
+				t.Errorf("%s response contains %q: %s", name, secret, body)
+			}
+		}
+		if !strings.Contains(body, `"user_id"`) || !strings.Contains(body, `"username"`) {
+			t.Errorf("%s response has no snake_case user fields: %s", name, body)
+		}
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// RequireAuth middleware checks if user is authenticated
+// RequireAuth middleware checks if user is authenticated. Guests do not
+// count as authenticated here.
 func RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
@@ -18,12 +19,19 @@ func RequireAuth() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if isGuest, _ := session.Get("is_guest").(bool); isGuest {
+			c.Redirect(http.StatusFound, "/register")
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
 }
 
-// SetUserContext middleware sets current user information in context
+// SetUserContext middleware sets current user information in context.
+// is_guest is set for sessions started from the guest form. role is the role
+// at login, good for navigation only; RequireRole checks the current one.
 func SetUserContext() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
@@ -31,9 +39,14 @@ func SetUserContext() gin.HandlerFunc {
 		username := session.Get("username")
 
 		if userID != nil && username != nil {
+			isGuest, _ := session.Get("is_guest").(bool)
 			c.Set("user_id", userID)
 			c.Set("username", username)
+			c.Set("is_guest", isGuest)
 			c.Set("is_authenticated", true)
+			if role, ok := session.Get("role").(string); ok {
+				c.Set("role", role)
+			}
 		} else {
 			c.Set("is_authenticated", false)
 		}
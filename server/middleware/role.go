@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole lets through users with the role or a more privileged one. The
+// role is read from the store on every request, so role changes apply at
+// once. API callers get JSON errors, browsers an error page.
+func RequireRole(store database.Store, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("user_id")
+		userID, ok := value.(uint)
+		if !ok {
+			denyRole(c, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		user, err := store.GetUserByID(userID)
+		if err != nil {
+			log.Printf("RequireRole: %v", err)
+			denyRole(c, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		// Keep the role shown in the navigation of this session current
+		session := sessions.Default(c)
+		if session.Get("user_id") == user.UserID && session.Get("role") != user.Role {
+			session.Set("role", user.Role)
+			if err := session.Save(); err != nil {
+				log.Printf("RequireRole: %v", err)
+			}
+		}
+		c.Set("role", user.Role)
+
+		if !user.HasRole(role) {
+			denyRole(c, http.StatusForbidden, "This needs the "+role+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// denyRole aborts a request that RequireRole turned down
+func denyRole(c *gin.Context, status int, message string) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.AbortWithStatusJSON(status, gin.H{"error": message})
+		return
+	}
+	if status == http.StatusUnauthorized {
+		c.Redirect(http.StatusFound, "/login")
+		c.Abort()
+		return
+	}
+
+	isAuth, _ := c.Get("is_authenticated")
+	isGuest, _ := c.Get("is_guest")
+	username, _ := c.Get("username")
+	c.HTML(status, "error.html", gin.H{
+		"title":            "SyncRate | Error",
+		"error":            message,
+		"is_authenticated": isAuth,
+		"is_guest":         isGuest,
+		"username":         username,
+		"can_curate":       models.RoleAtLeast(c.GetString("role"), models.RoleCurator),
+	})
+	c.Abort()
+}
@@ -4,29 +4,33 @@ import (
 	"html/template"
 	"log"
 
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/CptPie/SyncRate/server/backup"
 	"github.com/CptPie/SyncRate/server/handlers"
 	"github.com/CptPie/SyncRate/server/middleware"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func SetupRouter(db *gorm.DB) *gin.Engine {
+// SetupRouter wires all routes. Every handler goes through the
+// storage-agnostic store; the admin backup download uses exporter.
+func SetupRouter(store database.Store, exporter backup.Exporter) *gin.Engine {
 	r := gin.Default()
 
 	// Configure trusted proxies (disable for direct connections)
 	r.SetTrustedProxies(nil)
 
 	// Session setup
-	store := cookie.NewStore([]byte("your-secret-key-change-this-in-production"))
-	store.Options(sessions.Options{
+	sessionStore := cookie.NewStore([]byte("your-secret-key-change-this-in-production"))
+	sessionStore.Options(sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7 days
 		HttpOnly: true,
 		Secure:   false, // Set to true in production with HTTPS
 	})
-	r.Use(sessions.Sessions("syncrate-session", store))
+	r.Use(sessions.Sessions("syncrate-session", sessionStore))
 
 	// Add user context middleware to all routes
 	r.Use(middleware.SetUserContext())
@@ -50,116 +54,178 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	// Home routes
 	r.GET("/", func(c *gin.Context) {
 		log.Println("Router: Home route (/) accessed")
-		handlers.GetHome(db)(c)
+		handlers.GetHome(store)(c)
 	})
 
 	// Song routes
-	r.GET("/songs", handlers.GetSongs(db))
-	r.GET("/songs/:id", handlers.GetSong(db))
-	r.POST("/songs/:id/vote", handlers.PostVote(db))
+	r.GET("/songs", handlers.GetSongs(store))
+	r.GET("/songs/:id", handlers.GetSong(store))
+	r.POST("/songs/:id/vote", middleware.RequireRole(store, models.RoleMember), handlers.PostVote(store))
+	r.GET("/my-ratings.csv", handlers.GetMyRatingsCSV(store))
+
+	// Profile routes
+	r.GET("/me", handlers.GetMyProfile(store))
+	r.GET("/users/:id", handlers.GetUserProfile(store))
+	r.GET("/users/:id/compare/:other", handlers.GetCompareUsers(store))
+	r.GET("/recommendations", handlers.GetRecommendations(store))
+
+	// Chart routes
+	r.GET("/charts", handlers.GetCharts(store))
 
 	// User routes
-	r.GET("/login", handlers.GetLogin(db))
-	r.POST("/login", handlers.PostLogin(db))
-	r.GET("/register", handlers.GetRegister(db))
-	r.POST("/register", handlers.PostRegister(db))
-	r.POST("/logout", handlers.PostLogout(db))
+	r.GET("/login", handlers.GetLogin(store))
+	r.POST("/login", handlers.PostLogin(store))
+	r.GET("/register", handlers.GetRegister(store))
+	r.POST("/register", handlers.PostRegister(store))
+	r.POST("/logout", handlers.PostLogout(store))
+	r.GET("/guest", handlers.GetGuest(store))
+	r.POST("/guest", handlers.PostGuest(store))
 
 	// Rating room routes
-	r.GET("/create-rating-room", handlers.GetCreateRatingRoom(db))
-	r.POST("/create-rating-room", handlers.PostCreateRatingRoom(db))
-	r.GET("/rating-room/:roomId", handlers.GetRatingRoom(db))
-	r.GET("/rating-room/:roomId/ws", handlers.GetRatingRoomWS(db))
+	r.GET("/create-rating-room", handlers.GetCreateRatingRoom(store))
+	r.POST("/create-rating-room", handlers.PostCreateRatingRoom(store))
+	r.GET("/rating-room/:roomId", handlers.GetRatingRoom(store))
+	r.GET("/rating-room/:roomId/ws", handlers.GetRatingRoomWS(store))
+	r.POST("/rating-room/:roomId/unlock", handlers.PostUnlockRatingRoom(store))
+	r.POST("/rating-room/:roomId/invites", handlers.PostRatingRoomInvite(store))
 
 	// Radio room routes
-	r.GET("/create-radio-room", handlers.GetCreateRadioRoom(db))
-	r.POST("/create-radio-room", handlers.PostCreateRadioRoom(db))
-	r.GET("/radio-room/:roomId", handlers.GetRadioRoom(db))
-	r.GET("/radio-room/:roomId/ws", handlers.GetRadioRoomWS(db))
+	r.GET("/create-radio-room", handlers.GetCreateRadioRoom(store))
+	r.POST("/create-radio-room", handlers.PostCreateRadioRoom(store))
+	r.GET("/radio-room/:roomId", handlers.GetRadioRoom(store))
+	r.GET("/radio-room/:roomId/ws", handlers.GetRadioRoomWS(store))
+	r.GET("/radio-room/:roomId/songs", handlers.GetRadioRoomSongSearch(store))
+	r.POST("/radio-room/:roomId/unlock", handlers.PostUnlockRadioRoom(store))
+	r.POST("/radio-room/:roomId/invites", handlers.PostRadioRoomInvite(store))
 
 	// Tournament room routes
-	r.GET("/create-tournament-room", handlers.GetCreateTournamentRoom(db))
-	r.POST("/create-tournament-room", handlers.PostCreateTournamentRoom(db))
-	r.GET("/tournament-room/:roomId", handlers.GetTournamentRoom(db))
-	r.GET("/tournament-room/:roomId/ws", handlers.GetTournamentRoomWS(db))
-
-	// API routes
+	r.GET("/create-tournament-room", handlers.GetCreateTournamentRoom(store))
+	r.POST("/create-tournament-room", handlers.PostCreateTournamentRoom(store))
+	r.GET("/tournament-room/:roomId", handlers.GetTournamentRoom(store))
+	r.GET("/tournament-room/:roomId/ws", handlers.GetTournamentRoomWS(store))
+	r.POST("/tournament-room/:roomId/unlock", handlers.PostUnlockTournamentRoom(store))
+	r.POST("/tournament-room/:roomId/invites", handlers.PostTournamentRoomInvite(store))
+
+	// API routes: session or bearer token, see middleware.APIAuth
 	api := r.Group("/api")
+	api.Use(middleware.APIAuth(store))
+	read := middleware.RequireScope(models.ScopeRead)
+	// Writes need both the token scope and the role
+	catalogWrite := api.Group("", middleware.RequireScope(models.ScopeCatalogWrite), middleware.RequireRole(store, models.RoleCurator))
 	{
 		// Songs API
-		api.GET("/songs", handlers.GetAPISongs(db))
-		api.GET("/songs/:id", handlers.GetAPISong(db))
-		api.POST("/songs", handlers.PostAPISong(db))
+		api.GET("/songs", read, handlers.GetAPISongs(store))
+		api.GET("/songs/:id", read, handlers.GetAPISong(store))
+		catalogWrite.POST("/songs", handlers.PostAPISong(store))
 
 		// Artists API
-		api.GET("/artists", handlers.GetAPIArtists(db))
-		api.GET("/artists/:id", handlers.GetAPIArtist(db))
-		api.POST("/artists", handlers.PostAPIArtist(db))
+		api.GET("/artists", read, handlers.GetAPIArtists(store))
+		api.GET("/artists/:id", read, handlers.GetAPIArtist(store))
+		catalogWrite.POST("/artists", handlers.PostAPIArtist(store))
 
 		// Albums API
-		api.GET("/albums", handlers.GetAPIAlbums(db))
-		api.GET("/albums/:id", handlers.GetAPIAlbum(db))
-		api.POST("/albums", handlers.PostAPIAlbum(db))
+		api.GET("/albums", read, handlers.GetAPIAlbums(store))
+		api.GET("/albums/:id", read, handlers.GetAPIAlbum(store))
+		catalogWrite.POST("/albums", handlers.PostAPIAlbum(store))
 
 		// Units API
-		api.GET("/units", handlers.GetAPIUnits(db))
-		api.GET("/units/:id", handlers.GetAPIUnit(db))
-		api.POST("/units", handlers.PostAPIUnit(db))
+		api.GET("/units", read, handlers.GetAPIUnits(store))
+		api.GET("/units/:id", read, handlers.GetAPIUnit(store))
+		catalogWrite.POST("/units", handlers.PostAPIUnit(store))
 
 		// Categories API
-		api.GET("/categories", handlers.GetAPICategories(db))
-		api.GET("/categories/:id", handlers.GetAPICategory(db))
-		api.POST("/categories", handlers.PostAPICategory(db))
+		api.GET("/categories", read, handlers.GetAPICategories(store))
+		api.GET("/categories/:id", read, handlers.GetAPICategory(store))
+		catalogWrite.POST("/categories", handlers.PostAPICategory(store))
 
 		// Votes API
-		api.GET("/votes", handlers.GetAPIVotes(db))
-		api.GET("/votes/:id", handlers.GetAPIVote(db))
-		api.POST("/votes", handlers.PostAPIVote(db))
+		api.GET("/votes", read, handlers.GetAPIVotes(store))
+		api.GET("/votes/:id", read, handlers.GetAPIVote(store))
+		api.POST("/votes", middleware.RequireScope(models.ScopeVotesWrite), middleware.RequireRole(store, models.RoleMember), handlers.PostAPIVote(store))
 
 		// Users API
-		api.GET("/users", handlers.GetAPIUsers(db))
-		api.GET("/users/:id", handlers.GetAPIUser(db))
-		api.POST("/users", handlers.PostAPIUser(db))
+		api.GET("/users", read, handlers.GetAPIUsers(store))
+		api.GET("/users/:id", read, handlers.GetAPIUser(store))
+		api.GET("/users/:id/stats", read, handlers.GetAPIUserStats(store))
+		api.POST("/users", middleware.RequireScope(models.ScopeUsersWrite), middleware.RequireRole(store, models.RoleAdmin), handlers.PostAPIUser(store))
+
+		// Recommendations for the authenticated user
+		api.GET("/recommendations", read, handlers.GetAPIRecommendations(store))
+
+		// Charts API
+		api.GET("/charts/:chart", read, handlers.GetAPIChart(store))
+	}
+
+	// Account settings (protected)
+	settings := r.Group("/settings")
+	settings.Use(middleware.RequireAuth())
+	{
+		settings.GET("/tokens", handlers.GetAPITokens(store))
+		settings.POST("/tokens", handlers.PostAPIToken(store))
+		settings.POST("/tokens/:id/revoke", handlers.PostRevokeAPIToken(store))
 	}
 
-	// Admin routes (protected)
+	// Admin routes (protected): curators edit the catalog, admins also
+	// manage roles and backups
 	admin := r.Group("/admin")
-	admin.Use(middleware.RequireAuth())
+	admin.Use(middleware.RequireAuth(), middleware.RequireRole(store, models.RoleCurator))
+	adminOnly := middleware.RequireRole(store, models.RoleAdmin)
 	{
-		admin.GET("/", handlers.GetAdmin(db))
+		admin.GET("/", handlers.GetAdmin(store))
 
 		// Add routes
-		admin.GET("/add-category", handlers.GetAddCategory(db))
-		admin.POST("/add-category", handlers.PostAddCategory(db))
-		admin.GET("/add-unit", handlers.GetAddUnit(db))
-		admin.POST("/add-unit", handlers.PostAddUnit(db))
-		admin.GET("/add-artist", handlers.GetAddArtist(db))
-		admin.POST("/add-artist", handlers.PostAddArtist(db))
-		admin.GET("/add-song", handlers.GetAddSong(db))
-		admin.POST("/add-song", handlers.PostAddSong(db))
-		admin.GET("/add-album", handlers.GetAddAlbum(db))
-		admin.POST("/add-album", handlers.PostAddAlbum(db))
+		admin.GET("/add-category", handlers.GetAddCategory(store))
+		admin.POST("/add-category", handlers.PostAddCategory(store))
+		admin.GET("/add-unit", handlers.GetAddUnit(store))
+		admin.POST("/add-unit", handlers.PostAddUnit(store))
+		admin.GET("/add-artist", handlers.GetAddArtist(store))
+		admin.POST("/add-artist", handlers.PostAddArtist(store))
+		admin.GET("/add-song", handlers.GetAddSong(store))
+		admin.POST("/add-song", handlers.PostAddSong(store))
+		admin.GET("/songs/preview", handlers.GetSongPreview(store))
+		admin.GET("/import", handlers.GetImportSongs(store))
+		admin.POST("/import", handlers.PostImportSongs(store))
+		admin.GET("/export", adminOnly, handlers.GetExport(exporter))
+		admin.GET("/add-album", handlers.GetAddAlbum(store))
+		admin.POST("/add-album", handlers.PostAddAlbum(store))
 
 		// View routes
-		admin.GET("/categories", handlers.GetViewCategories(db))
-		admin.GET("/units", handlers.GetViewUnits(db))
-		admin.GET("/artists", handlers.GetViewArtists(db))
-		admin.GET("/view-songs", handlers.GetViewSongs(db))
-		admin.GET("/albums", handlers.GetViewAlbums(db))
+		admin.GET("/categories", handlers.GetViewCategories(store))
+		admin.GET("/units", handlers.GetViewUnits(store))
+		admin.GET("/artists", handlers.GetViewArtists(store))
+		admin.GET("/view-songs", handlers.GetViewSongs(store))
+		admin.GET("/albums", handlers.GetViewAlbums(store))
 
 		// Edit routes
-		admin.POST("/categories/:id/edit", handlers.PostEditCategory(db))
-		admin.POST("/units/:id/edit", handlers.PostEditUnit(db))
-		admin.POST("/artists/:id/edit", handlers.PostEditArtist(db))
-		admin.POST("/songs/:id/edit", handlers.PostEditSong(db))
-		admin.POST("/albums/:id/edit", handlers.PostEditAlbum(db))
+		admin.POST("/categories/:id/edit", handlers.PostEditCategory(store))
+		admin.POST("/units/:id/edit", handlers.PostEditUnit(store))
+		admin.POST("/artists/:id/edit", handlers.PostEditArtist(store))
+		admin.POST("/songs/:id/edit", handlers.PostEditSong(store))
+		admin.POST("/albums/:id/edit", handlers.PostEditAlbum(store))
 
 		// Delete routes
-		admin.POST("/categories/:id/delete", handlers.PostDeleteCategory(db))
-		admin.POST("/units/:id/delete", handlers.PostDeleteUnit(db))
-		admin.POST("/artists/:id/delete", handlers.PostDeleteArtist(db))
-		admin.POST("/songs/:id/delete", handlers.PostDeleteSong(db))
-		admin.POST("/albums/:id/delete", handlers.PostDeleteAlbum(db))
+		admin.POST("/categories/:id/delete", handlers.PostDeleteCategory(store))
+		admin.POST("/units/:id/delete", handlers.PostDeleteUnit(store))
+		admin.POST("/artists/:id/delete", handlers.PostDeleteArtist(store))
+		admin.POST("/songs/:id/delete", handlers.PostDeleteSong(store))
+		admin.POST("/albums/:id/delete", handlers.PostDeleteAlbum(store))
+
+		// Merge duplicate artists, units, albums and songs
+		admin.GET("/merge", handlers.GetAdminMerge(store))
+		admin.POST("/merge", handlers.PostAdminMerge(store))
+
+		// Trash: curators undo their deletes, admins purge for good
+		admin.GET("/trash", handlers.GetAdminTrash(store))
+		admin.POST("/trash/:type/:id/restore", handlers.PostRestoreTrashed(store))
+		admin.POST("/trash/:type/:id/purge", adminOnly, handlers.PostPurgeTrashed(store))
+
+		// User roles
+		admin.GET("/users", adminOnly, handlers.GetAdminUsers(store))
+		admin.POST("/users/:id/role", adminOnly, handlers.PostAdminUserRole(store))
+
+		// Audit log
+		admin.GET("/audit", adminOnly, handlers.GetAdminAudit(store))
+		admin.POST("/audit/:id/restore", adminOnly, handlers.PostRestoreAuditEvent(store))
 	}
 
 	return r
@@ -0,0 +1,171 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/CptPie/SyncRate/database"
+	"github.com/CptPie/SyncRate/database/memory"
+	"github.com/CptPie/SyncRate/models"
+	"github.com/gin-gonic/gin"
+)
+
+// newClient returns a client with its own session that does not follow
+// redirects
+func newClient(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookiejar: %v", err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func get(t *testing.T, client *http.Client, target string) *http.Response {
+	t.Helper()
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func post(t *testing.T, client *http.Client, target string) *http.Response {
+	t.Helper()
+	resp, err := client.PostForm(target, nil)
+	if err != nil {
+		t.Fatalf("POST %s: %v", target, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func register(t *testing.T, client *http.Client, server, username string) {
+	t.Helper()
+	resp, err := client.PostForm(server+"/register", url.Values{
+		"username":         {username},
+		"email":            {username + "@example.com"},
+		"password":         {"secret123"},
+		"confirm_password": {"secret123"},
+	})
+	if err != nil {
+		t.Fatalf("register %s: %v", username, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("register %s = %d; want 302", username, resp.StatusCode)
+	}
+}
+
+func TestSetupRouter(t *testing.T) {
+	// Templates and static files are loaded relative to the repository root
+	t.Chdir("../..")
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(SetupRouter(memory.New(), nil))
+	defer server.Close()
+
+	anonymous := newClient(t)
+	if resp := get(t, anonymous, server.URL+"/"); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET / = %d; want 200", resp.StatusCode)
+	}
+	resp := get(t, anonymous, server.URL+"/admin/")
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/login" {
+		t.Errorf("anonymous GET /admin/ = %d to %q; want a redirect to /login", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if resp := get(t, anonymous, server.URL+"/api/songs"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous GET /api/songs = %d; want 401", resp.StatusCode)
+	}
+
+	// The first account becomes admin, later ones are members
+	admin := newClient(t)
+	register(t, admin, server.URL, "first")
+	member := newClient(t)
+	register(t, member, server.URL, "second")
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		path   string
+		want   int
+	}{
+		{"admin opens the admin index", admin, "/admin/", http.StatusOK},
+		{"admin opens the song list", admin, "/admin/view-songs", http.StatusOK},
+		{"member is turned away from the admin pages", member, "/admin/", http.StatusForbidden},
+		{"member reads the API with the session", member, "/api/songs", http.StatusOK},
+		{"member opens their profile", member, "/me", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := get(t, tt.client, server.URL+tt.path); resp.StatusCode != tt.want {
+				t.Errorf("GET %s = %d; want %d", tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrashPurgeIsAdminOnly(t *testing.T) {
+	t.Chdir("../..")
+	gin.SetMode(gin.TestMode)
+	store := memory.New()
+	server := httptest.NewServer(SetupRouter(store, nil))
+	defer server.Close()
+
+	admin := newClient(t)
+	register(t, admin, server.URL, "first")
+	curator := newClient(t)
+	register(t, curator, server.URL, "second")
+	user, err := store.GetUserByUsername("second")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if err := store.SetUserRole(user.UserID, models.RoleCurator); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+
+	song := &models.Song{NameOriginal: "Song", SourceURL: "https://example.com/song.mp3", ThumbnailURL: "https://example.com/song.jpg"}
+	if err := store.CreateSong(song); err != nil {
+		t.Fatalf("CreateSong: %v", err)
+	}
+	trash := fmt.Sprintf("%s/admin/trash/song/%d", server.URL, song.SongID)
+	inTrash := func() bool {
+		trashed, err := store.ListTrash(database.TrashSong)
+		if err != nil {
+			t.Fatalf("ListTrash: %v", err)
+		}
+		return len(trashed) == 1
+	}
+
+	// Curators may undo a delete but not purge
+	if err := store.DeleteSong(song.SongID); err != nil {
+		t.Fatalf("DeleteSong: %v", err)
+	}
+	if resp := post(t, curator, trash+"/purge"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("curator purge = %d; want 403", resp.StatusCode)
+	}
+	if !inTrash() {
+		t.Fatal("curator purged the song")
+	}
+	if resp := post(t, curator, trash+"/restore"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("curator restore = %d; want 303", resp.StatusCode)
+	}
+
+	if err := store.DeleteSong(song.SongID); err != nil {
+		t.Fatalf("DeleteSong: %v", err)
+	}
+	if resp := post(t, admin, trash+"/purge"); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("admin purge = %d; want 303", resp.StatusCode)
+	}
+	if inTrash() {
+		t.Error("admin purge left the song in the trash")
+	}
+}
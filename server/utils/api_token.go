@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// apiTokenPrefix starts every personal access token, so leaked tokens are
+// easy to recognise
+const apiTokenPrefix = "srt_"
+
+// GenerateAPIToken makes a new personal access token. It returns the token,
+// which is shown to its owner once, the short prefix kept to tell tokens
+// apart and the hash that is stored.
+func GenerateAPIToken() (token, prefix, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token = apiTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, token[:len(apiTokenPrefix)+6], HashAPIToken(token), nil
+}
+
+// HashAPIToken returns the stored form of a token. The tokens are random, so
+// an unsalted SHA-256 is enough and lets tokens be looked up by hash.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var bilibiliVideoID = regexp.MustCompile(`(?i)/video/(BV[0-9A-Za-z]{10}|av[0-9]+)`)
+
+// bilibiliProvider plays Bilibili videos in the embedded player. The player
+// has no script API, so rooms cannot sync it.
+type bilibiliProvider struct{}
+
+func (bilibiliProvider) Name() string { return "bilibili" }
+
+func (bilibiliProvider) Match(sourceURL string) bool {
+	return hostMatches(sourceURL, "bilibili.com")
+}
+
+func (bilibiliProvider) MediaID(sourceURL string) (string, error) {
+	matches := bilibiliVideoID.FindStringSubmatch(sourceURL)
+	if len(matches) < 2 {
+		return "", fmt.Errorf("could not extract video ID from URL: %s", sourceURL)
+	}
+	// BV IDs are case sensitive, av IDs are not
+	if strings.HasPrefix(strings.ToLower(matches[1]), "av") {
+		return strings.ToLower(matches[1]), nil
+	}
+	return "BV" + matches[1][2:], nil
+}
+
+func (bilibiliProvider) EmbedURL(videoID string) string {
+	if strings.HasPrefix(videoID, "av") {
+		return fmt.Sprintf("https://player.bilibili.com/player.html?aid=%s&autoplay=1", strings.TrimPrefix(videoID, "av"))
+	}
+	return fmt.Sprintf("https://player.bilibili.com/player.html?bvid=%s&autoplay=1", videoID)
+}
+
+func (bilibiliProvider) ThumbnailURL(videoID string) (string, error) {
+	// Covers are only known to the Bilibili API
+	return "", nil
+}
+
+func (bilibiliProvider) Capabilities() PlayerCapabilities {
+	return PlayerCapabilities{}
+}
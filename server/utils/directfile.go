@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// directFileExtensions are the audio and video formats browsers play
+var directFileExtensions = map[string]bool{
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".oga": true,
+	".opus": true, ".wav": true, ".flac": true,
+	".mp4": true, ".m4v": true, ".webm": true, ".ogv": true,
+}
+
+// directFileProvider plays audio and video files by URL in the browser's own
+// player. The media ID is the URL itself.
+type directFileProvider struct{}
+
+func (directFileProvider) Name() string { return "file" }
+
+func (directFileProvider) Match(sourceURL string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(sourceURL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	return directFileExtensions[strings.ToLower(path.Ext(parsed.Path))]
+}
+
+func (p directFileProvider) MediaID(sourceURL string) (string, error) {
+	if !p.Match(sourceURL) {
+		return "", fmt.Errorf("not an audio or video file: %s", sourceURL)
+	}
+	return strings.TrimSpace(sourceURL), nil
+}
+
+func (directFileProvider) EmbedURL(fileURL string) string {
+	return fileURL
+}
+
+func (directFileProvider) ThumbnailURL(fileURL string) (string, error) {
+	return "", nil
+}
+
+func (directFileProvider) Capabilities() PlayerCapabilities {
+	return PlayerCapabilities{Sync: true, EndEvent: true}
+}
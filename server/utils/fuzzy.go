@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// channelNoise are words uploaders add to artist names, e.g. "YOASOBI
+// Official" or "Ado - Topic"
+var channelNoise = map[string]bool{
+	"official": true,
+	"channel":  true,
+	"topic":    true,
+	"vevo":     true,
+	"公式":       true,
+}
+
+// normalizeName folds case and drops punctuation, spaces and channel noise
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		if !channelNoise[word] {
+			b.WriteString(word)
+		}
+	}
+	return b.String()
+}
+
+// NameMatchScore rates how well a catalog name, e.g. of an artist, matches
+// text such as an uploader or a video title: 1 for the same name, 0.9 if the
+// text mentions the name, otherwise how similar the two are (0 to 1)
+func NameMatchScore(name, text string) float64 {
+	n, t := normalizeName(name), normalizeName(text)
+	if n == "" || t == "" {
+		return 0
+	}
+	if n == t {
+		return 1
+	}
+	// Very short names would be found in most titles
+	if utf8.RuneCountInString(n) >= 3 && strings.Contains(t, n) {
+		return 0.9
+	}
+	return similarity(n, t)
+}
+
+// similarity is 1 minus the edit distance of a and b relative to the longer
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrUnsupportedMedia is returned (wrapped) when no media provider plays a
+// source URL
+var ErrUnsupportedMedia = errors.New("unsupported media source")
+
+// PlayerCapabilities says what rooms can do with a provider's embedded player
+type PlayerCapabilities struct {
+	Sync     bool `json:"sync"`      // Position can be read and set, and playback paused and resumed
+	EndEvent bool `json:"end_event"` // Player reports when the media ends
+}
+
+// MediaProvider is a site or format songs can be played from. Providers are
+// looked up by source URL when a song is saved, and by the name stored in
+// Song.Provider when it is played.
+type MediaProvider interface {
+	// Name identifies the provider, e.g. in Song.Provider
+	Name() string
+	// Match reports whether the provider plays a source URL
+	Match(sourceURL string) bool
+	// MediaID extracts the provider's canonical ID from a source URL
+	MediaID(sourceURL string) (string, error)
+	// EmbedURL is the URL of the embedded player for a media ID
+	EmbedURL(mediaID string) string
+	// ThumbnailURL finds a thumbnail for a media ID. It returns "" if the
+	// provider cannot tell without asking its API.
+	ThumbnailURL(mediaID string) (string, error)
+	// Capabilities says what the embedded player can be told to do
+	Capabilities() PlayerCapabilities
+}
+
+// mediaProviders are tried in order; the first match plays a URL
+var mediaProviders = []MediaProvider{
+	youtubeProvider{},
+	soundCloudProvider{},
+	bilibiliProvider{},
+	niconicoProvider{},
+	directFileProvider{},
+}
+
+// RegisterMediaProvider adds a provider. It is tried before the built-in
+// ones, so it can take over URLs they would match.
+func RegisterMediaProvider(provider MediaProvider) {
+	mediaProviders = append([]MediaProvider{provider}, mediaProviders...)
+}
+
+// MediaProviderByName returns the provider stored as name in Song.Provider
+func MediaProviderByName(name string) (MediaProvider, bool) {
+	for _, provider := range mediaProviders {
+		if provider.Name() == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+// FindMediaProvider returns the provider that plays a source URL
+func FindMediaProvider(sourceURL string) (MediaProvider, bool) {
+	for _, provider := range mediaProviders {
+		if provider.Match(sourceURL) {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+// Media is a song source as its provider plays it
+type Media struct {
+	Provider     string             `json:"provider"`
+	ID           string             `json:"provider_id"`
+	EmbedURL     string             `json:"embed_url"`
+	Capabilities PlayerCapabilities `json:"capabilities"`
+}
+
+// ResolveMedia finds the provider of a source URL and its media ID
+func ResolveMedia(sourceURL string) (*Media, error) {
+	provider, ok := FindMediaProvider(sourceURL)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMedia, sourceURL)
+	}
+	mediaID, err := provider.MediaID(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	return newMedia(provider, mediaID), nil
+}
+
+// SongMedia returns the media of a song from its stored provider and media
+// ID. Songs saved before providers were recorded are resolved from their
+// source URL.
+func SongMedia(providerName, mediaID, sourceURL string) (*Media, error) {
+	if providerName != "" && mediaID != "" {
+		if provider, ok := MediaProviderByName(providerName); ok {
+			return newMedia(provider, mediaID), nil
+		}
+	}
+	return ResolveMedia(sourceURL)
+}
+
+func newMedia(provider MediaProvider, mediaID string) *Media {
+	return &Media{
+		Provider:     provider.Name(),
+		ID:           mediaID,
+		EmbedURL:     provider.EmbedURL(mediaID),
+		Capabilities: provider.Capabilities(),
+	}
+}
+
+// hostMatches reports whether a URL is on domain or one of its subdomains
+func hostMatches(sourceURL string, domains ...string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(sourceURL))
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
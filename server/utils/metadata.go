@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoMetadata is returned (wrapped) when a provider has no metadata source
+var ErrNoMetadata = errors.New("no metadata source for media")
+
+// MediaMetadata is what a provider knows about a song's media
+type MediaMetadata struct {
+	Title        string  `json:"title"`
+	Uploader     string  `json:"uploader"` // Channel or account that uploaded the media
+	Duration     float64 `json:"duration"` // Seconds, 0 if the provider does not tell
+	ThumbnailURL string  `json:"thumbnail_url"`
+}
+
+// MetadataFetcher looks up the metadata of media from its provider
+type MetadataFetcher interface {
+	FetchMetadata(ctx context.Context, media *Media) (*MediaMetadata, error)
+}
+
+// MetadataEndpoints are the URLs HTTPMetadataFetcher asks for metadata
+type MetadataEndpoints struct {
+	YouTube    string // oEmbed, called with ?url=&format=json
+	SoundCloud string // oEmbed, called with ?url=&format=json
+	Bilibili   string // Video info JSON, called with ?bvid= or ?aid=
+	Niconico   string // getthumbinfo XML, the video ID is appended
+}
+
+// DefaultMetadataEndpoints are the providers' public endpoints
+var DefaultMetadataEndpoints = MetadataEndpoints{
+	YouTube:    "https://www.youtube.com/oembed",
+	SoundCloud: "https://soundcloud.com/oembed",
+	Bilibili:   "https://api.bilibili.com/x/web-interface/view",
+	Niconico:   "https://ext.nicovideo.jp/api/getthumbinfo/",
+}
+
+// HTTPMetadataFetcher fetches metadata from the providers' oEmbed and JSON
+// endpoints. YouTube and SoundCloud oEmbed do not report durations.
+type HTTPMetadataFetcher struct {
+	Client    *http.Client
+	Endpoints MetadataEndpoints
+}
+
+// NewMetadataFetcher returns a fetcher for the providers' public endpoints
+func NewMetadataFetcher() *HTTPMetadataFetcher {
+	return &HTTPMetadataFetcher{
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		Endpoints: DefaultMetadataEndpoints,
+	}
+}
+
+// FetchMetadata asks the media's provider for its metadata
+func (f *HTTPMetadataFetcher) FetchMetadata(ctx context.Context, media *Media) (*MediaMetadata, error) {
+	switch media.Provider {
+	case "youtube":
+		return f.fetchOEmbed(ctx, f.Endpoints.YouTube, "https://www.youtube.com/watch?v="+media.ID)
+	case "soundcloud":
+		return f.fetchOEmbed(ctx, f.Endpoints.SoundCloud, "https://soundcloud.com/"+media.ID)
+	case "bilibili":
+		return f.fetchBilibili(ctx, media.ID)
+	case "niconico":
+		return f.fetchNiconico(ctx, media.ID)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoMetadata, media.Provider)
+}
+
+// oEmbedResponse holds the oEmbed fields we use
+type oEmbedResponse struct {
+	Title        string  `json:"title"`
+	AuthorName   string  `json:"author_name"`
+	ThumbnailURL string  `json:"thumbnail_url"`
+	Duration     float64 `json:"duration"` // Not in the spec, but some providers send it
+}
+
+func (f *HTTPMetadataFetcher) fetchOEmbed(ctx context.Context, endpoint, mediaURL string) (*MediaMetadata, error) {
+	query := url.Values{"url": {mediaURL}, "format": {"json"}}
+	var resp oEmbedResponse
+	if err := f.getJSON(ctx, endpoint+"?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	return &MediaMetadata{
+		Title:        resp.Title,
+		Uploader:     resp.AuthorName,
+		Duration:     resp.Duration,
+		ThumbnailURL: resp.ThumbnailURL,
+	}, nil
+}
+
+// bilibiliResponse holds the video info fields we use
+type bilibiliResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Title    string `json:"title"`
+		Pic      string `json:"pic"`
+		Duration int    `json:"duration"` // Seconds
+		Owner    struct {
+			Name string `json:"name"`
+		} `json:"owner"`
+	} `json:"data"`
+}
+
+func (f *HTTPMetadataFetcher) fetchBilibili(ctx context.Context, videoID string) (*MediaMetadata, error) {
+	query := url.Values{"bvid": {videoID}}
+	if strings.HasPrefix(videoID, "av") {
+		query = url.Values{"aid": {strings.TrimPrefix(videoID, "av")}}
+	}
+	var resp bilibiliResponse
+	if err := f.getJSON(ctx, f.Endpoints.Bilibili+"?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("bilibili returned code %d: %s", resp.Code, resp.Message)
+	}
+	return &MediaMetadata{
+		Title:        resp.Data.Title,
+		Uploader:     resp.Data.Owner.Name,
+		Duration:     float64(resp.Data.Duration),
+		ThumbnailURL: strings.Replace(resp.Data.Pic, "http://", "https://", 1),
+	}, nil
+}
+
+// niconicoResponse holds the getthumbinfo fields we use
+type niconicoResponse struct {
+	Status string `xml:"status,attr"`
+	Thumb  struct {
+		Title        string `xml:"title"`
+		ThumbnailURL string `xml:"thumbnail_url"`
+		Length       string `xml:"length"` // m:ss
+		UserNickname string `xml:"user_nickname"`
+		ChannelName  string `xml:"ch_name"`
+	} `xml:"thumb"`
+	Error struct {
+		Code string `xml:"code"`
+	} `xml:"error"`
+}
+
+func (f *HTTPMetadataFetcher) fetchNiconico(ctx context.Context, videoID string) (*MediaMetadata, error) {
+	body, err := f.get(ctx, f.Endpoints.Niconico+url.PathEscape(videoID))
+	if err != nil {
+		return nil, err
+	}
+	var resp niconicoResponse
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode niconico metadata: %w", err)
+	}
+	if resp.Status != "ok" {
+		return nil, fmt.Errorf("niconico returned %s", resp.Error.Code)
+	}
+
+	uploader := resp.Thumb.UserNickname
+	if uploader == "" {
+		uploader = resp.Thumb.ChannelName
+	}
+	return &MediaMetadata{
+		Title:        resp.Thumb.Title,
+		Uploader:     uploader,
+		Duration:     parseClock(resp.Thumb.Length),
+		ThumbnailURL: resp.Thumb.ThumbnailURL,
+	}, nil
+}
+
+// parseClock parses a h:mm:ss or m:ss length into seconds, or 0
+func parseClock(length string) float64 {
+	seconds := 0
+	for _, part := range strings.Split(length, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return float64(seconds)
+}
+
+func (f *HTTPMetadataFetcher) getJSON(ctx context.Context, endpoint string, v any) error {
+	body, err := f.get(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return nil
+}
+
+// maxMetadataSize caps the metadata responses we read
+const maxMetadataSize = 1 << 20
+
+func (f *HTTPMetadataFetcher) get(ctx context.Context, endpoint string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build metadata request: %w", err)
+	}
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata request returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFetcher returns a fetcher whose endpoints all point at handler
+func newTestFetcher(t *testing.T, handler http.HandlerFunc) *HTTPMetadataFetcher {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &HTTPMetadataFetcher{
+		Client: server.Client(),
+		Endpoints: MetadataEndpoints{
+			YouTube:    server.URL + "/youtube",
+			SoundCloud: server.URL + "/soundcloud",
+			Bilibili:   server.URL + "/bilibili",
+			Niconico:   server.URL + "/niconico/",
+		},
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	fetcher := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/youtube":
+			if r.URL.Query().Get("url") != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" || r.URL.Query().Get("format") != "json" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"title": "Song", "author_name": "Channel", "thumbnail_url": "https://example.com/yt.jpg"}`))
+		case r.URL.Path == "/soundcloud":
+			w.Write([]byte(`{"title": "Track", "author_name": "Artist", "thumbnail_url": "https://example.com/sc.jpg", "duration": 61.5}`))
+		case r.URL.Path == "/bilibili":
+			if r.URL.Query().Get("bvid") != "BV1xx411c7mD" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"code": 0, "data": {"title": "Video", "pic": "http://example.com/bb.jpg", "duration": 200, "owner": {"name": "Uploader"}}}`))
+		case strings.HasPrefix(r.URL.Path, "/niconico/sm9"):
+			w.Write([]byte(`<nicovideo_thumb_response status="ok"><thumb><title>Nico</title><thumbnail_url>https://example.com/nn.jpg</thumbnail_url><length>1:02:03</length><ch_name>Channel</ch_name></thumb></nicovideo_thumb_response>`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	tests := []struct {
+		media Media
+		want  MediaMetadata
+	}{
+		{Media{Provider: "youtube", ID: "dQw4w9WgXcQ"}, MediaMetadata{Title: "Song", Uploader: "Channel", ThumbnailURL: "https://example.com/yt.jpg"}},
+		{Media{Provider: "soundcloud", ID: "artist/track"}, MediaMetadata{Title: "Track", Uploader: "Artist", Duration: 61.5, ThumbnailURL: "https://example.com/sc.jpg"}},
+		{Media{Provider: "bilibili", ID: "BV1xx411c7mD"}, MediaMetadata{Title: "Video", Uploader: "Uploader", Duration: 200, ThumbnailURL: "https://example.com/bb.jpg"}},
+		{Media{Provider: "niconico", ID: "sm9"}, MediaMetadata{Title: "Nico", Uploader: "Channel", Duration: 3723, ThumbnailURL: "https://example.com/nn.jpg"}},
+	}
+	for _, tt := range tests {
+		got, err := fetcher.FetchMetadata(context.Background(), &tt.media)
+		if err != nil {
+			t.Errorf("%s: %v", tt.media.Provider, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.media.Provider, *got, tt.want)
+		}
+	}
+}
+
+func TestFetchMetadataErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		body     string
+		status   int
+	}{
+		{"oEmbed not found", "youtube", `{"title": "Song"}`, http.StatusNotFound},
+		{"oEmbed server error", "soundcloud", `{}`, http.StatusInternalServerError},
+		{"oEmbed malformed JSON", "youtube", `{"title": `, http.StatusOK},
+		{"oEmbed not JSON", "soundcloud", `<html>Not Found</html>`, http.StatusOK},
+		{"bilibili malformed JSON", "bilibili", `{"code": 0, "data": [`, http.StatusOK},
+		{"bilibili error code", "bilibili", `{"code": -404, "message": "not found"}`, http.StatusOK},
+		{"bilibili rate limited", "bilibili", `{}`, http.StatusTooManyRequests},
+		{"niconico malformed XML", "niconico", `<nicovideo_thumb_response status="ok"><thumb>`, http.StatusOK},
+		{"niconico failure", "niconico", `<nicovideo_thumb_response status="fail"><error><code>DELETED</code></error></nicovideo_thumb_response>`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		fetcher := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		})
+		got, err := fetcher.FetchMetadata(context.Background(), &Media{Provider: tt.provider, ID: "sm9"})
+		if err == nil {
+			t.Errorf("%s: got %+v, want an error", tt.name, got)
+		}
+	}
+}
+
+func TestFetchMetadataTimeout(t *testing.T) {
+	release := make(chan struct{})
+	fetcher := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	// The client timeout
+	fetcher.Client.Timeout = 50 * time.Millisecond
+	if _, err := fetcher.FetchMetadata(context.Background(), &Media{Provider: "youtube", ID: "dQw4w9WgXcQ"}); err == nil {
+		t.Error("client timeout: got no error")
+	}
+
+	// The caller's deadline
+	fetcher.Client.Timeout = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := fetcher.FetchMetadata(ctx, &Media{Provider: "bilibili", ID: "BV1xx411c7mD"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("context deadline: got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFetchMetadataUnsupportedProvider(t *testing.T) {
+	fetcher := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for %s", r.URL)
+	})
+	_, err := fetcher.FetchMetadata(context.Background(), &Media{Provider: "file", ID: "https://example.com/a.mp3"})
+	if !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("got %v, want ErrNoMetadata", err)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := map[string]float64{
+		"0:00":    0,
+		"4:05":    245,
+		"1:02:03": 3723,
+		"":        0,
+		"4:x":     0,
+		"-1:00":   0,
+	}
+	for length, want := range tests {
+		if got := parseClock(length); got != want {
+			t.Errorf("parseClock(%q) = %v, want %v", length, got, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var niconicoVideoID = regexp.MustCompile(`(?:nicovideo\.jp/watch/|nico\.ms/)((?:sm|nm|so)[0-9]+)`)
+
+// niconicoProvider plays Niconico videos in the embedded player, which is
+// controlled through postMessage
+type niconicoProvider struct{}
+
+func (niconicoProvider) Name() string { return "niconico" }
+
+func (niconicoProvider) Match(sourceURL string) bool {
+	return hostMatches(sourceURL, "nicovideo.jp", "nico.ms")
+}
+
+func (niconicoProvider) MediaID(sourceURL string) (string, error) {
+	matches := niconicoVideoID.FindStringSubmatch(sourceURL)
+	if len(matches) < 2 {
+		return "", fmt.Errorf("could not extract video ID from URL: %s", sourceURL)
+	}
+	return matches[1], nil
+}
+
+func (niconicoProvider) EmbedURL(videoID string) string {
+	return fmt.Sprintf("https://embed.nicovideo.jp/watch/%s?jsapi=1&playerId=1&autoplay=1", videoID)
+}
+
+func (niconicoProvider) ThumbnailURL(videoID string) (string, error) {
+	// Only sm videos have thumbnails at a predictable address
+	if !strings.HasPrefix(videoID, "sm") {
+		return "", nil
+	}
+	number := strings.TrimPrefix(videoID, "sm")
+	return fmt.Sprintf("https://nicovideo.cdn.nimg.jp/thumbnails/%s/%s", number, number), nil
+}
+
+func (niconicoProvider) Capabilities() PlayerCapabilities {
+	return PlayerCapabilities{Sync: true, EndEvent: true}
+}
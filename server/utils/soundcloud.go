@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// soundCloudProvider plays SoundCloud tracks through the Widget API. The
+// media ID is the track path, e.g. "artist/track".
+type soundCloudProvider struct{}
+
+func (soundCloudProvider) Name() string { return "soundcloud" }
+
+func (soundCloudProvider) Match(sourceURL string) bool {
+	return hostMatches(sourceURL, "soundcloud.com") && !hostMatches(sourceURL, "api.soundcloud.com", "w.soundcloud.com")
+}
+
+func (soundCloudProvider) MediaID(sourceURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(sourceURL))
+	if err != nil {
+		return "", fmt.Errorf("could not parse SoundCloud URL: %w", err)
+	}
+
+	// Tracks live at /<artist>/<track>; longer paths are sets or pages
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[1] == "sets" {
+		return "", fmt.Errorf("could not extract track from URL: %s", sourceURL)
+	}
+	return strings.ToLower(parts[0] + "/" + parts[1]), nil
+}
+
+func (soundCloudProvider) EmbedURL(trackPath string) string {
+	return "https://w.soundcloud.com/player/?url=" + url.QueryEscape("https://soundcloud.com/"+trackPath) +
+		"&auto_play=true&visual=true"
+}
+
+func (soundCloudProvider) ThumbnailURL(trackPath string) (string, error) {
+	// Artwork is only known to the SoundCloud API
+	return "", nil
+}
+
+func (soundCloudProvider) Capabilities() PlayerCapabilities {
+	return PlayerCapabilities{Sync: true, EndEvent: true}
+}
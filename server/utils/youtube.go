@@ -92,3 +92,23 @@ func GetYouTubeEmbedURL(sourceURL string) (string, error) {
 	return fmt.Sprintf("https://www.youtube.com/embed/%s", videoID), nil
 }
 
+// youtubeProvider plays YouTube videos through the IFrame Player API
+type youtubeProvider struct{}
+
+func (youtubeProvider) Name() string { return "youtube" }
+
+func (youtubeProvider) Match(sourceURL string) bool { return IsYouTubeURL(sourceURL) }
+
+func (youtubeProvider) MediaID(sourceURL string) (string, error) { return YouTubeVideoID(sourceURL) }
+
+func (youtubeProvider) EmbedURL(videoID string) string {
+	return fmt.Sprintf("https://www.youtube.com/embed/%s", videoID)
+}
+
+func (youtubeProvider) ThumbnailURL(videoID string) (string, error) {
+	return GetYouTubeThumbnailURL(videoID)
+}
+
+func (youtubeProvider) Capabilities() PlayerCapabilities {
+	return PlayerCapabilities{Sync: true, EndEvent: true}
+}
@@ -0,0 +1,315 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// RoomState is the part of a Room that outlives the process holding its
+// connections. It is what a RoomStore persists and what a RoomManager
+// rebuilds a Room from after a restart or on another instance.
+type RoomState struct {
+	ID            string
+	CreatorID     string
+	CurrentSongID *uint
+	VideoTime     float64
+	IsPlaying     bool
+	StartedAt     time.Time
+	Duration      float64
+	LastActivity  time.Time
+	Roles         map[string]Role // Roles other than member and host by user ID
+	Banned        []string        // User IDs that may not join
+	Queue         []QueueItem     // Songs to play next, in order
+	SkipVotes     []string        // User IDs voting to skip the current song
+	Members       []Member        // Only filled by LoadRoom
+}
+
+// Member is one connection of a user to a room on some instance
+type Member struct {
+	UserID     string    `json:"user_id"`
+	SessionID  string    `json:"session_id"`
+	Username   string    `json:"username"`
+	InstanceID string    `json:"instance_id"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// RoomStore persists room state and membership for one kind of room
+type RoomStore interface {
+	// SaveRoom creates or updates the room, leaving its members untouched
+	SaveRoom(state RoomState) error
+	// LoadRoom returns the room with all of its members, or nil if unknown
+	LoadRoom(roomID string) (*RoomState, error)
+	DeleteRoom(roomID string) error
+	// DeleteInactiveRooms removes rooms without members that have not been
+	// active since before
+	DeleteInactiveRooms(before time.Time) error
+
+	// AddMember creates or replaces the connection's membership in the room
+	AddMember(roomID string, member Member) error
+	// RemoveMember removes the membership only if it is held by instanceID
+	RemoveMember(roomID, sessionID, instanceID string) error
+	// TouchMembers marks every membership held by instanceID as seen
+	TouchMembers(instanceID string, seen time.Time) error
+	// DeleteStaleMembers removes memberships not seen since before
+	DeleteStaleMembers(before time.Time) error
+
+	// ClaimAdvance atomically claims moving the room on from fromSongID. It
+	// reports false if the room is on another song or another claim younger
+	// than AdvanceClaimTimeout holds, so of all instances that see a song
+	// end only one advances the room.
+	ClaimAdvance(roomID string, fromSongID uint) (bool, error)
+	// ReleaseAdvance drops the room's claim once the next song plays or
+	// the claimant gave up
+	ReleaseAdvance(roomID string) error
+
+	// MergeQueuedSongs points the queued items of merged songs at the
+	// survivor, in every room
+	MergeQueuedSongs(merge SongMerge) error
+}
+
+// AdvanceClaimTimeout is how long a claim to advance a room holds, in case
+// its instance dies before releasing it
+const AdvanceClaimTimeout = 30 * time.Second
+
+// EventKind says what a room event carries
+type EventKind string
+
+const (
+	EventMessage  EventKind = "message"  // A WSMessage for every client in the room
+	EventJoin     EventKind = "join"     // Member joined on the origin instance
+	EventLeave    EventKind = "leave"    // Member left the origin instance
+	EventPlayback EventKind = "playback" // Song or video position changed
+	EventDeleted  EventKind = "deleted"  // Room was cleaned up
+	EventRoles    EventKind = "roles"    // Host, roles or bans changed
+	EventKick     EventKind = "kick"     // Member was kicked or banned
+	EventQueue    EventKind = "queue"    // Queue or skip votes changed
+	EventMerge    EventKind = "merge"    // Songs were merged; for every room
+)
+
+// Event is what instances exchange through a Broadcaster
+type Event struct {
+	Topic    string          `json:"topic"`
+	RoomID   string          `json:"room_id"`
+	Origin   string          `json:"origin"`
+	Kind     EventKind       `json:"kind"`
+	Member   *Member         `json:"member,omitempty"`
+	Message  json.RawMessage `json:"message,omitempty"`
+	Playback *PlaybackState  `json:"playback,omitempty"`
+	Roles    *RoleState      `json:"roles,omitempty"`
+	Queue    *QueueState     `json:"queue,omitempty"`
+	Merge    *SongMerge      `json:"merge,omitempty"`
+}
+
+// PlaybackState is the shared player position of a room
+type PlaybackState struct {
+	CurrentSongID *uint     `json:"current_song_id,omitempty"`
+	VideoTime     float64   `json:"video_time"`
+	IsPlaying     bool      `json:"is_playing"`
+	StartedAt     time.Time `json:"started_at"`
+	Duration      float64   `json:"duration,omitempty"`
+}
+
+// Broadcaster fans room events out to every instance subscribed to a topic,
+// including the one that published them
+type Broadcaster interface {
+	Publish(event Event) error
+	Subscribe(topic string, handler func(Event))
+}
+
+// ============= IN-PROCESS BACKEND =============
+
+// MemoryRoomStore keeps room state in process memory. State is lost on
+// restart; it is the default for single-instance deployments.
+type MemoryRoomStore struct {
+	mutex    sync.RWMutex
+	rooms    map[string]RoomState
+	members  map[string]map[string]Member // room ID -> session ID -> member
+	advances map[string]time.Time         // room ID -> when its advance was claimed
+}
+
+// NewMemoryRoomStore creates an empty in-memory room store
+func NewMemoryRoomStore() *MemoryRoomStore {
+	return &MemoryRoomStore{
+		rooms:    make(map[string]RoomState),
+		members:  make(map[string]map[string]Member),
+		advances: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRoomStore) SaveRoom(state RoomState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state.Members = nil
+	s.rooms[state.ID] = state
+	return nil
+}
+
+func (s *MemoryRoomStore) LoadRoom(roomID string) (*RoomState, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	state, exists := s.rooms[roomID]
+	if !exists {
+		return nil, nil
+	}
+	for _, member := range s.members[roomID] {
+		state.Members = append(state.Members, member)
+	}
+	return &state, nil
+}
+
+func (s *MemoryRoomStore) DeleteRoom(roomID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.rooms, roomID)
+	delete(s.members, roomID)
+	delete(s.advances, roomID)
+	return nil
+}
+
+func (s *MemoryRoomStore) DeleteInactiveRooms(before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for roomID, state := range s.rooms {
+		if len(s.members[roomID]) == 0 && state.LastActivity.Before(before) {
+			delete(s.rooms, roomID)
+			delete(s.members, roomID)
+			delete(s.advances, roomID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRoomStore) AddMember(roomID string, member Member) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.rooms[roomID]; !exists {
+		return &RoomError{Message: "Room not found"}
+	}
+	if s.members[roomID] == nil {
+		s.members[roomID] = make(map[string]Member)
+	}
+	s.members[roomID][member.SessionID] = member
+	return nil
+}
+
+func (s *MemoryRoomStore) RemoveMember(roomID, sessionID, instanceID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if member, exists := s.members[roomID][sessionID]; exists && member.InstanceID == instanceID {
+		delete(s.members[roomID], sessionID)
+	}
+	return nil
+}
+
+func (s *MemoryRoomStore) TouchMembers(instanceID string, seen time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, members := range s.members {
+		for sessionID, member := range members {
+			if member.InstanceID == instanceID {
+				member.LastSeen = seen
+				members[sessionID] = member
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRoomStore) MergeQueuedSongs(merge SongMerge) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for roomID, state := range s.rooms {
+		if queue, changed := merge.Apply(state.Queue); changed {
+			state.Queue = queue
+			s.rooms[roomID] = state
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRoomStore) DeleteStaleMembers(before time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, members := range s.members {
+		for sessionID, member := range members {
+			if member.LastSeen.Before(before) {
+				delete(members, sessionID)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRoomStore) ClaimAdvance(roomID string, fromSongID uint) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, exists := s.rooms[roomID]
+	if !exists {
+		return false, nil
+	}
+	if state.CurrentSongID != nil && *state.CurrentSongID != fromSongID {
+		return false, nil
+	}
+	if claimed, exists := s.advances[roomID]; exists && time.Since(claimed) < AdvanceClaimTimeout {
+		return false, nil
+	}
+	s.advances[roomID] = time.Now()
+	return true, nil
+}
+
+func (s *MemoryRoomStore) ReleaseAdvance(roomID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.advances, roomID)
+	return nil
+}
+
+// LocalBroadcaster delivers events to subscribers in the same process.
+// Each subscriber gets its own queue so events arrive in publish order
+// without the publisher ever calling into a subscriber directly.
+type LocalBroadcaster struct {
+	mutex       sync.RWMutex
+	subscribers map[string][]chan Event
+}
+
+// NewLocalBroadcaster creates an in-process broadcaster
+func NewLocalBroadcaster() *LocalBroadcaster {
+	return &LocalBroadcaster{
+		subscribers: make(map[string][]chan Event),
+	}
+}
+
+func (b *LocalBroadcaster) Publish(event Event) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, queue := range b.subscribers[event.Topic] {
+		queue <- event
+	}
+	return nil
+}
+
+func (b *LocalBroadcaster) Subscribe(topic string, handler func(Event)) {
+	queue := make(chan Event, 256)
+	go func() {
+		for event := range queue {
+			handler(event)
+		}
+	}()
+
+	b.mutex.Lock()
+	b.subscribers[topic] = append(b.subscribers[topic], queue)
+	b.mutex.Unlock()
+}
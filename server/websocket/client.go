@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a single write may take before the client is dropped
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent before it is dropped
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait so healthy clients always answer in time
+	pingPeriod = pongWait * 9 / 10
+	// sendQueueSize is how many messages may wait for a slow client
+	sendQueueSize = 256
+	// maxMessageSize limits what a client may send in one message
+	maxMessageSize = 64 * 1024
+)
+
+// newLocalClient wraps a connection on this instance and starts its writer.
+// From here on only the writer goroutine writes to conn.
+func newLocalClient(userID, username, roomID, instanceID string, conn *websocket.Conn) *Client {
+	client := &Client{
+		ID:         userID,
+		SessionID:  newSessionID(),
+		Username:   username,
+		Conn:       conn,
+		RoomID:     roomID,
+		InstanceID: instanceID,
+		LastSeen:   time.Now(),
+		send:       make(chan []byte, sendQueueSize),
+		done:       make(chan struct{}),
+	}
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		client.touch()
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go client.writePump()
+	return client
+}
+
+// newSessionID identifies one connection; a user has one per tab or device
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Send queues a message for the client without blocking. A client whose
+// queue is full is too slow to keep up and gets disconnected.
+func (c *Client) Send(message []byte) bool {
+	if !c.IsLocal() {
+		return false
+	}
+
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- message:
+		return true
+	default:
+		log.Printf("Dropping session %s of user %s in room %s: send queue is full", c.SessionID, c.ID, c.RoomID)
+		c.Close()
+		// Don't wait for the queue to drain into a stalled connection
+		c.Conn.Close()
+		return false
+	}
+}
+
+// SendJSON encodes v and queues it for the client
+func (c *Client) SendJSON(v interface{}) bool {
+	message, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding message for client %s: %v", c.ID, err)
+		return false
+	}
+	return c.Send(message)
+}
+
+// Close stops the client. The writer sends what is still queued, then
+// closes the connection. It is safe to call more than once and from any
+// goroutine.
+func (c *Client) Close() {
+	if !c.IsLocal() {
+		return
+	}
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// Seen returns when the client last answered a ping
+func (c *Client) Seen() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.LastSeen
+}
+
+func (c *Client) touch() {
+	c.mutex.Lock()
+	c.LastSeen = time.Now()
+	c.mutex.Unlock()
+}
+
+// writePump is the only goroutine writing to the connection. It drains the
+// send queue and keeps the connection alive with pings.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.flush()
+			return
+		case message := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Printf("Error sending message to client %s: %v", c.ID, err)
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// flush writes whatever is still queued and closes the connection cleanly
+func (c *Client) flush() {
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	for {
+		select {
+		case message := <-c.send:
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		default:
+			c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
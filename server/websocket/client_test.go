@@ -0,0 +1,93 @@
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newConnPair returns the server side of a WebSocket connection and the
+// client side dialed to it
+func newConnPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	conns := make(chan *websocket.Conn, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(ts.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return <-conns, client
+}
+
+func TestSendDropsSlowClient(t *testing.T) {
+	serverConn, peer := newConnPair(t)
+	client := newLocalClient("1", "slow", "room", "instance", serverConn)
+
+	// The peer never reads, so the writer stalls once the socket buffers
+	// are full and the queue fills up behind it
+	message := make([]byte, 1<<20)
+	sent := 0
+	for client.Send(message) {
+		sent++
+		if sent > 10*sendQueueSize {
+			t.Fatalf("queued %d messages to a client that never reads", sent)
+		}
+	}
+	if sent < sendQueueSize {
+		t.Errorf("dropped the client after %d messages; want at least a full queue of %d", sent, sendQueueSize)
+	}
+
+	select {
+	case <-client.done:
+	default:
+		t.Fatal("client is still open after its queue overflowed")
+	}
+	if client.Send([]byte("late")) {
+		t.Error("Send to a dropped client succeeded")
+	}
+
+	// The dropped connection is closed rather than left to drain
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := peer.NextReader(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("connection of the dropped client is still open")
+			}
+			break
+		}
+	}
+}
+
+func TestSendKeepsClientThatReads(t *testing.T) {
+	serverConn, peer := newConnPair(t)
+	client := newLocalClient("1", "fast", "room", "instance", serverConn)
+	defer client.Close()
+
+	for i := 0; i < 2*sendQueueSize; i++ {
+		if !client.Send([]byte("hello")) {
+			t.Fatalf("Send %d failed for a client that keeps up", i)
+		}
+		peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, message, err := peer.ReadMessage(); err != nil || string(message) != "hello" {
+			t.Fatalf("ReadMessage = %q, %v; want hello", message, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package pgbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// notifyChannel is the Postgres channel all room events go through
+	notifyChannel = "syncrate_room_events"
+
+	// maxNotifyPayload keeps payloads under the 8000 byte NOTIFY limit.
+	// Larger events are stored in room_events and only their ID is sent.
+	maxNotifyPayload = 7000
+
+	// eventRefPrefix marks a payload that references a room_events row
+	eventRefPrefix = "#"
+
+	// eventRetention is how long stored events are kept for late readers
+	eventRetention = 10 * time.Minute
+)
+
+// roomEvent is a row in the room_events table
+type roomEvent struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Payload   string
+	CreatedAt time.Time
+}
+
+// Broadcaster is a wsocket.Broadcaster on top of Postgres LISTEN/NOTIFY.
+// Every instance listening on the same database receives every event.
+type Broadcaster struct {
+	db  *gorm.DB
+	dsn string
+
+	mutex    sync.RWMutex
+	handlers map[string][]func(wsocket.Event)
+}
+
+// NewBroadcaster creates a broadcaster that publishes through db and listens
+// on a dedicated connection opened from dsn
+func NewBroadcaster(db *gorm.DB, dsn string) *Broadcaster {
+	return &Broadcaster{
+		db:       db,
+		dsn:      dsn,
+		handlers: make(map[string][]func(wsocket.Event)),
+	}
+}
+
+var _ wsocket.Broadcaster = (*Broadcaster)(nil)
+
+// Start opens the listening connection and keeps it open until ctx is
+// cancelled, reconnecting whenever it drops
+func (b *Broadcaster) Start(ctx context.Context) error {
+	conn, err := b.listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			err := b.receive(ctx, conn)
+			conn.Close(context.Background())
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Room event listener disconnected: %v", err)
+
+			// Reconnect with a capped backoff
+			for delay := time.Second; ; delay = min(delay*2, 30*time.Second) {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				if conn, err = b.listen(ctx); err == nil {
+					log.Println("Room event listener reconnected")
+					break
+				}
+				log.Printf("Error reconnecting room event listener: %v", err)
+			}
+		}
+	}()
+
+	go b.pruneEvents(ctx)
+
+	return nil
+}
+
+func (b *Broadcaster) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect room event listener: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to listen for room events: %w", err)
+	}
+	return conn, nil
+}
+
+// receive dispatches notifications until the connection fails
+func (b *Broadcaster) receive(ctx context.Context, conn *pgx.Conn) error {
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		payload := notification.Payload
+		if strings.HasPrefix(payload, eventRefPrefix) {
+			if payload, err = b.loadEvent(strings.TrimPrefix(payload, eventRefPrefix)); err != nil {
+				log.Printf("Error loading room event: %v", err)
+				continue
+			}
+		}
+
+		var event wsocket.Event
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			log.Printf("Error decoding room event: %v", err)
+			continue
+		}
+
+		b.mutex.RLock()
+		handlers := b.handlers[event.Topic]
+		b.mutex.RUnlock()
+
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+func (b *Broadcaster) loadEvent(id string) (string, error) {
+	eventID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid room event reference %q", id)
+	}
+
+	var event roomEvent
+	if err := b.db.First(&event, eventID).Error; err != nil {
+		return "", fmt.Errorf("failed to load room event %d: %w", eventID, err)
+	}
+	return event.Payload, nil
+}
+
+func (b *Broadcaster) Publish(event wsocket.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode room event: %w", err)
+	}
+
+	notification := string(payload)
+	if len(payload) > maxNotifyPayload {
+		stored := roomEvent{Payload: string(payload), CreatedAt: time.Now()}
+		if err := b.db.Create(&stored).Error; err != nil {
+			return fmt.Errorf("failed to store room event: %w", err)
+		}
+		notification = eventRefPrefix + strconv.FormatUint(stored.ID, 10)
+	}
+
+	if err := b.db.Exec("SELECT pg_notify(?, ?)", notifyChannel, notification).Error; err != nil {
+		return fmt.Errorf("failed to publish room event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for events of a topic. Handlers run on the
+// listener goroutine, one event at a time.
+func (b *Broadcaster) Subscribe(topic string, handler func(wsocket.Event)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], handler)
+}
+
+// pruneEvents removes stored events every instance has had time to read
+func (b *Broadcaster) pruneEvents(ctx context.Context) {
+	ticker := time.NewTicker(eventRetention)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-eventRetention)
+			if err := b.db.Where("created_at < ?", cutoff).Delete(&roomEvent{}).Error; err != nil {
+				log.Printf("Error pruning room events: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package pgbackend
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statement is a query the fake database received
+type statement struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeDB is a database/sql connector that records statements instead of
+// talking to Postgres. Inserts return eventID; selects return events.
+type fakeDB struct {
+	mu         sync.Mutex
+	statements []statement
+	eventID    int64
+	events     map[int64]string
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return f, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (f *fakeDB) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (f *fakeDB) Close() error                        { return nil }
+func (f *fakeDB) Begin() (driver.Tx, error)           { return f, nil }
+func (f *fakeDB) Commit() error                       { return nil }
+func (f *fakeDB) Rollback() error                     { return nil }
+
+func (f *fakeDB) record(query string, args []driver.NamedValue) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statements = append(f.statements, statement{query, values})
+}
+
+func (f *fakeDB) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	f.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (f *fakeDB) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	f.record(query, args)
+	switch {
+	case strings.HasPrefix(query, "INSERT"):
+		return &fakeRows{columns: []string{"id"}, values: [][]driver.Value{{f.eventID}}}, nil
+	case strings.HasPrefix(query, "SELECT"):
+		id := args[0].Value.(int64)
+		payload, ok := f.events[id]
+		if !ok {
+			return &fakeRows{columns: []string{"id", "payload", "created_at"}}, nil
+		}
+		return &fakeRows{
+			columns: []string{"id", "payload", "created_at"},
+			values:  [][]driver.Value{{id, payload, time.Now()}},
+		}, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+// fakeRows is the result of a fakeDB query
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// newFakeBroadcaster returns a broadcaster writing to a fake database
+func newFakeBroadcaster(t *testing.T, fake *fakeDB) *Broadcaster {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(fake)}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	return NewBroadcaster(db, "")
+}
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		wantStored bool
+	}{
+		{name: "small event", size: 100},
+		{name: "event just under the limit", size: maxNotifyPayload - 200},
+		{name: "large event", size: 2 * maxNotifyPayload, wantStored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDB{eventID: 42}
+			b := newFakeBroadcaster(t, fake)
+
+			event := wsocket.Event{Topic: "rating", RoomID: "room", Message: []byte(`"` + strings.Repeat("x", tt.size) + `"`)}
+			if err := b.Publish(event); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+
+			var inserts, notifies []statement
+			for _, stmt := range fake.statements {
+				switch {
+				case strings.HasPrefix(stmt.query, "INSERT INTO \"room_events\""):
+					inserts = append(inserts, stmt)
+				case strings.Contains(stmt.query, "pg_notify"):
+					notifies = append(notifies, stmt)
+				}
+			}
+			if len(notifies) != 1 {
+				t.Fatalf("sent %d notifications; want 1", len(notifies))
+			}
+			notification := notifies[0].args[1].(string)
+			if len(notification) > maxNotifyPayload {
+				t.Errorf("notification has %d bytes; want at most %d", len(notification), maxNotifyPayload)
+			}
+
+			if !tt.wantStored {
+				if len(inserts) != 0 {
+					t.Errorf("stored the event in room_events; want it sent inline")
+				}
+				if strings.HasPrefix(notification, eventRefPrefix) {
+					t.Errorf("notification = %q; want the event itself", notification)
+				}
+				return
+			}
+			if len(inserts) != 1 {
+				t.Fatalf("stored %d events; want 1", len(inserts))
+			}
+			if payload := inserts[0].args[0].(string); !strings.Contains(payload, strings.Repeat("x", tt.size)) {
+				t.Errorf("stored payload does not hold the event")
+			}
+			if notification != eventRefPrefix+"42" {
+				t.Errorf("notification = %q; want a reference to event 42", notification)
+			}
+		})
+	}
+}
+
+func TestLoadEvent(t *testing.T) {
+	fake := &fakeDB{events: map[int64]string{42: `{"topic":"rating"}`}}
+	b := newFakeBroadcaster(t, fake)
+
+	payload, err := b.loadEvent("42")
+	if err != nil {
+		t.Fatalf("loadEvent: %v", err)
+	}
+	if payload != `{"topic":"rating"}` {
+		t.Errorf("payload = %q; want the stored event", payload)
+	}
+
+	if _, err := b.loadEvent("7"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("loadEvent of a pruned event = %v; want ErrRecordNotFound", err)
+	}
+	if _, err := b.loadEvent("not-a-number"); err == nil {
+		t.Errorf("loadEvent of a bad reference succeeded")
+	}
+}
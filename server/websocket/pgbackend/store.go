@@ -0,0 +1,259 @@
+// Package pgbackend keeps room state in Postgres and fans room events out to
+// every instance with LISTEN/NOTIFY
+package pgbackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	wsocket "github.com/CptPie/SyncRate/server/websocket"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// liveRoom is a row in the live_rooms table
+type liveRoom struct {
+	Topic         string `gorm:"primaryKey"`
+	RoomID        string `gorm:"primaryKey"`
+	CreatorID     string
+	CurrentSongID *uint
+	VideoTime     float64
+	IsPlaying     bool
+	StartedAt     time.Time
+	Duration      float64
+	LastActivity  time.Time
+	Roles         map[string]wsocket.Role `gorm:"serializer:json"`
+	Banned        []string                `gorm:"serializer:json"`
+	Queue         []wsocket.QueueItem     `gorm:"serializer:json"`
+	SkipVotes     []string                `gorm:"serializer:json"`
+}
+
+// liveRoomMember is a row in the live_room_members table
+type liveRoomMember struct {
+	Topic      string `gorm:"primaryKey"`
+	RoomID     string `gorm:"primaryKey"`
+	SessionID  string `gorm:"primaryKey"`
+	UserID     string
+	Username   string
+	InstanceID string
+	LastSeen   time.Time
+}
+
+// RoomStore is a wsocket.RoomStore for one kind of room (topic)
+type RoomStore struct {
+	db    *gorm.DB
+	topic string
+}
+
+// NewRoomStore creates a room store for the given topic
+func NewRoomStore(db *gorm.DB, topic string) *RoomStore {
+	return &RoomStore{db: db, topic: topic}
+}
+
+var _ wsocket.RoomStore = (*RoomStore)(nil)
+
+func (s *RoomStore) SaveRoom(state wsocket.RoomState) error {
+	row := liveRoom{
+		Topic:         s.topic,
+		RoomID:        state.ID,
+		CreatorID:     state.CreatorID,
+		CurrentSongID: state.CurrentSongID,
+		VideoTime:     state.VideoTime,
+		IsPlaying:     state.IsPlaying,
+		StartedAt:     state.StartedAt,
+		Duration:      state.Duration,
+		LastActivity:  state.LastActivity,
+		Roles:         state.Roles,
+		Banned:        state.Banned,
+		Queue:         state.Queue,
+		SkipVotes:     state.SkipVotes,
+	}
+	// Store empty values rather than JSON null
+	if row.Roles == nil {
+		row.Roles = map[string]wsocket.Role{}
+	}
+	if row.Banned == nil {
+		row.Banned = []string{}
+	}
+	if row.Queue == nil {
+		row.Queue = []wsocket.QueueItem{}
+	}
+	if row.SkipVotes == nil {
+		row.SkipVotes = []string{}
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "topic"}, {Name: "room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"creator_id", "current_song_id", "video_time", "is_playing", "started_at", "duration", "last_activity", "roles", "banned", "queue", "skip_votes"}),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("failed to save room state: %w", err)
+	}
+	return nil
+}
+
+func (s *RoomStore) LoadRoom(roomID string) (*wsocket.RoomState, error) {
+	var row liveRoom
+	err := s.db.Where("topic = ? AND room_id = ?", s.topic, roomID).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load room state: %w", err)
+	}
+
+	var members []liveRoomMember
+	if err := s.db.Where("topic = ? AND room_id = ?", s.topic, roomID).Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to load room members: %w", err)
+	}
+
+	state := &wsocket.RoomState{
+		ID:            row.RoomID,
+		CreatorID:     row.CreatorID,
+		CurrentSongID: row.CurrentSongID,
+		VideoTime:     row.VideoTime,
+		IsPlaying:     row.IsPlaying,
+		StartedAt:     row.StartedAt,
+		Duration:      row.Duration,
+		LastActivity:  row.LastActivity,
+		Roles:         row.Roles,
+		Banned:        row.Banned,
+		Queue:         row.Queue,
+		SkipVotes:     row.SkipVotes,
+		Members:       make([]wsocket.Member, len(members)),
+	}
+	for i, member := range members {
+		state.Members[i] = wsocket.Member{
+			UserID:     member.UserID,
+			SessionID:  member.SessionID,
+			Username:   member.Username,
+			InstanceID: member.InstanceID,
+			LastSeen:   member.LastSeen,
+		}
+	}
+	return state, nil
+}
+
+func (s *RoomStore) DeleteRoom(roomID string) error {
+	// Members go with the room through ON DELETE CASCADE
+	if err := s.db.Where("topic = ? AND room_id = ?", s.topic, roomID).Delete(&liveRoom{}).Error; err != nil {
+		return fmt.Errorf("failed to delete room state: %w", err)
+	}
+	return nil
+}
+
+func (s *RoomStore) DeleteInactiveRooms(before time.Time) error {
+	err := s.db.Where("topic = ? AND last_activity < ?", s.topic, before).
+		Where("NOT EXISTS (?)", s.db.Model(&liveRoomMember{}).Select("1").
+			Where("live_room_members.topic = live_rooms.topic AND live_room_members.room_id = live_rooms.room_id")).
+		Delete(&liveRoom{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete inactive room states: %w", err)
+	}
+	return nil
+}
+
+func (s *RoomStore) AddMember(roomID string, member wsocket.Member) error {
+	row := liveRoomMember{
+		Topic:      s.topic,
+		RoomID:     roomID,
+		SessionID:  member.SessionID,
+		UserID:     member.UserID,
+		Username:   member.Username,
+		InstanceID: member.InstanceID,
+		LastSeen:   member.LastSeen,
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "topic"}, {Name: "room_id"}, {Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "username", "instance_id", "last_seen"}),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("failed to save room member: %w", err)
+	}
+	return nil
+}
+
+func (s *RoomStore) RemoveMember(roomID, sessionID, instanceID string) error {
+	err := s.db.Where("topic = ? AND room_id = ? AND session_id = ? AND instance_id = ?", s.topic, roomID, sessionID, instanceID).
+		Delete(&liveRoomMember{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to remove room member: %w", err)
+	}
+	return nil
+}
+
+func (s *RoomStore) TouchMembers(instanceID string, seen time.Time) error {
+	err := s.db.Model(&liveRoomMember{}).
+		Where("topic = ? AND instance_id = ?", s.topic, instanceID).
+		Update("last_seen", seen).Error
+	if err != nil {
+		return fmt.Errorf("failed to refresh room members: %w", err)
+	}
+	return nil
+}
+
+func (s *RoomStore) DeleteStaleMembers(before time.Time) error {
+	err := s.db.Where("topic = ? AND last_seen < ?", s.topic, before).Delete(&liveRoomMember{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete stale room members: %w", err)
+	}
+	return nil
+}
+
+// ClaimAdvance is a compare-and-set on the room row, so exactly one of the
+// instances racing for the same song end updates it. SaveRoom leaves the
+// claim columns alone.
+func (s *RoomStore) ClaimAdvance(roomID string, fromSongID uint) (bool, error) {
+	now := time.Now()
+	result := s.db.Model(&liveRoom{}).
+		Where("topic = ? AND room_id = ?", s.topic, roomID).
+		Where("current_song_id = ? OR current_song_id IS NULL", fromSongID).
+		Where("advancing_from IS NULL OR advancing_at < ?", now.Add(-wsocket.AdvanceClaimTimeout)).
+		Updates(map[string]interface{}{"advancing_from": fromSongID, "advancing_at": now})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim room advance: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (s *RoomStore) ReleaseAdvance(roomID string) error {
+	err := s.db.Model(&liveRoom{}).
+		Where("topic = ? AND room_id = ?", s.topic, roomID).
+		Updates(map[string]interface{}{"advancing_from": nil, "advancing_at": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release room advance: %w", err)
+	}
+	return nil
+}
+
+func (s *RoomStore) MergeQueuedSongs(merge wsocket.SongMerge) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var rows []liveRoom
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("topic", "room_id", "queue").
+			Where("topic = ?", s.topic).
+			Where("EXISTS (SELECT 1 FROM jsonb_array_elements(queue) AS item WHERE (item->>'song_id')::bigint IN ?)", merge.DuplicateIDs).
+			Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed to load room queues: %w", err)
+		}
+		for _, row := range rows {
+			queue, changed := merge.Apply(row.Queue)
+			if !changed {
+				continue
+			}
+			queueJSON, err := json.Marshal(queue)
+			if err != nil {
+				return fmt.Errorf("failed to merge room queue: %w", err)
+			}
+			if err := tx.Model(&liveRoom{}).
+				Where("topic = ? AND room_id = ?", s.topic, row.RoomID).
+				Update("queue", string(queueJSON)).Error; err != nil {
+				return fmt.Errorf("failed to merge room queue: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// endGrace is how long a song may run past its duration before the clock
+	// moves on, so a player that reports the end itself goes first
+	endGrace = 3 * time.Second
+
+	// maxSongDuration caps durations reported by players
+	maxSongDuration = 6 * time.Hour
+
+	// endTolerance is how long before its end by the server's clock a
+	// player may report a song ended, for players a little ahead
+	endTolerance = 5 * time.Second
+)
+
+// position returns where the current song is at now, in seconds. Callers
+// must hold r.Mutex.
+func (r *Room) position(now time.Time) float64 {
+	if !r.IsPlaying || r.StartedAt.IsZero() {
+		return r.VideoTime
+	}
+	return max(0, now.Sub(r.StartedAt).Seconds())
+}
+
+// finished reports whether the current song played past its duration.
+// Callers must hold r.Mutex.
+func (r *Room) finished(now time.Time) bool {
+	return r.IsPlaying && r.Duration > 0 && r.position(now) >= r.Duration+endGrace.Seconds()
+}
+
+// NearEnd reports whether songID is the room's current song and has played
+// to within endTolerance of its end. Songs of unknown duration never are,
+// so those rooms move on by vote skip.
+func (rm *RoomManager) NearEnd(roomID string, songID uint) bool {
+	room, exists := rm.GetRoom(roomID)
+	if !exists {
+		return false
+	}
+	room.Mutex.RLock()
+	defer room.Mutex.RUnlock()
+
+	if room.CurrentSongID == nil || *room.CurrentSongID != songID {
+		return false
+	}
+	return room.Duration > 0 && room.position(time.Now()) >= room.Duration-endTolerance.Seconds()
+}
+
+// StartSong records the song a room is on and starts the room's clock at 0s
+func (rm *RoomManager) StartSong(roomID string, songID uint) {
+	rm.updatePlayback(roomID, func(room *Room) {
+		room.CurrentSongID = &songID
+		room.advancingFrom = nil
+		room.VideoTime = 0
+		room.IsPlaying = true
+		room.StartedAt = time.Now()
+		room.Duration = 0
+	})
+	// After the new song is saved, so a late claim for the old one fails
+	rm.releaseAdvance(roomID)
+}
+
+// SetDuration records the length of the room's current song, unless it is
+// already known or shorter than the song has played. It reports whether the
+// duration was taken.
+func (rm *RoomManager) SetDuration(roomID string, songID uint, duration float64) bool {
+	if duration <= 0 || duration > maxSongDuration.Seconds() {
+		return false
+	}
+
+	room, exists := rm.GetRoom(roomID)
+	if !exists {
+		return false
+	}
+	accepts := func(room *Room) bool {
+		return room.CurrentSongID != nil && *room.CurrentSongID == songID &&
+			room.Duration == 0 && duration >= room.position(time.Now())
+	}
+	room.Mutex.RLock()
+	ok := accepts(room)
+	room.Mutex.RUnlock()
+	if !ok {
+		return false
+	}
+
+	taken := false
+	rm.updatePlayback(roomID, func(room *Room) {
+		if taken = accepts(room); taken {
+			room.Duration = duration
+		}
+	})
+	return taken
+}
+
+// StartPlaybackClock makes the server the timekeeper of the manager's rooms.
+// Every interval it sends rooms with clients on this instance their position,
+// so players that drifted or joined late catch up, and calls ended for songs
+// that played past their duration. ended must move the room to another song.
+// Every instance with clients in a room calls it, so it should advance the
+// room through AdvanceQueue, whose claim lets only one of them through.
+func (rm *RoomManager) StartPlaybackClock(interval time.Duration, ended func(roomID string, songID uint)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			rm.tickPlayback(ended)
+		}
+	}()
+}
+
+func (rm *RoomManager) tickPlayback(ended func(roomID string, songID uint)) {
+	rm.mutex.RLock()
+	rooms := make([]*Room, 0, len(rm.rooms))
+	for _, room := range rm.rooms {
+		rooms = append(rooms, room)
+	}
+	rm.mutex.RUnlock()
+
+	now := time.Now()
+	for _, room := range rooms {
+		room.Mutex.RLock()
+		local := false
+		for _, client := range room.Clients {
+			if client.IsLocal() {
+				local = true
+				break
+			}
+		}
+		if !local || room.CurrentSongID == nil {
+			room.Mutex.RUnlock()
+			continue
+		}
+		songID := *room.CurrentSongID
+		finished := room.finished(now)
+		message := playbackSyncMessage(room, now)
+		room.Mutex.RUnlock()
+
+		if finished {
+			ended(room.ID, songID)
+			continue
+		}
+		// Every instance runs this, so only tell local clients
+		messageBytes, _ := json.Marshal(message)
+		rm.deliverLocal(room.ID, messageBytes)
+	}
+}
+
+// PlaybackSyncMessage is a video_sync message with the room's position by the
+// server's clock
+func PlaybackSyncMessage(room *Room) WSMessage {
+	room.Mutex.RLock()
+	defer room.Mutex.RUnlock()
+	return playbackSyncMessage(room, time.Now())
+}
+
+// playbackSyncMessage builds a video_sync message. Callers must hold
+// room.Mutex.
+func playbackSyncMessage(room *Room, now time.Time) WSMessage {
+	syncData := VideoSyncData{
+		Time:      room.position(now),
+		IsPlaying: room.IsPlaying,
+		Duration:  room.Duration,
+	}
+	if room.CurrentSongID != nil {
+		syncData.SongID = *room.CurrentSongID
+	}
+	if room.Duration > 0 {
+		syncData.Time = min(syncData.Time, room.Duration)
+	}
+
+	data, _ := json.Marshal(syncData)
+	return WSMessage{
+		Type:      MsgVideoSync,
+		Data:      data,
+		Timestamp: now,
+	}
+}
@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+// playFor moves the start of the room's clock back by played
+func playFor(room *Room, played time.Duration) {
+	room.Mutex.Lock()
+	room.StartedAt = time.Now().Add(-played)
+	room.Mutex.Unlock()
+}
+
+func TestNearEnd(t *testing.T) {
+	rm := NewRoomManager()
+	room := rm.CreateRoom("room", "1", "creator")
+	rm.StartSong("room", 10)
+
+	// Only a vote skips a song nobody knows the length of
+	playFor(room, time.Hour)
+	if rm.NearEnd("room", 10) {
+		t.Error("song of unknown duration is near its end")
+	}
+	if rm.NearEnd("room", 11) {
+		t.Error("song that is not playing is near its end")
+	}
+
+	rm.StartSong("room", 10)
+	rm.SetDuration("room", 10, 180)
+	if rm.NearEnd("room", 10) {
+		t.Error("song that just started is near its end")
+	}
+
+	playFor(room, 178*time.Second)
+	if !rm.NearEnd("room", 10) {
+		t.Error("song 2s before its end is not near it")
+	}
+}
+
+func TestSetDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		played   time.Duration
+		known    float64
+		songID   uint
+		duration float64
+		want     bool
+	}{
+		{name: "first report", duration: 180, want: true},
+		{name: "already known", known: 200, duration: 180},
+		{name: "another song", songID: 11, duration: 180},
+		{name: "longer than played", played: time.Minute, duration: 180, want: true},
+		{name: "shorter than played", played: time.Minute, duration: 30},
+		{name: "zero", duration: 0},
+		{name: "too long", duration: (maxSongDuration + time.Second).Seconds()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := NewRoomManager()
+			room := rm.CreateRoom("room", "1", "creator")
+			rm.StartSong("room", 10)
+			if tt.known > 0 {
+				rm.SetDuration("room", 10, tt.known)
+			}
+			playFor(room, tt.played)
+
+			songID := tt.songID
+			if songID == 0 {
+				songID = 10
+			}
+			if got := rm.SetDuration("room", songID, tt.duration); got != tt.want {
+				t.Fatalf("SetDuration = %v; want %v", got, tt.want)
+			}
+			want := tt.known
+			if tt.want {
+				want = tt.duration
+			}
+			if room.Duration != want {
+				t.Errorf("duration = %v; want %v", room.Duration, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	maxQueueLength   = 100 // Songs waiting in one room
+	maxQueuedPerUser = 5   // Songs one user may have waiting
+)
+
+// QueueItem is a song waiting to be played in a room
+type QueueItem struct {
+	ID          string    `json:"id"`
+	SongID      uint      `json:"song_id"`
+	Title       string    `json:"title"`
+	AddedBy     string    `json:"added_by"` // User ID
+	AddedByName string    `json:"added_by_name"`
+	Upvotes     []string  `json:"upvotes"` // User IDs
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// hasUpvote reports whether a user upvoted the item
+func (item *QueueItem) hasUpvote(userID string) bool {
+	for _, id := range item.Upvotes {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// QueueState is a room's queue and the skip votes for its current song
+type QueueState struct {
+	Items     []QueueItem `json:"items"`
+	SkipVotes []string    `json:"skip_votes,omitempty"`
+}
+
+// queueState copies the room's queue. Callers must hold r.Mutex.
+func (r *Room) queueState() QueueState {
+	state := QueueState{Items: make([]QueueItem, len(r.Queue))}
+	for i, item := range r.Queue {
+		item.Upvotes = append([]string(nil), item.Upvotes...)
+		state.Items[i] = item
+	}
+	for userID := range r.SkipVotes {
+		state.SkipVotes = append(state.SkipVotes, userID)
+	}
+	return state
+}
+
+// applyQueueState replaces the room's queue. Callers must hold r.Mutex.
+func (r *Room) applyQueueState(state QueueState) {
+	r.Queue = append([]QueueItem(nil), state.Items...)
+	r.SkipVotes = make(map[string]bool, len(state.SkipVotes))
+	for _, userID := range state.SkipVotes {
+		r.SkipVotes[userID] = true
+	}
+}
+
+// findQueueItem returns the position of an item in the queue, or -1.
+// Callers must hold r.Mutex.
+func (r *Room) findQueueItem(itemID string) int {
+	for i, item := range r.Queue {
+		if item.ID == itemID {
+			return i
+		}
+	}
+	return -1
+}
+
+// bubbleUp moves the item at i ahead of the items before it that have
+// fewer upvotes. Items with as many upvotes keep their place, so the
+// host's order holds until the listeners disagree. Callers must hold
+// r.Mutex.
+func (r *Room) bubbleUp(i int) {
+	for i > 0 && len(r.Queue[i-1].Upvotes) < len(r.Queue[i].Upvotes) {
+		r.Queue[i-1], r.Queue[i] = r.Queue[i], r.Queue[i-1]
+		i--
+	}
+}
+
+// Enqueue adds a song to the end of the client's room queue
+func (rm *RoomManager) Enqueue(client *Client, songID uint, title string) error {
+	return rm.changeQueue(client.RoomID, func(room *Room) error {
+		if len(room.Queue) >= maxQueueLength {
+			return &RoomError{Message: "The queue is full"}
+		}
+		queued := 0
+		for _, item := range room.Queue {
+			if item.SongID == songID {
+				return &RoomError{Message: "That song is already in the queue"}
+			}
+			if item.AddedBy == client.ID {
+				queued++
+			}
+		}
+		if queued >= maxQueuedPerUser && !room.roleOf(client.ID).AtLeast(RoleCoHost) {
+			return &RoomError{Message: "You already have the most songs allowed in the queue"}
+		}
+
+		room.Queue = append(room.Queue, QueueItem{
+			ID:          newSessionID(),
+			SongID:      songID,
+			Title:       title,
+			AddedBy:     client.ID,
+			AddedByName: client.Username,
+			Upvotes:     []string{},
+			AddedAt:     time.Now(),
+		})
+		return nil
+	})
+}
+
+// ToggleUpvote adds the client's upvote to a queued song, or takes it back
+func (rm *RoomManager) ToggleUpvote(client *Client, itemID string) error {
+	return rm.changeQueue(client.RoomID, func(room *Room) error {
+		i := room.findQueueItem(itemID)
+		if i < 0 {
+			return &RoomError{Message: "That song is no longer in the queue"}
+		}
+
+		item := &room.Queue[i]
+		if !item.hasUpvote(client.ID) {
+			item.Upvotes = append(item.Upvotes, client.ID)
+			room.bubbleUp(i)
+			return nil
+		}
+
+		upvotes := item.Upvotes[:0]
+		for _, userID := range item.Upvotes {
+			if userID != client.ID {
+				upvotes = append(upvotes, userID)
+			}
+		}
+		item.Upvotes = upvotes
+		// Sink below items that now have more upvotes
+		for i+1 < len(room.Queue) && len(room.Queue[i+1].Upvotes) > len(room.Queue[i].Upvotes) {
+			room.Queue[i], room.Queue[i+1] = room.Queue[i+1], room.Queue[i]
+			i++
+		}
+		return nil
+	})
+}
+
+// RemoveFromQueue drops a queued song. Users may remove their own songs;
+// the host and co-hosts may remove any.
+func (rm *RoomManager) RemoveFromQueue(client *Client, itemID string) error {
+	return rm.changeQueue(client.RoomID, func(room *Room) error {
+		i := room.findQueueItem(itemID)
+		if i < 0 {
+			return &RoomError{Message: "That song is no longer in the queue"}
+		}
+		if room.Queue[i].AddedBy != client.ID && !room.roleOf(client.ID).AtLeast(RoleCoHost) {
+			return permissionError(RoleCoHost)
+		}
+		room.Queue = append(room.Queue[:i], room.Queue[i+1:]...)
+		return nil
+	})
+}
+
+// MoveInQueue moves a queued song to a position, counted from 0. Callers
+// check that the client may reorder the queue.
+func (rm *RoomManager) MoveInQueue(client *Client, itemID string, position int) error {
+	return rm.changeQueue(client.RoomID, func(room *Room) error {
+		i := room.findQueueItem(itemID)
+		if i < 0 {
+			return &RoomError{Message: "That song is no longer in the queue"}
+		}
+		position = max(0, min(position, len(room.Queue)-1))
+
+		item := room.Queue[i]
+		room.Queue = append(room.Queue[:i], room.Queue[i+1:]...)
+		room.Queue = append(room.Queue[:position], append([]QueueItem{item}, room.Queue[position:]...)...)
+		return nil
+	})
+}
+
+// VoteSkip adds the client's vote to skip the current song, or takes it
+// back. It reports whether the votes reached threshold, the share of
+// members and above needed to skip.
+func (rm *RoomManager) VoteSkip(client *Client, threshold float64) (bool, error) {
+	reached := false
+	err := rm.changeQueue(client.RoomID, func(room *Room) error {
+		if room.CurrentSongID == nil {
+			return &RoomError{Message: "Nothing is playing"}
+		}
+		if room.SkipVotes[client.ID] {
+			delete(room.SkipVotes, client.ID)
+			return nil
+		}
+		room.SkipVotes[client.ID] = true
+
+		participants := make(map[string]bool)
+		for _, c := range room.Clients {
+			if room.roleOf(c.ID).AtLeast(RoleMember) {
+				participants[c.ID] = true
+			}
+		}
+		votes := 0
+		for userID := range room.SkipVotes {
+			if participants[userID] {
+				votes++
+			}
+		}
+		reached = votes >= skipVotesNeeded(threshold, len(participants))
+		return nil
+	})
+	return reached, err
+}
+
+// skipVotesNeeded is how many of participants must vote to skip a song
+func skipVotesNeeded(threshold float64, participants int) int {
+	return max(1, int(math.Ceil(threshold*float64(participants))))
+}
+
+// AdvanceQueue moves a room past the song fromSongID and returns the queued
+// song to play next, or nil if the queue is empty. It reports false if the
+// room already moved on or is moving on, e.g. because every player asked for
+// the next song when it ended. Callers then play a song with StartSong or
+// SetCurrentSong, which ends the advance, or give up with CancelAdvance.
+func (rm *RoomManager) AdvanceQueue(roomID string, fromSongID uint) (*QueueItem, bool) {
+	var next *QueueItem
+	err := rm.changeQueue(roomID, func(room *Room) error {
+		if room.advancingFrom != nil {
+			return &RoomError{Message: "The song is already changing"}
+		}
+		if room.CurrentSongID != nil && *room.CurrentSongID != fromSongID {
+			return &RoomError{Message: "The song already changed"}
+		}
+
+		// Claim the change so requests for the same song are dropped until
+		// the next song plays, here and on every other instance
+		claimed, err := rm.store.ClaimAdvance(roomID, fromSongID)
+		if err != nil {
+			log.Printf("Error claiming advance of room %s: %v", roomID, err)
+			return err
+		}
+		if !claimed {
+			return &RoomError{Message: "The song is already changing"}
+		}
+		room.advancingFrom = &fromSongID
+		room.SkipVotes = make(map[string]bool)
+		if len(room.Queue) > 0 {
+			item := room.Queue[0]
+			room.Queue = room.Queue[1:]
+			next = &item
+		}
+		return nil
+	})
+	return next, err == nil
+}
+
+// CancelAdvance gives up moving a room on from fromSongID, e.g. when no song
+// is left to play, so a later request may try again
+func (rm *RoomManager) CancelAdvance(roomID string, fromSongID uint) {
+	room, exists := rm.GetRoom(roomID)
+	if !exists {
+		return
+	}
+	room.Mutex.Lock()
+	claimed := room.advancingFrom != nil && *room.advancingFrom == fromSongID
+	if claimed {
+		room.advancingFrom = nil
+	}
+	room.Mutex.Unlock()
+
+	if claimed {
+		rm.releaseAdvance(roomID)
+	}
+}
+
+// releaseAdvance drops the room's claim in the shared store
+func (rm *RoomManager) releaseAdvance(roomID string) {
+	if err := rm.store.ReleaseAdvance(roomID); err != nil {
+		log.Printf("Error releasing advance of room %s: %v", roomID, err)
+	}
+}
+
+// SongMerge is a merge of duplicate songs into a survivor, for the queues
+// still holding the duplicates
+type SongMerge struct {
+	DuplicateIDs []uint `json:"duplicate_ids"`
+	SurvivorID   uint   `json:"survivor_id"`
+	Title        string `json:"title"` // Queue title of the survivor
+}
+
+// Apply points the queued items of the duplicates at the survivor. An item
+// whose song is queued already is dropped, and its upvotes go to the item
+// ahead of it. It reports whether the queue changed.
+func (m SongMerge) Apply(queue []QueueItem) ([]QueueItem, bool) {
+	merged := make([]QueueItem, 0, len(queue))
+	changed := false
+	for _, item := range queue {
+		if slices.Contains(m.DuplicateIDs, item.SongID) {
+			item.SongID = m.SurvivorID
+			item.Title = m.Title
+			changed = true
+		}
+		i := slices.IndexFunc(merged, func(queued QueueItem) bool { return queued.SongID == item.SongID })
+		if i < 0 {
+			merged = append(merged, item)
+			continue
+		}
+		for _, userID := range item.Upvotes {
+			if !merged[i].hasUpvote(userID) {
+				merged[i].Upvotes = append(slices.Clip(merged[i].Upvotes), userID)
+			}
+		}
+	}
+	return merged, changed
+}
+
+// MergeQueuedSongs points the queued items of merged songs at the survivor
+// in every room, whether it is open on this instance, another one or none
+func (rm *RoomManager) MergeQueuedSongs(merge SongMerge) error {
+	if err := rm.store.MergeQueuedSongs(merge); err != nil {
+		return err
+	}
+	rm.mergeLocalQueues(merge)
+	rm.publish(Event{Kind: EventMerge, Merge: &merge})
+	return nil
+}
+
+// mergeLocalQueues applies a song merge to the rooms open on this instance.
+// They are saved again so a queue change racing the merge cannot bring the
+// duplicates back.
+func (rm *RoomManager) mergeLocalQueues(merge SongMerge) {
+	rm.mutex.RLock()
+	rooms := make([]*Room, 0, len(rm.rooms))
+	for _, room := range rm.rooms {
+		rooms = append(rooms, room)
+	}
+	rm.mutex.RUnlock()
+
+	for _, room := range rooms {
+		room.Mutex.Lock()
+		queue, changed := merge.Apply(room.Queue)
+		if !changed {
+			room.Mutex.Unlock()
+			continue
+		}
+		room.Queue = queue
+		state := room.state()
+		queueState := room.queueState()
+		room.Mutex.Unlock()
+
+		if err := rm.store.SaveRoom(state); err != nil {
+			log.Printf("Error saving room %s: %v", room.ID, err)
+		}
+		messageBytes, _ := json.Marshal(queueUpdateMessage(queueState))
+		rm.deliverLocal(room.ID, messageBytes)
+	}
+}
+
+// changeQueue applies a queue change to a room, then saves it, shares it
+// with the other instances and sends the new queue to everyone in the room
+func (rm *RoomManager) changeQueue(roomID string, apply func(room *Room) error) error {
+	room, exists := rm.GetRoom(roomID)
+	if !exists {
+		return &RoomError{Message: "Room not found"}
+	}
+
+	room.Mutex.Lock()
+	if err := apply(room); err != nil {
+		room.Mutex.Unlock()
+		return err
+	}
+	room.LastActivity = time.Now()
+	state := room.state()
+	queue := room.queueState()
+	room.Mutex.Unlock()
+
+	if err := rm.store.SaveRoom(state); err != nil {
+		log.Printf("Error saving room %s: %v", room.ID, err)
+	}
+	rm.publish(Event{RoomID: room.ID, Kind: EventQueue, Queue: &queue})
+	rm.BroadcastToRoom(room.ID, queueUpdateMessage(queue))
+	return nil
+}
+
+// QueueUpdateMessage is the queue_update message for a room's current queue
+func QueueUpdateMessage(room *Room) WSMessage {
+	room.Mutex.RLock()
+	queue := room.queueState()
+	room.Mutex.RUnlock()
+	return queueUpdateMessage(queue)
+}
+
+func queueUpdateMessage(queue QueueState) WSMessage {
+	data, _ := json.Marshal(QueueUpdateData{Items: queue.Items, SkipVotes: queue.SkipVotes})
+	return WSMessage{
+		Type:      MsgQueueUpdate,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+}
+
+func (rm *RoomManager) handleRemoteQueue(event Event) {
+	if event.Queue == nil {
+		return
+	}
+
+	rm.mutex.RLock()
+	room, exists := rm.rooms[event.RoomID]
+	rm.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	room.Mutex.Lock()
+	room.applyQueueState(*event.Queue)
+	room.LastActivity = time.Now()
+	room.Mutex.Unlock()
+}
@@ -0,0 +1,132 @@
+package websocket
+
+import "testing"
+
+func TestAdvanceQueueClaimsOnce(t *testing.T) {
+	rm := NewRoomManager()
+	room := rm.CreateRoom("room", "1", "creator")
+	rm.StartSong("room", 10)
+
+	next, ok := rm.AdvanceQueue("room", 10)
+	if !ok || next != nil {
+		t.Fatalf("first advance = %v, %v; want nil, true", next, ok)
+	}
+	// Every other listener reports the same song ending
+	for i := 0; i < 3; i++ {
+		if _, ok := rm.AdvanceQueue("room", 10); ok {
+			t.Fatal("advanced twice from the same song")
+		}
+	}
+
+	rm.StartSong("room", 20)
+	if _, ok := rm.AdvanceQueue("room", 10); ok {
+		t.Fatal("advanced from a song that is no longer playing")
+	}
+
+	room.Queue = []QueueItem{{ID: "a", SongID: 30}}
+	next, ok = rm.AdvanceQueue("room", 20)
+	if !ok || next == nil || next.SongID != 30 {
+		t.Fatalf("advance = %v, %v; want the queued song", next, ok)
+	}
+	if len(room.Queue) != 0 {
+		t.Fatalf("queue = %v; want it empty", room.Queue)
+	}
+	if _, ok := rm.AdvanceQueue("room", 20); ok {
+		t.Fatal("advanced again before the queued song started")
+	}
+}
+
+func TestCancelAdvance(t *testing.T) {
+	rm := NewRoomManager()
+	rm.CreateRoom("room", "1", "creator")
+	rm.StartSong("room", 10)
+
+	if _, ok := rm.AdvanceQueue("room", 10); !ok {
+		t.Fatal("first advance failed")
+	}
+	// Cancelling another song's advance changes nothing
+	rm.CancelAdvance("room", 11)
+	if _, ok := rm.AdvanceQueue("room", 10); ok {
+		t.Fatal("advanced twice from the same song")
+	}
+
+	rm.CancelAdvance("room", 10)
+	if _, ok := rm.AdvanceQueue("room", 10); !ok {
+		t.Fatal("could not advance again after cancelling")
+	}
+}
+
+func TestAdvanceQueueAcrossInstances(t *testing.T) {
+	store := NewMemoryRoomStore()
+	a := NewRoomManagerWithBackend("rooms", store, NewLocalBroadcaster())
+	b := NewRoomManagerWithBackend("rooms", store, NewLocalBroadcaster())
+	b.CreateRoom("room", "1", "creator")
+	a.CreateRoom("room", "1", "creator")
+	a.StartSong("room", 10)
+
+	// Both clocks see the song end
+	if _, ok := a.AdvanceQueue("room", 10); !ok {
+		t.Fatal("first instance could not advance")
+	}
+	if _, ok := b.AdvanceQueue("room", 10); ok {
+		t.Fatal("second instance advanced the same song end")
+	}
+
+	a.StartSong("room", 20)
+	if _, ok := b.AdvanceQueue("room", 10); ok {
+		t.Fatal("advanced from a song that is no longer playing")
+	}
+	if _, ok := b.AdvanceQueue("room", 20); !ok {
+		t.Fatal("could not advance from the new song")
+	}
+}
+
+func TestSongMergeApply(t *testing.T) {
+	merge := SongMerge{DuplicateIDs: []uint{2, 3}, SurvivorID: 1, Title: "Survivor"}
+	queue := []QueueItem{
+		{ID: "a", SongID: 2, Upvotes: []string{"u1"}},
+		{ID: "b", SongID: 4},
+		{ID: "c", SongID: 1, Upvotes: []string{"u1", "u2"}},
+		{ID: "d", SongID: 3},
+	}
+
+	merged, changed := merge.Apply(queue)
+	if !changed || len(merged) != 2 {
+		t.Fatalf("merged = %+v, %v; want two items", merged, changed)
+	}
+	if merged[0].ID != "a" || merged[0].SongID != 1 || merged[0].Title != "Survivor" {
+		t.Errorf("first item = %+v; want a pointing at the survivor", merged[0])
+	}
+	if len(merged[0].Upvotes) != 2 {
+		t.Errorf("upvotes = %v; want u1 and u2", merged[0].Upvotes)
+	}
+	if len(queue[0].Upvotes) != 1 {
+		t.Errorf("the original queue changed: %+v", queue[0])
+	}
+
+	if _, changed := merge.Apply([]QueueItem{{ID: "b", SongID: 4}}); changed {
+		t.Error("a queue without merged songs changed")
+	}
+}
+
+func TestMergeQueuedSongs(t *testing.T) {
+	store := NewMemoryRoomStore()
+	rm := NewRoomManagerWithBackend("rooms", store, NewLocalBroadcaster())
+	room := rm.CreateRoom("open", "1", "creator")
+	room.Queue = []QueueItem{{ID: "a", SongID: 2}}
+	// A room no instance has open
+	store.SaveRoom(RoomState{ID: "closed", Queue: []QueueItem{{ID: "b", SongID: 2}}})
+
+	if err := rm.MergeQueuedSongs(SongMerge{DuplicateIDs: []uint{2}, SurvivorID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if room.Queue[0].SongID != 1 {
+		t.Errorf("open room queue = %+v; want the survivor", room.Queue)
+	}
+	for _, roomID := range []string{"open", "closed"} {
+		state, _ := store.LoadRoom(roomID)
+		if state.Queue[0].SongID != 1 {
+			t.Errorf("stored %s queue = %+v; want the survivor", roomID, state.Queue)
+		}
+	}
+}
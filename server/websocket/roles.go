@@ -0,0 +1,326 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Role is what a user may do in a room
+type Role string
+
+const (
+	RoleHost      Role = "host"      // Owns the room and manages roles
+	RoleCoHost    Role = "co_host"   // Controls playback and the tournament
+	RoleMember    Role = "member"    // Votes and picks, the default
+	RoleSpectator Role = "spectator" // Watches only
+)
+
+var roleRanks = map[Role]int{
+	RoleSpectator: 1,
+	RoleMember:    2,
+	RoleCoHost:    3,
+	RoleHost:      4,
+}
+
+// AtLeast reports whether r may do what min may do
+func (r Role) AtLeast(min Role) bool {
+	return roleRanks[r] >= roleRanks[min]
+}
+
+// Permissions maps each message type a client may send to the lowest role
+// allowed to send it. Types that are not listed are rejected.
+type Permissions map[MessageType]Role
+
+// moderationMessages are handled by RoomManager.Moderate in every room
+var moderationMessages = map[MessageType]bool{
+	MsgSetRole:      true,
+	MsgKickUser:     true,
+	MsgBanUser:      true,
+	MsgUnbanUser:    true,
+	MsgTransferHost: true,
+}
+
+// IsModeration reports whether a message type is a host action handled by
+// RoomManager.Moderate
+func IsModeration(msgType MessageType) bool {
+	return moderationMessages[msgType]
+}
+
+// RoleState is who runs a room and who may not enter it
+type RoleState struct {
+	HostID string          `json:"host_id"`
+	Roles  map[string]Role `json:"roles,omitempty"`
+	Banned []string        `json:"banned,omitempty"`
+}
+
+// RoleOf returns the role of a user in the room
+func (r *Room) RoleOf(userID string) Role {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+	return r.roleOf(userID)
+}
+
+// roleOf is RoleOf for callers holding r.Mutex
+func (r *Room) roleOf(userID string) Role {
+	if userID == r.CreatorID {
+		return RoleHost
+	}
+	if role, exists := r.Roles[userID]; exists {
+		return role
+	}
+	return RoleMember
+}
+
+// roleState copies the room's roles. Callers must hold r.Mutex.
+func (r *Room) roleState() RoleState {
+	state := RoleState{HostID: r.CreatorID, Roles: make(map[string]Role, len(r.Roles))}
+	for userID, role := range r.Roles {
+		state.Roles[userID] = role
+	}
+	for userID := range r.Banned {
+		state.Banned = append(state.Banned, userID)
+	}
+	return state
+}
+
+// applyRoleState replaces the room's roles. Callers must hold r.Mutex.
+func (r *Room) applyRoleState(state RoleState) {
+	r.CreatorID = state.HostID
+	r.Roles = make(map[string]Role, len(state.Roles))
+	for userID, role := range state.Roles {
+		r.Roles[userID] = role
+	}
+	r.Banned = make(map[string]bool, len(state.Banned))
+	for _, userID := range state.Banned {
+		r.Banned[userID] = true
+	}
+}
+
+// Authorize checks whether a client may send a message type in its room
+func (rm *RoomManager) Authorize(client *Client, msgType MessageType, permissions Permissions) error {
+	required, exists := permissions[msgType]
+	if IsModeration(msgType) {
+		required, exists = RoleHost, true
+	}
+	if !exists {
+		return &RoomError{Message: "This action is not supported in this room"}
+	}
+
+	room, exists := rm.GetRoom(client.RoomID)
+	if !exists {
+		return &RoomError{Message: "Room not found"}
+	}
+	if !room.RoleOf(client.ID).AtLeast(required) {
+		return permissionError(required)
+	}
+	return nil
+}
+
+// Moderate applies a host action sent by actor. The message data is a
+// ModerationData.
+func (rm *RoomManager) Moderate(actor *Client, msg WSMessage) error {
+	var data ModerationData
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.UserID == "" {
+		return &RoomError{Message: "Invalid moderation request"}
+	}
+	if data.UserID == actor.ID {
+		return &RoomError{Message: "You cannot do that to yourself"}
+	}
+
+	switch msg.Type {
+	case MsgSetRole:
+		return rm.SetRole(actor, data.UserID, data.Role)
+	case MsgKickUser:
+		return rm.Kick(actor, data.UserID)
+	case MsgBanUser:
+		return rm.Ban(actor, data.UserID)
+	case MsgUnbanUser:
+		return rm.Unban(actor, data.UserID)
+	case MsgTransferHost:
+		return rm.TransferHost(actor, data.UserID)
+	}
+	return &RoomError{Message: "Unknown moderation request"}
+}
+
+// SetRole promotes or demotes a user. The host role can only be handed over
+// with TransferHost.
+func (rm *RoomManager) SetRole(actor *Client, userID string, role Role) error {
+	if role != RoleCoHost && role != RoleMember && role != RoleSpectator {
+		return &RoomError{Message: "Invalid role"}
+	}
+
+	return rm.changeRoles(actor, func(room *Room) error {
+		if userID == room.CreatorID {
+			return &RoomError{Message: "The host's role can only change by transferring ownership"}
+		}
+		if role == RoleMember {
+			delete(room.Roles, userID)
+		} else {
+			room.Roles[userID] = role
+		}
+		return nil
+	})
+}
+
+// Kick disconnects every connection of a user from the room. They may join
+// again unless they are banned.
+func (rm *RoomManager) Kick(actor *Client, userID string) error {
+	err := rm.changeRoles(actor, func(room *Room) error {
+		if userID == room.CreatorID {
+			return &RoomError{Message: "The host cannot be removed"}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rm.disconnectUser(actor.RoomID, userID, "You were removed from this room")
+	rm.publish(Event{RoomID: actor.RoomID, Kind: EventKick, Member: &Member{UserID: userID}})
+	return nil
+}
+
+// Ban kicks a user and keeps them from joining again
+func (rm *RoomManager) Ban(actor *Client, userID string) error {
+	err := rm.changeRoles(actor, func(room *Room) error {
+		if userID == room.CreatorID {
+			return &RoomError{Message: "The host cannot be banned"}
+		}
+		room.Banned[userID] = true
+		delete(room.Roles, userID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rm.disconnectUser(actor.RoomID, userID, "You were banned from this room")
+	rm.publish(Event{RoomID: actor.RoomID, Kind: EventKick, Member: &Member{UserID: userID}})
+	return nil
+}
+
+// Unban lets a banned user join again
+func (rm *RoomManager) Unban(actor *Client, userID string) error {
+	return rm.changeRoles(actor, func(room *Room) error {
+		delete(room.Banned, userID)
+		return nil
+	})
+}
+
+// TransferHost makes a user in the room the new host. The previous host
+// stays on as co-host.
+func (rm *RoomManager) TransferHost(actor *Client, userID string) error {
+	return rm.changeRoles(actor, func(room *Room) error {
+		present := false
+		for _, client := range room.Clients {
+			if client.ID == userID {
+				present = true
+				break
+			}
+		}
+		if !present {
+			return &RoomError{Message: "Ownership can only go to someone in the room"}
+		}
+
+		room.Roles[room.CreatorID] = RoleCoHost
+		delete(room.Roles, userID)
+		room.CreatorID = userID
+		return nil
+	})
+}
+
+// changeRoles applies a host action to the actor's room, then saves it and
+// shares it with the other instances
+func (rm *RoomManager) changeRoles(actor *Client, apply func(room *Room) error) error {
+	room, exists := rm.GetRoom(actor.RoomID)
+	if !exists {
+		return &RoomError{Message: "Room not found"}
+	}
+
+	room.Mutex.Lock()
+	if room.roleOf(actor.ID) != RoleHost {
+		room.Mutex.Unlock()
+		return permissionError(RoleHost)
+	}
+	if err := apply(room); err != nil {
+		room.Mutex.Unlock()
+		return err
+	}
+	room.LastActivity = time.Now()
+	state := room.state()
+	roles := room.roleState()
+	room.Mutex.Unlock()
+
+	if err := rm.store.SaveRoom(state); err != nil {
+		log.Printf("Error saving room %s: %v", room.ID, err)
+	}
+	rm.publish(Event{RoomID: room.ID, Kind: EventRoles, Roles: &roles})
+
+	// Roles are part of the user list
+	rm.broadcastUserUpdate(room)
+	return nil
+}
+
+// disconnectUser closes every local connection of a user in a room
+func (rm *RoomManager) disconnectUser(roomID, userID, reason string) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	for sessionID, client := range rm.clients {
+		if client.RoomID != roomID || client.ID != userID {
+			continue
+		}
+		client.SendJSON(map[string]interface{}{
+			"type":  MsgError,
+			"error": reason,
+		})
+		rm.removeClientFromRoom(client)
+		delete(rm.clients, sessionID)
+	}
+}
+
+func (rm *RoomManager) handleRemoteRoles(event Event) {
+	if event.Roles == nil {
+		return
+	}
+
+	rm.mutex.RLock()
+	room, exists := rm.rooms[event.RoomID]
+	rm.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	room.Mutex.Lock()
+	room.applyRoleState(*event.Roles)
+	room.LastActivity = time.Now()
+	room.Mutex.Unlock()
+}
+
+func (rm *RoomManager) handleRemoteKick(event Event) {
+	if event.Member == nil {
+		return
+	}
+
+	reason := "You were removed from this room"
+	if room, exists := rm.GetRoom(event.RoomID); exists {
+		room.Mutex.RLock()
+		if room.Banned[event.Member.UserID] {
+			reason = "You were banned from this room"
+		}
+		room.Mutex.RUnlock()
+	}
+	rm.disconnectUser(event.RoomID, event.Member.UserID, reason)
+}
+
+// permissionError explains a rejected action to the client
+func permissionError(required Role) error {
+	switch required {
+	case RoleHost:
+		return &RoomError{Message: "Only the host can do that"}
+	case RoleCoHost:
+		return &RoomError{Message: "Only the host and co-hosts can do that"}
+	}
+	return &RoomError{Message: "Spectators cannot do that"}
+}
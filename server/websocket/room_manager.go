@@ -1,42 +1,137 @@
 package websocket
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/CptPie/SyncRate/server/utils"
 	"github.com/gorilla/websocket"
 )
 
-// Client represents a connected user in a rating room
+// Client represents one connection of a user in a room. A user may have
+// several, e.g. one per tab or device. Clients connected to another
+// instance are tracked too, with a nil Conn.
 type Client struct {
-	ID       string          // User ID
-	Username string          // Username for display
-	Conn     *websocket.Conn // WebSocket connection
-	RoomID   string          // Which room they're in
-	LastSeen time.Time       // For cleanup
+	ID         string          // User ID
+	SessionID  string          // Connection ID, unique per tab or device
+	Username   string          // Username for display
+	Conn       *websocket.Conn // WebSocket connection, nil on other instances
+	RoomID     string          // Which room they're in
+	InstanceID string          // Instance holding the connection
+	LastSeen   time.Time       // Last pong, for cleanup
+
+	send      chan []byte   // Outbound queue drained by writePump
+	done      chan struct{} // Closed when the client is closed
+	closeOnce sync.Once
+	mutex     sync.Mutex // Guards LastSeen on local clients
+}
+
+// IsLocal reports whether the client is connected to this instance
+func (c *Client) IsLocal() bool {
+	return c.Conn != nil
 }
 
 // Room represents an active rating room with connected clients
 type Room struct {
 	ID            string             // Room code
-	CreatorID     string             // Creator user ID
-	Clients       map[string]*Client // Connected clients by user ID
+	CreatorID     string             // Host user ID, the creator until ownership is transferred
+	Roles         map[string]Role    // Roles other than member and host by user ID
+	Banned        map[string]bool    // User IDs that may not join
+	Queue         []QueueItem        // Songs to play next, in order
+	SkipVotes     map[string]bool    // User IDs voting to skip the current song
+	Clients       map[string]*Client // Connected clients by session ID, on any instance
 	CurrentSongID *uint              // Current song being rated
-	VideoTime     float64            // Current video position in seconds
+	VideoTime     float64            // Video position in seconds when last paused or synced
 	IsPlaying     bool               // Video play state
+	StartedAt     time.Time          // When the song was at 0s, shifted by pauses and seeks
+	Duration      float64            // Length of the current song in seconds, 0 if unknown
 	LastActivity  time.Time          // For cleanup
 	Mutex         sync.RWMutex       // Thread safety
+
+	// advancingFrom is the song AdvanceQueue is moving the room on from,
+	// until StartSong or SetCurrentSong plays the next one
+	advancingFrom *uint
 }
 
-// RoomManager manages all active rating rooms
+// Users returns everyone in the room once, ordered by username, with the
+// number of connections each of them has open
+func (r *Room) Users() []UserInfo {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+
+	index := make(map[string]int)
+	users := make([]UserInfo, 0, len(r.Clients))
+	for _, client := range r.Clients {
+		if i, exists := index[client.ID]; exists {
+			users[i].Devices++
+			continue
+		}
+		index[client.ID] = len(users)
+		users = append(users, UserInfo{
+			ID:       client.ID,
+			Username: client.Username,
+			Role:     r.roleOf(client.ID),
+			Devices:  1,
+		})
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Username != users[j].Username {
+			return users[i].Username < users[j].Username
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// state snapshots what the room store keeps. Callers must hold r.Mutex.
+func (r *Room) state() RoomState {
+	roles := r.roleState()
+	queue := r.queueState()
+	return RoomState{
+		ID:            r.ID,
+		CreatorID:     r.CreatorID,
+		CurrentSongID: r.CurrentSongID,
+		VideoTime:     r.VideoTime,
+		IsPlaying:     r.IsPlaying,
+		StartedAt:     r.StartedAt,
+		Duration:      r.Duration,
+		LastActivity:  r.LastActivity,
+		Roles:         roles.Roles,
+		Banned:        roles.Banned,
+		Queue:         queue.Items,
+		SkipVotes:     queue.SkipVotes,
+	}
+}
+
+// RoomManager manages all active rooms of one kind. Room state is kept in a
+// RoomStore and room traffic goes through a Broadcaster, so instances that
+// share a backend serve the same rooms.
 type RoomManager struct {
-	rooms   map[string]*Room // Active rooms by room ID
-	clients map[string]*Client // All connected clients by user ID
-	mutex   sync.RWMutex      // Thread safety
+	rooms   map[string]*Room   // Active rooms by room ID
+	clients map[string]*Client // Locally connected clients by session ID
+	mutex   sync.RWMutex       // Thread safety
+
+	topic       string // Kind of room, the same on every instance
+	instanceID  string // Identifies this manager in memberships and events
+	store       RoomStore
+	broadcaster Broadcaster
+	outbox      chan Event
 }
 
+const (
+	// memberHeartbeat is how often local memberships are refreshed
+	memberHeartbeat = 30 * time.Second
+	// memberTTL is how long a membership survives without a heartbeat,
+	// e.g. after the instance holding it crashed
+	memberTTL = 3 * memberHeartbeat
+)
+
 // Message types for WebSocket communication
 type MessageType string
 
@@ -50,6 +145,35 @@ const (
 	MsgNextSong      MessageType = "next_song"
 	MsgRoomSettings  MessageType = "room_settings"
 	MsgError         MessageType = "error"
+
+	// Rating rooms: the host ends the session, everyone gets the summary
+	MsgEndSession     MessageType = "end_session"
+	MsgSessionSummary MessageType = "session_summary"
+
+	// Tournament rooms
+	MsgStartTournament MessageType = "start_tournament"
+	MsgStartMatch      MessageType = "start_match"
+	MsgPickWinner      MessageType = "pick_winner"
+	MsgNavigateMatch   MessageType = "navigate_match"
+
+	// Host actions, see RoomManager.Moderate
+	MsgSetRole      MessageType = "set_role"
+	MsgKickUser     MessageType = "kick_user"
+	MsgBanUser      MessageType = "ban_user"
+	MsgUnbanUser    MessageType = "unban_user"
+	MsgTransferHost MessageType = "transfer_host"
+
+	// Radio room queue, see queue.go
+	MsgSongEnded   MessageType = "song_ended"
+	MsgQueueAdd    MessageType = "queue_add"
+	MsgQueueUpvote MessageType = "queue_upvote"
+	MsgQueueRemove MessageType = "queue_remove"
+	MsgQueueMove   MessageType = "queue_move"
+	MsgVoteSkip    MessageType = "vote_skip"
+	MsgQueueUpdate MessageType = "queue_update"
+
+	// Radio room playback clock, see playback.go
+	MsgSongDuration MessageType = "song_duration"
 )
 
 // WebSocket message structure
@@ -94,6 +218,8 @@ type SongChangeData struct {
 	SongTitleOriginal string            `json:"song_title_original"`
 	SongTitleEnglish  string            `json:"song_title_english"`
 	EmbedURL          string            `json:"embed_url"`
+	Provider          string            `json:"provider"`
+	Capabilities      utils.PlayerCapabilities `json:"capabilities"`
 	ThumbnailURL      string            `json:"thumbnail_url"`
 	Artists           []ArtistData      `json:"artists"`
 	Units             []UnitData        `json:"units"`
@@ -103,9 +229,19 @@ type SongChangeData struct {
 	ExistingVotes     []VoteUpdateData  `json:"existing_votes"`
 }
 
+// VideoSyncData is a player position. Syncs sent by the server name the
+// song they are for.
 type VideoSyncData struct {
 	Time      float64 `json:"time"`
 	IsPlaying bool    `json:"is_playing"`
+	SongID    uint    `json:"song_id,omitempty"`
+	Duration  float64 `json:"duration,omitempty"`
+}
+
+// SongDurationData is the length of a song as a player reports it
+type SongDurationData struct {
+	SongID   uint    `json:"song_id"`
+	Duration float64 `json:"duration"` // Seconds
 }
 
 type VoteUpdateData struct {
@@ -119,129 +255,229 @@ type UserUpdateData struct {
 	Users []UserInfo `json:"users"`
 }
 
+// UserInfo is one user in a room, however many connections they have
 type UserInfo struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	Devices  int    `json:"devices"` // Open connections (tabs, devices)
+}
+
+// ModerationData is the payload of host actions. Role is only used by
+// MsgSetRole.
+type ModerationData struct {
+	UserID string `json:"user_id"`
+	Role   Role   `json:"role,omitempty"`
+}
+
+// NextSongData names the song a next_song or song_ended message moves past
+type NextSongData struct {
+	SongID uint `json:"song_id"`
+}
+
+// QueueRequestData is the payload of queue messages. SongID is used by
+// MsgQueueAdd and Position by MsgQueueMove; the others name an ItemID.
+type QueueRequestData struct {
+	SongID   uint   `json:"song_id,omitempty"`
+	ItemID   string `json:"item_id,omitempty"`
+	Position int    `json:"position,omitempty"`
+}
+
+type QueueUpdateData struct {
+	Items     []QueueItem `json:"items"`
+	SkipVotes []string    `json:"skip_votes"` // User IDs
+}
+
+// CompatibilityData is how alike two room members rate, see
+// database.Compatibility
+type CompatibilityData struct {
+	UserA                  string   `json:"user_a"`
+	UsernameA              string   `json:"username_a"`
+	UserB                  string   `json:"user_b"`
+	UsernameB              string   `json:"username_b"`
+	Overlap                int64    `json:"overlap"`
+	Correlation            *float64 `json:"correlation"`
+	MeanAbsoluteDifference float64  `json:"mean_absolute_difference"`
+}
+
+// SessionSummaryData ranks the members of a rating room by pairwise
+// compatibility, most compatible pair first
+type SessionSummaryData struct {
+	Pairs []CompatibilityData `json:"pairs"`
 }
 
 type RoomSettingsData struct {
-	VideoSyncEnabled bool `json:"video_sync_enabled"`
+	VideoSyncEnabled bool    `json:"video_sync_enabled"`
+	SkipThreshold    float64 `json:"skip_threshold,omitempty"` // Share of listeners needed to skip, radio rooms only
 }
 
-// NewRoomManager creates a new room manager
+// NewRoomManager creates a room manager that keeps all state in process memory
 func NewRoomManager() *RoomManager {
-	return &RoomManager{
-		rooms:   make(map[string]*Room),
-		clients: make(map[string]*Client),
+	return NewRoomManagerWithBackend("rooms", NewMemoryRoomStore(), NewLocalBroadcaster())
+}
+
+// NewRoomManagerWithBackend creates a room manager for one kind of room.
+// Managers on different instances that share the topic, store and
+// broadcaster backend serve the same set of rooms.
+func NewRoomManagerWithBackend(topic string, store RoomStore, broadcaster Broadcaster) *RoomManager {
+	rm := &RoomManager{
+		rooms:       make(map[string]*Room),
+		clients:     make(map[string]*Client),
+		topic:       topic,
+		instanceID:  newInstanceID(),
+		store:       store,
+		broadcaster: broadcaster,
+		outbox:      make(chan Event, 1024),
 	}
+
+	broadcaster.Subscribe(topic, rm.handleEvent)
+	go rm.runOutbox()
+	go rm.heartbeat()
+
+	return rm
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 // CreateRoom creates a new rating room
 func (rm *RoomManager) CreateRoom(roomID, creatorID, creatorUsername string) *Room {
 	rm.mutex.Lock()
-	defer rm.mutex.Unlock()
-
 	room := &Room{
 		ID:           roomID,
 		CreatorID:    creatorID,
+		Roles:        make(map[string]Role),
+		Banned:       make(map[string]bool),
+		SkipVotes:    make(map[string]bool),
 		Clients:      make(map[string]*Client),
 		LastActivity: time.Now(),
 	}
-
 	rm.rooms[roomID] = room
+	rm.mutex.Unlock()
+
+	if err := rm.store.SaveRoom(RoomState{ID: roomID, CreatorID: creatorID, LastActivity: room.LastActivity}); err != nil {
+		log.Printf("Error saving room %s: %v", roomID, err)
+	}
+
 	log.Printf("Created room %s by user %s", roomID, creatorID)
 	return room
 }
 
-// JoinRoom adds a client to a room
-func (rm *RoomManager) JoinRoom(roomID, userID, username string, conn *websocket.Conn) error {
+// JoinRoom adds a new connection of a user to a room. Other connections
+// of the same user stay connected. Once joined, all writes to conn must go
+// through the returned client.
+func (rm *RoomManager) JoinRoom(roomID, userID, username string, conn *websocket.Conn) (*Client, error) {
 	rm.mutex.Lock()
 	defer rm.mutex.Unlock()
 
-	// Check if user is already in another room
-	if existingClient, exists := rm.clients[userID]; exists {
-		// Remove from previous room
-		rm.removeClientFromRoom(existingClient)
+	// Get room, restoring it from the room store if needed
+	room, exists := rm.loadRoom(roomID)
+	if !exists {
+		return nil, &RoomError{Message: "Room not found"}
 	}
 
-	// Get or create room
-	room, exists := rm.rooms[roomID]
-	if !exists {
-		return &RoomError{Message: "Room not found"}
+	room.Mutex.RLock()
+	banned := room.Banned[userID]
+	room.Mutex.RUnlock()
+	if banned {
+		return nil, &RoomError{Message: "You are banned from this room"}
 	}
 
 	// Create client
-	client := &Client{
-		ID:       userID,
-		Username: username,
-		Conn:     conn,
-		RoomID:   roomID,
-		LastSeen: time.Now(),
-	}
+	client := newLocalClient(userID, username, roomID, rm.instanceID, conn)
 
 	// Add to room and global clients
 	room.Mutex.Lock()
-	room.Clients[userID] = client
+	room.Clients[client.SessionID] = client
 	room.LastActivity = time.Now()
 	room.Mutex.Unlock()
 
-	rm.clients[userID] = client
+	rm.clients[client.SessionID] = client
+
+	// Record the membership so other instances and restarts see it
+	member := Member{
+		UserID:     userID,
+		SessionID:  client.SessionID,
+		Username:   username,
+		InstanceID: rm.instanceID,
+		LastSeen:   client.LastSeen,
+	}
+	if err := rm.store.AddMember(roomID, member); err != nil {
+		log.Printf("Error saving membership of user %s in room %s: %v", userID, roomID, err)
+	}
+	rm.publish(Event{RoomID: roomID, Kind: EventJoin, Member: &member})
 
 	// Notify other users
 	rm.broadcastUserUpdate(room)
 
 	log.Printf("User %s joined room %s", username, roomID)
-	return nil
+	return client, nil
 }
 
-// LeaveRoom removes a client from their current room
-func (rm *RoomManager) LeaveRoom(userID string) {
+// LeaveRoom removes a connection from its room
+func (rm *RoomManager) LeaveRoom(sessionID string) {
 	rm.mutex.Lock()
 	defer rm.mutex.Unlock()
 
-	if client, exists := rm.clients[userID]; exists {
+	if client, exists := rm.clients[sessionID]; exists {
 		rm.removeClientFromRoom(client)
-		delete(rm.clients, userID)
+		delete(rm.clients, sessionID)
 	}
 }
 
-// BroadcastToRoom sends a message to all clients in a room
+// BroadcastToRoom sends a message to all clients in a room, on every instance
 func (rm *RoomManager) BroadcastToRoom(roomID string, message WSMessage) {
+	messageBytes, _ := json.Marshal(message)
+
+	rm.deliverLocal(roomID, messageBytes)
+	rm.publish(Event{RoomID: roomID, Kind: EventMessage, Message: messageBytes})
+}
+
+// GetRoom returns a room by ID, restoring it from the room store if it was
+// created on another instance or before a restart
+func (rm *RoomManager) GetRoom(roomID string) (*Room, bool) {
 	rm.mutex.RLock()
 	room, exists := rm.rooms[roomID]
 	rm.mutex.RUnlock()
-
-	if !exists {
-		return
+	if exists {
+		return room, true
 	}
 
-	room.Mutex.RLock()
-	defer room.Mutex.RUnlock()
-
-	messageBytes, _ := json.Marshal(message)
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	return rm.loadRoom(roomID)
+}
 
-	for _, client := range room.Clients {
-		if err := client.Conn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
-			log.Printf("Error sending message to client %s: %v", client.ID, err)
-			// Client will be cleaned up by connection handler
-		}
-	}
+// SetCurrentSong records the song a room is on and rewinds its video
+func (rm *RoomManager) SetCurrentSong(roomID string, songID uint) {
+	rm.updatePlayback(roomID, func(room *Room) {
+		room.CurrentSongID = &songID
+		room.advancingFrom = nil
+		room.VideoTime = 0
+		room.IsPlaying = false
+		room.StartedAt = time.Now()
+		room.Duration = 0
+	})
+	rm.releaseAdvance(roomID)
 }
 
-// GetRoom returns a room by ID
-func (rm *RoomManager) GetRoom(roomID string) (*Room, bool) {
-	rm.mutex.RLock()
-	defer rm.mutex.RUnlock()
-	room, exists := rm.rooms[roomID]
-	return room, exists
+// UpdatePlayback records the video position and play state of a room
+func (rm *RoomManager) UpdatePlayback(roomID string, videoTime float64, isPlaying bool) {
+	rm.updatePlayback(roomID, func(room *Room) {
+		room.VideoTime = videoTime
+		room.IsPlaying = isPlaying
+		room.StartedAt = time.Now().Add(-time.Duration(videoTime * float64(time.Second)))
+	})
 }
 
 // CleanupInactiveRooms removes rooms with no active clients
 func (rm *RoomManager) CleanupInactiveRooms(timeout time.Duration) {
 	rm.mutex.Lock()
-	defer rm.mutex.Unlock()
-
 	now := time.Now()
+	var removed []string
 	for roomID, room := range rm.rooms {
 		room.Mutex.RLock()
 		clientCount := len(room.Clients)
@@ -250,22 +486,157 @@ func (rm *RoomManager) CleanupInactiveRooms(timeout time.Duration) {
 
 		if clientCount == 0 && now.Sub(lastActivity) > timeout {
 			delete(rm.rooms, roomID)
+			removed = append(removed, roomID)
 			log.Printf("Cleaned up inactive room %s", roomID)
 		}
 	}
+	rm.mutex.Unlock()
+
+	for _, roomID := range removed {
+		if err := rm.store.DeleteRoom(roomID); err != nil {
+			log.Printf("Error deleting room %s from room store: %v", roomID, err)
+		}
+		rm.publish(Event{RoomID: roomID, Kind: EventDeleted})
+	}
+
+	// Rooms this instance never loaded, e.g. ones whose instance went away
+	if err := rm.store.DeleteInactiveRooms(now.Add(-timeout)); err != nil {
+		log.Printf("Error cleaning up room store: %v", err)
+	}
 }
 
 // Helper functions
 
+// loadRoom returns a loaded room or rebuilds it from the room store.
+// Callers must hold rm.mutex.
+func (rm *RoomManager) loadRoom(roomID string) (*Room, bool) {
+	if room, exists := rm.rooms[roomID]; exists {
+		return room, true
+	}
+
+	state, err := rm.store.LoadRoom(roomID)
+	if err != nil {
+		log.Printf("Error loading room %s from room store: %v", roomID, err)
+		return nil, false
+	}
+	if state == nil {
+		return nil, false
+	}
+
+	room := &Room{
+		ID:            state.ID,
+		CreatorID:     state.CreatorID,
+		Clients:       make(map[string]*Client),
+		CurrentSongID: state.CurrentSongID,
+		VideoTime:     state.VideoTime,
+		IsPlaying:     state.IsPlaying,
+		StartedAt:     state.StartedAt,
+		Duration:      state.Duration,
+		LastActivity:  state.LastActivity,
+	}
+	room.applyRoleState(RoleState{HostID: state.CreatorID, Roles: state.Roles, Banned: state.Banned})
+	room.applyQueueState(QueueState{Items: state.Queue, SkipVotes: state.SkipVotes})
+	rm.syncRemoteMembers(room, state.Members)
+	rm.rooms[roomID] = room
+
+	log.Printf("Restored room %s from room store", roomID)
+	return room, true
+}
+
+// syncRemoteMembers replaces the room's remote clients with the members
+// other instances still keep alive. It reports whether anything changed.
+func (rm *RoomManager) syncRemoteMembers(room *Room, members []Member) bool {
+	cutoff := time.Now().Add(-memberTTL)
+
+	room.Mutex.Lock()
+	defer room.Mutex.Unlock()
+
+	remote := make(map[string]*Client)
+	for _, member := range members {
+		if member.InstanceID == rm.instanceID || member.LastSeen.Before(cutoff) {
+			continue
+		}
+		remote[member.SessionID] = &Client{
+			ID:         member.UserID,
+			SessionID:  member.SessionID,
+			Username:   member.Username,
+			RoomID:     room.ID,
+			InstanceID: member.InstanceID,
+			LastSeen:   member.LastSeen,
+		}
+	}
+
+	changed := false
+	for sessionID, client := range room.Clients {
+		if client.IsLocal() {
+			continue
+		}
+		if _, exists := remote[sessionID]; !exists {
+			delete(room.Clients, sessionID)
+			changed = true
+		}
+	}
+	for sessionID, client := range remote {
+		if _, exists := room.Clients[sessionID]; !exists {
+			changed = true
+		}
+		room.Clients[sessionID] = client
+	}
+	return changed
+}
+
+func (rm *RoomManager) updatePlayback(roomID string, apply func(room *Room)) {
+	room, exists := rm.GetRoom(roomID)
+	if !exists {
+		return
+	}
+
+	room.Mutex.Lock()
+	apply(room)
+	room.LastActivity = time.Now()
+	state := room.state()
+	room.Mutex.Unlock()
+
+	if err := rm.store.SaveRoom(state); err != nil {
+		log.Printf("Error saving room %s: %v", roomID, err)
+	}
+	rm.publish(Event{
+		RoomID: roomID,
+		Kind:   EventPlayback,
+		Playback: &PlaybackState{
+			CurrentSongID: state.CurrentSongID,
+			VideoTime:     state.VideoTime,
+			IsPlaying:     state.IsPlaying,
+			StartedAt:     state.StartedAt,
+			Duration:      state.Duration,
+		},
+	})
+}
+
+// removeClientFromRoom drops a local client. Callers must hold rm.mutex.
 func (rm *RoomManager) removeClientFromRoom(client *Client) {
 	if room, exists := rm.rooms[client.RoomID]; exists {
 		room.Mutex.Lock()
-		delete(room.Clients, client.ID)
+		delete(room.Clients, client.SessionID)
 		room.LastActivity = time.Now()
 		room.Mutex.Unlock()
 
 		// Close connection
-		client.Conn.Close()
+		client.Close()
+
+		if err := rm.store.RemoveMember(client.RoomID, client.SessionID, rm.instanceID); err != nil {
+			log.Printf("Error removing membership of user %s in room %s: %v", client.ID, client.RoomID, err)
+		}
+		rm.publish(Event{
+			RoomID: client.RoomID,
+			Kind:   EventLeave,
+			Member: &Member{
+				UserID:     client.ID,
+				SessionID:  client.SessionID,
+				Username:   client.Username,
+				InstanceID: rm.instanceID,
+			},
+		})
 
 		// Notify other users
 		rm.broadcastUserUpdate(room)
@@ -275,24 +646,214 @@ func (rm *RoomManager) removeClientFromRoom(client *Client) {
 }
 
 func (rm *RoomManager) broadcastUserUpdate(room *Room) {
+	go rm.BroadcastToRoom(room.ID, userUpdateMessage(room))
+}
+
+func userUpdateMessage(room *Room) WSMessage {
+	data, _ := json.Marshal(UserUpdateData{Users: room.Users()})
+	return WSMessage{
+		Type:      MsgUserUpdate,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+}
+
+// deliverLocal writes a message to the clients connected to this instance
+func (rm *RoomManager) deliverLocal(roomID string, messageBytes []byte) {
+	rm.mutex.RLock()
+	room, exists := rm.rooms[roomID]
+	rm.mutex.RUnlock()
+
+	if !exists {
+		return
+	}
+
 	room.Mutex.RLock()
-	users := make([]UserInfo, 0, len(room.Clients))
+	defer room.Mutex.RUnlock()
+
 	for _, client := range room.Clients {
-		users = append(users, UserInfo{
-			ID:       client.ID,
-			Username: client.Username,
-		})
+		if !client.IsLocal() {
+			continue
+		}
+		// Never blocks; a client that cannot keep up is dropped and
+		// cleaned up by its connection handler
+		client.Send(messageBytes)
+	}
+}
+
+// ============= CROSS-INSTANCE EVENTS =============
+
+// publish queues an event for the broadcaster. Events leave in the order
+// they were queued, and callers may hold rm.mutex.
+func (rm *RoomManager) publish(event Event) {
+	event.Topic = rm.topic
+	event.Origin = rm.instanceID
+	rm.outbox <- event
+}
+
+func (rm *RoomManager) runOutbox() {
+	for event := range rm.outbox {
+		if err := rm.broadcaster.Publish(event); err != nil {
+			log.Printf("Error publishing %s event for room %s: %v", event.Kind, event.RoomID, err)
+		}
+	}
+}
+
+// handleEvent applies an event published by another instance
+func (rm *RoomManager) handleEvent(event Event) {
+	if event.Origin == rm.instanceID {
+		return
+	}
+
+	switch event.Kind {
+	case EventMessage:
+		rm.deliverLocal(event.RoomID, event.Message)
+	case EventJoin:
+		rm.handleRemoteJoin(event)
+	case EventLeave:
+		rm.handleRemoteLeave(event)
+	case EventPlayback:
+		rm.handleRemotePlayback(event)
+	case EventDeleted:
+		rm.handleRemoteDelete(event)
+	case EventRoles:
+		rm.handleRemoteRoles(event)
+	case EventKick:
+		rm.handleRemoteKick(event)
+	case EventQueue:
+		rm.handleRemoteQueue(event)
+	case EventMerge:
+		if event.Merge != nil {
+			rm.mergeLocalQueues(*event.Merge)
+		}
+	}
+}
+
+func (rm *RoomManager) handleRemoteJoin(event Event) {
+	if event.Member == nil {
+		return
+	}
+	member := *event.Member
+
+	rm.mutex.RLock()
+	room, exists := rm.rooms[event.RoomID]
+	rm.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	room.Mutex.Lock()
+	room.Clients[member.SessionID] = &Client{
+		ID:         member.UserID,
+		SessionID:  member.SessionID,
+		Username:   member.Username,
+		RoomID:     event.RoomID,
+		InstanceID: member.InstanceID,
+		LastSeen:   member.LastSeen,
+	}
+	room.LastActivity = time.Now()
+	room.Mutex.Unlock()
+}
+
+func (rm *RoomManager) handleRemoteLeave(event Event) {
+	if event.Member == nil {
+		return
+	}
+
+	rm.mutex.RLock()
+	room, exists := rm.rooms[event.RoomID]
+	rm.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	room.Mutex.Lock()
+	if client, exists := room.Clients[event.Member.SessionID]; exists && !client.IsLocal() {
+		delete(room.Clients, event.Member.SessionID)
+	}
+	room.LastActivity = time.Now()
+	room.Mutex.Unlock()
+}
+
+func (rm *RoomManager) handleRemotePlayback(event Event) {
+	if event.Playback == nil {
+		return
+	}
+
+	rm.mutex.RLock()
+	room, exists := rm.rooms[event.RoomID]
+	rm.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	room.Mutex.Lock()
+	room.CurrentSongID = event.Playback.CurrentSongID
+	room.VideoTime = event.Playback.VideoTime
+	room.IsPlaying = event.Playback.IsPlaying
+	room.StartedAt = event.Playback.StartedAt
+	room.Duration = event.Playback.Duration
+	room.LastActivity = time.Now()
+	room.Mutex.Unlock()
+}
+
+func (rm *RoomManager) handleRemoteDelete(event Event) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	room, exists := rm.rooms[event.RoomID]
+	if !exists {
+		return
+	}
+
+	room.Mutex.RLock()
+	localClients := 0
+	for _, client := range room.Clients {
+		if client.IsLocal() {
+			localClients++
+		}
 	}
 	room.Mutex.RUnlock()
 
-	data, _ := json.Marshal(UserUpdateData{Users: users})
-	message := WSMessage{
-		Type:      MsgUserUpdate,
-		Data:      data,
-		Timestamp: time.Now(),
+	if localClients == 0 {
+		delete(rm.rooms, event.RoomID)
 	}
+}
 
-	go rm.BroadcastToRoom(room.ID, message)
+// heartbeat keeps this instance's memberships alive and drops clients of
+// instances that stopped without leaving their rooms
+func (rm *RoomManager) heartbeat() {
+	ticker := time.NewTicker(memberHeartbeat)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if err := rm.store.TouchMembers(rm.instanceID, now); err != nil {
+			log.Printf("Error refreshing room memberships: %v", err)
+		}
+		if err := rm.store.DeleteStaleMembers(now.Add(-memberTTL)); err != nil {
+			log.Printf("Error removing stale room memberships: %v", err)
+		}
+
+		rm.mutex.RLock()
+		rooms := make([]*Room, 0, len(rm.rooms))
+		for _, room := range rm.rooms {
+			rooms = append(rooms, room)
+		}
+		rm.mutex.RUnlock()
+
+		for _, room := range rooms {
+			state, err := rm.store.LoadRoom(room.ID)
+			if err != nil || state == nil {
+				continue
+			}
+			if rm.syncRemoteMembers(room, state.Members) {
+				// Every instance runs this, so only tell local clients
+				messageBytes, _ := json.Marshal(userUpdateMessage(room))
+				rm.deliverLocal(room.ID, messageBytes)
+			}
+		}
+	}
 }
 
 // Custom error type
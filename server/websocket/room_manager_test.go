@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// presence lists the users of a room as "id:username:devices"
+func presence(room *Room) []string {
+	var users []string
+	for _, user := range room.Users() {
+		users = append(users, fmt.Sprintf("%s:%s:%d", user.ID, user.Username, user.Devices))
+	}
+	return users
+}
+
+// waitForPresence polls a room until its users match want
+func waitForPresence(t *testing.T, room *Room, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.Equal(presence(room), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("users = %v; want %v", presence(room), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func joinRoom(t *testing.T, rm *RoomManager, roomID, userID, username string) (*Client, *websocket.Conn) {
+	t.Helper()
+	serverConn, peer := newConnPair(t)
+	client, err := rm.JoinRoom(roomID, userID, username, serverConn)
+	if err != nil {
+		t.Fatalf("JoinRoom %s: %v", username, err)
+	}
+	return client, peer
+}
+
+func TestPresenceGroupsSessionsByUser(t *testing.T) {
+	rm := NewRoomManager()
+	room := rm.CreateRoom("room", "1", "alice")
+
+	laptop, _ := joinRoom(t, rm, "room", "1", "alice")
+	phone, _ := joinRoom(t, rm, "room", "1", "alice")
+	_, bobPeer := joinRoom(t, rm, "room", "2", "bob")
+	waitForPresence(t, room, []string{"1:alice:2", "2:bob:1"})
+
+	// Others see alice once, with both of her devices
+	bobPeer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg WSMessage
+		if err := bobPeer.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for a user update: %v", err)
+		}
+		if msg.Type != MsgUserUpdate {
+			continue
+		}
+		var update UserUpdateData
+		json.Unmarshal(msg.Data, &update)
+		if len(update.Users) == 2 && update.Users[0].Devices == 2 {
+			break
+		}
+	}
+
+	// Closing one tab keeps alice in the room
+	rm.LeaveRoom(laptop.SessionID)
+	waitForPresence(t, room, []string{"1:alice:1", "2:bob:1"})
+
+	rm.LeaveRoom(phone.SessionID)
+	waitForPresence(t, room, []string{"2:bob:1"})
+}
+
+func TestPresenceAcrossInstances(t *testing.T) {
+	store, broadcaster := NewMemoryRoomStore(), NewLocalBroadcaster()
+	first := NewRoomManagerWithBackend("rooms", store, broadcaster)
+	second := NewRoomManagerWithBackend("rooms", store, broadcaster)
+	firstRoom := first.CreateRoom("room", "1", "alice")
+	secondRoom, ok := second.GetRoom("room")
+	if !ok {
+		t.Fatal("second instance does not find the room")
+	}
+
+	joinRoom(t, first, "room", "1", "alice")
+	phone, _ := joinRoom(t, second, "room", "1", "alice")
+	joinRoom(t, second, "room", "2", "bob")
+
+	// Both instances count the sessions of either
+	waitForPresence(t, firstRoom, []string{"1:alice:2", "2:bob:1"})
+	waitForPresence(t, secondRoom, []string{"1:alice:2", "2:bob:1"})
+
+	second.LeaveRoom(phone.SessionID)
+	waitForPresence(t, firstRoom, []string{"1:alice:1", "2:bob:1"})
+	waitForPresence(t, secondRoom, []string{"1:alice:1", "2:bob:1"})
+}
@@ -200,4 +200,18 @@ function setupFuzzySearch(inputId, dropdownId, selectedId, hiddenInputId, data,
 
     // Render any existing selections on initialization
     renderSelectedItems();
+
+    return {
+        // Select an item by its ID, e.g. from a suggestion
+        select(id) {
+            const item = data.find(dataItem => dataItem[idField] === id);
+            if (!item || selectedItems.some(selected => selected.id === id)) {
+                return;
+            }
+            const itemData = { id: item[idField], name: item[nameField] };
+            selectedItems = singleSelect ? [itemData] : [...selectedItems, itemData];
+            renderSelectedItems();
+            updateHiddenInput();
+        }
+    };
 }
\ No newline at end of file
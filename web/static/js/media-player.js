@@ -0,0 +1,306 @@
+/**
+ * Media players
+ * Shared by rating, radio and tournament rooms: one interface over the
+ * embedded players of every media provider (YouTube, SoundCloud, Bilibili,
+ * Niconico and direct audio/video files).
+ *
+ * A player has ready, capabilities, getCurrentTime(), getDuration(),
+ * isPlaying(), play(), pause(), seekTo(seconds) and destroy(). Players whose
+ * provider cannot be synced ignore play, pause and seek.
+ */
+
+const MEDIA_STATE = {
+  PLAYING: "playing",
+  PAUSED: "paused",
+  ENDED: "ended",
+};
+
+const loadedScripts = {};
+
+/**
+ * Load a script once
+ * @param {string} src - Script URL
+ * @returns {Promise}
+ */
+function loadScript(src) {
+  if (!loadedScripts[src]) {
+    loadedScripts[src] = new Promise((resolve, reject) => {
+      const script = document.createElement("script");
+      script.src = src;
+      script.onload = resolve;
+      script.onerror = reject;
+      document.head.appendChild(script);
+    });
+  }
+  return loadedScripts[src];
+}
+
+/**
+ * Create a player for a song in a container element
+ * @param {string} containerId - ID of the element the player replaces
+ * @param {Object} media - provider, embed_url and capabilities of the song
+ * @param {Object} handlers - onReady(player) and onStateChange(state), where
+ *   state is one of MEDIA_STATE
+ * @param {Object} [options] - autoplay (default true)
+ * @returns {Object} - The player
+ */
+function createMediaPlayer(containerId, media, handlers, options = {}) {
+  // Songs shared before providers were recorded only have a YouTube embed URL
+  const provider = media.provider || (/youtube\.com\/embed\//.test(media.embed_url || "") ? "youtube" : "");
+  const create = MEDIA_PLAYERS[provider] || createIframePlayer;
+  const autoplay = options.autoplay !== false;
+  const player = create(containerId, { ...media, autoplay: autoplay }, {
+    onReady: () => {
+      player.ready = true;
+      if (handlers.onReady) handlers.onReady(player);
+    },
+    onStateChange: (state) => {
+      if (handlers.onStateChange) handlers.onStateChange(state);
+    },
+  });
+  player.ready = false;
+  // Without capabilities from the server, trust the players we can control
+  const controllable = create !== createIframePlayer;
+  player.capabilities = media.capabilities || { sync: controllable, end_event: controllable };
+  return player;
+}
+
+/**
+ * Extract the video ID from a YouTube embed URL
+ * @param {string} url - e.g. https://www.youtube.com/embed/VIDEO_ID
+ * @returns {string|null}
+ */
+function extractYouTubeId(url) {
+  const match = url.match(/embed\/([^?]+)/);
+  return match ? match[1] : null;
+}
+
+function createYouTubePlayer(containerId, media, events) {
+  let ytPlayer = null;
+  let destroyed = false;
+
+  const start = () => {
+    if (destroyed) return;
+    if (typeof YT === "undefined" || !YT.Player) {
+      setTimeout(start, 100);
+      return;
+    }
+    ytPlayer = new YT.Player(containerId, {
+      videoId: extractYouTubeId(media.embed_url),
+      playerVars: {
+        autoplay: media.autoplay ? 1 : 0,
+        controls: 1,
+        modestbranding: 1,
+        rel: 0,
+      },
+      events: {
+        onReady: events.onReady,
+        onStateChange: (event) => {
+          if (event.data === YT.PlayerState.PLAYING) events.onStateChange(MEDIA_STATE.PLAYING);
+          else if (event.data === YT.PlayerState.PAUSED) events.onStateChange(MEDIA_STATE.PAUSED);
+          else if (event.data === YT.PlayerState.ENDED) events.onStateChange(MEDIA_STATE.ENDED);
+        },
+      },
+    });
+  };
+  loadScript("https://www.youtube.com/iframe_api").then(start);
+
+  return {
+    getCurrentTime: () => (ytPlayer && ytPlayer.getCurrentTime ? ytPlayer.getCurrentTime() : 0),
+    getDuration: () => (ytPlayer && ytPlayer.getDuration ? ytPlayer.getDuration() : 0),
+    isPlaying: () => !!ytPlayer && ytPlayer.getPlayerState && ytPlayer.getPlayerState() === YT.PlayerState.PLAYING,
+    play: () => ytPlayer && ytPlayer.playVideo(),
+    pause: () => ytPlayer && ytPlayer.pauseVideo(),
+    seekTo: (seconds) => ytPlayer && ytPlayer.seekTo(seconds, true),
+    destroy: () => {
+      destroyed = true;
+      if (ytPlayer) ytPlayer.destroy();
+    },
+  };
+}
+
+/**
+ * Replace a container with an iframe of a song's embedded player
+ * @returns {HTMLIFrameElement}
+ */
+function replaceWithIframe(containerId, media) {
+  const src = new URL(media.embed_url);
+  if (!media.autoplay) {
+    // Embed URLs ask to autoplay; the parameter name depends on the provider
+    if (src.searchParams.has("autoplay")) src.searchParams.set("autoplay", "0");
+    if (src.searchParams.has("auto_play")) src.searchParams.set("auto_play", "false");
+  }
+  const iframe = document.createElement("iframe");
+  iframe.id = containerId;
+  iframe.src = src.toString();
+  iframe.allow = "autoplay; encrypted-media; fullscreen";
+  iframe.setAttribute("allowfullscreen", "");
+  iframe.setAttribute("frameborder", "0");
+  iframe.style.width = "100%";
+  iframe.style.height = "100%";
+  document.getElementById(containerId).replaceWith(iframe);
+  return iframe;
+}
+
+function createSoundCloudPlayer(containerId, media, events) {
+  const iframe = replaceWithIframe(containerId, media);
+  let widget = null;
+  let position = 0;
+  let duration = 0;
+  let playing = false;
+
+  loadScript("https://w.soundcloud.com/player/api.js").then(() => {
+    widget = SC.Widget(iframe);
+    widget.bind(SC.Widget.Events.READY, () => {
+      widget.getDuration((ms) => {
+        duration = ms / 1000;
+        events.onReady();
+      });
+    });
+    widget.bind(SC.Widget.Events.PLAY_PROGRESS, (event) => {
+      position = event.currentPosition / 1000;
+    });
+    widget.bind(SC.Widget.Events.PLAY, () => {
+      playing = true;
+      events.onStateChange(MEDIA_STATE.PLAYING);
+    });
+    widget.bind(SC.Widget.Events.PAUSE, () => {
+      playing = false;
+      events.onStateChange(MEDIA_STATE.PAUSED);
+    });
+    widget.bind(SC.Widget.Events.FINISH, () => {
+      playing = false;
+      events.onStateChange(MEDIA_STATE.ENDED);
+    });
+  });
+
+  return {
+    getCurrentTime: () => position,
+    getDuration: () => duration,
+    isPlaying: () => playing,
+    play: () => widget && widget.play(),
+    pause: () => widget && widget.pause(),
+    seekTo: (seconds) => {
+      position = seconds;
+      if (widget) widget.seekTo(seconds * 1000);
+    },
+    destroy: () => {
+      if (widget) widget.unbind(SC.Widget.Events.FINISH);
+      iframe.remove();
+    },
+  };
+}
+
+function createNiconicoPlayer(containerId, media, events) {
+  const origin = "https://embed.nicovideo.jp";
+  const iframe = replaceWithIframe(containerId, media);
+  let position = 0;
+  let duration = 0;
+  let playing = false;
+  let ready = false;
+
+  // The embedded player talks to the page through postMessage
+  const send = (eventName, data) => {
+    iframe.contentWindow.postMessage(
+      { eventName: eventName, data: data, sourceConnectorType: 1, playerId: "1" },
+      origin
+    );
+  };
+  const onMessage = (event) => {
+    if (event.origin !== origin || !event.data || event.data.playerId !== "1") return;
+    const data = event.data.data || {};
+    switch (event.data.eventName) {
+      case "loadComplete":
+        duration = data.videoInfo ? data.videoInfo.lengthInSeconds : 0;
+        if (!ready) {
+          ready = true;
+          events.onReady();
+        }
+        break;
+      case "playerMetadataChange":
+        position = (data.currentTime || 0) / 1000;
+        if (data.duration) duration = data.duration / 1000;
+        break;
+      case "playerStatusChange":
+        // 2 playing, 3 paused, 4 ended
+        playing = data.playerStatus === 2;
+        if (data.playerStatus === 2) events.onStateChange(MEDIA_STATE.PLAYING);
+        else if (data.playerStatus === 3) events.onStateChange(MEDIA_STATE.PAUSED);
+        else if (data.playerStatus === 4) events.onStateChange(MEDIA_STATE.ENDED);
+        break;
+    }
+  };
+  window.addEventListener("message", onMessage);
+
+  return {
+    getCurrentTime: () => position,
+    getDuration: () => duration,
+    isPlaying: () => playing,
+    play: () => send("play"),
+    pause: () => send("pause"),
+    seekTo: (seconds) => {
+      position = seconds;
+      send("seek", { time: seconds * 1000 });
+    },
+    destroy: () => {
+      window.removeEventListener("message", onMessage);
+      iframe.remove();
+    },
+  };
+}
+
+function createFilePlayer(containerId, media, events) {
+  const video = document.createElement("video");
+  video.id = containerId;
+  video.src = media.embed_url;
+  video.controls = true;
+  video.autoplay = media.autoplay;
+  video.style.width = "100%";
+  video.style.height = "100%";
+  document.getElementById(containerId).replaceWith(video);
+
+  video.addEventListener("loadedmetadata", () => events.onReady(), { once: true });
+  video.addEventListener("playing", () => events.onStateChange(MEDIA_STATE.PLAYING));
+  video.addEventListener("pause", () => {
+    if (!video.ended) events.onStateChange(MEDIA_STATE.PAUSED);
+  });
+  video.addEventListener("ended", () => events.onStateChange(MEDIA_STATE.ENDED));
+
+  return {
+    getCurrentTime: () => video.currentTime,
+    getDuration: () => (isFinite(video.duration) ? video.duration : 0),
+    isPlaying: () => !video.paused && !video.ended,
+    play: () => video.play().catch(() => {}),
+    pause: () => video.pause(),
+    seekTo: (seconds) => {
+      video.currentTime = seconds;
+    },
+    destroy: () => {
+      video.pause();
+      video.remove();
+    },
+  };
+}
+
+// createIframePlayer embeds players that cannot be controlled, e.g. Bilibili
+function createIframePlayer(containerId, media, events) {
+  const iframe = replaceWithIframe(containerId, media);
+  iframe.addEventListener("load", () => events.onReady(), { once: true });
+
+  return {
+    getCurrentTime: () => 0,
+    getDuration: () => 0,
+    isPlaying: () => false,
+    play: () => {},
+    pause: () => {},
+    seekTo: () => {},
+    destroy: () => iframe.remove(),
+  };
+}
+
+const MEDIA_PLAYERS = {
+  youtube: createYouTubePlayer,
+  soundcloud: createSoundCloudPlayer,
+  niconico: createNiconicoPlayer,
+  file: createFilePlayer,
+};
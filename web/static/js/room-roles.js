@@ -0,0 +1,122 @@
+/**
+ * Room roles
+ * Shared by rating, radio and tournament rooms: role checks, role labels,
+ * the host controls shown next to each user and invite links
+ */
+
+const ROOM_ROLE_RANKS = {
+  spectator: 1,
+  member: 2,
+  co_host: 3,
+  host: 4,
+};
+
+const ROOM_ROLE_LABELS = {
+  spectator: "Spectator",
+  member: "Member",
+  co_host: "Co-host",
+  host: "Host",
+};
+
+/**
+ * Check whether a role may do what another role may do
+ * @param {string} role - Role of the user
+ * @param {string} min - Lowest role allowed
+ * @returns {boolean}
+ */
+function roleAtLeast(role, min) {
+  return (ROOM_ROLE_RANKS[role] || 0) >= ROOM_ROLE_RANKS[min];
+}
+
+/**
+ * Find the current user's role in a user list
+ * @param {Array} users - Users from a user_update message
+ * @param {string} userId - ID of the current user
+ * @returns {string} - The role, "member" if the user is not listed
+ */
+function findOwnRole(users, userId) {
+  const me = (users || []).find((user) => user.id === userId);
+  return me && me.role ? me.role : "member";
+}
+
+/**
+ * Create a small label for a user's role; members get none
+ * @param {string} role - Role of the user
+ * @returns {HTMLElement|null}
+ */
+function createRoleBadge(role) {
+  if (!role || role === "member") {
+    return null;
+  }
+  const badge = document.createElement("span");
+  badge.className = `role-badge role-${role}`;
+  badge.textContent = ROOM_ROLE_LABELS[role] || role;
+  return badge;
+}
+
+/**
+ * Create the controls the host gets for another user
+ * @param {Object} user - User from a user_update message
+ * @param {Function} send - Sends a message, called as send(type, data)
+ * @returns {HTMLElement}
+ */
+function createHostControls(user, send) {
+  const controls = document.createElement("span");
+  controls.className = "host-controls";
+
+  const roleSelect = document.createElement("select");
+  roleSelect.title = "Role";
+  ["co_host", "member", "spectator"].forEach((role) => {
+    const option = document.createElement("option");
+    option.value = role;
+    option.textContent = ROOM_ROLE_LABELS[role];
+    option.selected = user.role === role;
+    roleSelect.appendChild(option);
+  });
+  roleSelect.addEventListener("change", () => {
+    send("set_role", { user_id: user.id, role: roleSelect.value });
+  });
+  controls.appendChild(roleSelect);
+
+  const actions = [
+    { type: "transfer_host", label: "Make host", confirm: `Make ${user.username} the host? You will become a co-host.` },
+    { type: "kick_user", label: "Kick", confirm: `Remove ${user.username} from the room?` },
+    { type: "ban_user", label: "Ban", confirm: `Ban ${user.username} from the room?` },
+  ];
+  actions.forEach((action) => {
+    const button = document.createElement("button");
+    button.type = "button";
+    button.className = "host-action";
+    button.textContent = action.label;
+    button.addEventListener("click", () => {
+      if (confirm(action.confirm)) {
+        send(action.type, { user_id: user.id });
+      }
+    });
+    controls.appendChild(button);
+  });
+
+  return controls;
+}
+
+/**
+ * Create an invite link for the current room and copy it to the clipboard.
+ * Only the host and co-hosts may create invite links.
+ */
+async function requestInviteLink() {
+  const response = await fetch(`${window.location.pathname}/invites`, { method: "POST" });
+  const data = await response.json();
+  if (!response.ok) {
+    alert(data.error || "Failed to create invite link");
+    return;
+  }
+
+  const url = window.location.origin + data.url;
+  const expires = new Date(data.expires_at).toLocaleString();
+  try {
+    await navigator.clipboard.writeText(url);
+    alert(`Invite link copied to the clipboard. It works until ${expires}.`);
+  } catch (error) {
+    prompt(`Invite link (works until ${expires}):`, url);
+  }
+}